@@ -0,0 +1,12 @@
+//go:build hook_compliancezones
+
+package main
+
+import (
+	"lead-net-affinity/pkg/controller"
+	"lead-net-affinity/pkg/hooks"
+)
+
+func init() {
+	controller.RegisterHook("compliance-zones", hooks.NewComplianceZones)
+}
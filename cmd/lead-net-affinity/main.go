@@ -2,48 +2,152 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
 	"syscall"
+	"time"
 
 	"lead-net-affinity/pkg/config"
 	"lead-net-affinity/pkg/controller"
+	"lead-net-affinity/pkg/dashboard"
+	"lead-net-affinity/pkg/graph"
 	"lead-net-affinity/pkg/kube"
+	"lead-net-affinity/pkg/output"
+	"lead-net-affinity/pkg/policy"
 	promc "lead-net-affinity/pkg/prometheus"
+	"lead-net-affinity/pkg/rbac"
+	"lead-net-affinity/pkg/supervise"
+	"lead-net-affinity/pkg/tracing"
 )
 
+// maxControllerCrashes in a row of a reconcile loop exit the process.
+const maxControllerCrashes = 5
+
 func main() {
+	kubeconfig := flag.String("kubeconfig", os.Getenv("LEAD_NET_KUBECONFIG"), "path to a kubeconfig (default: in-cluster, then $KUBECONFIG)")
+	contexts := flag.String("context", os.Getenv("LEAD_NET_CONTEXT"),
+		"kubeconfig context(s) to manage, comma-separated; each gets its own reconcile loop")
+	flag.Parse()
+	args := flag.Args()
+
+	// "lead-net-affinity rbac" prints the RBAC manifests the controller needs.
+	if len(args) > 0 && args[0] == "rbac" {
+		printRBAC(args[1:])
+		return
+	}
+	// "lead-net-affinity dashboard" prints the Grafana dashboard.
+	if len(args) > 0 && args[0] == "dashboard" {
+		printDashboard(args[1:])
+		return
+	}
+	// "lead-net-affinity graph import <file>" converts a graph document.
+	if len(args) > 1 && args[0] == "graph" && args[1] == "import" {
+		importGraph(args[2:])
+		return
+	}
+	// "lead-net-affinity diff <before> <after>" compares two snapshots.
+	if len(args) > 0 && args[0] == "diff" {
+		diffSnapshots(args[1:])
+		return
+	}
+	// "lead-net-affinity replay --snapshot <file>" reruns a recorded reconcile.
+	if len(args) > 0 && args[0] == "replay" {
+		replaySnapshot(args[1:])
+		return
+	}
+
 	cfgPath := os.Getenv("LEAD_NET_CONFIG")
 	if cfgPath == "" {
 		cfgPath = "/etc/lead-net-affinity/config.yaml"
 	}
+	// "lead-net-affinity validate [path]" checks a config and exits (helm test).
+	if len(args) > 0 && args[0] == "validate" && len(args) > 1 {
+		cfgPath = args[1]
+	}
 
 	cfg, err := config.Load(cfgPath)
 	if err != nil {
 		log.Fatalf("load config: %v", err)
 	}
-
-	k8sClient, err := kube.NewInCluster()
-	if err != nil {
-		log.Fatalf("init k8s client: %v", err)
+	if len(args) > 0 && args[0] == "validate" {
+		log.Printf("config %s is valid (apiVersion %s)", cfgPath, cfg.APIVersion)
+		return
+	}
+	// "lead-net-affinity graph export" prints the configured graph.
+	if len(args) > 1 && args[0] == "graph" && args[1] == "export" {
+		exportGraph(cfg, args[2:])
+		return
 	}
 
 	promClient, err := promc.NewClient(cfg.Prometheus.URL)
 	if err != nil {
 		log.Fatalf("init prometheus client: %v", err)
 	}
-
-	ctrl := controller.New(cfg, k8sClient, promClient)
+	if err := promClient.SetAuth(promc.Auth(cfg.Prometheus.Auth)); err != nil {
+		log.Fatalf("init prometheus client: %v", err)
+	}
+	if err := promClient.SetTLS(promc.TLS(cfg.Prometheus.TLS)); err != nil {
+		log.Fatalf("init prometheus client: %v", err)
+	}
+	if err := promClient.SetHTTPOptions(cfg.Prometheus.HTTP.Options()); err != nil {
+		log.Fatalf("init prometheus client: %v", err)
+	}
+	promClient.SetNodeQueryTimeout(cfg.Prometheus.NodeQueryTimeout())
 
 	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer cancel()
 
+	// One controller per kubeconfig context ("" = in-cluster / current context).
+	ctxNames := splitList(*contexts)
+	if len(ctxNames) == 0 {
+		ctxNames = []string{""}
+	}
+	// ...and, with tenants configured, one controller per tenant per context.
+	var instances []*instance
+	for _, name := range ctxNames {
+		k8sClient := newKubeClient(cfg, *kubeconfig, name)
+		if len(cfg.Tenants) == 0 {
+			instances = append(instances, newInstance(ctx, cfg, promClient, k8sClient, name, "", len(ctxNames) > 1))
+			continue
+		}
+		for _, t := range cfg.Tenants {
+			instances = append(instances, newInstance(ctx, cfg.ForTenant(t), promClient, k8sClient, name, t.Name, len(ctxNames) > 1))
+		}
+	}
+
+	// "lead-net-affinity reconcile --service=search" runs one scoped reconcile.
+	if len(args) > 0 && args[0] == "reconcile" {
+		scope := parseScope(args[1:])
+		for _, in := range instances {
+			err := in.ctrl.ReconcileScoped(ctx, scope)
+			if errors.Is(err, controller.ErrNoPaths) {
+				log.Printf("nothing to reconcile (%s): %v", in, err)
+				continue
+			}
+			if err != nil {
+				log.Fatalf("scoped reconciliation failed (%s): %v", in, err)
+			}
+		}
+		log.Printf("scoped reconciliation completed successfully")
+		return
+	}
+
 	// ⭐ NEW: Check if we should run once or continuously
 	if os.Getenv("LEAD_NET_ONCE") == "true" {
 		log.Printf("LEAD_NET_ONCE=true - running one-time reconciliation")
-		if err := ctrl.RunOnce(ctx); err != nil {
-			log.Fatalf("one-time reconciliation failed: %v", err)
+		for _, in := range instances {
+			if err := in.ctrl.RunOnce(ctx); err != nil {
+				log.Fatalf("one-time reconciliation failed (%s): %v", in, err)
+			}
 		}
 		log.Printf("one-time reconciliation completed successfully")
 		return
@@ -51,7 +155,493 @@ func main() {
 
 	// Original continuous execution
 	log.Printf("LEAD_NET_ONCE not set - running continuous reconciliation")
-	if err := ctrl.Run(ctx); err != nil {
-		log.Fatalf("controller error: %v", err)
+
+	// Probes, metrics and the scoped reanalyze API.
+	handler := controller.WithDebugEndpoints(httpHandler(instances), cfg.Server.Debug)
+	srv := newAPIServer(cfg.Server, os.Getenv("LEAD_NET_HTTP_ADDR"), handler)
+	srv.Start()
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout())
+		defer cancel()
+		_ = srv.Stop(shutdownCtx)
+	}()
+
+	startPodCaches(ctx, instances)
+
+	errs := make(chan error, len(instances))
+	for _, in := range instances {
+		go func(in *instance) {
+			in.startWatchers(ctx)
+			// A panicking reconcile loop restarts with backoff; one that
+			// keeps crashing exits the process so Kubernetes restarts it.
+			loop := supervise.Loop{Name: "controller", Labels: in.metricLabels(), MaxCrashes: maxControllerCrashes}
+			if err := loop.Run(ctx, in.ctrl.Run); err != nil && !errors.Is(err, context.Canceled) {
+				errs <- fmt.Errorf("%s: %w", in, err)
+				return
+			}
+			errs <- nil
+		}(in)
+	}
+	for range instances {
+		if err := <-errs; err != nil {
+			log.Fatalf("controller error: %v", err)
+		}
+	}
+	// Let in-flight API requests finish before exiting.
+	<-stopped
+}
+
+// instance is one controller managing one kubeconfig context, or one
+// tenant's graph within it.
+type instance struct {
+	name   string
+	tenant string
+	cfg    *config.Config
+	client *kube.Client
+	ctrl   *controller.Controller
+}
+
+// metricLabels match the controller's own metric labels.
+func (in *instance) metricLabels() map[string]string {
+	labels := make(map[string]string, 2)
+	if in.name != "" {
+		labels["context"] = in.name
+	}
+	if in.tenant != "" {
+		labels["tenant"] = in.tenant
+	}
+	return labels
+}
+
+func (in *instance) String() string {
+	if in.tenant == "" {
+		return fmt.Sprintf("context %q", in.name)
+	}
+	return fmt.Sprintf("context %q, tenant %q", in.name, in.tenant)
+}
+
+// newKubeClient builds the client for one context. Tenants on the same
+// context share it.
+func newKubeClient(cfg *config.Config, kubeconfig, name string) *kube.Client {
+	opts := kubeOptions(cfg.Kube)
+	opts.Kubeconfig = kubeconfig
+	opts.Context = name
+	k8sClient, err := kube.New(opts)
+	if err != nil {
+		log.Fatalf("init k8s client (context %q): %v", name, err)
+	}
+	return k8sClient
+}
+
+// newInstance builds the controller for one context or tenant: capability
+// detection, namespace-scoped mode and the status publisher. With several
+// contexts or tenants the status object and the logs/metrics are suffixed
+// per context and tenant.
+func newInstance(
+	ctx context.Context,
+	cfg *config.Config,
+	prom controller.PromClient,
+	k8sClient *kube.Client,
+	name, tenant string,
+	multi bool,
+) *instance {
+	ctrl := controller.New(cfg, k8sClient, prom)
+	if multi {
+		ctrl.SetName(name)
+	}
+	if tenant != "" {
+		ctrl.SetTenant(tenant)
+	}
+
+	if cfg.Controller.NamespaceScoped || os.Getenv("LEAD_NET_NAMESPACE_SCOPED") == "true" {
+		log.Printf("namespace-scoped mode: node access disabled")
+		k8sClient.DisableNodeAccess()
+	}
+
+	// Degrade features we lack permissions for instead of failing at runtime.
+	caps := k8sClient.DetectCapabilities(ctx, cfg.NamespaceSelector)
+	ctrl.SetCapabilities(caps)
+
+	// Publish each reconcile's results into a LeadNetAffinityStatus resource.
+	if os.Getenv("LEAD_NET_STATUS") != "false" && caps.Has(rbac.FeatureStatus) {
+		statusNS := os.Getenv("POD_NAMESPACE")
+		if statusNS == "" {
+			statusNS = "default"
+		}
+		statusName := os.Getenv("LEAD_NET_STATUS_NAME")
+		if statusName == "" {
+			statusName = "lead-net-affinity"
+		}
+		if multi {
+			statusName += "-" + name
+		}
+		if tenant != "" {
+			statusName += "-" + tenant
+		}
+		ctrl.SetStatusPublisher(controller.NewCRStatusPublisher(k8sClient, statusNS, statusName))
+	}
+
+	if cfg.Tracing.JaegerURL != "" {
+		tc, err := tracing.NewClient(cfg.Tracing.JaegerURL)
+		if err != nil {
+			log.Fatalf("init tracing client: %v", err)
+		}
+		if err := tc.SetHTTPOptions(cfg.Tracing.HTTP.Options()); err != nil {
+			log.Fatalf("init tracing client: %v", err)
+		}
+		ctrl.SetTraceSource(tc)
+	}
+
+	if cfg.DNSInference.Enabled {
+		if caps.Has(rbac.FeatureDNSInference) {
+			ctrl.SetDNSLogSource(k8sClient)
+		} else {
+			log.Printf("dnsInference enabled but pods/log access is missing; skipping")
+		}
+	}
+
+	if cfg.Drift.WebhookURL != "" {
+		ctrl.SetDriftNotifier(controller.NewWebhookDriftNotifier(cfg.Drift.WebhookURL))
+	}
+
+	if len(cfg.Hooks) > 0 {
+		hooks, err := controller.HooksFromConfig(cfg.Hooks)
+		if err != nil {
+			log.Fatalf("init decision hooks: %v", err)
+		}
+		ctrl.SetDecisionHooks(hooks...)
+	}
+	if pc := cfg.Policy; pc.WASMModule != "" {
+		ev, err := policy.NewWASIModule(pc.WASMModule, pc.Runtime, time.Duration(pc.TimeoutMs)*time.Millisecond)
+		if err != nil {
+			log.Fatalf("init policy: %v", err)
+		}
+		ctrl.SetPolicy(ev)
+	}
+
+	var cmWriter output.ConfigMapWriter
+	if caps.Has(rbac.FeatureOutput) {
+		cmWriter = k8sClient
+	}
+	sinks, err := output.SinksFromConfig(cfg.Output, cmWriter)
+	if err != nil {
+		log.Fatalf("init output sinks: %v", err)
+	}
+	if len(sinks) > 0 {
+		ctrl.SetOutputSinks(sinks...)
+	}
+	if cfg.Reports.Enabled() {
+		sinks, err := output.SinksFromConfig(cfg.Reports.Destinations(), cmWriter)
+		if err != nil {
+			log.Fatalf("init report sinks: %v", err)
+		}
+		if len(sinks) > 0 {
+			ctrl.SetReportSinks(sinks...)
+		}
+	}
+	if ref := cfg.Output.NodeScoresConfigMap; ref != "" {
+		if s, err := output.NewConfigMapSink(ref, cmWriter); err != nil {
+			log.Printf("node scores not published: %v", err)
+		} else {
+			ctrl.SetNodeScoresSink(s)
+		}
+	}
+
+	var cmStore controller.ConfigMapStore
+	if cmWriter != nil {
+		cmStore = k8sClient
+	}
+	if mc, err := controller.MetricsCacheFromConfig(cfg.MetricsCache, cmStore); err != nil {
+		log.Printf("metrics cache disabled: %v", err)
+	} else if mc != nil {
+		ctrl.SetMetricsCache(mc)
+	}
+
+	return &instance{name: name, tenant: tenant, cfg: cfg, client: k8sClient, ctrl: ctrl}
+}
+
+// startPodCaches serves pod lookups from informers instead of listing on
+// every reconcile. Instances sharing a client share one cache covering all
+// of their namespaces.
+func startPodCaches(ctx context.Context, instances []*instance) {
+	if os.Getenv("LEAD_NET_POD_CACHE") == "false" {
+		return
+	}
+	var clients []*kube.Client
+	namespaces := make(map[*kube.Client][]string)
+	allNamespaces := make(map[*kube.Client]bool)
+	// The service index uses the label keys only: they are shared by all
+	// tenants, per-service selectors are not.
+	identities := make(map[*kube.Client]*kube.ServiceIdentity)
+	for _, in := range instances {
+		if _, ok := namespaces[in.client]; !ok {
+			clients = append(clients, in.client)
+			namespaces[in.client] = nil
+			identities[in.client] = kube.NewServiceIdentity(in.cfg.ServiceLabelKeys, nil)
+		}
+		if len(in.cfg.NamespaceSelector) == 0 {
+			allNamespaces[in.client] = true
+		}
+		for _, ns := range in.cfg.NamespaceSelector {
+			if !slices.Contains(namespaces[in.client], ns) {
+				namespaces[in.client] = append(namespaces[in.client], ns)
+			}
+		}
+	}
+	for _, c := range clients {
+		nsList := namespaces[c]
+		if allNamespaces[c] {
+			nsList = nil
+		}
+		if err := c.EnableInformerCache(ctx, nsList, identities[c]); err != nil {
+			log.Printf("pod informer cache disabled: %v", err)
+		}
+	}
+}
+
+// startWatchers enables event-driven reconciles.
+func (in *instance) startWatchers(ctx context.Context) {
+	if in.cfg.Controller.EventTriggers {
+		if err := in.client.WatchChanges(ctx, in.cfg.NamespaceSelector, in.ctrl.ServiceIdentity(), in.ctrl.IsGraphService, in.ctrl.Trigger, in.ctrl.ForgetNode); err != nil {
+			log.Printf("event-driven reconciles disabled (%s): %v", in, err)
+		}
+	}
+}
+
+// httpHandler serves the first instance at the root and, with several,
+// each one under /contexts/<name>/ (several contexts) and/or
+// /tenants/<tenant>/ (tenants).
+func httpHandler(instances []*instance) http.Handler {
+	if len(instances) == 1 {
+		return instances[0].ctrl.Handler()
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/", instances[0].ctrl.Handler())
+	for _, in := range instances {
+		var prefix string
+		if in.name != "" {
+			prefix += "/contexts/" + in.name
+		}
+		if in.tenant != "" {
+			prefix += "/tenants/" + in.tenant
+		}
+		mux.Handle(prefix+"/", http.StripPrefix(prefix, in.ctrl.Handler()))
+	}
+	return mux
+}
+
+// printRBAC writes the ServiceAccount, ClusterRole and binding generated from
+// pkg/rbac to stdout (deploy/rbac.yaml is produced this way). With
+// --namespaces it writes per-namespace Roles for namespace-scoped mode, with
+// --rules only the rules the Helm chart embeds.
+func printRBAC(args []string) {
+	fs := flag.NewFlagSet("rbac", flag.ExitOnError)
+	name := fs.String("name", "lead-net-affinity", "name of the ServiceAccount and ClusterRole")
+	namespace := fs.String("namespace", "default", "namespace of the ServiceAccount")
+	features := fs.String("features", "", "only grant these features (comma-separated, default all)")
+	namespaces := fs.String("namespaces", "", "emit namespace-scoped Roles for these namespaces instead of a ClusterRole")
+	rulesOnly := fs.Bool("rules", false, "only print the ClusterRole rules (the Helm chart's files/rbac-rules.yaml)")
+	_ = fs.Parse(args)
+
+	var fl []rbac.Feature
+	for _, f := range splitList(*features) {
+		fl = append(fl, rbac.Feature(f))
+	}
+	var out []byte
+	var err error
+	if *rulesOnly {
+		out, err = rbac.RulesYAML(fl...)
+	} else if nsList := splitList(*namespaces); len(nsList) > 0 {
+		out, err = rbac.NamespacedManifests(*name, *namespace, nsList, fl...)
+	} else {
+		out, err = rbac.Manifests(*name, *namespace, fl...)
+	}
+	if err != nil {
+		log.Fatalf("render rbac: %v", err)
+	}
+	os.Stdout.Write(out)
+}
+
+// printDashboard writes the Grafana dashboard JSON to stdout; with
+// --configmap as a ConfigMap for the Grafana dashboard sidecar.
+func printDashboard(args []string) {
+	fs := flag.NewFlagSet("dashboard", flag.ExitOnError)
+	asConfigMap := fs.Bool("configmap", false, "print a ConfigMap labelled for the Grafana dashboard sidecar")
+	name := fs.String("name", "lead-net-affinity-dashboard", "name of the ConfigMap")
+	namespace := fs.String("namespace", "monitoring", "namespace of the ConfigMap")
+	_ = fs.Parse(args)
+
+	var out []byte
+	var err error
+	if *asConfigMap {
+		out, err = dashboard.ConfigMap(*name, *namespace)
+	} else {
+		out, err = dashboard.JSON()
+	}
+	if err != nil {
+		log.Fatalf("render dashboard: %v", err)
+	}
+	os.Stdout.Write(out)
+}
+
+// exportGraph writes the configured graph as a graph document to stdout.
+func exportGraph(cfg *config.Config, args []string) {
+	fs := flag.NewFlagSet("graph export", flag.ExitOnError)
+	format := fs.String("format", graph.FormatYAML, "output format: yaml, json or graphml")
+	_ = fs.Parse(args)
+
+	doc := cfg.Graph.Document()
+	if err := doc.Validate(); err != nil {
+		log.Fatalf("export graph: %v", err)
+	}
+	out, err := doc.Marshal(*format)
+	if err != nil {
+		log.Fatalf("export graph: %v", err)
+	}
+	os.Stdout.Write(out)
+}
+
+// importGraph validates a graph document (YAML, JSON or GraphML) and writes
+// it to stdout in the requested format, ready for graph.file.
+func importGraph(args []string) {
+	fs := flag.NewFlagSet("graph import", flag.ExitOnError)
+	from := fs.String("from", "", "input format: yaml, json or graphml (default: detect)")
+	format := fs.String("format", graph.FormatYAML, "output format: yaml, json or graphml")
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 {
+		log.Fatalf("usage: lead-net-affinity graph import [--from=graphml] [--format=yaml] <file>")
+	}
+
+	data, err := os.ReadFile(fs.Arg(0))
+	if err != nil {
+		log.Fatalf("import graph: %v", err)
+	}
+	doc, err := graph.ParseDocument(data, *from)
+	if err != nil {
+		log.Fatalf("import graph: %v", err)
+	}
+	out, err := doc.Marshal(*format)
+	if err != nil {
+		log.Fatalf("import graph: %v", err)
+	}
+	os.Stdout.Write(out)
+}
+
+// diffSnapshots compares two snapshots (GET /decisions output or graph
+// documents), e.g. from before and after a release.
+func diffSnapshots(args []string) {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	format := fs.String("format", "text", "output format: text or json")
+	_ = fs.Parse(args)
+	if fs.NArg() != 2 {
+		log.Fatalf("usage: lead-net-affinity diff [--format=text] <before> <after>")
+	}
+
+	var snaps [2]controller.Decisions
+	for i, path := range fs.Args() {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			log.Fatalf("diff: %v", err)
+		}
+		if snaps[i], err = controller.ParseSnapshot(data); err != nil {
+			log.Fatalf("diff: %s: %v", path, err)
+		}
+	}
+	d := controller.DiffDecisions(snaps[0], snaps[1])
+	switch *format {
+	case "text":
+		d.WriteText(os.Stdout)
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(d)
+	default:
+		log.Fatalf("diff: unknown format %q", *format)
+	}
+}
+
+// replaySnapshot reruns the decision pipeline on a snapshot (GET /snapshot
+// with server.debug.record) and prints the decisions like GET /decisions.
+// It exits 1 if they differ from the decisions recorded with the snapshot.
+func replaySnapshot(args []string) {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	path := fs.String("snapshot", "", "snapshot file (GET /snapshot output)")
+	_ = fs.Parse(args)
+	if *path == "" {
+		log.Fatalf("usage: lead-net-affinity replay --snapshot <file>")
+	}
+
+	data, err := os.ReadFile(*path)
+	if err != nil {
+		log.Fatalf("replay: %v", err)
+	}
+	var snap controller.Snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		log.Fatalf("replay: %s: %v", *path, err)
+	}
+	d, err := controller.Replay(context.Background(), snap)
+	if err != nil {
+		log.Fatalf("replay: %v", err)
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(d)
+
+	if snap.Decisions == nil {
+		return
+	}
+	if diff := controller.DiffDecisions(*snap.Decisions, d); !diff.Empty() || d.ID != snap.Decisions.ID {
+		log.Printf("replay decided %s, the snapshot recorded %s:", d.ID, snap.Decisions.ID)
+		diff.WriteText(os.Stderr)
+		os.Exit(1)
+	}
+	log.Printf("replay matches the recorded decision %s", snap.Decisions.ID)
+}
+
+// kubeOptions builds the client rate limits from config, letting
+// LEAD_NET_KUBE_QPS and LEAD_NET_KUBE_BURST override them.
+func kubeOptions(kc config.KubeClientConfig) kube.Options {
+	opts := kube.Options{QPS: kc.QPS, Burst: kc.Burst}
+	if v := os.Getenv("LEAD_NET_KUBE_QPS"); v != "" {
+		if f, err := strconv.ParseFloat(v, 32); err == nil && f > 0 {
+			opts.QPS = float32(f)
+		} else {
+			log.Printf("ignoring invalid LEAD_NET_KUBE_QPS=%q", v)
+		}
+	}
+	if v := os.Getenv("LEAD_NET_KUBE_BURST"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			opts.Burst = n
+		} else {
+			log.Printf("ignoring invalid LEAD_NET_KUBE_BURST=%q", v)
+		}
+	}
+	return opts
+}
+
+// parseScope parses the flags of the "reconcile" subcommand. Both flags take
+// a comma-separated list.
+func parseScope(args []string) controller.Scope {
+	fs := flag.NewFlagSet("reconcile", flag.ExitOnError)
+	services := fs.String("service", "", "only reconcile paths containing these services (comma-separated)")
+	namespaces := fs.String("namespace", "", "only patch deployments in these namespaces (comma-separated)")
+	_ = fs.Parse(args)
+
+	return controller.Scope{
+		Services:   splitList(*services),
+		Namespaces: splitList(*namespaces),
+	}
+}
+
+func splitList(v string) []string {
+	var out []string
+	for _, p := range strings.Split(v, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
 	}
+	return out
 }
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+
+	"lead-net-affinity/pkg/config"
+)
+
+// apiServer is the embedded HTTP server: probes, /metrics and the API.
+type apiServer struct {
+	srv *http.Server
+	cfg config.ServerConfig
+}
+
+func newAPIServer(cfg config.ServerConfig, addr string, h http.Handler) *apiServer {
+	if addr == "" {
+		addr = cfg.AddressOrDefault()
+	}
+	return &apiServer{
+		cfg: cfg,
+		srv: &http.Server{
+			Addr:              addr,
+			Handler:           h,
+			ReadTimeout:       cfg.ReadTimeout(),
+			ReadHeaderTimeout: cfg.ReadHeaderTimeout(),
+			WriteTimeout:      cfg.WriteTimeout(),
+			IdleTimeout:       cfg.IdleTimeout(),
+			MaxHeaderBytes:    cfg.MaxHeaderBytes,
+		},
+	}
+}
+
+// Start serves in the background, over HTTPS if a certificate is set.
+func (s *apiServer) Start() {
+	go func() {
+		var err error
+		if s.cfg.TLSCertFile != "" {
+			log.Printf("serving /healthz, /readyz, /metrics on %s (https)", s.srv.Addr)
+			err = s.srv.ListenAndServeTLS(s.cfg.TLSCertFile, s.cfg.TLSKeyFile)
+		} else {
+			log.Printf("serving /healthz, /readyz, /metrics on %s", s.srv.Addr)
+			err = s.srv.ListenAndServe()
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("http server error: %v", err)
+		}
+	}()
+}
+
+// Stop stops accepting connections and waits for in-flight requests until
+// ctx is done, then closes the remaining connections.
+func (s *apiServer) Stop(ctx context.Context) error {
+	err := s.srv.Shutdown(ctx)
+	if err != nil {
+		log.Printf("http server did not drain in time: %v", err)
+		_ = s.srv.Close()
+	}
+	return err
+}
@@ -0,0 +1,126 @@
+{{- define "lead-net-affinity.name" -}}
+{{- .Chart.Name | trunc 63 | trimSuffix "-" -}}
+{{- end -}}
+
+{{- define "lead-net-affinity.fullname" -}}
+{{- if contains .Chart.Name .Release.Name -}}
+{{- .Release.Name | trunc 63 | trimSuffix "-" -}}
+{{- else -}}
+{{- printf "%s-%s" .Release.Name .Chart.Name | trunc 63 | trimSuffix "-" -}}
+{{- end -}}
+{{- end -}}
+
+{{- define "lead-net-affinity.labels" -}}
+app.kubernetes.io/name: {{ include "lead-net-affinity.name" . }}
+app.kubernetes.io/instance: {{ .Release.Name }}
+app.kubernetes.io/version: {{ .Chart.AppVersion | quote }}
+app.kubernetes.io/managed-by: {{ .Release.Service }}
+helm.sh/chart: {{ printf "%s-%s" .Chart.Name .Chart.Version }}
+{{- end -}}
+
+{{- define "lead-net-affinity.selectorLabels" -}}
+app.kubernetes.io/name: {{ include "lead-net-affinity.name" . }}
+app.kubernetes.io/instance: {{ .Release.Name }}
+{{- end -}}
+
+{{- define "lead-net-affinity.serviceAccountName" -}}
+{{- default (include "lead-net-affinity.fullname" .) .Values.serviceAccount.name -}}
+{{- end -}}
+
+{{- define "lead-net-affinity.image" -}}
+{{- printf "%s:%s" .Values.image.repository (default .Chart.AppVersion .Values.image.tag) -}}
+{{- end -}}
+
+{{/*
+config.yaml as the controller reads it. apiVersion pins the schema the chart
+was written for; the controller refuses configs for schemas it does not know.
+*/}}
+{{- define "lead-net-affinity.config" -}}
+apiVersion: lead.io/v1alpha1
+{{ toYaml .Values.config }}
+{{- end -}}
+
+{{- define "lead-net-affinity.env" -}}
+- name: POD_NAMESPACE
+  valueFrom:
+    fieldRef:
+      fieldPath: metadata.namespace
+- name: LEAD_NET_CONFIG
+  value: /etc/lead-net-affinity/config.yaml
+- name: LEAD_NET_LOG
+  value: {{ .Values.logLevel | quote }}
+- name: LEAD_NET_DRYRUN
+  value: {{ .Values.dryRun | quote }}
+- name: LEAD_NET_DRY_DELETE
+  value: {{ .Values.dryDelete | quote }}
+- name: LEAD_NET_STATUS
+  value: {{ .Values.status.enabled | quote }}
+- name: LEAD_NET_STATUS_NAME
+  value: {{ include "lead-net-affinity.fullname" . }}
+{{- if eq .Values.mode "once" }}
+- name: LEAD_NET_ONCE
+  value: "true"
+{{- end }}
+{{- with .Values.extraEnv }}
+{{ toYaml . }}
+{{- end }}
+{{- end -}}
+
+{{- define "lead-net-affinity.podSpec" -}}
+serviceAccountName: {{ include "lead-net-affinity.serviceAccountName" . }}
+containers:
+  - name: controller
+    image: {{ include "lead-net-affinity.image" . }}
+    imagePullPolicy: {{ .Values.image.pullPolicy }}
+    env:
+      {{- include "lead-net-affinity.env" . | nindent 6 }}
+    {{- if eq .Values.mode "continuous" }}
+    ports:
+      - name: http
+        containerPort: 8080
+    livenessProbe:
+      httpGet:
+        path: /healthz
+        port: http
+    readinessProbe:
+      httpGet:
+        path: /readyz
+        port: http
+    {{- end }}
+    {{- with .Values.resources }}
+    resources:
+      {{- toYaml . | nindent 6 }}
+    {{- end }}
+    volumeMounts:
+      - name: cfg
+        mountPath: /etc/lead-net-affinity
+      {{- range .Values.secretMounts }}
+      - name: {{ .name }}
+        mountPath: {{ .mountPath }}
+        readOnly: true
+      {{- end }}
+    securityContext:
+      readOnlyRootFilesystem: true
+      allowPrivilegeEscalation: false
+{{- with .Values.nodeSelector }}
+nodeSelector:
+  {{- toYaml . | nindent 2 }}
+{{- end }}
+{{- with .Values.tolerations }}
+tolerations:
+  {{- toYaml . | nindent 2 }}
+{{- end }}
+{{- with .Values.affinity }}
+affinity:
+  {{- toYaml . | nindent 2 }}
+{{- end }}
+volumes:
+  - name: cfg
+    configMap:
+      name: {{ include "lead-net-affinity.fullname" . }}
+  {{- range .Values.secretMounts }}
+  - name: {{ .name }}
+    secret:
+      secretName: {{ .secretName }}
+  {{- end }}
+{{- end -}}
@@ -0,0 +1,153 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// WeightBudgetConfig bounds the preferred pod affinity generated for one
+// service (see rulegen.WeightBudget).
+type WeightBudgetConfig struct {
+	MaxTotalWeight int      `yaml:"maxTotalWeight"` // sum of term weights; 0 = unlimited
+	MaxTerms       int      `yaml:"maxTerms"`       // 0 = unlimited
+	Priority       []string `yaml:"priority"`       // sources, highest first: path, dependency
+}
+
+// Validate rejects negative limits and unknown or repeated sources.
+func (b WeightBudgetConfig) Validate() error {
+	if b.MaxTotalWeight < 0 || b.MaxTerms < 0 {
+		return fmt.Errorf("affinity.weightBudget limits must not be negative, got %+v", b)
+	}
+	seen := make(map[string]bool, len(b.Priority))
+	for _, s := range b.Priority {
+		if s != "path" && s != "dependency" {
+			return fmt.Errorf("affinity.weightBudget.priority: unknown source %q (want path or dependency)", s)
+		}
+		if seen[s] {
+			return fmt.Errorf("affinity.weightBudget.priority: %q listed twice", s)
+		}
+		seen[s] = true
+	}
+	return nil
+}
+
+// DirectDependencyConfig configures direct-dependency affinity rules.
+type DirectDependencyConfig struct {
+	Enabled bool     `yaml:"enabled"`
+	Weight  int      `yaml:"weight"`  // default 80, at most maxAffinityWeight
+	Exclude []string `yaml:"exclude"` // services never given or attracting these rules
+}
+
+// validate checks the weight range.
+func (d DirectDependencyConfig) validate() error {
+	if d.Weight < 0 || d.Weight > 100 {
+		return fmt.Errorf("affinity.directDependencies.weight must be 0-100, got %d", d.Weight)
+	}
+	return nil
+}
+
+// DefaultReverseWeightFactor scales mirrored terms (see SymmetricConfig).
+const DefaultReverseWeightFactor = 0.5
+
+// SymmetricConfig also pulls callers toward their callees, so whichever
+// side restarts first lands next to the other.
+type SymmetricConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// ReverseWeightFactor scales the reverse terms' weights (0 < f <= 1);
+	// default 0.5.
+	ReverseWeightFactor float64 `yaml:"reverseWeightFactor"`
+}
+
+// FactorOrDefault returns ReverseWeightFactor, or the default when unset.
+func (s SymmetricConfig) FactorOrDefault() float64 {
+	if s.ReverseWeightFactor <= 0 {
+		return DefaultReverseWeightFactor
+	}
+	return s.ReverseWeightFactor
+}
+
+// validate checks the factor range.
+func (s SymmetricConfig) validate() error {
+	if s.ReverseWeightFactor < 0 || s.ReverseWeightFactor > 1 {
+		return fmt.Errorf("affinity.symmetric.reverseWeightFactor must be in (0, 1], got %v", s.ReverseWeightFactor)
+	}
+	return nil
+}
+
+// DefaultZonePlanWeight is the node affinity weight of the zone most of a
+// service's traffic comes from (see ZonePlanConfig).
+const DefaultZonePlanWeight = 50
+
+// ZonePlanConfig spreads each service's replicas over zones in proportion
+// to where its callers' traffic originates, with a zone topology spread
+// constraint and zone-weighted node affinity. The plan is served on
+// GET /zones/plan.
+type ZonePlanConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Weight is the node affinity weight of the busiest zone (1-100,
+	// default 50); other zones get their share of it.
+	Weight int `yaml:"weight"`
+}
+
+// WeightOrDefault returns Weight, or the default when unset.
+func (z ZonePlanConfig) WeightOrDefault() int {
+	if z.Weight <= 0 {
+		return DefaultZonePlanWeight
+	}
+	return z.Weight
+}
+
+// validate checks the weight range.
+func (z ZonePlanConfig) validate() error {
+	if z.Weight < 0 || z.Weight > 100 {
+		return fmt.Errorf("affinity.zonePlan.weight must be 0-100, got %d", z.Weight)
+	}
+	return nil
+}
+
+// Defaults of VerificationConfig.
+const (
+	DefaultVerificationSettleSeconds    = 300
+	DefaultVerificationFailureThreshold = 3
+)
+
+// VerificationConfig checks, after pods rescheduled under a generated pod
+// affinity term, whether they actually landed next to (same node or zone
+// as) the term's peer, and flags terms that keep failing. Results are
+// served on GET /verification.
+type VerificationConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// SettleSeconds a term must be in place before pods created since are
+	// checked (default 300).
+	SettleSeconds int `yaml:"settleSeconds"`
+	// FailureThreshold failed checks in a row flag a term for review
+	// (default 3).
+	FailureThreshold int `yaml:"failureThreshold"`
+	// Escalate relaxes a flagged same-node term to the zone level instead
+	// of only flagging it.
+	Escalate bool `yaml:"escalate"`
+}
+
+// SettleOrDefault returns SettleSeconds as a duration, or the default when unset.
+func (v VerificationConfig) SettleOrDefault() time.Duration {
+	if v.SettleSeconds <= 0 {
+		return DefaultVerificationSettleSeconds * time.Second
+	}
+	return time.Duration(v.SettleSeconds) * time.Second
+}
+
+// ThresholdOrDefault returns FailureThreshold, or the default when unset.
+func (v VerificationConfig) ThresholdOrDefault() int {
+	if v.FailureThreshold <= 0 {
+		return DefaultVerificationFailureThreshold
+	}
+	return v.FailureThreshold
+}
+
+// validate rejects negative values.
+func (v VerificationConfig) validate() error {
+	if v.SettleSeconds < 0 || v.FailureThreshold < 0 {
+		return fmt.Errorf("affinity.verification values must not be negative, got %+v", v)
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package config
+
+import "fmt"
+
+// PrometheusAuth holds Prometheus credentials: a bearer token or HTTP basic
+// auth. Keep secrets out of the config file with the *File fields (a
+// mounted Secret, re-read when it changes) or ${ENV} interpolation.
+type PrometheusAuth struct {
+	BearerToken     string `yaml:"bearerToken"`
+	BearerTokenFile string `yaml:"bearerTokenFile"`
+	Username        string `yaml:"username"`
+	Password        string `yaml:"password"`
+	PasswordFile    string `yaml:"passwordFile"`
+}
+
+// Validate rejects ambiguous credentials.
+func (a PrometheusAuth) Validate() error {
+	if a.BearerToken != "" && a.BearerTokenFile != "" {
+		return fmt.Errorf("prometheus.auth: bearerToken and bearerTokenFile are mutually exclusive")
+	}
+	if a.Password != "" && a.PasswordFile != "" {
+		return fmt.Errorf("prometheus.auth: password and passwordFile are mutually exclusive")
+	}
+	if (a.BearerToken != "" || a.BearerTokenFile != "") && a.Username != "" {
+		return fmt.Errorf("prometheus.auth: set either a bearer token or username/password, not both")
+	}
+	if (a.Password != "" || a.PasswordFile != "") && a.Username == "" {
+		return fmt.Errorf("prometheus.auth: password needs a username")
+	}
+	return nil
+}
+
+// PrometheusTLS configures HTTPS to Prometheus behind a private CA or
+// requiring client certificates. The client certificate is re-read when it
+// changes.
+type PrometheusTLS struct {
+	CAFile             string `yaml:"caFile"`
+	CertFile           string `yaml:"certFile"`
+	KeyFile            string `yaml:"keyFile"`
+	ServerName         string `yaml:"serverName"`
+	InsecureSkipVerify bool   `yaml:"insecureSkipVerify"`
+}
+
+// Validate rejects a client certificate without its key and vice versa.
+func (t PrometheusTLS) Validate() error {
+	if (t.CertFile == "") != (t.KeyFile == "") {
+		return fmt.Errorf("prometheus.tls: certFile and keyFile must be set together")
+	}
+	return nil
+}
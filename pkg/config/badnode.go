@@ -0,0 +1,22 @@
+package config
+
+import "fmt"
+
+// How bad nodes are kept free of new pods (rebalancing.badNodeMode).
+const (
+	// BadNodeAntiAffinity appends a NotIn node anti-affinity to every
+	// deployment with pods on a bad node. This is the default.
+	BadNodeAntiAffinity = "anti-affinity"
+	// BadNodeTaint taints bad nodes lead.io/degraded=true:PreferNoSchedule
+	// and removes the taint once they recover; deployments are not touched.
+	BadNodeTaint = "taint"
+)
+
+// validateBadNodeMode rejects unknown modes; "" means anti-affinity.
+func (r RebalancingConfig) validateBadNodeMode() error {
+	switch r.BadNodeMode {
+	case "", BadNodeAntiAffinity, BadNodeTaint:
+		return nil
+	}
+	return fmt.Errorf("rebalancing.badNodeMode: unknown mode %q (want %s or %s)", r.BadNodeMode, BadNodeAntiAffinity, BadNodeTaint)
+}
@@ -0,0 +1,45 @@
+package config
+
+import "fmt"
+
+// Defaults for CacheConfig.
+const (
+	DefaultMaxCachedNodes    = 5000
+	DefaultMaxCachedEdges    = 50000
+	DefaultMaxCachedPaths    = 1000
+	DefaultMaxCachedServices = 1000
+)
+
+// CacheConfig bounds the controller's long-lived in-memory state. When a
+// cache is full, the entries updated longest ago are evicted first. Nodes
+// deleted from the cluster are evicted right away.
+type CacheConfig struct {
+	MaxNodes    int `yaml:"maxNodes"`    // node metrics kept (metrics cache, smoothing); default 5000
+	MaxEdges    int `yaml:"maxEdges"`    // service edge latencies/RPS kept; default 50000
+	MaxPaths    int `yaml:"maxPaths"`    // paths with score history (GET /paths/history); default 1000
+	MaxServices int `yaml:"maxServices"` // services with metric history (GET /services/history); default 1000
+}
+
+// NodesOrDefault, EdgesOrDefault, PathsOrDefault and ServicesOrDefault
+// return the limits with defaults applied.
+func (c CacheConfig) NodesOrDefault() int { return orDefault(c.MaxNodes, DefaultMaxCachedNodes) }
+func (c CacheConfig) EdgesOrDefault() int { return orDefault(c.MaxEdges, DefaultMaxCachedEdges) }
+func (c CacheConfig) PathsOrDefault() int { return orDefault(c.MaxPaths, DefaultMaxCachedPaths) }
+func (c CacheConfig) ServicesOrDefault() int {
+	return orDefault(c.MaxServices, DefaultMaxCachedServices)
+}
+
+func orDefault(v, def int) int {
+	if v <= 0 {
+		return def
+	}
+	return v
+}
+
+// Validate rejects negative limits.
+func (c CacheConfig) Validate() error {
+	if c.MaxNodes < 0 || c.MaxEdges < 0 || c.MaxPaths < 0 || c.MaxServices < 0 {
+		return fmt.Errorf("caches limits must not be negative, got %+v", c)
+	}
+	return nil
+}
@@ -1,28 +1,112 @@
 package config
 
 import (
+	"fmt"
 	"os"
+	"path"
+	"path/filepath"
 
-	"gopkg.in/yaml.v3"
+	"lead-net-affinity/pkg/graph"
 )
 
 type ServiceNode struct {
 	Name          string            `yaml:"name"`
 	DependsOn     []string          `yaml:"dependsOn"`
 	LabelSelector map[string]string `yaml:"labelSelector,omitempty"`
+
+	// LatencyCritical gives the service Guaranteed QoS with whole CPUs and
+	// prefers static CPU manager nodes (affinity.cpuManagerNodeLabel).
+	LatencyCritical bool `yaml:"latencyCritical,omitempty"`
+
+	// Version, Owner (owning team) and Metadata are reported with the
+	// service in /graph and /decisions. Unset Version and Owner come from
+	// the Deployment (see kube.DeploymentVersion and kube.DeploymentOwner).
+	Version  string            `yaml:"version,omitempty"`
+	Owner    string            `yaml:"owner,omitempty"`
+	Metadata map[string]string `yaml:"metadata,omitempty"`
+
+	// Ports the service listens on. Unset, they are discovered from the
+	// Kubernetes Services selecting the service's pods. The app protocol
+	// (appProtocol, else the Istio port naming convention) decides which
+	// prometheus.edgeFamilies measure its edges.
+	Ports []graph.Port `yaml:"ports,omitempty"`
+
+	// External marks a service running outside the cluster; see
+	// ExternalEndpoint.
+	External *ExternalEndpoint `yaml:"external,omitempty"`
 }
 
 type ServiceGraphConfig struct {
 	Services []ServiceNode `yaml:"services"`
 	Entry    string        `yaml:"entry"`
+
+	// File loads the services from a graph document (YAML, JSON or
+	// GraphML, see graph.Document) instead of declaring them here. entry
+	// overrides the document's entry.
+	File string `yaml:"file,omitempty"`
 }
 
 type PrometheusConfig struct {
 	URL                string `yaml:"url"`
-	NodeRTTQuery       string `yaml:"NodeRTTQuery"`
-	NodeDropRateQuery  string `yaml:"NodeDropRateQuery"`
-	NodeBandwidthQuery string `yaml:"NodeBandwidthQuery"`
+	NodeRTTQuery       string `yaml:"nodeRTTQuery"`
+	NodeDropRateQuery  string `yaml:"nodeDropRateQuery"`
+	NodeBandwidthQuery string `yaml:"nodeBandwidthQuery"`
 	SampleWindow       string `yaml:"sampleWindow"`
+
+	// Capitalized spellings of the node queries read by older releases;
+	// see applyLegacyKeys.
+	legacyNodeQueries `yaml:",inline"`
+
+	// NodeIPFamily is the address family tried first when matching node
+	// addresses to the instance labels of the node queries on dual-stack
+	// clusters: ipv4 (default) or ipv6. The other family is still tried.
+	NodeIPFamily string `yaml:"nodeIPFamily"`
+	// NodeQueryTimeoutSeconds bounds each node query, retries included
+	// (default 20). The queries run concurrently; one that fails or
+	// times out leaves only its dimension out of the network metrics.
+	NodeQueryTimeoutSeconds float64 `yaml:"nodeQueryTimeoutSeconds"`
+
+	// Pairwise service latency (Hubble/Istio edge metrics keyed by src/dst).
+	ServicePairLatencyQuery string `yaml:"servicePairLatencyQuery"`
+	ServicePairSrcLabel     string `yaml:"servicePairSrcLabel"`
+	ServicePairDstLabel     string `yaml:"servicePairDstLabel"`
+	ServicePairLatencyUnit  string `yaml:"servicePairLatencyUnit"` // s (default), ms or us
+	ServicePairRPSQuery     string `yaml:"servicePairRPSQuery"`
+	// EdgeFamilies add gRPC, TCP or other request rate and latency
+	// series for edges the queries above miss; see EdgeFamilyConfig.
+	EdgeFamilies []EdgeFamilyConfig `yaml:"edgeFamilies,omitempty"`
+	// ServicePairBytesQuery is a per-edge byte rate, used only for the
+	// effectiveness report (GET /effectiveness).
+	ServicePairBytesQuery string `yaml:"servicePairBytesQuery"`
+
+	// EdgeSource selects a preset for the servicePair* settings
+	// ("otel-servicegraph"); see ApplyEdgeSource.
+	EdgeSource       string `yaml:"edgeSource"`
+	EdgeMetricPrefix string `yaml:"edgeMetricPrefix"` // exporter namespace, if the collector sets one
+	EdgeSelector     string `yaml:"edgeSelector"`     // extra label matchers, e.g. env="prod"
+
+	// Auth is sent with every query; TLS applies to https URLs.
+	// KubeStateMetrics reads Deployment rollout state from
+	// kube-state-metrics, so replica decisions wait for earlier ones to
+	// take effect.
+	KubeStateMetrics KubeStateMetricsConfig `yaml:"kubeStateMetrics"`
+
+	// Gateway measures user-facing latency at the entry point; see
+	// GatewayConfig.
+	Gateway GatewayConfig `yaml:"gateway"`
+
+	Auth PrometheusAuth   `yaml:"auth"`
+	TLS  PrometheusTLS    `yaml:"tls"`
+	HTTP HTTPClientConfig `yaml:"http"` // proxy, extra headers, query timeout (default 10s)
+}
+
+// KubeStateMetricsConfig enables the kube_deployment_* series. While a
+// Deployment's rollout is in progress (replicas not yet updated and
+// available, or the spec not yet observed) its replica recommendation is
+// not re-evaluated and rebalancing does not surge it again.
+type KubeStateMetricsConfig struct {
+	Enabled  bool   `yaml:"enabled"`
+	Selector string `yaml:"selector"` // extra label matchers, e.g. job="kube-state-metrics"
 }
 
 type ScoringWeights struct {
@@ -36,6 +120,39 @@ type ScoringWeights struct {
 	NetLatencyWeight   float64 `yaml:"netLatencyWeight"`
 	NetDropWeight      float64 `yaml:"netDropWeight"`
 	NetBandwidthWeight float64 `yaml:"netBandwidthWeight"`
+	EdgeLatencyWeight  float64 `yaml:"edgeLatencyWeight"`
+	BadEdgeLatencyMs   float64 `yaml:"badEdgeLatencyMs"`
+	SameNodeBonus      float64 `yaml:"sameNodeBonus"`
+	SameZoneBonus      float64 `yaml:"sameZoneBonus"`
+
+	// StaleAfterSeconds discounts metrics older than this in scoring
+	// (weight scales by staleAfter/age); 0 disables the age discount.
+	StaleAfterSeconds int `yaml:"staleAfterSeconds"`
+
+	// Limits bounds metric samples before they are scored.
+	Limits ScoringLimits `yaml:"limits"`
+
+	// NodeAggregation combines the node severities of a service with pods
+	// on several nodes: "worst" (default) or "weighted" (by pods per node).
+	NodeAggregation string `yaml:"nodeAggregation"`
+
+	// ReplicaAggregation combines a node's closeness to each replica of a
+	// dependency in proximity scoring: "max" (default; one co-located pod
+	// is enough), "min" (every pod must be close) or "weighted" (by the
+	// share of pods that are close).
+	ReplicaAggregation string `yaml:"replicaAggregation"`
+
+	// Pareto also ranks paths by latency, cost and resilience separately
+	// and serves the Pareto-optimal set on GET /paths/pareto.
+	Pareto ParetoConfig `yaml:"pareto"`
+}
+
+// ParetoConfig enables multi-objective path ranking. An operator picks a
+// point on the front with POST /paths/pareto/select?path= (which needs the
+// server.debug token); the picked path then ranks first for affinity until
+// it leaves the front or is cleared.
+type ParetoConfig struct {
+	Enabled bool `yaml:"enabled"`
 }
 
 type AffinityConfig struct {
@@ -44,25 +161,522 @@ type AffinityConfig struct {
 	MaxAffinityWeight int     `yaml:"maxAffinityWeight"`
 	BadLatencyMs      float64 `yaml:"badLatencyMs"`
 	BadDropRate       float64 `yaml:"badDropRate"`
+	ZoneLatencyMs     float64 `yaml:"zoneLatencyMs"`
+
+	// CPUManagerNodeLabel ("key=value") selects nodes running the static
+	// CPU manager policy; default rulegen.DefaultCPUManagerNodeLabel.
+	CPUManagerNodeLabel string `yaml:"cpuManagerNodeLabel"`
+
+	// WeightBudget bounds the pod affinity terms of one service across
+	// all rule sources.
+	WeightBudget WeightBudgetConfig `yaml:"weightBudget"`
+
+	// DirectDependencies adds pod affinity for every dependency edge, not
+	// only the edges of the top paths.
+	DirectDependencies DirectDependencyConfig `yaml:"directDependencies"`
+
+	// Symmetric mirrors every term onto the other side of its edge.
+	Symmetric SymmetricConfig `yaml:"symmetric"`
+
+	// ZonePlan spreads replicas over the zones their traffic comes from.
+	ZonePlan ZonePlanConfig `yaml:"zonePlan"`
+
+	// Verification checks that pods placed under the generated terms are
+	// co-located with their peers.
+	Verification VerificationConfig `yaml:"verification"`
+}
+
+type BatchingConfig struct {
+	Enabled        bool `yaml:"enabled"`
+	WindowSeconds  int  `yaml:"windowSeconds"`
+	MaxPodsPerNode int  `yaml:"maxPodsPerNode"`
+}
+
+// ControllerConfig tunes the reconcile loop. Env vars LEAD_NET_INTERVAL,
+// LEAD_NET_STARTUP_DELAY and LEAD_NET_JITTER override these values.
+type ControllerConfig struct {
+	IntervalSeconds     int     `yaml:"intervalSeconds"`
+	StartupDelaySeconds int     `yaml:"startupDelaySeconds"`
+	Jitter              float64 `yaml:"jitter"` // fraction of the interval, e.g. 0.1 = ±10%
+
+	// Event-driven reconciles (Deployment/Node watches), coalesced over DebounceSeconds.
+	EventTriggers   bool `yaml:"eventTriggers"`
+	DebounceSeconds int  `yaml:"debounceSeconds"`
+
+	// HistorySize is the number of per-path score samples kept for
+	// GET /paths/history, and of samples and epochs for GET /effectiveness
+	// (default 120).
+	HistorySize int `yaml:"historySize"`
+
+	// NamespaceScoped runs without any node access (namespace-only RBAC);
+	// env LEAD_NET_NAMESPACE_SCOPED=true also enables it.
+	NamespaceScoped bool `yaml:"namespaceScoped"`
+
+	// ExpansionHints publishes per-zone capacity wanted for co-location
+	// (lead_net_desired_capacity{zone}) when a zone is full.
+	ExpansionHints bool `yaml:"expansionHints"`
+
+	// ArgoRollouts manages Argo Rollouts (argoproj.io) like Deployments:
+	// they are scored and their pod-template affinity is patched, but not
+	// while a canary or blue-green step is in progress. Needs the
+	// argo-rollouts RBAC feature.
+	ArgoRollouts bool `yaml:"argoRollouts"`
+
+	// SidecarContainers names containers that are sidecars rather than the
+	// application, e.g. injected mesh proxies (default istio-proxy and
+	// linkerd-proxy; native sidecars always count). Pod CPU requests sum
+	// every container; the sidecar share is reported separately.
+	SidecarContainers []string `yaml:"sidecarContainers,omitempty"`
+}
+
+// KubeClientConfig sets client-side rate limiting for every Kubernetes client
+// the controller builds. Env vars LEAD_NET_KUBE_QPS and LEAD_NET_KUBE_BURST
+// override these values; zero keeps the client-go defaults (5 QPS, burst 10).
+type KubeClientConfig struct {
+	QPS   float32 `yaml:"qps"`
+	Burst int     `yaml:"burst"`
+}
+
+// RebalancingConfig throttles pod deletions so a mass rebalance does not
+// overwhelm small API servers.
+type RebalancingConfig struct {
+	MaxDeletionsPerPass int     `yaml:"maxDeletionsPerPass"` // pod deletions per reconcile pass, 0 = unlimited
+	DeletionsPerSecond  float64 `yaml:"deletionsPerSecond"`
+	DeletionBurst       int     `yaml:"deletionBurst"`
+
+	// The old name of maxDeletionsPerPass; see applyLegacyKeys.
+	legacyRebalancing `yaml:",inline"`
+
+	// MinPodAgeSeconds spares pods younger than this from rescheduling, so
+	// a pod that just landed is not deleted again at once; default 30.
+	MinPodAgeSeconds int `yaml:"minPodAgeSeconds"`
+
+	// SurgeBeforeEvict makes rescheduling make-before-break: scale the
+	// deployment up by one, wait for the new replica to be Ready on a good
+	// node, then delete the pod on the bad node and scale back. The wait
+	// holds up the reconcile, up to SurgeTimeoutSeconds per pod.
+	// Deployments a HorizontalPodAutoscaler scales are not surged, as the
+	// HPA would scale the extra replica away; their pods are deleted
+	// directly. Without the hpa RBAC feature they are surged too.
+	SurgeBeforeEvict    bool `yaml:"surgeBeforeEvict"`
+	SurgeTimeoutSeconds int  `yaml:"surgeTimeoutSeconds"` // keep the old pod if no replica is Ready by then; default 120
+
+	// BadNodeMode is BadNodeAntiAffinity (default) or BadNodeTaint.
+	BadNodeMode string `yaml:"badNodeMode"`
+}
+
+// OutputConfig exports the generated affinity as Deployment patches (one
+// file per deployment) to any combination of sinks.
+type OutputConfig struct {
+	Directory   string            `yaml:"directory"`
+	ConfigMap   string            `yaml:"configMap"` // "namespace/name"
+	HTTPURL     string            `yaml:"httpURL"`   // files are PUT to <httpURL>/<file>
+	HTTPHeaders map[string]string `yaml:"httpHeaders"`
+
+	// Object storage and OCI registry destinations; see S3Output,
+	// GCSOutput and OCIOutput.
+	S3  S3Output  `yaml:"s3"`
+	GCS GCSOutput `yaml:"gcs"`
+	OCI OCIOutput `yaml:"oci"`
+
+	// TemplateDir holds per-deployment <name>.yaml.tmpl Go templates or
+	// <name>.yaml base manifests; LEAD only fills in the affinity.
+	TemplateDir string `yaml:"templateDir"`
+
+	// Include and Exclude are glob patterns (path.Match syntax, relative
+	// to templateDir) of the files LEAD may use as templates or base
+	// manifests; others, e.g. vendored charts, are never read. An empty
+	// Include allows every file Exclude does not match.
+	Include []string `yaml:"include"`
+	Exclude []string `yaml:"exclude"`
+
+	// Files maps a graph service to its template (.tmpl) or base manifest
+	// in templateDir, instead of <deployment>.yaml(.tmpl).
+	Files map[string]string `yaml:"files"`
+
+	// IntervalSeconds is the least time between exports; reconciles in
+	// between skip the sinks. 0 exports after every reconcile.
+	IntervalSeconds int `yaml:"intervalSeconds"`
+
+	// NodeScoresConfigMap ("namespace/name") receives the per-service node
+	// scores as node-scores.json, for schedulers that read them instead of
+	// querying metrics.
+	NodeScoresConfigMap string `yaml:"nodeScoresConfigMap"`
+
+	// Gatekeeper adds the enforced node requirements to the exported files
+	// as OPA Gatekeeper constraints.
+	Gatekeeper GatekeeperConfig `yaml:"gatekeeper"`
+}
+
+// Validate checks the destinations, the globs, the file mapping and the
+// Gatekeeper settings.
+func (o OutputConfig) Validate() error {
+	if o.IntervalSeconds < 0 {
+		return fmt.Errorf("output.intervalSeconds must be >= 0, got %d", o.IntervalSeconds)
+	}
+	if err := o.validateSinks(); err != nil {
+		return err
+	}
+	for _, p := range append(append([]string{}, o.Include...), o.Exclude...) {
+		if _, err := path.Match(p, ""); err != nil {
+			return fmt.Errorf("output include/exclude pattern %q: %w", p, err)
+		}
+	}
+	for svc, f := range o.Files {
+		if o.TemplateDir == "" {
+			return fmt.Errorf("output.files needs output.templateDir")
+		}
+		if f == "" || path.IsAbs(f) || !filepath.IsLocal(f) {
+			return fmt.Errorf("output.files[%s]: %q must be a path inside templateDir", svc, f)
+		}
+		if !o.Allows(f) {
+			return fmt.Errorf("output.files[%s]: %s is not matched by output.include or is excluded", svc, f)
+		}
+	}
+	return o.Gatekeeper.Validate()
+}
+
+// Allows reports whether file, relative to templateDir, passes Include and
+// Exclude.
+func (o OutputConfig) Allows(file string) bool {
+	file = filepath.ToSlash(file)
+	for _, p := range o.Exclude {
+		if ok, _ := path.Match(p, file); ok {
+			return false
+		}
+	}
+	if len(o.Include) == 0 {
+		return true
+	}
+	for _, p := range o.Include {
+		if ok, _ := path.Match(p, file); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// GatekeeperConfig exports, next to the affinity patches, a
+// ConstraintTemplate and one constraint per service whose generated
+// affinity requires node labels (e.g. compliance zones, spot avoidance).
+type GatekeeperConfig struct {
+	Enabled           bool   `yaml:"enabled"`
+	EnforcementAction string `yaml:"enforcementAction"` // dryrun (default), warn or deny
+}
+
+// Validate checks the enforcement action.
+func (g GatekeeperConfig) Validate() error {
+	switch g.EnforcementAction {
+	case "", "dryrun", "warn", "deny":
+		return nil
+	}
+	return fmt.Errorf("output.gatekeeper.enforcementAction must be dryrun, warn or deny, got %q", g.EnforcementAction)
+}
+
+// RecommendationsConfig controls the replica recommendations document.
+// LEAD never changes replicas itself.
+type RecommendationsConfig struct {
+	MinReplicasOnCriticalPath int `yaml:"minReplicasOnCriticalPath"` // 0 = off
+
+	// Trend recommends scaling ahead of rising load; see TrendConfig.
+	Trend TrendConfig `yaml:"trend"`
+}
+
+// DefaultTrendHorizonIntervals is the prediction horizon in reconcile
+// intervals when TrendConfig.HorizonIntervals is not set.
+const DefaultTrendHorizonIntervals = 5
+
+// TrendConfig extrapolates each service's inbound request rate along its
+// trend (the service history) and recommends more replicas once the rate
+// predicted HorizonIntervals reconciles ahead exceeds MaxRPSPerReplica,
+// instead of after the breach. Needs per-edge request rates.
+type TrendConfig struct {
+	MaxRPSPerReplica float64 `yaml:"maxRPSPerReplica"` // 0 = off
+	HorizonIntervals int     `yaml:"horizonIntervals"` // default 5
+}
+
+// HorizonOrDefault returns HorizonIntervals with the default applied.
+func (t TrendConfig) HorizonOrDefault() int {
+	if t.HorizonIntervals <= 0 {
+		return DefaultTrendHorizonIntervals
+	}
+	return t.HorizonIntervals
+}
+
+// Validate rejects negative limits.
+func (t TrendConfig) Validate() error {
+	if t.MaxRPSPerReplica < 0 || t.HorizonIntervals < 0 {
+		return fmt.Errorf("recommendations.trend values must not be negative, got %+v", t)
+	}
+	return nil
+}
+
+// DriftConfig tunes the declared-graph vs. observed-traffic check, which
+// runs when prometheus.servicePairRPSQuery or tracing is set.
+type DriftConfig struct {
+	MinRPS     float64 `yaml:"minRPS"`     // ignore edges below this rate
+	WebhookURL string  `yaml:"webhookURL"` // POSTed the report when it changes
+}
+
+// TracingConfig adds edges derived from distributed traces (Jaeger query
+// API; for Tempo point it at tempo-query). Prometheus pair metrics take
+// precedence where both exist.
+type TracingConfig struct {
+	JaegerURL         string  `yaml:"jaegerURL"`
+	LookbackSeconds   int     `yaml:"lookbackSeconds"`   // default 300
+	TracesPerService  int     `yaml:"tracesPerService"`  // default 100
+	LatencyPercentile float64 `yaml:"latencyPercentile"` // 0..1, default 0.5
+
+	HTTP HTTPClientConfig `yaml:"http"` // proxy, extra headers, request timeout (default 30s)
+}
+
+// DNSInferenceConfig approximates edges from CoreDNS query logs (the CoreDNS
+// log plugin must be enabled) for clusters without a mesh, Hubble or
+// tracing. Inferred edges are low-confidence and never replace declared ones.
+type DNSInferenceConfig struct {
+	Enabled       bool   `yaml:"enabled"`
+	Namespace     string `yaml:"namespace"`     // CoreDNS namespace, default kube-system
+	Selector      string `yaml:"selector"`      // CoreDNS pods, default k8s-app=kube-dns
+	SinceSeconds  int    `yaml:"sinceSeconds"`  // log window, default 300
+	ClusterDomain string `yaml:"clusterDomain"` // default cluster.local
+	MinQueries    int    `yaml:"minQueries"`    // lookups needed per edge, default 1
+}
+
+// SpotConfig classifies services by path score: services on critical paths
+// avoid spot/preemptible nodes, the rest may prefer them.
+type SpotConfig struct {
+	Enabled           bool     `yaml:"enabled"`
+	NodeLabels        []string `yaml:"nodeLabels"`        // "key=value"; default rulegen.DefaultSpotNodeLabels
+	CriticalPathScore float64  `yaml:"criticalPathScore"` // paths with a final score (0..100) at or above this are critical; default 70
+	RequireOnDemand   bool     `yaml:"requireOnDemand"`   // critical services: required instead of preferred
+	PreferSpotWeight  int      `yaml:"preferSpotWeight"`  // other services prefer spot with this weight; 0 = no preference
+}
+
+// ApprovalConfig holds mutating actions (deployment patches, pod evictions)
+// in a queue until an operator approves them via POST /approvals/<id>/approve.
+// An action's risk is the number of pods it disrupts: a patch rolls every
+// replica, an eviction moves one pod.
+type ApprovalConfig struct {
+	Enabled              bool    `yaml:"enabled"`
+	AutoApproveBelowRisk float64 `yaml:"autoApproveBelowRisk"` // apply actions with a lower risk without approval; 0 = approve nothing automatically
+	TTLSeconds           int     `yaml:"ttlSeconds"`           // forget actions no reconcile proposed for this long; default 3600
+}
+
+// RolloutConfig staggers the updates of deployments whose affinity
+// changes, so a change touching many deployments does not restart them all
+// at once. Each reconcile writes at most one batch and never waits for it;
+// later reconciles hold the rest until the batch is due.
+type RolloutConfig struct {
+	BatchSize            int  `yaml:"batchSize"`            // deployments per batch; 0 = all at once
+	BatchIntervalSeconds int  `yaml:"batchIntervalSeconds"` // least time between batches
+	HealthGate           bool `yaml:"healthGate"`           // hold the next batch until the last one rolled out
+	HealthTimeoutSeconds int  `yaml:"healthTimeoutSeconds"` // halt and defer the rest after this; default 300
+}
+
+// MetricsCacheConfig persists the last fetched metrics so a restarted
+// controller scores with them instead of defaults. Restored values keep
+// their observation time, so scoring.staleAfterSeconds discounts them.
+type MetricsCacheConfig struct {
+	Path          string `yaml:"path"`          // local file, e.g. on a persistent volume
+	ConfigMap     string `yaml:"configMap"`     // "namespace/name"; used when path is empty
+	MaxAgeSeconds int    `yaml:"maxAgeSeconds"` // never use values older than this; default 3600
 }
 
 type Config struct {
-	NamespaceSelector []string           `yaml:"namespaceSelector"`
-	Graph             ServiceGraphConfig `yaml:"graph"`
-	Prometheus        PrometheusConfig   `yaml:"prometheus"`
-	Scoring           ScoringWeights     `yaml:"scoring"`
-	Affinity          AffinityConfig     `yaml:"affinity"`
+	// APIVersion is the config schema version; see APIVersion.
+	APIVersion string `yaml:"apiVersion,omitempty"`
+
+	NamespaceSelector []string              `yaml:"namespaceSelector"`
+	Graph             ServiceGraphConfig    `yaml:"graph"`
+	Prometheus        PrometheusConfig      `yaml:"prometheus"`
+	Scoring           ScoringWeights        `yaml:"scoring"`
+	Affinity          AffinityConfig        `yaml:"affinity"`
+	Batching          BatchingConfig        `yaml:"batching"`
+	Controller        ControllerConfig      `yaml:"controller"`
+	Kube              KubeClientConfig      `yaml:"kube"`
+	Rebalancing       RebalancingConfig     `yaml:"rebalancing"`
+	Output            OutputConfig          `yaml:"output"`
+	Recommendations   RecommendationsConfig `yaml:"recommendations"`
+	Drift             DriftConfig           `yaml:"drift"`
+	Tracing           TracingConfig         `yaml:"tracing"`
+	DNSInference      DNSInferenceConfig    `yaml:"dnsInference"`
+	Degradation       DegradationConfig     `yaml:"degradation"`
+	Spot              SpotConfig            `yaml:"spot"`
+	Approval          ApprovalConfig        `yaml:"approval"`
+	Rollout           RolloutConfig         `yaml:"rollout"`
+	MetricsCache      MetricsCacheConfig    `yaml:"metricsCache"`
+	Smoothing         SmoothingConfig       `yaml:"smoothing"`
+	SLO               SLOConfig             `yaml:"slo"`
+	HealthChecks      HealthCheckConfig     `yaml:"healthChecks"`
+	Policy            PolicyConfig          `yaml:"policy"`
+	Reports           ReportsConfig         `yaml:"reports"`
+	Ownership         OwnershipConfig       `yaml:"ownership"`
+	Forecast          ForecastConfig        `yaml:"forecast"`
+
+	// Hooks are custom decision policies; see HookConfig.
+	Hooks []HookConfig `yaml:"hooks,omitempty"`
+
+	// DeploymentSelector restricts the managed deployments to those with
+	// all of these labels (used to split tenants sharing a namespace).
+	DeploymentSelector map[string]string `yaml:"deploymentSelector,omitempty"`
+
+	// ServiceLabelKeys are the pod/deployment labels naming a workload's
+	// graph service, checked in order; default io.kompose.service.
+	// graph.services[].labelSelector overrides them per service.
+	ServiceLabelKeys []string `yaml:"serviceLabelKeys,omitempty"`
+
+	// Thresholds overrides latency thresholds per service; see
+	// ServiceThresholds.
+	Thresholds []ServiceThresholds `yaml:"thresholds,omitempty"`
+
+	// Caches bounds the in-memory caches; see CacheConfig.
+	Caches CacheConfig `yaml:"caches"`
+
+	// Server configures the embedded HTTP server; see ServerConfig.
+	Server ServerConfig `yaml:"server"`
+
+	// Tenants run one independent controller each; see TenantConfig.
+	// Without tenants the top-level graph is the only one.
+	Tenants []TenantConfig `yaml:"tenants,omitempty"`
 }
 
 func Load(path string) (*Config, error) {
-	f, err := os.Open(path)
+	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, err
 	}
-	defer f.Close()
+	data, err = ExpandEnv(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
 
 	var c Config
-	if err := yaml.NewDecoder(f).Decode(&c); err != nil {
+	if err := decodeStrict(path, data, &c); err != nil {
+		return nil, err
+	}
+	if err := c.validateAPIVersion(); err != nil {
+		return nil, err
+	}
+	if err := c.Prometheus.applyLegacyKeys(); err != nil {
+		return nil, err
+	}
+	if err := c.Rebalancing.applyLegacyKeys(); err != nil {
+		return nil, err
+	}
+	if err := c.Prometheus.ApplyEdgeSource(); err != nil {
+		return nil, err
+	}
+	if err := c.Prometheus.ApplyEdgeFamilies(); err != nil {
+		return nil, err
+	}
+	if err := c.Prometheus.Gateway.ApplyPreset(c.Prometheus.SampleWindow); err != nil {
+		return nil, err
+	}
+	if err := c.Degradation.Validate(); err != nil {
+		return nil, err
+	}
+	if err := c.Smoothing.Validate(); err != nil {
+		return nil, err
+	}
+	if err := c.SLO.Validate(); err != nil {
+		return nil, err
+	}
+	if err := c.HealthChecks.Validate(); err != nil {
+		return nil, err
+	}
+	if err := validateHooks(c.Hooks); err != nil {
+		return nil, err
+	}
+	if err := c.Policy.Validate(); err != nil {
+		return nil, err
+	}
+	if err := c.Output.Validate(); err != nil {
+		return nil, err
+	}
+	for i, t := range c.Tenants {
+		if t.Output == nil {
+			continue
+		}
+		if err := t.Output.Validate(); err != nil {
+			return nil, fmt.Errorf("tenants[%d] (%s): %w", i, t.Name, err)
+		}
+	}
+	if err := c.Reports.Validate(); err != nil {
+		return nil, err
+	}
+	if err := c.Recommendations.Trend.Validate(); err != nil {
+		return nil, err
+	}
+	if err := c.Forecast.Validate(); err != nil {
+		return nil, err
+	}
+	if err := c.validateThresholds(); err != nil {
+		return nil, err
+	}
+	if err := c.Scoring.validateAggregations(); err != nil {
+		return nil, err
+	}
+	if err := c.Scoring.Limits.validate(); err != nil {
+		return nil, err
+	}
+	if err := c.Caches.Validate(); err != nil {
+		return nil, err
+	}
+	if err := c.Server.Validate(); err != nil {
+		return nil, err
+	}
+	if err := c.Prometheus.Auth.Validate(); err != nil {
+		return nil, err
+	}
+	if err := c.Prometheus.TLS.Validate(); err != nil {
+		return nil, err
+	}
+	if err := c.Prometheus.HTTP.validate("prometheus"); err != nil {
+		return nil, err
+	}
+	if err := c.Tracing.HTTP.validate("tracing"); err != nil {
+		return nil, err
+	}
+	if err := validateLatencyUnit(c.Prometheus.ServicePairLatencyUnit); err != nil {
+		return nil, err
+	}
+	if err := c.Prometheus.validateNodeQueries(); err != nil {
+		return nil, err
+	}
+	if err := c.Rebalancing.validateBadNodeMode(); err != nil {
+		return nil, err
+	}
+	if c.Rebalancing.MinPodAgeSeconds < 0 {
+		return nil, fmt.Errorf("rebalancing.minPodAgeSeconds must not be negative, got %d", c.Rebalancing.MinPodAgeSeconds)
+	}
+	if err := c.Affinity.WeightBudget.Validate(); err != nil {
+		return nil, err
+	}
+	if err := c.Affinity.DirectDependencies.validate(); err != nil {
+		return nil, err
+	}
+	if err := c.Affinity.Symmetric.validate(); err != nil {
+		return nil, err
+	}
+	if err := c.Affinity.ZonePlan.validate(); err != nil {
+		return nil, err
+	}
+	if err := c.Affinity.Verification.validate(); err != nil {
+		return nil, err
+	}
+	if err := c.loadGraphFiles(path); err != nil {
+		return nil, err
+	}
+	if err := c.validateLabels(); err != nil {
+		return nil, err
+	}
+	if err := c.validatePorts(); err != nil {
+		return nil, err
+	}
+	if err := c.validateExternals(); err != nil {
+		return nil, err
+	}
+	if err := c.validateTenants(); err != nil {
 		return nil, err
 	}
 	return &c, nil
@@ -0,0 +1,35 @@
+package config
+
+import "fmt"
+
+// Degradation policies: what a reconcile does when a data type is missing
+// for some services.
+const (
+	// DegradeUseDefault scores with the built-in default (no penalty) and
+	// flags the fallback in the reconcile status. This is the default.
+	DegradeUseDefault = "use-default"
+	// DegradeSkipService leaves paths through the affected services or
+	// edges out of scoring and affinity generation.
+	DegradeSkipService = "skip-service"
+	// DegradeFail aborts the reconcile with an error.
+	DegradeFail = "fail"
+)
+
+// DegradationConfig sets the policy per data type; "" means use-default.
+type DegradationConfig struct {
+	NodeMetrics string `yaml:"nodeMetrics"` // per-node RTT/drop/bandwidth
+	EdgeLatency string `yaml:"edgeLatency"` // service-pair latency (metrics or traces)
+}
+
+// Validate rejects unknown policies.
+func (d DegradationConfig) Validate() error {
+	for field, v := range map[string]string{"nodeMetrics": d.NodeMetrics, "edgeLatency": d.EdgeLatency} {
+		switch v {
+		case "", DegradeUseDefault, DegradeSkipService, DegradeFail:
+		default:
+			return fmt.Errorf("degradation.%s: unknown policy %q (want %s, %s or %s)",
+				field, v, DegradeUseDefault, DegradeSkipService, DegradeFail)
+		}
+	}
+	return nil
+}
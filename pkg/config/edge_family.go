@@ -0,0 +1,108 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Metric families understood by EdgeFamilyConfig.Family, for services the
+// servicePair* (HTTP) queries do not see.
+const (
+	// EdgeFamilyCustom uses the family's queries and labels as configured.
+	EdgeFamilyCustom = ""
+	// EdgeFamilyGRPC reads the go-grpc-prometheus server metrics
+	// (grpc_server_handled_total and the grpc_server_handling_seconds
+	// histogram). They carry no caller, so they are keyed by callee only.
+	EdgeFamilyGRPC = "grpc"
+	// EdgeFamilyTCP reads Istio TCP connection and byte counters
+	// (istio_tcp_connections_opened_total, istio_tcp_sent_bytes_total),
+	// e.g. for databases. New connections per second stand in for the
+	// request rate; TCP has no latency series.
+	EdgeFamilyTCP = "tcp"
+)
+
+// EdgeFamilyConfig is one extra source of per-edge request rates and
+// latencies. Values of the servicePair* queries win; a family only fills
+// edges they do not measure.
+//
+// Without a SrcLabel the series are per callee (DstLabel): the rate is
+// split evenly over the callee's declared callers and the latency applies
+// to each of them.
+type EdgeFamilyConfig struct {
+	Family       string `yaml:"family"` // grpc, tcp or "" (custom)
+	RPSQuery     string `yaml:"rpsQuery"`
+	LatencyQuery string `yaml:"latencyQuery"`
+	LatencyUnit  string `yaml:"latencyUnit"` // s (default), ms or us
+	SrcLabel     string `yaml:"srcLabel"`
+	DstLabel     string `yaml:"dstLabel"`
+	Selector     string `yaml:"selector"` // extra label matchers, e.g. namespace="shop"
+}
+
+// ApplyEdgeFamilies fills in the queries, labels and unit of every family
+// from its preset over the sample window; explicit settings win. It also
+// sets servicePairBytesQuery from the tcp family unless configured.
+func (p *PrometheusConfig) ApplyEdgeFamilies() error {
+	window := p.SampleWindow
+	if window == "" {
+		window = defaultEdgeSourceWindow
+	}
+	for i := range p.EdgeFamilies {
+		f := &p.EdgeFamilies[i]
+		sel := ""
+		if f.Selector != "" {
+			sel = "{" + f.Selector + "}"
+		}
+		switch strings.ToLower(strings.TrimSpace(f.Family)) {
+		case EdgeFamilyCustom:
+		case EdgeFamilyGRPC:
+			if f.DstLabel == "" {
+				f.DstLabel = "app"
+			}
+			if f.RPSQuery == "" {
+				f.RPSQuery = fmt.Sprintf("sum by (%s) (rate(grpc_server_handled_total%s[%s]))", f.DstLabel, sel, window)
+			}
+			if f.LatencyQuery == "" {
+				f.LatencyQuery = fmt.Sprintf("histogram_quantile(0.5, sum by (%s, le) (rate(grpc_server_handling_seconds_bucket%s[%s])))",
+					f.DstLabel, sel, window)
+				f.LatencyUnit = "s"
+			}
+		case EdgeFamilyTCP:
+			if f.SrcLabel == "" {
+				f.SrcLabel = "source_workload"
+			}
+			if f.DstLabel == "" {
+				f.DstLabel = "destination_workload"
+			}
+			by := f.SrcLabel + ", " + f.DstLabel
+			if f.RPSQuery == "" {
+				f.RPSQuery = fmt.Sprintf("sum by (%s) (rate(istio_tcp_connections_opened_total%s[%s]))", by, sel, window)
+			}
+			// The bytes query is read with the servicePair* labels.
+			if p.ServicePairBytesQuery == "" && f.SrcLabel == labelOrDefault(p.ServicePairSrcLabel, "source_workload") &&
+				f.DstLabel == labelOrDefault(p.ServicePairDstLabel, "destination_workload") {
+				p.ServicePairBytesQuery = fmt.Sprintf("sum by (%s) (rate(istio_tcp_sent_bytes_total%s[%s]))", by, sel, window)
+			}
+		default:
+			return fmt.Errorf("prometheus.edgeFamilies[%d]: unknown family %q (want %s or %s)", i, f.Family, EdgeFamilyGRPC, EdgeFamilyTCP)
+		}
+		if f.DstLabel == "" {
+			return fmt.Errorf("prometheus.edgeFamilies[%d]: dstLabel is required", i)
+		}
+		if f.RPSQuery == "" && f.LatencyQuery == "" {
+			return fmt.Errorf("prometheus.edgeFamilies[%d]: rpsQuery or latencyQuery is required", i)
+		}
+		switch f.LatencyUnit {
+		case "", "s", "ms", "us":
+		default:
+			return fmt.Errorf("prometheus.edgeFamilies[%d].latencyUnit must be s, ms or us, got %q", i, f.LatencyUnit)
+		}
+	}
+	return nil
+}
+
+func labelOrDefault(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
@@ -0,0 +1,64 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Edge metric sources understood by Prometheus.EdgeSource.
+const (
+	// EdgeSourceCustom leaves the servicePair* settings exactly as configured.
+	EdgeSourceCustom = ""
+	// EdgeSourceOTelServiceGraph reads the OpenTelemetry Collector
+	// servicegraph connector metrics (traces_service_graph_request_total and
+	// the traces_service_graph_request_server_seconds histogram), keyed by
+	// the connector's client/server labels.
+	EdgeSourceOTelServiceGraph = "otel-servicegraph"
+)
+
+const defaultEdgeSourceWindow = "5m"
+
+// ApplyEdgeSource fills in the servicePair* queries, labels and unit for the
+// configured EdgeSource. Anything set explicitly in the config wins, so a
+// preset can be adjusted per environment (a different window, an extra
+// label matcher) without restating all of it.
+func (p *PrometheusConfig) ApplyEdgeSource() error {
+	switch strings.ToLower(strings.TrimSpace(p.EdgeSource)) {
+	case EdgeSourceCustom:
+		return nil
+	case EdgeSourceOTelServiceGraph:
+	default:
+		return fmt.Errorf("prometheus.edgeSource: unknown source %q", p.EdgeSource)
+	}
+
+	window := p.SampleWindow
+	if window == "" {
+		window = defaultEdgeSourceWindow
+	}
+	metric := "traces_service_graph_request"
+	if p.EdgeMetricPrefix != "" {
+		metric = p.EdgeMetricPrefix + "_" + metric
+	}
+	sel := ""
+	if p.EdgeSelector != "" {
+		sel = "{" + p.EdgeSelector + "}"
+	}
+
+	if p.ServicePairSrcLabel == "" {
+		p.ServicePairSrcLabel = "client"
+	}
+	if p.ServicePairDstLabel == "" {
+		p.ServicePairDstLabel = "server"
+	}
+	by := p.ServicePairSrcLabel + ", " + p.ServicePairDstLabel
+	if p.ServicePairRPSQuery == "" {
+		p.ServicePairRPSQuery = fmt.Sprintf("sum by (%s) (rate(%s_total%s[%s]))", by, metric, sel, window)
+	}
+	if p.ServicePairLatencyQuery == "" {
+		p.ServicePairLatencyQuery = fmt.Sprintf(
+			"histogram_quantile(0.5, sum by (%s, le) (rate(%s_server_seconds_bucket%s[%s])))",
+			by, metric, sel, window)
+		p.ServicePairLatencyUnit = "s"
+	}
+	return nil
+}
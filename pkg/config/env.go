@@ -0,0 +1,45 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// envRef matches ${NAME} and ${NAME:-default}; $${ is a literal ${.
+var envRef = regexp.MustCompile(`\$?\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// ExpandEnv replaces ${NAME} in a config file with the value of the
+// environment variable NAME, or with default in ${NAME:-default} when NAME
+// is unset or empty. A reference to an unset variable without a default is
+// an error, so a missing secret does not turn into an empty URL. Bare $NAME
+// is left alone (PromQL and label values may contain $).
+func ExpandEnv(data []byte) ([]byte, error) {
+	var out bytes.Buffer
+	var missing []string
+	last := 0
+	for _, m := range envRef.FindAllSubmatchIndex(data, -1) {
+		out.Write(data[last:m[0]])
+		last = m[1]
+		if data[m[0]+1] == '$' {
+			out.Write(data[m[0]+1 : m[1]])
+			continue
+		}
+		name := string(data[m[2]:m[3]])
+		switch v, ok := os.LookupEnv(name); {
+		case v != "":
+			out.WriteString(v)
+		case m[4] >= 0:
+			out.Write(data[m[6]:m[7]])
+		case !ok:
+			missing = append(missing, fmt.Sprintf("%s (line %d)", name, bytes.Count(data[:m[0]], []byte("\n"))+1))
+		}
+	}
+	out.Write(data[last:])
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("environment variables referenced but not set: %s", strings.Join(missing, ", "))
+	}
+	return out.Bytes(), nil
+}
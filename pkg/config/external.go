@@ -0,0 +1,92 @@
+package config
+
+import (
+	"fmt"
+	"math"
+)
+
+// DefaultExternalWeight is the node affinity weight toward the zone
+// closest to an external service unless ExternalEndpoint.Weight is set.
+const DefaultExternalWeight = 60
+
+// ExternalEndpoint declares a graph service running outside the cluster:
+// a managed database or cache, a third-party API. It has no pods, so its
+// callers get node affinity toward the zones closest to it instead of pod
+// affinity.
+type ExternalEndpoint struct {
+	// Zone is where the endpoint runs, e.g. eu-west-1a for a managed
+	// MongoDB primary.
+	Zone string `yaml:"zone,omitempty"`
+
+	// ZoneLatencyMs is the expected latency from each cluster zone; zones
+	// slower than the fastest get a smaller share of the weight. Unset,
+	// only Zone is preferred.
+	ZoneLatencyMs map[string]float64 `yaml:"zoneLatencyMs,omitempty"`
+
+	// Weight is the node affinity weight of the closest zone, 1-100;
+	// default 60.
+	Weight int `yaml:"weight,omitempty"`
+}
+
+// WeightOrDefault returns Weight with the default applied.
+func (e ExternalEndpoint) WeightOrDefault() int {
+	if e.Weight <= 0 {
+		return DefaultExternalWeight
+	}
+	return e.Weight
+}
+
+// ZoneWeights returns the node affinity weight of each zone: Zone and the
+// fastest zones get WeightOrDefault, slower ones that weight scaled by
+// (fastest+1)/(latency+1). Zone counts as 0ms unless listed.
+func (e ExternalEndpoint) ZoneWeights() map[string]int32 {
+	w := float64(e.WeightOrDefault())
+	out := make(map[string]int32, len(e.ZoneLatencyMs)+1)
+	_, listed := e.ZoneLatencyMs[e.Zone]
+	best := math.Inf(1)
+	if e.Zone != "" && !listed {
+		best = 0
+	}
+	for _, lat := range e.ZoneLatencyMs {
+		best = math.Min(best, lat)
+	}
+	for z, lat := range e.ZoneLatencyMs {
+		out[z] = int32(max(math.Round(w*(best+1)/(lat+1)), 1))
+	}
+	if e.Zone != "" && !listed {
+		out[e.Zone] = int32(w)
+	}
+	return out
+}
+
+// validateExternals checks the external services of every graph.
+func (c *Config) validateExternals() error {
+	graphs := map[string]*ServiceGraphConfig{"graph": &c.Graph}
+	for i := range c.Tenants {
+		graphs[fmt.Sprintf("tenants[%d] (%s) graph", i, c.Tenants[i].Name)] = &c.Tenants[i].Graph
+	}
+	for where, g := range graphs {
+		for _, s := range g.Services {
+			e := s.External
+			if e == nil {
+				continue
+			}
+			switch {
+			case e.Zone == "" && len(e.ZoneLatencyMs) == 0:
+				return fmt.Errorf("%s: external service %s: set zone or zoneLatencyMs", where, s.Name)
+			case e.Weight < 0 || e.Weight > 100:
+				return fmt.Errorf("%s: external service %s: weight must be 0-100, got %d", where, s.Name, e.Weight)
+			case len(s.DependsOn) > 0:
+				return fmt.Errorf("%s: external service %s cannot declare dependencies", where, s.Name)
+			case s.Name == g.Entry:
+				return fmt.Errorf("%s: the entry service %s cannot be external", where, s.Name)
+			}
+			for z, lat := range e.ZoneLatencyMs {
+				if lat < 0 {
+					return fmt.Errorf("%s: external service %s: zoneLatencyMs[%s] must not be negative, got %v", where, s.Name, z, lat)
+				}
+			}
+		}
+	}
+	return nil
+}
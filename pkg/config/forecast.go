@@ -0,0 +1,83 @@
+package config
+
+import "fmt"
+
+// Forecast defaults applied when a ForecastConfig value is not set.
+const (
+	DefaultForecastSeasonHours  = 24
+	DefaultForecastHistoryHours = 7 * 24
+	DefaultForecastAlpha        = 0.5
+	DefaultForecastBeta         = 0.1
+	DefaultForecastGamma        = 0.3
+)
+
+// ForecastConfig predicts each service's inbound request rate for the next
+// hour with Holt-Winters smoothing over its hourly means (see
+// pkg/forecast). The forecast is the RPS input of path scoring
+// (scoring.rpsWeight) and, with recommendations.trend, recommends replicas
+// ahead of a daily peak. Needs per-edge request rates; the hourly history is
+// kept in memory and starts over on restart.
+type ForecastConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// SeasonHours is the length of the repeating pattern, default 24 (a
+	// day); HistoryHours the hours kept per service, default 168 (a week).
+	// Until two seasons are observed the forecast follows the trend only.
+	SeasonHours  int `yaml:"seasonHours"`
+	HistoryHours int `yaml:"historyHours"`
+
+	// Smoothing factors in [0, 1] for level, trend and season; higher
+	// values follow recent hours more closely. Defaults 0.5, 0.1, 0.3.
+	Alpha float64 `yaml:"alpha"`
+	Beta  float64 `yaml:"beta"`
+	Gamma float64 `yaml:"gamma"`
+}
+
+// SeasonOrDefault returns SeasonHours with the default applied.
+func (f ForecastConfig) SeasonOrDefault() int {
+	if f.SeasonHours <= 0 {
+		return DefaultForecastSeasonHours
+	}
+	return f.SeasonHours
+}
+
+// HistoryOrDefault returns HistoryHours with the default applied.
+func (f ForecastConfig) HistoryOrDefault() int {
+	if f.HistoryHours <= 0 {
+		return DefaultForecastHistoryHours
+	}
+	return f.HistoryHours
+}
+
+// SmoothingOrDefault returns alpha, beta and gamma with the defaults
+// applied.
+func (f ForecastConfig) SmoothingOrDefault() (alpha, beta, gamma float64) {
+	alpha, beta, gamma = f.Alpha, f.Beta, f.Gamma
+	if alpha == 0 {
+		alpha = DefaultForecastAlpha
+	}
+	if beta == 0 {
+		beta = DefaultForecastBeta
+	}
+	if gamma == 0 {
+		gamma = DefaultForecastGamma
+	}
+	return alpha, beta, gamma
+}
+
+// Validate rejects negative lengths, smoothing factors outside [0, 1] and
+// a history too short to ever hold two seasons.
+func (f ForecastConfig) Validate() error {
+	if f.SeasonHours < 0 || f.HistoryHours < 0 {
+		return fmt.Errorf("forecast.seasonHours and forecast.historyHours must not be negative, got %d and %d", f.SeasonHours, f.HistoryHours)
+	}
+	for name, v := range map[string]float64{"alpha": f.Alpha, "beta": f.Beta, "gamma": f.Gamma} {
+		if v < 0 || v > 1 {
+			return fmt.Errorf("forecast.%s must be within [0, 1], got %v", name, v)
+		}
+	}
+	if f.HistoryOrDefault() < 2*f.SeasonOrDefault() {
+		return fmt.Errorf("forecast.historyHours (%d) must hold two seasons of forecast.seasonHours (%d)", f.HistoryOrDefault(), f.SeasonOrDefault())
+	}
+	return nil
+}
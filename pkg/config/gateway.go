@@ -0,0 +1,111 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Ingress controllers understood by GatewayConfig.Controller.
+const (
+	// GatewayCustom uses LatencyQuery and LatencyUnit exactly as configured.
+	GatewayCustom       = ""
+	GatewayIngressNginx = "ingress-nginx"
+	GatewayTraefik      = "traefik"
+	GatewayEnvoy        = "envoy"
+)
+
+// DefaultGatewayQuantile is used when GatewayConfig.Quantile is unset.
+const DefaultGatewayQuantile = 0.95
+
+// gatewayHistograms are the request duration histograms of each controller
+// and the unit they are in.
+var gatewayHistograms = map[string]struct{ metric, unit string }{
+	GatewayIngressNginx: {"nginx_ingress_controller_request_duration_seconds_bucket", "s"},
+	GatewayTraefik:      {"traefik_entrypoint_request_duration_seconds_bucket", "s"},
+	GatewayEnvoy:        {"envoy_http_downstream_rq_time_bucket", "ms"},
+}
+
+// GatewayConfig measures user-facing latency at the entry point from the
+// ingress controller's metrics. It is the primary latency objective
+// (slo.gatewayLatencyMs) and is recorded next to the path scores.
+type GatewayConfig struct {
+	Controller   string  `yaml:"controller"`   // ingress-nginx, traefik, envoy or "" (LatencyQuery)
+	LatencyQuery string  `yaml:"latencyQuery"` // one series; set by the preset unless given
+	LatencyUnit  string  `yaml:"latencyUnit"`  // s (default), ms or us
+	Quantile     float64 `yaml:"quantile"`     // default 0.95
+	Selector     string  `yaml:"selector"`     // extra label matchers, e.g. ingress="shop"
+
+	// Origin measures where user traffic comes from; see GatewayOrigin.
+	Origin GatewayOrigin `yaml:"origin"`
+}
+
+// DefaultGatewayOriginLabel keys GatewayOrigin.Query series unless Label
+// is set.
+const DefaultGatewayOriginLabel = "zone"
+
+// GatewayOrigin reads the request rate of user traffic per client zone,
+// e.g. from ingress access logs turned into metrics or from CDN metrics
+// per point of presence. With affinity.zonePlan the entry service's
+// replicas are spread over zones by this distribution instead of its
+// callers'.
+type GatewayOrigin struct {
+	Query string `yaml:"query"` // request rate by Label, e.g. sum by (zone) (rate(...))
+	Label string `yaml:"label"` // default zone
+
+	// Zones maps Label values that are not cluster zones (a CDN point of
+	// presence, a client region) to the zone serving them; rates of
+	// unmapped values count for the zone of that name.
+	Zones map[string]string `yaml:"zones,omitempty"`
+}
+
+// LabelOrDefault returns Label with the default applied.
+func (o GatewayOrigin) LabelOrDefault() string {
+	if o.Label == "" {
+		return DefaultGatewayOriginLabel
+	}
+	return o.Label
+}
+
+// Enabled reports whether a gateway latency query is configured.
+func (g GatewayConfig) Enabled() bool {
+	return g.LatencyQuery != ""
+}
+
+// ApplyPreset fills in LatencyQuery and LatencyUnit for the configured
+// Controller over window; an explicit LatencyQuery wins.
+func (g *GatewayConfig) ApplyPreset(window string) error {
+	if g.Quantile < 0 || g.Quantile >= 1 {
+		return fmt.Errorf("prometheus.gateway.quantile must be in (0, 1), got %v", g.Quantile)
+	}
+	switch g.LatencyUnit {
+	case "", "s", "ms", "us":
+	default:
+		return fmt.Errorf("prometheus.gateway.latencyUnit must be s, ms or us, got %q", g.LatencyUnit)
+	}
+	name := strings.ToLower(strings.TrimSpace(g.Controller))
+	if name == GatewayCustom {
+		return nil
+	}
+	h, ok := gatewayHistograms[name]
+	if !ok {
+		return fmt.Errorf("prometheus.gateway.controller: unknown controller %q (want %s, %s or %s)",
+			g.Controller, GatewayIngressNginx, GatewayTraefik, GatewayEnvoy)
+	}
+	if g.LatencyQuery != "" {
+		return nil
+	}
+	if window == "" {
+		window = defaultEdgeSourceWindow
+	}
+	q := g.Quantile
+	if q == 0 {
+		q = DefaultGatewayQuantile
+	}
+	sel := ""
+	if g.Selector != "" {
+		sel = "{" + g.Selector + "}"
+	}
+	g.LatencyQuery = fmt.Sprintf("histogram_quantile(%g, sum by (le) (rate(%s%s[%s])))", q, h.metric, sel, window)
+	g.LatencyUnit = h.unit
+	return nil
+}
@@ -0,0 +1,85 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"lead-net-affinity/pkg/graph"
+)
+
+// loadGraphFiles replaces every graph.file (top-level and per tenant) with
+// the services of the graph document it names. Relative paths are resolved
+// against the directory of the config file.
+func (c *Config) loadGraphFiles(configPath string) error {
+	if err := c.Graph.loadFile(filepath.Dir(configPath)); err != nil {
+		return fmt.Errorf("graph: %w", err)
+	}
+	for i := range c.Tenants {
+		if err := c.Tenants[i].Graph.loadFile(filepath.Dir(configPath)); err != nil {
+			return fmt.Errorf("tenants[%d] (%s) graph: %w", i, c.Tenants[i].Name, err)
+		}
+	}
+	return nil
+}
+
+func (g *ServiceGraphConfig) loadFile(dir string) error {
+	if g.File == "" {
+		return nil
+	}
+	if len(g.Services) > 0 {
+		return fmt.Errorf("file %s and services are mutually exclusive", g.File)
+	}
+	path := g.File
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	doc, err := graph.ParseDocument(data, "")
+	if err != nil {
+		return fmt.Errorf("%s: %w", g.File, err)
+	}
+	g.Services = ServicesFromDocument(doc)
+	if g.Entry == "" {
+		g.Entry = doc.Entry
+	}
+	return nil
+}
+
+// ServicesFromDocument converts a graph document into config services.
+// Inferred dependencies become declared ones.
+func ServicesFromDocument(doc *graph.Document) []ServiceNode {
+	out := make([]ServiceNode, 0, len(doc.Services))
+	for _, s := range doc.Services {
+		out = append(out, ServiceNode{
+			Name:          s.Name,
+			DependsOn:     s.DependsOn,
+			LabelSelector: s.LabelSelector,
+			Version:       s.Version,
+			Owner:         s.Owner,
+			Metadata:      s.Metadata,
+			Ports:         s.Ports,
+		})
+	}
+	return out
+}
+
+// Document exports the graph as a graph document, services in config order.
+func (g ServiceGraphConfig) Document() *graph.Document {
+	doc := &graph.Document{APIVersion: graph.DocumentAPIVersion, Kind: graph.DocumentKind, Entry: g.Entry}
+	for _, s := range g.Services {
+		doc.Services = append(doc.Services, graph.DocumentService{
+			Name:          s.Name,
+			DependsOn:     s.DependsOn,
+			LabelSelector: s.LabelSelector,
+			Version:       s.Version,
+			Owner:         s.Owner,
+			Metadata:      s.Metadata,
+			Ports:         s.Ports,
+		})
+	}
+	return doc
+}
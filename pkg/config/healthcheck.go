@@ -0,0 +1,49 @@
+package config
+
+import "fmt"
+
+// HealthCheckConfig enables active health checks of the graph services'
+// pods, for environments where app metrics are incomplete. Results are
+// merged into the per-service health (GET /health-summary).
+type HealthCheckConfig struct {
+	Enabled   bool   `yaml:"enabled"`
+	TimeoutMs int    `yaml:"timeoutMs"` // per probe, default 1000
+	HTTPPath  string `yaml:"httpPath"`  // default /health
+
+	// Services overrides how individual services are checked. The others
+	// are checked on their first gRPC port with the gRPC health protocol,
+	// else on their first other TCP port over HTTP (see graph.Port); a
+	// service without known ports is not checked.
+	Services []ServiceHealthCheck `yaml:"services,omitempty"`
+}
+
+// ServiceHealthCheck is how one service's pods are checked.
+type ServiceHealthCheck struct {
+	Service     string `yaml:"service"`
+	Disabled    bool   `yaml:"disabled,omitempty"`
+	Protocol    string `yaml:"protocol,omitempty"`    // http or grpc; default from the port's app protocol
+	Port        int32  `yaml:"port,omitempty"`        // container port; default from the service's ports
+	Path        string `yaml:"path,omitempty"`        // http only; default httpPath
+	GRPCService string `yaml:"grpcService,omitempty"` // grpc only; "" checks the server as a whole
+}
+
+// Validate checks the timeout, protocols and ports.
+func (h HealthCheckConfig) Validate() error {
+	if h.TimeoutMs < 0 {
+		return fmt.Errorf("healthChecks.timeoutMs must not be negative, got %d", h.TimeoutMs)
+	}
+	for i, s := range h.Services {
+		if s.Service == "" {
+			return fmt.Errorf("healthChecks.services[%d]: service is required", i)
+		}
+		switch s.Protocol {
+		case "", "http", "grpc":
+		default:
+			return fmt.Errorf("healthChecks.services[%d] (%s): protocol must be http or grpc, got %q", i, s.Service, s.Protocol)
+		}
+		if s.Port < 0 || s.Port > 65535 {
+			return fmt.Errorf("healthChecks.services[%d] (%s): port %d out of range 1-65535", i, s.Service, s.Port)
+		}
+	}
+	return nil
+}
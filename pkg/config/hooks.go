@@ -0,0 +1,52 @@
+package config
+
+import "fmt"
+
+// Failure policies of a decision hook.
+const (
+	HookFailIgnore = "ignore"
+	HookFailClosed = "fail"
+)
+
+// HookConfig enables one decision hook, run in list order after paths are
+// scored, after affinity is computed and around each deployment update.
+// A hook is either compiled in (registered under Name by a file built with
+// its build tag) or, with URL set, an HTTP sidecar speaking JSON.
+type HookConfig struct {
+	Name      string            `yaml:"name"`
+	URL       string            `yaml:"url,omitempty"`       // sidecar base URL; events are POSTed to URL/<event>
+	TimeoutMs int               `yaml:"timeoutMs,omitempty"` // sidecar calls, default 5000
+	Options   map[string]string `yaml:"options,omitempty"`   // passed to a compiled-in hook
+
+	// FailurePolicy is what a hook error (not a denial) does: ignore
+	// (default) logs it and carries on without the hook's changes, fail
+	// holds the affected updates until the next reconcile.
+	FailurePolicy string `yaml:"failurePolicy,omitempty"`
+}
+
+// FailClosed reports whether errors of the hook hold updates.
+func (h HookConfig) FailClosed() bool {
+	return h.FailurePolicy == HookFailClosed
+}
+
+func validateHooks(hooks []HookConfig) error {
+	seen := make(map[string]bool, len(hooks))
+	for i, h := range hooks {
+		if h.Name == "" {
+			return fmt.Errorf("hooks[%d]: name is required", i)
+		}
+		if seen[h.Name] {
+			return fmt.Errorf("hooks[%d]: duplicate hook %q", i, h.Name)
+		}
+		seen[h.Name] = true
+		if h.TimeoutMs < 0 {
+			return fmt.Errorf("hooks[%d] (%s): timeoutMs must not be negative, got %d", i, h.Name, h.TimeoutMs)
+		}
+		switch h.FailurePolicy {
+		case "", HookFailIgnore, HookFailClosed:
+		default:
+			return fmt.Errorf("hooks[%d] (%s): failurePolicy must be ignore or fail, got %q", i, h.Name, h.FailurePolicy)
+		}
+	}
+	return nil
+}
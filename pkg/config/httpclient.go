@@ -0,0 +1,38 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+
+	"lead-net-affinity/pkg/outbound"
+)
+
+// HTTPClientConfig tunes an outbound HTTP client (prometheus.http,
+// tracing.http). HTTP_PROXY, HTTPS_PROXY and NO_PROXY are honored unless
+// proxyURL is set.
+type HTTPClientConfig struct {
+	ProxyURL       string            `yaml:"proxyURL"`
+	Headers        map[string]string `yaml:"headers"`        // e.g. X-Scope-OrgID for a metrics gateway
+	TimeoutSeconds float64           `yaml:"timeoutSeconds"` // per request; 0 = client default
+}
+
+// Options converts the config for outbound.Apply.
+func (h HTTPClientConfig) Options() outbound.Options {
+	return outbound.Options{
+		ProxyURL: h.ProxyURL,
+		Headers:  h.Headers,
+		Timeout:  seconds(h.TimeoutSeconds),
+	}
+}
+
+func (h HTTPClientConfig) validate(section string) error {
+	if h.TimeoutSeconds < 0 {
+		return fmt.Errorf("%s.http.timeoutSeconds must not be negative, got %v", section, h.TimeoutSeconds)
+	}
+	if h.ProxyURL != "" {
+		if u, err := url.Parse(h.ProxyURL); err != nil || u.Host == "" {
+			return fmt.Errorf("%s.http.proxyURL %q is not a URL", section, h.ProxyURL)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// validateLabels checks serviceLabelKeys and every labelSelector (top-level
+// and tenant graphs). Generated pod affinity selects pods with exactly these
+// labels (kube.ServiceIdentity.PodSelector), so an invalid one would make
+// the API server reject every updated Deployment.
+func (c *Config) validateLabels() error {
+	for _, k := range c.ServiceLabelKeys {
+		if errs := validation.IsQualifiedName(k); len(errs) > 0 {
+			return fmt.Errorf("serviceLabelKeys: invalid label key %q: %s", k, strings.Join(errs, "; "))
+		}
+	}
+	graphs := map[string]ServiceGraphConfig{"graph": c.Graph}
+	for i, t := range c.Tenants {
+		graphs[fmt.Sprintf("tenants[%d] (%s) graph", i, t.Name)] = t.Graph
+	}
+	for where, g := range graphs {
+		for _, s := range g.Services {
+			for k, v := range s.LabelSelector {
+				if errs := validation.IsQualifiedName(k); len(errs) > 0 {
+					return fmt.Errorf("%s: service %s: invalid labelSelector key %q: %s", where, s.Name, k, strings.Join(errs, "; "))
+				}
+				if errs := validation.IsValidLabelValue(v); len(errs) > 0 {
+					return fmt.Errorf("%s: service %s: invalid labelSelector value %q: %s", where, s.Name, v, strings.Join(errs, "; "))
+				}
+			}
+		}
+	}
+	return nil
+}
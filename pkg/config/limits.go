@@ -0,0 +1,85 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// ScoringLimits keeps one absurd Prometheus sample from dominating a path
+// score. Max* values use the units of the matching bad* thresholds (ms, or
+// whatever the drop and bandwidth queries return); larger samples are
+// clamped, 0 means unbounded. NaN, infinite and negative samples are
+// always discarded.
+type ScoringLimits struct {
+	MaxLatencyMs     float64 `yaml:"maxLatencyMs"`
+	MaxDropRate      float64 `yaml:"maxDropRate"`
+	MaxBandwidthRate float64 `yaml:"maxBandwidthRate"`
+
+	// MaxPenaltyFactor caps how many times past its bad* threshold one
+	// signal counts (default 10, negative = uncapped).
+	MaxPenaltyFactor float64 `yaml:"maxPenaltyFactor"`
+}
+
+func (l ScoringLimits) validate() error {
+	for name, v := range map[string]float64{
+		"maxLatencyMs":     l.MaxLatencyMs,
+		"maxDropRate":      l.MaxDropRate,
+		"maxBandwidthRate": l.MaxBandwidthRate,
+	} {
+		if v < 0 {
+			return fmt.Errorf("scoring.limits.%s must not be negative, got %v", name, v)
+		}
+	}
+	return nil
+}
+
+// validateLatencyUnit checks a *LatencyUnit setting; "" means seconds.
+func validateLatencyUnit(unit string) error {
+	switch unit {
+	case "", "s", "ms", "us":
+		return nil
+	}
+	return fmt.Errorf("prometheus.servicePairLatencyUnit must be s, ms or us, got %q", unit)
+}
+
+// validateNodeQueries checks nodeIPFamily ("" means ipv4) and
+// nodeQueryTimeoutSeconds.
+func (p PrometheusConfig) validateNodeQueries() error {
+	switch p.NodeIPFamily {
+	case "", "ipv4", "ipv6":
+	default:
+		return fmt.Errorf("prometheus.nodeIPFamily must be ipv4 or ipv6, got %q", p.NodeIPFamily)
+	}
+	if p.NodeQueryTimeoutSeconds < 0 {
+		return fmt.Errorf("prometheus.nodeQueryTimeoutSeconds must not be negative, got %v", p.NodeQueryTimeoutSeconds)
+	}
+	return nil
+}
+
+// NodeQueryTimeout is nodeQueryTimeoutSeconds; 0 means the client default.
+func (p PrometheusConfig) NodeQueryTimeout() time.Duration {
+	return seconds(p.NodeQueryTimeoutSeconds)
+}
+
+// MinPodAge is minPodAgeSeconds, default 30s.
+func (r RebalancingConfig) MinPodAge() time.Duration {
+	if r.MinPodAgeSeconds == 0 {
+		return 30 * time.Second
+	}
+	return time.Duration(r.MinPodAgeSeconds) * time.Second
+}
+
+// validateAggregations checks nodeAggregation and replicaAggregation.
+func (s ScoringWeights) validateAggregations() error {
+	switch s.NodeAggregation {
+	case "", "worst", "weighted":
+	default:
+		return fmt.Errorf("scoring.nodeAggregation must be worst or weighted, got %q", s.NodeAggregation)
+	}
+	switch s.ReplicaAggregation {
+	case "", "max", "min", "weighted":
+	default:
+		return fmt.Errorf("scoring.replicaAggregation must be max, min or weighted, got %q", s.ReplicaAggregation)
+	}
+	return nil
+}
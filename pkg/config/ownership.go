@@ -0,0 +1,15 @@
+package config
+
+// OwnershipConfig controls the markers stamped on updated Deployments
+// (lead.io/managed, lead.io/manager, lead.io/last-applied-decision-id and
+// lead.io/last-update-timestamp). Deployments another manager marked are
+// not modified unless Force is set, so two controllers (or a controller
+// and another tool using the markers) do not fight over them.
+type OwnershipConfig struct {
+	// Manager is this controller's name in lead.io/manager; default
+	// lead-net-affinity, or lead-net-affinity/<tenant> for a tenant.
+	Manager string `yaml:"manager,omitempty"`
+
+	// Force takes over Deployments marked by another manager.
+	Force bool `yaml:"force"`
+}
@@ -0,0 +1,41 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// PolicyConfig evaluates every affinity change and pod eviction against a
+// WebAssembly policy (see package policy) before it is applied.
+type PolicyConfig struct {
+	WASMModule string   `yaml:"wasmModule"`        // WASI command module; empty disables the policy
+	Runtime    []string `yaml:"runtime,omitempty"` // command running the module, default [wasmtime, run]; not in the published image
+	TimeoutMs  int      `yaml:"timeoutMs"`         // per evaluation, default 2000
+
+	// FailurePolicy is what an evaluation error does: fail (default)
+	// holds the action, ignore carries on as if it was allowed.
+	FailurePolicy string `yaml:"failurePolicy,omitempty"`
+}
+
+// FailOpen reports whether actions go ahead when the policy cannot be
+// evaluated.
+func (p PolicyConfig) FailOpen() bool {
+	return p.FailurePolicy == HookFailIgnore
+}
+
+// Validate checks the runtime command, timeout and failure policy. That
+// the runtime is installed is checked at startup, where it runs.
+func (p PolicyConfig) Validate() error {
+	if len(p.Runtime) > 0 && strings.TrimSpace(p.Runtime[0]) == "" {
+		return fmt.Errorf("policy.runtime must start with the runtime's executable, got %q", p.Runtime)
+	}
+	if p.TimeoutMs < 0 {
+		return fmt.Errorf("policy.timeoutMs must not be negative, got %d", p.TimeoutMs)
+	}
+	switch p.FailurePolicy {
+	case "", HookFailIgnore, HookFailClosed:
+	default:
+		return fmt.Errorf("policy.failurePolicy must be ignore or fail, got %q", p.FailurePolicy)
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+package config
+
+import (
+	"fmt"
+
+	"lead-net-affinity/pkg/graph"
+)
+
+// validatePorts checks the declared ports of every service (top-level and
+// tenant graphs) and normalises their app protocol, guessing it from the
+// port name like discovered ports (see graph.AppProtocolOf).
+func (c *Config) validatePorts() error {
+	graphs := map[string]*ServiceGraphConfig{"graph": &c.Graph}
+	for i := range c.Tenants {
+		graphs[fmt.Sprintf("tenants[%d] (%s) graph", i, c.Tenants[i].Name)] = &c.Tenants[i].Graph
+	}
+	for where, g := range graphs {
+		for _, s := range g.Services {
+			for i := range s.Ports {
+				p := &s.Ports[i]
+				if err := p.Validate(); err != nil {
+					return fmt.Errorf("%s: service %s: ports[%d]: %w", where, s.Name, i, err)
+				}
+				p.AppProtocol = graph.AppProtocolOf(p.AppProtocol, p.Name)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package config
+
+// Redacted is the placeholder for secrets removed by Config.Redacted.
+const Redacted = "REDACTED"
+
+// Redacted returns a copy of c without credentials: Prometheus auth, the
+// debug token and the values of extra HTTP headers. Shared in snapshots
+// and bug reports, it still configures the same decisions.
+func (c *Config) Redacted() *Config {
+	out := *c
+	for _, s := range []*string{&out.Prometheus.Auth.BearerToken, &out.Prometheus.Auth.Password, &out.Server.Debug.Token} {
+		if *s != "" {
+			*s = Redacted
+		}
+	}
+	redactHeaders(&out.Prometheus.HTTP.Headers)
+	redactHeaders(&out.Tracing.HTTP.Headers)
+	redactHeaders(&out.Output.HTTPHeaders)
+	redactHeaders(&out.Reports.HTTPHeaders)
+	out.Tenants = append([]TenantConfig(nil), c.Tenants...)
+	for i, t := range out.Tenants {
+		if t.Output != nil {
+			o := *t.Output
+			redactHeaders(&o.HTTPHeaders)
+			out.Tenants[i].Output = &o
+		}
+	}
+	return &out
+}
+
+func redactHeaders(h *map[string]string) {
+	if len(*h) == 0 {
+		return
+	}
+	out := make(map[string]string, len(*h))
+	for k := range *h {
+		out[k] = Redacted
+	}
+	*h = out
+}
@@ -0,0 +1,58 @@
+package config
+
+import "fmt"
+
+// Report schedules and formats.
+const (
+	ReportDaily    = "daily"
+	ReportWeekly   = "weekly"
+	ReportMarkdown = "markdown"
+	ReportHTML     = "html"
+)
+
+// ReportsConfig generates a periodic placement and health summary (top
+// critical paths, placement changes, latency trends, bad nodes and the
+// cross-zone traffic saved) for platform reviews. Periods end at midnight
+// UTC, weekly ones on Monday. Reports are written like output exports; at
+// least one destination enables them.
+type ReportsConfig struct {
+	Schedule    string            `yaml:"schedule"` // daily (default) or weekly
+	Format      string            `yaml:"format"`   // markdown (default) or html
+	TopPaths    int               `yaml:"topPaths"` // default 5
+	Directory   string            `yaml:"directory"`
+	ConfigMap   string            `yaml:"configMap"` // "namespace/name"
+	HTTPURL     string            `yaml:"httpURL"`   // reports are PUT to <httpURL>/<file>
+	HTTPHeaders map[string]string `yaml:"httpHeaders"`
+}
+
+// Enabled reports whether a destination is configured.
+func (r ReportsConfig) Enabled() bool {
+	return r.Directory != "" || r.ConfigMap != "" || r.HTTPURL != ""
+}
+
+// Destinations returns the report destinations as an OutputConfig, for
+// output.SinksFromConfig.
+func (r ReportsConfig) Destinations() OutputConfig {
+	return OutputConfig{Directory: r.Directory, ConfigMap: r.ConfigMap, HTTPURL: r.HTTPURL, HTTPHeaders: r.HTTPHeaders}
+}
+
+// Validate checks the schedule, format, path count and ConfigMap.
+func (r ReportsConfig) Validate() error {
+	switch r.Schedule {
+	case "", ReportDaily, ReportWeekly:
+	default:
+		return fmt.Errorf("reports.schedule must be daily or weekly, got %q", r.Schedule)
+	}
+	switch r.Format {
+	case "", ReportMarkdown, ReportHTML:
+	default:
+		return fmt.Errorf("reports.format must be markdown or html, got %q", r.Format)
+	}
+	if r.TopPaths < 0 {
+		return fmt.Errorf("reports.topPaths must not be negative, got %d", r.TopPaths)
+	}
+	if r.ConfigMap != "" && !validConfigMapRef(r.ConfigMap) {
+		return fmt.Errorf("reports.configMap must be namespace/name, got %q", r.ConfigMap)
+	}
+	return nil
+}
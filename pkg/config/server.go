@@ -0,0 +1,121 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// ServerConfig configures the embedded HTTP server (probes, /metrics and
+// the API). Env LEAD_NET_HTTP_ADDR overrides address.
+type ServerConfig struct {
+	Address     string `yaml:"address"`     // default :8080
+	TLSCertFile string `yaml:"tlsCertFile"` // serve HTTPS with this certificate and key
+	TLSKeyFile  string `yaml:"tlsKeyFile"`
+
+	ReadTimeoutSeconds       float64 `yaml:"readTimeoutSeconds"`       // 0 = none
+	ReadHeaderTimeoutSeconds float64 `yaml:"readHeaderTimeoutSeconds"` // default 5
+	WriteTimeoutSeconds      float64 `yaml:"writeTimeoutSeconds"`      // 0 = none
+	IdleTimeoutSeconds       float64 `yaml:"idleTimeoutSeconds"`       // 0 = readTimeoutSeconds
+	MaxHeaderBytes           int     `yaml:"maxHeaderBytes"`           // default 1 MiB
+
+	// ShutdownTimeoutSeconds is how long in-flight requests may finish on
+	// SIGTERM before connections are closed; default 5.
+	ShutdownTimeoutSeconds float64 `yaml:"shutdownTimeoutSeconds"`
+
+	// Debug enables the profiling endpoints; see DebugConfig.
+	Debug DebugConfig `yaml:"debug"`
+}
+
+// AddressOrDefault returns Address, or :8080 if unset.
+func (s ServerConfig) AddressOrDefault() string {
+	if s.Address == "" {
+		return ":8080"
+	}
+	return s.Address
+}
+
+// ReadHeaderTimeout returns readHeaderTimeoutSeconds, default 5s.
+func (s ServerConfig) ReadHeaderTimeout() time.Duration {
+	if s.ReadHeaderTimeoutSeconds == 0 {
+		return 5 * time.Second
+	}
+	return seconds(s.ReadHeaderTimeoutSeconds)
+}
+
+// ReadTimeout, WriteTimeout and IdleTimeout return the configured
+// timeouts; 0 means none (IdleTimeout: the read timeout).
+func (s ServerConfig) ReadTimeout() time.Duration  { return seconds(s.ReadTimeoutSeconds) }
+func (s ServerConfig) WriteTimeout() time.Duration { return seconds(s.WriteTimeoutSeconds) }
+func (s ServerConfig) IdleTimeout() time.Duration  { return seconds(s.IdleTimeoutSeconds) }
+
+// ShutdownTimeout returns shutdownTimeoutSeconds, default 5s.
+func (s ServerConfig) ShutdownTimeout() time.Duration {
+	if s.ShutdownTimeoutSeconds == 0 {
+		return 5 * time.Second
+	}
+	return seconds(s.ShutdownTimeoutSeconds)
+}
+
+// Validate rejects negative timeouts and a certificate without its key.
+func (s ServerConfig) Validate() error {
+	if (s.TLSCertFile == "") != (s.TLSKeyFile == "") {
+		return fmt.Errorf("server.tlsCertFile and server.tlsKeyFile must be set together")
+	}
+	for name, v := range map[string]float64{
+		"readTimeoutSeconds":       s.ReadTimeoutSeconds,
+		"readHeaderTimeoutSeconds": s.ReadHeaderTimeoutSeconds,
+		"writeTimeoutSeconds":      s.WriteTimeoutSeconds,
+		"idleTimeoutSeconds":       s.IdleTimeoutSeconds,
+		"shutdownTimeoutSeconds":   s.ShutdownTimeoutSeconds,
+	} {
+		if v < 0 {
+			return fmt.Errorf("server.%s must not be negative, got %v", name, v)
+		}
+	}
+	if s.MaxHeaderBytes < 0 {
+		return fmt.Errorf("server.maxHeaderBytes must not be negative, got %d", s.MaxHeaderBytes)
+	}
+	return s.Debug.Validate()
+}
+
+func seconds(v float64) time.Duration {
+	return time.Duration(v * float64(time.Second))
+}
+
+// DebugConfig serves /debug/pprof/ and /debug/vars (expvar, incl.
+// memstats) on the HTTP server for profiling long-running controllers.
+// Requests must carry "Authorization: Bearer <token>". The token also
+// guards the endpoints that change what the controller does, such as
+// approval decisions, whether or not debugging is enabled; without a token
+// they refuse every request.
+type DebugConfig struct {
+	Enabled   bool   `yaml:"enabled"`
+	Token     string `yaml:"token"`
+	TokenFile string `yaml:"tokenFile"` // re-read per request, so a rotated Secret applies at once
+
+	// Inject also serves /inject, behind the same token, to override node
+	// and edge metrics with synthetic values for rehearsing the
+	// controller's reactions in staging. Never enable it in production.
+	Inject bool `yaml:"inject"`
+
+	// Record keeps the inputs of the last full reconcile and serves them
+	// at /snapshot, behind the same token, for "lead-net-affinity replay".
+	Record bool `yaml:"record"`
+}
+
+// Validate requires a token for enabled debug endpoints.
+func (d DebugConfig) Validate() error {
+	if d.Enabled && d.Token == "" && d.TokenFile == "" {
+		return fmt.Errorf("server.debug.enabled needs server.debug.token or tokenFile")
+	}
+	if d.Token != "" && d.TokenFile != "" {
+		return fmt.Errorf("server.debug.token and tokenFile are mutually exclusive")
+	}
+	if d.Inject && !d.Enabled {
+		return fmt.Errorf("server.debug.inject needs server.debug.enabled")
+	}
+	if d.Record && !d.Enabled {
+		return fmt.Errorf("server.debug.record needs server.debug.enabled")
+	}
+	return nil
+}
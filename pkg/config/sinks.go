@@ -0,0 +1,97 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// S3Output uploads every exported file to s3://<bucket>/<prefix><file>,
+// signed with AWS Signature Version 4. Credentials come from the
+// environment: AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and
+// AWS_SESSION_TOKEN, or the web identity token EKS injects for IRSA
+// (AWS_ROLE_ARN and AWS_WEB_IDENTITY_TOKEN_FILE).
+type S3Output struct {
+	Bucket string `yaml:"bucket"` // empty disables the sink
+	Prefix string `yaml:"prefix"` // e.g. "lead/"; prepended as is
+	Region string `yaml:"region"` // default $AWS_REGION
+
+	// Endpoint is an S3-compatible server (MinIO, Ceph) addressed with
+	// path-style URLs; empty means AWS, https://<bucket>.s3.<region>.amazonaws.com.
+	Endpoint string `yaml:"endpoint"`
+}
+
+// GCSOutput uploads every exported file to gs://<bucket>/<prefix><file>
+// with the JSON API. The access token comes from the GKE metadata server
+// (workload identity) unless TokenFile is set.
+type GCSOutput struct {
+	Bucket    string `yaml:"bucket"` // empty disables the sink
+	Prefix    string `yaml:"prefix"`
+	TokenFile string `yaml:"tokenFile"` // OAuth2 access token, re-read per export
+	Endpoint  string `yaml:"endpoint"`  // default https://storage.googleapis.com
+}
+
+// OCIOutput pushes all exported files as one tar+gzip layer to an OCI
+// registry, in the artifact format Flux's OCIRepository pulls.
+type OCIOutput struct {
+	Repository string `yaml:"repository"` // e.g. ghcr.io/acme/lead-patches; empty disables the sink
+	Tag        string `yaml:"tag"`        // default latest
+
+	// Username and PasswordFile authenticate to the registry, also for
+	// its token service; PasswordFile is re-read per push.
+	Username     string `yaml:"username"`
+	PasswordFile string `yaml:"passwordFile"`
+
+	// PlainHTTP talks to the registry without TLS, for in-cluster
+	// registries only.
+	PlainHTTP bool `yaml:"plainHTTP"`
+}
+
+// TagOrDefault returns Tag, or latest if unset.
+func (o OCIOutput) TagOrDefault() string {
+	if o.Tag == "" {
+		return "latest"
+	}
+	return o.Tag
+}
+
+var ociTag = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9._-]{0,127}$`)
+
+// validateSinks checks the ConfigMap, S3, GCS and OCI settings.
+func (o OutputConfig) validateSinks() error {
+	if o.ConfigMap != "" && !validConfigMapRef(o.ConfigMap) {
+		return fmt.Errorf("output.configMap must be namespace/name, got %q", o.ConfigMap)
+	}
+	if o.NodeScoresConfigMap != "" && !validConfigMapRef(o.NodeScoresConfigMap) {
+		return fmt.Errorf("output.nodeScoresConfigMap must be namespace/name, got %q", o.NodeScoresConfigMap)
+	}
+	if o.S3.Bucket != "" && o.S3.Region == "" && os.Getenv("AWS_REGION") == "" {
+		return fmt.Errorf("output.s3 bucket %q needs output.s3.region or AWS_REGION", o.S3.Bucket)
+	}
+	if o.S3.Endpoint != "" && !strings.HasPrefix(o.S3.Endpoint, "http://") && !strings.HasPrefix(o.S3.Endpoint, "https://") {
+		return fmt.Errorf("output.s3.endpoint must be an http(s) URL, got %q", o.S3.Endpoint)
+	}
+	if o.GCS.Endpoint != "" && !strings.HasPrefix(o.GCS.Endpoint, "http://") && !strings.HasPrefix(o.GCS.Endpoint, "https://") {
+		return fmt.Errorf("output.gcs.endpoint must be an http(s) URL, got %q", o.GCS.Endpoint)
+	}
+	if r := o.OCI.Repository; r != "" {
+		host, name, ok := strings.Cut(r, "/")
+		if !ok || host == "" || name == "" || strings.Contains(r, "://") {
+			return fmt.Errorf("output.oci.repository must be <registry>/<name>, got %q", r)
+		}
+	}
+	if o.OCI.Tag != "" && !ociTag.MatchString(o.OCI.Tag) {
+		return fmt.Errorf("output.oci.tag: invalid tag %q", o.OCI.Tag)
+	}
+	if o.OCI.PasswordFile != "" && o.OCI.Username == "" {
+		return fmt.Errorf("output.oci.passwordFile needs output.oci.username")
+	}
+	return nil
+}
+
+// validConfigMapRef reports whether ref is "namespace/name".
+func validConfigMapRef(ref string) bool {
+	ns, name, ok := strings.Cut(ref, "/")
+	return ok && ns != "" && name != "" && !strings.Contains(name, "/")
+}
@@ -0,0 +1,70 @@
+package config
+
+import "fmt"
+
+// SLOConfig sets end-to-end latency objectives for graph paths. A path
+// meets its objective in a reconcile when the sum of its measured edge
+// latencies is at or below the objective; the error budget is the
+// 1-target share of reconciles allowed to miss it.
+type SLOConfig struct {
+	PathLatencyMs float64            `yaml:"pathLatencyMs"` // objective for every path; 0 = none
+	Paths         map[string]float64 `yaml:"paths"`         // per path ID (e.g. fe-src-prf), overrides pathLatencyMs
+	Target        float64            `yaml:"target"`        // share of reconciles meeting the objective; default 0.99
+	WindowSamples int                `yaml:"windowSamples"` // reconciles the burn rate covers; default all kept path history
+
+	// GatewayLatencyMs is the objective for the user-facing latency
+	// measured at the entry point (prometheus.gateway); 0 = none. While the
+	// gateway burns its budget at reanalyzeBurnRate or more, no changes are
+	// held.
+	GatewayLatencyMs float64 `yaml:"gatewayLatencyMs"`
+
+	// ReanalyzeBurnRate holds affinity changes and replica recommendations
+	// for a service until a path through it burns its error budget at this
+	// multiple of the sustainable rate or more; 0 changes on every
+	// reconcile. Services on a path without an objective are never held.
+	ReanalyzeBurnRate float64 `yaml:"reanalyzeBurnRate"`
+}
+
+// DefaultSLOTarget is used when SLOConfig.Target is unset.
+const DefaultSLOTarget = 0.99
+
+// LatencyObjective returns the objective of path id in ms, or 0 if none.
+func (s SLOConfig) LatencyObjective(id string) float64 {
+	if v, ok := s.Paths[id]; ok {
+		return v
+	}
+	return s.PathLatencyMs
+}
+
+// TargetOrDefault returns Target, or DefaultSLOTarget if unset.
+func (s SLOConfig) TargetOrDefault() float64 {
+	if s.Target == 0 {
+		return DefaultSLOTarget
+	}
+	return s.Target
+}
+
+// Validate rejects negative objectives and targets outside (0, 1).
+func (s SLOConfig) Validate() error {
+	if s.PathLatencyMs < 0 {
+		return fmt.Errorf("slo.pathLatencyMs must not be negative, got %v", s.PathLatencyMs)
+	}
+	for id, v := range s.Paths {
+		if v < 0 {
+			return fmt.Errorf("slo.paths[%s] must not be negative, got %v", id, v)
+		}
+	}
+	if s.GatewayLatencyMs < 0 {
+		return fmt.Errorf("slo.gatewayLatencyMs must not be negative, got %v", s.GatewayLatencyMs)
+	}
+	if s.Target < 0 || s.Target >= 1 {
+		return fmt.Errorf("slo.target must be in (0, 1), got %v", s.Target)
+	}
+	if s.ReanalyzeBurnRate < 0 {
+		return fmt.Errorf("slo.reanalyzeBurnRate must not be negative, got %v", s.ReanalyzeBurnRate)
+	}
+	if s.WindowSamples < 0 {
+		return fmt.Errorf("slo.windowSamples must not be negative, got %d", s.WindowSamples)
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package config
+
+import "fmt"
+
+// Smoothing methods for SmoothingConfig.Method.
+const (
+	SmoothNone   = ""       // use each sample as fetched
+	SmoothMedian = "median" // median of the last window samples
+	SmoothEWMA   = "ewma"   // exponentially weighted moving average
+)
+
+// SmoothingConfig filters node latency/bandwidth and edge latency samples
+// before scoring and bad-node detection, so a single GC pause or scrape
+// glitch does not trigger rebalancing.
+type SmoothingConfig struct {
+	Method string  `yaml:"method"` // median, ewma or "" (off)
+	Window int     `yaml:"window"` // samples kept per series; default 5
+	Alpha  float64 `yaml:"alpha"`  // ewma weight of the newest sample; default 0.3
+
+	// OutlierMADs rejects a sample further than this many median absolute
+	// deviations from the window median; 0 disables rejection.
+	OutlierMADs float64 `yaml:"outlierMADs"`
+}
+
+// Validate rejects unknown methods and out-of-range parameters.
+func (s SmoothingConfig) Validate() error {
+	switch s.Method {
+	case SmoothNone, SmoothMedian, SmoothEWMA:
+	default:
+		return fmt.Errorf("smoothing.method: unknown method %q (want %s or %s)", s.Method, SmoothMedian, SmoothEWMA)
+	}
+	if s.Window < 0 {
+		return fmt.Errorf("smoothing.window must not be negative, got %d", s.Window)
+	}
+	if s.Alpha < 0 || s.Alpha > 1 {
+		return fmt.Errorf("smoothing.alpha must be in [0, 1], got %v", s.Alpha)
+	}
+	if s.OutlierMADs < 0 {
+		return fmt.Errorf("smoothing.outlierMADs must not be negative, got %v", s.OutlierMADs)
+	}
+	return nil
+}
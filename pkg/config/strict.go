@@ -0,0 +1,130 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// decodeStrict decodes a config document into c, rejecting keys that are
+// not config fields (a misspelled "scorring:" would otherwise silently
+// leave the whole section at its defaults) and values of the wrong type.
+// Errors name the file, line and column.
+func decodeStrict(path string, data []byte, c *Config) error {
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	err := dec.Decode(c)
+	if err == nil || errors.Is(err, io.EOF) {
+		return nil
+	}
+	// A config for a newer schema fails on its new fields; say so instead.
+	var probe struct {
+		APIVersion string `yaml:"apiVersion"`
+	}
+	if yaml.Unmarshal(data, &probe) == nil {
+		if verr := (&Config{APIVersion: probe.APIVersion}).validateAPIVersion(); verr != nil {
+			return verr
+		}
+	}
+	var msgs []string
+	var terr *yaml.TypeError
+	if errors.As(err, &terr) {
+		msgs = terr.Errors
+	} else {
+		msgs = []string{strings.TrimPrefix(err.Error(), "yaml: ")}
+	}
+	lines := strings.Split(string(data), "\n")
+	for i, m := range msgs {
+		msgs[i] = path + ":" + positioned(m, lines)
+	}
+	return fmt.Errorf("%s", strings.Join(msgs, "\n"))
+}
+
+var (
+	yamlErrLine    = regexp.MustCompile(`^line (\d+): (.*)$`)
+	yamlErrUnknown = regexp.MustCompile(`^field (\S+) not found in type (\S+)$`)
+)
+
+// positioned rewrites a yaml.v3 "line N: msg" error as "N:C: msg". The
+// column is that of the unknown key, or of the line's first non-blank
+// character for other errors.
+func positioned(msg string, lines []string) string {
+	m := yamlErrLine.FindStringSubmatch(msg)
+	if m == nil {
+		return " " + msg
+	}
+	n, _ := strconv.Atoi(m[1])
+	text := m[2]
+	col := 1
+	if n >= 1 && n <= len(lines) {
+		line := lines[n-1]
+		col = len(line) - len(strings.TrimLeft(line, " \t-")) + 1
+		if u := yamlErrUnknown.FindStringSubmatch(text); u != nil {
+			if i := strings.Index(line, u[1]+":"); i >= 0 {
+				col = i + 1
+			}
+			text = fmt.Sprintf("unknown field %q in %s", u[1], strings.TrimPrefix(u[2], "config."))
+		}
+	}
+	return fmt.Sprintf("%d:%d: %s", n, col, text)
+}
+
+// legacyNodeQueries holds the NodeRTTQuery, NodeDropRateQuery and
+// NodeBandwidthQuery keys of configs written before the prometheus keys
+// were made camelCase like every other key.
+type legacyNodeQueries struct {
+	LegacyNodeRTTQuery       string `yaml:"NodeRTTQuery,omitempty"`
+	LegacyNodeDropRateQuery  string `yaml:"NodeDropRateQuery,omitempty"`
+	LegacyNodeBandwidthQuery string `yaml:"NodeBandwidthQuery,omitempty"`
+}
+
+// applyLegacyKeys moves capitalized node queries to their camelCase fields;
+// setting both spellings of one query is an error.
+func (p *PrometheusConfig) applyLegacyKeys() error {
+	for _, k := range []struct {
+		name      string
+		legacy    string
+		canonical *string
+	}{
+		{"nodeRTTQuery", p.LegacyNodeRTTQuery, &p.NodeRTTQuery},
+		{"nodeDropRateQuery", p.LegacyNodeDropRateQuery, &p.NodeDropRateQuery},
+		{"nodeBandwidthQuery", p.LegacyNodeBandwidthQuery, &p.NodeBandwidthQuery},
+	} {
+		if k.legacy == "" {
+			continue
+		}
+		if *k.canonical != "" {
+			return fmt.Errorf("prometheus.%s is set twice (also as %s%s)", k.name, strings.ToUpper(k.name[:1]), k.name[1:])
+		}
+		*k.canonical = k.legacy
+	}
+	p.legacyNodeQueries = legacyNodeQueries{}
+	return nil
+}
+
+// legacyRebalancing holds maxConcurrentDeletions, the deprecated name of
+// maxDeletionsPerPass: it never limited concurrency, only the deletions of
+// one reconcile pass.
+type legacyRebalancing struct {
+	LegacyMaxConcurrentDeletions int `yaml:"maxConcurrentDeletions,omitempty"`
+}
+
+// applyLegacyKeys moves maxConcurrentDeletions to maxDeletionsPerPass;
+// setting both is an error.
+func (r *RebalancingConfig) applyLegacyKeys() error {
+	if r.LegacyMaxConcurrentDeletions == 0 {
+		return nil
+	}
+	if r.MaxDeletionsPerPass != 0 {
+		return fmt.Errorf("rebalancing.maxDeletionsPerPass is set twice (also as the deprecated maxConcurrentDeletions)")
+	}
+	r.MaxDeletionsPerPass = r.LegacyMaxConcurrentDeletions
+	r.legacyRebalancing = legacyRebalancing{}
+	return nil
+}
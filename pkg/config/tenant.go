@@ -0,0 +1,61 @@
+package config
+
+import "fmt"
+
+// TenantConfig is one team's application: its own graph, namespaces and,
+// optionally, its own weights and output. Each tenant gets an independent
+// reconcile loop, so teams sharing one deployment never see each other's
+// services or decisions. Sections left out inherit the top-level config.
+type TenantConfig struct {
+	Name               string             `yaml:"name"`
+	NamespaceSelector  []string           `yaml:"namespaceSelector"`
+	DeploymentSelector map[string]string  `yaml:"deploymentSelector,omitempty"`
+	Graph              ServiceGraphConfig `yaml:"graph"`
+
+	Scoring  *ScoringWeights `yaml:"scoring,omitempty"`
+	Affinity *AffinityConfig `yaml:"affinity,omitempty"`
+	Output   *OutputConfig   `yaml:"output,omitempty"`
+}
+
+// ForTenant returns a copy of c scoped to tenant t: t's graph plus its
+// namespaces, deployment selector and any section it overrides. The copy has
+// no tenants of its own.
+func (c *Config) ForTenant(t TenantConfig) *Config {
+	out := *c
+	out.Tenants = nil
+	out.Graph = t.Graph
+	if len(t.NamespaceSelector) > 0 {
+		out.NamespaceSelector = t.NamespaceSelector
+	}
+	if len(t.DeploymentSelector) > 0 {
+		out.DeploymentSelector = t.DeploymentSelector
+	}
+	if t.Scoring != nil {
+		out.Scoring = *t.Scoring
+	}
+	if t.Affinity != nil {
+		out.Affinity = *t.Affinity
+	}
+	if t.Output != nil {
+		out.Output = *t.Output
+	}
+	return &out
+}
+
+// validateTenants requires unique, named tenants with an entry service.
+func (c *Config) validateTenants() error {
+	seen := make(map[string]bool)
+	for i, t := range c.Tenants {
+		if t.Name == "" {
+			return fmt.Errorf("tenants[%d]: name is required", i)
+		}
+		if seen[t.Name] {
+			return fmt.Errorf("tenants[%d]: duplicate name %q", i, t.Name)
+		}
+		seen[t.Name] = true
+		if t.Graph.Entry == "" {
+			return fmt.Errorf("tenants[%d] (%s): graph.entry is required", i, t.Name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,28 @@
+package config
+
+import "fmt"
+
+// ServiceThresholds overrides the scoring.bad* latency thresholds for the
+// services it matches, since a database and a frontend have very different
+// healthy ranges. Health status uses them; an entry matches by service name
+// or by the pod template labels of the service's deployment. Name matches
+// win over selector matches, and earlier entries over later ones.
+type ServiceThresholds struct {
+	Service  string            `yaml:"service,omitempty"`
+	Selector map[string]string `yaml:"selector,omitempty"`
+
+	BadLatencyMs     float64 `yaml:"badLatencyMs,omitempty"`     // RTT of the node running the service; 0 = scoring.badLatencyMs
+	BadEdgeLatencyMs float64 `yaml:"badEdgeLatencyMs,omitempty"` // latency of calls to the service; 0 = scoring.badEdgeLatencyMs
+}
+
+func (c *Config) validateThresholds() error {
+	for i, t := range c.Thresholds {
+		if (t.Service == "") == (len(t.Selector) == 0) {
+			return fmt.Errorf("thresholds[%d]: set exactly one of service and selector", i)
+		}
+		if t.BadLatencyMs < 0 || t.BadEdgeLatencyMs < 0 {
+			return fmt.Errorf("thresholds[%d]: thresholds must not be negative", i)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,27 @@
+package config
+
+import "fmt"
+
+// APIVersion is the config schema version this controller reads. Generated
+// configs (the Helm chart) set it so a chart and controller that disagree on
+// the schema fail at startup instead of silently dropping fields.
+const APIVersion = "lead.io/v1alpha1"
+
+// supportedAPIVersions are the schema versions Load accepts. An empty
+// apiVersion (hand-written configs from before versioning) means APIVersion.
+var supportedAPIVersions = []string{APIVersion}
+
+// validateAPIVersion rejects configs written for a schema this controller
+// does not know and fills in the default version.
+func (c *Config) validateAPIVersion() error {
+	if c.APIVersion == "" {
+		c.APIVersion = APIVersion
+		return nil
+	}
+	for _, v := range supportedAPIVersions {
+		if c.APIVersion == v {
+			return nil
+		}
+	}
+	return fmt.Errorf("apiVersion %q is not supported (want one of %v)", c.APIVersion, supportedAPIVersions)
+}
@@ -0,0 +1,226 @@
+package controller
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+
+	"lead-net-affinity/pkg/metrics"
+)
+
+// Kinds of mutating actions held by the approval queue.
+const (
+	ActionPatch = "patch" // affinity update of a deployment
+	ActionEvict = "evict" // pod deletion during rebalancing
+)
+
+// States of a queued action.
+const (
+	ApprovalPending  = "pending"
+	ApprovalApproved = "approved"
+	ApprovalDenied   = "denied"
+)
+
+const defaultApprovalTTL = time.Hour
+
+var errUnknownAction = errors.New("no such action")
+
+// PendingAction is a mutating action the controller wants to take and an
+// operator has to approve (see config.ApprovalConfig). The ID is stable for
+// as long as reconciles keep proposing the same change; a different change
+// to the same object replaces it under a new ID.
+type PendingAction struct {
+	ID         string    `json:"id"`
+	Kind       string    `json:"kind"`
+	Namespace  string    `json:"namespace"`
+	Name       string    `json:"name"`
+	Risk       float64   `json:"risk"` // pods disrupted
+	Reason     string    `json:"reason"`
+	State      string    `json:"state"`
+	ProposedAt time.Time `json:"proposedAt"`
+	LastSeen   time.Time `json:"lastSeen"`
+
+	fingerprint string
+}
+
+type approvalQueue struct {
+	mu    sync.Mutex
+	items map[string]*PendingAction // by kind/namespace/name
+}
+
+// propose queues an action and reports whether it was approved. An approved
+// action is removed from the queue when it is handed out.
+func (q *approvalQueue) propose(a PendingAction, now time.Time) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.items == nil {
+		q.items = make(map[string]*PendingAction)
+	}
+	key := a.Kind + "/" + a.Namespace + "/" + a.Name
+	if cur, ok := q.items[key]; ok && cur.fingerprint == a.fingerprint {
+		cur.LastSeen = now
+		if cur.State == ApprovalApproved {
+			delete(q.items, key)
+			return true
+		}
+		return false
+	}
+	sum := sha256.Sum256([]byte(key + "@" + a.fingerprint))
+	a.ID = hex.EncodeToString(sum[:6])
+	a.State = ApprovalPending
+	a.ProposedAt, a.LastSeen = now, now
+	q.items[key] = &a
+	return false
+}
+
+// decide moves a pending action to approved or denied.
+func (q *approvalQueue) decide(id string, approve bool) (PendingAction, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, a := range q.items {
+		if a.ID != id {
+			continue
+		}
+		if a.State != ApprovalPending {
+			return *a, fmt.Errorf("action %s is already %s", id, a.State)
+		}
+		a.State = ApprovalDenied
+		if approve {
+			a.State = ApprovalApproved
+		}
+		return *a, nil
+	}
+	return PendingAction{}, fmt.Errorf("%w: %q", errUnknownAction, id)
+}
+
+// expire drops actions no reconcile proposed within ttl and returns the
+// number still pending.
+func (q *approvalQueue) expire(now time.Time, ttl time.Duration) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	pending := 0
+	for key, a := range q.items {
+		if now.Sub(a.LastSeen) > ttl {
+			delete(q.items, key)
+			continue
+		}
+		if a.State == ApprovalPending {
+			pending++
+		}
+	}
+	return pending
+}
+
+func (q *approvalQueue) list() []PendingAction {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	out := make([]PendingAction, 0, len(q.items))
+	for _, a := range q.items {
+		out = append(out, *a)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].ProposedAt.Equal(out[j].ProposedAt) {
+			return out[i].ProposedAt.Before(out[j].ProposedAt)
+		}
+		return out[i].ID < out[j].ID
+	})
+	return out
+}
+
+// Approvals returns the queued actions, oldest first.
+func (c *Controller) Approvals() []PendingAction {
+	return c.approvals.list()
+}
+
+// DecideApproval approves or denies a pending action. Approved actions are
+// applied by the next reconcile, which is triggered right away; they are
+// only applied if that reconcile still proposes the same change.
+func (c *Controller) DecideApproval(id string, approve bool) (PendingAction, error) {
+	a, err := c.approvals.decide(id, approve)
+	if err != nil {
+		return a, err
+	}
+	c.infof("%s %s %s/%s (id %s, risk %.0f)", a.State, a.Kind, a.Namespace, a.Name, a.ID, a.Risk)
+	if approve {
+		c.Trigger("approval " + a.ID)
+	}
+	return a, nil
+}
+
+// approved reports whether a mutating action may be applied now. Without an
+// approval gate and below the auto-approve risk everything passes; other
+// actions wait in the queue until approved.
+func (c *Controller) approved(kind, namespace, name, fingerprint string, risk float64, reason string) bool {
+	ac := c.cfg.Approval
+	if !ac.Enabled || risk < ac.AutoApproveBelowRisk {
+		return true
+	}
+	ok := c.approvals.propose(PendingAction{
+		Kind:        kind,
+		Namespace:   namespace,
+		Name:        name,
+		Risk:        risk,
+		Reason:      reason,
+		fingerprint: fingerprint,
+	}, time.Now())
+	if !ok {
+		c.infof("awaiting approval: %s %s/%s (risk %.0f): %s", kind, namespace, name, risk, reason)
+	}
+	return ok
+}
+
+// approvedPatch gates an affinity update of d. before is the fingerprint of
+// d's affinity as read from the cluster; updates that change nothing pass.
+func (c *Controller) approvedPatch(d *appsv1.Deployment, before, reason string) bool {
+	fp := affinityFingerprint(d)
+	if fp == before {
+		return true
+	}
+	replicas := int32(1)
+	if d.Spec.Replicas != nil {
+		replicas = *d.Spec.Replicas
+	}
+	return c.approved(ActionPatch, d.Namespace, d.Name, fp, float64(replicas), reason)
+}
+
+// affinityFingerprints snapshots the current affinity of every deployment,
+// keyed namespace/name.
+func affinityFingerprints(deploys []appsv1.Deployment) map[string]string {
+	out := make(map[string]string, len(deploys))
+	for i := range deploys {
+		out[deploys[i].Namespace+"/"+deploys[i].Name] = affinityFingerprint(&deploys[i])
+	}
+	return out
+}
+
+// affinityFingerprint hashes d's affinity and, when set, its topology
+// spread constraints.
+func affinityFingerprint(d *appsv1.Deployment) string {
+	var v any = d.Spec.Template.Spec.Affinity
+	if tsc := d.Spec.Template.Spec.TopologySpreadConstraints; len(tsc) > 0 {
+		v = []any{d.Spec.Template.Spec.Affinity, tsc}
+	}
+	b, _ := json.Marshal(v)
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// expireApprovals drops stale actions and publishes the queue length.
+func (c *Controller) expireApprovals() {
+	if !c.cfg.Approval.Enabled {
+		return
+	}
+	ttl := defaultApprovalTTL
+	if c.cfg.Approval.TTLSeconds > 0 {
+		ttl = time.Duration(c.cfg.Approval.TTLSeconds) * time.Second
+	}
+	pending := c.approvals.expire(time.Now(), ttl)
+	metrics.Default.Set("lead_net_approvals_pending", "Mutating actions waiting for approval.", c.metricLabels(), float64(pending))
+}
@@ -0,0 +1,92 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+
+	"lead-net-affinity/pkg/kube"
+	"lead-net-affinity/pkg/rbac"
+)
+
+// rolloutClient is optionally implemented by the KubeClient (kube.Client
+// does); controller.argoRollouts needs it. Rollouts travel as Deployments
+// marked by kube.IsRollout.
+type rolloutClient interface {
+	ListRollouts(ctx context.Context, namespaces []string) ([]appsv1.Deployment, error)
+	GetRollout(ctx context.Context, namespace, name string) (*appsv1.Deployment, error)
+	UpdateRollout(ctx context.Context, d *appsv1.Deployment) error
+}
+
+// argoRollouts returns the rollout client if Argo Rollouts are managed.
+func (c *Controller) argoRollouts() (rolloutClient, bool) {
+	rc, ok := c.k8s.(rolloutClient)
+	return rc, ok && c.cfg.Controller.ArgoRollouts && c.caps.Has(rbac.FeatureArgoRollouts)
+}
+
+// listRollouts returns the Argo Rollouts to manage next to the Deployments.
+// Failing to list them degrades the reconcile to Deployments only.
+func (c *Controller) listRollouts(ctx context.Context, namespaces []string, report *reconcileReport) []appsv1.Deployment {
+	if !c.cfg.Controller.ArgoRollouts {
+		return nil
+	}
+	rc, ok := c.argoRollouts()
+	if !ok {
+		c.infof("warning: controller.argoRollouts is set but Rollout access is missing; managing Deployments only")
+		return nil
+	}
+	rollouts, err := rc.ListRollouts(ctx, namespaces)
+	if err != nil {
+		c.infof("warning: failed to list Argo Rollouts; managing Deployments only: %v", err)
+		report.degradedf("list rollouts: %v", err)
+		return nil
+	}
+	c.debugf("found %d Argo Rollouts", len(rollouts))
+	return rollouts
+}
+
+// updateWorkload writes d's affinity to its Deployment or Argo Rollout.
+func (c *Controller) updateWorkload(ctx context.Context, d *appsv1.Deployment) error {
+	if !kube.IsRollout(d) {
+		return c.k8s.UpdateDeployment(ctx, d)
+	}
+	rc, ok := c.argoRollouts()
+	if !ok {
+		return fmt.Errorf("rollout %s/%s: Argo Rollouts are not managed", d.Namespace, d.Name)
+	}
+	return rc.UpdateRollout(ctx, d)
+}
+
+// getWorkload re-reads d from its Deployment or Argo Rollout; ok is false
+// if the KubeClient cannot.
+func (c *Controller) getWorkload(ctx context.Context, d *appsv1.Deployment) (cur *appsv1.Deployment, ok bool, err error) {
+	if kube.IsRollout(d) {
+		rc, ok := c.argoRollouts()
+		if !ok {
+			return nil, false, nil
+		}
+		cur, err = rc.GetRollout(ctx, d.Namespace, d.Name)
+		return cur, true, err
+	}
+	getter, ok := c.k8s.(deploymentGetter)
+	if !ok {
+		return nil, false, nil
+	}
+	cur, err = getter.GetDeployment(ctx, d.Namespace, d.Name)
+	return cur, true, err
+}
+
+// rolloutInProgress reports whether d is an Argo Rollout in the middle of a
+// canary or blue-green rollout. Changing its pod template now would restart
+// that rollout from the first step, so the change waits.
+func rolloutInProgress(d *appsv1.Deployment) bool {
+	if !kube.IsRollout(d) {
+		return false
+	}
+	switch kube.RolloutPhase(d) {
+	case kube.RolloutPhaseHealthy, "":
+		return false
+	}
+	return true
+}
@@ -0,0 +1,160 @@
+package controller
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+
+	"lead-net-affinity/pkg/graph"
+	"lead-net-affinity/pkg/kube"
+	"lead-net-affinity/pkg/scoring"
+)
+
+const defaultBatchWindow = 10 * time.Second
+
+// planPendingGroups finds pending pods of graph services, groups co-dependent
+// ones (connected in the graph) and computes a joint node placement per group.
+// The plan is written as node preferences on the group's deployments, which
+// are then applied together in the regular update pass.
+//
+// A group is only planned once its newest pending pod is older than the batch
+// window, so a whole critical path deployed at once is seen as one group.
+func (c *Controller) planPendingGroups(
+	ctx context.Context,
+	g *graph.Graph,
+	deploysBySvc map[graph.NodeID]*appsv1.Deployment,
+	badNodes []string,
+) {
+	window := defaultBatchWindow
+	if c.cfg.Batching.WindowSeconds > 0 {
+		window = time.Duration(c.cfg.Batching.WindowSeconds) * time.Second
+	}
+
+	newest := make(map[graph.NodeID]time.Time)
+	for _, ns := range c.cfg.NamespaceSelector {
+		pods, err := c.k8s.ListPodsByPhase(ctx, ns, corev1.PodPending)
+		if err != nil {
+			c.infof("batching: failed to list pending pods in %s: %v", ns, err)
+			continue
+		}
+		for _, p := range pods {
+			if p.Spec.NodeName != "" {
+				continue
+			}
+			svc := c.identity.ServiceOf(p.Labels)
+			if _, ok := g.Nodes[svc]; !ok {
+				continue
+			}
+			if ts := p.CreationTimestamp.Time; ts.After(newest[svc]) {
+				newest[svc] = ts
+			}
+		}
+	}
+	if len(newest) == 0 {
+		c.debugf("batching: no pending pods for graph services")
+		return
+	}
+
+	nodes, err := c.k8s.ListNodes(ctx)
+	if err != nil {
+		c.infof("batching: failed to list nodes: %v", err)
+		return
+	}
+	var candidates []string
+	for _, n := range nodes {
+		if kube.NodeDraining(&n) || !nodeReady(&n) || contains(badNodes, n.Name) {
+			continue
+		}
+		candidates = append(candidates, n.Name)
+	}
+
+	idx := kube.BuildPlacementIndex(ctx, c.k8s, c.k8s, c.cfg.NamespaceSelector, c.identity)
+	edgeRPS := c.fetchEdgeRPS(ctx)
+	edgeWeight := func(a, b graph.NodeID) float64 {
+		if edgeRPS == nil {
+			return 1
+		}
+		out, _ := edgeRPS.RPS(string(a), string(b))
+		in, _ := edgeRPS.RPS(string(b), string(a))
+		if out+in > 0 {
+			return out + in
+		}
+		return 1
+	}
+	w := c.proximityWeights()
+	if w.SameNodeBonus <= 0 {
+		w.SameNodeBonus = 1
+	}
+
+	for _, group := range pendingGroups(g, newest) {
+		ready := true
+		for _, svc := range group {
+			if time.Since(newest[svc]) < window {
+				ready = false
+				break
+			}
+		}
+		if !ready {
+			c.infof("batching: group %v still inside the %s window; waiting", group, window)
+			continue
+		}
+
+		plan := scoring.PlanJointPlacement(group, g, edgeWeight, candidates, idx, w, c.cfg.Batching.MaxPodsPerNode)
+		for _, svc := range group {
+			node, ok := plan[svc]
+			d, okD := deploysBySvc[svc]
+			if !ok || !okD {
+				continue
+			}
+			setPreferredNode(d, node)
+			c.infof("batching: planned service %s (deployment %s/%s) on node %s", svc, d.Namespace, d.Name, node)
+		}
+	}
+}
+
+// pendingGroups splits the pending services into groups that are connected
+// through graph edges (ignoring services that are not pending).
+func pendingGroups(g *graph.Graph, pending map[graph.NodeID]time.Time) [][]graph.NodeID {
+	seen := make(map[graph.NodeID]bool)
+	var ids []graph.NodeID
+	for id := range pending {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	var groups [][]graph.NodeID
+	for _, start := range ids {
+		if seen[start] {
+			continue
+		}
+		var group []graph.NodeID
+		stack := []graph.NodeID{start}
+		seen[start] = true
+		for len(stack) > 0 {
+			cur := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			group = append(group, cur)
+			for _, n := range g.Neighbors(cur) {
+				if _, ok := pending[n]; ok && !seen[n] {
+					seen[n] = true
+					stack = append(stack, n)
+				}
+			}
+		}
+		sort.Slice(group, func(i, j int) bool { return group[i] < group[j] })
+		groups = append(groups, group)
+	}
+	return groups
+}
+
+func nodeReady(n *corev1.Node) bool {
+	for _, cond := range n.Status.Conditions {
+		if cond.Type == corev1.NodeReady {
+			return cond.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
@@ -0,0 +1,100 @@
+package controller
+
+import (
+	"sort"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+
+	"lead-net-affinity/pkg/graph"
+)
+
+// budgetHolds returns the services whose changes wait for the error budget
+// (slo.reanalyzeBurnRate): those on no path that either has no objective or
+// burns its budget at the configured multiple or more. Nothing is held
+// while the gateway burns its budget that fast. Call it after recordHealth.
+func (c *Controller) budgetHolds(paths []graph.Path) map[graph.NodeID]bool {
+	mult := c.cfg.SLO.ReanalyzeBurnRate
+	if mult <= 0 {
+		return nil
+	}
+	health := c.HealthSummary()
+	if gw := health.Gateway; gw != nil && gw.BurnRate != nil && *gw.BurnRate >= mult {
+		return nil
+	}
+	burning := make(map[string]bool)
+	for _, ph := range health.Paths {
+		burning[ph.Path] = ph.ObjectiveMs <= 0 || (ph.BurnRate != nil && *ph.BurnRate >= mult)
+	}
+	allowed := make(map[graph.NodeID]bool)
+	held := make(map[graph.NodeID]bool)
+	for _, p := range paths {
+		for _, svc := range p.Nodes {
+			if burning[PathID(p)] {
+				allowed[svc] = true
+			} else {
+				held[svc] = true
+			}
+		}
+	}
+	for svc := range allowed {
+		delete(held, svc)
+	}
+	return held
+}
+
+// affinitySnapshot deep-copies the affinity of every deployment, keyed
+// namespace/name, before any rule changes. It is nil unless
+// slo.reanalyzeBurnRate is set.
+func (c *Controller) affinitySnapshot(deploys []appsv1.Deployment) map[string]*corev1.Affinity {
+	if c.cfg.SLO.ReanalyzeBurnRate <= 0 {
+		return nil
+	}
+	out := make(map[string]*corev1.Affinity, len(deploys))
+	for i := range deploys {
+		out[deploys[i].Namespace+"/"+deploys[i].Name] = deploys[i].Spec.Template.Spec.Affinity.DeepCopy()
+	}
+	return out
+}
+
+// holdWithinBudget restores the original affinity of held services (see
+// budgetHolds) whose rules changed, so the change waits for a path to burn
+// its error budget.
+func (c *Controller) holdWithinBudget(
+	paths []graph.Path,
+	deploysBySvc map[graph.NodeID]*appsv1.Deployment,
+	original map[string]*corev1.Affinity,
+	report *reconcileReport,
+) map[graph.NodeID]bool {
+	held := c.budgetHolds(paths)
+	for svc := range held {
+		d, ok := deploysBySvc[svc]
+		if !ok {
+			continue
+		}
+		before := original[d.Namespace+"/"+d.Name]
+		if equality.Semantic.DeepEqual(before, d.Spec.Template.Spec.Affinity) {
+			continue
+		}
+		d.Spec.Template.Spec.Affinity = before
+		c.infof("error budget: holding affinity change for %s/%s; no path through %s burns its budget fast enough", d.Namespace, d.Name, svc)
+		report.held = append(report.held, string(svc))
+	}
+	sort.Strings(report.held)
+	return held
+}
+
+// withoutHeld drops recommendations for held services.
+func withoutHeld(items []ReplicaRecommendation, held map[graph.NodeID]bool) []ReplicaRecommendation {
+	if len(held) == 0 {
+		return items
+	}
+	out := items[:0]
+	for _, r := range items {
+		if !held[graph.NodeID(r.ServiceID)] {
+			out = append(out, r)
+		}
+	}
+	return out
+}
@@ -0,0 +1,100 @@
+package controller
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"lead-net-affinity/pkg/metrics"
+)
+
+// evictOldest deletes the entries of m updated longest ago (at) until at
+// most max remain, and returns the evicted keys. Ties go by key order
+// (less) so eviction is deterministic.
+func evictOldest[K comparable, V any](m map[K]V, max int, at func(V) time.Time, less func(a, b K) bool) []K {
+	if max <= 0 || len(m) <= max {
+		return nil
+	}
+	keys := make([]K, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		ai, aj := at(m[keys[i]]), at(m[keys[j]])
+		if !ai.Equal(aj) {
+			return ai.Before(aj)
+		}
+		return less(keys[i], keys[j])
+	})
+	evicted := keys[:len(m)-max]
+	for _, k := range evicted {
+		delete(m, k)
+	}
+	return evicted
+}
+
+// ForgetNode drops everything cached about a node deleted from the
+// cluster: its metrics in the metrics cache and its smoothing state. addrs
+// are the node's IPs, which node metrics may be keyed by.
+func (c *Controller) ForgetNode(name string, addrs []string) {
+	ids := append([]string{name}, addrs...)
+	forgotten := 0
+
+	s := &c.metricsCache
+	s.mu.Lock()
+	for _, id := range ids {
+		if _, ok := s.nodes[id]; ok {
+			delete(s.nodes, id)
+			s.dirty = true
+			forgotten++
+		}
+	}
+	s.mu.Unlock()
+
+	sm := &c.smoother
+	sm.mu.Lock()
+	for _, id := range ids {
+		for key := range sm.filters {
+			if strings.HasPrefix(key, "node/"+id+"/") {
+				delete(sm.filters, key)
+				delete(sm.misses, key)
+				forgotten++
+			}
+		}
+	}
+	sm.mu.Unlock()
+
+	if forgotten > 0 {
+		c.infof("node %s deleted: forgot %d cached entries", name, forgotten)
+	}
+}
+
+// recordCacheSizes publishes the number of entries per in-memory cache.
+func (c *Controller) recordCacheSizes() {
+	s := &c.metricsCache
+	s.mu.Lock()
+	nodes, edges := len(s.nodes), len(s.latency)+len(s.rps)
+	s.mu.Unlock()
+	sm := &c.smoother
+	sm.mu.Lock()
+	series := len(sm.filters)
+	sm.mu.Unlock()
+	c.history.mu.RLock()
+	paths := len(c.history.paths)
+	c.history.mu.RUnlock()
+	services := len(c.services.load())
+
+	for name, n := range map[string]int{
+		"metrics_cache_nodes": nodes,
+		"metrics_cache_edges": edges,
+		"smoothing_series":    series,
+		"path_history":        paths,
+		"service_history":     services,
+	} {
+		labels := map[string]string{"cache": name}
+		for k, v := range c.metricLabels() {
+			labels[k] = v
+		}
+		metrics.Default.Set("lead_net_cache_entries", "Entries in the controller's in-memory caches.", labels, float64(n))
+	}
+}
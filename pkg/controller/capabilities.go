@@ -0,0 +1,25 @@
+package controller
+
+import (
+	"lead-net-affinity/pkg/rbac"
+)
+
+// SetCapabilities tells the controller which features its service account is
+// allowed to use (see kube.Client.DetectCapabilities). Without it every
+// feature is assumed available.
+//
+//   - no apply-affinity: affinity is computed and logged as in dry-run
+//   - no rebalance: bad nodes are reported but no pods are deleted
+//   - no nodes (namespace-scoped mode): node IPs and zones are learned from
+//     pods, node readiness is unknown and pending-pod batching is skipped
+func (c *Controller) SetCapabilities(caps rbac.Capabilities) {
+	c.caps = caps
+	if missing := caps.Missing(); len(missing) > 0 {
+		c.infof("running with reduced permissions; disabled features: %v", missing)
+	}
+}
+
+// canApply reports whether deployments may be written.
+func (c *Controller) canApply() bool {
+	return !c.dryRun && c.caps.Has(rbac.FeatureApplyAffinity)
+}
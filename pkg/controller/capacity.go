@@ -0,0 +1,166 @@
+package controller
+
+import (
+	"context"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"lead-net-affinity/pkg/graph"
+	"lead-net-affinity/pkg/kube"
+	"lead-net-affinity/pkg/metrics"
+	"lead-net-affinity/pkg/rbac"
+)
+
+// CapacityHint is capacity the controller wants added to a zone so that
+// pods can be co-located with their dependencies. Cluster-autoscaler (or a
+// balancing policy driven by the lead_net_desired_capacity metrics) can act
+// on it.
+type CapacityHint struct {
+	Zone      string `json:"zone"`
+	Pods      int    `json:"pods"`
+	CPUMillis int64  `json:"cpuMillis"`
+
+	// SidecarCPUMillis is the part of CPUMillis requested by sidecars
+	// (controller.sidecarContainers), e.g. mesh proxies.
+	SidecarCPUMillis int64 `json:"sidecarCpuMillis,omitempty"`
+}
+
+// expansionHints finds graph service pods that could not be placed in the
+// zone their dependencies run in because that zone is full:
+//
+//   - pods stuck Pending as Unschedulable, and
+//   - running pods outside that zone when it lacks CPU for them.
+//
+// The result is published as lead_net_desired_capacity{zone} and
+// lead_net_desired_capacity_cpu_cores{zone}. Without node access it is nil.
+func (c *Controller) expansionHints(ctx context.Context, g *graph.Graph) []CapacityHint {
+	if !c.cfg.Controller.ExpansionHints || !c.caps.Has(rbac.FeatureNodes) {
+		return nil
+	}
+	nodes, err := c.k8s.ListNodes(ctx)
+	if err != nil {
+		c.infof("expansion hints: failed to list nodes: %v", err)
+		return nil
+	}
+	pods, err := c.k8s.ListPods(ctx, "", "")
+	if err != nil {
+		c.infof("expansion hints: failed to list pods: %v", err)
+		return nil
+	}
+
+	zoneOf := make(map[string]string)
+	free := make(map[string]int64) // allocatable minus requested CPU per zone
+	for i := range nodes {
+		n := &nodes[i]
+		zone := n.Labels[corev1.LabelTopologyZone]
+		if zone == "" || kube.NodeDraining(n) || !nodeReady(n) {
+			continue
+		}
+		zoneOf[n.Name] = zone
+		free[zone] += n.Status.Allocatable.Cpu().MilliValue()
+	}
+
+	// Where each service runs, by zone.
+	svcZones := make(map[graph.NodeID]map[string]int)
+	for i := range pods {
+		p := &pods[i]
+		zone, ok := zoneOf[p.Spec.NodeName]
+		if !ok || p.Status.Phase == corev1.PodSucceeded || p.Status.Phase == corev1.PodFailed {
+			continue
+		}
+		free[zone] -= c.podRequests(p).CPUMillis
+		if svc := c.identity.ServiceOf(p.Labels); svc != "" {
+			if svcZones[svc] == nil {
+				svcZones[svc] = make(map[string]int)
+			}
+			svcZones[svc][zone]++
+		}
+	}
+
+	want := make(map[string]*CapacityHint)
+	for i := range pods {
+		p := &pods[i]
+		svc := c.identity.ServiceOf(p.Labels)
+		if _, ok := g.Nodes[svc]; !ok {
+			continue
+		}
+		target := preferredZone(g.Neighbors(svc), svcZones)
+		if target == "" {
+			continue
+		}
+		req := c.podRequests(p)
+		switch {
+		case podUnschedulable(p):
+		case zoneOf[p.Spec.NodeName] != "" && zoneOf[p.Spec.NodeName] != target && req.CPUMillis > 0 && free[target] < req.CPUMillis:
+		default:
+			continue
+		}
+		h := want[target]
+		if h == nil {
+			h = &CapacityHint{Zone: target}
+			want[target] = h
+		}
+		h.Pods++
+		h.CPUMillis += req.CPUMillis
+		h.SidecarCPUMillis += req.SidecarCPUMillis
+	}
+
+	hints := make([]CapacityHint, 0, len(want))
+	for _, h := range want {
+		hints = append(hints, *h)
+	}
+	sort.Slice(hints, func(i, j int) bool { return hints[i].Zone < hints[j].Zone })
+
+	metrics.Default.Reset("lead_net_desired_capacity")
+	metrics.Default.Reset("lead_net_desired_capacity_cpu_cores")
+	for _, h := range hints {
+		labels := map[string]string{"zone": h.Zone}
+		for k, v := range c.metricLabels() {
+			labels[k] = v
+		}
+		metrics.Default.Set("lead_net_desired_capacity", "Pods that could not be co-located with their dependencies because the zone is full.", labels, float64(h.Pods))
+		metrics.Default.Set("lead_net_desired_capacity_cpu_cores", "CPU those pods request, per zone.", labels, float64(h.CPUMillis)/1000)
+		c.infof("zone %s is short of capacity for %d co-located pods (%dm CPU, %dm of it sidecars)", h.Zone, h.Pods, h.CPUMillis, h.SidecarCPUMillis)
+	}
+	return hints
+}
+
+// preferredZone is the zone hosting most pods of the given services.
+func preferredZone(services []graph.NodeID, svcZones map[graph.NodeID]map[string]int) string {
+	count := make(map[string]int)
+	for _, s := range services {
+		for z, n := range svcZones[s] {
+			count[z] += n
+		}
+	}
+	best, bestN := "", 0
+	for z, n := range count {
+		if n > bestN || (n == bestN && z < best) {
+			best, bestN = z, n
+		}
+	}
+	return best
+}
+
+// podRequests is the CPU the scheduler accounts for p, with the sidecar
+// share (see kube.EffectiveRequests).
+func (c *Controller) podRequests(p *corev1.Pod) kube.PodRequests {
+	sidecars := c.cfg.Controller.SidecarContainers
+	if sidecars == nil {
+		sidecars = kube.DefaultSidecarContainers
+	}
+	return kube.EffectiveRequests(&p.Spec, sidecars)
+}
+
+func podUnschedulable(p *corev1.Pod) bool {
+	if p.Status.Phase != corev1.PodPending {
+		return false
+	}
+	for _, cond := range p.Status.Conditions {
+		if cond.Type == corev1.PodScheduled && cond.Status == corev1.ConditionFalse && cond.Reason == corev1.PodReasonUnschedulable {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,118 @@
+package controller
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"lead-net-affinity/pkg/metrics"
+)
+
+// Components tracked in the health registry. Optional ones only appear
+// once configured and used.
+const (
+	ComponentKubernetes     = "kubernetes"      // deployment discovery
+	ComponentNetworkMetrics = "network-metrics" // per-node latency, drops and bandwidth
+	ComponentServiceMetrics = "service-metrics" // service pair latency and request rates
+	ComponentTraces         = "traces"          // trace-derived edges
+	ComponentDNSInference   = "dns-inference"   // DNS-inferred edges
+	ComponentUpdates        = "updates"         // deployment updates
+	ComponentOutput         = "output"          // exports to output sinks
+	ComponentReconcile      = "reconcile"       // full and scoped reconciles without errors
+)
+
+// ComponentStatus is the health of one component: whether its last cycle
+// succeeded and when it last did, so one failing for an hour while the
+// controller keeps running shows up in /status and /readyz.
+type ComponentStatus struct {
+	Name         string    `json:"name"`
+	Healthy      bool      `json:"healthy"`
+	LastSuccess  time.Time `json:"lastSuccess,omitempty"`
+	FailingSince time.Time `json:"failingSince,omitempty"` // first failure after the last success
+	LastError    string    `json:"lastError,omitempty"`
+	Failures     int       `json:"consecutiveFailures,omitempty"`
+}
+
+type componentRegistry struct {
+	mu         sync.RWMutex
+	components map[string]*ComponentStatus
+}
+
+// componentOK records a successful cycle of name.
+func (c *Controller) componentOK(name string) {
+	c.setComponent(name, nil)
+}
+
+// componentFailed records a failed cycle of name.
+func (c *Controller) componentFailed(name string, err error) {
+	c.setComponent(name, err)
+}
+
+func (c *Controller) setComponent(name string, err error) {
+	r := &c.components
+	now := time.Now()
+	r.mu.Lock()
+	if r.components == nil {
+		r.components = make(map[string]*ComponentStatus)
+	}
+	s, ok := r.components[name]
+	if !ok {
+		s = &ComponentStatus{Name: name}
+		r.components[name] = s
+	}
+	if err == nil {
+		s.Healthy, s.LastSuccess, s.FailingSince, s.LastError, s.Failures = true, now, time.Time{}, "", 0
+	} else {
+		if s.Failures == 0 {
+			s.FailingSince = now
+		}
+		s.Healthy, s.LastError = false, err.Error()
+		s.Failures++
+	}
+	last := s.LastSuccess
+	r.mu.Unlock()
+
+	labels := map[string]string{"component": name}
+	for k, v := range c.metricLabels() {
+		labels[k] = v
+	}
+	up := 0.0
+	if err == nil {
+		up = 1
+	}
+	metrics.Default.Set("lead_net_component_up", "Whether the component's last cycle succeeded.", labels, up)
+	if !last.IsZero() {
+		metrics.Default.Set("lead_net_component_last_success_timestamp_seconds", "Unix time of the component's last successful cycle.",
+			labels, float64(last.Unix()))
+	}
+}
+
+// Components returns the health of every component that ran, by name.
+func (c *Controller) Components() []ComponentStatus {
+	r := &c.components
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make([]ComponentStatus, 0, len(r.components))
+	for _, s := range r.components {
+		out = append(out, *s)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// failingComponents describes the components failing for longer than
+// maxAge, for /readyz.
+func (c *Controller) failingComponents(maxAge time.Duration) []string {
+	now := time.Now()
+	c.components.mu.RLock()
+	defer c.components.mu.RUnlock()
+	var out []string
+	for name, s := range c.components.components {
+		if d := now.Sub(s.FailingSince); !s.Healthy && d > maxAge {
+			out = append(out, fmt.Sprintf("%s failing for %s: %s", name, d.Round(time.Second), s.LastError))
+		}
+	}
+	sort.Strings(out)
+	return out
+}
@@ -2,21 +2,34 @@ package controller
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"math/rand"
+	"net/netip"
 	"os"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/util/flowcontrol"
 	"lead-net-affinity/pkg/config"
 	"lead-net-affinity/pkg/graph"
 	"lead-net-affinity/pkg/kube"
+	"lead-net-affinity/pkg/metrics"
+	"lead-net-affinity/pkg/output"
+	"lead-net-affinity/pkg/policy"
+	"lead-net-affinity/pkg/probe"
 	promc "lead-net-affinity/pkg/prometheus"
+	"lead-net-affinity/pkg/rbac"
 	"lead-net-affinity/pkg/rulegen"
 	"lead-net-affinity/pkg/scoring"
+	"lead-net-affinity/pkg/supervise"
 )
 
 type LogLevel int
@@ -30,12 +43,16 @@ type KubeClient interface {
 	ListDeployments(ctx context.Context, namespaces []string) ([]appsv1.Deployment, error)
 	UpdateDeployment(ctx context.Context, d *appsv1.Deployment) error
 	ListPods(ctx context.Context, namespace, selector string) ([]corev1.Pod, error)
+	ListPodsByPhase(ctx context.Context, namespace string, phase corev1.PodPhase) ([]corev1.Pod, error)
 	GetNode(ctx context.Context, name string) (*corev1.Node, error)
+	ListNodes(ctx context.Context) ([]corev1.Node, error)
 	DeletePod(ctx context.Context, namespace, name string) error // NEW: Added for rebalancing
 }
 
 type PromClient interface {
 	FetchNetworkMatrix(ctx context.Context, latencyQuery, dropQuery, bwQuery string) (*promc.NetworkMatrix, error)
+	FetchServiceLatencies(ctx context.Context, query, srcLabel, dstLabel, unit string) (*promc.ServiceLatencyMatrix, error)
+	FetchServicePairRPS(ctx context.Context, query, srcLabel, dstLabel string) (*promc.ServiceRPSMatrix, error)
 }
 
 type Controller struct {
@@ -45,57 +62,163 @@ type Controller struct {
 	logLevel  LogLevel
 	dryRun    bool
 	dryDelete bool // NEW: Control pod deletion separately
+
+	// Proximity scores per service, valid while the topology fingerprint
+	// (placement index + bad nodes) stays the same.
+	scoreCache    map[graph.NodeID]cachedScores
+	scoreCacheKey string
+
+	interval     time.Duration
+	startupDelay time.Duration
+	jitter       float64
+	reconciling  atomic.Bool
+
+	triggers chan string // event-driven reconcile requests, see Trigger
+	debounce time.Duration
+
+	status    statusTracker
+	publisher StatusPublisher
+
+	deleteLimiter flowcontrol.RateLimiter // paces pod deletions during rebalancing
+	maxDeletions  int                     // per rebalance pass, 0 = unlimited
+
+	caps rbac.Capabilities // nil = all features allowed, see SetCapabilities
+
+	identity *kube.ServiceIdentity // pod/deployment -> graph service
+
+	name   string // kubeconfig context this controller manages, see SetName
+	tenant string // tenant this controller serves, see SetTenant
+
+	sinks      []output.Sink    // generated affinity exports, see SetOutputSinks
+	lastExport time.Time        // of the sinks, for output.intervalSeconds
+	rollout    rolloutState     // batch a staggered rollout waits on, see applyUpdates
+	hooks      []DecisionHook   // custom decision policies, see SetDecisionHooks
+	policy     policy.Evaluator // checks affinity changes and evictions, see SetPolicy
+	reports    reportTracker    // periodic placement and health reports, see SetReportSinks
+	recs       recommendationStore
+
+	history pathHistory // per-path score samples, see PathHistory
+	pareto  paretoStore // multi-objective ranking, see ParetoFront
+	drift   driftTracker
+	traces  traceCache // optional trace-derived edges, see SetTraceSource
+	dns     dnsCache   // optional DNS-inferred edges, see SetDNSLogSource
+	quality qualityStore
+
+	approvals  approvalQueue   // mutating actions awaiting approval, see Approvals
+	nodeScores nodeScoresStore // per-service node scores, see SetNodeScoresSink
+
+	metricsCache metricsCacheStore // last metrics across restarts, see SetMetricsCache
+
+	decisions  decisionStore      // last full reconcile's ranking and affinity, see Decisions
+	smoother   metricSmoother     // per-series smoothing state, see smoothing.*
+	health     healthStore        // per-service and per-path health, see HealthSummary
+	services   serviceHistory     // per-service metric samples, see ServiceHistory
+	forecast   forecastStore      // hourly inbound rates and their forecasts, see Forecast
+	zonePlans  zonePlanStore      // replicas per zone by traffic origin, see ZonePlans
+	injected   injectionStore     // synthetic metrics from /inject, see Injections
+	replay     replayStore        // inputs of the last full reconcile, see Snapshot
+	lifecycle  lifecycle          // state of Run, see State
+	components componentRegistry  // per-component health, see Components
+	rootCause  rootCauseStore     // culprits of paths over their objective, see RootCause
+	preview    previewStore       // generated affinity per service, see AffinityPreview
+	selectors  selectorCheckStore // generated selectors matching no pod, see SelectorCheck
+
+	effectiveness effectivenessStore // cross-node share of critical-path traffic, see Effectiveness
+	verification  verificationStore  // placement checks of generated terms, see Verification
+	gateway       gatewayStore       // entry-point latency samples, see HealthSummary
+	ports         servicePortStore   // ports discovered from Kubernetes Services
+	prober        *probe.Prober      // active health checks, nil unless healthChecks.enabled
+}
+
+type cachedScores struct {
+	neighbors string // edge weights the scores were computed with
+	scores    map[string]float64
 }
 
-// nodeIPResolver implements scoring.NodeIPResolver by using the KubeClient to
-// look up a node's InternalIP/ExternalIP and caching the result.
+// nodeIPResolver implements scoring.MultiIPResolver by using the KubeClient
+// to look up a node's InternalIPs/ExternalIPs and caching the result.
 type nodeIPResolver struct {
-	k8s   KubeClient
-	cache map[string]string
+	k8s    KubeClient
+	cache  map[string][]string
+	family string // prometheus.nodeIPFamily, tried first
+
+	podsOnly bool // cache was pre-filled from pod host IPs; never call GetNode
 }
 
-// IPForNode returns the IP address for a given Kubernetes node name.
-// It prefers InternalIP, then ExternalIP. If no address can be found, it
-// returns the empty string and logs at info level.
+// IPForNode returns the preferred IP address for a given Kubernetes node
+// name (see IPsForNode), or the empty string if none can be found.
 func (r *nodeIPResolver) IPForNode(nodeName string) string {
+	for _, ip := range r.IPsForNode(nodeName) {
+		if _, err := netip.ParseAddr(ip); err == nil {
+			return ip
+		}
+	}
+	return ""
+}
+
+// IPsForNode returns every InternalIP, then every ExternalIP, of a node,
+// normalized, with the preferred family first within each type, followed
+// by its host names (Hostname, InternalDNS, ExternalDNS), which some
+// exporters use as instance. Dual-stack nodes report an IP of each family.
+// If no address can be found, it returns nil and logs at info level.
+func (r *nodeIPResolver) IPsForNode(nodeName string) []string {
 	if nodeName == "" {
-		return ""
+		return nil
 	}
-	if ip, ok := r.cache[nodeName]; ok {
-		return ip
+	if ips, ok := r.cache[nodeName]; ok || r.podsOnly {
+		return ips
 	}
 
 	node, err := r.k8s.GetNode(context.Background(), nodeName)
 	if err != nil {
 		log.Printf("[lead-net][ip-resolver] GetNode(%q) failed: %v", nodeName, err)
-		r.cache[nodeName] = ""
-		return ""
+		r.cache[nodeName] = nil
+		return nil
 	}
 
-	var internalIP, externalIP string
+	var internal, external, names []string
 	for _, addr := range node.Status.Addresses {
-		if addr.Type == corev1.NodeInternalIP && internalIP == "" {
-			internalIP = addr.Address
-		}
-		if addr.Type == corev1.NodeExternalIP && externalIP == "" {
-			externalIP = addr.Address
+		a := promc.NormalizeAddress(addr.Address)
+		switch addr.Type {
+		case corev1.NodeInternalIP:
+			internal = append(internal, a)
+		case corev1.NodeExternalIP:
+			external = append(external, a)
+		case corev1.NodeHostName, corev1.NodeInternalDNS, corev1.NodeExternalDNS:
+			if a != nodeName && !slices.Contains(names, a) {
+				names = append(names, a)
+			}
 		}
 	}
+	ips := append(preferIPFamily(internal, r.family), preferIPFamily(external, r.family)...)
 
-	ip := internalIP
-	if ip == "" {
-		ip = externalIP
-	}
-
-	if ip == "" {
+	if len(ips) == 0 {
 		log.Printf("[lead-net][ip-resolver] node %q has no InternalIP/ExternalIP addresses", nodeName)
-		r.cache[nodeName] = ""
-		return ""
 	}
+	ips = append(ips, names...)
+	if len(ips) == 0 {
+		r.cache[nodeName] = nil
+		return nil
+	}
+
+	r.cache[nodeName] = ips
+	log.Printf("[lead-net][ip-resolver] mapped node %q -> %v", nodeName, ips)
+	return ips
+}
+
+// preferIPFamily stably orders ips with those of family ("ipv4" if empty)
+// first.
+func preferIPFamily(ips []string, family string) []string {
+	want6 := family == "ipv6"
+	sort.SliceStable(ips, func(i, j int) bool {
+		return isIPv6(ips[i]) == want6 && isIPv6(ips[j]) != want6
+	})
+	return ips
+}
 
-	r.cache[nodeName] = ip
-	log.Printf("[lead-net][ip-resolver] mapped node %q -> ip %q", nodeName, ip)
-	return ip
+func isIPv6(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	return err == nil && addr.Is6() && !addr.Is4In6()
 }
 
 func New(cfg *config.Config, k8s KubeClient, prom PromClient) *Controller {
@@ -117,39 +240,245 @@ func New(cfg *config.Config, k8s KubeClient, prom PromClient) *Controller {
 		dryDelete = false
 	}
 
+	interval, startupDelay, jitter := loopTiming(cfg.Controller)
+
 	c := &Controller{
-		cfg:       cfg,
-		k8s:       k8s,
-		prom:      prom,
-		logLevel:  level,
-		dryRun:    dry,
-		dryDelete: dryDelete, // NEW
+		cfg:          cfg,
+		k8s:          k8s,
+		prom:         prom,
+		logLevel:     level,
+		dryRun:       dry,
+		dryDelete:    dryDelete, // NEW
+		interval:     interval,
+		startupDelay: startupDelay,
+		jitter:       jitter,
+		triggers:     make(chan string, 1),
+		debounce:     defaultDebounce,
+	}
+	if cfg.Controller.DebounceSeconds > 0 {
+		c.debounce = time.Duration(cfg.Controller.DebounceSeconds) * time.Second
+	}
+	c.identity = serviceIdentity(cfg)
+	c.deleteLimiter, c.maxDeletions = deletionLimits(cfg.Rebalancing)
+	c.history.size = cfg.Controller.HistorySize
+	c.services.size = cfg.Controller.HistorySize
+	c.effectiveness.size = cfg.Controller.HistorySize
+	c.gateway.size = cfg.Controller.HistorySize
+	if cfg.HealthChecks.Enabled {
+		c.prober = probe.NewProber(time.Duration(cfg.HealthChecks.TimeoutMs) * time.Millisecond)
+	}
+	if dc := cfg.Server.Debug; dc.Enabled && dc.Record {
+		c.replay.rec = &recorder{}
+		c.k8s = recordingKube{KubeClient: k8s, rec: c.replay.rec}
+		c.prom = recordingProm{PromClient: prom, rec: c.replay.rec}
 	}
 
 	c.infof("starting lead-net-affinity controller")
 	c.infof("log level: %s", c.logLevelString())
 	c.infof("dry-run: %v", c.dryRun)
 	c.infof("dry-delete: %v", c.dryDelete) // NEW
+	c.infof("reconcile interval: %s (startup delay %s, jitter ±%.0f%%)", c.interval, c.startupDelay, c.jitter*100)
 	c.infof("namespaces: %v", cfg.NamespaceSelector)
 	c.infof("graph entry: %s, services: %d", cfg.Graph.Entry, len(cfg.Graph.Services))
 	return c
 }
 
-func (c *Controller) Run(ctx context.Context) error {
-	ticker := time.NewTicker(30 * time.Second)
-	defer ticker.Stop()
+// Run reconciles on the configured interval and on triggers until ctx is
+// done or Stop is called, then waits for the in-flight reconcile. A
+// reconcile that panics stops Run, which returns the *supervise.PanicError
+// so the supervising loop can restart it. A second Run before the first
+// returns fails with ErrAlreadyRunning.
+func (c *Controller) Run(ctx context.Context) (err error) {
+	ctx, ok := c.lifecycle.begin(ctx)
+	if !ok {
+		return ErrAlreadyRunning
+	}
+	g, ctx := newGroup(ctx)
+	defer c.lifecycle.end(func() {
+		if gerr := g.wait(); gerr != nil {
+			err = gerr
+		}
+	})
 
-	for {
-		if err := c.reconcileOnce(ctx); err != nil {
-			c.infof("reconcile error: %v", err)
+	if c.startupDelay > 0 {
+		c.infof("waiting %s before first reconcile", c.startupDelay)
+		select {
+		case <-ctx.Done():
+			c.infof("shutting down controller: %v", context.Cause(ctx))
+			return ctx.Err()
+		case <-time.After(c.startupDelay):
 		}
+	}
+	c.lifecycle.running()
+
+	var debounceC <-chan time.Time
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
 		select {
 		case <-ctx.Done():
-			c.infof("shutting down controller: %v", ctx.Err())
+			c.infof("shutting down controller: %v", context.Cause(ctx))
 			return ctx.Err()
-		case <-ticker.C:
+
+		case <-timer.C:
+			c.startReconcile(ctx, g, "timer")
+			timer.Reset(c.nextInterval())
+
+		case reason := <-c.triggers:
+			// Coalesce bursts of events into one reconcile.
+			c.infof("reconcile requested: %s", reason)
+			if debounceC == nil {
+				debounceC = time.After(c.debounce)
+			}
+
+		case <-debounceC:
+			debounceC = nil
+			if !c.startReconcile(ctx, g, "event") {
+				// Don't lose the event: retry once the current reconcile is done.
+				debounceC = time.After(c.debounce)
+			}
+		}
+	}
+}
+
+// startReconcile runs one reconcile in the background unless the previous
+// one is still running, so slow clusters don't pile up overlapping reconciles.
+func (c *Controller) startReconcile(ctx context.Context, g *group, source string) bool {
+	if !c.reconciling.CompareAndSwap(false, true) {
+		c.infof("previous reconcile still running; skipping %s trigger", source)
+		return false
+	}
+	g.goFunc(func() error {
+		defer c.reconciling.Store(false)
+		err := supervise.Recover("reconcile", c.metricLabels(), func() error { return c.reconcileOnce(ctx) })
+		var pe *supervise.PanicError
+		if errors.As(err, &pe) {
+			// Fails the group: Run stops and returns the panic.
+			return err
+		}
+		if err != nil {
+			// Retried on the next trigger.
+			c.infof("reconcile error: %v", err)
+		}
+		return nil
+	})
+	return true
+}
+
+var errReconcileInProgress = errors.New("reconcile already in progress")
+
+// Trigger requests a (debounced) reconcile. It never blocks: if a request
+// is already queued, this one is folded into it.
+func (c *Controller) Trigger(reason string) {
+	select {
+	case c.triggers <- reason:
+	default:
+		c.debugf("reconcile already requested; folding trigger: %s", reason)
+	}
+}
+
+// IsGraphService reports whether a service name is part of the configured graph.
+func (c *Controller) IsGraphService(name string) bool {
+	for _, s := range c.cfg.Graph.Services {
+		if s.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// GraphDocument exports the service graph reconciles work on: the declared
+// services plus any edges inferred from DNS lookups.
+func (c *Controller) GraphDocument(ctx context.Context) *graph.Document {
+	g := buildGraph(c.cfg.Graph)
+	c.addInferredEdges(ctx, g)
+	c.fillServicePorts(g)
+	return g.Document()
+}
+
+// ServiceIdentity returns how pods and deployments map to graph services:
+// serviceLabelKeys, overridden per service by graph.services[].labelSelector.
+func (c *Controller) ServiceIdentity() *kube.ServiceIdentity {
+	return c.identity
+}
+
+func serviceIdentity(cfg *config.Config) *kube.ServiceIdentity {
+	selectors := make(map[string]map[string]string)
+	for _, s := range cfg.Graph.Services {
+		selectors[s.Name] = s.LabelSelector
+	}
+	return kube.NewServiceIdentity(cfg.ServiceLabelKeys, selectors)
+}
+
+// nextInterval returns the reconcile interval with random jitter applied.
+func (c *Controller) nextInterval() time.Duration {
+	if c.jitter <= 0 {
+		return c.interval
+	}
+	delta := (rand.Float64()*2 - 1) * c.jitter * float64(c.interval)
+	d := c.interval + time.Duration(delta)
+	if d < minReconcileInterval {
+		d = minReconcileInterval
+	}
+	return d
+}
+
+const (
+	defaultDebounce          = 5 * time.Second
+	defaultReconcileInterval = 30 * time.Second
+	minReconcileInterval     = 5 * time.Second
+	maxReconcileJitter       = 0.5
+
+	defaultDeletionsPerSecond = 10
+)
+
+// loopTiming resolves interval, startup delay and jitter from config and env
+// (env wins), applying defaults and the minimum-interval guard.
+func loopTiming(cc config.ControllerConfig) (time.Duration, time.Duration, float64) {
+	interval := time.Duration(cc.IntervalSeconds) * time.Second
+	startupDelay := time.Duration(cc.StartupDelaySeconds) * time.Second
+	jitter := cc.Jitter
+
+	if v := os.Getenv("LEAD_NET_INTERVAL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			interval = d
+		} else {
+			log.Printf("[lead-net] ignoring invalid LEAD_NET_INTERVAL=%q: %v", v, err)
 		}
 	}
+	if v := os.Getenv("LEAD_NET_STARTUP_DELAY"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			startupDelay = d
+		} else {
+			log.Printf("[lead-net] ignoring invalid LEAD_NET_STARTUP_DELAY=%q: %v", v, err)
+		}
+	}
+	if v := os.Getenv("LEAD_NET_JITTER"); v != "" {
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			jitter = f
+		} else {
+			log.Printf("[lead-net] ignoring invalid LEAD_NET_JITTER=%q: %v", v, err)
+		}
+	}
+
+	if interval <= 0 {
+		interval = defaultReconcileInterval
+	}
+	if interval < minReconcileInterval {
+		log.Printf("[lead-net] reconcile interval %s below minimum; using %s", interval, minReconcileInterval)
+		interval = minReconcileInterval
+	}
+	if startupDelay < 0 {
+		startupDelay = 0
+	}
+	if jitter < 0 {
+		jitter = 0
+	}
+	if jitter > maxReconcileJitter {
+		jitter = maxReconcileJitter
+	}
+	return interval, startupDelay, jitter
 }
 
 // NEW: method for one-time execution
@@ -169,6 +498,19 @@ func (c *Controller) RunOnce(ctx context.Context) error {
 	return nil
 }
 
+// buildGraph builds the service graph of gc, with each service's version,
+// owner, metadata and declared ports.
+func buildGraph(gc config.ServiceGraphConfig) *graph.Graph {
+	g := graph.NewGraph(gc.Entry, toServiceDefs(gc.Services))
+	for _, s := range gc.Services {
+		if n := g.Nodes[graph.NodeID(s.Name)]; n != nil {
+			n.Version, n.Owner, n.Metadata, n.Ports = s.Version, s.Owner, s.Metadata, s.Ports
+			n.External = s.External != nil
+		}
+	}
+	return g
+}
+
 func toServiceDefs(nodes []config.ServiceNode) []struct {
 	Name          string
 	DependsOn     []string
@@ -242,6 +584,22 @@ func (c *Controller) resolveNodeName(nodeID string) string {
 	// For IP addresses, we need to map them to node names
 	// This is a simplified implementation - in production you'd want to cache this
 	ctx := context.Background()
+	if !c.caps.Has(rbac.FeatureNodes) {
+		if name := c.nodeNameForIP(ctx, nodeID); name != "" {
+			return name
+		}
+		c.debugf("no visible pod runs on %s, using as-is", nodeID)
+		return nodeID
+	}
+	// Match the node's name and addresses (instance may be an IP or a host
+	// name, with or without the domain).
+	if list, err := c.k8s.ListNodes(ctx); err == nil {
+		for i := range list {
+			if nodeKnownAs(&list[i], nodeID) {
+				return list[i].Name
+			}
+		}
+	}
 	nodes, err := c.k8s.ListPods(ctx, "", "") // Empty namespace and selector to get all pods
 	if err != nil {
 		c.debugf("failed to list pods for node resolution: %v", err)
@@ -255,7 +613,8 @@ func (c *Controller) resolveNodeName(nodeID string) string {
 			node, err := c.k8s.GetNode(ctx, pod.Spec.NodeName)
 			if err == nil {
 				for _, addr := range node.Status.Addresses {
-					if (addr.Type == corev1.NodeInternalIP || addr.Type == corev1.NodeExternalIP) && addr.Address == nodeID {
+					if (addr.Type == corev1.NodeInternalIP || addr.Type == corev1.NodeExternalIP) &&
+						promc.NormalizeAddress(addr.Address) == promc.NormalizeAddress(nodeID) {
 						return pod.Spec.NodeName
 					}
 				}
@@ -267,6 +626,20 @@ func (c *Controller) resolveNodeName(nodeID string) string {
 	return nodeID
 }
 
+// nodeKnownAs reports whether id (a matrix key) names n, by name or by any
+// of its addresses.
+func nodeKnownAs(n *corev1.Node, id string) bool {
+	if promc.SameNode(n.Name, id) {
+		return true
+	}
+	for _, addr := range n.Status.Addresses {
+		if promc.SameNode(addr.Address, id) {
+			return true
+		}
+	}
+	return false
+}
+
 // NEW: RebalancePods detects stuck pods on bad nodes and triggers rescheduling
 func (c *Controller) RebalancePods(ctx context.Context, deployments []appsv1.Deployment, badNodes []string) error {
 	if len(badNodes) == 0 {
@@ -276,12 +649,34 @@ func (c *Controller) RebalancePods(ctx context.Context, deployments []appsv1.Dep
 
 	c.infof("checking for rebalancing opportunities, bad nodes: %v", badNodes)
 
+	// Where do dependency pods run right now? Used to steer evicted pods
+	// toward nodes close to the services they talk to.
+	var nodes kube.NodeGetter
+	if c.caps.Has(rbac.FeatureNodes) {
+		nodes = c.k8s
+	}
+	idx := kube.BuildPlacementIndex(ctx, c.k8s, nodes, c.cfg.NamespaceSelector, c.identity)
+	g := buildGraph(c.cfg.Graph)
+	edgeRPS := c.fetchEdgeRPS(ctx)
+	excluded := append(append([]string{}, badNodes...), c.drainingNodes(ctx)...)
+	if err := c.checkSchedulable(ctx, excluded); err != nil {
+		return err
+	}
+
 	podsOnBadNodes := 0
 	podsToRebalance := []corev1.Pod{}
+	var plan *surgePlan
+	if c.cfg.Rebalancing.SurgeBeforeEvict && c.canApply() {
+		plan = &surgePlan{
+			owners:     make(map[string]string),
+			badNodes:   badNodes,
+			settling:   c.settlingDeployments(ctx),
+			autoscaled: c.autoscaledDeployments(ctx),
+		}
+	}
 
 	for _, d := range deployments {
-		selector := fmt.Sprintf("io.kompose.service=%s", d.Labels["io.kompose.service"])
-		pods, err := c.k8s.ListPods(ctx, d.Namespace, selector)
+		pods, err := c.identity.ListServicePods(ctx, c.k8s, d.Namespace, c.identity.DeploymentService(&d))
 		if err != nil {
 			c.infof("failed to list pods for %s: %v", d.Name, err)
 			continue
@@ -291,16 +686,23 @@ func (c *Controller) RebalancePods(ctx context.Context, deployments []appsv1.Dep
 			if contains(badNodes, pod.Spec.NodeName) {
 				podsOnBadNodes++
 				podsToRebalance = append(podsToRebalance, pod)
+				if plan != nil && !kube.IsRollout(&d) { // Rollouts are not surged
+					plan.owners[pod.Namespace+"/"+pod.Name] = d.Name
+				}
 
 				c.infof("pod %s/%s is on bad node %s", pod.Namespace, pod.Name, pod.Spec.NodeName)
 
 				// Add node anti-affinity to prevent rescheduling on bad nodes
 				deployCopy := d // Create a copy to avoid modifying the original
-				c.addNodeAntiAffinity(&deployCopy, badNodes)
+				before := affinityFingerprint(&d)
+				if !c.taintMode() { // tainted bad nodes need no per-deployment rule
+					c.addNodeAntiAffinity(&deployCopy, badNodes)
+				}
+				c.addDependencyNodePreference(&deployCopy, g, idx, edgeRPS, excluded)
 
 				// Update the deployment with anti-affinity
-				if !c.dryRun {
-					if err := c.k8s.UpdateDeployment(ctx, &deployCopy); err != nil {
+				if c.canApply() && c.approvedPatch(&deployCopy, before, "avoid bad nodes "+strings.Join(badNodes, ",")) {
+					if err := c.updateWorkload(ctx, &deployCopy); err != nil {
 						c.infof("failed to update deployment %s with anti-affinity: %v", d.Name, err)
 					} else {
 						c.infof("successfully added anti-affinity to deployment %s", d.Name)
@@ -313,7 +715,7 @@ func (c *Controller) RebalancePods(ctx context.Context, deployments []appsv1.Dep
 	c.infof("found %d pods on bad nodes that need rebalancing", podsOnBadNodes)
 	if len(podsToRebalance) > 0 {
 		c.infof("triggering rescheduling for %d pods", len(podsToRebalance))
-		if err := c.triggerPodRescheduling(ctx, podsToRebalance); err != nil {
+		if err := c.triggerPodRescheduling(ctx, podsToRebalance, plan); err != nil {
 			return err
 		}
 	}
@@ -363,8 +765,159 @@ func (c *Controller) addNodeAntiAffinity(d *appsv1.Deployment, badNodes []string
 		d.Namespace, d.Name, badNodes)
 }
 
-// NEW: TriggerPodRescheduling actually deletes pods to force rescheduling
-func (c *Controller) triggerPodRescheduling(ctx context.Context, pods []corev1.Pod) error {
+// dependencyNodePreferenceWeight is the node-affinity weight used to pull a
+// rescheduled pod toward the node hosting most of its dependencies.
+const dependencyNodePreferenceWeight = 50
+
+// fetchEdgeRPS returns per-edge request rates from the servicePair* query,
+// then prometheus.edgeFamilies, then traces; nil if none is configured or
+// available.
+func (c *Controller) fetchEdgeRPS(ctx context.Context) *promc.ServiceRPSMatrix {
+	var traced *promc.ServiceRPSMatrix
+	if edges := c.traceEdges(ctx); edges != nil {
+		traced = edges.RPS()
+	}
+	families := c.familyRPS(ctx)
+	if c.cfg.Prometheus.ServicePairRPSQuery == "" {
+		return mergeRPS(families, traced)
+	}
+	rps, err := c.prom.FetchServicePairRPS(
+		ctx,
+		c.cfg.Prometheus.ServicePairRPSQuery,
+		c.cfg.Prometheus.ServicePairSrcLabel,
+		c.cfg.Prometheus.ServicePairDstLabel,
+	)
+	if err != nil {
+		c.infof("warning: failed to fetch service pair RPS; using unweighted edges: %v", err)
+		c.componentFailed(ComponentServiceMetrics, err)
+		rps = nil
+	} else {
+		c.componentOK(ComponentServiceMetrics)
+	}
+	return mergeRPS(mergeRPS(c.withCachedRPS(ctx, rps), families), traced)
+}
+
+// addDependencyNodePreference scores the nodes not in excluded (bad,
+// cordoned or draining) by proximity to the service's dependency pods and
+// prefers the best one for rescheduling.
+func (c *Controller) addDependencyNodePreference(
+	d *appsv1.Deployment,
+	g *graph.Graph,
+	idx *kube.PlacementIndex,
+	edgeRPS *promc.ServiceRPSMatrix,
+	excluded []string,
+) {
+	svc := c.identity.DeploymentService(d)
+	if svc == "" || g == nil || idx == nil {
+		return
+	}
+
+	neighbors := neighborWeights(g, svc, edgeRPS)
+
+	key := idx.Fingerprint() + "|" + strings.Join(excluded, ",")
+	if key != c.scoreCacheKey {
+		c.scoreCache = make(map[graph.NodeID]cachedScores)
+		c.scoreCacheKey = key
+	}
+
+	neighborsKey := fmt.Sprint(neighbors)
+	entry, cached := c.scoreCache[svc]
+	scores := entry.scores
+	if cached && entry.neighbors == neighborsKey {
+		c.debugf("using cached proximity scores for service %s", svc)
+	} else {
+		var candidates []string
+		for _, n := range idx.Nodes() {
+			if !contains(excluded, n) {
+				candidates = append(candidates, n)
+			}
+		}
+		scores = scoring.NodeProximityScores(svc, neighbors, candidates, idx, c.proximityWeights())
+		c.scoreCache[svc] = cachedScores{neighbors: neighborsKey, scores: scores}
+	}
+	best := scoring.BestNode(scores)
+	if best == "" {
+		c.debugf("no proximity preference for service %s (scores=%v)", svc, scores)
+		return
+	}
+
+	setPreferredNode(d, best)
+	c.infof("preferring node %s for deployment %s/%s (proximity score %.2f)",
+		best, d.Namespace, d.Name, scores[best])
+}
+
+// setPreferredNode replaces any previous single-node preference on the
+// deployment with a preference for node.
+func setPreferredNode(d *appsv1.Deployment, node string) {
+	if d.Spec.Template.Spec.Affinity == nil {
+		d.Spec.Template.Spec.Affinity = &corev1.Affinity{}
+	}
+	if d.Spec.Template.Spec.Affinity.NodeAffinity == nil {
+		d.Spec.Template.Spec.Affinity.NodeAffinity = &corev1.NodeAffinity{}
+	}
+	na := d.Spec.Template.Spec.Affinity.NodeAffinity
+
+	// Replace any previous node preference instead of accumulating them.
+	kept := na.PreferredDuringSchedulingIgnoredDuringExecution[:0]
+	for _, term := range na.PreferredDuringSchedulingIgnoredDuringExecution {
+		isPreference := false
+		for _, expr := range term.Preference.MatchExpressions {
+			if expr.Key == "kubernetes.io/hostname" && expr.Operator == corev1.NodeSelectorOpIn {
+				isPreference = true
+			}
+		}
+		if !isPreference {
+			kept = append(kept, term)
+		}
+	}
+	na.PreferredDuringSchedulingIgnoredDuringExecution = append(kept, corev1.PreferredSchedulingTerm{
+		Weight: dependencyNodePreferenceWeight,
+		Preference: corev1.NodeSelectorTerm{
+			MatchExpressions: []corev1.NodeSelectorRequirement{{
+				Key:      "kubernetes.io/hostname",
+				Operator: corev1.NodeSelectorOpIn,
+				Values:   []string{node},
+			}},
+		},
+	})
+}
+
+// weightBudget is the rulegen.WeightBudget from the config.
+func (c *Controller) weightBudget() rulegen.WeightBudget {
+	b := c.cfg.Affinity.WeightBudget
+	return rulegen.WeightBudget{MaxTotalWeight: b.MaxTotalWeight, MaxTerms: b.MaxTerms, Priority: b.Priority}
+}
+
+// proximityWeights are the scoring.ProximityWeights from the config.
+func (c *Controller) proximityWeights() scoring.ProximityWeights {
+	return scoring.ProximityWeights{
+		SameNodeBonus:      c.cfg.Scoring.SameNodeBonus,
+		SameZoneBonus:      c.cfg.Scoring.SameZoneBonus,
+		ReplicaAggregation: c.cfg.Scoring.ReplicaAggregation,
+	}
+}
+
+// neighborWeights weights each dependency of svc (either direction) by the
+// request rate between them, 1 when unmeasured.
+func neighborWeights(g *graph.Graph, svc graph.NodeID, edgeRPS *promc.ServiceRPSMatrix) map[graph.NodeID]float64 {
+	neighbors := make(map[graph.NodeID]float64)
+	for _, n := range g.Neighbors(svc) {
+		w := 1.0
+		if edgeRPS != nil {
+			out, _ := edgeRPS.RPS(string(svc), string(n))
+			in, _ := edgeRPS.RPS(string(n), string(svc))
+			if out+in > 0 {
+				w = out + in
+			}
+		}
+		neighbors[n] = w
+	}
+	return neighbors
+}
+
+// NEW: TriggerPodRescheduling actually deletes pods to force rescheduling.
+// With a surge plan each pod is only deleted once a replacement is Ready.
+func (c *Controller) triggerPodRescheduling(ctx context.Context, pods []corev1.Pod, plan *surgePlan) error {
 	if len(pods) == 0 {
 		return nil
 	}
@@ -372,38 +925,112 @@ func (c *Controller) triggerPodRescheduling(ctx context.Context, pods []corev1.P
 	c.infof("triggering rescheduling for %d pods", len(pods))
 
 	deletedCount := 0
-	for _, pod := range pods {
+	for _, pod := range orderForEviction(pods, c.identity) {
+		if c.maxDeletions > 0 && deletedCount >= c.maxDeletions {
+			c.infof("reached %d deletions this pass; deferring remaining pods to the next reconcile", c.maxDeletions)
+			break
+		}
+
 		podInfo := fmt.Sprintf("%s/%s on node %s", pod.Namespace, pod.Name, pod.Spec.NodeName)
 
-		if c.dryRun || c.dryDelete {
+		if !kube.SafeToEvict(&pod) {
+			c.infof("skipping pod %s - annotated %s=false", podInfo, kube.SafeToEvictAnnotation)
+			continue
+		}
+
+		if c.dryRun || c.dryDelete || !c.caps.Has(rbac.FeatureRebalance) {
 			c.infof("DRY-RUN: would delete pod %s to trigger rescheduling", podInfo)
 			continue
 		}
 
 		// Check pod age - don't delete very young pods
 		podAge := time.Since(pod.CreationTimestamp.Time)
-		minPodAge := 30 * time.Second // Minimum 30 seconds old
-		if podAge < minPodAge {
+		if podAge < c.cfg.Rebalancing.MinPodAge() {
 			c.infof("skipping pod %s - too young (age: %v)", podInfo, podAge)
 			continue
 		}
 
+		reason := "reschedule off bad node " + pod.Spec.NodeName
+		if !c.policyAllowsEviction(ctx, &pod, reason) {
+			continue
+		}
+		if !c.approved(ActionEvict, pod.Namespace, pod.Name, string(pod.UID)+"@"+pod.Spec.NodeName, 1, reason) {
+			continue
+		}
+
+		// Pace deletions so a mass rebalance does not overwhelm the API server.
+		if err := c.deleteLimiter.Wait(ctx); err != nil {
+			return err
+		}
+
+		// Make-before-break: bring up the replacement first.
+		surged := false
+		switch {
+		case plan == nil:
+		case plan.skipSurge(pod):
+			c.infof("not surging for pod %s: its deployment is scaled by a HorizontalPodAutoscaler", podInfo)
+		default:
+			if err := c.surgeReplica(ctx, pod, plan); err != nil {
+				c.infof("keeping pod %s: %v", podInfo, err)
+				continue
+			}
+			surged = true
+		}
+
 		c.infof("deleting pod %s to trigger rescheduling (age: %v)", podInfo, podAge)
 		if err := c.k8s.DeletePod(ctx, pod.Namespace, pod.Name); err != nil {
 			c.infof("failed to delete pod %s: %v", podInfo, err)
 		} else {
 			deletedCount++
 			c.infof("successfully deleted pod %s", podInfo)
+			metrics.Default.Add("lead_net_pods_rescheduled_total", "Pods deleted to be rescheduled off bad nodes.", c.metricLabels(), 1)
+		}
+		if surged {
+			c.scaleBack(ctx, pod.Namespace, plan.owner(pod))
 		}
-
-		// Small delay to avoid overwhelming the API server
-		time.Sleep(100 * time.Millisecond)
 	}
 
 	c.infof("triggered rescheduling for %d pods (%d actually deleted)", len(pods), deletedCount)
 	return nil
 }
 
+// orderForEviction sorts each service's pods by deletion cost, cheapest
+// first, keeping the services in their original order. When the per-pass
+// deletion cap is hit the expensive pods are the ones deferred.
+func orderForEviction(pods []corev1.Pod, id *kube.ServiceIdentity) []corev1.Pod {
+	rank := make(map[string]int)
+	for _, p := range pods {
+		svc := p.Namespace + "/" + string(id.ServiceOf(p.Labels))
+		if _, ok := rank[svc]; !ok {
+			rank[svc] = len(rank)
+		}
+	}
+	out := append([]corev1.Pod(nil), pods...)
+	sort.SliceStable(out, func(i, j int) bool {
+		ri := rank[out[i].Namespace+"/"+string(id.ServiceOf(out[i].Labels))]
+		rj := rank[out[j].Namespace+"/"+string(id.ServiceOf(out[j].Labels))]
+		if ri != rj {
+			return ri < rj
+		}
+		return kube.PodDeletionCost(&out[i]) < kube.PodDeletionCost(&out[j])
+	})
+	return out
+}
+
+// deletionLimits builds the pod deletion rate limiter from config. The default
+// of 10 deletions/s with no burst matches the old fixed 100ms pause.
+func deletionLimits(rc config.RebalancingConfig) (flowcontrol.RateLimiter, int) {
+	qps := float32(defaultDeletionsPerSecond)
+	if rc.DeletionsPerSecond > 0 {
+		qps = float32(rc.DeletionsPerSecond)
+	}
+	burst := 1
+	if rc.DeletionBurst > 0 {
+		burst = rc.DeletionBurst
+	}
+	return flowcontrol.NewTokenBucketRateLimiter(qps, burst), rc.MaxDeletionsPerPass
+}
+
 // NEW: Helper functions
 func contains(slice []string, item string) bool {
 	for _, s := range slice {
@@ -427,39 +1054,81 @@ func equalSlices(a, b []string) bool {
 }
 
 func (c *Controller) reconcileOnce(ctx context.Context) error {
+	err := c.reconcile(ctx, Scope{})
+	if errors.Is(err, ErrNoPaths) {
+		return nil // nothing to do is no failure of a full reconcile
+	}
+	return err
+}
+
+func (c *Controller) reconcile(ctx context.Context, scope Scope) error {
 	start := time.Now()
 	c.debugf("==== reconcile start ====")
 
+	report := &reconcileReport{start: start}
+	c.startRecording(scope)
+	defer c.finishReconcile(ctx, report, scope)
+	defer func() {
+		// Reported before finishReconcile so a panic never counts as a success.
+		if v := recover(); v != nil {
+			report.errorf("panic: %v", v)
+			panic(v)
+		}
+	}()
+
 	// 1) Graph & paths
-	g := graph.NewGraph(c.cfg.Graph.Entry, toServiceDefs(c.cfg.Graph.Services))
-	paths := g.FindAllPaths()
+	g := buildGraph(c.cfg.Graph)
+	if len(g.Nodes) == 0 {
+		err := fmt.Errorf("%w: no services declared for entry %q", ErrGraphEmpty, c.cfg.Graph.Entry)
+		c.infof("%v; nothing to reconcile", err)
+		report.errorf("%v", err)
+		return err
+	}
+	c.addInferredEdges(ctx, g)
+	paths := scope.filterPaths(g.FindAllPaths())
 	if len(paths) == 0 {
-		c.infof("no paths found from entry %q; nothing to do", c.cfg.Graph.Entry)
+		c.infof("no paths found from entry %q (scope services=%v); nothing to do", c.cfg.Graph.Entry, scope.Services)
 		c.debugf("==== reconcile end (no paths) ====")
-		return nil
+		return fmt.Errorf("%w %q (scope services=%v)", ErrNoPaths, c.cfg.Graph.Entry, scope.Services)
 	}
 	c.debugf("found %d paths from entry %q", len(paths), c.cfg.Graph.Entry)
 
 	// 2) Deployments
-	deploysSlice, err := c.k8s.ListDeployments(ctx, c.cfg.NamespaceSelector)
+	namespaces := scope.namespaces(c.cfg.NamespaceSelector)
+	deploysSlice, err := c.k8s.ListDeployments(ctx, namespaces)
 	if err != nil {
 		c.infof("ListDeployments failed: %v", err)
+		report.errorf("list deployments: %v", err)
+		c.componentFailed(ComponentKubernetes, err)
 		return err
 	}
-	deploysBySvc := kube.MapDeploymentsByService(deploysSlice)
+	c.componentOK(ComponentKubernetes)
+	deploysSlice = append(deploysSlice, c.listRollouts(ctx, namespaces, report)...)
+	deploysSlice = c.selectDeployments(deploysSlice)
+	current := affinityFingerprints(deploysSlice) // before any rule changes, for approvals and decision stamps
+	original := c.affinitySnapshot(deploysSlice)  // for holding changes within the error budget
+	deploysBySvc := kube.MapDeploymentsByService(deploysSlice, c.identity)
 	c.debugf("found %d deployments across namespaces, mapped %d services",
 		len(deploysSlice), len(deploysBySvc))
+	c.discoverPorts(ctx, namespaces, deploysBySvc, scope)
+	c.fillServicePorts(g)
 
 	// 3) Placement resolver (nodeName lookup per service)
-	placements := kube.NewPlacementResolver(c.k8s, c.cfg.NamespaceSelector)
+	placements := kube.NewPlacementResolver(c.k8s, c.cfg.NamespaceSelector, c.identity)
 
-	// ⭐ NEW: Node IP resolver (nodeName -> IP matching Prometheus instance)
-	ipResolver := &nodeIPResolver{
-		k8s:   c.k8s,
-		cache: map[string]string{},
+	// 3b) Never steer pods toward cordoned or draining nodes
+	if draining := c.drainingNodes(ctx); len(draining) > 0 {
+		c.infof("nodes cordoned or draining: %v; removing them from node preferences", draining)
+		for _, d := range deploysBySvc {
+			dropDrainingNodePreferences(d, draining)
+		}
 	}
 
+	// ⭐ NEW: Node IP resolver (nodeName -> IP matching Prometheus instance)
+	ipResolver := c.newNodeIPResolver(ctx)
+
 	// 4) Fetch per-node network metrics
+	var badNodes []string
 	nm, err := c.prom.FetchNetworkMatrix(
 		ctx,
 		c.cfg.Prometheus.NodeRTTQuery,
@@ -468,21 +1137,129 @@ func (c *Controller) reconcileOnce(ctx context.Context) error {
 	)
 	if err != nil {
 		c.infof("warning: failed to fetch network metrics; using base-only: %v", err)
+		if errors.Is(err, ErrPrometheusUnavailable) {
+			report.degradedf("network metrics: %v: using cached values", err)
+		} else {
+			report.errorf("fetch network metrics: %v", err)
+		}
+		c.componentFailed(ComponentNetworkMetrics, err)
 	} else if nm == nil {
 		c.infof("warning: network matrix is nil; fallback to base-only")
+		c.componentFailed(ComponentNetworkMetrics, errors.New("network matrix is nil"))
 	} else {
 		c.debugf("fetched network matrix with %d nodes", len(nm.Nodes))
-
+		for _, dim := range nm.MissingDimensions() {
+			c.infof("warning: network metrics without %s: %s", dim, nm.Missing[dim])
+			report.degradedf("network metrics: %s query failed, scoring without it: %s", dim, nm.Missing[dim])
+		}
+		c.componentOK(ComponentNetworkMetrics)
+		nm = c.smoothNodeMetrics(nm)
+	}
+	nm = c.injectNodeMetrics(nm, ipResolver)
+	if nm != nil {
 		// ⭐⭐ NEW: Identify bad nodes and trigger rebalancing
-		badNodes := c.IdentifyBadNodes(nm)
-		if len(badNodes) > 0 {
+		badNodes = c.IdentifyBadNodes(nm)
+		report.bad = badNodes
+		if c.taintMode() && scope.IsEmpty() {
+			c.syncDegradedTaints(ctx, badNodes)
+		}
+		if len(badNodes) > 0 && !c.caps.Has(rbac.FeatureRebalance) {
+			c.infof("detected %d bad nodes %v; rebalancing disabled (no pods/delete permission)", len(badNodes), badNodes)
+		} else if len(badNodes) > 0 {
 			c.infof("detected %d bad nodes that need rebalancing: %v", len(badNodes), badNodes)
-			if err := c.RebalancePods(ctx, deploysSlice, badNodes); err != nil {
+			var rebalance []appsv1.Deployment
+			for i := range deploysSlice {
+				d := &deploysSlice[i]
+				if scope.includesDeployment(c.identity.DeploymentService(d), d) {
+					rebalance = append(rebalance, *d)
+				}
+			}
+			if err := c.RebalancePods(ctx, rebalance, badNodes); errors.Is(err, ErrUnschedulable) {
+				c.infof("not rebalancing: %v", err)
+				report.degradedf("rebalance skipped: %v", err)
+			} else if err != nil {
 				c.infof("rebalancing failed: %v", err)
+				report.errorf("rebalance: %v", err)
 			}
 		}
 	}
 
+	// 4a) Fill nodes the query did not return from the metrics cache. Bad
+	// nodes are judged on live metrics only.
+	nm = c.withCachedNodes(ctx, nm)
+
+	// 4b) Pairwise service latency (caller -> callee edges)
+	var svcLat *promc.ServiceLatencyMatrix
+	if c.cfg.Prometheus.ServicePairLatencyQuery != "" {
+		svcLat, err = c.prom.FetchServiceLatencies(
+			ctx,
+			c.cfg.Prometheus.ServicePairLatencyQuery,
+			c.cfg.Prometheus.ServicePairSrcLabel,
+			c.cfg.Prometheus.ServicePairDstLabel,
+			c.cfg.Prometheus.ServicePairLatencyUnit,
+		)
+		if err != nil {
+			c.infof("warning: failed to fetch service pair latencies; ignoring edge latency: %v", err)
+			if errors.Is(err, ErrPrometheusUnavailable) {
+				report.degradedf("service pair latencies: %v: using cached values", err)
+			} else {
+				report.errorf("fetch service pair latencies: %v", err)
+			}
+			c.componentFailed(ComponentServiceMetrics, err)
+			svcLat = nil
+		} else {
+			c.componentOK(ComponentServiceMetrics)
+			c.debugf("fetched service latency matrix with %d pairs", len(svcLat.Pairs))
+			svcLat = c.smoothLatency(svcLat)
+		}
+	}
+
+	svcLat = c.withCachedLatency(ctx, svcLat)
+	svcLat = mergeLatency(svcLat, c.familyLatency(ctx))
+
+	if edges := c.traceEdges(ctx); edges != nil {
+		svcLat = mergeLatency(svcLat, edges.Latency(c.tracePercentile()))
+	}
+	svcLat = c.injectLatency(svcLat, g)
+
+	// Entry-point latency, recorded with the path scores
+	gwLat := c.fetchGatewayLatency(ctx)
+
+	// 4c) Declared graph vs. observed traffic (full reconciles only); the
+	// request rates also feed the service history
+	var edgeRPS *promc.ServiceRPSMatrix
+	if scope.IsEmpty() && (c.cfg.Prometheus.ServicePairRPSQuery != "" || len(c.cfg.Prometheus.EdgeFamilies) > 0 || c.traces.src != nil) {
+		edgeRPS = c.fetchEdgeRPS(ctx)
+		c.checkDrift(ctx, g, edgeRPS)
+		c.observeForecast(g, edgeRPS, time.Now())
+	}
+	c.saveMetricsCache(ctx, report)
+
+	// 4d) Degradation policies for data missing on the evaluated paths
+	var skipSvcs, skipEdges []string
+	if c.cfg.Prometheus.NodeRTTQuery != "" || c.cfg.Prometheus.NodeDropRateQuery != "" || c.cfg.Prometheus.NodeBandwidthQuery != "" {
+		missing := missingNodeMetrics(paths, placements, nm, ipResolver)
+		if err := c.degrade("node metrics", c.cfg.Degradation.NodeMetrics, missing, report); err != nil {
+			return err
+		}
+		if c.cfg.Degradation.NodeMetrics == config.DegradeSkipService {
+			skipSvcs = missing
+		}
+	}
+	if c.cfg.Prometheus.ServicePairLatencyQuery != "" || c.traces.src != nil {
+		missing := missingEdgeLatency(paths, svcLat)
+		if err := c.degrade("edge latency", c.cfg.Degradation.EdgeLatency, missing, report); err != nil {
+			return err
+		}
+		if c.cfg.Degradation.EdgeLatency == config.DegradeSkipService {
+			skipEdges = missing
+		}
+	}
+	if paths = skipPaths(paths, skipSvcs, skipEdges); len(paths) == 0 {
+		c.infof("every path lacks data skipped by the degradation policy; nothing to do")
+		return nil
+	}
+
 	// 5) Compute base scores for each path
 	baseWeights := scoring.Weights{
 		PathLengthWeight:   c.cfg.Scoring.PathLengthWeight,
@@ -496,7 +1273,7 @@ func (c *Controller) reconcileOnce(ctx context.Context) error {
 			PathLength:       len(p.Nodes),
 			PodCount:         scoring.EstimatePodCount(p),
 			ServiceEdgeCount: scoring.EstimateServiceEdges(p),
-			RPS:              0,
+			RPS:              c.pathForecastRPS(p),
 		}
 		baseScores[i] = scoring.BaseScore(in, baseWeights)
 	}
@@ -514,6 +1291,11 @@ func (c *Controller) reconcileOnce(ctx context.Context) error {
 		BadLatencyMs:       c.cfg.Scoring.BadLatencyMs,
 		BadDropRate:        c.cfg.Scoring.BadDropRate,
 		BadBandwidthRate:   c.cfg.Scoring.BadBandwidthRate,
+		EdgeLatencyWeight:  c.cfg.Scoring.EdgeLatencyWeight,
+		BadEdgeLatencyMs:   c.cfg.Scoring.BadEdgeLatencyMs,
+		StaleAfter:         c.staleAfter(),
+		Limits:             c.scoringLimits(),
+		NodeAggregation:    c.cfg.Scoring.NodeAggregation,
 	}
 	for i := range paths {
 		p := &paths[i]
@@ -527,6 +1309,9 @@ func (c *Controller) reconcileOnce(ctx context.Context) error {
 				netWeights,
 			)
 		}
+		if svcLat != nil {
+			pen += scoring.ComputeEdgeLatencyPenalty(*p, svcLat, netWeights)
+		}
 		p.NetworkPenalty = pen
 		p.FinalScore = scoring.CombineScores(p.BaseScore, pen)
 		finalScores[i] = p.FinalScore
@@ -540,12 +1325,26 @@ func (c *Controller) reconcileOnce(ctx context.Context) error {
 	sort.Slice(paths, func(i, j int) bool {
 		return paths[i].FinalScore > paths[j].FinalScore
 	})
+	paths, err = c.runPathsScored(ctx, paths)
+	if err != nil {
+		return err
+	}
+	paths = c.rankPareto(paths, placements, svcLat)
+
+	c.recordPathHistory(paths, svcLat, gwLat)
+	c.recordCacheSizes()
+	c.recordDataQuality(g, placements, nm, ipResolver, svcLat)
+	thresholds := c.resolveThresholds(g, deploysBySvc)
+	probes := c.probeServices(ctx, g, namespaces)
+	c.recordHealth(g, paths, placements, nm, ipResolver, svcLat, edgeRPS, netWeights, thresholds, badNodes, probes)
+	c.recordRootCause(g, paths, svcLat, thresholds)
 
 	// 8) Top-K affinity generation
 	top := c.cfg.Affinity.TopPaths
 	if top <= 0 || top > len(paths) {
 		top = len(paths)
 	}
+	report.paths = len(paths)
 	c.infof("evaluated %d paths; top %d:", len(paths), top)
 	for i := 0; i < top; i++ {
 		p := paths[i]
@@ -556,30 +1355,137 @@ func (c *Controller) reconcileOnce(ctx context.Context) error {
 	affCfg := rulegen.AffinityConfig{
 		MinAffinityWeight: c.cfg.Affinity.MinAffinityWeight,
 		MaxAffinityWeight: c.cfg.Affinity.MaxAffinityWeight,
+		BadEdgeLatencyMs:  c.cfg.Scoring.BadEdgeLatencyMs,
+		ZoneLatencyMs:     c.cfg.Affinity.ZoneLatencyMs,
+		EdgeConfidence:    edgeConfidence(g),
+		PodSelector:       c.identity.PodSelector,
+	}
+	if svcLat != nil {
+		maxLat := c.cfg.Scoring.Limits.MaxLatencyMs
+		affCfg.EdgeLatency = func(src, dst graph.NodeID) (float64, bool) {
+			lat, ok := svcLat.Latency(string(src), string(dst))
+			if !ok {
+				return 0, false
+			}
+			return scoring.Sanitize("edge latency_ms", lat, maxLat)
+		}
 	}
 
-	// ⭐⭐ CRITICAL FIX: Use the clean version to prevent rule accumulation
+	// Terms of all top paths are composed per service within the weight
+	// budget; each target's previous rules are replaced, not accumulated.
+	var plan rulegen.AffinityPlan
 	for i := 0; i < top; i++ {
 		p := paths[i]
-		rulegen.GenerateCleanAffinityForPath(deploysBySvc, p, p.FinalScore, affCfg)
+		plan.AddPath(deploysBySvc, p, p.FinalScore, affCfg)
+	}
+	if dd := c.cfg.Affinity.DirectDependencies; dd.Enabled {
+		exclude := make(map[string]bool, len(dd.Exclude))
+		for _, s := range dd.Exclude {
+			exclude[s] = true
+		}
+		plan.AddDependencies(deploysBySvc, g, rulegen.DependencyConfig{Weight: dd.Weight, Exclude: exclude}, affCfg)
+	}
+	if sym := c.cfg.Affinity.Symmetric; sym.Enabled {
+		plan.Mirror(deploysBySvc, sym.FactorOrDefault(), affCfg)
 	}
+	plan.Apply(deploysBySvc, c.weightBudget())
 
-	// 9) Apply or dry-run
-	updated := 0
-	for _, d := range deploysBySvc {
-		if c.dryRun {
+	// Check that pods placed under the terms in place landed next to their
+	// peers; relax the terms that keep failing
+	if scope.IsEmpty() {
+		c.verifyPlacements(ctx, deploysBySvc)
+	}
+	c.escalateRules(deploysBySvc)
+
+	// 8a) Node rules: static CPU manager for latency-critical services,
+	// spot avoidance for services on critical paths, replicas spread over
+	// the zones their traffic comes from and toward external services
+	for _, s := range c.cfg.Graph.Services {
+		if d, ok := deploysBySvc[graph.NodeID(s.Name)]; ok && s.LatencyCritical {
+			rulegen.ApplyLatencyCritical(d, c.cfg.Affinity.CPUManagerNodeLabel)
+		}
+	}
+	c.applySpotPolicy(paths, deploysBySvc)
+	c.applyZonePlans(ctx, g, edgeRPS, deploysBySvc, scope)
+	c.applyExternalZones(g, deploysBySvc)
+
+	// Custom decision hooks and the policy may adjust or veto the rules
+	hookHeld := c.runAffinityComputed(ctx, deploysBySvc)
+	c.enforcePolicy(ctx, deploysBySvc, original)
+
+	// Services on no path burning its error budget keep their rules
+	held := c.holdWithinBudget(paths, deploysBySvc, original, report)
+	decision := decisionID(paths[:top], deploysBySvc)
+	if scope.IsEmpty() {
+		c.recordDecisions(g, paths, deploysBySvc, decision)
+		c.recordEffectiveness(ctx, paths[:top])
+	}
+
+	// 8b) Joint placement for co-dependent pending pods (fresh installs)
+	if c.cfg.Batching.Enabled && c.caps.Has(rbac.FeatureNodes) {
+		c.planPendingGroups(ctx, g, deploysBySvc, badNodes)
+	}
+
+	// Capacity the cluster autoscaler should add for co-location, and node
+	// scores for external schedulers
+	if scope.IsEmpty() {
+		report.capacity = c.expansionHints(ctx, g)
+		if c.nodeScores.sink != nil {
+			c.publishNodeScores(ctx, g, nm, ipResolver, netWeights, badNodes, report)
+		}
+	}
+
+	// 8c) Replica recommendations (never applied, only published)
+	recs := c.recommendReplicas(paths, top, deploysBySvc, scope, c.settlingDeployments(ctx))
+	recs.Items = withoutHeld(recs.Items, held)
+	c.recs.set(recs)
+
+	// 8d) Export the generated rules and recommendations (GitOps sinks)
+	c.exportAffinity(ctx, deploysBySvc, recs, scope, report)
+
+	c.recordPreview(deploysBySvc, scope)
+	c.checkSelectors(ctx, deploysBySvc, scope)
+
+	// 9) Apply or dry-run; changes above the auto-approve risk wait for
+	// approval, the rest roll out in batches
+	var apply []*appsv1.Deployment
+	changedAffinity := make(map[string]bool)
+	foreign := 0
+	for svc, d := range deploysBySvc {
+		if !scope.includesDeployment(svc, d) {
+			c.debugf("out of scope: not updating deployment %s/%s", d.Namespace, d.Name)
+			continue
+		}
+		if hookHeld[svc] {
+			continue
+		}
+		if !c.mayModify(d) {
+			foreign++
+			report.errorf("update %s/%s skipped: managed by another controller", d.Namespace, d.Name)
+			continue
+		}
+		if !c.canApply() {
 			c.infof("dry-run: would update deployment %s/%s", d.Namespace, d.Name)
 			continue
 		}
-		if err := c.k8s.UpdateDeployment(ctx, d); err != nil {
-			c.infof("update failed: %s/%s: %v", d.Namespace, d.Name, err)
-		} else {
-			updated++
+		before := current[d.Namespace+"/"+d.Name]
+		if !c.approvedPatch(d, before, "affinity update") {
+			continue
 		}
+		changed := affinityFingerprint(d) != before
+		c.stampDecision(d, decision, changed)
+		c.stampOwnership(d, decision, changed, start)
+		apply = append(apply, d)
+		changedAffinity[d.Namespace+"/"+d.Name] = changed
 	}
-
-	c.infof("reconcile completed in %s; deployments updated: %d",
-		time.Since(start).Round(time.Millisecond), updated)
+	metrics.Default.Set("lead_net_deployments_foreign", "Deployments not updated because another manager marked them.",
+		c.metricLabels(), float64(foreign))
+	updated := c.applyUpdates(ctx, apply, changedAffinity, report)
+
+	c.expireApprovals()
+	report.updated = updated
+	c.infof("reconcile completed in %s; decision %s; deployments updated: %d",
+		time.Since(start).Round(time.Millisecond), decision, updated)
 	c.debugf("=`=== reconcile end ====")
 	return nil
 }
@@ -596,15 +1502,84 @@ func (c *Controller) logLevelString() string {
 }
 
 func (c *Controller) infof(format string, args ...interface{}) {
-	log.Printf("[lead-net] "+format, args...)
+	log.Printf("[lead-net]"+c.logTag()+" "+format, args...)
 }
 
 func (c *Controller) debugf(format string, args ...interface{}) {
 	if c.logLevel >= LogLevelDebug {
-		log.Printf("[lead-net][debug] "+format, args...)
+		log.Printf("[lead-net][debug]"+c.logTag()+" "+format, args...)
 	}
 }
 
+// SetName labels this controller's logs and metrics with the kubeconfig
+// context it manages, so several controllers can share one process.
+func (c *Controller) SetName(name string) {
+	c.name = name
+}
+
+// SetTenant labels this controller's logs and metrics with the tenant
+// (config.TenantConfig) whose graph it reconciles.
+func (c *Controller) SetTenant(name string) {
+	c.tenant = name
+}
+
+func (c *Controller) logTag() string {
+	var tag string
+	if c.name != "" {
+		tag += "[" + c.name + "]"
+	}
+	if c.tenant != "" {
+		tag += "[tenant=" + c.tenant + "]"
+	}
+	return tag
+}
+
+func (c *Controller) metricLabels() map[string]string {
+	if c.name == "" && c.tenant == "" {
+		return nil
+	}
+	labels := make(map[string]string, 2)
+	if c.name != "" {
+		labels["context"] = c.name
+	}
+	if c.tenant != "" {
+		labels["tenant"] = c.tenant
+	}
+	return labels
+}
+
+// selectDeployments keeps the deployments matching cfg.DeploymentSelector
+// and not opted out with kube.IgnoreAnnotation.
+func (c *Controller) selectDeployments(deploys []appsv1.Deployment) []appsv1.Deployment {
+	sel := c.cfg.DeploymentSelector
+	out := deploys[:0:0]
+	ignored := 0
+	for _, d := range deploys {
+		match := true
+		for k, v := range sel {
+			if d.Labels[k] != v {
+				match = false
+				break
+			}
+		}
+		if !match {
+			continue
+		}
+		if kube.Ignored(&d) {
+			c.debugf("skipping deployment %s/%s: annotated %s", d.Namespace, d.Name, kube.IgnoreAnnotation)
+			ignored++
+			continue
+		}
+		out = append(out, d)
+	}
+	metrics.Default.Set("lead_net_deployments_ignored", "Deployments opted out with the lead.io/ignore annotation.",
+		c.metricLabels(), float64(ignored))
+	if len(out) == len(deploys) {
+		return deploys
+	}
+	return out
+}
+
 func formatPath(p graph.Path) string {
 	parts := make([]string, len(p.Nodes))
 	for i, n := range p.Nodes {
@@ -620,3 +1595,17 @@ func (c *Controller) ReconcileOnceForTest(ctx context.Context) error {
 func (c *Controller) EnableDryRunForTest() {
 	c.dryRun = true
 }
+
+// AgeVerificationForTest moves the time every verified term took effect
+// back by d, as if it had been in place that much longer.
+func (c *Controller) AgeVerificationForTest(d time.Duration) {
+	c.verification.mu.Lock()
+	defer c.verification.mu.Unlock()
+	for _, r := range c.verification.rules {
+		r.Since = r.Since.Add(-d)
+	}
+}
+
+func (c *Controller) ReconcileIntervalForTest() time.Duration {
+	return c.interval
+}
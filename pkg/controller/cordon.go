@@ -0,0 +1,93 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+
+	"lead-net-affinity/pkg/kube"
+	"lead-net-affinity/pkg/rbac"
+)
+
+// drainingNodes lists the cordoned or draining nodes (kube.NodeDraining).
+// Without node access it returns nil.
+func (c *Controller) drainingNodes(ctx context.Context) []string {
+	if !c.caps.Has(rbac.FeatureNodes) {
+		return nil
+	}
+	nodes, err := c.k8s.ListNodes(ctx)
+	if err != nil {
+		c.infof("warning: failed to list nodes for cordon/drain state: %v", err)
+		return nil
+	}
+	var out []string
+	for i := range nodes {
+		if kube.NodeDraining(&nodes[i]) {
+			out = append(out, nodes[i].Name)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// checkSchedulable returns ErrUnschedulable when every node is excluded
+// (bad, cordoned or draining), so evicted pods would stay Pending. Without
+// node access it assumes there is room.
+func (c *Controller) checkSchedulable(ctx context.Context, excluded []string) error {
+	if !c.caps.Has(rbac.FeatureNodes) {
+		return nil
+	}
+	nodes, err := c.k8s.ListNodes(ctx)
+	if err != nil || len(nodes) == 0 {
+		return nil
+	}
+	for i := range nodes {
+		if !slices.Contains(excluded, nodes[i].Name) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: all %d nodes are bad, cordoned or draining", ErrUnschedulable, len(nodes))
+}
+
+// dropDrainingNodePreferences removes draining nodes from the deployment's
+// single-node preferences (see setPreferredNode), dropping terms left with
+// no node. It reports whether anything changed.
+func dropDrainingNodePreferences(d *appsv1.Deployment, draining []string) bool {
+	aff := d.Spec.Template.Spec.Affinity
+	if len(draining) == 0 || aff == nil || aff.NodeAffinity == nil {
+		return false
+	}
+	na := aff.NodeAffinity
+
+	changed := false
+	kept := na.PreferredDuringSchedulingIgnoredDuringExecution[:0]
+	for _, term := range na.PreferredDuringSchedulingIgnoredDuringExecution {
+		drop := false
+		for i, expr := range term.Preference.MatchExpressions {
+			if expr.Key != "kubernetes.io/hostname" || expr.Operator != corev1.NodeSelectorOpIn {
+				continue
+			}
+			var values []string
+			for _, v := range expr.Values {
+				if contains(draining, v) {
+					changed = true
+				} else {
+					values = append(values, v)
+				}
+			}
+			term.Preference.MatchExpressions[i].Values = values
+			if len(values) == 0 {
+				drop = true
+			}
+		}
+		if !drop {
+			kept = append(kept, term)
+		}
+	}
+	na.PreferredDuringSchedulingIgnoredDuringExecution = kept
+	return changed
+}
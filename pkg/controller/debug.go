@@ -0,0 +1,58 @@
+package controller
+
+import (
+	"crypto/subtle"
+	"expvar"
+	"log"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"strings"
+
+	"lead-net-affinity/pkg/config"
+)
+
+// WithDebugEndpoints adds /debug/pprof/ and /debug/vars to next when
+// cfg.Enabled, behind the configured bearer token. The rest of next is
+// served unchanged.
+func WithDebugEndpoints(next http.Handler, cfg config.DebugConfig) http.Handler {
+	if !cfg.Enabled {
+		return next
+	}
+	debug := http.NewServeMux()
+	debug.HandleFunc("/debug/pprof/", pprof.Index)
+	debug.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	debug.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	debug.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	debug.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	debug.Handle("/debug/vars", expvar.Handler())
+
+	mux := http.NewServeMux()
+	mux.Handle("/", next)
+	mux.Handle("/debug/", requireToken(debug, cfg))
+	log.Printf("[lead-net][http] serving /debug/pprof/ and /debug/vars (token required)")
+	return mux
+}
+
+// requireToken rejects requests without the bearer token of cfg.
+func requireToken(next http.Handler, cfg config.DebugConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		want := cfg.Token
+		if cfg.TokenFile != "" {
+			b, err := os.ReadFile(cfg.TokenFile)
+			if err != nil {
+				log.Printf("[lead-net][http] debug token file: %v", err)
+				http.Error(w, "debug endpoints unavailable", http.StatusServiceUnavailable)
+				return
+			}
+			want = strings.TrimSpace(string(b))
+		}
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || want == "" || subtle.ConstantTimeCompare([]byte(got), []byte(want)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
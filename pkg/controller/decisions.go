@@ -0,0 +1,420 @@
+package controller
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	"sigs.k8s.io/yaml"
+
+	"lead-net-affinity/pkg/graph"
+	"lead-net-affinity/pkg/kube"
+	"lead-net-affinity/pkg/metrics"
+)
+
+// Decisions is a snapshot of what one full reconcile decided: the graph it
+// worked on, the path ranking and the pod affinity generated per service.
+// Snapshots taken before and after a release are compared with
+// DiffDecisions.
+type Decisions struct {
+	// ID is a content hash of the top paths and the generated rules:
+	// reconciles deciding the same thing get the same ID. It is logged,
+	// stamped on changed pod templates (DecisionAnnotation), recorded in
+	// path history and exported as lead_net_decision_info.
+	ID          string            `json:"id,omitempty"`
+	GeneratedAt time.Time         `json:"generatedAt"`
+	Graph       *graph.Document   `json:"graph,omitempty"`
+	Paths       []RankedPath      `json:"paths,omitempty"`
+	Affinity    []ServiceAffinity `json:"affinity,omitempty"`
+}
+
+// RankedPath is a path's place in the ranking.
+type RankedPath struct {
+	ID         string   `json:"id"`
+	Rank       int      `json:"rank"` // 1 = most critical
+	FinalScore float64  `json:"finalScore"`
+	Services   []string `json:"services,omitempty"`
+}
+
+// ServiceAffinity is the preferred pod affinity generated for a service.
+type ServiceAffinity struct {
+	Service string         `json:"service"`
+	Version string         `json:"version,omitempty"`
+	Owner   string         `json:"owner,omitempty"`
+	Peers   []AffinityPeer `json:"peers"`
+}
+
+// AffinityPeer is one preferred pod affinity term.
+type AffinityPeer struct {
+	Service     string `json:"service"`
+	TopologyKey string `json:"topologyKey"`
+	Weight      int32  `json:"weight"`
+}
+
+// DecisionAnnotation is set on a pod template to the ID of the decision
+// that last changed its affinity, so a rollout and the pod restarts it
+// causes can be traced to that decision.
+const DecisionAnnotation = kube.DecisionAnnotation
+
+// decisionID hashes the path set (IDs in rank order) and the rule set
+// (every service's affinity and zone spread) of a decision. Scores are left out: they
+// move every reconcile without changing what is decided.
+func decisionID(paths []graph.Path, deploysBySvc map[graph.NodeID]*appsv1.Deployment) string {
+	h := sha256.New()
+	for _, p := range paths {
+		fmt.Fprintf(h, "path %s\n", PathID(p))
+	}
+	svcs := make([]string, 0, len(deploysBySvc))
+	for svc := range deploysBySvc {
+		svcs = append(svcs, string(svc))
+	}
+	sort.Strings(svcs)
+	for _, svc := range svcs {
+		fmt.Fprintf(h, "rules %s %s\n", svc, affinityFingerprint(deploysBySvc[graph.NodeID(svc)]))
+	}
+	return hex.EncodeToString(h.Sum(nil))[:12]
+}
+
+// stampDecision sets DecisionAnnotation on d's pod template if decision
+// changed its affinity.
+func (c *Controller) stampDecision(d *appsv1.Deployment, decision string, changed bool) {
+	if !changed {
+		return
+	}
+	if d.Spec.Template.Annotations == nil {
+		d.Spec.Template.Annotations = make(map[string]string)
+	}
+	d.Spec.Template.Annotations[DecisionAnnotation] = decision
+	c.infof("decision %s changes the affinity of %s/%s", decision, d.Namespace, d.Name)
+}
+
+type decisionStore struct {
+	mu   sync.RWMutex
+	last Decisions
+}
+
+func (s *decisionStore) get() Decisions {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.last
+}
+
+func (s *decisionStore) set(d Decisions) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.last = d
+}
+
+// Decisions returns the decisions of the last full reconcile.
+func (c *Controller) Decisions() Decisions {
+	return c.decisions.get()
+}
+
+// recordDecisions snapshots the ranking and the generated affinity of
+// decision id.
+func (c *Controller) recordDecisions(g *graph.Graph, paths []graph.Path, deploysBySvc map[graph.NodeID]*appsv1.Deployment, id string) {
+	fillServiceMeta(g, deploysBySvc)
+	d := Decisions{ID: id, GeneratedAt: time.Now(), Graph: g.Document()}
+	for i, p := range paths {
+		rp := RankedPath{ID: PathID(p), Rank: i + 1, FinalScore: p.FinalScore}
+		for _, n := range p.Nodes {
+			rp.Services = append(rp.Services, string(n))
+		}
+		d.Paths = append(d.Paths, rp)
+	}
+	for svc, dep := range deploysBySvc {
+		aff := dep.Spec.Template.Spec.Affinity
+		if aff == nil || aff.PodAffinity == nil {
+			continue
+		}
+		sa := ServiceAffinity{Service: string(svc)}
+		if n := g.Nodes[svc]; n != nil {
+			sa.Version, sa.Owner = n.Version, n.Owner
+		}
+		for _, t := range aff.PodAffinity.PreferredDuringSchedulingIgnoredDuringExecution {
+			peer := ""
+			if sel := t.PodAffinityTerm.LabelSelector; sel != nil {
+				peer = string(c.identity.ServiceOf(sel.MatchLabels))
+			}
+			sa.Peers = append(sa.Peers, AffinityPeer{Service: peer, TopologyKey: t.PodAffinityTerm.TopologyKey, Weight: t.Weight})
+		}
+		if len(sa.Peers) > 0 {
+			sort.Slice(sa.Peers, func(i, j int) bool {
+				if sa.Peers[i].Service != sa.Peers[j].Service {
+					return sa.Peers[i].Service < sa.Peers[j].Service
+				}
+				return sa.Peers[i].TopologyKey < sa.Peers[j].TopologyKey
+			})
+			d.Affinity = append(d.Affinity, sa)
+		}
+	}
+	sort.Slice(d.Affinity, func(i, j int) bool { return d.Affinity[i].Service < d.Affinity[j].Service })
+	prev := c.decisions.get().ID
+	c.decisions.set(d)
+
+	if prev == id {
+		return
+	}
+	c.infof("decision %s replaces %q", id, prev)
+	if prev != "" {
+		metrics.Default.Delete("lead_net_decision_info", c.decisionLabels(prev))
+	}
+	metrics.Default.Set("lead_net_decision_info",
+		"Always 1; decision_id is the ID of the last full reconcile's decision.", c.decisionLabels(id), 1)
+}
+
+func (c *Controller) decisionLabels(id string) map[string]string {
+	labels := map[string]string{"decision_id": id}
+	for k, v := range c.metricLabels() {
+		labels[k] = v
+	}
+	return labels
+}
+
+// fillServiceMeta takes versions and owners not set in the config from
+// the services' Deployments.
+func fillServiceMeta(g *graph.Graph, deploysBySvc map[graph.NodeID]*appsv1.Deployment) {
+	for svc, dep := range deploysBySvc {
+		n := g.Nodes[svc]
+		if n == nil {
+			continue
+		}
+		if n.Version == "" {
+			n.Version = kube.DeploymentVersion(dep)
+		}
+		if n.Owner == "" {
+			n.Owner = kube.DeploymentOwner(dep)
+		}
+	}
+}
+
+// ForOwner returns the decisions about services owned by owner: their
+// graph services and affinity. Paths are kept if they cross such a
+// service.
+func (d Decisions) ForOwner(owner string) Decisions {
+	out := Decisions{GeneratedAt: d.GeneratedAt}
+	owned := make(map[string]bool)
+	if d.Graph != nil {
+		doc := *d.Graph
+		doc.Services = nil
+		for _, s := range d.Graph.Services {
+			if s.Owner == owner {
+				owned[s.Name] = true
+				doc.Services = append(doc.Services, s)
+			}
+		}
+		out.Graph = &doc
+	}
+	for _, a := range d.Affinity {
+		if a.Owner == owner {
+			owned[a.Service] = true
+			out.Affinity = append(out.Affinity, a)
+		}
+	}
+	for _, p := range d.Paths {
+		for _, svc := range p.Services {
+			if owned[svc] {
+				out.Paths = append(out.Paths, p)
+				break
+			}
+		}
+	}
+	return out
+}
+
+// DecisionDiff is the result of DiffDecisions and POST /diff.
+type DecisionDiff struct {
+	Graph    *graph.DocumentDiff `json:"graph,omitempty"` // nil unless both snapshots carry a graph
+	Paths    []PathChange        `json:"paths,omitempty"`
+	Affinity []AffinityChange    `json:"affinity,omitempty"`
+}
+
+// PathChange is a path whose rank changed. Rank 0 means the path is absent
+// from that snapshot.
+type PathChange struct {
+	ID          string  `json:"id"`
+	RankBefore  int     `json:"rankBefore"`
+	RankAfter   int     `json:"rankAfter"`
+	ScoreBefore float64 `json:"scoreBefore"`
+	ScoreAfter  float64 `json:"scoreAfter"`
+}
+
+// AffinityChange is a pod affinity term whose weight changed. Weight 0
+// means the term is absent from that snapshot.
+type AffinityChange struct {
+	Service      string `json:"service"`
+	Peer         string `json:"peer"`
+	TopologyKey  string `json:"topologyKey"`
+	WeightBefore int32  `json:"weightBefore"`
+	WeightAfter  int32  `json:"weightAfter"`
+}
+
+// Empty reports whether nothing changed.
+func (d DecisionDiff) Empty() bool {
+	return (d.Graph == nil || d.Graph.Empty()) && len(d.Paths) == 0 && len(d.Affinity) == 0
+}
+
+// DiffDecisions compares two snapshots, e.g. from before and after a
+// release. Results are sorted by path rank and by service.
+func DiffDecisions(before, after Decisions) DecisionDiff {
+	var out DecisionDiff
+	if before.Graph != nil && after.Graph != nil {
+		gd := graph.DiffDocuments(before.Graph, after.Graph)
+		out.Graph = &gd
+	}
+
+	paths := make(map[string]*PathChange)
+	for _, p := range before.Paths {
+		paths[p.ID] = &PathChange{ID: p.ID, RankBefore: p.Rank, ScoreBefore: p.FinalScore}
+	}
+	for _, p := range after.Paths {
+		pc, ok := paths[p.ID]
+		if !ok {
+			pc = &PathChange{ID: p.ID}
+			paths[p.ID] = pc
+		}
+		pc.RankAfter, pc.ScoreAfter = p.Rank, p.FinalScore
+	}
+	for _, pc := range paths {
+		if pc.RankBefore != pc.RankAfter {
+			out.Paths = append(out.Paths, *pc)
+		}
+	}
+	sort.Slice(out.Paths, func(i, j int) bool {
+		a, b := out.Paths[i], out.Paths[j]
+		if ra, rb := rankOrder(a), rankOrder(b); ra != rb {
+			return ra < rb
+		}
+		return a.ID < b.ID
+	})
+
+	type termKey struct{ svc, peer, topo string }
+	terms := make(map[termKey]*AffinityChange)
+	term := func(svc string, p AffinityPeer) *AffinityChange {
+		k := termKey{svc, p.Service, p.TopologyKey}
+		ac, ok := terms[k]
+		if !ok {
+			ac = &AffinityChange{Service: svc, Peer: p.Service, TopologyKey: p.TopologyKey}
+			terms[k] = ac
+		}
+		return ac
+	}
+	for _, sa := range before.Affinity {
+		for _, p := range sa.Peers {
+			term(sa.Service, p).WeightBefore += p.Weight
+		}
+	}
+	for _, sa := range after.Affinity {
+		for _, p := range sa.Peers {
+			term(sa.Service, p).WeightAfter += p.Weight
+		}
+	}
+	for _, ac := range terms {
+		if ac.WeightBefore != ac.WeightAfter {
+			out.Affinity = append(out.Affinity, *ac)
+		}
+	}
+	sort.Slice(out.Affinity, func(i, j int) bool {
+		a, b := out.Affinity[i], out.Affinity[j]
+		if a.Service != b.Service {
+			return a.Service < b.Service
+		}
+		if a.Peer != b.Peer {
+			return a.Peer < b.Peer
+		}
+		return a.TopologyKey < b.TopologyKey
+	})
+	return out
+}
+
+// rankOrder sorts a change by its best rank in either snapshot.
+func rankOrder(p PathChange) int {
+	r := math.MaxInt
+	for _, v := range []int{p.RankBefore, p.RankAfter} {
+		if v > 0 && v < r {
+			r = v
+		}
+	}
+	return r
+}
+
+// ParseSnapshot reads a Decisions snapshot (JSON or YAML, as served by
+// GET /decisions) or a bare graph document in any graph.ParseDocument
+// format, which yields a snapshot with only the graph set.
+func ParseSnapshot(data []byte) (Decisions, error) {
+	trimmed := bytes.TrimSpace(data)
+	var probe struct {
+		Kind  string `json:"kind"`
+		Entry string `json:"entry"`
+	}
+	if bytes.HasPrefix(trimmed, []byte("<")) || (yaml.Unmarshal(trimmed, &probe) == nil && probe.Kind+probe.Entry != "") {
+		doc, err := graph.ParseDocument(data, "")
+		if err != nil {
+			return Decisions{}, err
+		}
+		return Decisions{Graph: doc}, nil
+	}
+	var d Decisions
+	if err := yaml.UnmarshalStrict(trimmed, &d); err != nil {
+		return Decisions{}, fmt.Errorf("parse decisions snapshot: %w", err)
+	}
+	if d.Graph != nil {
+		if err := d.Graph.Validate(); err != nil {
+			return Decisions{}, err
+		}
+	}
+	return d, nil
+}
+
+// WriteText writes d for humans, one change per line.
+func (d DecisionDiff) WriteText(w io.Writer) {
+	if d.Empty() {
+		fmt.Fprintln(w, "no changes")
+		return
+	}
+	if g := d.Graph; g != nil && !g.Empty() {
+		fmt.Fprintln(w, "graph:")
+		if g.EntryBefore != g.EntryAfter {
+			fmt.Fprintf(w, "  ~ entry %s -> %s\n", g.EntryBefore, g.EntryAfter)
+		}
+		for _, s := range g.AddedServices {
+			fmt.Fprintf(w, "  + service %s\n", s)
+		}
+		for _, s := range g.RemovedServices {
+			fmt.Fprintf(w, "  - service %s\n", s)
+		}
+		for _, e := range g.AddedEdges {
+			fmt.Fprintf(w, "  + edge %s -> %s\n", e.From, e.To)
+		}
+		for _, e := range g.RemovedEdges {
+			fmt.Fprintf(w, "  - edge %s -> %s\n", e.From, e.To)
+		}
+	}
+	if len(d.Paths) > 0 {
+		fmt.Fprintln(w, "paths:")
+		for _, p := range d.Paths {
+			switch {
+			case p.RankBefore == 0:
+				fmt.Fprintf(w, "  + %s rank %d (score %.1f)\n", p.ID, p.RankAfter, p.ScoreAfter)
+			case p.RankAfter == 0:
+				fmt.Fprintf(w, "  - %s rank %d (score %.1f)\n", p.ID, p.RankBefore, p.ScoreBefore)
+			default:
+				fmt.Fprintf(w, "  ~ %s rank %d -> %d (score %.1f -> %.1f)\n", p.ID, p.RankBefore, p.RankAfter, p.ScoreBefore, p.ScoreAfter)
+			}
+		}
+	}
+	if len(d.Affinity) > 0 {
+		fmt.Fprintln(w, "affinity:")
+		for _, a := range d.Affinity {
+			fmt.Fprintf(w, "  ~ %s -> %s (%s) weight %d -> %d (%+d)\n",
+				a.Service, a.Peer, a.TopologyKey, a.WeightBefore, a.WeightAfter, a.WeightAfter-a.WeightBefore)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package controller
+
+import (
+	"fmt"
+	"sort"
+
+	"lead-net-affinity/pkg/config"
+	"lead-net-affinity/pkg/graph"
+	promc "lead-net-affinity/pkg/prometheus"
+	"lead-net-affinity/pkg/scoring"
+)
+
+// degrade applies a degradation policy (config.Degrade*) to the services or
+// edges (missing) that lack data of one kind. It returns an error for fail;
+// otherwise the fallback is recorded in the reconcile status.
+func (c *Controller) degrade(kind, policy string, missing []string, report *reconcileReport) error {
+	if len(missing) == 0 {
+		return nil
+	}
+	sort.Strings(missing)
+	switch policy {
+	case config.DegradeFail:
+		report.errorf("%s missing for %v (degradation policy %s)", kind, missing, policy)
+		return fmt.Errorf("%s missing for %v", kind, missing)
+	case config.DegradeSkipService:
+		report.degradedf("%s missing for %v: skipped", kind, missing)
+		c.infof("%s missing for %v; skipping affected paths", kind, missing)
+	default:
+		report.degradedf("%s missing for %v: using defaults", kind, missing)
+		c.debugf("%s missing for %v; scoring with defaults", kind, missing)
+	}
+	return nil
+}
+
+// missingNodeMetrics lists the services on paths whose (known) node has no
+// network metrics. Services that are not placed yet are not counted.
+func missingNodeMetrics(
+	paths []graph.Path,
+	placements scoring.PodPlacement,
+	nm *promc.NetworkMatrix,
+	ipResolver scoring.NodeIPResolver,
+) []string {
+	seen := make(map[graph.NodeID]bool)
+	var out []string
+	for _, p := range paths {
+		for _, svc := range p.Nodes {
+			if seen[svc] {
+				continue
+			}
+			seen[svc] = true
+			// Missing only if none of the service's nodes has metrics.
+			nodes := scoring.ServiceNodes(placements, svc)
+			measured := false
+			for node := range nodes {
+				if nodeMetrics(nm, node, ipResolver) != nil {
+					measured = true
+					break
+				}
+			}
+			if len(nodes) > 0 && !measured {
+				out = append(out, string(svc))
+			}
+		}
+	}
+	return out
+}
+
+// missingEdgeLatency lists the path edges ("src->dst") without a latency.
+func missingEdgeLatency(paths []graph.Path, svcLat *promc.ServiceLatencyMatrix) []string {
+	seen := make(map[string]bool)
+	var out []string
+	for _, p := range paths {
+		for i := 0; i+1 < len(p.Nodes); i++ {
+			e := edgeKey(p.Nodes[i], p.Nodes[i+1])
+			if seen[e] {
+				continue
+			}
+			seen[e] = true
+			if _, ok := svcLat.Latency(string(p.Nodes[i]), string(p.Nodes[i+1])); !ok {
+				out = append(out, e)
+			}
+		}
+	}
+	return out
+}
+
+func edgeKey(src, dst graph.NodeID) string {
+	return string(src) + "->" + string(dst)
+}
+
+// skipPaths drops the paths through any of the given services or edges.
+func skipPaths(paths []graph.Path, services, edges []string) []graph.Path {
+	if len(services) == 0 && len(edges) == 0 {
+		return paths
+	}
+	skipSvc := make(map[string]bool, len(services))
+	for _, s := range services {
+		skipSvc[s] = true
+	}
+	skipEdge := make(map[string]bool, len(edges))
+	for _, e := range edges {
+		skipEdge[e] = true
+	}
+
+	out := paths[:0:0]
+	for _, p := range paths {
+		keep := true
+		for i, n := range p.Nodes {
+			if skipSvc[string(n)] || (i+1 < len(p.Nodes) && skipEdge[edgeKey(n, p.Nodes[i+1])]) {
+				keep = false
+				break
+			}
+		}
+		if keep {
+			out = append(out, p)
+		}
+	}
+	return out
+}
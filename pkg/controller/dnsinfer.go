@@ -0,0 +1,124 @@
+package controller
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"lead-net-affinity/pkg/dnsinfer"
+	"lead-net-affinity/pkg/graph"
+	"lead-net-affinity/pkg/metrics"
+)
+
+const (
+	defaultDNSNamespace = "kube-system"
+	defaultDNSSelector  = "k8s-app=kube-dns"
+	defaultDNSSince     = 5 * time.Minute
+)
+
+// DNSLogSource reads DNS server logs (kube.Client.PodLogs).
+type DNSLogSource interface {
+	PodLogs(ctx context.Context, namespace, selector string, since time.Duration) ([]string, error)
+}
+
+// SetDNSLogSource enables DNS-based edge inference (dnsInference.enabled).
+// Inferred edges are added to the graph as low-confidence dependencies
+// where the declared graph has none.
+func (c *Controller) SetDNSLogSource(src DNSLogSource) {
+	c.dns.src = src
+}
+
+type dnsCache struct {
+	mu    sync.Mutex
+	src   DNSLogSource
+	at    time.Time
+	edges []dnsinfer.Edge
+}
+
+// inferDNSEdges returns the DNS-inferred edges, refreshed at most once per
+// reconcile interval.
+func (c *Controller) inferDNSEdges(ctx context.Context) []dnsinfer.Edge {
+	c.dns.mu.Lock()
+	defer c.dns.mu.Unlock()
+	if c.dns.src == nil {
+		return nil
+	}
+	if c.dns.edges != nil && time.Since(c.dns.at) < c.interval {
+		return c.dns.edges
+	}
+
+	dc := c.cfg.DNSInference
+	ns, sel, since := dc.Namespace, dc.Selector, defaultDNSSince
+	if ns == "" {
+		ns = defaultDNSNamespace
+	}
+	if sel == "" {
+		sel = defaultDNSSelector
+	}
+	if dc.SinceSeconds > 0 {
+		since = time.Duration(dc.SinceSeconds) * time.Second
+	}
+
+	lines, err := c.dns.src.PodLogs(ctx, ns, sel, since)
+	if err != nil {
+		c.infof("warning: failed to read DNS logs; keeping previous inferred edges: %v", err)
+		c.componentFailed(ComponentDNSInference, err)
+		return c.dns.edges
+	}
+	c.componentOK(ComponentDNSInference)
+	var queries []dnsinfer.Query
+	for _, l := range lines {
+		if q, ok := dnsinfer.ParseCoreDNSLog(l); ok {
+			queries = append(queries, q)
+		}
+	}
+
+	podServices := make(map[string]string)
+	for _, pns := range c.cfg.NamespaceSelector {
+		pods, err := c.k8s.ListPods(ctx, pns, "")
+		if err != nil {
+			c.infof("warning: DNS inference: list pods in %s: %v", pns, err)
+			continue
+		}
+		for _, p := range pods {
+			svc := string(c.identity.ServiceOf(p.Labels))
+			if svc == "" || p.Status.PodIP == "" || p.Spec.HostNetwork {
+				continue
+			}
+			podServices[p.Status.PodIP] = svc
+		}
+	}
+
+	edges := dnsinfer.Infer(queries, podServices, dc.ClusterDomain)
+	c.dns.edges, c.dns.at = edges, time.Now()
+	c.debugf("DNS inference: %d queries, %d candidate edges", len(queries), len(edges))
+	return edges
+}
+
+// addInferredEdges adds DNS-inferred edges with at least minQueries lookups
+// to g. Declared edges always win; inferred ones are marked on the graph.
+func (c *Controller) addInferredEdges(ctx context.Context, g *graph.Graph) {
+	edges := c.inferDNSEdges(ctx)
+	if edges == nil {
+		return
+	}
+	minQueries := c.cfg.DNSInference.MinQueries
+	if minQueries <= 0 {
+		minQueries = 1
+	}
+
+	added := 0
+	for _, e := range edges {
+		if e.Queries < minQueries {
+			continue
+		}
+		if g.AddInferredEdge(graph.NodeID(e.Pair.Src), graph.NodeID(e.Pair.Dst)) {
+			added++
+			c.debugf("inferred edge %s -> %s from %d DNS queries (low confidence)", e.Pair.Src, e.Pair.Dst, e.Queries)
+		}
+	}
+	metrics.Default.Set("lead_net_inferred_edges", "Graph edges inferred from DNS lookups.", c.metricLabels(), float64(added))
+	if added > 0 {
+		c.infof("added %d low-confidence edges inferred from DNS lookups", added)
+	}
+}
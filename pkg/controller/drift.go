@@ -0,0 +1,185 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"lead-net-affinity/pkg/graph"
+	"lead-net-affinity/pkg/metrics"
+	promc "lead-net-affinity/pkg/prometheus"
+)
+
+// DriftEdge is a caller -> callee dependency.
+type DriftEdge struct {
+	From string  `json:"from"`
+	To   string  `json:"to"`
+	RPS  float64 `json:"rps,omitempty"`
+}
+
+// DriftReport compares the declared graph with the edges seen in traffic.
+type DriftReport struct {
+	Time time.Time `json:"time"`
+
+	// Undeclared edges carry traffic but are missing from graph.services.
+	Undeclared []DriftEdge `json:"undeclared"`
+	// Unobserved edges are declared but have not carried traffic (in either
+	// direction) since the controller started.
+	Unobserved []DriftEdge `json:"unobserved"`
+}
+
+// Empty reports whether the config matches the observed traffic.
+func (r DriftReport) Empty() bool {
+	return len(r.Undeclared) == 0 && len(r.Unobserved) == 0
+}
+
+func (r DriftReport) fingerprint() string {
+	var parts []string
+	for _, e := range r.Undeclared {
+		parts = append(parts, "+"+e.From+">"+e.To)
+	}
+	for _, e := range r.Unobserved {
+		parts = append(parts, "-"+e.From+">"+e.To)
+	}
+	return strings.Join(parts, ",")
+}
+
+// DriftNotifier is told whenever the drift report changes.
+type DriftNotifier interface {
+	NotifyDrift(ctx context.Context, r DriftReport) error
+}
+
+// SetDriftNotifier wires a notifier for graph drift changes.
+func (c *Controller) SetDriftNotifier(n DriftNotifier) {
+	c.drift.notifier = n
+}
+
+// Drift returns the last drift report (zero value before the first check).
+func (c *Controller) Drift() DriftReport {
+	c.drift.mu.RLock()
+	defer c.drift.mu.RUnlock()
+	return c.drift.last
+}
+
+type driftTracker struct {
+	mu       sync.RWMutex
+	last     DriftReport
+	observed map[promc.ServicePair]bool // every edge seen since start
+	notifier DriftNotifier
+}
+
+// checkDrift compares declared edges with the service-pair RPS matrix and
+// publishes the result as metrics, via Drift() and the notifier on change.
+func (c *Controller) checkDrift(ctx context.Context, g *graph.Graph, rps *promc.ServiceRPSMatrix) {
+	if rps == nil {
+		return
+	}
+	minRPS := c.cfg.Drift.MinRPS
+
+	declared := make(map[promc.ServicePair]bool)
+	for id, n := range g.Nodes {
+		for _, dep := range n.DependsOn {
+			if n.Inferred[dep] {
+				continue
+			}
+			declared[promc.ServicePair{Src: string(id), Dst: string(dep)}] = true
+		}
+	}
+
+	c.drift.mu.Lock()
+	if c.drift.observed == nil {
+		c.drift.observed = make(map[promc.ServicePair]bool)
+	}
+	report := DriftReport{Time: time.Now(), Undeclared: []DriftEdge{}, Unobserved: []DriftEdge{}}
+	for pair, v := range rps.Pairs {
+		if v <= 0 || v < minRPS || pair.Src == pair.Dst {
+			continue
+		}
+		c.drift.observed[pair] = true
+		if !declared[pair] && !declared[promc.ServicePair{Src: pair.Dst, Dst: pair.Src}] {
+			report.Undeclared = append(report.Undeclared, DriftEdge{From: pair.Src, To: pair.Dst, RPS: v})
+		}
+	}
+	for pair := range declared {
+		if !c.drift.observed[pair] && !c.drift.observed[promc.ServicePair{Src: pair.Dst, Dst: pair.Src}] {
+			report.Unobserved = append(report.Unobserved, DriftEdge{From: pair.Src, To: pair.Dst})
+		}
+	}
+	sortDriftEdges(report.Undeclared)
+	sortDriftEdges(report.Unobserved)
+
+	changed := report.fingerprint() != c.drift.last.fingerprint()
+	c.drift.last = report
+	notifier := c.drift.notifier
+	c.drift.mu.Unlock()
+
+	for kind, n := range map[string]int{"undeclared": len(report.Undeclared), "unobserved": len(report.Unobserved)} {
+		labels := map[string]string{"kind": kind}
+		for k, v := range c.metricLabels() {
+			labels[k] = v
+		}
+		metrics.Default.Set("lead_net_graph_drift_edges", "Edges where the declared graph and observed traffic disagree.", labels, float64(n))
+	}
+
+	if !changed {
+		return
+	}
+	for _, e := range report.Undeclared {
+		c.infof("graph drift: %s -> %s carries %.2f rps but is not declared", e.From, e.To, e.RPS)
+	}
+	for _, e := range report.Unobserved {
+		c.infof("graph drift: declared edge %s -> %s has not been observed", e.From, e.To)
+	}
+	if notifier != nil {
+		if err := notifier.NotifyDrift(ctx, report); err != nil {
+			c.infof("failed to send drift notification: %v", err)
+		}
+	}
+}
+
+func sortDriftEdges(es []DriftEdge) {
+	sort.Slice(es, func(i, j int) bool {
+		if es[i].From != es[j].From {
+			return es[i].From < es[j].From
+		}
+		return es[i].To < es[j].To
+	})
+}
+
+// webhookDriftNotifier POSTs the report as JSON.
+type webhookDriftNotifier struct {
+	url    string
+	client *http.Client
+}
+
+// NewWebhookDriftNotifier returns a DriftNotifier POSTing reports to url.
+func NewWebhookDriftNotifier(url string) DriftNotifier {
+	return &webhookDriftNotifier{url: url, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (n *webhookDriftNotifier) NotifyDrift(ctx context.Context, r DriftReport) error {
+	body, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("drift webhook: unexpected status %s", resp.Status)
+	}
+	return nil
+}
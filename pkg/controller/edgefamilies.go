@@ -0,0 +1,139 @@
+package controller
+
+import (
+	"context"
+	"time"
+
+	"lead-net-affinity/pkg/config"
+	promc "lead-net-affinity/pkg/prometheus"
+)
+
+// serviceValueFetcher is implemented by Prometheus clients that can run
+// per-service queries, needed for edge families without a caller label.
+type serviceValueFetcher interface {
+	FetchServiceValues(ctx context.Context, kind, query, label string) (map[string]float64, error)
+}
+
+// familyRPS returns the request rates of prometheus.edgeFamilies, earlier
+// families winning, or nil if none are configured or none answered. Each
+// family only measures callees of its protocol (see familyMeasures).
+func (c *Controller) familyRPS(ctx context.Context) *promc.ServiceRPSMatrix {
+	var out *promc.ServiceRPSMatrix
+	protos := c.appProtocols()
+	for _, f := range c.cfg.Prometheus.EdgeFamilies {
+		if f.RPSQuery == "" {
+			continue
+		}
+		var m *promc.ServiceRPSMatrix
+		if f.SrcLabel != "" {
+			var err error
+			if m, err = c.prom.FetchServicePairRPS(ctx, f.RPSQuery, f.SrcLabel, f.DstLabel); err != nil {
+				c.infof("warning: failed to fetch %s edge request rates: %v", familyName(f), err)
+				continue
+			}
+		} else {
+			perCallee, ok := c.fetchServiceValues(ctx, f, "rps", f.RPSQuery)
+			if !ok {
+				continue
+			}
+			m = &promc.ServiceRPSMatrix{Pairs: map[promc.ServicePair]float64{}, Freshness: map[promc.ServicePair]promc.Freshness{}}
+			now := time.Now()
+			for callee, callers := range declaredCallers(c.cfg.Graph) {
+				v, ok := perCallee[callee]
+				if !ok {
+					continue
+				}
+				for _, caller := range callers {
+					k := promc.ServicePair{Src: caller, Dst: callee}
+					m.Pairs[k] = v / float64(len(callers))
+					m.Freshness[k] = promc.Measured(now)
+				}
+			}
+		}
+		dropUnmeasured(f, m.Pairs, m.Freshness, protos)
+		c.debugf("edge family %s: %d request rates", familyName(f), len(m.Pairs))
+		out = mergeRPS(out, m)
+	}
+	return out
+}
+
+// familyLatency returns the edge latencies of prometheus.edgeFamilies,
+// earlier families winning, or nil if none are configured or none answered.
+// Each family only measures callees of its protocol (see familyMeasures).
+func (c *Controller) familyLatency(ctx context.Context) *promc.ServiceLatencyMatrix {
+	var out *promc.ServiceLatencyMatrix
+	protos := c.appProtocols()
+	for _, f := range c.cfg.Prometheus.EdgeFamilies {
+		if f.LatencyQuery == "" {
+			continue
+		}
+		var m *promc.ServiceLatencyMatrix
+		if f.SrcLabel != "" {
+			var err error
+			if m, err = c.prom.FetchServiceLatencies(ctx, f.LatencyQuery, f.SrcLabel, f.DstLabel, f.LatencyUnit); err != nil {
+				c.infof("warning: failed to fetch %s edge latencies: %v", familyName(f), err)
+				continue
+			}
+		} else {
+			perCallee, ok := c.fetchServiceValues(ctx, f, "latency", f.LatencyQuery)
+			if !ok {
+				continue
+			}
+			scale, err := promc.MillisecondsPer(f.LatencyUnit)
+			if err != nil {
+				c.infof("warning: %s edge latencies: %v", familyName(f), err)
+				continue
+			}
+			m = &promc.ServiceLatencyMatrix{Pairs: map[promc.ServicePair]float64{}, Freshness: map[promc.ServicePair]promc.Freshness{}}
+			now := time.Now()
+			for callee, callers := range declaredCallers(c.cfg.Graph) {
+				v, ok := perCallee[callee]
+				if !ok {
+					continue
+				}
+				for _, caller := range callers {
+					k := promc.ServicePair{Src: caller, Dst: callee}
+					m.Pairs[k] = v * scale
+					m.Freshness[k] = promc.Measured(now)
+				}
+			}
+		}
+		dropUnmeasured(f, m.Pairs, m.Freshness, protos)
+		c.debugf("edge family %s: %d latencies", familyName(f), len(m.Pairs))
+		out = mergeLatency(out, m)
+	}
+	return out
+}
+
+func (c *Controller) fetchServiceValues(ctx context.Context, f config.EdgeFamilyConfig, kind, query string) (map[string]float64, bool) {
+	fetcher, ok := c.prom.(serviceValueFetcher)
+	if !ok {
+		c.infof("warning: %s edge %s needs per-service queries, which this Prometheus client does not support", familyName(f), kind)
+		return nil, false
+	}
+	values, err := fetcher.FetchServiceValues(ctx, familyName(f)+" "+kind, query, f.DstLabel)
+	if err != nil {
+		c.infof("warning: failed to fetch %s edge %s: %v", familyName(f), kind, err)
+		return nil, false
+	}
+	return values, true
+}
+
+// declaredCallers maps every service to the services declaring a
+// dependency on it.
+func declaredCallers(gc config.ServiceGraphConfig) map[string][]string {
+	out := make(map[string][]string)
+	for _, s := range gc.Services {
+		for _, dep := range s.DependsOn {
+			out[dep] = append(out[dep], s.Name)
+		}
+	}
+	return out
+}
+
+func familyName(f config.EdgeFamilyConfig) string {
+	if f.Family == "" {
+		return "custom"
+	}
+	return f.Family
+}
@@ -0,0 +1,277 @@
+package controller
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"lead-net-affinity/pkg/graph"
+	"lead-net-affinity/pkg/history"
+	"lead-net-affinity/pkg/kube"
+	"lead-net-affinity/pkg/metrics"
+	promc "lead-net-affinity/pkg/prometheus"
+	"lead-net-affinity/pkg/rbac"
+)
+
+// Effectiveness is the response of GET /effectiveness: how much of the
+// traffic on the top-ranked paths crosses node and zone boundaries, over
+// time and per decision epoch, to show whether the generated affinity
+// actually keeps that traffic local.
+type Effectiveness struct {
+	Samples []EffectivenessSample `json:"samples"`
+	Epochs  []EffectivenessEpoch  `json:"epochs"`
+
+	// CrossNodeChange is the byte-weighted cross-node fraction of the
+	// latest epoch minus that of the first one recorded; negative means
+	// less cross-node traffic than before.
+	CrossNodeChange *float64 `json:"crossNodeChange,omitempty"`
+}
+
+// EffectivenessSample is one full reconcile's measurement. Traffic is
+// attributed to the epoch whose rules were in place while it was measured.
+type EffectivenessSample struct {
+	Time        time.Time `json:"time"`
+	Epoch       int       `json:"epoch"`
+	Edges       int       `json:"edges"` // critical-path edges with traffic and placed pods
+	BytesPerSec float64   `json:"bytesPerSec"`
+
+	CrossNodeFraction float64  `json:"crossNodeFraction"`
+	CrossZoneFraction *float64 `json:"crossZoneFraction,omitempty"` // omitted if no zones are known
+}
+
+// EffectivenessEpoch is a period in which the generated affinity rules
+// (service, peer and topology key; not weights) stayed the same. Epoch 0
+// covers the rules found before the controller's first decision.
+type EffectivenessEpoch struct {
+	Epoch      int       `json:"epoch"`
+	DecisionID string    `json:"decisionId,omitempty"` // the decision that began the epoch
+	Start      time.Time `json:"start"`
+	Samples    int       `json:"samples"`
+
+	// Byte-weighted over the epoch's samples.
+	CrossNodeFraction float64  `json:"crossNodeFraction"`
+	CrossZoneFraction *float64 `json:"crossZoneFraction,omitempty"`
+
+	bytes, crossNode, zoneBytes, crossZone float64
+}
+
+type effectivenessStore struct {
+	mu      sync.RWMutex
+	size    int
+	samples *history.Ring[EffectivenessSample]
+	epochs  []EffectivenessEpoch // at most size, oldest first
+	rules   string               // rule fingerprint of the current epoch, "" before the first decision
+	started bool
+}
+
+// Effectiveness returns the recorded samples and epochs.
+func (c *Controller) Effectiveness() Effectiveness {
+	s := &c.effectiveness
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := Effectiveness{Samples: []EffectivenessSample{}, Epochs: append([]EffectivenessEpoch{}, s.epochs...)}
+	if s.samples != nil {
+		out.Samples = s.samples.Snapshot()
+	}
+	var first, last *EffectivenessEpoch
+	for i := range out.Epochs {
+		if out.Epochs[i].Samples == 0 {
+			continue
+		}
+		if first == nil {
+			first = &out.Epochs[i]
+		}
+		last = &out.Epochs[i]
+	}
+	if first != nil && last != first {
+		d := last.CrossNodeFraction - first.CrossNodeFraction
+		out.CrossNodeChange = &d
+	}
+	return out
+}
+
+// recordEffectiveness measures the cross-node and cross-zone share of the
+// traffic on the edges of paths (the top-ranked ones) and then advances the
+// decision epoch if the affinity just recorded by recordDecisions changed.
+//
+// Which pod talks to which is not observable from per-service byte
+// counters, so each edge's traffic is assumed to be spread evenly over the
+// pod pairs: an edge whose caller has share p(n) of its pods on node n and
+// whose callee has share q(n) stays on a node for sum p(n)*q(n) of its bytes.
+func (c *Controller) recordEffectiveness(ctx context.Context, paths []graph.Path) {
+	query := c.cfg.Prometheus.ServicePairBytesQuery
+	f, ok := c.prom.(bytesFetcher)
+	if query == "" || !ok {
+		return
+	}
+	s := &c.effectiveness
+	decision := c.Decisions()
+	rules := affinityRules(decision)
+
+	sample := EffectivenessSample{Time: time.Now()}
+	measured := false
+	if m, err := f.FetchServicePairBytes(ctx, query, c.cfg.Prometheus.ServicePairSrcLabel, c.cfg.Prometheus.ServicePairDstLabel); err != nil {
+		c.infof("warning: failed to fetch service pair bytes; no effectiveness sample: %v", err)
+	} else {
+		var nodes kube.NodeGetter
+		if c.caps.Has(rbac.FeatureNodes) {
+			nodes = c.k8s
+		}
+		idx := kube.BuildPlacementIndex(ctx, c.k8s, nodes, c.cfg.NamespaceSelector, c.identity)
+		measured = measureCrossTraffic(&sample, paths, m, idx)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.started {
+		s.started = true
+		s.epochs = append(s.epochs, EffectivenessEpoch{Start: sample.Time})
+	}
+	cur := &s.epochs[len(s.epochs)-1]
+	if measured {
+		sample.Epoch = cur.Epoch
+		cur.add(sample)
+		if s.samples == nil {
+			size := s.size
+			if size <= 0 {
+				size = defaultHistorySize
+			}
+			s.samples = history.NewRing[EffectivenessSample](size)
+		}
+		s.samples.Push(sample)
+
+		metrics.Default.Set("lead_net_critical_path_cross_node_ratio",
+			"Share of critical-path traffic crossing nodes (estimated from pod placement).", c.metricLabels(), sample.CrossNodeFraction)
+		if sample.CrossZoneFraction != nil {
+			metrics.Default.Set("lead_net_critical_path_cross_zone_ratio",
+				"Share of critical-path traffic crossing zones (estimated from pod placement).", c.metricLabels(), *sample.CrossZoneFraction)
+		}
+		c.debugf("effectiveness: epoch=%d edges=%d bytes/s=%.0f crossNode=%.3f",
+			sample.Epoch, sample.Edges, sample.BytesPerSec, sample.CrossNodeFraction)
+	}
+
+	if rules != s.rules {
+		next := cur.Epoch + 1
+		s.rules = rules
+		s.epochs = append(s.epochs, EffectivenessEpoch{Epoch: next, DecisionID: decision.ID, Start: time.Now()})
+		if max := s.maxEpochs(); len(s.epochs) > max {
+			s.epochs = s.epochs[len(s.epochs)-max:]
+		}
+		c.infof("affinity rules changed; effectiveness epoch %d begins with decision %s", next, decision.ID)
+	}
+	metrics.Default.Set("lead_net_decision_epoch",
+		"Current decision epoch (increments whenever the generated affinity rules change).", c.metricLabels(),
+		float64(s.epochs[len(s.epochs)-1].Epoch))
+}
+
+// bytesFetcher is implemented by Prometheus clients that can query
+// per-edge byte rates.
+type bytesFetcher interface {
+	FetchServicePairBytes(ctx context.Context, query, srcLabel, dstLabel string) (*promc.ServiceBytesMatrix, error)
+}
+
+func (s *effectivenessStore) maxEpochs() int {
+	if s.size > 0 {
+		return s.size
+	}
+	return defaultHistorySize
+}
+
+func (e *EffectivenessEpoch) add(s EffectivenessSample) {
+	e.Samples++
+	e.bytes += s.BytesPerSec
+	e.crossNode += s.CrossNodeFraction * s.BytesPerSec
+	if e.bytes > 0 {
+		e.CrossNodeFraction = e.crossNode / e.bytes
+	}
+	if s.CrossZoneFraction != nil {
+		e.zoneBytes += s.BytesPerSec
+		e.crossZone += *s.CrossZoneFraction * s.BytesPerSec
+		if e.zoneBytes > 0 {
+			z := e.crossZone / e.zoneBytes
+			e.CrossZoneFraction = &z
+		}
+	}
+}
+
+// measureCrossTraffic fills s from the distinct edges of paths. It reports
+// false if no edge had both traffic and placed pods.
+func measureCrossTraffic(s *EffectivenessSample, paths []graph.Path, m *promc.ServiceBytesMatrix, idx *kube.PlacementIndex) bool {
+	seen := make(map[promc.ServicePair]bool)
+	var crossNode, zoneBytes, crossZone float64
+	for _, p := range paths {
+		for i := 0; i+1 < len(p.Nodes); i++ {
+			src, dst := p.Nodes[i], p.Nodes[i+1]
+			pair := promc.ServicePair{Src: string(src), Dst: string(dst)}
+			if seen[pair] {
+				continue
+			}
+			seen[pair] = true
+			b, ok := m.Bytes(pair.Src, pair.Dst)
+			srcNodes, dstNodes := idx.NodesForService(src), idx.NodesForService(dst)
+			if !ok || b <= 0 || len(srcNodes) == 0 || len(dstNodes) == 0 {
+				continue
+			}
+			s.Edges++
+			s.BytesPerSec += b
+			crossNode += b * (1 - colocated(srcNodes, dstNodes, func(n string) string { return n }))
+			if zoned(srcNodes, idx) && zoned(dstNodes, idx) {
+				zoneBytes += b
+				crossZone += b * (1 - colocated(srcNodes, dstNodes, idx.ZoneForNode))
+			}
+		}
+	}
+	if s.BytesPerSec == 0 {
+		return false
+	}
+	s.CrossNodeFraction = crossNode / s.BytesPerSec
+	if zoneBytes > 0 {
+		z := crossZone / zoneBytes
+		s.CrossZoneFraction = &z
+	}
+	return true
+}
+
+// colocated returns the probability that a random pod of a and a random pod
+// of b share a domain (node or zone, as mapped by domain).
+func colocated(a, b map[string]int, domain func(node string) string) float64 {
+	share := func(nodes map[string]int) map[string]float64 {
+		total := 0
+		for _, n := range nodes {
+			total += n
+		}
+		out := make(map[string]float64)
+		for node, n := range nodes {
+			out[domain(node)] += float64(n) / float64(total)
+		}
+		return out
+	}
+	sa, sb := share(a), share(b)
+	p := 0.0
+	for d, v := range sa {
+		p += v * sb[d]
+	}
+	return p
+}
+
+func zoned(nodes map[string]int, idx *kube.PlacementIndex) bool {
+	for n := range nodes {
+		if idx.ZoneForNode(n) == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// affinityRules fingerprints the generated affinity by its rules, leaving
+// out weights, which move with the scores every reconcile.
+func affinityRules(d Decisions) string {
+	var b strings.Builder
+	for _, sa := range d.Affinity {
+		for _, p := range sa.Peers {
+			b.WriteString(sa.Service + ">" + p.Service + "@" + p.TopologyKey + ";")
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,24 @@
+package controller
+
+import (
+	"errors"
+
+	promc "lead-net-affinity/pkg/prometheus"
+)
+
+// Errors reconciles wrap with detail, for callers to tell apart with
+// errors.Is:
+//   - ErrGraphEmpty aborts the reconcile: there is nothing to score, and
+//     retrying will not help until the graph configuration changes.
+//   - ErrNoPaths means nothing to do. A full reconcile counts it as a
+//     success; a scoped one returns it, as the scope matched no path.
+//   - ErrPrometheusUnavailable is retried per query; if it persists the
+//     reconcile degrades to cached metrics instead of failing.
+//   - ErrUnschedulable skips rebalancing: evicted pods would have no node
+//     to go to.
+var (
+	ErrGraphEmpty            = errors.New("service graph is empty")
+	ErrNoPaths               = errors.New("no paths from the entry service")
+	ErrPrometheusUnavailable = promc.ErrUnavailable
+	ErrUnschedulable         = errors.New("no schedulable node")
+)
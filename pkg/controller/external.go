@@ -0,0 +1,64 @@
+package controller
+
+import (
+	appsv1 "k8s.io/api/apps/v1"
+
+	"lead-net-affinity/pkg/config"
+	"lead-net-affinity/pkg/graph"
+	"lead-net-affinity/pkg/rulegen"
+)
+
+// applyExternalZones gives every service calling external services (see
+// config.ExternalEndpoint) node affinity toward the zones closest to them,
+// as they have no pods to be co-located with. The weights of several
+// external dependencies and of the service's zone plan add up, capped at
+// 100.
+func (c *Controller) applyExternalZones(g *graph.Graph, deploysBySvc map[graph.NodeID]*appsv1.Deployment) {
+	externals := make(map[graph.NodeID]*config.ExternalEndpoint)
+	for _, s := range c.cfg.Graph.Services {
+		if s.External != nil {
+			externals[graph.NodeID(s.Name)] = s.External
+		}
+	}
+	if len(externals) == 0 {
+		return
+	}
+	for svc, d := range deploysBySvc {
+		n := g.Nodes[svc]
+		if n == nil || n.External {
+			continue
+		}
+		weights := make(map[string]int32)
+		for _, dep := range n.DependsOn {
+			if e, ok := externals[dep]; ok {
+				addZoneWeights(weights, e.ZoneWeights())
+			}
+		}
+		if len(weights) == 0 {
+			continue
+		}
+		addZoneWeights(weights, c.zonePlanWeights(svc))
+		rulegen.PreferZones(d, weights)
+		c.debugf("service %s prefers zones %v toward its external dependencies", svc, weights)
+	}
+}
+
+func addZoneWeights(into, from map[string]int32) {
+	for z, w := range from {
+		into[z] = min(into[z]+w, 100)
+	}
+}
+
+// zonePlanWeights returns the node affinity weights of svc's zone plan, nil
+// without one.
+func (c *Controller) zonePlanWeights(svc graph.NodeID) map[string]int32 {
+	if !c.cfg.Affinity.ZonePlan.Enabled {
+		return nil
+	}
+	c.zonePlans.mu.RLock()
+	defer c.zonePlans.mu.RUnlock()
+	if p, ok := c.zonePlans.plans[svc]; ok {
+		return p.weights()
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package controller
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"lead-net-affinity/pkg/forecast"
+	"lead-net-affinity/pkg/graph"
+	"lead-net-affinity/pkg/metrics"
+	promc "lead-net-affinity/pkg/prometheus"
+)
+
+// ServiceForecast is a service's predicted inbound request rate.
+type ServiceForecast struct {
+	Service    string  `json:"service"`
+	CurrentRPS float64 `json:"currentRPS"` // last measured inbound rate
+	Hours      int     `json:"hours"`      // complete hours observed
+
+	// NextHourRPS is the predicted mean of the next hour and Model the
+	// model predicting it (holt-winters, or holt before two seasons are
+	// observed); both omitted before two complete hours.
+	NextHourRPS *float64 `json:"nextHourRPS,omitempty"`
+	Model       string   `json:"model,omitempty"`
+}
+
+// ForecastReport is the response of GET /forecast.
+type ForecastReport struct {
+	Enabled  bool              `json:"enabled"`
+	Time     time.Time         `json:"time"`
+	Services []ServiceForecast `json:"services"`
+}
+
+// forecastStore keeps an hourly series of each service's inbound rate, for
+// at most caches.maxServices services, and the forecasts of the last
+// observation.
+type forecastStore struct {
+	mu        sync.RWMutex
+	series    map[graph.NodeID]*forecast.Series
+	last      map[graph.NodeID]time.Time
+	time      time.Time
+	forecasts map[graph.NodeID]ServiceForecast
+}
+
+// observeForecast adds the measured inbound rate of each service of g to
+// its series and forecasts the next hour.
+func (c *Controller) observeForecast(g *graph.Graph, edgeRPS *promc.ServiceRPSMatrix, now time.Time) {
+	fc := c.cfg.Forecast
+	if !fc.Enabled || edgeRPS == nil {
+		return
+	}
+	alpha, beta, gamma := fc.SmoothingOrDefault()
+	params := forecast.Params{Alpha: alpha, Beta: beta, Gamma: gamma, Season: fc.SeasonOrDefault()}
+
+	s := &c.forecast
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.series == nil {
+		s.series = make(map[graph.NodeID]*forecast.Series)
+		s.last = make(map[graph.NodeID]time.Time)
+		s.forecasts = make(map[graph.NodeID]ServiceForecast)
+	}
+	for id := range g.Nodes {
+		rps := inboundRPS(edgeRPS, id)
+		if rps == nil {
+			continue
+		}
+		series, ok := s.series[id]
+		if !ok {
+			series = forecast.NewSeries(fc.HistoryOrDefault())
+			s.series[id] = series
+		}
+		series.Add(now, *rps)
+		s.last[id] = now
+
+		f := ServiceForecast{Service: string(id), CurrentRPS: *rps, Hours: len(series.Hours())}
+		if v, model, ok := series.Forecast(params, now.Add(time.Hour)); ok {
+			f.NextHourRPS, f.Model = &v, model
+			metrics.Default.Set("lead_net_forecast_rps", "Inbound request rate forecast for a service's next hour.", c.forecastLabels(id), v)
+		}
+		s.forecasts[id] = f
+	}
+	for _, id := range evictOldest(s.last, c.cfg.Caches.ServicesOrDefault(), func(t time.Time) time.Time { return t }, func(a, b graph.NodeID) bool { return a < b }) {
+		delete(s.series, id)
+		delete(s.forecasts, id)
+		metrics.Default.Delete("lead_net_forecast_rps", c.forecastLabels(id))
+	}
+	s.time = now
+}
+
+func (c *Controller) forecastLabels(svc graph.NodeID) map[string]string {
+	labels := map[string]string{"service": string(svc)}
+	for k, v := range c.metricLabels() {
+		labels[k] = v
+	}
+	return labels
+}
+
+// forecastRPS returns the next hour's predicted inbound rate of svc, if
+// forecasting is enabled and has one.
+func (c *Controller) forecastRPS(svc graph.NodeID) (ServiceForecast, bool) {
+	if !c.cfg.Forecast.Enabled {
+		return ServiceForecast{}, false
+	}
+	c.forecast.mu.RLock()
+	defer c.forecast.mu.RUnlock()
+	f, ok := c.forecast.forecasts[svc]
+	return f, ok && f.NextHourRPS != nil
+}
+
+// pathForecastRPS is the highest next-hour forecast among p's services:
+// the load the path must carry when the hour peaks. 0 without forecasts.
+func (c *Controller) pathForecastRPS(p graph.Path) float64 {
+	var out float64
+	for _, svc := range p.Nodes {
+		if f, ok := c.forecastRPS(svc); ok {
+			out = max(out, *f.NextHourRPS)
+		}
+	}
+	return out
+}
+
+// Forecast returns the forecasts of the last full reconcile.
+func (c *Controller) Forecast() ForecastReport {
+	c.forecast.mu.RLock()
+	defer c.forecast.mu.RUnlock()
+	out := ForecastReport{Enabled: c.cfg.Forecast.Enabled, Time: c.forecast.time, Services: []ServiceForecast{}}
+	for _, f := range c.forecast.forecasts {
+		out.Services = append(out.Services, f)
+	}
+	sort.Slice(out.Services, func(i, j int) bool { return out.Services[i].Service < out.Services[j].Service })
+	return out
+}
@@ -0,0 +1,198 @@
+package controller
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"lead-net-affinity/pkg/history"
+	"lead-net-affinity/pkg/metrics"
+)
+
+// gatewayFetcher is implemented by Prometheus clients that can query the
+// entry-point latency (prometheus.gateway).
+type gatewayFetcher interface {
+	FetchGatewayLatency(ctx context.Context, query, unit string) (float64, bool, error)
+}
+
+// GatewayHealth is the user-facing latency measured at the ingress
+// controller against slo.gatewayLatencyMs, judged like a path objective.
+type GatewayHealth struct {
+	Status        string   `json:"status"`
+	LatencyMs     *float64 `json:"latencyMs,omitempty"` // omitted if this reconcile had no measurement
+	ObjectiveMs   float64  `json:"objectiveMs,omitempty"`
+	BurnRate      *float64 `json:"burnRate,omitempty"`
+	WindowSamples int      `json:"windowSamples,omitempty"`
+}
+
+// GatewaySample is one reconcile's entry-point latency.
+type GatewaySample struct {
+	Time      time.Time `json:"time"`
+	LatencyMs float64   `json:"latencyMs"`
+}
+
+type gatewayStore struct {
+	mu      sync.RWMutex
+	size    int
+	samples *history.Ring[GatewaySample]
+	last    *float64 // this reconcile's latency, nil if not measured
+}
+
+// fetchGatewayLatency measures the entry-point latency, records it and
+// returns it in ms, or nil if prometheus.gateway is off or returned no data.
+func (c *Controller) fetchGatewayLatency(ctx context.Context) *float64 {
+	gw := c.cfg.Prometheus.Gateway
+	f, ok := c.prom.(gatewayFetcher)
+	if !gw.Enabled() || !ok {
+		return nil
+	}
+	s := &c.gateway
+	var last *float64
+	ms, ok, err := f.FetchGatewayLatency(ctx, gw.LatencyQuery, gw.LatencyUnit)
+	switch {
+	case err != nil:
+		c.infof("warning: failed to fetch gateway latency: %v", err)
+	case !ok:
+		c.infof("warning: gateway latency query returned no data")
+	default:
+		last = &ms
+		metrics.Default.Set("lead_net_gateway_latency_ms", "User-facing latency at the entry point (prometheus.gateway) in ms.", c.metricLabels(), ms)
+		c.debugf("gateway latency: %.1fms", ms)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.last = last
+	if last != nil {
+		if s.samples == nil {
+			size := s.size
+			if size <= 0 {
+				size = defaultHistorySize
+			}
+			s.samples = history.NewRing[GatewaySample](size)
+		}
+		s.samples.Push(GatewaySample{Time: time.Now(), LatencyMs: ms})
+	}
+	return last
+}
+
+// gatewayHealth judges the gateway against slo.gatewayLatencyMs over the
+// slo.windowSamples latest samples; nil if prometheus.gateway is off.
+func (c *Controller) gatewayHealth() *GatewayHealth {
+	if !c.cfg.Prometheus.Gateway.Enabled() {
+		return nil
+	}
+	s := &c.gateway
+	s.mu.RLock()
+	var samples []GatewaySample
+	if s.samples != nil {
+		samples = s.samples.Snapshot()
+	}
+	gh := &GatewayHealth{Status: HealthUnknown, LatencyMs: s.last, ObjectiveMs: c.cfg.SLO.GatewayLatencyMs}
+	s.mu.RUnlock()
+
+	if gh.LatencyMs != nil {
+		gh.Status = HealthHealthy
+	}
+	if gh.ObjectiveMs <= 0 {
+		return gh
+	}
+	if gh.LatencyMs != nil && *gh.LatencyMs > gh.ObjectiveMs {
+		gh.Status = HealthDegraded
+	}
+	if n := c.cfg.SLO.WindowSamples; n > 0 && len(samples) > n {
+		samples = samples[len(samples)-n:]
+	}
+	if len(samples) == 0 {
+		return gh
+	}
+	missed := 0
+	for _, smp := range samples {
+		if smp.LatencyMs > gh.ObjectiveMs {
+			missed++
+		}
+	}
+	gh.WindowSamples = len(samples)
+	burn := float64(missed) / float64(len(samples)) / (1 - c.cfg.SLO.TargetOrDefault())
+	gh.BurnRate = &burn
+	if burn > 1 {
+		gh.Status = worseHealth(gh.Status, HealthUnhealthy)
+	}
+	metrics.Default.Set("lead_net_gateway_error_budget_burn_rate", "Error budget burn rate of the gateway latency objective.", c.metricLabels(), burn)
+	return gh
+}
+
+// gatewayCorrelation is the Pearson correlation between a path's final
+// score and the gateway latency over the samples carrying both; nil with
+// fewer than 3 such samples or no variation.
+func gatewayCorrelation(samples []PathSample) *float64 {
+	var xs, ys []float64
+	for _, s := range samples {
+		if s.GatewayLatencyMs != nil {
+			xs = append(xs, s.FinalScore)
+			ys = append(ys, *s.GatewayLatencyMs)
+		}
+	}
+	if len(xs) < 3 {
+		return nil
+	}
+	n := float64(len(xs))
+	var mx, my float64
+	for i := range xs {
+		mx += xs[i] / n
+		my += ys[i] / n
+	}
+	var cov, vx, vy float64
+	for i := range xs {
+		dx, dy := xs[i]-mx, ys[i]-my
+		cov += dx * dy
+		vx += dx * dx
+		vy += dy * dy
+	}
+	if vx == 0 || vy == 0 {
+		return nil
+	}
+	r := cov / math.Sqrt(vx*vy)
+	return &r
+}
+
+// fetchGatewayOrigin returns the user request rate per cluster zone from
+// prometheus.gateway.origin, mapping its label values through
+// origin.zones; nil if the query is unset or failed.
+func (c *Controller) fetchGatewayOrigin(ctx context.Context) map[string]float64 {
+	o := c.cfg.Prometheus.Gateway.Origin
+	if o.Query == "" {
+		return nil
+	}
+	f, ok := c.prom.(serviceValueFetcher)
+	if !ok {
+		c.infof("warning: gateway origin needs per-label queries, which this Prometheus client does not support")
+		return nil
+	}
+	values, err := f.FetchServiceValues(ctx, "gateway origin", o.Query, o.LabelOrDefault())
+	if err != nil {
+		c.infof("warning: failed to fetch gateway origin: %v", err)
+		return nil
+	}
+	out := make(map[string]float64, len(values))
+	for v, rps := range values {
+		zone := v
+		if z, ok := o.Zones[v]; ok {
+			zone = z
+		}
+		if rps > 0 {
+			out[zone] += rps
+		}
+	}
+	metrics.Default.Reset("lead_net_gateway_origin_rps")
+	for zone, rps := range out {
+		labels := map[string]string{"zone": zone}
+		for k, v := range c.metricLabels() {
+			labels[k] = v
+		}
+		metrics.Default.Set("lead_net_gateway_origin_rps", "User request rate at the entry point by client zone (prometheus.gateway.origin).", labels, rps)
+	}
+	c.debugf("gateway origin: %v", out)
+	return out
+}
@@ -0,0 +1,274 @@
+package controller
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"lead-net-affinity/pkg/graph"
+	"lead-net-affinity/pkg/kube"
+	"lead-net-affinity/pkg/metrics"
+	promc "lead-net-affinity/pkg/prometheus"
+	"lead-net-affinity/pkg/scoring"
+)
+
+// Health states, from best to worst.
+const (
+	HealthHealthy   = "healthy"
+	HealthUnknown   = "unknown" // no node metrics and no edge latencies
+	HealthDegraded  = "degraded"
+	HealthUnhealthy = "unhealthy"
+)
+
+var healthOrder = map[string]int{HealthHealthy: 0, HealthUnknown: 1, HealthDegraded: 2, HealthUnhealthy: 3}
+
+func worseHealth(a, b string) string {
+	if healthOrder[b] > healthOrder[a] {
+		return b
+	}
+	return a
+}
+
+// HealthSummary is the response of GET /health-summary.
+type HealthSummary struct {
+	Time     time.Time       `json:"time"`
+	Status   string          `json:"status"` // worst path or gateway status
+	Services []ServiceHealth `json:"services"`
+	Paths    []PathHealth    `json:"paths"` // by rank
+
+	// Gateway is the user-facing latency at the entry point, the primary
+	// objective when prometheus.gateway is configured.
+	Gateway *GatewayHealth `json:"gateway,omitempty"`
+}
+
+// ServiceHealth is a service's health: unhealthy on a bad node, without
+// ready replicas or with every pod failing its health checks, degraded on
+// a node above a network threshold, with replicas not ready or failing
+// health checks or with a call slower than the callee's edge latency
+// threshold (thresholds[] or scoring.badEdgeLatencyMs).
+type ServiceHealth struct {
+	Service      string   `json:"service"`
+	Status       string   `json:"status"`
+	Node         string   `json:"node,omitempty"`
+	NodeSeverity float64  `json:"nodeSeverity,omitempty"` // scoring.NodeSeverityFromMetrics
+	Reasons      []string `json:"reasons,omitempty"`
+
+	// Replicas are the service's active pods; ReadyRatio is the share of
+	// them that can serve traffic. Both are omitted without pods.
+	Replicas   *kube.Replicas `json:"replicas,omitempty"`
+	ReadyRatio *float64       `json:"readyRatio,omitempty"`
+
+	// Probe is the result of the active health checks (healthChecks.*):
+	// degraded if some pods fail them, unhealthy if all do.
+	Probe *ProbeResult `json:"probe,omitempty"`
+}
+
+// replicaCounter is implemented by placements that know how many of a
+// service's pods are ready (kube.PlacementResolver).
+type replicaCounter interface {
+	Replicas(svc graph.NodeID) kube.Replicas
+}
+
+// PathHealth rolls a path's services and its latency objective (slo.*) up.
+// A path missing its objective now is degraded; one burning its error
+// budget faster than allowed (burnRate > 1) is unhealthy.
+type PathHealth struct {
+	Path          string   `json:"path"`
+	Rank          int      `json:"rank"`
+	Status        string   `json:"status"`
+	WorstService  string   `json:"worstService,omitempty"`  // first service in the worst state, unless all are healthy
+	LatencyMs     *float64 `json:"latencyMs,omitempty"`     // sum of edge latencies, when all are measured
+	ObjectiveMs   float64  `json:"objectiveMs,omitempty"`   // slo.pathLatencyMs or slo.paths[path]
+	BurnRate      *float64 `json:"burnRate,omitempty"`      // share of samples missing the objective / (1 - slo.target)
+	WindowSamples int      `json:"windowSamples,omitempty"` // samples the burn rate covers
+}
+
+// healthStore publishes each reconcile's summary for lock-free reads.
+type healthStore struct {
+	last atomic.Pointer[HealthSummary]
+}
+
+// HealthSummary returns the health summary of the last reconcile.
+func (c *Controller) HealthSummary() HealthSummary {
+	if p := c.health.last.Load(); p != nil {
+		return *p
+	}
+	return HealthSummary{}
+}
+
+// recordHealth builds the health summary from the metrics of this
+// reconcile and the path history, and samples it into the service
+// history; call it after recordPathHistory.
+func (c *Controller) recordHealth(
+	g *graph.Graph,
+	paths []graph.Path,
+	placements scoring.PodPlacement,
+	nm *promc.NetworkMatrix,
+	ipResolver scoring.NodeIPResolver,
+	svcLat *promc.ServiceLatencyMatrix,
+	edgeRPS *promc.ServiceRPSMatrix,
+	netWeights scoring.NetWeights,
+	thresholds serviceThresholds,
+	badNodes []string,
+	probes map[graph.NodeID]*ProbeResult,
+) {
+	bad := make(map[string]bool, len(badNodes))
+	for _, n := range badNodes {
+		bad[n] = true
+	}
+
+	sum := HealthSummary{Time: time.Now(), Status: HealthHealthy, Services: []ServiceHealth{}, Paths: []PathHealth{}}
+	bySvc := make(map[graph.NodeID]ServiceHealth, len(g.Nodes))
+	samples := make(map[graph.NodeID]ServiceSample, len(g.Nodes))
+	for id, n := range g.Nodes {
+		sh := ServiceHealth{Service: string(id), Status: HealthUnknown}
+		var callLat *float64
+		measured := false
+		// With pods on several nodes, the worst node (scoring.nodeAggregation)
+		// speaks for the service; it is unhealthy once all its nodes are bad.
+		nodes := scoring.ServiceNodes(placements, id)
+		badCount := 0
+		if len(nodes) > 0 {
+			sh.Node = kube.MainNode(nodes)
+			w := netWeights
+			w.BadLatencyMs = thresholds.nodeLatencyMs(id)
+			if sev, worst := scoring.AggregateNodeSeverity(nodes, nm, ipResolver, w); worst != "" {
+				measured = true
+				sh.Node, sh.NodeSeverity = worst, sev
+				if sev > 0 {
+					sh.Reasons = append(sh.Reasons, "node "+worst+" above a network threshold")
+				}
+			}
+			for _, node := range slices.Sorted(maps.Keys(nodes)) {
+				if bad[node] {
+					badCount++
+					sh.Reasons = append(sh.Reasons, "node "+node+" is bad")
+				}
+			}
+		}
+		down := false // no pod can serve
+		if rc, ok := placements.(replicaCounter); ok {
+			r := rc.Replicas(id)
+			if ratio, ok := r.ReadyRatio(); ok {
+				measured = true
+				sh.Replicas, sh.ReadyRatio = &r, &ratio
+				if r.NotReady > 0 {
+					down = r.Ready == 0
+					sh.Reasons = append(sh.Reasons, fmt.Sprintf("%d/%d replicas ready", r.Ready, r.Total()))
+				}
+				labels := map[string]string{"service": string(id)}
+				for k, v := range c.metricLabels() {
+					labels[k] = v
+				}
+				metrics.Default.Set("lead_net_service_ready_ratio", "Share of a service's active pods that are ready.", labels, ratio)
+			}
+		}
+		if r := probes[id]; r != nil && r.Probed > 0 {
+			measured = true
+			sh.Probe = r
+			if r.Healthy < r.Probed {
+				down = down || r.Healthy == 0
+				sh.Reasons = append(sh.Reasons, probeReason(r))
+			}
+		}
+		for _, dep := range n.DependsOn {
+			lat, ok := svcLat.Latency(string(id), string(dep))
+			if !ok {
+				continue
+			}
+			measured = true
+			if callLat == nil || lat > *callLat {
+				callLat = &lat
+			}
+			if t := thresholds.edgeLatencyMs(dep); t > 0 && lat > t {
+				sh.Reasons = append(sh.Reasons, "slow call to "+string(dep))
+			}
+		}
+		switch {
+		case badCount > 0 && badCount == len(nodes), down:
+			sh.Status = HealthUnhealthy
+		case len(sh.Reasons) > 0:
+			sh.Status = HealthDegraded
+		case measured:
+			sh.Status = HealthHealthy
+		}
+		bySvc[id] = sh
+		sum.Services = append(sum.Services, sh)
+		samples[id] = ServiceSample{
+			Time: sum.Time, Status: sh.Status, NodeSeverity: sh.NodeSeverity,
+			Replicas: sh.Replicas, ReadyRatio: sh.ReadyRatio, CallLatencyMs: callLat,
+			InboundRPS: inboundRPS(edgeRPS, id),
+		}
+	}
+	sort.Slice(sum.Services, func(i, j int) bool { return sum.Services[i].Service < sum.Services[j].Service })
+
+	for i, p := range paths {
+		ph := PathHealth{Path: PathID(p), Rank: i + 1, Status: HealthHealthy}
+		for _, svc := range p.Nodes {
+			if s := bySvc[svc].Status; healthOrder[s] > healthOrder[ph.Status] {
+				ph.Status, ph.WorstService = s, string(svc)
+			}
+		}
+		if lat, ok := predictedLatency(p, svcLat); ok {
+			ph.LatencyMs = &lat
+		}
+		c.applyObjective(&ph)
+		sum.Paths = append(sum.Paths, ph)
+		sum.Status = worseHealth(sum.Status, ph.Status)
+
+		labels := map[string]string{"path": ph.Path}
+		for k, v := range c.metricLabels() {
+			labels[k] = v
+		}
+		metrics.Default.Set("lead_net_path_health", "Path health of the last reconcile: 0 healthy, 1 unknown, 2 degraded, 3 unhealthy.", labels, float64(healthOrder[ph.Status]))
+		if ph.BurnRate != nil {
+			metrics.Default.Set("lead_net_path_error_budget_burn_rate", "Error budget burn rate of a path's latency objective.", labels, *ph.BurnRate)
+		}
+	}
+
+	if sum.Gateway = c.gatewayHealth(); sum.Gateway != nil {
+		sum.Status = worseHealth(sum.Status, sum.Gateway.Status)
+	}
+
+	c.health.last.Store(&sum)
+	c.services.record(samples, c.cfg.Caches.ServicesOrDefault())
+}
+
+// applyObjective compares the path with its latency objective now and over
+// the path history window.
+func (c *Controller) applyObjective(ph *PathHealth) {
+	slo := c.cfg.SLO
+	ph.ObjectiveMs = slo.LatencyObjective(ph.Path)
+	if ph.ObjectiveMs <= 0 {
+		return
+	}
+	if ph.LatencyMs != nil && *ph.LatencyMs > ph.ObjectiveMs {
+		ph.Status = worseHealth(ph.Status, HealthDegraded)
+	}
+
+	samples, _ := c.history.get(ph.Path)
+	if n := slo.WindowSamples; n > 0 && len(samples) > n {
+		samples = samples[len(samples)-n:]
+	}
+	missed := 0
+	for _, s := range samples {
+		if s.PredictedLatencyMs == nil {
+			continue
+		}
+		ph.WindowSamples++
+		if *s.PredictedLatencyMs > ph.ObjectiveMs {
+			missed++
+		}
+	}
+	if ph.WindowSamples == 0 {
+		return
+	}
+	burn := float64(missed) / float64(ph.WindowSamples) / (1 - slo.TargetOrDefault())
+	ph.BurnRate = &burn
+	if burn > 1 {
+		ph.Status = worseHealth(ph.Status, HealthUnhealthy)
+	}
+}
@@ -0,0 +1,201 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"lead-net-affinity/pkg/config"
+	"lead-net-affinity/pkg/graph"
+	"lead-net-affinity/pkg/kube"
+	"lead-net-affinity/pkg/metrics"
+	"lead-net-affinity/pkg/probe"
+	"lead-net-affinity/pkg/supervise"
+)
+
+// maxConcurrentProbes bounds the health checks in flight per reconcile.
+const maxConcurrentProbes = 16
+
+// ProbeResult is the outcome of a reconcile's active health checks of one
+// service's running pods (healthChecks.*).
+type ProbeResult struct {
+	Protocol string   `json:"protocol"`
+	Port     int32    `json:"port"`
+	Probed   int      `json:"probed"`
+	Healthy  int      `json:"healthy"`
+	Errors   []string `json:"errors,omitempty"` // one per failed pod, sorted
+}
+
+// probeTarget is how a service is checked.
+type probeTarget struct {
+	protocol, path, grpcService string
+	port                        int32
+}
+
+// probeServices health-checks the running pods of every service in g that
+// has a probe target, or returns nil if healthChecks are off.
+func (c *Controller) probeServices(ctx context.Context, g *graph.Graph, namespaces []string) map[graph.NodeID]*ProbeResult {
+	if c.prober == nil {
+		return nil
+	}
+	type job struct {
+		svc    graph.NodeID
+		target probeTarget
+		pod    *corev1.Pod
+	}
+	var jobs []job
+	out := make(map[graph.NodeID]*ProbeResult)
+	ports := c.servicePorts()
+	for id, n := range g.Nodes {
+		ps := n.Ports
+		if len(ps) == 0 {
+			ps = ports[id]
+		}
+		t, ok := c.probeTarget(id, ps)
+		if !ok {
+			continue
+		}
+		for _, ns := range namespaces {
+			pods, err := c.identity.ListServicePods(ctx, c.k8s, ns, id)
+			if err != nil {
+				c.infof("warning: health checks: failed to list pods of %s in %s: %v", id, ns, err)
+				continue
+			}
+			for i := range pods {
+				p := &pods[i]
+				if p.Status.Phase != corev1.PodRunning || p.Status.PodIP == "" || !kube.PodActive(p) {
+					continue
+				}
+				jobs = append(jobs, job{svc: id, target: t, pod: p})
+			}
+		}
+		out[id] = &ProbeResult{Protocol: t.protocol, Port: t.port}
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, maxConcurrentProbes)
+	for _, j := range jobs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			err := supervise.Recover("health-check", c.metricLabels(), func() error {
+				return c.probePod(ctx, j.target, j.pod.Status.PodIP)
+			})
+			mu.Lock()
+			defer mu.Unlock()
+			r := out[j.svc]
+			r.Probed++
+			if err != nil {
+				r.Errors = append(r.Errors, j.pod.Name+": "+err.Error())
+				return
+			}
+			r.Healthy++
+		}()
+	}
+	wg.Wait()
+
+	for id, r := range out {
+		sort.Strings(r.Errors)
+		if r.Probed == 0 {
+			continue
+		}
+		labels := map[string]string{"service": string(id)}
+		for k, v := range c.metricLabels() {
+			labels[k] = v
+		}
+		metrics.Default.Set("lead_net_service_probe_healthy_ratio", "Share of a service's running pods passing active health checks.",
+			labels, float64(r.Healthy)/float64(r.Probed))
+		c.debugf("health checks of %s (%s :%d): %d/%d healthy", id, r.Protocol, r.Port, r.Healthy, r.Probed)
+	}
+	return out
+}
+
+func (c *Controller) probePod(ctx context.Context, t probeTarget, ip string) error {
+	addr := net.JoinHostPort(ip, strconv.Itoa(int(t.port)))
+	if t.protocol == probe.ProtocolGRPC {
+		return c.prober.GRPC(ctx, addr, t.grpcService)
+	}
+	return c.prober.HTTP(ctx, "http://"+addr+t.path)
+}
+
+// probeTarget picks how svc is checked: its healthChecks.services entry,
+// filled in from its ports (the first gRPC one, else the first HTTP one).
+// It reports false if the service is not to be checked.
+func (c *Controller) probeTarget(svc graph.NodeID, ports []graph.Port) (probeTarget, bool) {
+	hc := c.cfg.HealthChecks
+	var o config.ServiceHealthCheck
+	for _, s := range hc.Services {
+		if s.Service == string(svc) {
+			o = s
+		}
+	}
+	if o.Disabled {
+		return probeTarget{}, false
+	}
+	t := probeTarget{protocol: o.Protocol, port: o.Port, path: o.Path, grpcService: o.GRPCService}
+	if t.port == 0 || t.protocol == "" {
+		if p, ok := probePort(ports, t.protocol, t.port); ok {
+			if t.port == 0 {
+				t.port = p.Target()
+			}
+			if t.protocol == "" && p.AppProtocol == graph.AppProtocolGRPC {
+				t.protocol = probe.ProtocolGRPC
+			}
+		}
+	}
+	if t.port == 0 {
+		return probeTarget{}, false
+	}
+	if t.protocol == "" {
+		t.protocol = probe.ProtocolHTTP
+	}
+	if t.path == "" {
+		t.path = hc.HTTPPath
+	}
+	if t.path == "" {
+		t.path = "/health"
+	}
+	return t, true
+}
+
+// probePort is the port to check among ports: the one with the given
+// container port, else the first gRPC port (unless protocol is http),
+// else the first TCP port speaking HTTP or an unknown protocol (unless
+// protocol is grpc).
+func probePort(ports []graph.Port, protocol string, port int32) (graph.Port, bool) {
+	if port != 0 {
+		for _, p := range ports {
+			if p.Target() == port {
+				return p, true
+			}
+		}
+		return graph.Port{}, false
+	}
+	for _, p := range ports {
+		if p.AppProtocol == graph.AppProtocolGRPC && protocol != probe.ProtocolHTTP {
+			return p, true
+		}
+	}
+	for _, p := range ports {
+		switch p.AppProtocol {
+		case "", graph.AppProtocolHTTP, graph.AppProtocolHTTP2:
+			if p.Transport() == graph.ProtocolTCP && protocol != probe.ProtocolGRPC {
+				return p, true
+			}
+		}
+	}
+	return graph.Port{}, false
+}
+
+// probeReason describes failing health checks for ServiceHealth.Reasons.
+func probeReason(r *ProbeResult) string {
+	return fmt.Sprintf("%d/%d pods failing %s health checks", r.Probed-r.Healthy, r.Probed, r.Protocol)
+}
@@ -0,0 +1,180 @@
+package controller
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"lead-net-affinity/pkg/graph"
+	"lead-net-affinity/pkg/history"
+	"lead-net-affinity/pkg/metrics"
+	promc "lead-net-affinity/pkg/prometheus"
+)
+
+const defaultHistorySize = 120
+
+// PathSample is one reconcile's view of a path.
+type PathSample struct {
+	Time           time.Time `json:"time"`
+	Rank           int       `json:"rank"` // 1 = most critical
+	BaseScore      float64   `json:"baseScore"`
+	NetworkPenalty float64   `json:"networkPenalty"`
+	FinalScore     float64   `json:"finalScore"`
+
+	// PredictedLatencyMs sums the measured edge latencies along the path;
+	// omitted unless every edge has a measurement.
+	PredictedLatencyMs *float64 `json:"predictedLatencyMs,omitempty"`
+
+	// GatewayLatencyMs is the entry-point latency (prometheus.gateway) of
+	// the same reconcile, if measured.
+	GatewayLatencyMs *float64 `json:"gatewayLatencyMs,omitempty"`
+
+	// DecisionID is the decision in force while the sample was measured
+	// (the previous full reconcile's); empty before the first decision.
+	DecisionID string `json:"decisionId,omitempty"`
+}
+
+// PathHistory is the response of GET /paths/history?path=.
+type PathHistory struct {
+	Path    string       `json:"path"`
+	Samples []PathSample `json:"samples"`
+
+	// GatewayCorrelation is the Pearson correlation of the path's final
+	// score with the gateway latency over the samples; omitted with fewer
+	// than 3 samples carrying both.
+	GatewayCorrelation *float64 `json:"gatewayCorrelation,omitempty"`
+}
+
+// PathID identifies a path by its services joined with "-", e.g. "fe-src-prf".
+func PathID(p graph.Path) string {
+	parts := make([]string, len(p.Nodes))
+	for i, n := range p.Nodes {
+		parts[i] = string(n)
+	}
+	return strings.Join(parts, "-")
+}
+
+// pathHistory keeps a ring buffer of samples per path, for at most
+// caches.maxPaths paths (the ones recorded longest ago are evicted).
+type pathHistory struct {
+	mu    sync.RWMutex
+	size  int
+	paths map[string]*history.Ring[PathSample]
+	last  map[string]time.Time // last sample per path
+}
+
+func (h *pathHistory) record(id string, s PathSample) {
+	h.mu.Lock()
+	if h.paths == nil {
+		h.paths = make(map[string]*history.Ring[PathSample])
+	}
+	r, ok := h.paths[id]
+	if !ok {
+		size := h.size
+		if size <= 0 {
+			size = defaultHistorySize
+		}
+		r = history.NewRing[PathSample](size)
+		h.paths[id] = r
+	}
+	if h.last == nil {
+		h.last = make(map[string]time.Time)
+	}
+	h.last[id] = s.Time
+	h.mu.Unlock()
+	r.Push(s)
+}
+
+// evict drops the paths recorded longest ago until at most max remain.
+func (h *pathHistory) evict(max int) []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	evicted := evictOldest(h.last, max, func(t time.Time) time.Time { return t }, func(a, b string) bool { return a < b })
+	for _, id := range evicted {
+		delete(h.paths, id)
+	}
+	return evicted
+}
+
+func (h *pathHistory) get(id string) ([]PathSample, bool) {
+	h.mu.RLock()
+	r, ok := h.paths[id]
+	h.mu.RUnlock()
+	if !ok {
+		return nil, false
+	}
+	return r.Snapshot(), true
+}
+
+func (h *pathHistory) ids() []string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	out := make([]string, 0, len(h.paths))
+	for id := range h.paths {
+		out = append(out, id)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// PathHistory returns the recorded samples of a path (see PathID).
+func (c *Controller) PathHistory(id string) (PathHistory, bool) {
+	samples, ok := c.history.get(id)
+	return PathHistory{Path: id, Samples: samples, GatewayCorrelation: gatewayCorrelation(samples)}, ok
+}
+
+// recordPathHistory stores one sample per scored path (sorted by final
+// score), with the gateway latency gw if measured, and mirrors the scores
+// as gauges so Prometheus keeps the long-term series.
+func (c *Controller) recordPathHistory(paths []graph.Path, svcLat *promc.ServiceLatencyMatrix, gw *float64) {
+	now := time.Now()
+	decision := c.decisions.get().ID
+	for i, p := range paths {
+		id := PathID(p)
+		s := PathSample{
+			Time:           now,
+			Rank:           i + 1,
+			BaseScore:      p.BaseScore,
+			NetworkPenalty: p.NetworkPenalty,
+			FinalScore:     p.FinalScore,
+
+			GatewayLatencyMs: gw,
+			DecisionID:       decision,
+		}
+		if lat, ok := predictedLatency(p, svcLat); ok {
+			s.PredictedLatencyMs = &lat
+		}
+		c.history.record(id, s)
+
+		labels := map[string]string{"path": id}
+		for k, v := range c.metricLabels() {
+			labels[k] = v
+		}
+		metrics.Default.Set("lead_net_path_score", "Final criticality score of a path in the last reconcile.", labels, p.FinalScore)
+		metrics.Default.Set("lead_net_path_network_penalty", "Network penalty of a path in the last reconcile.", labels, p.NetworkPenalty)
+	}
+	for _, id := range c.history.evict(c.cfg.Caches.PathsOrDefault()) {
+		labels := map[string]string{"path": id}
+		for k, v := range c.metricLabels() {
+			labels[k] = v
+		}
+		metrics.Default.Delete("lead_net_path_score", labels)
+		metrics.Default.Delete("lead_net_path_network_penalty", labels)
+	}
+}
+
+func predictedLatency(p graph.Path, svcLat *promc.ServiceLatencyMatrix) (float64, bool) {
+	if svcLat == nil || len(p.Nodes) < 2 {
+		return 0, false
+	}
+	total := 0.0
+	for i := 0; i+1 < len(p.Nodes); i++ {
+		v, ok := svcLat.Latency(string(p.Nodes[i]), string(p.Nodes[i+1]))
+		if !ok {
+			return 0, false
+		}
+		total += v
+	}
+	return total, true
+}
@@ -0,0 +1,208 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	appsv1 "k8s.io/api/apps/v1"
+
+	"lead-net-affinity/pkg/config"
+	"lead-net-affinity/pkg/graph"
+)
+
+// DecisionHook lets custom policies (e.g. compliance zones) inspect and
+// adjust the controller's decisions without forking it. Hooks run in the
+// order of the hooks config, every reconcile. Embed NopHook to implement
+// only some of the events.
+type DecisionHook interface {
+	Name() string
+
+	// OnPathsScored returns the scored paths, best first; it may reorder,
+	// rescore or drop them.
+	OnPathsScored(ctx context.Context, paths []graph.Path) ([]graph.Path, error)
+	// OnAffinityComputed may change the rules generated for svc's
+	// deployment d before they are exported, previewed or applied.
+	OnAffinityComputed(ctx context.Context, svc graph.NodeID, d *appsv1.Deployment) error
+	// OnBeforeApply runs before d is updated; a *HookDenial vetoes it.
+	OnBeforeApply(ctx context.Context, d *appsv1.Deployment) error
+	// OnAfterApply is told the outcome of the update of d.
+	OnAfterApply(ctx context.Context, d *appsv1.Deployment, updateErr error)
+}
+
+// NopHook implements the DecisionHook events as no-ops.
+type NopHook struct{}
+
+func (NopHook) OnPathsScored(_ context.Context, paths []graph.Path) ([]graph.Path, error) {
+	return paths, nil
+}
+
+func (NopHook) OnAffinityComputed(context.Context, graph.NodeID, *appsv1.Deployment) error {
+	return nil
+}
+
+func (NopHook) OnBeforeApply(context.Context, *appsv1.Deployment) error { return nil }
+
+func (NopHook) OnAfterApply(context.Context, *appsv1.Deployment, error) {}
+
+// HookDenial is returned by OnBeforeApply to veto an update. Unlike other
+// hook errors it holds the update whatever the failure policy.
+type HookDenial struct {
+	Reason string
+}
+
+func (d *HookDenial) Error() string {
+	return "denied: " + d.Reason
+}
+
+// HookFactory builds a compiled-in hook from its hooks[].options.
+type HookFactory func(options map[string]string) (DecisionHook, error)
+
+var hookRegistry = struct {
+	mu        sync.RWMutex
+	factories map[string]HookFactory
+}{factories: make(map[string]HookFactory)}
+
+// RegisterHook makes a compiled-in hook available under name. It is meant
+// to be called from init() in a file built only with the hook's build tag,
+// so a binary contains just the hooks it was built with.
+func RegisterHook(name string, f HookFactory) {
+	hookRegistry.mu.Lock()
+	defer hookRegistry.mu.Unlock()
+	if _, dup := hookRegistry.factories[name]; dup {
+		panic("controller: hook " + name + " registered twice")
+	}
+	hookRegistry.factories[name] = f
+}
+
+// RegisteredHooks lists the names of the compiled-in hooks.
+func RegisteredHooks() []string {
+	hookRegistry.mu.RLock()
+	defer hookRegistry.mu.RUnlock()
+	out := make([]string, 0, len(hookRegistry.factories))
+	for name := range hookRegistry.factories {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// HooksFromConfig builds the configured hooks: HTTP sidecars for entries
+// with a url, compiled-in hooks for the others.
+func HooksFromConfig(hooks []config.HookConfig) ([]DecisionHook, error) {
+	out := make([]DecisionHook, 0, len(hooks))
+	for _, hc := range hooks {
+		if hc.URL != "" {
+			h, err := NewHTTPHook(hc.Name, hc.URL, hc.TimeoutMs)
+			if err != nil {
+				return nil, fmt.Errorf("hook %s: %w", hc.Name, err)
+			}
+			out = append(out, h)
+			continue
+		}
+		hookRegistry.mu.RLock()
+		f, ok := hookRegistry.factories[hc.Name]
+		hookRegistry.mu.RUnlock()
+		if !ok {
+			return nil, fmt.Errorf("hook %s is not compiled in (available: %v) and has no url", hc.Name, RegisteredHooks())
+		}
+		h, err := f(hc.Options)
+		if err != nil {
+			return nil, fmt.Errorf("hook %s: %w", hc.Name, err)
+		}
+		out = append(out, h)
+	}
+	return out, nil
+}
+
+// SetDecisionHooks wires the decision hooks, in the order they run.
+func (c *Controller) SetDecisionHooks(hooks ...DecisionHook) {
+	c.hooks = hooks
+	for _, h := range hooks {
+		c.infof("decision hook %s enabled", h.Name())
+	}
+}
+
+// hookFailClosed reports whether errors of hook h hold updates
+// (hooks[].failurePolicy: fail).
+func (c *Controller) hookFailClosed(h DecisionHook) bool {
+	for _, hc := range c.cfg.Hooks {
+		if hc.Name == h.Name() {
+			return hc.FailClosed()
+		}
+	}
+	return false
+}
+
+// runPathsScored passes the scored paths through every hook. A failing
+// hook's result is discarded, or with failurePolicy fail the reconcile
+// stops before anything is applied.
+func (c *Controller) runPathsScored(ctx context.Context, paths []graph.Path) ([]graph.Path, error) {
+	for _, h := range c.hooks {
+		out, err := h.OnPathsScored(ctx, paths)
+		if err != nil {
+			if c.hookFailClosed(h) {
+				return nil, fmt.Errorf("decision hook %s: %w", h.Name(), err)
+			}
+			c.infof("warning: decision hook %s failed on scored paths; ignoring: %v", h.Name(), err)
+			continue
+		}
+		if len(out) != len(paths) {
+			c.debugf("decision hook %s kept %d of %d paths", h.Name(), len(out), len(paths))
+		}
+		paths = out
+	}
+	return paths, nil
+}
+
+// runAffinityComputed lets every hook adjust each deployment's generated
+// rules. It returns the services whose deployments must not be updated
+// this reconcile: those a failurePolicy fail hook errored on. A failing
+// hook's changes to a deployment are rolled back.
+func (c *Controller) runAffinityComputed(ctx context.Context, deploysBySvc map[graph.NodeID]*appsv1.Deployment) map[graph.NodeID]bool {
+	if len(c.hooks) == 0 {
+		return nil
+	}
+	held := make(map[graph.NodeID]bool)
+	for svc, d := range deploysBySvc {
+		for _, h := range c.hooks {
+			before := d.DeepCopy()
+			if err := h.OnAffinityComputed(ctx, svc, d); err != nil {
+				deploysBySvc[svc] = before
+				d = before
+				if c.hookFailClosed(h) {
+					c.infof("decision hook %s failed on %s/%s; holding its update: %v", h.Name(), d.Namespace, d.Name, err)
+					held[svc] = true
+					break
+				}
+				c.infof("warning: decision hook %s failed on %s/%s; ignoring: %v", h.Name(), d.Namespace, d.Name, err)
+			}
+		}
+	}
+	return held
+}
+
+// beforeApply asks every hook whether d may be updated.
+func (c *Controller) beforeApply(ctx context.Context, d *appsv1.Deployment) error {
+	for _, h := range c.hooks {
+		err := h.OnBeforeApply(ctx, d)
+		if err == nil {
+			continue
+		}
+		var denial *HookDenial
+		if errors.As(err, &denial) || c.hookFailClosed(h) {
+			return fmt.Errorf("decision hook %s: %w", h.Name(), err)
+		}
+		c.infof("warning: decision hook %s failed before updating %s/%s; ignoring: %v", h.Name(), d.Namespace, d.Name, err)
+	}
+	return nil
+}
+
+// afterApply tells every hook the outcome of updating d.
+func (c *Controller) afterApply(ctx context.Context, d *appsv1.Deployment, updateErr error) {
+	for _, h := range c.hooks {
+		h.OnAfterApply(ctx, d, updateErr)
+	}
+}
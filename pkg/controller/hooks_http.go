@@ -0,0 +1,158 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+
+	"lead-net-affinity/pkg/graph"
+)
+
+// defaultHookTimeout bounds a sidecar hook call when none is configured.
+const defaultHookTimeout = 5 * time.Second
+
+// Events POSTed to a sidecar hook, as paths under its URL.
+const (
+	HookEventPathsScored      = "paths-scored"
+	HookEventAffinityComputed = "affinity-computed"
+	HookEventBeforeApply      = "before-apply"
+	HookEventAfterApply       = "after-apply"
+)
+
+// HookPath is a scored path as exchanged with sidecar hooks.
+type HookPath struct {
+	Services       []graph.NodeID `json:"services"`
+	BaseScore      float64        `json:"baseScore"`
+	NetworkPenalty float64        `json:"networkPenalty"`
+	FinalScore     float64        `json:"finalScore"`
+}
+
+// HookRequest is the body POSTed for every event; fields not relevant to
+// the event are left out.
+type HookRequest struct {
+	Paths      []HookPath         `json:"paths,omitempty"`      // paths-scored
+	Service    graph.NodeID       `json:"service,omitempty"`    // affinity-computed
+	Deployment *appsv1.Deployment `json:"deployment,omitempty"` // all but paths-scored
+	Error      string             `json:"error,omitempty"`      // after-apply, if the update failed
+}
+
+// HookResponse is a sidecar hook's answer. An empty body (or 204) changes
+// nothing and allows the update.
+type HookResponse struct {
+	Paths    []HookPath       `json:"paths,omitempty"`    // paths-scored: replaces the paths
+	Affinity *corev1.Affinity `json:"affinity,omitempty"` // affinity-computed: replaces the pod affinity
+	Allowed  *bool            `json:"allowed,omitempty"`  // before-apply: false vetoes the update
+	Reason   string           `json:"reason,omitempty"`
+}
+
+// httpHook is a DecisionHook running in a sidecar (or any HTTP service),
+// reached with JSON POSTs to URL/<event>; see HookRequest and HookResponse.
+type httpHook struct {
+	name   string
+	url    string
+	client *http.Client
+}
+
+// NewHTTPHook returns a DecisionHook calling the sidecar at baseURL, each
+// call timing out after timeoutMs (5s if <= 0).
+func NewHTTPHook(name, baseURL string, timeoutMs int) (DecisionHook, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid hook URL %q", baseURL)
+	}
+	timeout := defaultHookTimeout
+	if timeoutMs > 0 {
+		timeout = time.Duration(timeoutMs) * time.Millisecond
+	}
+	return &httpHook{name: name, url: strings.TrimSuffix(baseURL, "/"), client: &http.Client{Timeout: timeout}}, nil
+}
+
+func (h *httpHook) Name() string { return h.name }
+
+func (h *httpHook) OnPathsScored(ctx context.Context, paths []graph.Path) ([]graph.Path, error) {
+	req := HookRequest{Paths: make([]HookPath, len(paths))}
+	for i, p := range paths {
+		req.Paths[i] = HookPath{Services: p.Nodes, BaseScore: p.BaseScore, NetworkPenalty: p.NetworkPenalty, FinalScore: p.FinalScore}
+	}
+	resp, err := h.call(ctx, HookEventPathsScored, req)
+	if err != nil || resp.Paths == nil {
+		return paths, err
+	}
+	out := make([]graph.Path, len(resp.Paths))
+	for i, p := range resp.Paths {
+		out[i] = graph.Path{Nodes: p.Services, BaseScore: p.BaseScore, NetworkPenalty: p.NetworkPenalty, FinalScore: p.FinalScore}
+	}
+	return out, nil
+}
+
+func (h *httpHook) OnAffinityComputed(ctx context.Context, svc graph.NodeID, d *appsv1.Deployment) error {
+	resp, err := h.call(ctx, HookEventAffinityComputed, HookRequest{Service: svc, Deployment: d})
+	if err != nil {
+		return err
+	}
+	if resp.Affinity != nil {
+		d.Spec.Template.Spec.Affinity = resp.Affinity
+	}
+	return nil
+}
+
+func (h *httpHook) OnBeforeApply(ctx context.Context, d *appsv1.Deployment) error {
+	resp, err := h.call(ctx, HookEventBeforeApply, HookRequest{Deployment: d})
+	if err != nil {
+		return err
+	}
+	if resp.Allowed != nil && !*resp.Allowed {
+		return &HookDenial{Reason: resp.Reason}
+	}
+	return nil
+}
+
+func (h *httpHook) OnAfterApply(ctx context.Context, d *appsv1.Deployment, updateErr error) {
+	req := HookRequest{Deployment: d}
+	if updateErr != nil {
+		req.Error = updateErr.Error()
+	}
+	// Notifications are best effort; the update has already happened.
+	_, _ = h.call(ctx, HookEventAfterApply, req)
+}
+
+func (h *httpHook) call(ctx context.Context, event string, body HookRequest) (HookResponse, error) {
+	var out HookResponse
+	data, err := json.Marshal(body)
+	if err != nil {
+		return out, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.url+"/"+event, bytes.NewReader(data))
+	if err != nil {
+		return out, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return out, err
+	}
+	defer resp.Body.Close()
+	data, err = io.ReadAll(io.LimitReader(resp.Body, 8<<20))
+	if err != nil {
+		return out, err
+	}
+	if resp.StatusCode/100 != 2 {
+		return out, fmt.Errorf("%s: unexpected status %s", event, resp.Status)
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return out, nil
+	}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return out, fmt.Errorf("%s: decode response: %w", event, err)
+	}
+	return out, nil
+}
@@ -0,0 +1,385 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"lead-net-affinity/pkg/config"
+	"lead-net-affinity/pkg/graph"
+	"lead-net-affinity/pkg/metrics"
+)
+
+// pinger is optionally implemented by the PromClient (prometheus.Client does).
+type pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// Handler returns the controller's HTTP API:
+//
+//	GET  /healthz           liveness (process is up)
+//	GET  /readyz            last successful reconcile age + Prometheus reachability
+//	GET  /metrics           Prometheus metrics
+//	GET  /status            last reconcile status (JSON)
+//	GET  /recommendations   replica recommendations of the last reconcile (JSON)
+//	GET  /drift             declared graph vs. observed traffic (JSON)
+//	GET  /quality           confidence and freshness of the last reconcile's inputs (JSON)
+//	GET  /health-summary    per-service and per-path health incl. latency SLO burn rates (JSON)
+//	GET  /root-cause        likely culprit services of paths over their latency objective (JSON)
+//	GET  /node-scores       per-service node scores for schedulers (JSON, with a node scores sink)
+//	GET  /graph             service graph incl. inferred edges, ?format=yaml|json|graphml (default json)
+//	GET  /paths/history     per-path score samples, ?path=fe-src-prf (no path: list path IDs)
+//	GET  /paths/pareto      paths by latency, cost and resilience with their Pareto front (JSON)
+//	POST /paths/pareto/select  rank a path of the front first, ?path=fe-src-prf (DELETE: clear the pick); server.debug token required
+//	GET  /services/history  per-service metric samples and trends, ?service=fe (no service: list services)
+//	GET  /forecast          next-hour inbound request rate forecast per service (JSON)
+//	GET  /zones/plan        target replicas per zone by where each service's traffic comes from (JSON)
+//	GET  /decisions         ranking and affinity of the last full reconcile, ?owner=team (JSON)
+//	GET  /affinity/preview  affinity the last reconcile generated, ?service=X (YAML; applied or not)
+//	GET  /selectors         generated affinity selectors matching no running pod (JSON)
+//	GET  /effectiveness     cross-node share of critical-path traffic per decision epoch (JSON)
+//	GET  /verification      whether pods placed under the terms in place landed next to their peers (JSON)
+//	GET  /simulate          predicted placement under the last reconcile's affinity, ?service=X (JSON); server.debug token required
+//	GET  /report            placement and health report of the current period, ?format=markdown|html|json
+//	POST /diff              compare {"before": ..., "after": ...} snapshots (no after: current decisions)
+//	POST /reanalyze         scoped reconcile, ?service=a,b&namespace=ns; server.debug token required
+//	GET  /approvals         mutating actions queued for approval (JSON)
+//	POST /approvals/<id>/approve, /approvals/<id>/deny; server.debug token required
+//	GET  /inject            synthetic node/edge metrics (POST: add, DELETE: clear); server.debug.inject, token required
+//	GET  /snapshot          inputs of the last full reconcile for replay (JSON); server.debug.record, token required
+func (c *Controller) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("ok\n"))
+	})
+	mux.HandleFunc("/readyz", c.handleReadyz)
+	mux.Handle("/metrics", metrics.Default.Handler())
+	mux.HandleFunc("/status", func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, http.StatusOK, c.Status())
+	})
+	mux.HandleFunc("/recommendations", func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, http.StatusOK, c.Recommendations())
+	})
+	mux.HandleFunc("/drift", func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, http.StatusOK, c.Drift())
+	})
+	mux.HandleFunc("/quality", func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, http.StatusOK, c.DataQuality())
+	})
+	mux.HandleFunc("/health-summary", func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, http.StatusOK, c.HealthSummary())
+	})
+	mux.HandleFunc("/root-cause", func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, http.StatusOK, c.RootCause())
+	})
+	mux.HandleFunc("/node-scores", func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, http.StatusOK, c.NodeScores())
+	})
+	mux.HandleFunc("/graph", c.handleGraph)
+	mux.HandleFunc("/paths/history", c.handlePathHistory)
+	mux.HandleFunc("/services/history", c.handleServiceHistory)
+	mux.HandleFunc("/forecast", func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, http.StatusOK, c.Forecast())
+	})
+	mux.HandleFunc("/zones/plan", func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, http.StatusOK, c.ZonePlans())
+	})
+	mux.HandleFunc("/paths/pareto", func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, http.StatusOK, c.ParetoFront())
+	})
+	mux.Handle("/paths/pareto/select", requireToken(http.HandlerFunc(c.handleParetoSelect), c.cfg.Server.Debug))
+	mux.HandleFunc("/decisions", func(w http.ResponseWriter, r *http.Request) {
+		d := c.Decisions()
+		if owner := r.URL.Query().Get("owner"); owner != "" {
+			d = d.ForOwner(owner)
+		}
+		writeJSON(w, http.StatusOK, d)
+	})
+	mux.HandleFunc("/affinity/preview", c.handleAffinityPreview)
+	mux.HandleFunc("/selectors", func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, http.StatusOK, c.SelectorCheck())
+	})
+	mux.HandleFunc("/effectiveness", func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, http.StatusOK, c.Effectiveness())
+	})
+	mux.HandleFunc("/verification", func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, http.StatusOK, c.Verification())
+	})
+	// Simulating lists nodes, pods and deployments cluster-wide per request.
+	mux.Handle("/simulate", requireToken(http.HandlerFunc(c.handleSimulate), c.cfg.Server.Debug))
+	mux.HandleFunc("/report", c.handleReport)
+	mux.HandleFunc("/diff", c.handleDiff)
+	mux.Handle("/reanalyze", requireToken(http.HandlerFunc(c.handleReanalyze), c.cfg.Server.Debug))
+	mux.HandleFunc("/approvals", func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, http.StatusOK, c.Approvals())
+	})
+	mux.Handle("/approvals/", requireToken(http.HandlerFunc(c.handleApprovalDecision), c.cfg.Server.Debug))
+	if dc := c.cfg.Server.Debug; dc.Enabled && dc.Inject {
+		mux.Handle("/inject", requireToken(http.HandlerFunc(c.handleInject), dc))
+	}
+	if dc := c.cfg.Server.Debug; dc.Enabled && dc.Record {
+		mux.Handle("/snapshot", requireToken(http.HandlerFunc(c.handleSnapshot), dc))
+	}
+	return mux
+}
+
+type readyResponse struct {
+	Ready               bool     `json:"ready"`
+	LastSuccessAgeSec   float64  `json:"lastSuccessAgeSeconds,omitempty"`
+	PrometheusReachable bool     `json:"prometheusReachable"`
+	Reasons             []string `json:"reasons,omitempty"`
+
+	// Degraded lists components failing for longer than the readiness
+	// window. The controller keeps running on fallbacks, so they do not
+	// make it unready; a failing Kubernetes API stops every reconcile and
+	// shows up as a stale last success instead.
+	Degraded   []string          `json:"degraded,omitempty"`
+	Components []ComponentStatus `json:"components,omitempty"`
+}
+
+func (c *Controller) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	resp := readyResponse{Ready: true, PrometheusReachable: true}
+
+	if c.State() == StateStopping {
+		resp.Ready = false
+		resp.Reasons = append(resp.Reasons, "controller is shutting down")
+	}
+	st := c.Status()
+	maxAge := 3 * c.interval
+	if st.LastSuccessTime.IsZero() {
+		resp.Ready = false
+		resp.Reasons = append(resp.Reasons, "no successful reconcile yet")
+	} else {
+		age := time.Since(st.LastSuccessTime)
+		resp.LastSuccessAgeSec = age.Seconds()
+		if age > maxAge {
+			resp.Ready = false
+			resp.Reasons = append(resp.Reasons, fmt.Sprintf("last successful reconcile %s ago (max %s)", age.Round(time.Second), maxAge))
+		}
+	}
+	resp.Degraded = c.failingComponents(maxAge)
+	resp.Components = c.Components()
+
+	if p, ok := c.prom.(pinger); ok {
+		ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+		defer cancel()
+		if err := p.Ping(ctx); err != nil {
+			resp.Ready = false
+			resp.PrometheusReachable = false
+			resp.Reasons = append(resp.Reasons, fmt.Sprintf("prometheus unreachable: %v", err))
+		}
+	}
+
+	code := http.StatusOK
+	if !resp.Ready {
+		code = http.StatusServiceUnavailable
+	}
+	writeJSON(w, code, resp)
+}
+
+func (c *Controller) handleReanalyze(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "use POST", http.StatusMethodNotAllowed)
+		return
+	}
+	scope := Scope{
+		Services:   splitQueryList(r.URL.Query().Get("service")),
+		Namespaces: splitQueryList(r.URL.Query().Get("namespace")),
+	}
+	if err := c.ReconcileScoped(r.Context(), scope); err != nil {
+		code := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, errReconcileInProgress):
+			code = http.StatusConflict
+		case errors.Is(err, ErrNoPaths):
+			code = http.StatusNotFound
+		}
+		writeJSON(w, code, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, c.Status())
+}
+
+func splitQueryList(v string) []string {
+	var out []string
+	for _, p := range strings.Split(v, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func (c *Controller) handleServiceHistory(w http.ResponseWriter, r *http.Request) {
+	svc := r.URL.Query().Get("service")
+	if svc == "" {
+		writeJSON(w, http.StatusOK, map[string][]string{"services": c.ServiceHistoryIDs()})
+		return
+	}
+	h, ok := c.ServiceHistory(svc)
+	if !ok {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": fmt.Sprintf("no history for service %q", svc)})
+		return
+	}
+	writeJSON(w, http.StatusOK, h)
+}
+
+func (c *Controller) handlePathHistory(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("path")
+	if id == "" {
+		writeJSON(w, http.StatusOK, map[string][]string{"paths": c.history.ids()})
+		return
+	}
+	h, ok := c.PathHistory(id)
+	if !ok {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": fmt.Sprintf("no history for path %q", id)})
+		return
+	}
+	writeJSON(w, http.StatusOK, h)
+}
+
+var graphContentTypes = map[string]string{
+	graph.FormatJSON:    "application/json",
+	graph.FormatYAML:    "application/yaml",
+	graph.FormatGraphML: "application/xml",
+}
+
+func (c *Controller) handleGraph(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = graph.FormatJSON
+	}
+	ct, ok := graphContentTypes[format]
+	if !ok {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("unknown format %q", format)})
+		return
+	}
+	b, err := c.GraphDocument(r.Context()).Marshal(format)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	w.Header().Set("Content-Type", ct)
+	_, _ = w.Write(b)
+}
+
+// handleReport serves GET /report[?format=markdown|html|json].
+func (c *Controller) handleReport(w http.ResponseWriter, r *http.Request) {
+	rep := c.CurrentReport()
+	format := r.URL.Query().Get("format")
+	switch format {
+	case "json":
+		writeJSON(w, http.StatusOK, rep)
+		return
+	case "", config.ReportMarkdown, config.ReportHTML:
+	default:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "format must be markdown, html or json"})
+		return
+	}
+	data, err := RenderReport(rep, format)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	if format == config.ReportHTML {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	} else {
+		w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+	}
+	_, _ = w.Write(data)
+}
+
+// maxDiffBody bounds the two snapshots POSTed to /diff.
+const maxDiffBody = 8 << 20
+
+// handleDiff compares two snapshots, each a Decisions document or a bare
+// graph document.
+func (c *Controller) handleDiff(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "use POST", http.StatusMethodNotAllowed)
+		return
+	}
+	var req struct {
+		Before json.RawMessage `json:"before"`
+		After  json.RawMessage `json:"after"`
+	}
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxDiffBody)).Decode(&req)
+	if tooLarge := (*http.MaxBytesError)(nil); errors.As(err, &tooLarge) {
+		writeJSON(w, http.StatusRequestEntityTooLarge, map[string]string{"error": fmt.Sprintf("body exceeds %d bytes", tooLarge.Limit)})
+		return
+	}
+	if err != nil || len(req.Before) == 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "body must be {\"before\": <snapshot>, \"after\": <snapshot>}"})
+		return
+	}
+	before, err := ParseSnapshot(req.Before)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "before: " + err.Error()})
+		return
+	}
+	after := c.Decisions()
+	if len(req.After) > 0 {
+		if after, err = ParseSnapshot(req.After); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "after: " + err.Error()})
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, DiffDecisions(before, after))
+}
+
+func (c *Controller) handleParetoSelect(w http.ResponseWriter, r *http.Request) {
+	var id string
+	switch r.Method {
+	case http.MethodPost:
+		if id = r.URL.Query().Get("path"); id == "" {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "missing ?path="})
+			return
+		}
+	case http.MethodDelete:
+	default:
+		http.Error(w, "use POST or DELETE", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := c.SelectParetoPoint(id); err != nil {
+		code := http.StatusConflict
+		if errors.Is(err, errUnknownPath) {
+			code = http.StatusNotFound
+		}
+		writeJSON(w, code, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, c.ParetoFront())
+}
+
+func (c *Controller) handleApprovalDecision(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "use POST", http.StatusMethodNotAllowed)
+		return
+	}
+	id, verb, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/approvals/"), "/")
+	if verb != "approve" && verb != "deny" {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "use /approvals/<id>/approve or /approvals/<id>/deny"})
+		return
+	}
+	a, err := c.DecideApproval(id, verb == "approve")
+	if err != nil {
+		code := http.StatusConflict
+		if errors.Is(err, errUnknownAction) {
+			code = http.StatusNotFound
+		}
+		writeJSON(w, code, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, a)
+}
@@ -0,0 +1,226 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"lead-net-affinity/pkg/graph"
+	promc "lead-net-affinity/pkg/prometheus"
+	"lead-net-affinity/pkg/scoring"
+)
+
+// InjectedNode overrides a node's network metrics. Unset fields keep the
+// measured value (0 for nodes Prometheus does not report).
+type InjectedNode struct {
+	Node          string   `json:"node"` // node name or the IP Prometheus reports it by
+	LatencyMs     *float64 `json:"latencyMs,omitempty"`
+	DropRate      *float64 `json:"dropRate,omitempty"`
+	BandwidthRate *float64 `json:"bandwidthRate,omitempty"`
+}
+
+// InjectedEdge overrides the latency of the src -> dst edge, or with src
+// unset of every edge into dst.
+type InjectedEdge struct {
+	Src       string  `json:"src,omitempty"`
+	Dst       string  `json:"dst"`
+	LatencyMs float64 `json:"latencyMs"`
+}
+
+// Injections are the synthetic values served by /inject (see
+// config.DebugConfig.Inject). They replace the monitored ones from the
+// next reconcile on, after smoothing and before bad nodes are judged, and
+// are never written to the metrics cache. Node metrics are per node, so
+// there are no node pairs to inject.
+type Injections struct {
+	Nodes []InjectedNode `json:"nodes"`
+	Edges []InjectedEdge `json:"edges"`
+}
+
+type injectionStore struct {
+	mu    sync.RWMutex
+	nodes map[string]InjectedNode
+	edges map[promc.ServicePair]InjectedEdge
+}
+
+// Inject adds in to the active injections, replacing earlier ones for the
+// same node or edge.
+func (c *Controller) Inject(in Injections) error {
+	for _, n := range in.Nodes {
+		if n.Node == "" {
+			return fmt.Errorf("injected node without a name")
+		}
+		for name, v := range map[string]*float64{"latencyMs": n.LatencyMs, "dropRate": n.DropRate, "bandwidthRate": n.BandwidthRate} {
+			if v != nil && *v < 0 {
+				return fmt.Errorf("node %s: %s must not be negative, got %v", n.Node, name, *v)
+			}
+		}
+	}
+	for _, e := range in.Edges {
+		if e.Dst == "" {
+			return fmt.Errorf("injected edge without dst")
+		}
+		if e.LatencyMs < 0 {
+			return fmt.Errorf("edge %s -> %s: latencyMs must not be negative, got %v", e.Src, e.Dst, e.LatencyMs)
+		}
+	}
+
+	s := &c.injected
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.nodes == nil {
+		s.nodes = make(map[string]InjectedNode)
+		s.edges = make(map[promc.ServicePair]InjectedEdge)
+	}
+	for _, n := range in.Nodes {
+		s.nodes[n.Node] = n
+	}
+	for _, e := range in.Edges {
+		s.edges[promc.ServicePair{Src: e.Src, Dst: e.Dst}] = e
+	}
+	c.infof("injected synthetic metrics: %d nodes, %d edges active", len(s.nodes), len(s.edges))
+	return nil
+}
+
+// ClearInjections drops every injection; the next reconcile uses the
+// monitored values again.
+func (c *Controller) ClearInjections() {
+	s := &c.injected
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.nodes)+len(s.edges) > 0 {
+		c.infof("cleared synthetic metrics of %d nodes, %d edges", len(s.nodes), len(s.edges))
+	}
+	s.nodes, s.edges = nil, nil
+}
+
+// Injected returns the active injections.
+func (c *Controller) Injected() Injections {
+	s := &c.injected
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := Injections{Nodes: []InjectedNode{}, Edges: []InjectedEdge{}}
+	for _, n := range s.nodes {
+		out.Nodes = append(out.Nodes, n)
+	}
+	for _, e := range s.edges {
+		out.Edges = append(out.Edges, e)
+	}
+	sort.Slice(out.Nodes, func(i, j int) bool { return out.Nodes[i].Node < out.Nodes[j].Node })
+	sort.Slice(out.Edges, func(i, j int) bool {
+		if out.Edges[i].Dst != out.Edges[j].Dst {
+			return out.Edges[i].Dst < out.Edges[j].Dst
+		}
+		return out.Edges[i].Src < out.Edges[j].Src
+	})
+	return out
+}
+
+// injectNodeMetrics returns nm with the injected node metrics applied. A
+// node named by injection is matched by name, then by each of its IPs. nm
+// is not modified.
+func (c *Controller) injectNodeMetrics(nm *promc.NetworkMatrix, ipResolver scoring.NodeIPResolver) *promc.NetworkMatrix {
+	s := &c.injected
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if len(s.nodes) == 0 {
+		return nm
+	}
+	out := &promc.NetworkMatrix{Nodes: make(map[string]*promc.NodeMetrics)}
+	if nm != nil {
+		for id, m := range nm.Nodes {
+			out.Nodes[id] = m
+		}
+		out.Missing = nm.Missing
+	}
+	now := time.Now()
+	for name, in := range s.nodes {
+		id := name
+		if _, ok := out.Nodes[id]; !ok {
+			if m, ip := scoring.NodeMetricsByIP(out, name, ipResolver); m != nil {
+				id = ip
+				if out.Nodes[id] == nil {
+					id = promc.NormalizeAddress(ip) // matched in normalized form
+				}
+			}
+		}
+		m := promc.NodeMetrics{NodeID: id}
+		if cur := out.Nodes[id]; cur != nil {
+			m = *cur
+		}
+		for _, f := range []struct{ from, to *float64 }{
+			{in.LatencyMs, &m.AvgLatencyMs}, {in.DropRate, &m.DropRate}, {in.BandwidthRate, &m.BandwidthRate},
+		} {
+			if f.from != nil {
+				*f.to = *f.from
+			}
+		}
+		m.Freshness = promc.Freshness{Confidence: promc.ConfidenceInjected, ObservedAt: now}
+		out.Nodes[id] = &m
+	}
+	c.debugf("applied injected metrics of %d nodes", len(s.nodes))
+	return out
+}
+
+// injectLatency returns svcLat with the injected edge latencies of graph
+// edges applied. An edge injection with src wins over one for every edge
+// into dst. svcLat is not modified.
+func (c *Controller) injectLatency(svcLat *promc.ServiceLatencyMatrix, g *graph.Graph) *promc.ServiceLatencyMatrix {
+	s := &c.injected
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if len(s.edges) == 0 {
+		return svcLat
+	}
+	out := &promc.ServiceLatencyMatrix{Pairs: map[promc.ServicePair]float64{}, Freshness: map[promc.ServicePair]promc.Freshness{}}
+	if svcLat != nil {
+		for k, v := range svcLat.Pairs {
+			out.Pairs[k] = v
+			out.Freshness[k] = svcLat.Freshness[k]
+		}
+	}
+	now := time.Now()
+	for src, n := range g.Nodes {
+		for _, dst := range n.DependsOn {
+			pair := promc.ServicePair{Src: string(src), Dst: string(dst)}
+			in, ok := s.edges[pair]
+			if !ok {
+				in, ok = s.edges[promc.ServicePair{Dst: string(dst)}]
+			}
+			if ok {
+				out.Pairs[pair] = in.LatencyMs
+				out.Freshness[pair] = promc.Freshness{Confidence: promc.ConfidenceInjected, ObservedAt: now}
+			}
+		}
+	}
+	return out
+}
+
+// handleInject serves GET (active injections), POST (add Injections) and
+// DELETE (clear) on /inject.
+func (c *Controller) handleInject(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var in Injections
+		dec := json.NewDecoder(r.Body)
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&in); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "decode injections: " + err.Error()})
+			return
+		}
+		if err := c.Inject(in); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+	case http.MethodDelete:
+		c.ClearInjections()
+	default:
+		http.Error(w, "use GET, POST or DELETE", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, c.Injected())
+}
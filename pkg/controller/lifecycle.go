@@ -0,0 +1,131 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+// State is where the controller's reconcile loop is in its lifecycle:
+// Stopped -> Starting -> Running -> Stopping -> Stopped.
+type State int32
+
+const (
+	StateStopped  State = iota // Run not called, or returned
+	StateStarting              // waiting out the startup delay
+	StateRunning               // reconciling
+	StateStopping              // context done; waiting for the in-flight reconcile
+)
+
+func (s State) String() string {
+	switch s {
+	case StateStarting:
+		return "starting"
+	case StateRunning:
+		return "running"
+	case StateStopping:
+		return "stopping"
+	default:
+		return "stopped"
+	}
+}
+
+// ErrAlreadyRunning is returned by Run while another Run of the same
+// controller has not returned.
+var ErrAlreadyRunning = errors.New("controller already running")
+
+type lifecycle struct {
+	state atomic.Int32
+
+	mu     sync.Mutex
+	cancel context.CancelFunc // of the running Run, nil when stopped
+}
+
+// begin moves Stopped -> Starting and returns the context Run works
+// under, or false if Run is already in progress.
+func (l *lifecycle) begin(ctx context.Context) (context.Context, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.state.CompareAndSwap(int32(StateStopped), int32(StateStarting)) {
+		return nil, false
+	}
+	ctx, l.cancel = context.WithCancel(ctx)
+	return ctx, true
+}
+
+// running moves Starting -> Running unless Stop came first.
+func (l *lifecycle) running() {
+	l.state.CompareAndSwap(int32(StateStarting), int32(StateRunning))
+}
+
+// stop cancels the running Run, if any, and marks it Stopping.
+func (l *lifecycle) stop() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.cancel == nil {
+		return
+	}
+	l.cancel()
+	l.state.Store(int32(StateStopping))
+}
+
+// end marks Run returned; wait is called while Stopping.
+func (l *lifecycle) end(wait func()) {
+	l.stop()
+	wait()
+	l.mu.Lock()
+	l.cancel = nil
+	l.mu.Unlock()
+	l.state.Store(int32(StateStopped))
+}
+
+// group runs the goroutines of one Run, like errgroup.WithContext: the
+// first to fail cancels the context of the others, and wait returns its
+// error once all are done.
+type group struct {
+	wg     sync.WaitGroup
+	cancel context.CancelCauseFunc
+
+	once sync.Once
+	err  error
+}
+
+func newGroup(ctx context.Context) (*group, context.Context) {
+	g := &group{}
+	ctx, g.cancel = context.WithCancelCause(ctx)
+	return g, ctx
+}
+
+// goFunc runs fn in a new goroutine of the group.
+func (g *group) goFunc(fn func() error) {
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		if err := fn(); err != nil {
+			g.once.Do(func() {
+				g.err = err
+				g.cancel(err)
+			})
+		}
+	}()
+}
+
+// wait waits for all goroutines and returns the first error.
+func (g *group) wait() error {
+	g.wg.Wait()
+	g.cancel(nil)
+	return g.err
+}
+
+// State returns the lifecycle state of the reconcile loop.
+func (c *Controller) State() State {
+	return State(c.lifecycle.state.Load())
+}
+
+// Stop makes Run return once the in-flight reconcile, if any, is done.
+// It does not wait for that and is a no-op when Run is not in progress,
+// so it may be called any number of times.
+func (c *Controller) Stop() {
+	c.lifecycle.stop()
+}
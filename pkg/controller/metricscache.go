@@ -0,0 +1,429 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"lead-net-affinity/pkg/config"
+	"lead-net-affinity/pkg/output"
+	promc "lead-net-affinity/pkg/prometheus"
+)
+
+const (
+	defaultMetricsCacheMaxAge = time.Hour
+	metricsCacheFile          = "metrics-cache.json"
+)
+
+// MetricsCache stores the last metrics snapshot across restarts (see
+// config.MetricsCacheConfig).
+type MetricsCache interface {
+	String() string
+	// Load returns the saved snapshot, or nil if nothing was saved yet.
+	Load(ctx context.Context) ([]byte, error)
+	Save(ctx context.Context, b []byte) error
+}
+
+// FileMetricsCache keeps the snapshot in a local file.
+type FileMetricsCache struct {
+	Path string
+}
+
+func (f *FileMetricsCache) String() string { return "file:" + f.Path }
+
+func (f *FileMetricsCache) Load(context.Context) ([]byte, error) {
+	b, err := os.ReadFile(f.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	return b, err
+}
+
+// Save writes through a temporary file so a crash never leaves a truncated
+// snapshot behind.
+func (f *FileMetricsCache) Save(_ context.Context, b []byte) error {
+	if err := os.MkdirAll(filepath.Dir(f.Path), 0o755); err != nil {
+		return err
+	}
+	tmp := f.Path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, f.Path)
+}
+
+// ConfigMapStore is implemented by kube.Client.
+type ConfigMapStore interface {
+	output.ConfigMapWriter
+	GetConfigMap(ctx context.Context, namespace, name string) (map[string]string, error)
+}
+
+// ConfigMapMetricsCache keeps the snapshot under metrics-cache.json in a
+// ConfigMap.
+type ConfigMapMetricsCache struct {
+	Client    ConfigMapStore
+	Namespace string
+	Name      string
+}
+
+func (m *ConfigMapMetricsCache) String() string { return "configmap:" + m.Namespace + "/" + m.Name }
+
+func (m *ConfigMapMetricsCache) Load(ctx context.Context) ([]byte, error) {
+	data, err := m.Client.GetConfigMap(ctx, m.Namespace, m.Name)
+	if err != nil || data[metricsCacheFile] == "" {
+		return nil, err
+	}
+	return []byte(data[metricsCacheFile]), nil
+}
+
+func (m *ConfigMapMetricsCache) Save(ctx context.Context, b []byte) error {
+	return m.Client.ApplyConfigMap(ctx, m.Namespace, m.Name, map[string]string{metricsCacheFile: string(b)})
+}
+
+// MetricsCacheFromConfig builds the cache enabled in cfg, or nil if none
+// is. cm may be nil when ConfigMaps cannot be used.
+func MetricsCacheFromConfig(cfg config.MetricsCacheConfig, cm ConfigMapStore) (MetricsCache, error) {
+	switch {
+	case cfg.Path != "":
+		return &FileMetricsCache{Path: cfg.Path}, nil
+	case cfg.ConfigMap == "":
+		return nil, nil
+	}
+	ns, name, ok := strings.Cut(cfg.ConfigMap, "/")
+	switch {
+	case !ok || ns == "" || name == "":
+		return nil, fmt.Errorf("metricsCache.configMap %q: expected namespace/name", cfg.ConfigMap)
+	case cm == nil:
+		return nil, fmt.Errorf("metricsCache.configMap %q: no ConfigMap access", cfg.ConfigMap)
+	}
+	return &ConfigMapMetricsCache{Client: cm, Namespace: ns, Name: name}, nil
+}
+
+// metricsSnapshot is the persisted form of the cache.
+type metricsSnapshot struct {
+	SavedAt time.Time             `json:"savedAt"`
+	Nodes   map[string]cachedNode `json:"nodes,omitempty"`
+	Latency []cachedPair          `json:"latency,omitempty"`
+	RPS     []cachedPair          `json:"rps,omitempty"`
+}
+
+type cachedNode struct {
+	AvgLatencyMs  float64   `json:"avgLatencyMs"`
+	DropRate      float64   `json:"dropRate"`
+	BandwidthRate float64   `json:"bandwidthRate"`
+	ObservedAt    time.Time `json:"observedAt"`
+}
+
+type cachedPair struct {
+	Src        string    `json:"src"`
+	Dst        string    `json:"dst"`
+	Value      float64   `json:"value"`
+	ObservedAt time.Time `json:"observedAt"`
+}
+
+type cachedValue struct {
+	v  float64
+	at time.Time
+}
+
+// metricsCacheStore holds the last measured value of every node metric and
+// service edge. It is loaded from the backend on first use; live values
+// replace cached ones, and cached ones fill in what a query did not return.
+type metricsCacheStore struct {
+	mu      sync.Mutex
+	backend MetricsCache
+	loaded  bool
+	dirty   bool
+	nodes   map[string]cachedNode
+	latency map[promc.ServicePair]cachedValue
+	rps     map[promc.ServicePair]cachedValue
+}
+
+// SetMetricsCache persists the last fetched metrics to m and restores them
+// on the first reconcile.
+func (c *Controller) SetMetricsCache(m MetricsCache) {
+	c.metricsCache.backend = m
+	c.metricsCache.nodes = make(map[string]cachedNode)
+	c.metricsCache.latency = make(map[promc.ServicePair]cachedValue)
+	c.metricsCache.rps = make(map[promc.ServicePair]cachedValue)
+	c.infof("caching metrics in %s", m)
+}
+
+func (c *Controller) metricsCacheMaxAge() time.Duration {
+	if s := c.cfg.MetricsCache.MaxAgeSeconds; s > 0 {
+		return time.Duration(s) * time.Second
+	}
+	return defaultMetricsCacheMaxAge
+}
+
+// loadMetricsCacheLocked restores the saved snapshot once. A missing or
+// unreadable snapshot leaves the cache empty.
+func (c *Controller) loadMetricsCacheLocked(ctx context.Context) {
+	s := &c.metricsCache
+	if s.loaded {
+		return
+	}
+	s.loaded = true
+
+	b, err := s.backend.Load(ctx)
+	if err != nil {
+		c.infof("warning: failed to load metrics cache from %s: %v", s.backend, err)
+		return
+	}
+	if b == nil {
+		return
+	}
+	var snap metricsSnapshot
+	if err := json.Unmarshal(b, &snap); err != nil {
+		c.infof("warning: ignoring corrupt metrics cache in %s: %v", s.backend, err)
+		return
+	}
+	for id, n := range snap.Nodes {
+		s.nodes[id] = n
+	}
+	for _, p := range snap.Latency {
+		s.latency[promc.ServicePair{Src: p.Src, Dst: p.Dst}] = cachedValue{p.Value, p.ObservedAt}
+	}
+	for _, p := range snap.RPS {
+		s.rps[promc.ServicePair{Src: p.Src, Dst: p.Dst}] = cachedValue{p.Value, p.ObservedAt}
+	}
+	c.infof("restored %d node and %d edge metrics saved at %s from %s",
+		len(s.nodes), len(s.latency)+len(s.rps), snap.SavedAt.Format(time.RFC3339), s.backend)
+}
+
+// measuredAt returns when a live value was observed, and false for values
+// that were not measured (inferred or defaults are never cached).
+func measuredAt(f promc.Freshness, now time.Time) (time.Time, bool) {
+	if f.Confidence != "" && f.Confidence != promc.ConfidenceMeasured {
+		return time.Time{}, false
+	}
+	if f.ObservedAt.IsZero() {
+		return now, true
+	}
+	return f.ObservedAt, true
+}
+
+// withCachedNodes records the measured nodes of live and returns live plus
+// the cached nodes it lacks. live is not modified.
+func (c *Controller) withCachedNodes(ctx context.Context, live *promc.NetworkMatrix) *promc.NetworkMatrix {
+	s := &c.metricsCache
+	if s.backend == nil {
+		return live
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c.loadMetricsCacheLocked(ctx)
+
+	now := time.Now()
+	out := &promc.NetworkMatrix{Nodes: make(map[string]*promc.NodeMetrics)}
+	if live != nil {
+		out.Missing = live.Missing
+		for id, m := range live.Nodes {
+			at, ok := measuredAt(m.Freshness, now)
+			if prev, cached := s.nodes[id]; ok && cached && len(live.Missing) > 0 {
+				m = withCachedDimensions(live, m, prev)
+				at = prev.ObservedAt // the carried values are no fresher
+			}
+			out.Nodes[id] = m
+			if ok {
+				s.nodes[id] = cachedNode{AvgLatencyMs: m.AvgLatencyMs, DropRate: m.DropRate, BandwidthRate: m.BandwidthRate, ObservedAt: at}
+				s.dirty = true
+			}
+		}
+	}
+	if evicted := evictOldest(s.nodes, c.cfg.Caches.NodesOrDefault(),
+		func(n cachedNode) time.Time { return n.ObservedAt }, func(a, b string) bool { return a < b }); len(evicted) > 0 {
+		s.dirty = true
+		c.debugf("metrics cache full: evicted %d nodes measured longest ago", len(evicted))
+	}
+	restored := 0
+	for id, n := range s.nodes {
+		if now.Sub(n.ObservedAt) > c.metricsCacheMaxAge() {
+			delete(s.nodes, id)
+			s.dirty = true
+			continue
+		}
+		if _, ok := out.Nodes[id]; ok {
+			continue
+		}
+		out.Nodes[id] = &promc.NodeMetrics{
+			NodeID:        id,
+			AvgLatencyMs:  n.AvgLatencyMs,
+			DropRate:      n.DropRate,
+			BandwidthRate: n.BandwidthRate,
+			Freshness:     promc.Measured(n.ObservedAt),
+		}
+		restored++
+	}
+	if restored > 0 {
+		c.debugf("using %d cached node metrics", restored)
+	}
+	if live == nil && len(out.Nodes) == 0 {
+		return nil
+	}
+	return out
+}
+
+// withCachedDimensions returns a copy of m with the dimensions missing from
+// live taken from the cached prev, observed when prev was.
+func withCachedDimensions(live *promc.NetworkMatrix, m *promc.NodeMetrics, prev cachedNode) *promc.NodeMetrics {
+	cp := *m
+	for _, d := range []struct {
+		dim      string
+		to       *float64
+		fallback float64
+	}{
+		{promc.DimensionLatency, &cp.AvgLatencyMs, prev.AvgLatencyMs},
+		{promc.DimensionDrop, &cp.DropRate, prev.DropRate},
+		{promc.DimensionBandwidth, &cp.BandwidthRate, prev.BandwidthRate},
+	} {
+		if !live.Has(d.dim) {
+			*d.to = d.fallback
+		}
+	}
+	cp.Freshness = promc.Measured(prev.ObservedAt)
+	return &cp
+}
+
+// withCachedLatency is withCachedNodes for edge latencies.
+func (c *Controller) withCachedLatency(ctx context.Context, live *promc.ServiceLatencyMatrix) *promc.ServiceLatencyMatrix {
+	if c.metricsCache.backend == nil {
+		return live
+	}
+	var pairs map[promc.ServicePair]float64
+	var fresh map[promc.ServicePair]promc.Freshness
+	if live != nil {
+		pairs, fresh = live.Pairs, live.Freshness
+	}
+	pairs, fresh = c.withCachedPairs(ctx, c.metricsCache.latency, pairs, fresh, "edge latencies")
+	if live == nil && len(pairs) == 0 {
+		return nil
+	}
+	return &promc.ServiceLatencyMatrix{Pairs: pairs, Freshness: fresh}
+}
+
+// withCachedRPS is withCachedNodes for edge request rates.
+func (c *Controller) withCachedRPS(ctx context.Context, live *promc.ServiceRPSMatrix) *promc.ServiceRPSMatrix {
+	if c.metricsCache.backend == nil {
+		return live
+	}
+	var pairs map[promc.ServicePair]float64
+	var fresh map[promc.ServicePair]promc.Freshness
+	if live != nil {
+		pairs, fresh = live.Pairs, live.Freshness
+	}
+	pairs, fresh = c.withCachedPairs(ctx, c.metricsCache.rps, pairs, fresh, "edge request rates")
+	if live == nil && len(pairs) == 0 {
+		return nil
+	}
+	return &promc.ServiceRPSMatrix{Pairs: pairs, Freshness: fresh}
+}
+
+// withCachedPairs records the measured live pairs in cache (one of the
+// store's pair maps) and returns the live pairs plus the cached ones they
+// lack.
+func (c *Controller) withCachedPairs(
+	ctx context.Context,
+	cache map[promc.ServicePair]cachedValue,
+	live map[promc.ServicePair]float64,
+	fresh map[promc.ServicePair]promc.Freshness,
+	what string,
+) (map[promc.ServicePair]float64, map[promc.ServicePair]promc.Freshness) {
+	s := &c.metricsCache
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c.loadMetricsCacheLocked(ctx)
+
+	now := time.Now()
+	pairs := make(map[promc.ServicePair]float64, len(live))
+	freshness := make(map[promc.ServicePair]promc.Freshness, len(live))
+	for k, v := range live {
+		pairs[k], freshness[k] = v, fresh[k]
+		if at, ok := measuredAt(fresh[k], now); ok {
+			cache[k] = cachedValue{v, at}
+			s.dirty = true
+		}
+	}
+	if evicted := evictOldest(cache, c.cfg.Caches.EdgesOrDefault(),
+		func(v cachedValue) time.Time { return v.at }, pairLess); len(evicted) > 0 {
+		s.dirty = true
+		c.debugf("metrics cache full: evicted %d %s measured longest ago", len(evicted), what)
+	}
+	restored := 0
+	for k, cv := range cache {
+		if now.Sub(cv.at) > c.metricsCacheMaxAge() {
+			delete(cache, k)
+			s.dirty = true
+			continue
+		}
+		if _, ok := pairs[k]; ok {
+			continue
+		}
+		pairs[k], freshness[k] = cv.v, promc.Measured(cv.at)
+		restored++
+	}
+	if restored > 0 {
+		c.debugf("using %d cached %s", restored, what)
+	}
+	return pairs, freshness
+}
+
+// saveMetricsCache writes the cache to its backend if live values changed
+// it since the last save.
+func (c *Controller) saveMetricsCache(ctx context.Context, report *reconcileReport) {
+	s := &c.metricsCache
+	if s.backend == nil {
+		return
+	}
+	s.mu.Lock()
+	if !s.dirty {
+		s.mu.Unlock()
+		return
+	}
+	snap := metricsSnapshot{SavedAt: time.Now(), Nodes: make(map[string]cachedNode, len(s.nodes))}
+	for id, n := range s.nodes {
+		snap.Nodes[id] = n
+	}
+	snap.Latency = snapshotPairs(s.latency)
+	snap.RPS = snapshotPairs(s.rps)
+	s.dirty = false
+	s.mu.Unlock()
+
+	b, err := json.Marshal(snap)
+	if err != nil {
+		report.errorf("render metrics cache: %v", err)
+		return
+	}
+	if err := s.backend.Save(ctx, b); err != nil {
+		c.infof("failed to save metrics cache to %s: %v", s.backend, err)
+		report.errorf("save metrics cache: %v", err)
+		s.mu.Lock()
+		s.dirty = true
+		s.mu.Unlock()
+	}
+}
+
+func snapshotPairs(m map[promc.ServicePair]cachedValue) []cachedPair {
+	out := make([]cachedPair, 0, len(m))
+	for k, v := range m {
+		out = append(out, cachedPair{Src: k.Src, Dst: k.Dst, Value: v.v, ObservedAt: v.at})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return pairLess(promc.ServicePair{Src: out[i].Src, Dst: out[i].Dst}, promc.ServicePair{Src: out[j].Src, Dst: out[j].Dst})
+	})
+	return out
+}
+
+func pairLess(a, b promc.ServicePair) bool {
+	if a.Src != b.Src {
+		return a.Src < b.Src
+	}
+	return a.Dst < b.Dst
+}
@@ -0,0 +1,69 @@
+package controller
+
+import (
+	"context"
+
+	promc "lead-net-affinity/pkg/prometheus"
+	"lead-net-affinity/pkg/rbac"
+)
+
+// Namespace-scoped mode: without node read access, node names and IPs are
+// learned from the pods we can see (Spec.NodeName / Status.HostIPs) and zones
+// from the pods' own topology labels (see kube.PodZone).
+
+// podHostIPs maps node name -> host IPs (one per family on dual-stack
+// nodes, normalized) for every node running a pod in the configured
+// namespaces.
+func (c *Controller) podHostIPs(ctx context.Context) map[string][]string {
+	out := make(map[string][]string)
+	for _, ns := range c.cfg.NamespaceSelector {
+		pods, err := c.k8s.ListPods(ctx, ns, "")
+		if err != nil {
+			c.infof("failed to list pods in %s for host IP mapping: %v", ns, err)
+			continue
+		}
+		for _, p := range pods {
+			if p.Spec.NodeName == "" || len(out[p.Spec.NodeName]) > 0 {
+				continue
+			}
+			var ips []string
+			for _, h := range p.Status.HostIPs {
+				ips = append(ips, promc.NormalizeAddress(h.IP))
+			}
+			if len(ips) == 0 && p.Status.HostIP != "" {
+				ips = []string{promc.NormalizeAddress(p.Status.HostIP)}
+			}
+			if len(ips) > 0 {
+				out[p.Spec.NodeName] = preferIPFamily(ips, c.cfg.Prometheus.NodeIPFamily)
+			}
+		}
+	}
+	c.debugf("namespace-scoped: learned %d node IPs from pods", len(out))
+	return out
+}
+
+// newNodeIPResolver returns a resolver backed by node lookups, or by pod host
+// IPs when the nodes feature is unavailable.
+func (c *Controller) newNodeIPResolver(ctx context.Context) *nodeIPResolver {
+	if c.caps.Has(rbac.FeatureNodes) {
+		return &nodeIPResolver{k8s: c.k8s, cache: map[string][]string{}, family: c.cfg.Prometheus.NodeIPFamily}
+	}
+	return &nodeIPResolver{cache: c.podHostIPs(ctx), podsOnly: true}
+}
+
+// nodeNameForIP reverses podHostIPs, also matching a host name to the node
+// name; "" if no visible pod runs on that IP.
+func (c *Controller) nodeNameForIP(ctx context.Context, ip string) string {
+	ip = promc.NormalizeAddress(ip)
+	for name, hostIPs := range c.podHostIPs(ctx) {
+		if promc.SameNode(name, ip) {
+			return name
+		}
+		for _, h := range hostIPs {
+			if h == ip {
+				return name
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,47 @@
+package controller
+
+import (
+	appsv1 "k8s.io/api/apps/v1"
+
+	"lead-net-affinity/pkg/graph"
+	"lead-net-affinity/pkg/rulegen"
+)
+
+const defaultCriticalPathScore = 70
+
+// applySpotPolicy classifies the services on the evaluated paths: a service
+// on any path scoring at least spot.criticalPathScore is critical and kept
+// off spot nodes; the others may prefer spot nodes. Services on no
+// evaluated path are left alone.
+func (c *Controller) applySpotPolicy(paths []graph.Path, deploysBySvc map[graph.NodeID]*appsv1.Deployment) {
+	sc := c.cfg.Spot
+	if !sc.Enabled {
+		return
+	}
+	threshold := sc.CriticalPathScore
+	if threshold <= 0 {
+		threshold = defaultCriticalPathScore
+	}
+
+	critical := make(map[graph.NodeID]bool)
+	for _, p := range paths {
+		for _, n := range p.Nodes {
+			critical[n] = critical[n] || p.FinalScore >= threshold
+		}
+	}
+
+	var nCritical int
+	for svc, isCritical := range critical {
+		d, ok := deploysBySvc[svc]
+		if !ok {
+			continue
+		}
+		if isCritical {
+			rulegen.AvoidSpotNodes(d, sc.NodeLabels, sc.RequireOnDemand)
+			nCritical++
+		} else {
+			rulegen.PreferSpotNodes(d, sc.NodeLabels, int32(sc.PreferSpotWeight))
+		}
+	}
+	c.debugf("spot policy: %d critical of %d services (threshold %.1f)", nCritical, len(critical), threshold)
+}
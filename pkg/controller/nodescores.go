@@ -0,0 +1,134 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"lead-net-affinity/pkg/graph"
+	"lead-net-affinity/pkg/kube"
+	"lead-net-affinity/pkg/output"
+	promc "lead-net-affinity/pkg/prometheus"
+	"lead-net-affinity/pkg/rbac"
+	"lead-net-affinity/pkg/scoring"
+)
+
+// NodeScores is the per-service node desirability of the last full
+// reconcile. A scheduler webhook or extender reads it (GET /node-scores or
+// the node scores ConfigMap) instead of computing metrics on the
+// scheduling hot path.
+type NodeScores struct {
+	GeneratedAt time.Time `json:"generatedAt"`
+	// Services maps service -> node -> score: proximity to the service's
+	// dependencies minus the node's network severity. Higher is better.
+	Services map[string]map[string]float64 `json:"services"`
+	// Excluded nodes (bad, cordoned or draining) have no score and should
+	// not receive pods.
+	Excluded []string `json:"excludedNodes,omitempty"`
+}
+
+// nodeScoresFile is the key the document is published under.
+const nodeScoresFile = "node-scores.json"
+
+type nodeScoresStore struct {
+	mu   sync.RWMutex
+	last NodeScores
+	sink output.Sink
+}
+
+func (s *nodeScoresStore) get() NodeScores {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.last
+}
+
+func (s *nodeScoresStore) set(ns NodeScores) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.last = ns
+}
+
+// NodeScores returns the node scores of the last full reconcile.
+func (c *Controller) NodeScores() NodeScores {
+	return c.nodeScores.get()
+}
+
+// SetNodeScoresSink publishes the node scores after every full reconcile
+// (output.nodeScoresConfigMap).
+func (c *Controller) SetNodeScoresSink(s output.Sink) {
+	c.nodeScores.sink = s
+	c.infof("publishing node scores to %s", s)
+}
+
+// publishNodeScores scores every node hosting graph pods, plus every ready
+// node when node access is granted, for every graph service and publishes
+// the result. Excluded nodes are left out.
+func (c *Controller) publishNodeScores(
+	ctx context.Context,
+	g *graph.Graph,
+	nm *promc.NetworkMatrix,
+	ipResolver scoring.NodeIPResolver,
+	w scoring.NetWeights,
+	badNodes []string,
+	report *reconcileReport,
+) {
+	var nodes kube.NodeGetter
+	if c.caps.Has(rbac.FeatureNodes) {
+		nodes = c.k8s
+	}
+	idx := kube.BuildPlacementIndex(ctx, c.k8s, nodes, c.cfg.NamespaceSelector, c.identity)
+	excluded := append(append([]string{}, badNodes...), c.drainingNodes(ctx)...)
+	sort.Strings(excluded)
+	all := idx.Nodes()
+	if nodes != nil {
+		if list, err := c.k8s.ListNodes(ctx); err == nil {
+			for i := range list {
+				if nodeReady(&list[i]) && !contains(all, list[i].Name) {
+					all = append(all, list[i].Name)
+				}
+			}
+		}
+	}
+	var candidates []string
+	for _, n := range all {
+		if !contains(excluded, n) {
+			candidates = append(candidates, n)
+		}
+	}
+
+	severity := make(map[string]float64, len(candidates))
+	if nm != nil {
+		for _, n := range candidates {
+			if m := nodeMetrics(nm, n, ipResolver); m != nil {
+				severity[n] = scoring.NodeSeverityFromMetrics(m, w)
+			}
+		}
+	}
+
+	edgeRPS := c.fetchEdgeRPS(ctx)
+	doc := NodeScores{GeneratedAt: time.Now(), Services: make(map[string]map[string]float64), Excluded: excluded}
+	for svc := range g.Nodes {
+		scores := scoring.NodeProximityScores(svc, neighborWeights(g, svc, edgeRPS), candidates, idx, c.proximityWeights())
+		for n := range scores {
+			scores[n] -= severity[n]
+		}
+		doc.Services[string(svc)] = scores
+	}
+	c.nodeScores.set(doc)
+	c.debugf("scored %d nodes for %d services", len(candidates), len(doc.Services))
+
+	if c.nodeScores.sink == nil {
+		return
+	}
+	b, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		report.errorf("render node scores: %v", err)
+		return
+	}
+	if err := c.nodeScores.sink.Write(ctx, map[string][]byte{nodeScoresFile: b}); err != nil {
+		c.infof("failed to publish node scores to %s: %v", c.nodeScores.sink, err)
+		report.errorf("publish node scores: %v", err)
+	}
+}
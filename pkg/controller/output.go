@@ -0,0 +1,112 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+
+	"lead-net-affinity/pkg/graph"
+	"lead-net-affinity/pkg/output"
+)
+
+// SetOutputSinks exports the generated affinity after every reconcile as
+// Deployment patches. Sinks are written in dry-run too, so a GitOps pipeline
+// can own the rollout while LEAD only computes the rules.
+func (c *Controller) SetOutputSinks(sinks ...output.Sink) {
+	c.sinks = sinks
+	for _, s := range sinks {
+		c.infof("exporting generated affinity to %s", s)
+	}
+}
+
+// exportAffinity renders the in-scope deployments plus the replica
+// recommendations document and writes them to every sink; failures are
+// recorded on the report but never abort the reconcile.
+func (c *Controller) exportAffinity(
+	ctx context.Context,
+	deploysBySvc map[graph.NodeID]*appsv1.Deployment,
+	recs Recommendations,
+	scope Scope,
+	report *reconcileReport,
+) {
+	if len(c.sinks) == 0 {
+		return
+	}
+	if since, every := time.Since(c.lastExport), time.Duration(c.cfg.Output.IntervalSeconds)*time.Second; since < every {
+		c.debugf("last export %s ago; skipping until output.intervalSeconds (%s) passed", since.Round(time.Second), every)
+		return
+	}
+
+	var deploys []*appsv1.Deployment
+	for svc, d := range deploysBySvc {
+		if scope.includesDeployment(svc, d) {
+			deploys = append(deploys, d)
+		}
+	}
+	sort.Slice(deploys, func(i, j int) bool {
+		return deploys[i].Namespace+"/"+deploys[i].Name < deploys[j].Namespace+"/"+deploys[j].Name
+	})
+
+	files, err := output.Render(deploys, output.TemplatesFor(c.cfg.Output), c.identity, c.servicePorts())
+	if err != nil {
+		c.infof("failed to render affinity patches: %v", err)
+		report.errorf("render output: %v", err)
+		c.componentFailed(ComponentOutput, err)
+		return
+	}
+	if files[recommendationsFile], err = marshalRecommendations(recs); err != nil {
+		c.infof("failed to render recommendations: %v", err)
+		report.errorf("render recommendations: %v", err)
+		delete(files, recommendationsFile)
+	}
+	if gk := c.cfg.Output.Gatekeeper; gk.Enabled {
+		constraints, err := output.Gatekeeper(c.nodeConstraints(deploys), gk.EnforcementAction)
+		if err != nil {
+			c.infof("failed to render Gatekeeper constraints: %v", err)
+			report.errorf("render Gatekeeper constraints: %v", err)
+		}
+		for name, data := range constraints {
+			files[name] = data
+		}
+	}
+
+	c.lastExport = time.Now()
+	var failed error
+	for _, s := range c.sinks {
+		if err := s.Write(ctx, files); err != nil {
+			c.infof("failed to export %d patches to %s: %v", len(files), s, err)
+			report.errorf("export to %s: %v", s, err)
+			failed = fmt.Errorf("%s: %w", s, err)
+			continue
+		}
+		c.debugf("exported %d patches to %s", len(files), s)
+	}
+	if failed != nil {
+		c.componentFailed(ComponentOutput, failed)
+	} else {
+		c.componentOK(ComponentOutput)
+	}
+}
+
+// nodeConstraints are the node requirements of deploys' generated affinity,
+// per service.
+func (c *Controller) nodeConstraints(deploys []*appsv1.Deployment) []output.NodeConstraint {
+	var out []output.NodeConstraint
+	for _, d := range deploys {
+		reqs := output.NodeConstraints(d)
+		if len(reqs) == 0 {
+			continue
+		}
+		svc := c.identity.DeploymentService(d)
+		out = append(out, output.NodeConstraint{
+			Service:      string(svc),
+			Namespace:    d.Namespace,
+			Selector:     c.identity.PodSelector(svc, d.Spec.Template.Labels),
+			Requirements: reqs,
+		})
+	}
+	return out
+}
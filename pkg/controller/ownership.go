@@ -0,0 +1,75 @@
+package controller
+
+import (
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+
+	"lead-net-affinity/pkg/kube"
+)
+
+// Ownership markers on the Deployments the controller updates; see
+// config.OwnershipConfig.
+const (
+	ManagedAnnotation      = kube.ManagedAnnotation
+	ManagerAnnotation      = kube.ManagerAnnotation
+	LastDecisionAnnotation = kube.LastDecisionAnnotation
+	LastUpdateAnnotation   = kube.LastUpdateAnnotation
+)
+
+// DefaultManager is the lead.io/manager value unless ownership.manager is
+// set.
+const DefaultManager = "lead-net-affinity"
+
+// manager is the name this controller marks Deployments with. Tenants get
+// their own, as they manage disjoint Deployments.
+func (c *Controller) manager() string {
+	if m := c.cfg.Ownership.Manager; m != "" {
+		return m
+	}
+	if c.tenant != "" {
+		return DefaultManager + "/" + c.tenant
+	}
+	return DefaultManager
+}
+
+// foreignManager returns the manager that marked d if that is not this
+// controller ("" for a managed marker without a manager).
+func (c *Controller) foreignManager(d *appsv1.Deployment) (string, bool) {
+	if d.Annotations[ManagedAnnotation] != "true" {
+		return "", false
+	}
+	m := d.Annotations[ManagerAnnotation]
+	return m, m != c.manager()
+}
+
+// mayModify reports whether d is this controller's to update: unmarked,
+// marked by it, or taken over with ownership.force.
+func (c *Controller) mayModify(d *appsv1.Deployment) bool {
+	m, foreign := c.foreignManager(d)
+	if !foreign {
+		return true
+	}
+	if c.cfg.Ownership.Force {
+		c.infof("taking over deployment %s/%s from manager %q (ownership.force)", d.Namespace, d.Name, m)
+		return true
+	}
+	c.infof("warning: not updating deployment %s/%s: managed by %q, not %q (set ownership.force to take over)",
+		d.Namespace, d.Name, m, c.manager())
+	return false
+}
+
+// stampOwnership marks d as managed by this controller. The decision and
+// timestamp only move when decision changed d's affinity, so an unchanged
+// Deployment keeps the markers of the update that last changed it.
+func (c *Controller) stampOwnership(d *appsv1.Deployment, decision string, changed bool, now time.Time) {
+	if d.Annotations == nil {
+		d.Annotations = make(map[string]string)
+	}
+	d.Annotations[ManagedAnnotation] = "true"
+	d.Annotations[ManagerAnnotation] = c.manager()
+	if changed || d.Annotations[LastDecisionAnnotation] == "" {
+		d.Annotations[LastDecisionAnnotation] = decision
+		d.Annotations[LastUpdateAnnotation] = now.UTC().Format(time.RFC3339)
+	}
+}
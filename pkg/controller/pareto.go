@@ -0,0 +1,202 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"lead-net-affinity/pkg/graph"
+	"lead-net-affinity/pkg/kube"
+	"lead-net-affinity/pkg/metrics"
+	promc "lead-net-affinity/pkg/prometheus"
+	"lead-net-affinity/pkg/scoring"
+)
+
+var (
+	errUnknownPath = errors.New("no such path")
+	errNotOnFront  = errors.New("path is not on the Pareto front")
+	errParetoOff   = errors.New("pareto ranking is disabled (scoring.pareto.enabled)")
+)
+
+// ParetoPoint is a path with its objectives kept apart.
+type ParetoPoint struct {
+	Path     string         `json:"path"`
+	Services []graph.NodeID `json:"services"`
+
+	// Front is 1 for Pareto-optimal paths: no other path recovers more
+	// latency, moves fewer pods and keeps more replicas all at once.
+	// Front 2 is optimal once front 1 is removed, and so on.
+	Front int `json:"front"`
+
+	Latency    float64 `json:"latency"`    // network penalty co-location can recover (higher is better)
+	Cost       float64 `json:"cost"`       // active pods of the path's services (lower is better)
+	Resilience float64 `json:"resilience"` // ready replicas of the least replicated service (higher is better)
+
+	// PredictedLatencyMs sums the measured edge latencies along the path;
+	// omitted unless every edge has a measurement.
+	PredictedLatencyMs *float64 `json:"predictedLatencyMs,omitempty"`
+
+	FinalScore float64 `json:"finalScore"` // the combined single score, for comparison
+	Selected   bool    `json:"selected,omitempty"`
+}
+
+// ParetoFront is the response of GET /paths/pareto.
+type ParetoFront struct {
+	Time     time.Time     `json:"time"`
+	Selected string        `json:"selected,omitempty"`
+	Points   []ParetoPoint `json:"points"` // by front, then final score
+}
+
+// paretoStore keeps the last reconcile's points and the operator's pick.
+type paretoStore struct {
+	mu       sync.RWMutex
+	time     time.Time
+	points   []ParetoPoint
+	selected string
+}
+
+// update stores points and returns the selection, dropping it if the
+// selected path is no longer on the front.
+func (s *paretoStore) update(points []ParetoPoint, now time.Time) (selected string, dropped bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.time, s.points = now, points
+	if s.selected == "" {
+		return "", false
+	}
+	for i := range points {
+		if points[i].Path == s.selected && points[i].Front == 1 {
+			points[i].Selected = true
+			return s.selected, false
+		}
+	}
+	s.selected = ""
+	return "", true
+}
+
+// rankPareto computes the Pareto fronts of paths (in ranking order)
+// and, if the operator picked a path on the front, ranks it first with the
+// top final score so it gets the strongest affinity.
+func (c *Controller) rankPareto(paths []graph.Path, placements *kube.PlacementResolver, svcLat *promc.ServiceLatencyMatrix) []graph.Path {
+	if !c.cfg.Scoring.Pareto.Enabled || len(paths) == 0 {
+		return paths
+	}
+	objs := make([]scoring.Objectives, len(paths))
+	for i, p := range paths {
+		objs[i] = pathObjectives(p, placements)
+	}
+	fronts := scoring.ParetoFronts(objs)
+
+	points := make([]ParetoPoint, len(paths))
+	onFront := 0
+	for i, p := range paths {
+		points[i] = ParetoPoint{
+			Path:       PathID(p),
+			Services:   p.Nodes,
+			Front:      fronts[i],
+			Latency:    objs[i].Latency,
+			Cost:       objs[i].Cost,
+			Resilience: objs[i].Resilience,
+			FinalScore: p.FinalScore,
+		}
+		if lat, ok := predictedLatency(p, svcLat); ok {
+			points[i].PredictedLatencyMs = &lat
+		}
+		if fronts[i] == 1 {
+			onFront++
+		}
+	}
+	// paths are in ranking order already; a stable sort keeps that order
+	// within a front.
+	sort.SliceStable(points, func(i, j int) bool { return points[i].Front < points[j].Front })
+	metrics.Default.Set("lead_net_pareto_front_size",
+		"Paths on the Pareto front of latency, cost and resilience.", c.metricLabels(), float64(onFront))
+
+	selected, dropped := c.pareto.update(points, time.Now())
+	if dropped {
+		c.infof("warning: the selected Pareto point left the front; ranking by final score again")
+	}
+	if selected == "" {
+		return paths
+	}
+	for i, p := range paths {
+		if PathID(p) != selected {
+			continue
+		}
+		if i > 0 {
+			p.FinalScore = paths[0].FinalScore
+			paths = append([]graph.Path{p}, append(paths[:i:i], paths[i+1:]...)...)
+		}
+		c.infof("ranking the selected Pareto point %s first", selected)
+		break
+	}
+	return paths
+}
+
+// pathObjectives measures p's trade-offs; services without listed pods
+// count as one pod and no ready replica.
+func pathObjectives(p graph.Path, placements *kube.PlacementResolver) scoring.Objectives {
+	o := scoring.Objectives{Latency: p.NetworkPenalty, Resilience: math.Inf(1)}
+	for _, svc := range p.Nodes {
+		r := placements.Replicas(svc)
+		o.Cost += float64(max(r.Ready+r.NotReady, 1))
+		o.Resilience = math.Min(o.Resilience, float64(r.Ready))
+	}
+	if len(p.Nodes) == 0 {
+		o.Resilience = 0
+	}
+	return o
+}
+
+// ParetoFront returns the last reconcile's Pareto ranking.
+func (c *Controller) ParetoFront() ParetoFront {
+	c.pareto.mu.RLock()
+	defer c.pareto.mu.RUnlock()
+	out := ParetoFront{Time: c.pareto.time, Selected: c.pareto.selected, Points: make([]ParetoPoint, len(c.pareto.points))}
+	copy(out.Points, c.pareto.points)
+	return out
+}
+
+// SelectParetoPoint picks the path with the given ID on the front to rank
+// first from the next reconcile on; an empty ID clears the pick.
+func (c *Controller) SelectParetoPoint(id string) error {
+	if !c.cfg.Scoring.Pareto.Enabled {
+		return errParetoOff
+	}
+	c.pareto.mu.Lock()
+	if id != "" {
+		front := -1
+		for _, p := range c.pareto.points {
+			if p.Path == id {
+				front = p.Front
+				break
+			}
+		}
+		switch {
+		case front < 0:
+			c.pareto.mu.Unlock()
+			return fmt.Errorf("%w %q", errUnknownPath, id)
+		case front != 1:
+			c.pareto.mu.Unlock()
+			return fmt.Errorf("%w: %s is on front %d", errNotOnFront, id, front)
+		}
+	}
+	prev := c.pareto.selected
+	c.pareto.selected = id
+	c.pareto.mu.Unlock()
+
+	if id == prev {
+		return nil
+	}
+	if id == "" {
+		c.infof("Pareto selection %s cleared", prev)
+		c.Trigger("pareto selection cleared")
+	} else {
+		c.infof("Pareto point %s selected", id)
+		c.Trigger("pareto selection " + id)
+	}
+	return nil
+}
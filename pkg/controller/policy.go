@@ -0,0 +1,81 @@
+package controller
+
+import (
+	"context"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+
+	"lead-net-affinity/pkg/graph"
+	"lead-net-affinity/pkg/policy"
+)
+
+// SetPolicy wires the evaluator every affinity change and pod eviction
+// must pass (policy.*).
+func (c *Controller) SetPolicy(e policy.Evaluator) {
+	c.policy = e
+	c.infof("enforcing %s", e)
+}
+
+// enforcePolicy evaluates each deployment whose affinity this reconcile
+// changes. Denied changes are reverted to the rules in the cluster,
+// mutations replace the proposed rules.
+func (c *Controller) enforcePolicy(ctx context.Context, deploysBySvc map[graph.NodeID]*appsv1.Deployment, original map[string]*corev1.Affinity) {
+	if c.policy == nil {
+		return
+	}
+	for svc, d := range deploysBySvc {
+		key := d.Namespace + "/" + d.Name
+		before := original[key]
+		if equality.Semantic.DeepEqual(before, d.Spec.Template.Spec.Affinity) {
+			continue
+		}
+		dec, err := c.policy.Evaluate(ctx, policy.Input{
+			Kind: policy.KindAffinity, Service: string(svc), Namespace: d.Namespace, Name: d.Name,
+			Labels: d.Labels, Affinity: d.Spec.Template.Spec.Affinity, Current: before,
+		})
+		if err != nil {
+			if c.cfg.Policy.FailOpen() {
+				c.infof("warning: policy: cannot evaluate affinity of %s; allowing: %v", key, err)
+				continue
+			}
+			c.infof("policy: cannot evaluate affinity of %s; keeping its current rules: %v", key, err)
+			d.Spec.Template.Spec.Affinity = before
+			continue
+		}
+		switch dec.Result {
+		case policy.Deny:
+			c.infof("policy: denied affinity change for %s; keeping its current rules: %s", key, dec.Reason)
+			d.Spec.Template.Spec.Affinity = before
+		case policy.Mutate:
+			c.infof("policy: mutated affinity of %s: %s", key, dec.Reason)
+			d.Spec.Template.Spec.Affinity = dec.Affinity
+		}
+	}
+}
+
+// policyAllowsEviction reports whether the policy lets pod be evicted.
+func (c *Controller) policyAllowsEviction(ctx context.Context, pod *corev1.Pod, reason string) bool {
+	if c.policy == nil {
+		return true
+	}
+	key := pod.Namespace + "/" + pod.Name
+	dec, err := c.policy.Evaluate(ctx, policy.Input{
+		Kind: policy.KindEviction, Service: string(c.identity.ServiceOf(pod.Labels)), Namespace: pod.Namespace, Name: pod.Name,
+		Labels: pod.Labels, Node: pod.Spec.NodeName, Reason: reason,
+	})
+	if err != nil {
+		if c.cfg.Policy.FailOpen() {
+			c.infof("warning: policy: cannot evaluate eviction of %s; allowing: %v", key, err)
+			return true
+		}
+		c.infof("policy: cannot evaluate eviction of %s; keeping the pod: %v", key, err)
+		return false
+	}
+	if dec.Result == policy.Deny {
+		c.infof("policy: denied eviction of %s: %s", key, dec.Reason)
+		return false
+	}
+	return true
+}
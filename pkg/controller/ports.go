@@ -0,0 +1,138 @@
+package controller
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+
+	"lead-net-affinity/pkg/config"
+	"lead-net-affinity/pkg/graph"
+	"lead-net-affinity/pkg/kube"
+	promc "lead-net-affinity/pkg/prometheus"
+	"lead-net-affinity/pkg/rbac"
+)
+
+// serviceLister is optionally implemented by the KubeClient (kube.Client
+// does); ports not declared in graph.services[].ports are discovered with it.
+type serviceLister interface {
+	ListServices(ctx context.Context, namespaces []string) ([]corev1.Service, error)
+}
+
+type servicePortStore struct {
+	mu   sync.RWMutex
+	last map[graph.NodeID][]graph.Port // discovered, per graph service
+}
+
+// discoverPorts reads the ports of every mapped service from the Kubernetes
+// Services selecting its pods. A full reconcile replaces what was known; a
+// scoped one only updates its own services.
+func (c *Controller) discoverPorts(ctx context.Context, namespaces []string, deploysBySvc map[graph.NodeID]*appsv1.Deployment, scope Scope) {
+	lister, ok := c.k8s.(serviceLister)
+	if !ok || !c.caps.Has(rbac.FeatureServicePorts) || len(deploysBySvc) == 0 {
+		return
+	}
+	services, err := lister.ListServices(ctx, namespaces)
+	if err != nil {
+		c.infof("warning: failed to list Services; keeping known service ports: %v", err)
+		return
+	}
+	found := make(map[graph.NodeID][]graph.Port, len(deploysBySvc))
+	for svc, d := range deploysBySvc {
+		if ports := kube.DeploymentPorts(d, services); len(ports) > 0 {
+			found[svc] = ports
+		}
+	}
+	c.debugf("discovered ports of %d/%d services", len(found), len(deploysBySvc))
+
+	s := &c.ports
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if scope.IsEmpty() || s.last == nil {
+		s.last = found
+		return
+	}
+	for svc := range deploysBySvc {
+		if ports, ok := found[svc]; ok {
+			s.last[svc] = ports
+		} else {
+			delete(s.last, svc)
+		}
+	}
+}
+
+// fillServicePorts gives services without declared ports the discovered
+// ones.
+func (c *Controller) fillServicePorts(g *graph.Graph) {
+	s := &c.ports
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for id, n := range g.Nodes {
+		if len(n.Ports) == 0 {
+			n.Ports = s.last[id]
+		}
+	}
+}
+
+// servicePorts returns the ports of every service that has some, declared
+// ones winning over discovered ones.
+func (c *Controller) servicePorts() map[graph.NodeID][]graph.Port {
+	s := &c.ports
+	s.mu.RLock()
+	out := make(map[graph.NodeID][]graph.Port, len(s.last))
+	for id, ports := range s.last {
+		out[id] = ports
+	}
+	s.mu.RUnlock()
+	for _, svc := range c.cfg.Graph.Services {
+		if len(svc.Ports) > 0 {
+			out[graph.NodeID(svc.Name)] = svc.Ports
+		}
+	}
+	return out
+}
+
+// appProtocols returns the app protocol of every service whose ports name
+// one (see graph.Node.AppProtocol).
+func (c *Controller) appProtocols() map[string]string {
+	out := make(map[string]string)
+	for id, ports := range c.servicePorts() {
+		if p := (&graph.Node{Ports: ports}).AppProtocol(); p != "" {
+			out[string(id)] = p
+		}
+	}
+	return out
+}
+
+// familyMeasures reports whether edge family f applies to a callee with the
+// given app protocol: gRPC metrics to gRPC services, TCP metrics to
+// services that do not speak HTTP or gRPC. Services of unknown protocol and
+// custom families are measured by every family, as before ports were known.
+func familyMeasures(f config.EdgeFamilyConfig, proto string) bool {
+	if proto == "" {
+		return true
+	}
+	switch strings.ToLower(strings.TrimSpace(f.Family)) {
+	case config.EdgeFamilyGRPC:
+		return proto == graph.AppProtocolGRPC
+	case config.EdgeFamilyTCP:
+		switch proto {
+		case graph.AppProtocolHTTP, graph.AppProtocolHTTP2, "https", graph.AppProtocolGRPC:
+			return false
+		}
+	}
+	return true
+}
+
+// dropUnmeasured removes the edges of callees family f does not apply to
+// (see familyMeasures).
+func dropUnmeasured(f config.EdgeFamilyConfig, pairs map[promc.ServicePair]float64, fresh map[promc.ServicePair]promc.Freshness, protos map[string]string) {
+	for k := range pairs {
+		if !familyMeasures(f, protos[k.Dst]) {
+			delete(pairs, k)
+			delete(fresh, k)
+		}
+	}
+}
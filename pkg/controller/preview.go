@@ -0,0 +1,92 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+
+	"lead-net-affinity/pkg/graph"
+)
+
+// previewStore keeps the complete affinity each service's deployment
+// would get, as generated by the last reconcile, dry-run or not.
+type previewStore struct {
+	mu          sync.RWMutex
+	generatedAt time.Time
+	affinity    map[string]*corev1.Affinity
+}
+
+func (s *previewStore) get(svc string) (*corev1.Affinity, time.Time, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	a, ok := s.affinity[svc]
+	return a, s.generatedAt, ok
+}
+
+func (s *previewStore) services() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]string, 0, len(s.affinity))
+	for svc := range s.affinity {
+		out = append(out, svc)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// recordPreview snapshots the generated affinity of the in-scope
+// deployments; services outside a scoped reconcile keep their last preview.
+func (c *Controller) recordPreview(deploysBySvc map[graph.NodeID]*appsv1.Deployment, scope Scope) {
+	c.preview.mu.Lock()
+	defer c.preview.mu.Unlock()
+	if scope.IsEmpty() || c.preview.affinity == nil {
+		c.preview.affinity = make(map[string]*corev1.Affinity, len(deploysBySvc))
+	}
+	for svc, d := range deploysBySvc {
+		if !scope.includesDeployment(svc, d) {
+			continue
+		}
+		a := d.Spec.Template.Spec.Affinity.DeepCopy()
+		if a == nil {
+			a = &corev1.Affinity{}
+		}
+		c.preview.affinity[string(svc)] = a
+	}
+	c.preview.generatedAt = time.Now()
+}
+
+// AffinityPreview returns the affinity the last reconcile generated for
+// svc, whether or not it was applied.
+func (c *Controller) AffinityPreview(svc string) (*corev1.Affinity, bool) {
+	a, _, ok := c.preview.get(svc)
+	return a, ok
+}
+
+// handleAffinityPreview serves GET /affinity/preview?service=X as
+// corev1.Affinity YAML; without a service it lists the services.
+func (c *Controller) handleAffinityPreview(w http.ResponseWriter, r *http.Request) {
+	svc := r.URL.Query().Get("service")
+	if svc == "" {
+		writeJSON(w, http.StatusOK, map[string][]string{"services": c.preview.services()})
+		return
+	}
+	a, at, ok := c.preview.get(svc)
+	if !ok {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": fmt.Sprintf("no generated affinity for service %q (no deployment, or no reconcile yet)", svc)})
+		return
+	}
+	b, err := yaml.Marshal(a)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	w.Header().Set("Content-Type", "application/yaml")
+	w.Header().Set("Last-Modified", at.UTC().Format(http.TimeFormat))
+	_, _ = w.Write(b)
+}
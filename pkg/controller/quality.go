@@ -0,0 +1,160 @@
+package controller
+
+import (
+	"maps"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"lead-net-affinity/pkg/graph"
+	"lead-net-affinity/pkg/metrics"
+	promc "lead-net-affinity/pkg/prometheus"
+	"lead-net-affinity/pkg/scoring"
+)
+
+// DataQuality tells which inputs the last reconcile's decisions were based
+// on: measured metrics, inferred ones, or defaults because nothing was
+// measured.
+type DataQuality struct {
+	Time              time.Time     `json:"time"`
+	StaleAfterSeconds float64       `json:"staleAfterSeconds,omitempty"`
+	Nodes             []NodeQuality `json:"nodes"`
+	Edges             []EdgeQuality `json:"edges"`
+}
+
+// NodeQuality describes the network metrics used for a node hosting a
+// graph service.
+type NodeQuality struct {
+	Node string `json:"node"`
+	promc.Freshness
+	Stale bool `json:"stale,omitempty"`
+}
+
+// EdgeQuality describes the latency used for a caller -> callee edge.
+// Inferred marks edges that are not declared but were inferred (DNS).
+type EdgeQuality struct {
+	From      string   `json:"from"`
+	To        string   `json:"to"`
+	Inferred  bool     `json:"inferred,omitempty"`
+	LatencyMs *float64 `json:"latencyMs,omitempty"`
+	promc.Freshness
+	Stale bool `json:"stale,omitempty"`
+}
+
+// DataQuality returns the input quality report of the last reconcile.
+func (c *Controller) DataQuality() DataQuality {
+	c.quality.mu.RLock()
+	defer c.quality.mu.RUnlock()
+	return c.quality.last
+}
+
+type qualityStore struct {
+	mu   sync.RWMutex
+	last DataQuality
+}
+
+func (c *Controller) staleAfter() time.Duration {
+	return time.Duration(c.cfg.Scoring.StaleAfterSeconds) * time.Second
+}
+
+func (c *Controller) scoringLimits() scoring.Limits {
+	l := c.cfg.Scoring.Limits
+	return scoring.Limits{
+		MaxLatencyMs:     l.MaxLatencyMs,
+		MaxDropRate:      l.MaxDropRate,
+		MaxBandwidthRate: l.MaxBandwidthRate,
+		MaxPenaltyFactor: l.MaxPenaltyFactor,
+	}
+}
+
+// recordDataQuality builds the DataQuality report for the nodes hosting
+// graph services and every graph edge, and exports per-confidence counts.
+func (c *Controller) recordDataQuality(
+	g *graph.Graph,
+	placements scoring.PodPlacement,
+	nm *promc.NetworkMatrix,
+	ipResolver scoring.NodeIPResolver,
+	svcLat *promc.ServiceLatencyMatrix,
+) {
+	now := time.Now()
+	staleAfter := c.staleAfter()
+	q := DataQuality{Time: now, StaleAfterSeconds: staleAfter.Seconds(), Nodes: []NodeQuality{}, Edges: []EdgeQuality{}}
+	counts := map[string]map[promc.Confidence]int{"node": {}, "edge": {}}
+
+	ids := make([]string, 0, len(g.Nodes))
+	for id := range g.Nodes {
+		ids = append(ids, string(id))
+	}
+	sort.Strings(ids)
+
+	seen := make(map[string]bool)
+	for _, id := range ids {
+		for _, node := range slices.Sorted(maps.Keys(scoring.ServiceNodes(placements, graph.NodeID(id)))) {
+			if seen[node] {
+				continue
+			}
+			seen[node] = true
+			f := promc.Freshness{Confidence: promc.ConfidenceDefault}
+			if m := nodeMetrics(nm, node, ipResolver); m != nil {
+				f = m.Freshness
+				if f.Confidence == "" {
+					f.Confidence = promc.ConfidenceMeasured
+				}
+			}
+			q.Nodes = append(q.Nodes, NodeQuality{Node: node, Freshness: f, Stale: f.Stale(now, staleAfter)})
+			counts["node"][f.Confidence]++
+		}
+	}
+
+	for _, id := range ids {
+		for _, dep := range g.Nodes[graph.NodeID(id)].DependsOn {
+			e := EdgeQuality{From: id, To: string(dep), Inferred: g.IsInferred(graph.NodeID(id), dep)}
+			e.Freshness = promc.Freshness{Confidence: promc.ConfidenceDefault}
+			if lat, ok := svcLat.Latency(id, string(dep)); ok {
+				e.LatencyMs = &lat
+				e.Freshness = svcLat.FreshnessOf(id, string(dep))
+				if e.Confidence == "" {
+					e.Confidence = promc.ConfidenceMeasured
+				}
+			}
+			e.Stale = e.Freshness.Stale(now, staleAfter)
+			q.Edges = append(q.Edges, e)
+			counts["edge"][e.Confidence]++
+		}
+	}
+
+	c.quality.mu.Lock()
+	c.quality.last = q
+	c.quality.mu.Unlock()
+
+	for kind, byConf := range counts {
+		for _, conf := range []promc.Confidence{promc.ConfidenceMeasured, promc.ConfidenceInferred, promc.ConfidenceDefault, promc.ConfidenceInjected} {
+			labels := map[string]string{"kind": kind, "confidence": string(conf)}
+			for k, v := range c.metricLabels() {
+				labels[k] = v
+			}
+			metrics.Default.Set("lead_net_data_inputs", "Scoring inputs of the last reconcile by confidence.", labels, float64(byConf[conf]))
+		}
+	}
+}
+
+// nodeMetrics looks a node up by name, then by each of its IPs, like the
+// scorer does.
+func nodeMetrics(nm *promc.NetworkMatrix, node string, ipResolver scoring.NodeIPResolver) *promc.NodeMetrics {
+	if m := nm.GetNode(node); m != nil {
+		return m
+	}
+	m, _ := scoring.NodeMetricsByIP(nm, node, ipResolver)
+	return m
+}
+
+// edgeConfidence scales the affinity weight of inferred edges down.
+func edgeConfidence(g *graph.Graph) func(src, dst graph.NodeID) float64 {
+	return func(src, dst graph.NodeID) float64 {
+		if g.IsInferred(src, dst) {
+			return promc.ConfidenceInferred.Weight()
+		}
+		return 1
+	}
+}
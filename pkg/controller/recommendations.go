@@ -0,0 +1,123 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+
+	"lead-net-affinity/pkg/graph"
+)
+
+// ReplicaRecommendation is a scaling decision LEAD does not apply itself;
+// GitOps owners pick it up from GET /recommendations or the output sinks.
+type ReplicaRecommendation struct {
+	ServiceID  string `json:"serviceID"`
+	Namespace  string `json:"namespace"`
+	Deployment string `json:"deployment"`
+	Current    int32  `json:"current"`
+	Target     int32  `json:"target"`
+	Reason     string `json:"reason"`
+}
+
+// Recommendations is the document produced by every reconcile.
+type Recommendations struct {
+	GeneratedAt time.Time               `json:"generatedAt"`
+	Items       []ReplicaRecommendation `json:"items"`
+}
+
+// recommendationsFile is the name the document is exported under.
+const recommendationsFile = "recommendations.json"
+
+type recommendationStore struct {
+	mu   sync.RWMutex
+	last Recommendations
+}
+
+func (s *recommendationStore) get() Recommendations {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.last
+}
+
+func (s *recommendationStore) set(r Recommendations) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.last = r
+}
+
+// Recommendations returns the replica recommendations of the last reconcile.
+func (c *Controller) Recommendations() Recommendations {
+	return c.recs.get()
+}
+
+// recommendReplicas recommends recommendations.minReplicasOnCriticalPath
+// replicas for every in-scope service on the top paths that runs fewer, so
+// a single pod restart cannot take a critical path down, and replicas for
+// load predicted by the trend (see trendRecommendations); the higher
+// target wins. Deployments still rolling out (settling, see
+// settlingDeployments) keep their previous recommendation.
+func (c *Controller) recommendReplicas(
+	paths []graph.Path,
+	top int,
+	deploysBySvc map[graph.NodeID]*appsv1.Deployment,
+	scope Scope,
+	settling map[string]bool,
+) Recommendations {
+	doc := Recommendations{GeneratedAt: time.Now(), Items: []ReplicaRecommendation{}}
+	previous := make(map[string]ReplicaRecommendation)
+	for _, r := range c.recs.get().Items {
+		previous[r.ServiceID] = r
+	}
+	minReplicas := int32(c.cfg.Recommendations.MinReplicasOnCriticalPath)
+	if minReplicas <= 0 {
+		top = 0
+	}
+
+	seen := make(map[graph.NodeID]bool)
+	for i := 0; i < top && i < len(paths); i++ {
+		for _, svc := range paths[i].Nodes {
+			d, ok := deploysBySvc[svc]
+			if !ok || seen[svc] || !scope.includesDeployment(svc, d) {
+				continue
+			}
+			seen[svc] = true
+			if settling[d.Namespace+"/"+d.Name] {
+				c.infof("rollout of %s/%s in progress; not re-evaluating its replicas", d.Namespace, d.Name)
+				if r, ok := previous[string(svc)]; ok {
+					doc.Items = append(doc.Items, r)
+				}
+				continue
+			}
+			current := int32(1)
+			if d.Spec.Replicas != nil {
+				current = *d.Spec.Replicas
+			}
+			if current >= minReplicas {
+				continue
+			}
+			doc.Items = append(doc.Items, ReplicaRecommendation{
+				ServiceID:  string(svc),
+				Namespace:  d.Namespace,
+				Deployment: d.Name,
+				Current:    current,
+				Target:     minReplicas,
+				Reason:     fmt.Sprintf("on critical path #%d (%s) with fewer than %d replicas", i+1, formatPath(paths[i]), minReplicas),
+			})
+		}
+	}
+	doc.Items = mergeRecommendations(doc.Items, c.trendRecommendations(deploysBySvc, scope, settling, previous, seen))
+	sort.Slice(doc.Items, func(i, j int) bool { return doc.Items[i].ServiceID < doc.Items[j].ServiceID })
+
+	for _, r := range doc.Items {
+		c.infof("recommendation: scale %s/%s %d -> %d (%s)", r.Namespace, r.Deployment, r.Current, r.Target, r.Reason)
+	}
+	return doc
+}
+
+func marshalRecommendations(doc Recommendations) ([]byte, error) {
+	return json.MarshalIndent(doc, "", "  ")
+}
@@ -0,0 +1,567 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+
+	"lead-net-affinity/pkg/config"
+	"lead-net-affinity/pkg/dnsinfer"
+	promc "lead-net-affinity/pkg/prometheus"
+	"lead-net-affinity/pkg/rbac"
+	"lead-net-affinity/pkg/tracing"
+)
+
+// Snapshot holds everything one full reconcile read: its config (see
+// config.Config.Redacted), the answers of every Kubernetes and Prometheus
+// call, the cached trace and DNS edges, and what it decided. Replay reruns
+// the decision pipeline on it, so a bug report with a snapshot attached
+// reproduces without access to the cluster.
+type Snapshot struct {
+	Time         time.Time               `json:"time"`
+	Config       *config.Config          `json:"config"`
+	Capabilities rbac.Capabilities       `json:"capabilities,omitempty"`
+	Calls        map[string]RecordedCall `json:"calls"`
+	Traces       *recordedTraces         `json:"traces,omitempty"`
+	DNSEdges     []recordedPair          `json:"dnsEdges,omitempty"`
+	Decisions    *Decisions              `json:"decisions,omitempty"` // nil if the reconcile failed before deciding
+}
+
+// RecordedCall is the answer of one client call, keyed in Snapshot.Calls
+// by method and arguments.
+type RecordedCall struct {
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+// recordedPair is a service pair value; JSON has no struct map keys.
+type recordedPair struct {
+	Src       string           `json:"src"`
+	Dst       string           `json:"dst"`
+	Value     float64          `json:"value"`
+	Freshness *promc.Freshness `json:"freshness,omitempty"`
+}
+
+type recordedTraces struct {
+	Window time.Duration       `json:"window"`
+	At     time.Time           `json:"at"`
+	Edges  []recordedTraceEdge `json:"edges"`
+}
+
+type recordedTraceEdge struct {
+	Src   string             `json:"src"`
+	Dst   string             `json:"dst"`
+	Stats *tracing.EdgeStats `json:"stats"`
+}
+
+type gatewayLatency struct {
+	Ms float64 `json:"ms"`
+	OK bool    `json:"ok"`
+}
+
+var errNotRecorded = errors.New("not recorded in the snapshot")
+
+func callKey(method string, args ...string) string {
+	return method + "(" + strings.Join(args, ", ") + ")"
+}
+
+func pairsOut(pairs map[promc.ServicePair]float64, fresh map[promc.ServicePair]promc.Freshness) []recordedPair {
+	out := make([]recordedPair, 0, len(pairs))
+	for p, v := range pairs {
+		rp := recordedPair{Src: p.Src, Dst: p.Dst, Value: v}
+		if f, ok := fresh[p]; ok {
+			rp.Freshness = &f
+		}
+		out = append(out, rp)
+	}
+	return out
+}
+
+// pairsIn is the inverse of pairsOut, moving observation times by shift.
+func pairsIn(in []recordedPair, shift time.Duration) (map[promc.ServicePair]float64, map[promc.ServicePair]promc.Freshness) {
+	pairs := make(map[promc.ServicePair]float64, len(in))
+	fresh := make(map[promc.ServicePair]promc.Freshness)
+	for _, rp := range in {
+		p := promc.ServicePair{Src: rp.Src, Dst: rp.Dst}
+		pairs[p] = rp.Value
+		if rp.Freshness != nil {
+			fresh[p] = shiftFreshness(*rp.Freshness, shift)
+		}
+	}
+	return pairs, fresh
+}
+
+func shiftFreshness(f promc.Freshness, shift time.Duration) promc.Freshness {
+	if !f.ObservedAt.IsZero() {
+		f.ObservedAt = f.ObservedAt.Add(shift)
+	}
+	return f
+}
+
+// recorder collects the calls of the running full reconcile.
+type recorder struct {
+	mu    sync.Mutex
+	calls map[string]RecordedCall // nil outside a full reconcile
+}
+
+// record keeps the first answer to key of the running reconcile.
+func (r *recorder) record(key string, v any, err error) {
+	var rc RecordedCall
+	if err != nil {
+		rc.Error = err.Error()
+	} else if b, mErr := json.Marshal(v); mErr == nil {
+		rc.Result = b
+	} else {
+		rc.Error = "record: " + mErr.Error()
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.calls[key]; !ok && r.calls != nil {
+		r.calls[key] = rc
+	}
+}
+
+type replayStore struct {
+	rec  *recorder // nil unless server.debug.record
+	mu   sync.RWMutex
+	last *Snapshot
+}
+
+// startRecording begins recording the calls of a full reconcile.
+func (c *Controller) startRecording(scope Scope) {
+	if c.replay.rec == nil || !scope.IsEmpty() {
+		return
+	}
+	c.replay.rec.mu.Lock()
+	c.replay.rec.calls = make(map[string]RecordedCall)
+	c.replay.rec.mu.Unlock()
+}
+
+// saveSnapshot ends the recording started by startRecording and keeps it
+// as the last snapshot.
+func (c *Controller) saveSnapshot(r *reconcileReport, scope Scope) {
+	if c.replay.rec == nil || !scope.IsEmpty() {
+		return
+	}
+	rec := c.replay.rec
+	rec.mu.Lock()
+	s := &Snapshot{Time: r.start, Config: c.cfg.Redacted(), Capabilities: c.caps, Calls: rec.calls}
+	rec.calls = nil
+	rec.mu.Unlock()
+
+	if d := c.Decisions(); !d.GeneratedAt.Before(r.start) {
+		s.Decisions = &d
+	}
+	c.traces.mu.Lock()
+	if e := c.traces.edges; e != nil {
+		s.Traces = &recordedTraces{Window: e.Window, At: e.At}
+		for p, st := range e.Pairs {
+			s.Traces.Edges = append(s.Traces.Edges, recordedTraceEdge{Src: p.Src, Dst: p.Dst, Stats: st})
+		}
+	}
+	c.traces.mu.Unlock()
+	c.dns.mu.Lock()
+	for _, e := range c.dns.edges {
+		s.DNSEdges = append(s.DNSEdges, recordedPair{Src: e.Pair.Src, Dst: e.Pair.Dst, Value: float64(e.Queries)})
+	}
+	c.dns.mu.Unlock()
+
+	c.replay.mu.Lock()
+	c.replay.last = s
+	c.replay.mu.Unlock()
+	c.debugf("recorded %d calls for replay", len(s.Calls))
+}
+
+// LastSnapshot returns the snapshot of the last full reconcile, if
+// server.debug.record is on and one ran.
+func (c *Controller) LastSnapshot() (Snapshot, bool) {
+	c.replay.mu.RLock()
+	defer c.replay.mu.RUnlock()
+	if c.replay.last == nil {
+		return Snapshot{}, false
+	}
+	return *c.replay.last, true
+}
+
+func (c *Controller) handleSnapshot(w http.ResponseWriter, _ *http.Request) {
+	s, ok := c.LastSnapshot()
+	if !ok {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "no full reconcile recorded yet"})
+		return
+	}
+	writeJSON(w, http.StatusOK, s)
+}
+
+// Replay reruns the decision pipeline of s in dry run and returns what it
+// decides. The controller starts without history, so smoothing, trends,
+// forecasts and hysteresis see the recorded values as their first
+// samples; decision hooks and policy modules are not run. Observation
+// times are moved by the snapshot's age so freshness is judged as when it
+// was recorded.
+func Replay(ctx context.Context, s Snapshot) (Decisions, error) {
+	if s.Config == nil {
+		return Decisions{}, fmt.Errorf("snapshot has no config")
+	}
+	cfg := *s.Config
+	cfg.Server.Debug = config.DebugConfig{}
+	now := time.Now()
+	src := &replaySource{calls: s.Calls, shift: now.Sub(s.Time)}
+	c := New(&cfg, src, src)
+	c.dryRun = true
+	c.caps = s.Capabilities
+
+	if t := s.Traces; t != nil {
+		edges := &tracing.Edges{Window: t.Window, At: t.At.Add(src.shift), Pairs: map[promc.ServicePair]*tracing.EdgeStats{}}
+		for _, e := range t.Edges {
+			edges.Pairs[promc.ServicePair{Src: e.Src, Dst: e.Dst}] = e.Stats
+		}
+		c.traces.src, c.traces.edges, c.traces.at = src, edges, now
+	}
+	if len(s.DNSEdges) > 0 {
+		for _, e := range s.DNSEdges {
+			c.dns.edges = append(c.dns.edges, dnsinfer.Edge{Pair: promc.ServicePair{Src: e.Src, Dst: e.Dst}, Queries: int(e.Value)})
+		}
+		c.dns.src, c.dns.at = src, now
+	}
+
+	if err := c.reconcileOnce(ctx); err != nil {
+		return Decisions{}, err
+	}
+	return c.Decisions(), nil
+}
+
+// recordingKube records the reads of a KubeClient; writes pass through.
+type recordingKube struct {
+	KubeClient
+	rec *recorder
+}
+
+func (k recordingKube) ListDeployments(ctx context.Context, namespaces []string) ([]appsv1.Deployment, error) {
+	v, err := k.KubeClient.ListDeployments(ctx, namespaces)
+	k.rec.record(callKey("ListDeployments", namespaces...), v, err)
+	return v, err
+}
+
+func (k recordingKube) ListPods(ctx context.Context, namespace, selector string) ([]corev1.Pod, error) {
+	v, err := k.KubeClient.ListPods(ctx, namespace, selector)
+	k.rec.record(callKey("ListPods", namespace, selector), v, err)
+	return v, err
+}
+
+func (k recordingKube) ListPodsByPhase(ctx context.Context, namespace string, phase corev1.PodPhase) ([]corev1.Pod, error) {
+	v, err := k.KubeClient.ListPodsByPhase(ctx, namespace, phase)
+	k.rec.record(callKey("ListPodsByPhase", namespace, string(phase)), v, err)
+	return v, err
+}
+
+func (k recordingKube) GetNode(ctx context.Context, name string) (*corev1.Node, error) {
+	v, err := k.KubeClient.GetNode(ctx, name)
+	k.rec.record(callKey("GetNode", name), v, err)
+	return v, err
+}
+
+func (k recordingKube) ListNodes(ctx context.Context) ([]corev1.Node, error) {
+	v, err := k.KubeClient.ListNodes(ctx)
+	k.rec.record(callKey("ListNodes"), v, err)
+	return v, err
+}
+
+func (k recordingKube) ListServices(ctx context.Context, namespaces []string) ([]corev1.Service, error) {
+	l, ok := k.KubeClient.(serviceLister)
+	if !ok {
+		return nil, errors.ErrUnsupported
+	}
+	v, err := l.ListServices(ctx, namespaces)
+	k.rec.record(callKey("ListServices", namespaces...), v, err)
+	return v, err
+}
+
+func (k recordingKube) GetDeployment(ctx context.Context, namespace, name string) (*appsv1.Deployment, error) {
+	g, ok := k.KubeClient.(deploymentGetter)
+	if !ok {
+		return nil, errors.ErrUnsupported
+	}
+	return g.GetDeployment(ctx, namespace, name)
+}
+
+func (k recordingKube) ScaleDeployment(ctx context.Context, namespace, name string, delta int32) (int32, error) {
+	s, ok := k.KubeClient.(deploymentScaler)
+	if !ok {
+		return 0, errors.ErrUnsupported
+	}
+	return s.ScaleDeployment(ctx, namespace, name, delta)
+}
+
+func (k recordingKube) ListRollouts(ctx context.Context, namespaces []string) ([]appsv1.Deployment, error) {
+	rc, ok := k.KubeClient.(rolloutClient)
+	if !ok {
+		return nil, errors.ErrUnsupported
+	}
+	v, err := rc.ListRollouts(ctx, namespaces)
+	k.rec.record(callKey("ListRollouts", namespaces...), v, err)
+	return v, err
+}
+
+func (k recordingKube) GetRollout(ctx context.Context, namespace, name string) (*appsv1.Deployment, error) {
+	rc, ok := k.KubeClient.(rolloutClient)
+	if !ok {
+		return nil, errors.ErrUnsupported
+	}
+	return rc.GetRollout(ctx, namespace, name)
+}
+
+func (k recordingKube) UpdateRollout(ctx context.Context, d *appsv1.Deployment) error {
+	rc, ok := k.KubeClient.(rolloutClient)
+	if !ok {
+		return errors.ErrUnsupported
+	}
+	return rc.UpdateRollout(ctx, d)
+}
+
+func (k recordingKube) SetNodeTaint(ctx context.Context, name string, t corev1.Taint, present bool) error {
+	tt, ok := k.KubeClient.(nodeTainter)
+	if !ok {
+		return errors.ErrUnsupported
+	}
+	return tt.SetNodeTaint(ctx, name, t, present)
+}
+
+// recordingProm records the queries of a PromClient.
+type recordingProm struct {
+	PromClient
+	rec *recorder
+}
+
+func (p recordingProm) FetchNetworkMatrix(ctx context.Context, latencyQuery, dropQuery, bwQuery string) (*promc.NetworkMatrix, error) {
+	v, err := p.PromClient.FetchNetworkMatrix(ctx, latencyQuery, dropQuery, bwQuery)
+	p.rec.record(callKey("FetchNetworkMatrix", latencyQuery, dropQuery, bwQuery), v, err)
+	return v, err
+}
+
+func (p recordingProm) FetchServiceLatencies(ctx context.Context, query, srcLabel, dstLabel, unit string) (*promc.ServiceLatencyMatrix, error) {
+	v, err := p.PromClient.FetchServiceLatencies(ctx, query, srcLabel, dstLabel, unit)
+	var out []recordedPair
+	if v != nil {
+		out = pairsOut(v.Pairs, v.Freshness)
+	}
+	p.rec.record(callKey("FetchServiceLatencies", query, srcLabel, dstLabel, unit), out, err)
+	return v, err
+}
+
+func (p recordingProm) FetchServicePairRPS(ctx context.Context, query, srcLabel, dstLabel string) (*promc.ServiceRPSMatrix, error) {
+	v, err := p.PromClient.FetchServicePairRPS(ctx, query, srcLabel, dstLabel)
+	var out []recordedPair
+	if v != nil {
+		out = pairsOut(v.Pairs, v.Freshness)
+	}
+	p.rec.record(callKey("FetchServicePairRPS", query, srcLabel, dstLabel), out, err)
+	return v, err
+}
+
+func (p recordingProm) FetchServicePairBytes(ctx context.Context, query, srcLabel, dstLabel string) (*promc.ServiceBytesMatrix, error) {
+	f, ok := p.PromClient.(bytesFetcher)
+	if !ok {
+		return nil, errors.ErrUnsupported
+	}
+	v, err := f.FetchServicePairBytes(ctx, query, srcLabel, dstLabel)
+	var out []recordedPair
+	if v != nil {
+		out = pairsOut(v.Pairs, nil)
+	}
+	p.rec.record(callKey("FetchServicePairBytes", query, srcLabel, dstLabel), out, err)
+	return v, err
+}
+
+func (p recordingProm) FetchServiceValues(ctx context.Context, kind, query, label string) (map[string]float64, error) {
+	f, ok := p.PromClient.(serviceValueFetcher)
+	if !ok {
+		return nil, errors.ErrUnsupported
+	}
+	v, err := f.FetchServiceValues(ctx, kind, query, label)
+	p.rec.record(callKey("FetchServiceValues", kind, query, label), v, err)
+	return v, err
+}
+
+func (p recordingProm) FetchGatewayLatency(ctx context.Context, query, unit string) (float64, bool, error) {
+	f, ok := p.PromClient.(gatewayFetcher)
+	if !ok {
+		return 0, false, errors.ErrUnsupported
+	}
+	ms, measured, err := f.FetchGatewayLatency(ctx, query, unit)
+	p.rec.record(callKey("FetchGatewayLatency", query, unit), gatewayLatency{ms, measured}, err)
+	return ms, measured, err
+}
+
+func (p recordingProm) FetchDeploymentRollouts(ctx context.Context, selector string) (map[string]promc.DeploymentRollout, error) {
+	f, ok := p.PromClient.(rolloutFetcher)
+	if !ok {
+		return nil, errors.ErrUnsupported
+	}
+	v, err := f.FetchDeploymentRollouts(ctx, selector)
+	p.rec.record(callKey("FetchDeploymentRollouts", selector), v, err)
+	return v, err
+}
+
+func (p recordingProm) Ping(ctx context.Context) error {
+	if pp, ok := p.PromClient.(pinger); ok {
+		return pp.Ping(ctx)
+	}
+	return nil
+}
+
+// replaySource answers the Kubernetes, Prometheus, trace and DNS calls of
+// Replay from a Snapshot. Writes succeed without effect.
+type replaySource struct {
+	calls map[string]RecordedCall
+	shift time.Duration // snapshot age, added to observation times
+}
+
+func (s *replaySource) load(key string, v any) error {
+	rc, ok := s.calls[key]
+	if !ok {
+		return fmt.Errorf("%s: %w", key, errNotRecorded)
+	}
+	if rc.Error != "" {
+		return errors.New(rc.Error)
+	}
+	if len(rc.Result) == 0 {
+		return nil
+	}
+	return json.Unmarshal(rc.Result, v)
+}
+
+func (s *replaySource) ListDeployments(_ context.Context, namespaces []string) ([]appsv1.Deployment, error) {
+	var v []appsv1.Deployment
+	err := s.load(callKey("ListDeployments", namespaces...), &v)
+	return v, err
+}
+
+func (s *replaySource) ListPods(_ context.Context, namespace, selector string) ([]corev1.Pod, error) {
+	var v []corev1.Pod
+	err := s.load(callKey("ListPods", namespace, selector), &v)
+	return v, err
+}
+
+func (s *replaySource) ListPodsByPhase(_ context.Context, namespace string, phase corev1.PodPhase) ([]corev1.Pod, error) {
+	var v []corev1.Pod
+	err := s.load(callKey("ListPodsByPhase", namespace, string(phase)), &v)
+	return v, err
+}
+
+func (s *replaySource) GetNode(_ context.Context, name string) (*corev1.Node, error) {
+	var v *corev1.Node
+	err := s.load(callKey("GetNode", name), &v)
+	return v, err
+}
+
+func (s *replaySource) ListNodes(context.Context) ([]corev1.Node, error) {
+	var v []corev1.Node
+	err := s.load(callKey("ListNodes"), &v)
+	return v, err
+}
+
+func (s *replaySource) ListServices(_ context.Context, namespaces []string) ([]corev1.Service, error) {
+	var v []corev1.Service
+	err := s.load(callKey("ListServices", namespaces...), &v)
+	return v, err
+}
+
+func (s *replaySource) GetDeployment(_ context.Context, namespace, name string) (*appsv1.Deployment, error) {
+	return nil, fmt.Errorf("%s: %w", callKey("GetDeployment", namespace, name), errNotRecorded)
+}
+
+func (s *replaySource) ListRollouts(_ context.Context, namespaces []string) ([]appsv1.Deployment, error) {
+	var v []appsv1.Deployment
+	err := s.load(callKey("ListRollouts", namespaces...), &v)
+	return v, err
+}
+
+func (s *replaySource) GetRollout(_ context.Context, namespace, name string) (*appsv1.Deployment, error) {
+	return nil, fmt.Errorf("%s: %w", callKey("GetRollout", namespace, name), errNotRecorded)
+}
+
+func (s *replaySource) UpdateDeployment(context.Context, *appsv1.Deployment) error { return nil }
+func (s *replaySource) UpdateRollout(context.Context, *appsv1.Deployment) error    { return nil }
+func (s *replaySource) DeletePod(context.Context, string, string) error            { return nil }
+func (s *replaySource) SetNodeTaint(context.Context, string, corev1.Taint, bool) error {
+	return nil
+}
+func (s *replaySource) ScaleDeployment(context.Context, string, string, int32) (int32, error) {
+	return 0, nil
+}
+
+func (s *replaySource) FetchNetworkMatrix(_ context.Context, latencyQuery, dropQuery, bwQuery string) (*promc.NetworkMatrix, error) {
+	var v *promc.NetworkMatrix
+	if err := s.load(callKey("FetchNetworkMatrix", latencyQuery, dropQuery, bwQuery), &v); err != nil || v == nil {
+		return v, err
+	}
+	for _, m := range v.Nodes {
+		m.Freshness = shiftFreshness(m.Freshness, s.shift)
+	}
+	return v, nil
+}
+
+func (s *replaySource) FetchServiceLatencies(_ context.Context, query, srcLabel, dstLabel, unit string) (*promc.ServiceLatencyMatrix, error) {
+	var rp []recordedPair
+	if err := s.load(callKey("FetchServiceLatencies", query, srcLabel, dstLabel, unit), &rp); err != nil {
+		return nil, err
+	}
+	pairs, fresh := pairsIn(rp, s.shift)
+	return &promc.ServiceLatencyMatrix{Pairs: pairs, Freshness: fresh}, nil
+}
+
+func (s *replaySource) FetchServicePairRPS(_ context.Context, query, srcLabel, dstLabel string) (*promc.ServiceRPSMatrix, error) {
+	var rp []recordedPair
+	if err := s.load(callKey("FetchServicePairRPS", query, srcLabel, dstLabel), &rp); err != nil {
+		return nil, err
+	}
+	pairs, fresh := pairsIn(rp, s.shift)
+	return &promc.ServiceRPSMatrix{Pairs: pairs, Freshness: fresh}, nil
+}
+
+func (s *replaySource) FetchServicePairBytes(_ context.Context, query, srcLabel, dstLabel string) (*promc.ServiceBytesMatrix, error) {
+	var rp []recordedPair
+	if err := s.load(callKey("FetchServicePairBytes", query, srcLabel, dstLabel), &rp); err != nil {
+		return nil, err
+	}
+	pairs, _ := pairsIn(rp, s.shift)
+	return &promc.ServiceBytesMatrix{Pairs: pairs}, nil
+}
+
+func (s *replaySource) FetchServiceValues(_ context.Context, kind, query, label string) (map[string]float64, error) {
+	var v map[string]float64
+	err := s.load(callKey("FetchServiceValues", kind, query, label), &v)
+	return v, err
+}
+
+func (s *replaySource) FetchGatewayLatency(_ context.Context, query, unit string) (float64, bool, error) {
+	var v gatewayLatency
+	err := s.load(callKey("FetchGatewayLatency", query, unit), &v)
+	return v.Ms, v.OK, err
+}
+
+func (s *replaySource) FetchDeploymentRollouts(_ context.Context, selector string) (map[string]promc.DeploymentRollout, error) {
+	var v map[string]promc.DeploymentRollout
+	err := s.load(callKey("FetchDeploymentRollouts", selector), &v)
+	return v, err
+}
+
+func (s *replaySource) Ping(context.Context) error { return nil }
+
+// FetchEdges and PodLogs are never reached: Replay seeds the trace and DNS
+// caches with the recorded edges.
+func (s *replaySource) FetchEdges(context.Context, []string, time.Duration, int) (*tracing.Edges, error) {
+	return nil, fmt.Errorf("trace edges: %w", errNotRecorded)
+}
+
+func (s *replaySource) PodLogs(context.Context, string, string, time.Duration) ([]string, error) {
+	return nil, fmt.Errorf("DNS logs: %w", errNotRecorded)
+}
@@ -0,0 +1,328 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	htmltemplate "html/template"
+	"math"
+	"sort"
+	"sync"
+	"text/template"
+	"time"
+
+	"lead-net-affinity/pkg/config"
+	"lead-net-affinity/pkg/output"
+)
+
+const defaultReportPaths = 5
+
+// Report is the placement and health summary of a reporting period
+// (reports.*), also served for the current period by GET /report.
+type Report struct {
+	Schedule string    `json:"schedule"`
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+
+	Reconciles         int `json:"reconciles"`
+	DeploymentsUpdated int `json:"deploymentsUpdated"`
+
+	TopPaths []ReportPath `json:"topPaths"`
+	// PlacementChanges are the pod affinity terms added, removed or
+	// reweighted since the start of the period.
+	PlacementChanges []AffinityChange `json:"placementChanges"`
+	// BadNodes counts, per node, the reconciles that flagged it.
+	BadNodes  []ReportNode       `json:"badNodes"`
+	CrossZone *CrossZoneEstimate `json:"crossZone,omitempty"` // omitted without zone-aware traffic samples
+}
+
+// ReportPath is a top-ranked path with its predicted latency at the start
+// and end of the period (omitted if not measured then).
+type ReportPath struct {
+	RankedPath
+	LatencyStartMs *float64 `json:"latencyStartMs,omitempty"`
+	LatencyEndMs   *float64 `json:"latencyEndMs,omitempty"`
+}
+
+// ReportNode is a node flagged bad during the period.
+type ReportNode struct {
+	Node       string `json:"node"`
+	Reconciles int    `json:"reconciles"`
+}
+
+// CrossZoneEstimate compares the share of critical-path traffic crossing
+// zones under the first recorded decision epoch with the latest sample.
+type CrossZoneEstimate struct {
+	Before      float64 `json:"before"`
+	Now         float64 `json:"now"`
+	BytesPerSec float64 `json:"bytesPerSec"` // critical-path traffic of the latest sample
+	// SavedBytesPerSec is the cross-zone traffic avoided at the current
+	// rate: (Before - Now) * BytesPerSec; negative if it grew.
+	SavedBytesPerSec float64 `json:"savedBytesPerSec"`
+}
+
+type reportTracker struct {
+	mu         sync.Mutex
+	sinks      []output.Sink
+	start      time.Time
+	baseline   Decisions
+	reconciles int
+	updated    int
+	badNodes   map[string]int
+}
+
+// SetReportSinks writes the report of every finished period (reports.*)
+// to sinks.
+func (c *Controller) SetReportSinks(sinks ...output.Sink) {
+	c.reports.sinks = sinks
+	for _, s := range sinks {
+		c.infof("writing %s reports to %s", c.reportSchedule(), s)
+	}
+}
+
+func (c *Controller) reportSchedule() string {
+	if s := c.cfg.Reports.Schedule; s != "" {
+		return s
+	}
+	return config.ReportDaily
+}
+
+// reportPeriodEnd is the end of the period containing t: the next midnight
+// UTC, on a Monday for weekly reports.
+func reportPeriodEnd(t time.Time, schedule string) time.Time {
+	day := time.Date(t.UTC().Year(), t.UTC().Month(), t.UTC().Day(), 0, 0, 0, 0, time.UTC)
+	days := 1
+	if schedule == config.ReportWeekly {
+		days = (int(time.Monday) - int(day.Weekday()) + 7) % 7
+		if days == 0 {
+			days = 7
+		}
+	}
+	return day.AddDate(0, 0, days)
+}
+
+// trackReport adds a finished reconcile to the current period and, once the
+// period is over, writes its report and starts the next one.
+func (c *Controller) trackReport(ctx context.Context, r *reconcileReport, now time.Time) {
+	s := &c.reports
+	s.mu.Lock()
+	if s.start.IsZero() {
+		s.start = now
+		s.baseline = c.Decisions()
+	}
+	s.reconciles++
+	s.updated += r.updated
+	for _, n := range r.bad {
+		if s.badNodes == nil {
+			s.badNodes = make(map[string]int)
+		}
+		s.badNodes[n]++
+	}
+	end := reportPeriodEnd(s.start, c.reportSchedule())
+	if now.Before(end) || len(s.sinks) == 0 {
+		s.mu.Unlock()
+		return
+	}
+	rep := c.buildReport(end)
+	sinks := s.sinks
+	*s = reportTracker{sinks: sinks, start: now, baseline: c.Decisions()}
+	s.mu.Unlock()
+
+	c.writeReport(ctx, rep, sinks)
+}
+
+// CurrentReport is the report of the period so far.
+func (c *Controller) CurrentReport() Report {
+	s := &c.reports
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return c.buildReport(time.Now())
+}
+
+// buildReport reports on the current period up to end; the caller holds
+// c.reports.mu.
+func (c *Controller) buildReport(end time.Time) Report {
+	s := &c.reports
+	rep := Report{
+		Schedule: c.reportSchedule(), Start: s.start, End: end,
+		Reconciles: s.reconciles, DeploymentsUpdated: s.updated,
+		TopPaths: []ReportPath{}, PlacementChanges: []AffinityChange{}, BadNodes: []ReportNode{},
+	}
+
+	now := c.Decisions()
+	top := c.cfg.Reports.TopPaths
+	if top <= 0 {
+		top = defaultReportPaths
+	}
+	for _, p := range now.Paths[:min(top, len(now.Paths))] {
+		rp := ReportPath{RankedPath: p}
+		samples, _ := c.history.get(p.ID)
+		for _, smp := range samples {
+			if smp.Time.Before(s.start) || smp.Time.After(end) || smp.PredictedLatencyMs == nil {
+				continue
+			}
+			if rp.LatencyStartMs == nil {
+				rp.LatencyStartMs = smp.PredictedLatencyMs
+			}
+			rp.LatencyEndMs = smp.PredictedLatencyMs
+		}
+		rep.TopPaths = append(rep.TopPaths, rp)
+	}
+	if diff := DiffDecisions(s.baseline, now); len(diff.Affinity) > 0 {
+		rep.PlacementChanges = diff.Affinity
+	}
+	for n, count := range s.badNodes {
+		rep.BadNodes = append(rep.BadNodes, ReportNode{Node: n, Reconciles: count})
+	}
+	sort.Slice(rep.BadNodes, func(i, j int) bool {
+		if rep.BadNodes[i].Reconciles != rep.BadNodes[j].Reconciles {
+			return rep.BadNodes[i].Reconciles > rep.BadNodes[j].Reconciles
+		}
+		return rep.BadNodes[i].Node < rep.BadNodes[j].Node
+	})
+	rep.CrossZone = crossZoneEstimate(c.Effectiveness())
+	return rep
+}
+
+// crossZoneEstimate compares the first epoch with a cross-zone share to
+// the latest sample with one.
+func crossZoneEstimate(e Effectiveness) *CrossZoneEstimate {
+	var before *float64
+	for _, ep := range e.Epochs {
+		if ep.CrossZoneFraction != nil {
+			before = ep.CrossZoneFraction
+			break
+		}
+	}
+	for i := len(e.Samples) - 1; i >= 0 && before != nil; i-- {
+		smp := e.Samples[i]
+		if smp.CrossZoneFraction == nil {
+			continue
+		}
+		now := *smp.CrossZoneFraction
+		return &CrossZoneEstimate{Before: *before, Now: now, BytesPerSec: smp.BytesPerSec, SavedBytesPerSec: (*before - now) * smp.BytesPerSec}
+	}
+	return nil
+}
+
+// reportFile names a period's report, e.g. report-daily-2026-10-15.md.
+func reportFile(rep Report, format string) string {
+	ext := ".md"
+	if format == config.ReportHTML {
+		ext = ".html"
+	}
+	return "report-" + rep.Schedule + "-" + rep.Start.UTC().Format("2006-01-02") + ext
+}
+
+func (c *Controller) writeReport(ctx context.Context, rep Report, sinks []output.Sink) {
+	format := c.cfg.Reports.Format
+	data, err := RenderReport(rep, format)
+	if err != nil {
+		c.infof("warning: failed to render the %s report: %v", rep.Schedule, err)
+		return
+	}
+	files := map[string][]byte{reportFile(rep, format): data}
+	for _, s := range sinks {
+		if err := s.Write(ctx, files); err != nil {
+			c.infof("warning: failed to write the %s report to %s: %v", rep.Schedule, s, err)
+			continue
+		}
+		c.infof("wrote the %s report for %s to %s", rep.Schedule, rep.Start.UTC().Format("2006-01-02"), s)
+	}
+}
+
+var reportFuncs = template.FuncMap{
+	"date": func(t time.Time) string { return t.UTC().Format("2006-01-02 15:04 MST") },
+	"pct":  func(f float64) string { return fmt.Sprintf("%.1f%%", f*100) },
+	"ms": func(f *float64) string {
+		if f == nil {
+			return "-"
+		}
+		return fmt.Sprintf("%.1f ms", *f)
+	},
+	"rate": formatRate,
+}
+
+// formatRate formats a byte rate with a binary unit, e.g. "1.5 MiB/s".
+func formatRate(b float64) string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+	i := 0
+	for ; i < len(units)-1 && math.Abs(b) >= 1024; i++ {
+		b /= 1024
+	}
+	return fmt.Sprintf("%.1f %s/s", b, units[i])
+}
+
+// RenderReport renders rep as Markdown (default) or HTML.
+func RenderReport(rep Report, format string) ([]byte, error) {
+	var buf bytes.Buffer
+	if format == config.ReportHTML {
+		t, err := htmltemplate.New("report").Funcs(htmltemplate.FuncMap(reportFuncs)).Parse(reportHTML)
+		if err != nil {
+			return nil, err
+		}
+		err = t.Execute(&buf, rep)
+		return buf.Bytes(), err
+	}
+	t, err := template.New("report").Funcs(reportFuncs).Parse(reportMarkdown)
+	if err != nil {
+		return nil, err
+	}
+	err = t.Execute(&buf, rep)
+	return buf.Bytes(), err
+}
+
+const reportMarkdown = `# LEAD placement and health report ({{.Schedule}})
+
+{{date .Start}} to {{date .End}}: {{.Reconciles}} reconciles, {{.DeploymentsUpdated}} deployment updates.
+
+## Top critical paths
+
+| Rank | Path | Score | Latency start | Latency end |
+|---:|---|---:|---:|---:|
+{{range .TopPaths}}| {{.Rank}} | {{.ID}} | {{printf "%.1f" .FinalScore}} | {{ms .LatencyStartMs}} | {{ms .LatencyEndMs}} |
+{{end}}
+## Placement changes
+
+{{if .PlacementChanges}}| Service | Peer | Topology | Weight before | Weight after |
+|---|---|---|---:|---:|
+{{range .PlacementChanges}}| {{.Service}} | {{.Peer}} | {{.TopologyKey}} | {{.WeightBefore}} | {{.WeightAfter}} |
+{{end}}{{else}}No affinity changes.
+{{end}}
+## Nodes flagged bad
+
+{{if .BadNodes}}{{range .BadNodes}}- {{.Node}}: {{.Reconciles}} reconciles
+{{end}}{{else}}None.
+{{end}}
+## Cross-zone traffic
+
+{{with .CrossZone}}Critical-path traffic crossing zones: {{pct .Before}} before LEAD's rules, {{pct .Now}} now. Estimated cross-zone traffic saved: {{rate .SavedBytesPerSec}} (of {{rate .BytesPerSec}}).
+{{else}}Not measured (needs prometheus.servicePairBytesQuery and zone-labelled nodes).
+{{end}}`
+
+const reportHTML = `<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>LEAD {{.Schedule}} report</title></head>
+<body>
+<h1>LEAD placement and health report ({{.Schedule}})</h1>
+<p>{{date .Start}} to {{date .End}}: {{.Reconciles}} reconciles, {{.DeploymentsUpdated}} deployment updates.</p>
+<h2>Top critical paths</h2>
+<table>
+<tr><th>Rank</th><th>Path</th><th>Score</th><th>Latency start</th><th>Latency end</th></tr>
+{{range .TopPaths}}<tr><td>{{.Rank}}</td><td>{{.ID}}</td><td>{{printf "%.1f" .FinalScore}}</td><td>{{ms .LatencyStartMs}}</td><td>{{ms .LatencyEndMs}}</td></tr>
+{{end}}</table>
+<h2>Placement changes</h2>
+{{if .PlacementChanges}}<table>
+<tr><th>Service</th><th>Peer</th><th>Topology</th><th>Weight before</th><th>Weight after</th></tr>
+{{range .PlacementChanges}}<tr><td>{{.Service}}</td><td>{{.Peer}}</td><td>{{.TopologyKey}}</td><td>{{.WeightBefore}}</td><td>{{.WeightAfter}}</td></tr>
+{{end}}</table>
+{{else}}<p>No affinity changes.</p>
+{{end}}<h2>Nodes flagged bad</h2>
+{{if .BadNodes}}<ul>
+{{range .BadNodes}}<li>{{.Node}}: {{.Reconciles}} reconciles</li>
+{{end}}</ul>
+{{else}}<p>None.</p>
+{{end}}<h2>Cross-zone traffic</h2>
+{{with .CrossZone}}<p>Critical-path traffic crossing zones: {{pct .Before}} before LEAD's rules, {{pct .Now}} now. Estimated cross-zone traffic saved: {{rate .SavedBytesPerSec}} (of {{rate .BytesPerSec}}).</p>
+{{else}}<p>Not measured (needs prometheus.servicePairBytesQuery and zone-labelled nodes).</p>
+{{end}}</body></html>
+`
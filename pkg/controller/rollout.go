@@ -0,0 +1,181 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+
+	"lead-net-affinity/pkg/kube"
+	"lead-net-affinity/pkg/metrics"
+)
+
+const defaultRolloutHealthTimeout = 5 * time.Minute
+
+// deploymentGetter is optionally implemented by the KubeClient (kube.Client
+// does); without it batches are paced but not health-gated.
+type deploymentGetter interface {
+	GetDeployment(ctx context.Context, namespace, name string) (*appsv1.Deployment, error)
+}
+
+// rolloutState is the batch a staggered rollout is waiting on. The
+// deployments still to update are not stored: every reconcile derives them
+// again, as the ones whose affinity differs from the generated one.
+type rolloutState struct {
+	batch     []*appsv1.Deployment
+	appliedAt time.Time
+}
+
+// applyUpdates writes the deployments. Those whose affinity changes, as
+// changed tells by namespace/name, restart their pods and roll out in
+// batches of rollout.batchSize, in namespace/name order, one batch per
+// reconcile; the others are written at once. While changed deployments
+// remain, later reconciles hold them until rollout.batchIntervalSeconds
+// have passed since the last batch and, with rollout.healthGate, it has
+// rolled out; a reconcile is triggered when the interval is up. A batch
+// that does not roll out within rollout.healthTimeoutSeconds halts the
+// rollout: that reconcile defers every changed deployment and the next
+// one starts over with what is still left. No reconcile blocks on a batch.
+func (c *Controller) applyUpdates(ctx context.Context, deploys []*appsv1.Deployment, changed map[string]bool, report *reconcileReport) int {
+	sort.Slice(deploys, func(i, j int) bool {
+		if deploys[i].Namespace != deploys[j].Namespace {
+			return deploys[i].Namespace < deploys[j].Namespace
+		}
+		return deploys[i].Name < deploys[j].Name
+	})
+	var write, rolling []*appsv1.Deployment
+	for _, d := range deploys {
+		if changed[d.Namespace+"/"+d.Name] {
+			rolling = append(rolling, d)
+		} else {
+			write = append(write, d)
+		}
+	}
+
+	held := false
+	if len(rolling) > 0 && len(c.rollout.batch) > 0 {
+		waiting, err := c.batchPending(ctx)
+		switch {
+		case err != nil:
+			c.rollout = rolloutState{}
+			c.infof("rollout halted, %d deployments deferred: %v", len(rolling), err)
+			report.errorf("rollout halted, %d deployments deferred: %v", len(rolling), err)
+			held = true
+		case waiting:
+			c.debugf("rollout waiting for the previous batch, %d deployments deferred", len(rolling))
+			held = true
+		}
+	}
+	size := 0
+	if !held {
+		c.rollout = rolloutState{}
+		size = c.cfg.Rollout.BatchSize
+		if size <= 0 || size > len(rolling) {
+			size = len(rolling)
+		}
+		write = append(write, rolling[:size]...)
+	}
+	deferred := len(rolling) - size
+
+	updated := 0
+	var lastErr error
+	var batch []*appsv1.Deployment
+	for _, d := range write {
+		if rolloutInProgress(d) {
+			c.infof("not updating rollout %s/%s while %s; retrying next reconcile", d.Namespace, d.Name, kube.RolloutPhase(d))
+			report.degradedf("update %s/%s deferred: rollout %s", d.Namespace, d.Name, kube.RolloutPhase(d))
+			continue
+		}
+		if err := c.beforeApply(ctx, d); err != nil {
+			c.infof("not updating %s/%s: %v", d.Namespace, d.Name, err)
+			report.errorf("update %s/%s held: %v", d.Namespace, d.Name, err)
+			continue
+		}
+		err := c.updateWorkload(ctx, d)
+		c.afterApply(ctx, d, err)
+		if err != nil {
+			c.infof("update failed: %s/%s: %v", d.Namespace, d.Name, err)
+			report.errorf("update %s/%s: %v", d.Namespace, d.Name, err)
+			lastErr = err
+			continue
+		}
+		updated++
+		if changed[d.Namespace+"/"+d.Name] {
+			batch = append(batch, d)
+		}
+	}
+	if deferred > 0 && !held {
+		c.infof("rollout updated %d of %d changed deployments; the rest follow in later reconciles", size, len(rolling))
+		if len(batch) > 0 {
+			c.rollout = rolloutState{batch: batch, appliedAt: time.Now()}
+		}
+		if d := time.Duration(c.cfg.Rollout.BatchIntervalSeconds) * time.Second; d > 0 {
+			time.AfterFunc(d, func() { c.Trigger("rollout batch interval elapsed") })
+		}
+	}
+	metrics.Default.Set("lead_net_rollout_deferred", "Deployment updates deferred to a later reconcile by a staggered or halted rollout.",
+		c.metricLabels(), float64(deferred))
+	if lastErr != nil {
+		c.componentFailed(ComponentUpdates, lastErr)
+	} else if updated > 0 {
+		c.componentOK(ComponentUpdates)
+	}
+	return updated
+}
+
+// batchPending reports whether the next batch must still wait for the
+// last one: for rollout.batchIntervalSeconds and, with the health gate,
+// until every deployment (or Argo Rollout) in it has rolled out. It
+// checks once and does not wait; an error halts the rollout.
+func (c *Controller) batchPending(ctx context.Context) (bool, error) {
+	rc := c.cfg.Rollout
+	elapsed := time.Since(c.rollout.appliedAt)
+	if elapsed < time.Duration(rc.BatchIntervalSeconds)*time.Second {
+		return true, nil
+	}
+	if !rc.HealthGate {
+		return false, nil
+	}
+	timeout := defaultRolloutHealthTimeout
+	if rc.HealthTimeoutSeconds > 0 {
+		timeout = time.Duration(rc.HealthTimeoutSeconds) * time.Second
+	}
+	for _, d := range c.rollout.batch {
+		cur, ok, err := c.getWorkload(ctx, d)
+		if !ok {
+			continue // cannot be read back: paced only
+		}
+		if err != nil {
+			return false, fmt.Errorf("get %s/%s: %w", d.Namespace, d.Name, err)
+		}
+		done, err := kube.RolloutComplete(cur)
+		if err != nil {
+			return false, err
+		}
+		if done {
+			continue
+		}
+		if elapsed > timeout {
+			return false, fmt.Errorf("%s/%s did not roll out within %s", d.Namespace, d.Name, timeout)
+		}
+		c.debugf("waiting for %s/%s to roll out", d.Namespace, d.Name)
+		return true, nil
+	}
+	return false, nil
+}
+
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
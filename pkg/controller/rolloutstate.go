@@ -0,0 +1,48 @@
+package controller
+
+import (
+	"context"
+	"sort"
+
+	"lead-net-affinity/pkg/metrics"
+	promc "lead-net-affinity/pkg/prometheus"
+)
+
+// rolloutFetcher is implemented by Prometheus clients that can read the
+// kube-state-metrics Deployment series.
+type rolloutFetcher interface {
+	FetchDeploymentRollouts(ctx context.Context, selector string) (map[string]promc.DeploymentRollout, error)
+}
+
+// settlingDeployments returns the Deployments ("namespace/name") whose
+// latest change kube-state-metrics does not yet report as rolled out, or
+// nil if prometheus.kubeStateMetrics is off or unavailable. A scaling
+// decision about such a Deployment has not taken effect yet, so it is not
+// re-evaluated.
+func (c *Controller) settlingDeployments(ctx context.Context) map[string]bool {
+	ksm := c.cfg.Prometheus.KubeStateMetrics
+	f, ok := c.prom.(rolloutFetcher)
+	if !ksm.Enabled || !ok {
+		return nil
+	}
+	rollouts, err := f.FetchDeploymentRollouts(ctx, ksm.Selector)
+	if err != nil {
+		c.infof("warning: failed to fetch kube-state-metrics rollout state; not waiting for rollouts: %v", err)
+		return nil
+	}
+	settling := make(map[string]bool)
+	var names []string
+	for key, r := range rollouts {
+		if !r.Settled() {
+			settling[key] = true
+			names = append(names, key)
+		}
+	}
+	if len(names) > 0 {
+		sort.Strings(names)
+		c.infof("rollouts in progress (kube-state-metrics): %v", names)
+	}
+	metrics.Default.Set("lead_net_rollouts_in_progress",
+		"Deployments whose latest change kube-state-metrics does not yet report as rolled out.", c.metricLabels(), float64(len(settling)))
+	return settling
+}
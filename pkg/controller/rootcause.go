@@ -0,0 +1,157 @@
+package controller
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"lead-net-affinity/pkg/graph"
+	promc "lead-net-affinity/pkg/prometheus"
+)
+
+// RootCauseReport is the response of GET /root-cause: which services most
+// likely cause the paths missing their latency objective (slo.*).
+type RootCauseReport struct {
+	Time       time.Time       `json:"time"`
+	Violations []PathViolation `json:"violations"`
+	Culprits   []RootCause     `json:"culprits"` // largest excess first
+}
+
+// PathViolation is a path above its latency objective.
+type PathViolation struct {
+	Path        string  `json:"path"`
+	LatencyMs   float64 `json:"latencyMs"`
+	ObjectiveMs float64 `json:"objectiveMs"`
+}
+
+// RootCause is a service at the end of a chain of slow calls from the
+// entry: the call into it is above its edge latency threshold but none of
+// its own calls is, so the time is spent in the service (or its node).
+type RootCause struct {
+	Service   string     `json:"service"`
+	Edge      graph.Edge `json:"edge"` // the slow call into the service
+	LatencyMs float64    `json:"latencyMs"`
+	ExcessMs  float64    `json:"excessMs"` // latency above the threshold
+	Chain     []string   `json:"chain"`    // slow calls from the entry, entry first
+	Node      string     `json:"node,omitempty"`
+	NodeBad   bool       `json:"nodeBad,omitempty"`
+	Paths     []string   `json:"paths"` // violating paths through the slow call
+}
+
+type rootCauseStore struct {
+	mu   sync.RWMutex
+	last RootCauseReport
+}
+
+// RootCause returns the root-cause report of the last reconcile.
+func (c *Controller) RootCause() RootCauseReport {
+	c.rootCause.mu.RLock()
+	defer c.rootCause.mu.RUnlock()
+	return c.rootCause.last
+}
+
+// recordRootCause localizes the paths over their objective in the health
+// summary (call it after recordHealth). From the entry it follows every
+// call above the callee's edge latency threshold (thresholds[] or
+// scoring.badEdgeLatencyMs); services where such a chain ends are the
+// culprits. Edges without a threshold are never judged slow.
+func (c *Controller) recordRootCause(
+	g *graph.Graph,
+	paths []graph.Path,
+	svcLat *promc.ServiceLatencyMatrix,
+	thresholds serviceThresholds,
+) {
+	rep := RootCauseReport{Time: time.Now(), Violations: []PathViolation{}, Culprits: []RootCause{}}
+	hs := c.HealthSummary()
+	for _, ph := range hs.Paths {
+		if ph.ObjectiveMs > 0 && ph.LatencyMs != nil && *ph.LatencyMs > ph.ObjectiveMs {
+			rep.Violations = append(rep.Violations, PathViolation{Path: ph.Path, LatencyMs: *ph.LatencyMs, ObjectiveMs: ph.ObjectiveMs})
+		}
+	}
+	if len(rep.Violations) > 0 && svcLat != nil {
+		nodes := make(map[string]ServiceHealth, len(hs.Services))
+		for _, sh := range hs.Services {
+			nodes[sh.Service] = sh
+		}
+		found := make(map[graph.Edge]bool)
+		c.walkSlowCalls(g, []string{string(g.Entry)}, nil, svcLat, thresholds, func(rc RootCause) {
+			if found[rc.Edge] {
+				return // reached again through another chain
+			}
+			found[rc.Edge] = true
+			rc.Node = nodes[rc.Service].Node
+			rc.NodeBad = nodes[rc.Service].Status == HealthUnhealthy
+			rc.Paths = violatingPathsThrough(rep.Violations, paths, rc.Edge)
+			if len(rc.Paths) > 0 {
+				rep.Culprits = append(rep.Culprits, rc)
+			}
+		})
+		sort.SliceStable(rep.Culprits, func(i, j int) bool { return rep.Culprits[i].ExcessMs > rep.Culprits[j].ExcessMs })
+	}
+	if n := len(rep.Culprits); n > 0 {
+		c.infof("root cause: %d paths over their latency objective; most likely culprit %s (%s -> %s %.1fms, %.1fms over)",
+			len(rep.Violations), rep.Culprits[0].Service, rep.Culprits[0].Edge.From, rep.Culprits[0].Edge.To,
+			rep.Culprits[0].LatencyMs, rep.Culprits[0].ExcessMs)
+	}
+
+	c.rootCause.mu.Lock()
+	c.rootCause.last = rep
+	c.rootCause.mu.Unlock()
+}
+
+// walkSlowCalls follows the slow calls out of the last service of chain;
+// in is the slow call that led there, reported once no slow call leaves.
+func (c *Controller) walkSlowCalls(
+	g *graph.Graph,
+	chain []string,
+	in *RootCause,
+	svcLat *promc.ServiceLatencyMatrix,
+	thresholds serviceThresholds,
+	report func(RootCause),
+) {
+	svc := graph.NodeID(chain[len(chain)-1])
+	slow := false
+	if n, ok := g.Nodes[svc]; ok {
+		for _, dep := range n.DependsOn {
+			lat, ok := svcLat.Latency(string(svc), string(dep))
+			t := thresholds.edgeLatencyMs(dep)
+			if !ok || t <= 0 || lat <= t || contains(chain, string(dep)) {
+				continue
+			}
+			slow = true
+			next := append(append([]string(nil), chain...), string(dep))
+			c.walkSlowCalls(g, next, &RootCause{
+				Service:   string(dep),
+				Edge:      graph.Edge{From: string(svc), To: string(dep)},
+				LatencyMs: lat,
+				ExcessMs:  lat - t,
+				Chain:     next,
+			}, svcLat, thresholds, report)
+		}
+	}
+	if !slow && in != nil {
+		report(*in)
+	}
+}
+
+// violatingPathsThrough returns the violating paths that contain the call e.
+func violatingPathsThrough(violations []PathViolation, paths []graph.Path, e graph.Edge) []string {
+	violated := make(map[string]bool, len(violations))
+	for _, v := range violations {
+		violated[v.Path] = true
+	}
+	var out []string
+	for _, p := range paths {
+		id := PathID(p)
+		if !violated[id] {
+			continue
+		}
+		for i := 0; i+1 < len(p.Nodes); i++ {
+			if string(p.Nodes[i]) == e.From && string(p.Nodes[i+1]) == e.To {
+				out = append(out, id)
+				break
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,76 @@
+package controller
+
+import (
+	"context"
+
+	appsv1 "k8s.io/api/apps/v1"
+
+	"lead-net-affinity/pkg/graph"
+)
+
+// Scope limits a reconcile to a subset of the graph. An empty Scope means
+// "everything". With Services set, only paths containing one of them are
+// scored and only their deployments are patched; with Namespaces set, only
+// deployments in those namespaces are considered.
+type Scope struct {
+	Services   []string `json:"services,omitempty"`
+	Namespaces []string `json:"namespaces,omitempty"`
+}
+
+func (s Scope) IsEmpty() bool {
+	return len(s.Services) == 0 && len(s.Namespaces) == 0
+}
+
+// filterPaths keeps the paths that contain at least one scoped service.
+func (s Scope) filterPaths(paths []graph.Path) []graph.Path {
+	if len(s.Services) == 0 {
+		return paths
+	}
+	var out []graph.Path
+	for _, p := range paths {
+		for _, n := range p.Nodes {
+			if contains(s.Services, string(n)) {
+				out = append(out, p)
+				break
+			}
+		}
+	}
+	return out
+}
+
+// namespaces intersects the scoped namespaces with the configured ones.
+func (s Scope) namespaces(configured []string) []string {
+	if len(s.Namespaces) == 0 {
+		return configured
+	}
+	var out []string
+	for _, ns := range s.Namespaces {
+		if contains(configured, ns) {
+			out = append(out, ns)
+		}
+	}
+	return out
+}
+
+// includesDeployment reports whether the deployment of svc may be patched.
+func (s Scope) includesDeployment(svc graph.NodeID, d *appsv1.Deployment) bool {
+	if len(s.Services) > 0 && !contains(s.Services, string(svc)) {
+		return false
+	}
+	if len(s.Namespaces) > 0 && !contains(s.Namespaces, d.Namespace) {
+		return false
+	}
+	return true
+}
+
+// ReconcileScoped runs a single reconcile restricted to scope. It is meant for
+// targeted debugging and fast iteration on one service or namespace.
+func (c *Controller) ReconcileScoped(ctx context.Context, scope Scope) error {
+	c.infof("=== LEAD-NET SCOPED RECONCILIATION services=%v namespaces=%v ===", scope.Services, scope.Namespaces)
+	if !c.reconciling.CompareAndSwap(false, true) {
+		c.infof("scoped reconcile rejected: a reconcile is already running")
+		return errReconcileInProgress
+	}
+	defer c.reconciling.Store(false)
+	return c.reconcile(ctx, scope)
+}
@@ -0,0 +1,145 @@
+package controller
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"lead-net-affinity/pkg/graph"
+	"lead-net-affinity/pkg/metrics"
+)
+
+// SelectorCheck is the response of GET /selectors: generated pod affinity
+// terms whose label selector matches no running pod. Such a term is a
+// silent no-op for the scheduler, usually because of a label mismatch.
+type SelectorCheck struct {
+	Time      time.Time           `json:"time"`
+	Checked   int                 `json:"checked"` // distinct selectors checked
+	Unmatched []UnmatchedSelector `json:"unmatched"`
+}
+
+// UnmatchedSelector is a pod affinity term of Service's deployment that
+// selects no running pod in Namespaces.
+type UnmatchedSelector struct {
+	Service    string            `json:"service"`
+	Namespaces []string          `json:"namespaces"`
+	Selector   map[string]string `json:"selector"`
+	Anti       bool              `json:"anti,omitempty"` // a pod anti-affinity term
+}
+
+type selectorCheckStore struct {
+	mu   sync.RWMutex
+	last SelectorCheck
+}
+
+// SelectorCheck returns the selector check of the last reconcile.
+func (c *Controller) SelectorCheck() SelectorCheck {
+	c.selectors.mu.RLock()
+	defer c.selectors.mu.RUnlock()
+	return c.selectors.last
+}
+
+// checkSelectors verifies that every preferred pod (anti-)affinity term of
+// the in-scope deployments matches at least one running pod in the term's
+// namespaces (the deployment's own by default). Unmatched terms are logged
+// as warnings and counted in lead_net_affinity_selectors_unmatched. Each
+// distinct selector is listed once per namespace.
+func (c *Controller) checkSelectors(ctx context.Context, deploysBySvc map[graph.NodeID]*appsv1.Deployment, scope Scope) {
+	type lookup struct{ namespace, selector string }
+	matched := make(map[lookup]bool)
+	matches := func(ns string, sel *metav1.LabelSelector) bool {
+		s, err := metav1.LabelSelectorAsSelector(sel)
+		if err != nil {
+			return false
+		}
+		k := lookup{ns, s.String()}
+		if m, ok := matched[k]; ok {
+			return m
+		}
+		pods, err := c.k8s.ListPods(ctx, ns, k.selector)
+		if err != nil {
+			c.infof("selector check: list pods %q in %s failed: %v", k.selector, ns, err)
+			return true // unknown, not a mismatch
+		}
+		m := false
+		for _, p := range pods {
+			if p.Status.Phase == corev1.PodRunning && p.DeletionTimestamp == nil {
+				m = true
+				break
+			}
+		}
+		matched[k] = m
+		return m
+	}
+
+	out := SelectorCheck{Time: time.Now(), Unmatched: []UnmatchedSelector{}}
+	for svc, d := range deploysBySvc {
+		if !scope.includesDeployment(svc, d) || d.Spec.Template.Spec.Affinity == nil {
+			continue
+		}
+		aff := d.Spec.Template.Spec.Affinity
+		var terms []corev1.WeightedPodAffinityTerm
+		var anti []bool
+		if aff.PodAffinity != nil {
+			for _, t := range aff.PodAffinity.PreferredDuringSchedulingIgnoredDuringExecution {
+				terms, anti = append(terms, t), append(anti, false)
+			}
+		}
+		if aff.PodAntiAffinity != nil {
+			for _, t := range aff.PodAntiAffinity.PreferredDuringSchedulingIgnoredDuringExecution {
+				terms, anti = append(terms, t), append(anti, true)
+			}
+		}
+		for i, t := range terms {
+			sel := t.PodAffinityTerm.LabelSelector
+			if sel == nil {
+				continue
+			}
+			namespaces := t.PodAffinityTerm.Namespaces
+			if len(namespaces) == 0 {
+				namespaces = []string{d.Namespace}
+			}
+			found := false
+			for _, ns := range namespaces {
+				if matches(ns, sel) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				kind := "affinity"
+				if anti[i] {
+					kind = "anti-affinity"
+				}
+				c.infof("warning: pod %s term of %s/%s selects no running pod: %v in %v",
+					kind, d.Namespace, d.Name, sel.MatchLabels, namespaces)
+				out.Unmatched = append(out.Unmatched, UnmatchedSelector{
+					Service:    string(svc),
+					Namespaces: namespaces,
+					Selector:   sel.MatchLabels,
+					Anti:       anti[i],
+				})
+			}
+		}
+	}
+	sort.Slice(out.Unmatched, func(i, j int) bool {
+		if out.Unmatched[i].Service != out.Unmatched[j].Service {
+			return out.Unmatched[i].Service < out.Unmatched[j].Service
+		}
+		return labels.Set(out.Unmatched[i].Selector).String() < labels.Set(out.Unmatched[j].Selector).String()
+	})
+	out.Checked = len(matched)
+
+	metrics.Default.Set("lead_net_affinity_selectors_unmatched",
+		"Generated pod affinity terms whose selector matches no running pod.", c.metricLabels(), float64(len(out.Unmatched)))
+
+	c.selectors.mu.Lock()
+	c.selectors.last = out
+	c.selectors.mu.Unlock()
+}
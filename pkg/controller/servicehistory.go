@@ -0,0 +1,183 @@
+package controller
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"lead-net-affinity/pkg/graph"
+	"lead-net-affinity/pkg/history"
+	"lead-net-affinity/pkg/kube"
+	promc "lead-net-affinity/pkg/prometheus"
+)
+
+// ServiceSample is one reconcile's metrics of a service, as in its
+// ServiceHealth.
+type ServiceSample struct {
+	Time         time.Time      `json:"time"`
+	Status       string         `json:"status"`
+	NodeSeverity float64        `json:"nodeSeverity"`
+	Replicas     *kube.Replicas `json:"replicas,omitempty"`
+	ReadyRatio   *float64       `json:"readyRatio,omitempty"`
+
+	// CallLatencyMs is the slowest measured call to a dependency.
+	CallLatencyMs *float64 `json:"callLatencyMs,omitempty"`
+
+	// InboundRPS sums the request rates of the calls to the service;
+	// omitted without measured callers or on scoped reconciles.
+	InboundRPS *float64 `json:"inboundRPS,omitempty"`
+}
+
+// ServiceHistory is the response of GET /services/history?service=.
+type ServiceHistory struct {
+	Service string          `json:"service"`
+	Samples []ServiceSample `json:"samples"`
+	Trend   ServiceTrend    `json:"trend"`
+}
+
+// ServiceTrend is the least-squares slope per hour of a service's metrics
+// over its samples; a slope is omitted with fewer than 3 samples carrying
+// the metric.
+type ServiceTrend struct {
+	CallLatencyMsPerHour *float64 `json:"callLatencyMsPerHour,omitempty"`
+	InboundRPSPerHour    *float64 `json:"inboundRPSPerHour,omitempty"`
+	ReadyRatioPerHour    *float64 `json:"readyRatioPerHour,omitempty"`
+	NodeSeverityPerHour  *float64 `json:"nodeSeverityPerHour,omitempty"`
+}
+
+// serviceSnapshot is an immutable copy of every service's samples.
+type serviceSnapshot map[graph.NodeID][]ServiceSample
+
+// serviceHistory keeps a ring buffer of samples per service, for at most
+// caches.maxServices services (the ones recorded longest ago are evicted).
+// Only the reconcile loop writes; after each reconcile it publishes a
+// snapshot that readers load without locking.
+type serviceHistory struct {
+	mu    sync.Mutex // serializes writers
+	size  int
+	rings map[graph.NodeID]*history.Ring[ServiceSample]
+	last  map[graph.NodeID]time.Time
+	snap  atomic.Pointer[serviceSnapshot]
+}
+
+// record appends one sample per service, evicts down to max services and
+// publishes the new snapshot.
+func (h *serviceHistory) record(samples map[graph.NodeID]ServiceSample, max int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.rings == nil {
+		h.rings = make(map[graph.NodeID]*history.Ring[ServiceSample])
+		h.last = make(map[graph.NodeID]time.Time)
+	}
+	for id, s := range samples {
+		r, ok := h.rings[id]
+		if !ok {
+			size := h.size
+			if size <= 0 {
+				size = defaultHistorySize
+			}
+			r = history.NewRing[ServiceSample](size)
+			h.rings[id] = r
+		}
+		r.Push(s)
+		h.last[id] = s.Time
+	}
+	for _, id := range evictOldest(h.last, max, func(t time.Time) time.Time { return t }, func(a, b graph.NodeID) bool { return a < b }) {
+		delete(h.rings, id)
+	}
+
+	snap := make(serviceSnapshot, len(h.rings))
+	for id, r := range h.rings {
+		snap[id] = r.Snapshot()
+	}
+	h.snap.Store(&snap)
+}
+
+func (h *serviceHistory) load() serviceSnapshot {
+	if p := h.snap.Load(); p != nil {
+		return *p
+	}
+	return nil
+}
+
+// ServiceHistory returns the recorded samples of a service and their trend.
+func (c *Controller) ServiceHistory(svc string) (ServiceHistory, bool) {
+	samples, ok := c.services.load()[graph.NodeID(svc)]
+	if !ok {
+		return ServiceHistory{}, false
+	}
+	return ServiceHistory{Service: svc, Samples: samples, Trend: serviceTrend(samples)}, true
+}
+
+// ServiceHistoryIDs lists the services with recorded samples.
+func (c *Controller) ServiceHistoryIDs() []string {
+	snap := c.services.load()
+	out := make([]string, 0, len(snap))
+	for id := range snap {
+		out = append(out, string(id))
+	}
+	sort.Strings(out)
+	return out
+}
+
+// inboundRPS sums the measured request rates of the calls to svc.
+func inboundRPS(m *promc.ServiceRPSMatrix, svc graph.NodeID) *float64 {
+	if m == nil {
+		return nil
+	}
+	var total float64
+	found := false
+	for pair, v := range m.Pairs {
+		if pair.Dst == string(svc) {
+			total += v
+			found = true
+		}
+	}
+	if !found {
+		return nil
+	}
+	return &total
+}
+
+func serviceTrend(samples []ServiceSample) ServiceTrend {
+	return ServiceTrend{
+		CallLatencyMsPerHour: slopePerHour(samples, func(s ServiceSample) *float64 { return s.CallLatencyMs }),
+		InboundRPSPerHour:    slopePerHour(samples, func(s ServiceSample) *float64 { return s.InboundRPS }),
+		ReadyRatioPerHour:    slopePerHour(samples, func(s ServiceSample) *float64 { return s.ReadyRatio }),
+		NodeSeverityPerHour:  slopePerHour(samples, func(s ServiceSample) *float64 { return &s.NodeSeverity }),
+	}
+}
+
+// slopePerHour fits value(s) = a + b*t by least squares over the samples
+// carrying a value and returns b per hour; nil with fewer than 3 such
+// samples or all at the same time.
+func slopePerHour(samples []ServiceSample, value func(ServiceSample) *float64) *float64 {
+	var ts, vs []float64
+	for _, s := range samples {
+		if v := value(s); v != nil {
+			ts = append(ts, s.Time.Sub(samples[0].Time).Hours())
+			vs = append(vs, *v)
+		}
+	}
+	if len(ts) < 3 {
+		return nil
+	}
+	n := float64(len(ts))
+	var mt, mv float64
+	for i := range ts {
+		mt += ts[i] / n
+		mv += vs[i] / n
+	}
+	var cov, vt float64
+	for i := range ts {
+		dt := ts[i] - mt
+		cov += dt * (vs[i] - mv)
+		vt += dt * dt
+	}
+	if vt == 0 {
+		return nil
+	}
+	b := cov / vt
+	return &b
+}
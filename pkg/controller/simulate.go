@@ -0,0 +1,182 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"lead-net-affinity/pkg/graph"
+	"lead-net-affinity/pkg/kube"
+	"lead-net-affinity/pkg/rbac"
+	"lead-net-affinity/pkg/simulate"
+)
+
+var errNothingToSimulate = errors.New("no generated affinity")
+
+// Simulation is the response of GET /simulate: where the pods of the
+// services with generated affinity would land if it were applied and they
+// restarted, predicted on a fresh snapshot of nodes and pods (see package
+// simulate), next to where they run now.
+type Simulation struct {
+	Time     time.Time           `json:"time"`
+	Services []ServiceSimulation `json:"services"`
+}
+
+// ServiceSimulation is the prediction for one service.
+type ServiceSimulation struct {
+	Service   string              `json:"service"`
+	Current   map[string]int      `json:"current"` // node -> running pods
+	Predicted simulate.Prediction `json:"predicted"`
+	Peers     []PeerColocation    `json:"peers,omitempty"`
+}
+
+// PeerColocation is the share of a service's pods that share the topology
+// domain of a generated pod affinity term with a pod of its peer, now and
+// as predicted.
+type PeerColocation struct {
+	Peer        string  `json:"peer"`
+	TopologyKey string  `json:"topologyKey"`
+	Current     float64 `json:"current"`
+	Predicted   float64 `json:"predicted"`
+}
+
+// Simulate predicts the placement of services (all with a generated
+// affinity, in name order, if empty), simulated in order, each seeing the
+// pods predicted for the ones before.
+func (c *Controller) Simulate(ctx context.Context, services []string) (Simulation, error) {
+	if !c.caps.Has(rbac.FeatureNodes) {
+		return Simulation{}, fmt.Errorf("simulation needs node access")
+	}
+	if len(services) == 0 {
+		services = c.preview.services()
+	}
+	nodes, err := c.k8s.ListNodes(ctx)
+	if err != nil {
+		return Simulation{}, fmt.Errorf("list nodes: %w", err)
+	}
+	pods, err := c.k8s.ListPods(ctx, "", "")
+	if err != nil {
+		return Simulation{}, fmt.Errorf("list pods: %w", err)
+	}
+	deploys, err := c.k8s.ListDeployments(ctx, c.cfg.NamespaceSelector)
+	if err != nil {
+		return Simulation{}, fmt.Errorf("list deployments: %w", err)
+	}
+	deploysBySvc := kube.MapDeploymentsByService(c.selectDeployments(deploys), c.identity)
+
+	var workloads []simulate.Workload
+	var simulated []string
+	affinity := make(map[string]*corev1.Affinity)
+	for _, svc := range services {
+		aff, _, ok := c.preview.get(svc)
+		d, found := deploysBySvc[graph.NodeID(svc)]
+		if !ok || !found {
+			continue
+		}
+		tmpl := *d.Spec.Template.DeepCopy()
+		tmpl.Spec.Affinity = aff.DeepCopy()
+		replicas := 1
+		if d.Spec.Replicas != nil {
+			replicas = int(*d.Spec.Replicas)
+		}
+		workloads = append(workloads, simulate.Workload{
+			Name: svc, Namespace: d.Namespace, Selector: d.Spec.Selector, Template: tmpl, Replicas: replicas,
+		})
+		simulated = append(simulated, svc)
+		affinity[svc] = aff
+	}
+	if len(workloads) == 0 {
+		return Simulation{}, fmt.Errorf("%w for services %v (no deployment, or no reconcile yet)", errNothingToSimulate, services)
+	}
+	predictions := simulate.Run(simulate.Snapshot{Nodes: nodes, Pods: pods}, workloads)
+
+	current := make(map[string]map[string]int)
+	for i := range pods {
+		p := &pods[i]
+		svc := string(c.identity.ServiceOf(p.Labels))
+		if svc == "" || p.Spec.NodeName == "" || !kube.PodActive(p) {
+			continue
+		}
+		if current[svc] == nil {
+			current[svc] = make(map[string]int)
+		}
+		current[svc][p.Spec.NodeName]++
+	}
+	predicted := make(map[string]map[string]int, len(current))
+	for svc, n := range current {
+		predicted[svc] = n
+	}
+	for i, svc := range simulated {
+		predicted[svc] = predictions[i].Nodes
+	}
+	nodeLabels := make(map[string]map[string]string, len(nodes))
+	for i := range nodes {
+		nodeLabels[nodes[i].Name] = nodes[i].Labels
+	}
+
+	out := Simulation{Time: time.Now(), Services: make([]ServiceSimulation, 0, len(simulated))}
+	for i, svc := range simulated {
+		s := ServiceSimulation{Service: svc, Current: current[svc], Predicted: predictions[i]}
+		if s.Current == nil {
+			s.Current = map[string]int{}
+		}
+		if aff := affinity[svc]; aff != nil && aff.PodAffinity != nil {
+			for _, t := range aff.PodAffinity.PreferredDuringSchedulingIgnoredDuringExecution {
+				sel := t.PodAffinityTerm.LabelSelector
+				if sel == nil {
+					continue
+				}
+				peer := string(c.identity.ServiceOf(sel.MatchLabels))
+				key := t.PodAffinityTerm.TopologyKey
+				s.Peers = append(s.Peers, PeerColocation{
+					Peer:        peer,
+					TopologyKey: key,
+					Current:     colocatedShare(current[svc], current[peer], nodeLabels, key),
+					Predicted:   colocatedShare(predicted[svc], predicted[peer], nodeLabels, key),
+				})
+			}
+		}
+		out.Services = append(out.Services, s)
+	}
+	return out, nil
+}
+
+// colocatedShare is the share of pods (node -> count) on a node sharing
+// the value of key with a node hosting a peer pod.
+func colocatedShare(pods, peers map[string]int, nodeLabels map[string]map[string]string, key string) float64 {
+	domains := make(map[string]bool)
+	for n := range peers {
+		if v, ok := nodeLabels[n][key]; ok {
+			domains[v] = true
+		}
+	}
+	total, near := 0, 0
+	for n, k := range pods {
+		total += k
+		if v, ok := nodeLabels[n][key]; ok && domains[v] {
+			near += k
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+	return float64(near) / float64(total)
+}
+
+// handleSimulate serves GET /simulate[?service=X&service=Y].
+func (c *Controller) handleSimulate(w http.ResponseWriter, r *http.Request) {
+	sim, err := c.Simulate(r.Context(), r.URL.Query()["service"])
+	if err != nil {
+		code := http.StatusServiceUnavailable
+		if errors.Is(err, errNothingToSimulate) {
+			code = http.StatusNotFound
+		}
+		writeJSON(w, code, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, sim)
+}
@@ -0,0 +1,168 @@
+package controller
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"lead-net-affinity/pkg/config"
+	"lead-net-affinity/pkg/history"
+	"lead-net-affinity/pkg/metrics"
+	promc "lead-net-affinity/pkg/prometheus"
+)
+
+const (
+	defaultSmoothingWindow = 5
+	defaultSmoothingAlpha  = 0.3
+)
+
+// metricSmoother keeps one filter per metric series ("node/<id>/latency",
+// "edge/<src>/<dst>", ...). A series missing from a window of fetches in a
+// row is forgotten.
+type metricSmoother struct {
+	mu      sync.Mutex
+	filters map[string]*history.Filter
+	misses  map[string]int
+}
+
+// add filters one sample of series key.
+func (s *metricSmoother) add(cfg config.SmoothingConfig, key string, v float64) (float64, bool) {
+	if s.filters == nil {
+		s.filters = make(map[string]*history.Filter)
+		s.misses = make(map[string]int)
+	}
+	f, ok := s.filters[key]
+	if !ok {
+		alpha := cfg.Alpha
+		if alpha == 0 {
+			alpha = defaultSmoothingAlpha
+		}
+		f = history.NewFilter(smoothingWindow(cfg), cfg.Method == config.SmoothMedian, alpha, cfg.OutlierMADs)
+		s.filters[key] = f
+	}
+	s.misses[key] = 0
+	return f.Add(v)
+}
+
+// prune forgets series under prefix that were not in the latest fetch for
+// a whole window, and beyond max series those missed longest.
+func (s *metricSmoother) prune(cfg config.SmoothingConfig, prefix string, fetched map[string]bool, max int) {
+	var missed []string
+	n := 0
+	for key := range s.filters {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		n++
+		if fetched[key] {
+			continue
+		}
+		if s.misses[key]++; s.misses[key] >= smoothingWindow(cfg) {
+			delete(s.filters, key)
+			delete(s.misses, key)
+			n--
+			continue
+		}
+		missed = append(missed, key)
+	}
+	if n <= max {
+		return
+	}
+	sort.Slice(missed, func(i, j int) bool {
+		if s.misses[missed[i]] != s.misses[missed[j]] {
+			return s.misses[missed[i]] > s.misses[missed[j]]
+		}
+		return missed[i] < missed[j]
+	})
+	for _, key := range missed[:min(n-max, len(missed))] {
+		delete(s.filters, key)
+		delete(s.misses, key)
+	}
+}
+
+func smoothingWindow(cfg config.SmoothingConfig) int {
+	if cfg.Window <= 0 {
+		return defaultSmoothingWindow
+	}
+	return cfg.Window
+}
+
+// smoothNodeMetrics returns a copy of nm with latency and bandwidth
+// smoothed and outliers replaced by the previous value (smoothing.*). Drop
+// rates are counters of rare events and pass through unchanged.
+func (c *Controller) smoothNodeMetrics(nm *promc.NetworkMatrix) *promc.NetworkMatrix {
+	cfg := c.cfg.Smoothing
+	if cfg.Method == config.SmoothNone || nm == nil {
+		return nm
+	}
+	s := &c.smoother
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := &promc.NetworkMatrix{Nodes: make(map[string]*promc.NodeMetrics, len(nm.Nodes)), Missing: nm.Missing}
+	fetched := make(map[string]bool, 2*len(nm.Nodes))
+	rejected := 0
+	for id, m := range nm.Nodes {
+		cp := *m
+		for _, sig := range []struct {
+			name string
+			v    *float64
+		}{{promc.DimensionLatency, &cp.AvgLatencyMs}, {promc.DimensionBandwidth, &cp.BandwidthRate}} {
+			if !nm.Has(sig.name) {
+				continue // not measured this cycle; keep the history as is
+			}
+			key := "node/" + id + "/" + sig.name
+			fetched[key] = true
+			raw := *sig.v
+			smoothed, outlier := s.add(cfg, key, raw)
+			if outlier {
+				rejected++
+				c.debugf("smoothing: rejected %s sample %.3f on node %s as an outlier; using %.3f", sig.name, raw, id, smoothed)
+			}
+			*sig.v = smoothed
+		}
+		out.Nodes[id] = &cp
+	}
+	s.prune(cfg, "node/", fetched, 2*c.cfg.Caches.NodesOrDefault())
+	c.recordRejectedSamples("node", rejected)
+	return out
+}
+
+// smoothLatency is smoothNodeMetrics for service pair latencies.
+func (c *Controller) smoothLatency(m *promc.ServiceLatencyMatrix) *promc.ServiceLatencyMatrix {
+	cfg := c.cfg.Smoothing
+	if cfg.Method == config.SmoothNone || m == nil {
+		return m
+	}
+	s := &c.smoother
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := &promc.ServiceLatencyMatrix{Pairs: make(map[promc.ServicePair]float64, len(m.Pairs)), Freshness: m.Freshness}
+	fetched := make(map[string]bool, len(m.Pairs))
+	rejected := 0
+	for pair, v := range m.Pairs {
+		key := "edge/" + pair.Src + "/" + pair.Dst
+		fetched[key] = true
+		smoothed, outlier := s.add(cfg, key, v)
+		if outlier {
+			rejected++
+			c.debugf("smoothing: rejected latency sample %.3fms on %s -> %s as an outlier; using %.3fms", v, pair.Src, pair.Dst, smoothed)
+		}
+		out.Pairs[pair] = smoothed
+	}
+	s.prune(cfg, "edge/", fetched, c.cfg.Caches.EdgesOrDefault())
+	c.recordRejectedSamples("edge", rejected)
+	return out
+}
+
+func (c *Controller) recordRejectedSamples(kind string, n int) {
+	if n > 0 {
+		c.infof("smoothing: rejected %d %s metric samples as outliers", n, kind)
+	}
+	labels := map[string]string{"kind": kind}
+	for k, v := range c.metricLabels() {
+		labels[k] = v
+	}
+	metrics.Default.Set("lead_net_metric_outliers_rejected", "Metric samples of the last reconcile rejected as outliers by smoothing.", labels, float64(n))
+}
@@ -0,0 +1,168 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"lead-net-affinity/pkg/metrics"
+)
+
+// ReconcileStatus summarizes the most recent reconcile. It is published as a
+// LeadNetAffinityStatus resource so `kubectl get` shows controller health.
+type ReconcileStatus struct {
+	LastReconcileTime  time.Time      `json:"lastReconcileTime"`
+	DurationMs         int64          `json:"durationMs"`
+	PathsEvaluated     int            `json:"pathsEvaluated"`
+	DeploymentsUpdated int            `json:"deploymentsUpdated"`
+	BadNodes           []string       `json:"badNodes,omitempty"`
+	Errors             []string       `json:"errors,omitempty"`
+	Degraded           []string       `json:"degraded,omitempty"` // data fallbacks, see config.DegradationConfig
+	DesiredCapacity    []CapacityHint `json:"desiredCapacity,omitempty"`
+	Scope              *Scope         `json:"scope,omitempty"`
+
+	// HeldByErrorBudget lists services whose affinity changes waited
+	// because no path through them burns its error budget fast enough.
+	HeldByErrorBudget []string `json:"heldByErrorBudget,omitempty"`
+
+	// LastSuccessTime is the end of the last reconcile that finished without errors.
+	LastSuccessTime time.Time `json:"lastSuccessTime,omitempty"`
+
+	// Components is the health of each component as of this reconcile.
+	Components []ComponentStatus `json:"components,omitempty"`
+}
+
+// StatusPublisher persists a ReconcileStatus (e.g. into a custom resource).
+type StatusPublisher interface {
+	PublishStatus(ctx context.Context, st ReconcileStatus) error
+}
+
+// statusTracker holds the last status; it is shared between the reconcile
+// goroutine and readers such as HTTP handlers.
+type statusTracker struct {
+	mu   sync.RWMutex
+	last ReconcileStatus
+}
+
+func (t *statusTracker) get() ReconcileStatus {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.last
+}
+
+func (t *statusTracker) set(st ReconcileStatus) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(st.Errors) == 0 {
+		st.LastSuccessTime = st.LastReconcileTime
+	} else {
+		st.LastSuccessTime = t.last.LastSuccessTime
+	}
+	t.last = st
+}
+
+// reconcileReport collects results while a reconcile runs.
+type reconcileReport struct {
+	start    time.Time
+	paths    int
+	updated  int
+	bad      []string
+	errs     []string
+	degraded []string
+	capacity []CapacityHint
+	held     []string
+}
+
+func (r *reconcileReport) errorf(format string, args ...interface{}) {
+	r.errs = append(r.errs, fmt.Sprintf(format, args...))
+}
+
+func (r *reconcileReport) degradedf(format string, args ...interface{}) {
+	r.degraded = append(r.degraded, fmt.Sprintf(format, args...))
+}
+
+// Status returns the result of the most recent reconcile.
+func (c *Controller) Status() ReconcileStatus {
+	return c.status.get()
+}
+
+// SetStatusPublisher wires a publisher that is called after every reconcile.
+func (c *Controller) SetStatusPublisher(p StatusPublisher) {
+	c.publisher = p
+}
+
+// finishReconcile records the report and publishes it (best-effort).
+func (c *Controller) finishReconcile(ctx context.Context, r *reconcileReport, scope Scope) {
+	st := ReconcileStatus{
+		LastReconcileTime:  time.Now(),
+		DurationMs:         time.Since(r.start).Milliseconds(),
+		PathsEvaluated:     r.paths,
+		DeploymentsUpdated: r.updated,
+		BadNodes:           r.bad,
+		Errors:             r.errs,
+		Degraded:           r.degraded,
+		DesiredCapacity:    r.capacity,
+		HeldByErrorBudget:  r.held,
+	}
+	if !scope.IsEmpty() {
+		s := scope
+		st.Scope = &s
+	}
+	if len(r.errs) == 0 {
+		c.componentOK(ComponentReconcile)
+	} else {
+		c.componentFailed(ComponentReconcile, errors.New(r.errs[0]))
+	}
+	st.Components = c.Components()
+	c.status.set(st)
+	recordReconcileMetrics(st, c.metricLabels())
+	c.trackReport(ctx, r, st.LastReconcileTime)
+	c.saveSnapshot(r, scope)
+
+	if c.publisher == nil {
+		return
+	}
+	if err := c.publisher.PublishStatus(ctx, c.status.get()); err != nil {
+		c.infof("failed to publish reconcile status: %v", err)
+	}
+}
+
+// StatusWriter is implemented by kube.Client.
+type StatusWriter interface {
+	WriteStatus(ctx context.Context, namespace, name string, status interface{}) error
+}
+
+// crStatusPublisher publishes the status into a LeadNetAffinityStatus object.
+type crStatusPublisher struct {
+	w         StatusWriter
+	namespace string
+	name      string
+}
+
+// NewCRStatusPublisher returns a StatusPublisher writing to the
+// LeadNetAffinityStatus object namespace/name.
+func NewCRStatusPublisher(w StatusWriter, namespace, name string) StatusPublisher {
+	return &crStatusPublisher{w: w, namespace: namespace, name: name}
+}
+
+func (p *crStatusPublisher) PublishStatus(ctx context.Context, st ReconcileStatus) error {
+	return p.w.WriteStatus(ctx, p.namespace, p.name, st)
+}
+
+func recordReconcileMetrics(st ReconcileStatus, labels map[string]string) {
+	m := metrics.Default
+	m.Add("lead_net_reconcile_total", "Reconciles run.", labels, 1)
+	if len(st.Errors) > 0 {
+		m.Add("lead_net_reconcile_errors_total", "Reconciles that finished with errors.", labels, 1)
+	}
+	m.Set("lead_net_reconcile_duration_seconds", "Duration of the last reconcile.", labels, float64(st.DurationMs)/1000)
+	m.Set("lead_net_paths_evaluated", "Paths evaluated in the last reconcile.", labels, float64(st.PathsEvaluated))
+	m.Add("lead_net_deployments_updated_total", "Deployments updated by reconciles.", labels, float64(st.DeploymentsUpdated))
+	m.Set("lead_net_bad_nodes", "Nodes flagged bad in the last reconcile.", labels, float64(len(st.BadNodes)))
+	if !st.LastSuccessTime.IsZero() {
+		m.Set("lead_net_last_success_timestamp_seconds", "Unix time of the last successful reconcile.", labels,
+			float64(st.LastSuccessTime.Unix()))
+	}
+}
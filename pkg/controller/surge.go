@@ -0,0 +1,137 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"lead-net-affinity/pkg/kube"
+	"lead-net-affinity/pkg/rbac"
+)
+
+const (
+	defaultSurgeTimeout = 2 * time.Minute
+	surgePollInterval   = 2 * time.Second
+)
+
+// deploymentScaler is optionally implemented by the KubeClient (kube.Client
+// does); make-before-break rescheduling needs it.
+type deploymentScaler interface {
+	ScaleDeployment(ctx context.Context, namespace, name string, delta int32) (int32, error)
+}
+
+// hpaLister is optionally implemented by the KubeClient (kube.Client does);
+// without it every deployment may be surged.
+type hpaLister interface {
+	HPATargets(ctx context.Context, namespaces []string) (map[string]bool, error)
+}
+
+// surgePlan tells triggerPodRescheduling to surge each pod's deployment
+// before deleting the pod; a nil plan deletes pods directly.
+type surgePlan struct {
+	owners     map[string]string // pod namespace/name -> deployment name
+	badNodes   []string
+	settling   map[string]bool // namespace/deployment still rolling out, see settlingDeployments
+	autoscaled map[string]bool // namespace/deployment scaled by an HPA, see autoscaledDeployments
+}
+
+func (p *surgePlan) owner(pod corev1.Pod) string {
+	return p.owners[pod.Namespace+"/"+pod.Name]
+}
+
+// skipSurge reports whether pod is deleted without a surge: an HPA owns
+// its deployment's replicas and would scale the extra one away, so the
+// surge would fight it rather than protect capacity.
+func (p *surgePlan) skipSurge(pod corev1.Pod) bool {
+	return p.autoscaled[pod.Namespace+"/"+p.owner(pod)]
+}
+
+// autoscaledDeployments returns the deployments a HorizontalPodAutoscaler
+// scales, or nil if they cannot be listed; then none is skipped.
+func (c *Controller) autoscaledDeployments(ctx context.Context) map[string]bool {
+	lister, ok := c.k8s.(hpaLister)
+	if !ok || !c.caps.Has(rbac.FeatureHPA) {
+		return nil
+	}
+	targets, err := lister.HPATargets(ctx, c.cfg.NamespaceSelector)
+	if err != nil {
+		c.infof("warning: failed to list HorizontalPodAutoscalers; surging their deployments too: %v", err)
+		return nil
+	}
+	return targets
+}
+
+// surgeReplica scales pod's deployment up by one and waits for a new
+// replica to be Ready on a node that is not bad. On failure the deployment
+// is scaled back and pod must be kept. It blocks the rebalance pass, and
+// so the reconcile, for up to rebalancing.surgeTimeoutSeconds per pod.
+func (c *Controller) surgeReplica(ctx context.Context, pod corev1.Pod, plan *surgePlan) error {
+	scaler, ok := c.k8s.(deploymentScaler)
+	owner := plan.owner(pod)
+	if !ok || owner == "" {
+		return fmt.Errorf("cannot surge: deployment of the pod unknown or not scalable")
+	}
+	if plan.settling[pod.Namespace+"/"+owner] {
+		return fmt.Errorf("cannot surge: rollout of %s/%s still in progress", pod.Namespace, owner)
+	}
+	svc := c.identity.ServiceOf(pod.Labels)
+	before, err := c.identity.ListServicePods(ctx, c.k8s, pod.Namespace, svc)
+	if err != nil {
+		return fmt.Errorf("list pods: %w", err)
+	}
+	known := make(map[string]bool, len(before))
+	for _, p := range before {
+		known[p.Name] = true
+	}
+
+	replicas, err := scaler.ScaleDeployment(ctx, pod.Namespace, owner, 1)
+	if err != nil {
+		return fmt.Errorf("scale up %s/%s: %w", pod.Namespace, owner, err)
+	}
+	c.infof("surged %s/%s to %d replicas before rescheduling %s", pod.Namespace, owner, replicas, pod.Name)
+
+	timeout := defaultSurgeTimeout
+	if s := c.cfg.Rebalancing.SurgeTimeoutSeconds; s > 0 {
+		timeout = time.Duration(s) * time.Second
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		pods, err := c.identity.ListServicePods(ctx, c.k8s, pod.Namespace, svc)
+		if err == nil {
+			for i := range pods {
+				p := &pods[i]
+				if !known[p.Name] && kube.PodReady(p) && !contains(plan.badNodes, p.Spec.NodeName) {
+					c.infof("replacement %s/%s is Ready on node %s", p.Namespace, p.Name, p.Spec.NodeName)
+					return nil
+				}
+			}
+		}
+		if time.Now().After(deadline) {
+			c.scaleBack(ctx, pod.Namespace, owner)
+			return fmt.Errorf("no Ready replacement on a good node within %s", timeout)
+		}
+		if err := sleepCtx(ctx, surgePollInterval); err != nil {
+			c.scaleBack(ctx, pod.Namespace, owner)
+			return err
+		}
+	}
+}
+
+// scaleBack undoes the surge of surgeReplica.
+func (c *Controller) scaleBack(ctx context.Context, namespace, owner string) {
+	scaler, ok := c.k8s.(deploymentScaler)
+	if !ok {
+		return
+	}
+	// The surge must be undone even if the reconcile was cancelled meanwhile.
+	if ctx.Err() != nil {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+	}
+	if _, err := scaler.ScaleDeployment(ctx, namespace, owner, -1); err != nil {
+		c.infof("failed to scale %s/%s back after surge: %v", namespace, owner, err)
+	}
+}
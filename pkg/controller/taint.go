@@ -0,0 +1,63 @@
+package controller
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"lead-net-affinity/pkg/config"
+	"lead-net-affinity/pkg/kube"
+	"lead-net-affinity/pkg/metrics"
+	"lead-net-affinity/pkg/rbac"
+)
+
+// nodeTainter is optionally implemented by the KubeClient (kube.Client
+// does); rebalancing.badNodeMode=taint needs it.
+type nodeTainter interface {
+	SetNodeTaint(ctx context.Context, name string, t corev1.Taint, present bool) error
+}
+
+func (c *Controller) taintMode() bool {
+	return c.cfg.Rebalancing.BadNodeMode == config.BadNodeTaint
+}
+
+// syncDegradedTaints makes kube.DegradedTaint present on exactly the bad
+// nodes: newly bad nodes are tainted, recovered ones untainted.
+func (c *Controller) syncDegradedTaints(ctx context.Context, badNodes []string) {
+	tainter, ok := c.k8s.(nodeTainter)
+	if !ok || !c.caps.Has(rbac.FeatureTaintNodes) || !c.caps.Has(rbac.FeatureNodes) {
+		c.infof("badNodeMode=taint but node update access is missing; bad nodes are not tainted")
+		return
+	}
+	nodes, err := c.k8s.ListNodes(ctx)
+	if err != nil {
+		c.infof("list nodes for degraded taints failed: %v", err)
+		return
+	}
+	tainted := 0
+	for i := range nodes {
+		n := &nodes[i]
+		want := contains(badNodes, n.Name)
+		if kube.HasTaint(n, kube.DegradedTaint) == want {
+			if want {
+				tainted++
+			}
+			continue
+		}
+		if !c.canApply() {
+			c.infof("dry-run: would set taint %s on node %s: %v", kube.DegradedTaint.Key, n.Name, want)
+			continue
+		}
+		if err := tainter.SetNodeTaint(ctx, n.Name, kube.DegradedTaint, want); err != nil {
+			c.infof("failed to update taint on node %s: %v", n.Name, err)
+			continue
+		}
+		if want {
+			tainted++
+			c.infof("tainted bad node %s %s", n.Name, kube.DegradedTaint.ToString())
+		} else {
+			c.infof("node %s recovered; removed taint %s", n.Name, kube.DegradedTaint.Key)
+		}
+	}
+	metrics.Default.Set("lead_net_degraded_nodes_tainted", "Nodes carrying the lead.io/degraded taint.", c.metricLabels(), float64(tainted))
+}
@@ -0,0 +1,72 @@
+package controller
+
+import (
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"lead-net-affinity/pkg/config"
+	"lead-net-affinity/pkg/graph"
+)
+
+// serviceThresholds are the effective latency thresholds per service:
+// the first thresholds[] entry setting a value, name matches first, else
+// scoring.bad*.
+type serviceThresholds struct {
+	defaults config.ServiceThresholds
+	bySvc    map[graph.NodeID]config.ServiceThresholds
+}
+
+// resolveThresholds applies thresholds[] to the graph services, matching
+// selectors against the pod template labels of their deployments.
+func (c *Controller) resolveThresholds(g *graph.Graph, deploysBySvc map[graph.NodeID]*appsv1.Deployment) serviceThresholds {
+	t := serviceThresholds{
+		defaults: config.ServiceThresholds{BadLatencyMs: c.cfg.Scoring.BadLatencyMs, BadEdgeLatencyMs: c.cfg.Scoring.BadEdgeLatencyMs},
+		bySvc:    make(map[graph.NodeID]config.ServiceThresholds),
+	}
+	if len(c.cfg.Thresholds) == 0 {
+		return t
+	}
+	for id := range g.Nodes {
+		var matched []config.ServiceThresholds
+		for _, e := range c.cfg.Thresholds {
+			if e.Service == string(id) {
+				matched = append(matched, e)
+			}
+		}
+		if d, ok := deploysBySvc[id]; ok {
+			for _, e := range c.cfg.Thresholds {
+				if len(e.Selector) > 0 && labels.SelectorFromSet(e.Selector).Matches(labels.Set(d.Spec.Template.Labels)) {
+					matched = append(matched, e)
+				}
+			}
+		}
+		eff := t.defaults
+		for i := len(matched) - 1; i >= 0; i-- {
+			if v := matched[i].BadLatencyMs; v > 0 {
+				eff.BadLatencyMs = v
+			}
+			if v := matched[i].BadEdgeLatencyMs; v > 0 {
+				eff.BadEdgeLatencyMs = v
+			}
+		}
+		t.bySvc[id] = eff
+	}
+	return t
+}
+
+func (t serviceThresholds) get(svc graph.NodeID) config.ServiceThresholds {
+	if v, ok := t.bySvc[svc]; ok {
+		return v
+	}
+	return t.defaults
+}
+
+// nodeLatencyMs is the RTT above which the node running svc is unhealthy.
+func (t serviceThresholds) nodeLatencyMs(svc graph.NodeID) float64 {
+	return t.get(svc).BadLatencyMs
+}
+
+// edgeLatencyMs is the latency above which a call to svc is slow.
+func (t serviceThresholds) edgeLatencyMs(svc graph.NodeID) float64 {
+	return t.get(svc).BadEdgeLatencyMs
+}
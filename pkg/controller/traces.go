@@ -0,0 +1,116 @@
+package controller
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	promc "lead-net-affinity/pkg/prometheus"
+	"lead-net-affinity/pkg/tracing"
+)
+
+const (
+	defaultTraceLookback   = 5 * time.Minute
+	defaultTracesPerSvc    = 100
+	defaultTracePercentile = 0.5
+)
+
+// TraceSource derives edges from distributed traces (tracing.Client).
+type TraceSource interface {
+	FetchEdges(ctx context.Context, services []string, lookback time.Duration, limit int) (*tracing.Edges, error)
+}
+
+// SetTraceSource adds traces as an edge source. Prometheus pair metrics win
+// where both have a value; traces fill the edges Prometheus does not see.
+func (c *Controller) SetTraceSource(t TraceSource) {
+	c.traces.src = t
+}
+
+type traceCache struct {
+	mu    sync.Mutex
+	src   TraceSource
+	at    time.Time
+	edges *tracing.Edges
+}
+
+// traceEdges returns the trace-derived edges, refreshed at most once per
+// reconcile interval (trace queries are expensive).
+func (c *Controller) traceEdges(ctx context.Context) *tracing.Edges {
+	c.traces.mu.Lock()
+	defer c.traces.mu.Unlock()
+	if c.traces.src == nil {
+		return nil
+	}
+	if c.traces.edges != nil && time.Since(c.traces.at) < c.interval {
+		return c.traces.edges
+	}
+
+	lookback := defaultTraceLookback
+	if c.cfg.Tracing.LookbackSeconds > 0 {
+		lookback = time.Duration(c.cfg.Tracing.LookbackSeconds) * time.Second
+	}
+	limit := defaultTracesPerSvc
+	if c.cfg.Tracing.TracesPerService > 0 {
+		limit = c.cfg.Tracing.TracesPerService
+	}
+	services := make([]string, 0, len(c.cfg.Graph.Services))
+	for _, s := range c.cfg.Graph.Services {
+		services = append(services, s.Name)
+	}
+
+	edges, err := c.traces.src.FetchEdges(ctx, services, lookback, limit)
+	if err != nil {
+		c.infof("warning: failed to fetch trace edges; keeping previous: %v", err)
+		c.componentFailed(ComponentTraces, err)
+		return c.traces.edges
+	}
+	c.componentOK(ComponentTraces)
+	c.traces.edges, c.traces.at = edges, time.Now()
+	c.debugf("fetched %d trace-derived edges", len(edges.Pairs))
+	return edges
+}
+
+func (c *Controller) tracePercentile() float64 {
+	if q := c.cfg.Tracing.LatencyPercentile; q > 0 && q <= 1 {
+		return q
+	}
+	return defaultTracePercentile
+}
+
+// mergeRPS fills pairs missing from base with values from extra.
+func mergeRPS(base, extra *promc.ServiceRPSMatrix) *promc.ServiceRPSMatrix {
+	if extra == nil || len(extra.Pairs) == 0 {
+		return base
+	}
+	out := &promc.ServiceRPSMatrix{Pairs: map[promc.ServicePair]float64{}, Freshness: map[promc.ServicePair]promc.Freshness{}}
+	for k, v := range extra.Pairs {
+		out.Pairs[k] = v
+		out.Freshness[k] = extra.Freshness[k]
+	}
+	if base != nil {
+		for k, v := range base.Pairs {
+			out.Pairs[k] = v
+			out.Freshness[k] = base.Freshness[k]
+		}
+	}
+	return out
+}
+
+// mergeLatency fills pairs missing from base with values from extra.
+func mergeLatency(base, extra *promc.ServiceLatencyMatrix) *promc.ServiceLatencyMatrix {
+	if extra == nil || len(extra.Pairs) == 0 {
+		return base
+	}
+	out := &promc.ServiceLatencyMatrix{Pairs: map[promc.ServicePair]float64{}, Freshness: map[promc.ServicePair]promc.Freshness{}}
+	for k, v := range extra.Pairs {
+		out.Pairs[k] = v
+		out.Freshness[k] = extra.Freshness[k]
+	}
+	if base != nil {
+		for k, v := range base.Pairs {
+			out.Pairs[k] = v
+			out.Freshness[k] = base.Freshness[k]
+		}
+	}
+	return out
+}
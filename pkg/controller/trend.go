@@ -0,0 +1,96 @@
+package controller
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+
+	"lead-net-affinity/pkg/graph"
+)
+
+// trendRecommendations recommends replicas for in-scope services whose
+// inbound request rate, extrapolated along its trend in the service
+// history recommendations.trend.horizonIntervals reconciles ahead (or its
+// next-hour forecast, if higher), exceeds maxRPSPerReplica for the current
+// replicas. Settling deployments keep
+// their previous recommendation unless recommendReplicas kept it already
+// (handled).
+func (c *Controller) trendRecommendations(
+	deploysBySvc map[graph.NodeID]*appsv1.Deployment,
+	scope Scope,
+	settling map[string]bool,
+	previous map[string]ReplicaRecommendation,
+	handled map[graph.NodeID]bool,
+) []ReplicaRecommendation {
+	tc := c.cfg.Recommendations.Trend
+	if tc.MaxRPSPerReplica <= 0 {
+		return nil
+	}
+	horizon := time.Duration(tc.HorizonOrDefault()) * c.interval
+
+	var out []ReplicaRecommendation
+	for svc, d := range deploysBySvc {
+		if !scope.includesDeployment(svc, d) {
+			continue
+		}
+		if settling[d.Namespace+"/"+d.Name] {
+			if r, ok := previous[string(svc)]; ok && !handled[svc] {
+				out = append(out, r)
+			}
+			continue
+		}
+		h, ok := c.ServiceHistory(string(svc))
+		if !ok || len(h.Samples) == 0 || h.Samples[len(h.Samples)-1].InboundRPS == nil {
+			continue
+		}
+		now := *h.Samples[len(h.Samples)-1].InboundRPS
+		predicted, reason := now, fmt.Sprintf("inbound %.1f req/s", now)
+		if slope := h.Trend.InboundRPSPerHour; slope != nil && *slope > 0 {
+			predicted = now + *slope*horizon.Hours()
+			reason = fmt.Sprintf("inbound %.1f req/s rising %.1f/h, %.1f req/s predicted within %s", now, *slope, predicted, horizon)
+		}
+		if f, ok := c.forecastRPS(svc); ok && *f.NextHourRPS > predicted {
+			predicted = *f.NextHourRPS
+			reason = fmt.Sprintf("inbound %.1f req/s, %.1f req/s forecast for the next hour (%s)", now, predicted, f.Model)
+		}
+		current := int32(1)
+		if d.Spec.Replicas != nil {
+			current = *d.Spec.Replicas
+		}
+		target := int32(math.Ceil(predicted / tc.MaxRPSPerReplica))
+		if target <= current {
+			continue
+		}
+		out = append(out, ReplicaRecommendation{
+			ServiceID:  string(svc),
+			Namespace:  d.Namespace,
+			Deployment: d.Name,
+			Current:    current,
+			Target:     target,
+			Reason:     fmt.Sprintf("%s exceeds %.1f req/s per replica", reason, tc.MaxRPSPerReplica),
+		})
+	}
+	return out
+}
+
+// mergeRecommendations adds extra to items, keeping the higher target per
+// service.
+func mergeRecommendations(items, extra []ReplicaRecommendation) []ReplicaRecommendation {
+	idx := make(map[string]int, len(items))
+	for i, r := range items {
+		idx[r.ServiceID] = i
+	}
+	for _, r := range extra {
+		i, ok := idx[r.ServiceID]
+		switch {
+		case !ok:
+			idx[r.ServiceID] = len(items)
+			items = append(items, r)
+		case r.Target > items[i].Target:
+			items[i] = r
+		}
+	}
+	return items
+}
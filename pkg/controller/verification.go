@@ -0,0 +1,311 @@
+package controller
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+
+	"lead-net-affinity/pkg/graph"
+	"lead-net-affinity/pkg/kube"
+	"lead-net-affinity/pkg/metrics"
+	"lead-net-affinity/pkg/rbac"
+	"lead-net-affinity/pkg/rulegen"
+)
+
+// States of a RuleVerification.
+const (
+	VerificationPending     = "pending"     // no pod placed under the term yet
+	VerificationSatisfied   = "satisfied"   // most pods landed next to the peer
+	VerificationUnsatisfied = "unsatisfied" // most pods did not
+)
+
+// verifySatisfiedShare is the share of checked pods that must be
+// co-located with the peer for a check to succeed. Terms are preferences,
+// so a minority placed elsewhere (full nodes, spread constraints) is fine.
+const verifySatisfiedShare = 0.5
+
+// PlacementVerification is the response of GET /verification: whether the
+// pods placed since each generated pod affinity term took effect actually
+// share a node (or zone) with the term's peer.
+type PlacementVerification struct {
+	Time  time.Time          `json:"time"`
+	Rules []RuleVerification `json:"rules"`
+}
+
+// RuleVerification is the record of one term, Service toward Peer.
+type RuleVerification struct {
+	Service     string    `json:"service"`
+	Peer        string    `json:"peer"`
+	TopologyKey string    `json:"topologyKey"`
+	Since       time.Time `json:"since"`               // first seen in place
+	Escalated   bool      `json:"escalated,omitempty"` // relaxed from same-node to the zone
+
+	State     string `json:"state"`
+	Pods      int    `json:"pods"`      // pods checked by the last check
+	Colocated int    `json:"colocated"` // of them, next to the peer
+
+	Successes           int       `json:"successes"`
+	Failures            int       `json:"failures"`
+	ConsecutiveFailures int       `json:"consecutiveFailures"`
+	LastCheck           time.Time `json:"lastCheck,omitempty"`
+
+	// Flagged terms failed affinity.verification.failureThreshold checks
+	// in a row and need review.
+	Flagged bool `json:"flagged,omitempty"`
+
+	placed string // pods and nodes of the last check
+}
+
+type verificationStore struct {
+	mu        sync.RWMutex
+	rules     map[string]*RuleVerification // by service>peer@topologyKey
+	escalated map[string]bool              // service>peer relaxed to the zone
+	last      time.Time
+}
+
+// Verification returns the placement verification of every term in place.
+func (c *Controller) Verification() PlacementVerification {
+	s := &c.verification
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := PlacementVerification{Time: s.last, Rules: []RuleVerification{}}
+	for _, r := range s.rules {
+		out.Rules = append(out.Rules, *r)
+	}
+	sort.Slice(out.Rules, func(i, j int) bool {
+		a, b := out.Rules[i], out.Rules[j]
+		if a.Service != b.Service {
+			return a.Service < b.Service
+		}
+		if a.Peer != b.Peer {
+			return a.Peer < b.Peer
+		}
+		return a.TopologyKey < b.TopologyKey
+	})
+	return out
+}
+
+// verifyPlacements checks the terms of the last decision, which are in
+// place unless the controller runs dry. A term is checked once it has been
+// in place for affinity.verification.settleSeconds, against the pods of
+// its service created since; each new set of such pods is one check.
+// failureThreshold failed checks in a row flag the term and, with
+// escalate, relax a same-node term to the zone (see escalateRules).
+func (c *Controller) verifyPlacements(ctx context.Context, deploysBySvc map[graph.NodeID]*appsv1.Deployment) {
+	vc := c.cfg.Affinity.Verification
+	if !vc.Enabled || !c.canApply() {
+		return
+	}
+	decision := c.Decisions()
+	now := time.Now()
+
+	var idx *kube.PlacementIndex
+	podsOf := make(map[graph.NodeID][]corev1.Pod)
+	placement := func() *kube.PlacementIndex {
+		if idx == nil {
+			var nodes kube.NodeGetter
+			if c.caps.Has(rbac.FeatureNodes) {
+				nodes = c.k8s
+			}
+			idx = kube.BuildPlacementIndex(ctx, c.k8s, nodes, c.cfg.NamespaceSelector, c.identity)
+		}
+		return idx
+	}
+
+	s := &c.verification
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.rules == nil {
+		s.rules = make(map[string]*RuleVerification)
+		s.escalated = make(map[string]bool)
+	}
+	inPlace := make(map[string]bool)
+	pairs := make(map[string]bool)
+	for _, sa := range decision.Affinity {
+		for _, p := range sa.Peers {
+			if p.Service == "" {
+				continue
+			}
+			pair := sa.Service + ">" + p.Service
+			key := pair + "@" + p.TopologyKey
+			inPlace[key], pairs[pair] = true, true
+			r := s.rules[key]
+			if r == nil {
+				r = &RuleVerification{Service: sa.Service, Peer: p.Service, TopologyKey: p.TopologyKey, Since: now, State: VerificationPending}
+				r.Escalated = s.escalated[pair] && p.TopologyKey == rulegen.ZoneTopologyKey
+				s.rules[key] = r
+			}
+			if now.Sub(r.Since) < vc.SettleOrDefault() {
+				continue
+			}
+			svc := graph.NodeID(sa.Service)
+			d, ok := deploysBySvc[svc]
+			if !ok {
+				continue
+			}
+			pods, ok := podsOf[svc]
+			if !ok {
+				var err error
+				pods, err = c.identity.ListServicePods(ctx, c.k8s, d.Namespace, svc)
+				if err != nil {
+					c.infof("placement verification: list pods of %s failed: %v", svc, err)
+				}
+				podsOf[svc] = pods
+			}
+			c.checkRule(r, pods, placement(), now)
+		}
+	}
+	for key, r := range s.rules {
+		if !inPlace[key] {
+			delete(s.rules, key)
+			continue
+		}
+		if r.Flagged || r.ConsecutiveFailures < vc.ThresholdOrDefault() {
+			continue
+		}
+		pair := r.Service + ">" + r.Peer
+		if vc.Escalate && r.TopologyKey == rulegen.HostnameTopologyKey && !s.escalated[pair] {
+			c.infof("affinity term %s -> %s failed %d placement checks in a row; relaxing it to the zone",
+				r.Service, r.Peer, r.ConsecutiveFailures)
+			s.escalated[pair] = true
+			delete(s.rules, key)
+			continue
+		}
+		r.Flagged = true
+		c.infof("warning: affinity term %s -> %s (%s) failed %d placement checks in a row; flagged for review",
+			r.Service, r.Peer, r.TopologyKey, r.ConsecutiveFailures)
+	}
+	for pair := range s.escalated {
+		if !pairs[pair] {
+			delete(s.escalated, pair)
+		}
+	}
+	s.last = now
+
+	flagged := 0
+	for _, r := range s.rules {
+		if r.Flagged {
+			flagged++
+		}
+	}
+	metrics.Default.Set("lead_net_affinity_rules_flagged",
+		"Generated pod affinity terms whose pods repeatedly failed to land next to their peer.", c.metricLabels(), float64(flagged))
+	metrics.Default.Set("lead_net_affinity_rules_escalated",
+		"Generated same-node pod affinity terms relaxed to the zone after failed placement checks.", c.metricLabels(), float64(len(s.escalated)))
+}
+
+// checkRule checks r against the pods of its service created since r took
+// effect. Pods without a node or, for a zone term, without a known zone are
+// not counted; neither is a set of pods checked before.
+func (c *Controller) checkRule(r *RuleVerification, pods []corev1.Pod, idx *kube.PlacementIndex, now time.Time) {
+	peer := idx.NodesForService(graph.NodeID(r.Peer))
+	peerZones := make(map[string]bool)
+	for n := range peer {
+		if z := idx.ZoneForNode(n); z != "" {
+			peerZones[z] = true
+		}
+	}
+	var placed []string
+	checked, colocated := 0, 0
+	for i := range pods {
+		p := &pods[i]
+		if p.Spec.NodeName == "" || !kube.PodActive(p) || p.CreationTimestamp.Time.Before(r.Since) {
+			continue
+		}
+		ok := peer[p.Spec.NodeName] > 0
+		if r.TopologyKey == rulegen.ZoneTopologyKey {
+			z := idx.ZoneForNode(p.Spec.NodeName)
+			if z == "" {
+				continue
+			}
+			ok = peerZones[z]
+		}
+		checked++
+		if ok {
+			colocated++
+		}
+		placed = append(placed, p.Name+"@"+p.Spec.NodeName)
+	}
+	sort.Strings(placed)
+	fingerprint := strings.Join(placed, ",")
+	if checked == 0 || len(peer) == 0 || fingerprint == r.placed {
+		return
+	}
+	r.placed = fingerprint
+	r.Pods, r.Colocated, r.LastCheck = checked, colocated, now
+
+	result := VerificationSatisfied
+	if float64(colocated) < verifySatisfiedShare*float64(checked) {
+		result = VerificationUnsatisfied
+	}
+	r.State = result
+	if result == VerificationSatisfied {
+		r.Successes++
+		r.ConsecutiveFailures = 0
+		r.Flagged = false
+	} else {
+		r.Failures++
+		r.ConsecutiveFailures++
+		c.infof("placement check: %d of %d pods of %s placed since %s share a %s with %s",
+			colocated, checked, r.Service, r.Since.Format(time.RFC3339), topologyLevel(r.TopologyKey), r.Peer)
+	}
+	labels := map[string]string{"result": result}
+	for k, v := range c.metricLabels() {
+		labels[k] = v
+	}
+	metrics.Default.Add("lead_net_affinity_verification_checks_total",
+		"Placement checks of generated pod affinity terms, by result.", labels, 1)
+}
+
+// escalateRules relaxes the same-node terms verifyPlacements escalated to
+// the zone level. It runs on every reconcile, scoped ones included, so the
+// relaxed terms are not regenerated at the node level.
+func (c *Controller) escalateRules(deploysBySvc map[graph.NodeID]*appsv1.Deployment) {
+	s := &c.verification
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if len(s.escalated) == 0 {
+		return
+	}
+	for svc, d := range deploysBySvc {
+		aff := d.Spec.Template.Spec.Affinity
+		if aff == nil || aff.PodAffinity == nil {
+			continue
+		}
+		terms := aff.PodAffinity.PreferredDuringSchedulingIgnoredDuringExecution
+		zoned := make(map[graph.NodeID]bool)
+		for _, t := range terms {
+			if sel := t.PodAffinityTerm.LabelSelector; sel != nil && t.PodAffinityTerm.TopologyKey == rulegen.ZoneTopologyKey {
+				zoned[c.identity.ServiceOf(sel.MatchLabels)] = true
+			}
+		}
+		out := terms[:0]
+		for _, t := range terms {
+			sel := t.PodAffinityTerm.LabelSelector
+			if sel != nil && t.PodAffinityTerm.TopologyKey == rulegen.HostnameTopologyKey {
+				peer := c.identity.ServiceOf(sel.MatchLabels)
+				if s.escalated[string(svc)+">"+string(peer)] {
+					if zoned[peer] {
+						continue // a zone term toward the peer exists already
+					}
+					t.PodAffinityTerm.TopologyKey = rulegen.ZoneTopologyKey
+					zoned[peer] = true
+				}
+			}
+			out = append(out, t)
+		}
+		aff.PodAffinity.PreferredDuringSchedulingIgnoredDuringExecution = out
+	}
+}
+
+func topologyLevel(key string) string {
+	if key == rulegen.ZoneTopologyKey {
+		return "zone"
+	}
+	return "node"
+}
@@ -0,0 +1,276 @@
+package controller
+
+import (
+	"context"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+
+	"lead-net-affinity/pkg/graph"
+	"lead-net-affinity/pkg/kube"
+	"lead-net-affinity/pkg/metrics"
+	promc "lead-net-affinity/pkg/prometheus"
+	"lead-net-affinity/pkg/rbac"
+	"lead-net-affinity/pkg/rulegen"
+)
+
+// ZoneTarget is a zone's part of a ZonePlan.
+type ZoneTarget struct {
+	Zone string `json:"zone"`
+
+	// TrafficShare is the share of the requests sent from the zone: each
+	// caller's request rate to the service (1 when unmeasured) split over
+	// the zones its pods run in, or for the entry service with
+	// prometheus.gateway.origin, the users' requests from the zone.
+	TrafficShare float64 `json:"trafficShare"`
+
+	Current int   `json:"current"` // replicas running in the zone
+	Target  int32 `json:"target"`
+	Weight  int32 `json:"weight,omitempty"` // node affinity weight; omitted for zones without a target
+}
+
+// Sources of a ZonePlan's traffic shares.
+const (
+	ZoneOriginCallers = "callers" // the callers' pods
+	ZoneOriginGateway = "gateway" // user traffic, prometheus.gateway.origin
+)
+
+// ZonePlan is a service's target replica distribution over zones.
+type ZonePlan struct {
+	Service    string       `json:"service"`
+	Namespace  string       `json:"namespace"`
+	Deployment string       `json:"deployment"`
+	Replicas   int32        `json:"replicas"`
+	Origin     string       `json:"origin"`  // callers or gateway
+	MaxSkew    int32        `json:"maxSkew"` // of the zone topology spread constraint
+	Zones      []ZoneTarget `json:"zones"`   // every zone with service pods
+}
+
+// ZonePlans is the response of GET /zones/plan.
+type ZonePlans struct {
+	Time  time.Time  `json:"time"`
+	Plans []ZonePlan `json:"plans"`
+}
+
+// zonePlanStore keeps the plans of the last full reconcile; scoped
+// reconciles reuse them, as they do not fetch request rates.
+type zonePlanStore struct {
+	mu    sync.RWMutex
+	time  time.Time
+	plans map[graph.NodeID]ZonePlan
+}
+
+// applyZonePlans plans the zone distribution of every service called from
+// a known zone and expresses it on the service's deployment (see
+// rulegen.ApplyZoneSpread).
+func (c *Controller) applyZonePlans(
+	ctx context.Context,
+	g *graph.Graph,
+	edgeRPS *promc.ServiceRPSMatrix,
+	deploysBySvc map[graph.NodeID]*appsv1.Deployment,
+	scope Scope,
+) {
+	zc := c.cfg.Affinity.ZonePlan
+	if !zc.Enabled {
+		return
+	}
+	if scope.IsEmpty() || c.zonePlans.plans == nil {
+		var nodes kube.NodeGetter
+		if c.caps.Has(rbac.FeatureNodes) {
+			nodes = c.k8s
+		}
+		idx := kube.BuildPlacementIndex(ctx, c.k8s, nodes, c.cfg.NamespaceSelector, c.identity)
+		plans := planZones(g, idx, edgeRPS, c.fetchGatewayOrigin(ctx), deploysBySvc, zc.WeightOrDefault())
+		c.zonePlans.mu.Lock()
+		c.zonePlans.time, c.zonePlans.plans = time.Now(), plans
+		c.zonePlans.mu.Unlock()
+
+		metrics.Default.Reset("lead_net_zone_replicas_target")
+		for svc, p := range plans {
+			for _, z := range p.Zones {
+				labels := map[string]string{"service": string(svc), "zone": z.Zone}
+				for k, v := range c.metricLabels() {
+					labels[k] = v
+				}
+				metrics.Default.Set("lead_net_zone_replicas_target", "Replicas the zone plan puts in a zone.", labels, float64(z.Target))
+			}
+		}
+	}
+
+	c.zonePlans.mu.RLock()
+	defer c.zonePlans.mu.RUnlock()
+	for svc, p := range c.zonePlans.plans {
+		d, ok := deploysBySvc[svc]
+		if !ok {
+			continue
+		}
+		rulegen.ApplyZoneSpread(d, rulegen.ZoneSpread{
+			Weights:  p.weights(),
+			MaxSkew:  p.MaxSkew,
+			Selector: c.identity.PodSelector(svc, d.Spec.Template.Labels),
+		})
+	}
+}
+
+// weights returns the node affinity weight of each zone with a target.
+func (p ZonePlan) weights() map[string]int32 {
+	out := make(map[string]int32)
+	for _, z := range p.Zones {
+		if z.Weight > 0 {
+			out[z.Zone] = z.Weight
+		}
+	}
+	return out
+}
+
+// planZones splits each service's replicas over zones in proportion to
+// where its callers' requests come from (largest remainder), weighting the
+// busiest zone maxWeight. The entry service follows the user traffic of
+// gateway (by zone) instead, if measured. Services without callers in a
+// known zone get no plan.
+func planZones(
+	g *graph.Graph,
+	idx *kube.PlacementIndex,
+	edgeRPS *promc.ServiceRPSMatrix,
+	gateway map[string]float64,
+	deploysBySvc map[graph.NodeID]*appsv1.Deployment,
+	maxWeight int,
+) map[graph.NodeID]ZonePlan {
+	zonePods := func(svc graph.NodeID) (map[string]int, int) {
+		out, total := make(map[string]int), 0
+		for node, n := range idx.NodesForService(svc) {
+			if z := idx.ZoneForNode(node); z != "" {
+				out[z] += n
+				total += n
+			}
+		}
+		return out, total
+	}
+
+	// User traffic only counts for zones with service pods, if any are
+	// known: other zones have no nodes to place replicas on.
+	known := make(map[string]bool)
+	for _, z := range idx.NodeZones {
+		if z != "" {
+			known[z] = true
+		}
+	}
+
+	plans := make(map[graph.NodeID]ZonePlan)
+	for svc, d := range deploysBySvc {
+		origin := make(map[string]float64)
+		var sum float64
+		source := ZoneOriginCallers
+		if svc == g.Entry {
+			for z, rps := range gateway {
+				if len(known) == 0 || known[z] {
+					origin[z] += rps
+					sum += rps
+				}
+			}
+			if sum > 0 {
+				source = ZoneOriginGateway
+			}
+		}
+		for caller, n := range g.Nodes {
+			if source != ZoneOriginCallers || !dependsOn(n, svc) {
+				continue
+			}
+			w := 1.0
+			if edgeRPS != nil {
+				if rps, ok := edgeRPS.RPS(string(caller), string(svc)); ok {
+					w = rps
+				}
+			}
+			pods, total := zonePods(caller)
+			for z, k := range pods {
+				origin[z] += w * float64(k) / float64(total)
+				sum += w * float64(k) / float64(total)
+			}
+		}
+		if sum <= 0 {
+			continue
+		}
+
+		replicas := int32(1)
+		if d.Spec.Replicas != nil {
+			replicas = *d.Spec.Replicas
+		}
+		current, _ := zonePods(svc)
+		zones := make([]string, 0, len(origin)+len(current))
+		for z := range origin {
+			zones = append(zones, z)
+		}
+		for z := range current {
+			if _, ok := origin[z]; !ok {
+				zones = append(zones, z)
+			}
+		}
+		sort.Strings(zones)
+
+		plan := ZonePlan{Service: string(svc), Namespace: d.Namespace, Deployment: d.Name, Replicas: replicas, Origin: source}
+		var busiest float64
+		for _, z := range zones {
+			plan.Zones = append(plan.Zones, ZoneTarget{Zone: z, TrafficShare: origin[z] / sum, Current: current[z]})
+			busiest = math.Max(busiest, origin[z]/sum)
+		}
+		distribute(plan.Zones, replicas)
+		minT, maxT := plan.Zones[0].Target, plan.Zones[0].Target
+		for i := range plan.Zones {
+			z := &plan.Zones[i]
+			minT, maxT = min(minT, z.Target), max(maxT, z.Target)
+			if z.Target > 0 {
+				z.Weight = int32(max(math.Round(float64(maxWeight)*z.TrafficShare/busiest), 1))
+			}
+		}
+		plan.MaxSkew = max(maxT-minT, 1)
+		plans[svc] = plan
+	}
+	return plans
+}
+
+// distribute sets the zones' targets to replicas split by traffic share,
+// handing the remainder to the largest fractions (ties by zone).
+func distribute(zones []ZoneTarget, replicas int32) {
+	type frac struct {
+		i int
+		f float64
+	}
+	left := replicas
+	fracs := make([]frac, len(zones))
+	for i := range zones {
+		exact := float64(replicas) * zones[i].TrafficShare
+		zones[i].Target = int32(math.Floor(exact))
+		left -= zones[i].Target
+		fracs[i] = frac{i, exact - math.Floor(exact)}
+	}
+	sort.SliceStable(fracs, func(a, b int) bool { return fracs[a].f > fracs[b].f })
+	for k := 0; left > 0 && k < len(fracs); k++ {
+		zones[fracs[k].i].Target++
+		left--
+	}
+}
+
+func dependsOn(n *graph.Node, svc graph.NodeID) bool {
+	for _, dep := range n.DependsOn {
+		if dep == svc {
+			return true
+		}
+	}
+	return false
+}
+
+// ZonePlans returns the zone plans of the last full reconcile.
+func (c *Controller) ZonePlans() ZonePlans {
+	c.zonePlans.mu.RLock()
+	defer c.zonePlans.mu.RUnlock()
+	out := ZonePlans{Time: c.zonePlans.time, Plans: []ZonePlan{}}
+	for _, p := range c.zonePlans.plans {
+		out.Plans = append(out.Plans, p)
+	}
+	sort.Slice(out.Plans, func(i, j int) bool { return out.Plans[i].Service < out.Plans[j].Service })
+	return out
+}
@@ -0,0 +1,248 @@
+// Package dashboard generates the Grafana dashboard for the metrics the
+// controller exports. The committed copies (deploy/grafana-dashboard.yaml
+// and the Helm chart's files/grafana-dashboard.json) are rendered from
+// Rows by "lead-net-affinity dashboard", and tests check that every
+// exported metric is charted and every charted metric is exported.
+package dashboard
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// UID is the dashboard's stable Grafana UID.
+const UID = "lead-net-affinity"
+
+// FileName is the dashboard's key in the provisioning ConfigMap.
+const FileName = "lead-net-affinity.json"
+
+// SidecarLabel marks ConfigMaps the Grafana dashboard sidecar provisions.
+const SidecarLabel = "grafana_dashboard"
+
+// Row groups related panels.
+type Row struct {
+	Title  string
+	Panels []Panel
+}
+
+// Panel is one chart: a time series unless Stat is set.
+type Panel struct {
+	Title   string
+	Unit    string // Grafana unit, e.g. s, ms, percentunit
+	Stat    bool
+	Targets []Target
+}
+
+// Target is one PromQL query of a panel.
+type Target struct {
+	Expr   string
+	Legend string
+}
+
+// Rows are the dashboard's content, top to bottom.
+var Rows = []Row{
+	{Title: "Reconcile", Panels: []Panel{
+		{Title: "Reconciles per minute", Targets: []Target{
+			{Expr: "rate(lead_net_reconcile_total[5m]) * 60", Legend: "reconciles"},
+			{Expr: "rate(lead_net_reconcile_errors_total[5m]) * 60", Legend: "with errors"},
+		}},
+		{Title: "Reconcile duration", Unit: "s", Targets: []Target{{Expr: "lead_net_reconcile_duration_seconds", Legend: "duration"}}},
+		{Title: "Since last successful reconcile", Unit: "s", Stat: true, Targets: []Target{
+			{Expr: "time() - lead_net_last_success_timestamp_seconds", Legend: "age"},
+		}},
+		{Title: "Components up", Targets: []Target{{Expr: "lead_net_component_up", Legend: "{{component}}"}}},
+		{Title: "Since last successful component cycle", Unit: "s", Targets: []Target{
+			{Expr: "time() - lead_net_component_last_success_timestamp_seconds", Legend: "{{component}}"},
+		}},
+		{Title: "Panics and loop restarts per hour", Targets: []Target{
+			{Expr: "increase(lead_net_loop_panics_total[1h])", Legend: "panics {{loop}}"},
+			{Expr: "increase(lead_net_loop_restarts_total[1h])", Legend: "restarts {{loop}}"},
+		}},
+		{Title: "Loop restart backoff", Unit: "s", Targets: []Target{{Expr: "lead_net_loop_restart_backoff_seconds", Legend: "{{loop}}"}}},
+		{Title: "Paths evaluated", Targets: []Target{{Expr: "lead_net_paths_evaluated", Legend: "paths"}}},
+		{Title: "Deployment updates per hour", Targets: []Target{
+			{Expr: "increase(lead_net_deployments_updated_total[1h])", Legend: "updated"},
+			{Expr: "lead_net_deployments_ignored", Legend: "ignored (lead.io/ignore)"},
+			{Expr: "lead_net_deployments_foreign", Legend: "managed by another controller"},
+		}},
+		{Title: "Rollouts and approvals", Targets: []Target{
+			{Expr: "lead_net_rollouts_in_progress", Legend: "rolling out"},
+			{Expr: "lead_net_rollout_deferred", Legend: "deferred"},
+			{Expr: "lead_net_approvals_pending", Legend: "pending approval"},
+		}},
+	}},
+	{Title: "Critical paths", Panels: []Panel{
+		{Title: "Path score", Targets: []Target{{Expr: "lead_net_path_score", Legend: "{{path}}"}}},
+		{Title: "Path network penalty", Targets: []Target{{Expr: "lead_net_path_network_penalty", Legend: "{{path}}"}}},
+		{Title: "Paths on the Pareto front", Stat: true, Targets: []Target{{Expr: "lead_net_pareto_front_size", Legend: "paths"}}},
+		{Title: "Path health (0 healthy, 3 unhealthy)", Targets: []Target{{Expr: "lead_net_path_health", Legend: "{{path}}"}}},
+		{Title: "Path error budget burn rate", Targets: []Target{{Expr: "lead_net_path_error_budget_burn_rate", Legend: "{{path}}"}}},
+		{Title: "Gateway latency", Unit: "ms", Targets: []Target{{Expr: "lead_net_gateway_latency_ms", Legend: "latency"}}},
+		{Title: "User traffic by client zone", Unit: "reqps", Targets: []Target{{Expr: "lead_net_gateway_origin_rps", Legend: "{{zone}}"}}},
+		{Title: "Gateway error budget burn rate", Targets: []Target{{Expr: "lead_net_gateway_error_budget_burn_rate", Legend: "burn rate"}}},
+	}},
+	{Title: "Nodes and rebalancing", Panels: []Panel{
+		{Title: "Bad nodes", Targets: []Target{
+			{Expr: "lead_net_bad_nodes", Legend: "flagged"},
+			{Expr: "lead_net_degraded_nodes_tainted", Legend: "tainted"},
+		}},
+		{Title: "Pods rescheduled per hour", Targets: []Target{{Expr: "increase(lead_net_pods_rescheduled_total[1h])", Legend: "rescheduled"}}},
+		{Title: "Pods not co-located (zone full)", Targets: []Target{{Expr: "lead_net_desired_capacity", Legend: "{{zone}}"}}},
+		{Title: "CPU needed for co-location", Unit: "cores", Targets: []Target{{Expr: "lead_net_desired_capacity_cpu_cores", Legend: "{{zone}}"}}},
+	}},
+	{Title: "Services", Panels: []Panel{
+		{Title: "Ready replicas", Unit: "percentunit", Targets: []Target{{Expr: "lead_net_service_ready_ratio", Legend: "{{service}}"}}},
+		{Title: "Target replicas per zone", Targets: []Target{{Expr: "lead_net_zone_replicas_target", Legend: "{{service}} {{zone}}"}}},
+		{Title: "Next-hour request rate forecast", Unit: "reqps", Targets: []Target{{Expr: "lead_net_forecast_rps", Legend: "{{service}}"}}},
+		{Title: "Passing health checks", Unit: "percentunit", Targets: []Target{{Expr: "lead_net_service_probe_healthy_ratio", Legend: "{{service}}"}}},
+	}},
+	{Title: "Effectiveness", Panels: []Panel{
+		{Title: "Critical-path traffic crossing nodes and zones", Unit: "percentunit", Targets: []Target{
+			{Expr: "lead_net_critical_path_cross_node_ratio", Legend: "cross-node"},
+			{Expr: "lead_net_critical_path_cross_zone_ratio", Legend: "cross-zone"},
+		}},
+		{Title: "Decision epoch", Stat: true, Targets: []Target{{Expr: "lead_net_decision_epoch", Legend: "epoch"}}},
+		{Title: "Current decision", Stat: true, Targets: []Target{{Expr: "lead_net_decision_info", Legend: "{{decision_id}}"}}},
+		{Title: "Placement checks per hour", Targets: []Target{
+			{Expr: "increase(lead_net_affinity_verification_checks_total[1h])", Legend: "{{result}}"},
+		}},
+		{Title: "Affinity terms flagged and escalated", Targets: []Target{
+			{Expr: "lead_net_affinity_rules_flagged", Legend: "flagged"},
+			{Expr: "lead_net_affinity_rules_escalated", Legend: "relaxed to zone"},
+		}},
+	}},
+	{Title: "Data quality", Panels: []Panel{
+		{Title: "Scoring inputs by confidence", Targets: []Target{{Expr: "lead_net_data_inputs", Legend: "{{kind}} {{confidence}}"}}},
+		{Title: "Outliers rejected", Targets: []Target{{Expr: "lead_net_metric_outliers_rejected", Legend: "{{kind}}"}}},
+		{Title: "Graph drift and inferred edges", Targets: []Target{
+			{Expr: "lead_net_graph_drift_edges", Legend: "{{kind}}"},
+			{Expr: "lead_net_inferred_edges", Legend: "inferred (DNS)"},
+		}},
+		{Title: "Affinity selectors matching no pod", Targets: []Target{{Expr: "lead_net_affinity_selectors_unmatched", Legend: "unmatched"}}},
+		{Title: "Cache entries", Targets: []Target{{Expr: "lead_net_cache_entries", Legend: "{{cache}}"}}},
+	}},
+	{Title: "Kubernetes API", Panels: []Panel{
+		{Title: "API retries and failures per minute", Targets: []Target{
+			{Expr: "rate(lead_net_kube_retries_total[5m]) * 60", Legend: "retried {{op}}"},
+			{Expr: "rate(lead_net_kube_failures_total[5m]) * 60", Legend: "failed {{op}}"},
+			{Expr: "rate(lead_net_kube_conflicts_total[5m]) * 60", Legend: "update conflicts"},
+		}},
+	}},
+}
+
+var metricName = regexp.MustCompile(`lead_net_[a-z_]+`)
+
+// Metrics lists the metrics the dashboard queries.
+func Metrics() []string {
+	seen := make(map[string]bool)
+	for _, r := range Rows {
+		for _, p := range r.Panels {
+			for _, t := range p.Targets {
+				for _, m := range metricName.FindAllString(t.Expr, -1) {
+					seen[m] = true
+				}
+			}
+		}
+	}
+	out := make([]string, 0, len(seen))
+	for m := range seen {
+		out = append(out, m)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Grid layout: panels per row and panel size in grid units (24 wide).
+const (
+	panelsPerRow = 3
+	panelWidth   = 24 / panelsPerRow
+	panelHeight  = 8
+)
+
+var datasource = map[string]string{"type": "prometheus", "uid": "${datasource}"}
+
+// JSON renders the dashboard model.
+func JSON() ([]byte, error) {
+	var panels []map[string]any
+	id, y := 1, 0
+	for _, r := range Rows {
+		panels = append(panels, map[string]any{
+			"id": id, "type": "row", "title": r.Title, "collapsed": false,
+			"gridPos": map[string]int{"x": 0, "y": y, "w": 24, "h": 1},
+		})
+		id++
+		y++
+		for i, p := range r.Panels {
+			panels = append(panels, panelJSON(p, id, i%panelsPerRow*panelWidth, y+i/panelsPerRow*panelHeight))
+			id++
+		}
+		y += (len(r.Panels) + panelsPerRow - 1) / panelsPerRow * panelHeight
+	}
+	d := map[string]any{
+		"uid":           UID,
+		"title":         "LEAD network affinity",
+		"tags":          []string{"lead-net-affinity"},
+		"schemaVersion": 39,
+		"editable":      true,
+		"refresh":       "1m",
+		"time":          map[string]string{"from": "now-24h", "to": "now"},
+		"templating": map[string]any{"list": []map[string]any{{
+			"name": "datasource", "label": "Prometheus", "type": "datasource", "query": "prometheus",
+		}}},
+		"panels": panels,
+	}
+	b, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
+
+func panelJSON(p Panel, id, x, y int) map[string]any {
+	targets := make([]map[string]any, len(p.Targets))
+	for i, t := range p.Targets {
+		targets[i] = map[string]any{
+			"refId": string(rune('A' + i)), "datasource": datasource, "expr": t.Expr, "legendFormat": t.Legend,
+		}
+	}
+	typ := "timeseries"
+	if p.Stat {
+		typ = "stat"
+	}
+	out := map[string]any{
+		"id": id, "type": typ, "title": p.Title, "datasource": datasource, "targets": targets,
+		"gridPos": map[string]int{"x": x, "y": y, "w": panelWidth, "h": panelHeight},
+	}
+	if p.Unit != "" {
+		out["fieldConfig"] = map[string]any{"defaults": map[string]string{"unit": p.Unit}, "overrides": []any{}}
+	}
+	return out
+}
+
+// ConfigMap renders the dashboard as a ConfigMap the Grafana dashboard
+// sidecar provisions.
+func ConfigMap(name, namespace string) ([]byte, error) {
+	data, err := JSON()
+	if err != nil {
+		return nil, err
+	}
+	cm := corev1.ConfigMap{
+		TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name, Namespace: namespace,
+			Labels: map[string]string{SidecarLabel: "1", "app.kubernetes.io/name": "lead-net-affinity"},
+		},
+		Data: map[string]string{FileName: string(data)},
+	}
+	b, err := yaml.Marshal(cm)
+	if err != nil {
+		return nil, fmt.Errorf("render dashboard ConfigMap: %w", err)
+	}
+	return b, nil
+}
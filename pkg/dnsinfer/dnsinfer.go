@@ -0,0 +1,116 @@
+// Package dnsinfer approximates service-to-service edges from DNS lookups,
+// for clusters without a service mesh, Hubble or tracing. A pod resolving
+// <svc>.<ns>.svc.<domain> is taken as a hint that its service calls svc.
+// Lookups are not requests (clients cache, retry and resolve names they
+// never dial), so these edges are low-confidence and only fill gaps.
+package dnsinfer
+
+import (
+	"net"
+	"sort"
+	"strings"
+
+	promc "lead-net-affinity/pkg/prometheus"
+)
+
+// DefaultClusterDomain is the Kubernetes cluster DNS domain.
+const DefaultClusterDomain = "cluster.local"
+
+// Query is one DNS lookup: who asked, and for which name.
+type Query struct {
+	ClientIP string
+	Name     string
+}
+
+// ParseCoreDNSLog parses a line written by the CoreDNS log plugin in its
+// default format, e.g.
+//
+//	[INFO] 10.244.1.7:51234 - 4242 "A IN search.default.svc.cluster.local. udp 50 false 512" NOERROR qr,aa,rd 106 0.0001s
+func ParseCoreDNSLog(line string) (Query, bool) {
+	open := strings.IndexByte(line, '"')
+	if open < 0 {
+		return Query{}, false
+	}
+	end := strings.IndexByte(line[open+1:], '"')
+	if end < 0 {
+		return Query{}, false
+	}
+
+	head := strings.Fields(line[:open])
+	if len(head) < 2 {
+		return Query{}, false
+	}
+	// The remote address precedes " - <id>"; it is the first field that
+	// parses as host:port.
+	var client string
+	for _, f := range head {
+		if host, _, err := net.SplitHostPort(f); err == nil && net.ParseIP(host) != nil {
+			client = host
+			break
+		}
+	}
+	q := strings.Fields(line[open+1 : open+1+end])
+	if client == "" || len(q) < 3 {
+		return Query{}, false
+	}
+	return Query{ClientIP: client, Name: q[2]}, true
+}
+
+// ServiceFromName returns the service and namespace addressed by a cluster
+// DNS name (<svc>.<ns>.svc.<domain>[.]). Search-path expansions of external
+// names (api.example.com.default.svc.cluster.local) are rejected.
+func ServiceFromName(name, clusterDomain string) (svc, namespace string, ok bool) {
+	if clusterDomain == "" {
+		clusterDomain = DefaultClusterDomain
+	}
+	name = strings.TrimSuffix(strings.ToLower(name), ".")
+	rest, found := strings.CutSuffix(name, ".svc."+clusterDomain)
+	if !found {
+		return "", "", false
+	}
+	parts := strings.Split(rest, ".")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+// Edge is an inferred caller -> callee dependency.
+type Edge struct {
+	Pair    promc.ServicePair
+	Queries int
+}
+
+// Infer counts queries per caller/callee service. podServices maps pod IPs
+// to the service running there; lookups from unknown IPs, for names outside
+// the cluster or from a service to itself are dropped. Edges are sorted by
+// descending query count, then by name.
+func Infer(queries []Query, podServices map[string]string, clusterDomain string) []Edge {
+	counts := make(map[promc.ServicePair]int)
+	for _, q := range queries {
+		src, ok := podServices[q.ClientIP]
+		if !ok {
+			continue
+		}
+		dst, _, ok := ServiceFromName(q.Name, clusterDomain)
+		if !ok || dst == src {
+			continue
+		}
+		counts[promc.ServicePair{Src: src, Dst: dst}]++
+	}
+
+	edges := make([]Edge, 0, len(counts))
+	for p, n := range counts {
+		edges = append(edges, Edge{Pair: p, Queries: n})
+	}
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].Queries != edges[j].Queries {
+			return edges[i].Queries > edges[j].Queries
+		}
+		if edges[i].Pair.Src != edges[j].Pair.Src {
+			return edges[i].Pair.Src < edges[j].Pair.Src
+		}
+		return edges[i].Pair.Dst < edges[j].Pair.Dst
+	})
+	return edges
+}
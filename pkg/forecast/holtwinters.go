@@ -0,0 +1,63 @@
+// Package forecast predicts request rates from their hourly history with
+// exponential smoothing, so placement and scaling can anticipate daily
+// peaks and batch spikes instead of reacting to them.
+package forecast
+
+// Models reported with a forecast.
+const (
+	ModelHoltWinters = "holt-winters" // level, trend and season
+	ModelHolt        = "holt"         // level and trend, too little history for a season
+)
+
+// Params are the smoothing factors (each in [0, 1]) and the season length
+// in samples.
+type Params struct {
+	Alpha  float64 // level
+	Beta   float64 // trend
+	Gamma  float64 // season
+	Season int
+}
+
+// HoltWinters forecasts xs h samples past its last one with additive
+// Holt-Winters smoothing. With fewer than two seasons of samples it falls
+// back to Holt's linear smoothing; with fewer than two samples there is no
+// forecast. Forecasts are clamped at 0, as rates cannot be negative.
+func HoltWinters(xs []float64, p Params, h int) (value float64, model string, ok bool) {
+	m := p.Season
+	if m < 2 || len(xs) < 2*m {
+		v, ok := Holt(xs, p.Alpha, p.Beta, h)
+		return v, ModelHolt, ok
+	}
+
+	var level, trend float64
+	for i := 0; i < m; i++ {
+		level += xs[i] / float64(m)
+		trend += (xs[m+i] - xs[i]) / float64(m*m)
+	}
+	season := make([]float64, m)
+	for i := range season {
+		season[i] = xs[i] - level
+	}
+	for t := m; t < len(xs); t++ {
+		prev := level
+		level = p.Alpha*(xs[t]-season[t%m]) + (1-p.Alpha)*(level+trend)
+		trend = p.Beta*(level-prev) + (1-p.Beta)*trend
+		season[t%m] = p.Gamma*(xs[t]-level) + (1-p.Gamma)*season[t%m]
+	}
+	return max(level+float64(h)*trend+season[(len(xs)-1+h)%m], 0), ModelHoltWinters, true
+}
+
+// Holt forecasts xs h samples past its last one with Holt's linear
+// (double exponential) smoothing; ok is false with fewer than two samples.
+func Holt(xs []float64, alpha, beta float64, h int) (float64, bool) {
+	if len(xs) < 2 {
+		return 0, false
+	}
+	level, trend := xs[0], xs[1]-xs[0]
+	for _, x := range xs[1:] {
+		prev := level
+		level = alpha*x + (1-alpha)*(level+trend)
+		trend = beta*(level-prev) + (1-beta)*trend
+	}
+	return max(level+float64(h)*trend, 0), true
+}
@@ -0,0 +1,68 @@
+package forecast
+
+import "time"
+
+// Series aggregates samples into hourly means, keeping the most recent
+// complete hours. An hour without samples (a restart or a quiet period)
+// repeats the mean before it, so the season stays aligned with the clock.
+type Series struct {
+	max   int
+	hours []float64 // complete hours, oldest first
+	cur   time.Time // start of the hour being aggregated
+	sum   float64
+	n     int
+}
+
+// NewSeries returns a series keeping at most maxHours complete hours.
+func NewSeries(maxHours int) *Series {
+	return &Series{max: max(maxHours, 1)}
+}
+
+// Add records v at t. Samples older than the hour being aggregated are
+// dropped.
+func (s *Series) Add(t time.Time, v float64) {
+	h := t.Truncate(time.Hour)
+	switch {
+	case s.cur.IsZero():
+		s.cur = h
+	case h.Before(s.cur):
+		return
+	case h.After(s.cur):
+		if s.n > 0 {
+			mean := s.sum / float64(s.n)
+			s.push(mean)
+			for gap := s.cur.Add(time.Hour); gap.Before(h) && gap.Sub(s.cur) <= time.Duration(s.max)*time.Hour; gap = gap.Add(time.Hour) {
+				s.push(mean)
+			}
+		}
+		s.cur, s.sum, s.n = h, 0, 0
+	}
+	s.sum += v
+	s.n++
+}
+
+func (s *Series) push(v float64) {
+	s.hours = append(s.hours, v)
+	if len(s.hours) > s.max {
+		s.hours = append(s.hours[:0], s.hours[len(s.hours)-s.max:]...)
+	}
+}
+
+// Hours returns a copy of the complete hourly means, oldest first.
+func (s *Series) Hours() []float64 {
+	return append([]float64(nil), s.hours...)
+}
+
+// Forecast predicts the mean of the hour containing at, which must be
+// after the hour being aggregated.
+func (s *Series) Forecast(p Params, at time.Time) (value float64, model string, ok bool) {
+	if len(s.hours) == 0 {
+		return 0, "", false
+	}
+	// the last complete hour is the one before s.cur
+	h := int(at.Truncate(time.Hour).Sub(s.cur)/time.Hour) + 1
+	if h < 1 {
+		return 0, "", false
+	}
+	return HoltWinters(s.hours, p, h)
+}
@@ -0,0 +1,80 @@
+package graph
+
+import "sort"
+
+// Edge is a caller -> callee dependency.
+type Edge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// DocumentDiff lists what changed between two graph documents.
+type DocumentDiff struct {
+	EntryBefore     string   `json:"entryBefore,omitempty"` // set when the entry changed
+	EntryAfter      string   `json:"entryAfter,omitempty"`
+	AddedServices   []string `json:"addedServices,omitempty"`
+	RemovedServices []string `json:"removedServices,omitempty"`
+	AddedEdges      []Edge   `json:"addedEdges,omitempty"`
+	RemovedEdges    []Edge   `json:"removedEdges,omitempty"`
+}
+
+// Empty reports whether the documents describe the same graph.
+func (d DocumentDiff) Empty() bool {
+	return d.EntryBefore == d.EntryAfter && len(d.AddedServices)+len(d.RemovedServices)+len(d.AddedEdges)+len(d.RemovedEdges) == 0
+}
+
+// DiffDocuments compares before and after. Results are sorted.
+func DiffDocuments(before, after *Document) DocumentDiff {
+	var out DocumentDiff
+	if before.Entry != after.Entry {
+		out.EntryBefore, out.EntryAfter = before.Entry, after.Entry
+	}
+	bs, be := documentSets(before)
+	as, ae := documentSets(after)
+	for s := range as {
+		if !bs[s] {
+			out.AddedServices = append(out.AddedServices, s)
+		}
+	}
+	for s := range bs {
+		if !as[s] {
+			out.RemovedServices = append(out.RemovedServices, s)
+		}
+	}
+	for e := range ae {
+		if !be[e] {
+			out.AddedEdges = append(out.AddedEdges, e)
+		}
+	}
+	for e := range be {
+		if !ae[e] {
+			out.RemovedEdges = append(out.RemovedEdges, e)
+		}
+	}
+	sort.Strings(out.AddedServices)
+	sort.Strings(out.RemovedServices)
+	sortEdges(out.AddedEdges)
+	sortEdges(out.RemovedEdges)
+	return out
+}
+
+func documentSets(d *Document) (map[string]bool, map[Edge]bool) {
+	services := make(map[string]bool, len(d.Services))
+	edges := make(map[Edge]bool)
+	for _, s := range d.Services {
+		services[s.Name] = true
+		for _, dep := range s.DependsOn {
+			edges[Edge{From: s.Name, To: dep}] = true
+		}
+	}
+	return services, edges
+}
+
+func sortEdges(edges []Edge) {
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].From != edges[j].From {
+			return edges[i].From < edges[j].From
+		}
+		return edges[i].To < edges[j].To
+	})
+}
@@ -0,0 +1,421 @@
+package graph
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Document identification and the formats it can be written in.
+const (
+	DocumentAPIVersion = "lead.io/v1alpha1"
+	DocumentKind       = "ServiceGraph"
+
+	FormatYAML    = "yaml"
+	FormatJSON    = "json"
+	FormatGraphML = "graphml"
+)
+
+// Document is the exchange format for service graphs, so graphs built by
+// other tooling (trace analysis, architecture docs) can be loaded instead of
+// declared in the config. As YAML (JSON uses the same field names):
+//
+//	apiVersion: lead.io/v1alpha1
+//	kind: ServiceGraph
+//	entry: frontend
+//	services:
+//	  - name: frontend
+//	    dependsOn: [search, cache]
+//	    labelSelector: {app: web}   # optional, see kube.ServiceIdentity
+//	    inferred: [cache]           # optional: dependencies that were inferred
+//	    version: "1.4.2"            # optional: version, owner and metadata
+//	    owner: team-search          # describe the service
+//	    metadata: {tier: gold}
+//	    ports:                      # optional: see Port
+//	      - {name: http, port: 80, targetPort: 8080, appProtocol: http}
+//	  - name: search
+//	  - name: cache
+//
+// GraphML is supported too: nodes are services (named by a "name" or
+// "label" node attribute, else the node id), directed edges are
+// dependencies, and the entry is the "entry" graph attribute or else the
+// only node without callers.
+type Document struct {
+	APIVersion string            `json:"apiVersion" yaml:"apiVersion"`
+	Kind       string            `json:"kind" yaml:"kind"`
+	Entry      string            `json:"entry" yaml:"entry"`
+	Services   []DocumentService `json:"services" yaml:"services"`
+}
+
+// DocumentService is one service of a Document.
+type DocumentService struct {
+	Name          string            `json:"name" yaml:"name"`
+	DependsOn     []string          `json:"dependsOn,omitempty" yaml:"dependsOn,omitempty,flow"`
+	LabelSelector map[string]string `json:"labelSelector,omitempty" yaml:"labelSelector,omitempty,flow"`
+	Inferred      []string          `json:"inferred,omitempty" yaml:"inferred,omitempty,flow"`
+	Version       string            `json:"version,omitempty" yaml:"version,omitempty"`
+	Owner         string            `json:"owner,omitempty" yaml:"owner,omitempty"`
+	Metadata      map[string]string `json:"metadata,omitempty" yaml:"metadata,omitempty,flow"`
+	Ports         []Port            `json:"ports,omitempty" yaml:"ports,omitempty"`
+}
+
+// Document returns g in the exchange format, services sorted by name.
+func (g *Graph) Document() *Document {
+	doc := &Document{APIVersion: DocumentAPIVersion, Kind: DocumentKind, Entry: string(g.Entry)}
+	for id, n := range g.Nodes {
+		s := DocumentService{Name: string(id), LabelSelector: n.LabelSelector, Version: n.Version, Owner: n.Owner, Metadata: n.Metadata, Ports: n.Ports}
+		for _, dep := range n.DependsOn {
+			s.DependsOn = append(s.DependsOn, string(dep))
+			if n.Inferred[dep] {
+				s.Inferred = append(s.Inferred, string(dep))
+			}
+		}
+		doc.Services = append(doc.Services, s)
+	}
+	sort.Slice(doc.Services, func(i, j int) bool { return doc.Services[i].Name < doc.Services[j].Name })
+	return doc
+}
+
+// Validate checks that the entry and every dependency are services, names
+// are unique and the graph has no cycles.
+func (d *Document) Validate() error {
+	if d.Kind != "" && d.Kind != DocumentKind {
+		return fmt.Errorf("graph document: kind %q, want %s", d.Kind, DocumentKind)
+	}
+	if d.APIVersion != "" && d.APIVersion != DocumentAPIVersion {
+		return fmt.Errorf("graph document: unsupported apiVersion %q (supported: %s)", d.APIVersion, DocumentAPIVersion)
+	}
+	names := make(map[string]bool, len(d.Services))
+	for i, s := range d.Services {
+		if s.Name == "" {
+			return fmt.Errorf("graph document: services[%d]: name is required", i)
+		}
+		if names[s.Name] {
+			return fmt.Errorf("graph document: duplicate service %q", s.Name)
+		}
+		names[s.Name] = true
+		for _, p := range s.Ports {
+			if err := p.Validate(); err != nil {
+				return fmt.Errorf("graph document: %s: %w", s.Name, err)
+			}
+		}
+	}
+	if !names[d.Entry] {
+		return fmt.Errorf("graph document: entry %q is not a service", d.Entry)
+	}
+	for _, s := range d.Services {
+		for _, dep := range s.DependsOn {
+			if !names[dep] {
+				return fmt.Errorf("graph document: %s depends on unknown service %q", s.Name, dep)
+			}
+		}
+	}
+	g := d.graph()
+	for id, n := range g.Nodes {
+		for _, dep := range n.DependsOn {
+			if g.reaches(dep, id, map[NodeID]bool{}) {
+				return fmt.Errorf("graph document: cycle through %s -> %s", id, dep)
+			}
+		}
+	}
+	return nil
+}
+
+// Graph validates d and builds the graph it describes.
+func (d *Document) Graph() (*Graph, error) {
+	if err := d.Validate(); err != nil {
+		return nil, err
+	}
+	return d.graph(), nil
+}
+
+func (d *Document) graph() *Graph {
+	g := &Graph{Nodes: make(map[NodeID]*Node, len(d.Services)), Entry: NodeID(d.Entry)}
+	for _, s := range d.Services {
+		n := &Node{ID: NodeID(s.Name), LabelSelector: s.LabelSelector, Version: s.Version, Owner: s.Owner, Metadata: s.Metadata, Ports: s.Ports}
+		for _, dep := range s.DependsOn {
+			n.DependsOn = append(n.DependsOn, NodeID(dep))
+		}
+		for _, dep := range s.Inferred {
+			if n.Inferred == nil {
+				n.Inferred = map[NodeID]bool{}
+			}
+			n.Inferred[NodeID(dep)] = true
+		}
+		g.Nodes[n.ID] = n
+	}
+	return g
+}
+
+// ParseDocument reads a graph document. format is FormatYAML (which also
+// reads JSON), FormatJSON or FormatGraphML; "" guesses from the content.
+// The document is validated.
+func ParseDocument(data []byte, format string) (*Document, error) {
+	if format == "" {
+		format = FormatYAML
+		if bytes.HasPrefix(bytes.TrimSpace(data), []byte("<")) {
+			format = FormatGraphML
+		}
+	}
+	var doc *Document
+	var err error
+	switch format {
+	case FormatYAML, FormatJSON:
+		doc = &Document{}
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		err = dec.Decode(doc)
+	case FormatGraphML:
+		doc, err = parseGraphML(data)
+	default:
+		return nil, fmt.Errorf("unknown graph format %q (want %s, %s or %s)", format, FormatYAML, FormatJSON, FormatGraphML)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse graph document: %w", err)
+	}
+	if err := doc.Validate(); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// Marshal writes d as FormatYAML, FormatJSON or FormatGraphML.
+func (d *Document) Marshal(format string) ([]byte, error) {
+	switch format {
+	case FormatYAML, "":
+		var buf bytes.Buffer
+		enc := yaml.NewEncoder(&buf)
+		enc.SetIndent(2)
+		if err := enc.Encode(d); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case FormatJSON:
+		return json.MarshalIndent(d, "", "  ")
+	case FormatGraphML:
+		return d.graphML()
+	}
+	return nil, fmt.Errorf("unknown graph format %q (want %s, %s or %s)", format, FormatYAML, FormatJSON, FormatGraphML)
+}
+
+type graphML struct {
+	XMLName xml.Name     `xml:"graphml"`
+	XMLNS   string       `xml:"xmlns,attr,omitempty"`
+	Keys    []graphMLKey `xml:"key"`
+	Graph   graphMLGraph `xml:"graph"`
+}
+
+type graphMLKey struct {
+	ID   string `xml:"id,attr"`
+	For  string `xml:"for,attr"`
+	Name string `xml:"attr.name,attr"`
+	Type string `xml:"attr.type,attr"`
+}
+
+type graphMLGraph struct {
+	ID          string        `xml:"id,attr,omitempty"`
+	EdgeDefault string        `xml:"edgedefault,attr"`
+	Data        []graphMLData `xml:"data"`
+	Nodes       []graphMLNode `xml:"node"`
+	Edges       []graphMLEdge `xml:"edge"`
+}
+
+type graphMLNode struct {
+	ID   string        `xml:"id,attr"`
+	Data []graphMLData `xml:"data"`
+}
+
+type graphMLEdge struct {
+	Source string        `xml:"source,attr"`
+	Target string        `xml:"target,attr"`
+	Data   []graphMLData `xml:"data"`
+}
+
+type graphMLData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+// graphML attribute names (attr.name) the exchange format uses.
+const (
+	gmlEntry    = "entry"
+	gmlName     = "name"
+	gmlLabel    = "label"
+	gmlSelector = "labelSelector" // "key=value,key=value"
+	gmlInferred = "inferred"
+	gmlVersion  = "version"
+	gmlOwner    = "owner"
+	gmlMetadata = "metadata" // "key=value,key=value"
+	gmlPorts    = "ports"    // "name=port:targetPort/PROTOCOL/appProtocol,..."
+)
+
+func (d *Document) graphML() ([]byte, error) {
+	doc := graphML{
+		XMLNS: "http://graphml.graphdrawing.org/xmlns",
+		Keys: []graphMLKey{
+			{ID: gmlEntry, For: "graph", Name: gmlEntry, Type: "string"},
+			{ID: gmlSelector, For: "node", Name: gmlSelector, Type: "string"},
+			{ID: gmlVersion, For: "node", Name: gmlVersion, Type: "string"},
+			{ID: gmlOwner, For: "node", Name: gmlOwner, Type: "string"},
+			{ID: gmlMetadata, For: "node", Name: gmlMetadata, Type: "string"},
+			{ID: gmlPorts, For: "node", Name: gmlPorts, Type: "string"},
+			{ID: gmlInferred, For: "edge", Name: gmlInferred, Type: "boolean"},
+		},
+		Graph: graphMLGraph{
+			ID:          "services",
+			EdgeDefault: "directed",
+			Data:        []graphMLData{{Key: gmlEntry, Value: d.Entry}},
+		},
+	}
+	for _, s := range d.Services {
+		n := graphMLNode{ID: s.Name}
+		if len(s.LabelSelector) > 0 {
+			n.Data = append(n.Data, graphMLData{Key: gmlSelector, Value: formatSelector(s.LabelSelector)})
+		}
+		if s.Version != "" {
+			n.Data = append(n.Data, graphMLData{Key: gmlVersion, Value: s.Version})
+		}
+		if s.Owner != "" {
+			n.Data = append(n.Data, graphMLData{Key: gmlOwner, Value: s.Owner})
+		}
+		if len(s.Metadata) > 0 {
+			n.Data = append(n.Data, graphMLData{Key: gmlMetadata, Value: formatSelector(s.Metadata)})
+		}
+		if len(s.Ports) > 0 {
+			n.Data = append(n.Data, graphMLData{Key: gmlPorts, Value: formatPorts(s.Ports)})
+		}
+		doc.Graph.Nodes = append(doc.Graph.Nodes, n)
+		for _, dep := range s.DependsOn {
+			e := graphMLEdge{Source: s.Name, Target: dep}
+			if contains(s.Inferred, dep) {
+				e.Data = append(e.Data, graphMLData{Key: gmlInferred, Value: "true"})
+			}
+			doc.Graph.Edges = append(doc.Graph.Edges, e)
+		}
+	}
+	out, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), append(out, '\n')...), nil
+}
+
+func parseGraphML(data []byte) (*Document, error) {
+	var in graphML
+	if err := xml.Unmarshal(data, &in); err != nil {
+		return nil, err
+	}
+	// Other tools pick their own key ids; match keys by attribute name.
+	attr := make(map[string]string, len(in.Keys))
+	for _, k := range in.Keys {
+		attr[k.ID] = k.Name
+	}
+	value := func(data []graphMLData, name string) string {
+		for _, d := range data {
+			if attr[d.Key] == name || (attr[d.Key] == "" && d.Key == name) {
+				return strings.TrimSpace(d.Value)
+			}
+		}
+		return ""
+	}
+
+	doc := &Document{APIVersion: DocumentAPIVersion, Kind: DocumentKind, Entry: value(in.Graph.Data, gmlEntry)}
+	names := make(map[string]string, len(in.Graph.Nodes)) // node id -> service
+	index := make(map[string]int, len(in.Graph.Nodes))
+	for _, n := range in.Graph.Nodes {
+		name := value(n.Data, gmlName)
+		if name == "" {
+			name = value(n.Data, gmlLabel)
+		}
+		if name == "" {
+			name = n.ID
+		}
+		sel, err := parseSelector(value(n.Data, gmlSelector))
+		if err != nil {
+			return nil, fmt.Errorf("node %s: %w", n.ID, err)
+		}
+		meta, err := parseSelector(value(n.Data, gmlMetadata))
+		if err != nil {
+			return nil, fmt.Errorf("node %s metadata: %w", n.ID, err)
+		}
+		ports, err := parsePorts(value(n.Data, gmlPorts))
+		if err != nil {
+			return nil, fmt.Errorf("node %s: %w", n.ID, err)
+		}
+		names[n.ID] = name
+		index[name] = len(doc.Services)
+		doc.Services = append(doc.Services, DocumentService{
+			Name:          name,
+			LabelSelector: sel,
+			Version:       value(n.Data, gmlVersion),
+			Owner:         value(n.Data, gmlOwner),
+			Metadata:      meta,
+			Ports:         ports,
+		})
+	}
+	called := make(map[string]bool)
+	for _, e := range in.Graph.Edges {
+		src, ok1 := names[e.Source]
+		dst, ok2 := names[e.Target]
+		if !ok1 || !ok2 {
+			return nil, fmt.Errorf("edge %s -> %s: unknown node", e.Source, e.Target)
+		}
+		s := &doc.Services[index[src]]
+		s.DependsOn = append(s.DependsOn, dst)
+		if value(e.Data, gmlInferred) == "true" {
+			s.Inferred = append(s.Inferred, dst)
+		}
+		called[dst] = true
+	}
+	if doc.Entry == "" {
+		var roots []string
+		for _, s := range doc.Services {
+			if !called[s.Name] {
+				roots = append(roots, s.Name)
+			}
+		}
+		if len(roots) != 1 {
+			return nil, fmt.Errorf("no entry attribute and %d services without callers %v; set the %q graph attribute", len(roots), roots, gmlEntry)
+		}
+		doc.Entry = roots[0]
+	}
+	return doc, nil
+}
+
+func formatSelector(sel map[string]string) string {
+	parts := make([]string, 0, len(sel))
+	for k, v := range sel {
+		parts = append(parts, k+"="+v)
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ",")
+}
+
+func parseSelector(s string) (map[string]string, error) {
+	if s == "" {
+		return nil, nil
+	}
+	out := make(map[string]string)
+	for _, part := range strings.Split(s, ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok || k == "" {
+			return nil, fmt.Errorf("invalid label selector %q: want key=value[,key=value]", s)
+		}
+		out[k] = v
+	}
+	return out, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
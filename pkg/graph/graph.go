@@ -8,6 +8,25 @@ type Node struct {
 	ID            NodeID
 	DependsOn     []NodeID
 	LabelSelector map[string]string
+
+	// Inferred marks dependencies that were not declared in the config but
+	// guessed from indirect evidence (see AddInferredEdge). They are
+	// low-confidence.
+	Inferred map[NodeID]bool
+
+	// Version, Owner (team) and Metadata describe the service for
+	// attribution in the API and decision records; scoring ignores them.
+	Version  string
+	Owner    string
+	Metadata map[string]string
+
+	// Ports are what the service listens on, declared or discovered from
+	// its Kubernetes Service. Their app protocol picks the metric family
+	// measuring the service's edges.
+	Ports []Port
+
+	// External marks a service running outside the cluster, without pods.
+	External bool
 }
 
 type Graph struct {
@@ -81,3 +100,80 @@ func (g *Graph) FindAllPaths() []Path {
 	log.Printf("[lead-net][graph] FindAllPaths complete; totalPaths=%d", len(result))
 	return result
 }
+
+// Neighbors returns the direct dependencies (children) and dependents
+// (parents) of a node, i.e. every service it talks to in either direction.
+func (g *Graph) Neighbors(id NodeID) []NodeID {
+	var out []NodeID
+	if n, ok := g.Nodes[id]; ok {
+		out = append(out, n.DependsOn...)
+	}
+	for pid, n := range g.Nodes {
+		for _, dep := range n.DependsOn {
+			if dep == id {
+				out = append(out, pid)
+				break
+			}
+		}
+	}
+	return out
+}
+
+// AddInferredEdge adds from -> to as a low-confidence dependency. It is a
+// no-op (returning false) when either service is not in the graph, the two
+// are already connected directly in either direction, or the edge would
+// close a cycle.
+func (g *Graph) AddInferredEdge(from, to NodeID) bool {
+	src, ok := g.Nodes[from]
+	if !ok || g.Nodes[to] == nil || from == to {
+		return false
+	}
+	for _, dep := range src.DependsOn {
+		if dep == to {
+			return false
+		}
+	}
+	for _, dep := range g.Nodes[to].DependsOn {
+		if dep == from {
+			return false
+		}
+	}
+	if g.reaches(to, from, map[NodeID]bool{}) {
+		log.Printf("[lead-net][graph] not adding inferred edge %s -> %s: would create a cycle", from, to)
+		return false
+	}
+
+	src.DependsOn = append(src.DependsOn, to)
+	if src.Inferred == nil {
+		src.Inferred = map[NodeID]bool{}
+	}
+	src.Inferred[to] = true
+	log.Printf("[lead-net][graph] added inferred edge %s -> %s", from, to)
+	return true
+}
+
+// IsInferred reports whether from -> to was added by AddInferredEdge.
+func (g *Graph) IsInferred(from, to NodeID) bool {
+	n, ok := g.Nodes[from]
+	return ok && n.Inferred[to]
+}
+
+func (g *Graph) reaches(from, to NodeID, seen map[NodeID]bool) bool {
+	if from == to {
+		return true
+	}
+	if seen[from] {
+		return false
+	}
+	seen[from] = true
+	n, ok := g.Nodes[from]
+	if !ok {
+		return false
+	}
+	for _, dep := range n.DependsOn {
+		if g.reaches(dep, to, seen) {
+			return true
+		}
+	}
+	return false
+}
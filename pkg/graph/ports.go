@@ -0,0 +1,165 @@
+package graph
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Transport protocols of a Port, as in a Kubernetes ServicePort.
+const (
+	ProtocolTCP  = "TCP"
+	ProtocolUDP  = "UDP"
+	ProtocolSCTP = "SCTP"
+)
+
+// Application protocols Port.AppProtocol is normalised to; others are kept
+// as given.
+const (
+	AppProtocolHTTP  = "http"
+	AppProtocolHTTP2 = "http2"
+	AppProtocolGRPC  = "grpc"
+	AppProtocolTCP   = "tcp"
+)
+
+// Port is one port a service listens on.
+type Port struct {
+	Name        string `json:"name,omitempty" yaml:"name,omitempty"`
+	Port        int32  `json:"port" yaml:"port"`
+	TargetPort  int32  `json:"targetPort,omitempty" yaml:"targetPort,omitempty"`   // defaults to Port
+	Protocol    string `json:"protocol,omitempty" yaml:"protocol,omitempty"`       // TCP (default), UDP or SCTP
+	AppProtocol string `json:"appProtocol,omitempty" yaml:"appProtocol,omitempty"` // http, http2, grpc, tcp, ...
+}
+
+// Target returns the container port traffic to p is sent to.
+func (p Port) Target() int32 {
+	if p.TargetPort != 0 {
+		return p.TargetPort
+	}
+	return p.Port
+}
+
+// Transport returns p.Protocol, TCP if unset.
+func (p Port) Transport() string {
+	if p.Protocol == "" {
+		return ProtocolTCP
+	}
+	return p.Protocol
+}
+
+// Validate checks the port numbers and transport protocol.
+func (p Port) Validate() error {
+	if p.Port < 1 || p.Port > 65535 {
+		return fmt.Errorf("port %d out of range 1-65535", p.Port)
+	}
+	if p.TargetPort < 0 || p.TargetPort > 65535 {
+		return fmt.Errorf("targetPort %d out of range 1-65535", p.TargetPort)
+	}
+	switch p.Transport() {
+	case ProtocolTCP, ProtocolUDP, ProtocolSCTP:
+	default:
+		return fmt.Errorf("port %d: protocol must be %s, %s or %s, got %q", p.Port, ProtocolTCP, ProtocolUDP, ProtocolSCTP, p.Protocol)
+	}
+	return nil
+}
+
+// AppProtocolOf guesses the application protocol of a port: its explicit
+// appProtocol, else the Istio naming convention ("grpc-api", "http") for
+// its name. Values such as "kubernetes.io/h2c" are mapped to http2. It
+// returns "" if nothing is known.
+func AppProtocolOf(appProtocol, name string) string {
+	if p := normaliseAppProtocol(appProtocol); p != "" {
+		return p
+	}
+	prefix, _, _ := strings.Cut(name, "-")
+	switch p := normaliseAppProtocol(prefix); p {
+	case AppProtocolHTTP, AppProtocolHTTP2, AppProtocolGRPC, AppProtocolTCP, "https", "mongo", "mysql", "redis", "tls", "udp":
+		return p
+	}
+	return ""
+}
+
+func normaliseAppProtocol(s string) string {
+	s = strings.ToLower(strings.TrimSpace(s))
+	switch s {
+	case "kubernetes.io/h2c", "h2c", "h2":
+		return AppProtocolHTTP2
+	case "kubernetes.io/ws", "kubernetes.io/wss", "ws", "wss":
+		return AppProtocolHTTP
+	}
+	return s
+}
+
+// AppProtocol returns the service's application protocol when all its
+// ports that declare one agree, or "" if it is unknown or mixed.
+func (n *Node) AppProtocol() string {
+	proto := ""
+	for _, p := range n.Ports {
+		if p.AppProtocol == "" {
+			continue
+		}
+		if proto != "" && proto != p.AppProtocol {
+			return ""
+		}
+		proto = p.AppProtocol
+	}
+	return proto
+}
+
+// formatPorts writes ports as "name=port:targetPort/PROTOCOL/appProtocol"
+// entries separated by commas; unset parts are left out ("9090//grpc" has
+// no protocol).
+func formatPorts(ports []Port) string {
+	parts := make([]string, 0, len(ports))
+	for _, p := range ports {
+		s := strconv.Itoa(int(p.Port))
+		if p.Name != "" {
+			s = p.Name + "=" + s
+		}
+		if p.TargetPort != 0 {
+			s += ":" + strconv.Itoa(int(p.TargetPort))
+		}
+		if p.Protocol != "" || p.AppProtocol != "" {
+			s += "/" + p.Protocol
+		}
+		if p.AppProtocol != "" {
+			s += "/" + p.AppProtocol
+		}
+		parts = append(parts, s)
+	}
+	return strings.Join(parts, ",")
+}
+
+func parsePorts(s string) ([]Port, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var out []Port
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		var p Port
+		if name, rest, ok := strings.Cut(part, "="); ok {
+			p.Name, part = name, rest
+		}
+		nums, protos, _ := strings.Cut(part, "/")
+		p.Protocol, p.AppProtocol, _ = strings.Cut(protos, "/")
+		port, target, hasTarget := strings.Cut(nums, ":")
+		n, err := strconv.ParseInt(port, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ports %q: want [name=]port[:targetPort][/protocol[/appProtocol]][,...]", s)
+		}
+		p.Port = int32(n)
+		if hasTarget {
+			t, err := strconv.ParseInt(target, 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("invalid ports %q: bad targetPort %q", s, target)
+			}
+			p.TargetPort = int32(t)
+		}
+		if err := p.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid ports %q: %w", s, err)
+		}
+		out = append(out, p)
+	}
+	return out, nil
+}
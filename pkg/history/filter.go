@@ -0,0 +1,108 @@
+package history
+
+import (
+	"math"
+	"sort"
+	"sync"
+)
+
+// madScale makes the median absolute deviation comparable to a standard
+// deviation for normally distributed samples.
+const madScale = 1.4826
+
+// Filter smooths one metric series and rejects outliers.
+//
+// A sample further than OutlierMADs median absolute deviations from the
+// median of the kept window is rejected and the previous output repeated,
+// unless more than half a window of samples in a row were rejected: then the
+// level has really moved and the window restarts at the new samples.
+type Filter struct {
+	Median      bool    // median of the window instead of an EWMA
+	Alpha       float64 // EWMA weight of the newest sample
+	OutlierMADs float64 // 0 disables rejection
+
+	mu       sync.Mutex
+	window   *Ring[float64]
+	rejected []float64 // consecutive rejected samples
+	out      float64
+	primed   bool
+}
+
+// NewFilter returns a filter keeping the last size samples.
+func NewFilter(size int, median bool, alpha, outlierMADs float64) *Filter {
+	return &Filter{Median: median, Alpha: alpha, OutlierMADs: outlierMADs, window: NewRing[float64](size)}
+}
+
+// Add feeds a sample and returns the smoothed value and whether the sample
+// was rejected as an outlier.
+func (f *Filter) Add(v float64) (float64, bool) {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return v, false // left to the scoring sanitizer
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.isOutlier(v) {
+		f.rejected = append(f.rejected, v)
+		if 2*len(f.rejected) <= len(f.window.buf) {
+			return f.out, true
+		}
+		// Sustained shift: restart the window at the new level.
+		f.window = NewRing[float64](len(f.window.buf))
+		f.primed = false
+		for _, r := range f.rejected[:len(f.rejected)-1] {
+			f.push(r)
+		}
+	}
+	f.rejected = f.rejected[:0]
+	f.push(v)
+	return f.out, false
+}
+
+func (f *Filter) push(v float64) {
+	f.window.Push(v)
+	switch {
+	case f.Median:
+		f.out = median(f.window.Snapshot())
+	case !f.primed:
+		f.out = v
+	default:
+		f.out = f.Alpha*v + (1-f.Alpha)*f.out
+	}
+	f.primed = true
+}
+
+// isOutlier needs at least three kept samples to judge. A window of equal
+// samples has no spread; 1% of the median stands in for the MAD then.
+func (f *Filter) isOutlier(v float64) bool {
+	if f.OutlierMADs <= 0 || f.window.Len() < 3 {
+		return false
+	}
+	w := f.window.Snapshot()
+	med := median(w)
+	dev := make([]float64, len(w))
+	for i, x := range w {
+		dev[i] = math.Abs(x - med)
+	}
+	mad := median(dev)
+	if floor := 0.01 * math.Abs(med); mad < floor {
+		mad = floor
+	}
+	if mad == 0 {
+		return false
+	}
+	return math.Abs(v-med) > f.OutlierMADs*madScale*mad
+}
+
+func median(xs []float64) float64 {
+	s := append([]float64(nil), xs...)
+	sort.Float64s(s)
+	n := len(s)
+	if n == 0 {
+		return 0
+	}
+	if n%2 == 1 {
+		return s[n/2]
+	}
+	return (s[n/2-1] + s[n/2]) / 2
+}
@@ -0,0 +1,51 @@
+// Package history provides fixed-size, concurrency-safe sample buffers for
+// time series the controller keeps in memory.
+package history
+
+import "sync"
+
+// Ring keeps the last N values pushed; older values are overwritten.
+type Ring[T any] struct {
+	mu    sync.RWMutex
+	buf   []T
+	next  int
+	count int
+}
+
+// NewRing returns a ring holding at most size values (minimum 1).
+func NewRing[T any](size int) *Ring[T] {
+	if size < 1 {
+		size = 1
+	}
+	return &Ring[T]{buf: make([]T, size)}
+}
+
+// Push appends v, evicting the oldest value when full.
+func (r *Ring[T]) Push(v T) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.buf[r.next] = v
+	r.next = (r.next + 1) % len(r.buf)
+	if r.count < len(r.buf) {
+		r.count++
+	}
+}
+
+// Snapshot returns a copy of the stored values, oldest first.
+func (r *Ring[T]) Snapshot() []T {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make([]T, 0, r.count)
+	start := (r.next - r.count + len(r.buf)) % len(r.buf)
+	for i := 0; i < r.count; i++ {
+		out = append(out, r.buf[(start+i)%len(r.buf)])
+	}
+	return out
+}
+
+// Len returns the number of stored values.
+func (r *Ring[T]) Len() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.count
+}
@@ -0,0 +1,98 @@
+// Package hooks holds decision hooks (controller.DecisionHook) that can be
+// compiled into the controller. Each is registered by a file in
+// cmd/lead-net-affinity built only with the hook's build tag, e.g.
+//
+//	go build -tags hook_compliancezones ./cmd/lead-net-affinity
+package hooks
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+
+	"lead-net-affinity/pkg/controller"
+	"lead-net-affinity/pkg/graph"
+)
+
+// DefaultZoneLabel is the node label compliance zones are matched on.
+const DefaultZoneLabel = corev1.LabelTopologyZone
+
+// ComplianceZones pins services to the zones they may run in (e.g. for data
+// residency): their deployments get a required node affinity on the zone
+// label, replacing any earlier requirement on that label.
+type ComplianceZones struct {
+	controller.NopHook
+
+	label    string
+	zones    []string
+	services map[graph.NodeID]bool // nil for every service
+}
+
+// NewComplianceZones builds the hook from its options: zones (required,
+// comma-separated), services (comma-separated, default all) and label
+// (default DefaultZoneLabel).
+func NewComplianceZones(options map[string]string) (controller.DecisionHook, error) {
+	h := &ComplianceZones{label: options["label"], zones: splitList(options["zones"])}
+	if h.label == "" {
+		h.label = DefaultZoneLabel
+	}
+	if len(h.zones) == 0 {
+		return nil, fmt.Errorf("option zones is required")
+	}
+	if svcs := splitList(options["services"]); len(svcs) > 0 {
+		h.services = make(map[graph.NodeID]bool, len(svcs))
+		for _, s := range svcs {
+			h.services[graph.NodeID(s)] = true
+		}
+	}
+	return h, nil
+}
+
+func (h *ComplianceZones) Name() string { return "compliance-zones" }
+
+func (h *ComplianceZones) OnAffinityComputed(_ context.Context, svc graph.NodeID, d *appsv1.Deployment) error {
+	if h.services != nil && !h.services[svc] {
+		return nil
+	}
+	spec := &d.Spec.Template.Spec
+	if spec.Affinity == nil {
+		spec.Affinity = &corev1.Affinity{}
+	}
+	if spec.Affinity.NodeAffinity == nil {
+		spec.Affinity.NodeAffinity = &corev1.NodeAffinity{}
+	}
+	na := spec.Affinity.NodeAffinity
+	if na.RequiredDuringSchedulingIgnoredDuringExecution == nil {
+		na.RequiredDuringSchedulingIgnoredDuringExecution = &corev1.NodeSelector{}
+	}
+	rs := na.RequiredDuringSchedulingIgnoredDuringExecution
+	if len(rs.NodeSelectorTerms) == 0 {
+		rs.NodeSelectorTerms = []corev1.NodeSelectorTerm{{}}
+	}
+	// Terms are ORed, so the zone requirement is ANDed into each.
+	req := corev1.NodeSelectorRequirement{Key: h.label, Operator: corev1.NodeSelectorOpIn, Values: h.zones}
+	for i := range rs.NodeSelectorTerms {
+		t := &rs.NodeSelectorTerms[i]
+		t.MatchExpressions = slices.DeleteFunc(t.MatchExpressions, func(e corev1.NodeSelectorRequirement) bool {
+			return e.Key == h.label
+		})
+		t.MatchExpressions = append(t.MatchExpressions, req)
+	}
+	log.Printf("[lead-net][hooks] %s/%s: restricted to zones %v", d.Namespace, d.Name, h.zones)
+	return nil
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, f := range strings.Split(s, ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			out = append(out, f)
+		}
+	}
+	return out
+}
@@ -0,0 +1,208 @@
+package kube
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/util/retry"
+
+	"lead-net-affinity/pkg/metrics"
+)
+
+// RolloutGVR is the Argo Rollouts Rollout resource.
+var RolloutGVR = schema.GroupVersionResource{
+	Group:    "argoproj.io",
+	Version:  "v1alpha1",
+	Resource: "rollouts",
+}
+
+// RolloutKind is the Kind of an Argo Rollout.
+const RolloutKind = "Rollout"
+
+// RolloutPhaseAnnotation carries an Argo Rollout's status.phase on the
+// Deployment standing in for it (see ListRollouts). It is never written
+// back to the cluster.
+const RolloutPhaseAnnotation = "lead.io/rollout-phase"
+
+// Argo Rollout phases.
+const (
+	RolloutPhaseHealthy     = "Healthy"
+	RolloutPhaseProgressing = "Progressing"
+	RolloutPhasePaused      = "Paused"
+	RolloutPhaseDegraded    = "Degraded"
+)
+
+// IsRollout reports whether d stands for an Argo Rollout rather than a
+// Deployment.
+func IsRollout(d *appsv1.Deployment) bool {
+	return d.Kind == RolloutKind && d.APIVersion == RolloutGVR.GroupVersion().String()
+}
+
+// RolloutPhase returns the Argo Rollout phase of d, "" for a Deployment.
+func RolloutPhase(d *appsv1.Deployment) string {
+	if !IsRollout(d) {
+		return ""
+	}
+	return d.Annotations[RolloutPhaseAnnotation]
+}
+
+// argoRollout is the part of an Argo Rollout LEAD reads. A Rollout with a
+// workloadRef takes its pod template from a Deployment and has none.
+type argoRollout struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata"`
+	Spec              struct {
+		Replicas    *int32                 `json:"replicas,omitempty"`
+		Selector    *metav1.LabelSelector  `json:"selector,omitempty"`
+		Template    corev1.PodTemplateSpec `json:"template"`
+		WorkloadRef *struct {
+			Name string `json:"name"`
+		} `json:"workloadRef,omitempty"`
+	} `json:"spec"`
+	Status struct {
+		Replicas           int32  `json:"replicas"`
+		UpdatedReplicas    int32  `json:"updatedReplicas"`
+		ReadyReplicas      int32  `json:"readyReplicas"`
+		AvailableReplicas  int32  `json:"availableReplicas"`
+		ObservedGeneration string `json:"observedGeneration"` // a string in Argo
+		Phase              string `json:"phase"`
+		Message            string `json:"message"`
+	} `json:"status"`
+}
+
+// ListRollouts lists the Argo Rollouts in namespaces as Deployments with
+// their metadata, replicas, selector, pod template and status, so the
+// controller scores and patches them like any Deployment (see IsRollout).
+// Rollouts referencing a Deployment's template (workloadRef) are skipped;
+// that Deployment is listed instead.
+func (c *Client) ListRollouts(ctx context.Context, namespaces []string) ([]appsv1.Deployment, error) {
+	if c.dyn == nil {
+		return nil, fmt.Errorf("dynamic client not configured")
+	}
+	var out []appsv1.Deployment
+	for _, ns := range namespaces {
+		var list *unstructured.UnstructuredList
+		err := c.withRetry(ctx, "list_rollouts", func() (err error) {
+			list, err = c.dyn.Resource(RolloutGVR).Namespace(ns).List(ctx, metav1.ListOptions{})
+			return err
+		})
+		if err != nil {
+			log.Printf("[lead-net][kube] ListRollouts failed for namespace=%s: %v", ns, err)
+			return nil, err
+		}
+		for i := range list.Items {
+			d, err := rolloutAsDeployment(&list.Items[i])
+			if err != nil {
+				log.Printf("[lead-net][kube] skipping rollout %s/%s: %v", list.Items[i].GetNamespace(), list.Items[i].GetName(), err)
+				continue
+			}
+			if d != nil {
+				out = append(out, *d)
+			}
+		}
+	}
+	log.Printf("[lead-net][kube] ListRollouts total rollouts=%d across namespaces=%v", len(out), namespaces)
+	return out, nil
+}
+
+// GetRollout reads one Argo Rollout as a Deployment, see ListRollouts.
+func (c *Client) GetRollout(ctx context.Context, namespace, name string) (*appsv1.Deployment, error) {
+	if c.dyn == nil {
+		return nil, fmt.Errorf("dynamic client not configured")
+	}
+	var obj *unstructured.Unstructured
+	err := c.withRetry(ctx, "get_rollout", func() (err error) {
+		obj, err = c.dyn.Resource(RolloutGVR).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	d, err := rolloutAsDeployment(obj)
+	if err == nil && d == nil {
+		err = fmt.Errorf("rollout %s/%s uses a workloadRef", namespace, name)
+	}
+	return d, err
+}
+
+// UpdateRollout writes the fields the controller owns on d (affinity,
+// ownership and decision annotations, Guaranteed CPU resources; see
+// carryOwned) to its Argo Rollout. The Rollout is re-read, those fields are
+// set on it and it is updated, again on a conflict, so concurrent changes by
+// Argo or others are kept.
+func (c *Client) UpdateRollout(ctx context.Context, d *appsv1.Deployment) error {
+	if c.dyn == nil {
+		return fmt.Errorf("dynamic client not configured")
+	}
+	log.Printf("[lead-net][kube] UpdateRollout %s/%s starting", d.Namespace, d.Name)
+	rollouts := c.dyn.Resource(RolloutGVR).Namespace(d.Namespace)
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		var obj *unstructured.Unstructured
+		err := c.withRetry(ctx, "get_rollout", func() (err error) {
+			obj, err = rollouts.Get(ctx, d.Name, metav1.GetOptions{})
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		if err := carryOwnedUnstructured(obj, d); err != nil {
+			return err
+		}
+		err = c.withRetry(ctx, "update_rollout", func() error {
+			_, err := rollouts.Update(ctx, obj, metav1.UpdateOptions{})
+			return err
+		})
+		if apierrors.IsConflict(err) {
+			metrics.Default.Add("lead_net_kube_conflicts_total", "Deployment updates that hit a 409 conflict.", nil, 1)
+			log.Printf("[lead-net][kube] UpdateRollout %s/%s conflict; re-reading latest version", d.Namespace, d.Name)
+		}
+		return err
+	})
+	if err != nil {
+		log.Printf("[lead-net][kube] UpdateRollout %s/%s failed: %v", d.Namespace, d.Name, err)
+		return err
+	}
+	log.Printf("[lead-net][kube] UpdateRollout %s/%s succeeded", d.Namespace, d.Name)
+	return nil
+}
+
+// rolloutAsDeployment converts a Rollout; nil if it has a workloadRef.
+func rolloutAsDeployment(obj *unstructured.Unstructured) (*appsv1.Deployment, error) {
+	var r argoRollout
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, &r); err != nil {
+		return nil, err
+	}
+	if r.Spec.WorkloadRef != nil {
+		return nil, nil
+	}
+	d := &appsv1.Deployment{
+		TypeMeta:   metav1.TypeMeta{APIVersion: RolloutGVR.GroupVersion().String(), Kind: RolloutKind},
+		ObjectMeta: r.ObjectMeta,
+	}
+	d.Spec.Replicas = r.Spec.Replicas
+	d.Spec.Selector = r.Spec.Selector
+	d.Spec.Template = r.Spec.Template
+	d.Status = appsv1.DeploymentStatus{
+		Replicas:          r.Status.Replicas,
+		UpdatedReplicas:   r.Status.UpdatedReplicas,
+		ReadyReplicas:     r.Status.ReadyReplicas,
+		AvailableReplicas: r.Status.AvailableReplicas,
+	}
+	if g, err := strconv.ParseInt(r.Status.ObservedGeneration, 10, 64); err == nil {
+		d.Status.ObservedGeneration = g
+	}
+	if d.Annotations == nil {
+		d.Annotations = make(map[string]string)
+	}
+	d.Annotations[RolloutPhaseAnnotation] = r.Status.Phase
+	return d, nil
+}
@@ -0,0 +1,75 @@
+package kube
+
+import (
+	"context"
+	"log"
+	"strings"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"lead-net-affinity/pkg/rbac"
+)
+
+// DetectCapabilities asks the API server (SelfSubjectAccessReview) which of
+// the permissions in rbac.Permissions the controller actually holds. A feature
+// is allowed only if every verb on every resource it needs is allowed in
+// every namespace. If a review itself fails the permission is assumed granted,
+// so a flaky API server never silently disables features.
+func (c *Client) DetectCapabilities(ctx context.Context, namespaces []string) rbac.Capabilities {
+	caps := make(rbac.Capabilities, len(rbac.AllFeatures))
+	for _, f := range rbac.AllFeatures {
+		caps[f] = true
+	}
+
+	if c.noNodes {
+		caps[rbac.FeatureNodes] = false
+		caps[rbac.FeatureTaintNodes] = false
+	}
+
+	for _, p := range rbac.Permissions {
+		if !caps[p.Feature] {
+			continue
+		}
+		scopes := namespaces
+		if p.ClusterScoped || len(scopes) == 0 {
+			scopes = []string{""}
+		}
+		for _, ns := range scopes {
+			for _, verb := range p.Verbs {
+				if !c.canI(ctx, p, ns, verb) {
+					log.Printf("[lead-net][kube] missing permission %s %s (namespace=%q); disabling feature %q",
+						verb, p.Resource, ns, p.Feature)
+					caps[p.Feature] = false
+				}
+			}
+		}
+	}
+	return caps
+}
+
+func (c *Client) canI(ctx context.Context, p rbac.Permission, namespace, verb string) bool {
+	resource, subresource, _ := strings.Cut(p.Resource, "/")
+	review := &authorizationv1.SelfSubjectAccessReview{
+		Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+			ResourceAttributes: &authorizationv1.ResourceAttributes{
+				Namespace:   namespace,
+				Verb:        verb,
+				Group:       p.APIGroup,
+				Resource:    resource,
+				Subresource: subresource,
+			},
+		},
+	}
+
+	var res *authorizationv1.SelfSubjectAccessReview
+	err := c.withRetry(ctx, "access_review", func() (err error) {
+		res, err = c.cs.AuthorizationV1().SelfSubjectAccessReviews().Create(ctx, review, metav1.CreateOptions{})
+		return err
+	})
+	if err != nil {
+		log.Printf("[lead-net][kube] access review %s %s failed, assuming allowed: %v", verb, p.Resource, err)
+		return true
+	}
+	return res.Status.Allowed
+}
@@ -2,33 +2,125 @@ package kube
 
 import (
 	"context"
+	"errors"
 	"log"
 
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/util/retry"
+
+	"lead-net-affinity/pkg/metrics"
 )
 
 type Client struct {
-	cs *kubernetes.Clientset
+	cs   kubernetes.Interface
+	dyn  dynamic.Interface
+	pods *podCache // optional informer cache, see EnableInformerCache
+
+	backoff *wait.Backoff // retry budget override, see SetRetryBackoff
+
+	noNodes bool // namespace-scoped mode, see DisableNodeAccess
+}
+
+// ErrNodeAccessDisabled is returned by node lookups in namespace-scoped mode.
+var ErrNodeAccessDisabled = errors.New("node access disabled (namespace-scoped mode)")
+
+// DisableNodeAccess puts the client in namespace-scoped mode: node lookups
+// fail fast with ErrNodeAccessDisabled, WatchChanges skips the Node informer
+// and DetectCapabilities reports the nodes feature as unavailable. Use it
+// when the service account only has namespace-level RBAC.
+func (c *Client) DisableNodeAccess() {
+	c.noNodes = true
+}
+
+// Options tunes the rest.Config used for every client built by New or
+// NewInCluster. Zero values keep the client-go defaults.
+type Options struct {
+	QPS   float32 // sustained client-side request rate
+	Burst int     // requests allowed above QPS in a short burst
+
+	Kubeconfig string // kubeconfig path; "" = $KUBECONFIG or ~/.kube/config
+	Context    string // kubeconfig context; "" = current context
 }
 
-func NewInCluster() (*Client, error) {
+// Apply copies the rate limit settings onto cfg.
+func (o Options) Apply(cfg *rest.Config) {
+	if o.QPS > 0 {
+		cfg.QPS = o.QPS
+	}
+	if o.Burst > 0 {
+		cfg.Burst = o.Burst
+	}
+}
+
+// New builds a client from opts: the in-cluster config when no kubeconfig or
+// context is given and we run inside a pod, the kubeconfig otherwise.
+func New(opts Options) (*Client, error) {
+	if opts.Kubeconfig == "" && opts.Context == "" {
+		c, err := NewInCluster(opts)
+		if !errors.Is(err, rest.ErrNotInCluster) {
+			return c, err
+		}
+		log.Printf("[lead-net][kube] not running in a cluster; falling back to kubeconfig")
+	}
+
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	if opts.Kubeconfig != "" {
+		rules.ExplicitPath = opts.Kubeconfig
+	}
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: opts.Context}
+	cfg, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides).ClientConfig()
+	if err != nil {
+		log.Printf("[lead-net][kube] kubeconfig %q context %q failed: %v", opts.Kubeconfig, opts.Context, err)
+		return nil, err
+	}
+	log.Printf("[lead-net][kube] creating Kubernetes client for context %q (host %s)", opts.Context, cfg.Host)
+	return newForConfig(cfg, opts)
+}
+
+func NewInCluster(opts Options) (*Client, error) {
 	log.Printf("[lead-net][kube] creating in-cluster Kubernetes client")
 	cfg, err := rest.InClusterConfig()
 	if err != nil {
 		log.Printf("[lead-net][kube] InClusterConfig failed: %v", err)
 		return nil, err
 	}
+	return newForConfig(cfg, opts)
+}
+
+func newForConfig(cfg *rest.Config, opts Options) (*Client, error) {
+	opts.Apply(cfg)
+	log.Printf("[lead-net][kube] client rate limit qps=%.1f burst=%d", cfg.QPS, cfg.Burst)
 	cs, err := kubernetes.NewForConfig(cfg)
 	if err != nil {
 		log.Printf("[lead-net][kube] NewForConfig failed: %v", err)
 		return nil, err
 	}
-	log.Printf("[lead-net][kube] in-cluster client successfully created")
-	return &Client{cs: cs}, nil
+	dyn, err := dynamic.NewForConfig(cfg)
+	if err != nil {
+		log.Printf("[lead-net][kube] dynamic NewForConfig failed: %v", err)
+		return nil, err
+	}
+	log.Printf("[lead-net][kube] client successfully created")
+	return &Client{cs: cs, dyn: dyn}, nil
+}
+
+// NewForClientset wraps an existing clientset (e.g. a fake one in tests).
+func NewForClientset(cs kubernetes.Interface) *Client {
+	return &Client{cs: cs}
+}
+
+// NewForClients wraps an existing clientset and dynamic client, for the
+// custom resources (status, Argo Rollouts) too.
+func NewForClients(cs kubernetes.Interface, dyn dynamic.Interface) *Client {
+	return &Client{cs: cs, dyn: dyn}
 }
 
 func (c *Client) ListDeployments(ctx context.Context, namespaces []string) ([]appsv1.Deployment, error) {
@@ -36,7 +128,11 @@ func (c *Client) ListDeployments(ctx context.Context, namespaces []string) ([]ap
 
 	var out []appsv1.Deployment
 	for _, ns := range namespaces {
-		list, err := c.cs.AppsV1().Deployments(ns).List(ctx, metav1.ListOptions{})
+		var list *appsv1.DeploymentList
+		err := c.withRetry(ctx, "list_deployments", func() (err error) {
+			list, err = c.cs.AppsV1().Deployments(ns).List(ctx, metav1.ListOptions{})
+			return err
+		})
 		if err != nil {
 			log.Printf("[lead-net][kube] ListDeployments failed for namespace=%s: %v", ns, err)
 			return nil, err
@@ -48,9 +144,26 @@ func (c *Client) ListDeployments(ctx context.Context, namespaces []string) ([]ap
 	return out, nil
 }
 
+// UpdateDeployment writes the pod-template affinity and ownership markers
+// computed on d back to the cluster. If the update conflicts (HPA or another
+// controller raced us), the latest object is re-read, the fields the
+// controller owns are re-applied to it and the update is retried, so we
+// never clobber fields owned by someone else.
 func (c *Client) UpdateDeployment(ctx context.Context, d *appsv1.Deployment) error {
 	log.Printf("[lead-net][kube] UpdateDeployment %s/%s starting", d.Namespace, d.Name)
-	_, err := c.cs.AppsV1().Deployments(d.Namespace).Update(ctx, d, metav1.UpdateOptions{})
+	desired := d.DeepCopy()
+
+	first := true
+	err := c.UpdateDeploymentWith(ctx, d.Namespace, d.Name, func(latest *appsv1.Deployment) {
+		carryOwned(latest, desired)
+	}, func() *appsv1.Deployment {
+		// First attempt uses the caller's object as-is; no extra GET.
+		if first {
+			first = false
+			return d.DeepCopy()
+		}
+		return nil
+	})
 	if err != nil {
 		log.Printf("[lead-net][kube] UpdateDeployment %s/%s failed: %v", d.Namespace, d.Name, err)
 		return err
@@ -59,10 +172,61 @@ func (c *Client) UpdateDeployment(ctx context.Context, d *appsv1.Deployment) err
 	return nil
 }
 
+// UpdateDeploymentWith runs the standard get-mutate-update loop: on a 409
+// conflict it re-reads the Deployment, applies mutate again and retries.
+// seed may supply the object for an attempt (return nil to GET it instead).
+func (c *Client) UpdateDeploymentWith(
+	ctx context.Context,
+	namespace, name string,
+	mutate func(*appsv1.Deployment),
+	seed func() *appsv1.Deployment,
+) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		var cur *appsv1.Deployment
+		if seed != nil {
+			cur = seed()
+		}
+		if cur == nil {
+			err := c.withRetry(ctx, "get_deployment", func() (err error) {
+				cur, err = c.cs.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+				return err
+			})
+			if err != nil {
+				return err
+			}
+		}
+		mutate(cur)
+
+		err := c.withRetry(ctx, "update_deployment", func() error {
+			_, err := c.cs.AppsV1().Deployments(namespace).Update(ctx, cur, metav1.UpdateOptions{})
+			return err
+		})
+		if apierrors.IsConflict(err) {
+			metrics.Default.Add("lead_net_kube_conflicts_total", "Deployment updates that hit a 409 conflict.", nil, 1)
+			log.Printf("[lead-net][kube] UpdateDeployment %s/%s conflict; re-reading latest version", namespace, name)
+		}
+		return err
+	})
+}
+
 func (c *Client) ListPods(ctx context.Context, namespace, selector string) ([]corev1.Pod, error) {
+	if c.pods != nil {
+		if pods, ok, err := c.pods.list(namespace, selector); ok {
+			if err != nil {
+				log.Printf("[lead-net][kube] ListPods (cache) namespace=%s selector=%q failed: %v", namespace, selector, err)
+				return nil, err
+			}
+			return pods, nil
+		}
+	}
+
 	log.Printf("[lead-net][kube] ListPods namespace=%s selector=%q", namespace, selector)
-	pods, err := c.cs.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
-		LabelSelector: selector,
+	var pods *corev1.PodList
+	err := c.withRetry(ctx, "list_pods", func() (err error) {
+		pods, err = c.cs.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
+			LabelSelector: selector,
+		})
+		return err
 	})
 	if err != nil {
 		log.Printf("[lead-net][kube] ListPods namespace=%s selector=%q failed: %v", namespace, selector, err)
@@ -72,9 +236,44 @@ func (c *Client) ListPods(ctx context.Context, namespace, selector string) ([]co
 	return pods.Items, nil
 }
 
+// ListPodsByPhase lists pods in a namespace with the given phase, using the
+// informer phase index when available and a field selector otherwise.
+func (c *Client) ListPodsByPhase(ctx context.Context, namespace string, phase corev1.PodPhase) ([]corev1.Pod, error) {
+	if c.pods != nil {
+		if pods, ok, err := c.pods.byPhase(namespace, phase); ok {
+			if err != nil {
+				log.Printf("[lead-net][kube] ListPodsByPhase (cache) namespace=%s phase=%s failed: %v", namespace, phase, err)
+				return nil, err
+			}
+			return pods, nil
+		}
+	}
+
+	log.Printf("[lead-net][kube] ListPodsByPhase namespace=%s phase=%s", namespace, phase)
+	var pods *corev1.PodList
+	err := c.withRetry(ctx, "list_pods", func() (err error) {
+		pods, err = c.cs.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
+			FieldSelector: "status.phase=" + string(phase),
+		})
+		return err
+	})
+	if err != nil {
+		log.Printf("[lead-net][kube] ListPodsByPhase namespace=%s phase=%s failed: %v", namespace, phase, err)
+		return nil, err
+	}
+	return pods.Items, nil
+}
+
 func (c *Client) GetNode(ctx context.Context, name string) (*corev1.Node, error) {
+	if c.noNodes {
+		return nil, ErrNodeAccessDisabled
+	}
 	log.Printf("[lead-net][kube] GetNode %q", name)
-	node, err := c.cs.CoreV1().Nodes().Get(ctx, name, metav1.GetOptions{})
+	var node *corev1.Node
+	err := c.withRetry(ctx, "get_node", func() (err error) {
+		node, err = c.cs.CoreV1().Nodes().Get(ctx, name, metav1.GetOptions{})
+		return err
+	})
 	if err != nil {
 		log.Printf("[lead-net][kube] GetNode %q failed: %v", name, err)
 		return nil, err
@@ -91,7 +290,9 @@ func (c *Client) DeletePod(ctx context.Context, namespace, name string) error {
 		PropagationPolicy: &deletePolicy,
 	}
 
-	err := c.cs.CoreV1().Pods(namespace).Delete(ctx, name, deleteOptions)
+	err := c.withRetry(ctx, "delete_pod", func() error {
+		return c.cs.CoreV1().Pods(namespace).Delete(ctx, name, deleteOptions)
+	})
 	if err != nil {
 		log.Printf("[lead-net][kube] failed to delete pod %s/%s: %v", namespace, name, err)
 		return err
@@ -100,3 +301,21 @@ func (c *Client) DeletePod(ctx context.Context, namespace, name string) error {
 	log.Printf("[lead-net][kube] successfully deleted pod %s/%s", namespace, name)
 	return nil
 }
+
+func (c *Client) ListNodes(ctx context.Context) ([]corev1.Node, error) {
+	if c.noNodes {
+		return nil, ErrNodeAccessDisabled
+	}
+	log.Printf("[lead-net][kube] ListNodes")
+	var nodes *corev1.NodeList
+	err := c.withRetry(ctx, "list_nodes", func() (err error) {
+		nodes, err = c.cs.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+		return err
+	})
+	if err != nil {
+		log.Printf("[lead-net][kube] ListNodes failed: %v", err)
+		return nil, err
+	}
+	log.Printf("[lead-net][kube] ListNodes returned %d nodes", len(nodes.Items))
+	return nodes.Items, nil
+}
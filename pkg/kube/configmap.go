@@ -0,0 +1,50 @@
+package kube
+
+import (
+	"context"
+	"log"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ApplyConfigMap creates namespace/name or replaces its data.
+func (c *Client) ApplyConfigMap(ctx context.Context, namespace, name string, data map[string]string) error {
+	cms := c.cs.CoreV1().ConfigMaps(namespace)
+	return c.withRetry(ctx, "apply_configmap", func() error {
+		cm, err := cms.Get(ctx, name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			log.Printf("[lead-net][kube] creating ConfigMap %s/%s", namespace, name)
+			_, err = cms.Create(ctx, &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+				Data:       data,
+			}, metav1.CreateOptions{})
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		cm.Data = data
+		_, err = cms.Update(ctx, cm, metav1.UpdateOptions{})
+		return err
+	})
+}
+
+// GetConfigMap returns the data of namespace/name, or nil if it does not
+// exist.
+func (c *Client) GetConfigMap(ctx context.Context, namespace, name string) (map[string]string, error) {
+	var data map[string]string
+	err := c.withRetry(ctx, "get_configmap", func() error {
+		cm, err := c.cs.CoreV1().ConfigMaps(namespace).Get(ctx, name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		data = cm.Data
+		return nil
+	})
+	return data, err
+}
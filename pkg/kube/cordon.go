@@ -0,0 +1,32 @@
+package kube
+
+import corev1 "k8s.io/api/core/v1"
+
+// DrainTaints are taint keys that mark a node as being drained or removed
+// (cordon itself sets node.kubernetes.io/unschedulable along with
+// spec.unschedulable).
+var DrainTaints = []string{
+	corev1.TaintNodeUnschedulable,
+	"ToBeDeletedByClusterAutoscaler",
+	"karpenter.sh/disrupted",
+	"karpenter.sh/disruption",
+}
+
+// NodeDraining reports whether a node is cordoned or a drain is in progress,
+// i.e. no new pods should be steered toward it.
+func NodeDraining(n *corev1.Node) bool {
+	if n.Spec.Unschedulable {
+		return true
+	}
+	for _, t := range n.Spec.Taints {
+		if t.Effect != corev1.TaintEffectNoSchedule && t.Effect != corev1.TaintEffectNoExecute {
+			continue
+		}
+		for _, k := range DrainTaints {
+			if t.Key == k {
+				return true
+			}
+		}
+	}
+	return false
+}
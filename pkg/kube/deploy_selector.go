@@ -1,23 +1,33 @@
 package kube
 
 import (
+	"strconv"
+
 	appsv1 "k8s.io/api/apps/v1"
 
 	"lead-net-affinity/pkg/graph"
 )
 
-const svcLabel = "io.kompose.service"
-
-func MapDeploymentsByService(deploys []appsv1.Deployment) map[graph.NodeID]*appsv1.Deployment {
+// MapDeploymentsByService keys deployments by the service id resolves them
+// to; deployments without a service are left out.
+func MapDeploymentsByService(deploys []appsv1.Deployment, id *ServiceIdentity) map[graph.NodeID]*appsv1.Deployment {
 	m := make(map[graph.NodeID]*appsv1.Deployment)
 	for i := range deploys {
 		d := &deploys[i]
-		if d.Labels == nil {
-			continue
-		}
-		if name, ok := d.Labels[svcLabel]; ok && name != "" {
-			m[graph.NodeID(name)] = d
+		if svc := id.DeploymentService(d); svc != "" {
+			m[svc] = d
 		}
 	}
 	return m
 }
+
+// IgnoreAnnotation opts a Deployment out of LEAD management: no affinity
+// updates, rebalancing evictions or replica recommendations.
+const IgnoreAnnotation = "lead.io/ignore"
+
+// Ignored reports whether d is annotated lead.io/ignore with a true value
+// ("true", "1", ...).
+func Ignored(d *appsv1.Deployment) bool {
+	v, err := strconv.ParseBool(d.Annotations[IgnoreAnnotation])
+	return err == nil && v
+}
@@ -0,0 +1,33 @@
+package kube
+
+import (
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Annotations that express how disruptive deleting a pod is.
+const (
+	PodDeletionCostAnnotation = "controller.kubernetes.io/pod-deletion-cost"
+	SafeToEvictAnnotation     = "cluster-autoscaler.kubernetes.io/safe-to-evict"
+)
+
+// PodDeletionCost returns the pod's deletion cost (0 when unset or invalid),
+// the value ReplicaSets use to pick which pods to remove first.
+func PodDeletionCost(p *corev1.Pod) int32 {
+	v, ok := p.Annotations[PodDeletionCostAnnotation]
+	if !ok {
+		return 0
+	}
+	cost, err := strconv.ParseInt(v, 10, 32)
+	if err != nil {
+		return 0
+	}
+	return int32(cost)
+}
+
+// SafeToEvict reports whether the pod may be deleted to move it; pods
+// annotated safe-to-evict=false opted out.
+func SafeToEvict(p *corev1.Pod) bool {
+	return p.Annotations[SafeToEvictAnnotation] != "false"
+}
@@ -0,0 +1,32 @@
+package kube
+
+import (
+	"context"
+	"log"
+
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// HPATargets returns the Deployments, as namespace/name, that a
+// HorizontalPodAutoscaler in namespaces scales.
+func (c *Client) HPATargets(ctx context.Context, namespaces []string) (map[string]bool, error) {
+	out := make(map[string]bool)
+	for _, ns := range namespaces {
+		var list *autoscalingv2.HorizontalPodAutoscalerList
+		err := c.withRetry(ctx, "list_hpas", func() (err error) {
+			list, err = c.cs.AutoscalingV2().HorizontalPodAutoscalers(ns).List(ctx, metav1.ListOptions{})
+			return err
+		})
+		if err != nil {
+			log.Printf("[lead-net][kube] HPATargets failed for namespace=%s: %v", ns, err)
+			return nil, err
+		}
+		for _, h := range list.Items {
+			if ref := h.Spec.ScaleTargetRef; ref.Kind == "Deployment" {
+				out[h.Namespace+"/"+ref.Name] = true
+			}
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,138 @@
+package kube
+
+import (
+	"context"
+	"sort"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"lead-net-affinity/pkg/graph"
+)
+
+// DefaultServiceLabel names a workload's graph service when no other label
+// keys are configured (the kompose convention).
+const DefaultServiceLabel = "io.kompose.service"
+
+// ServiceIdentity maps workloads to graph services. A service with an
+// explicit label selector (graph.services[].labelSelector) owns every
+// object matching it; otherwise the value of the first of LabelKeys present
+// on the object names the service. A nil *ServiceIdentity uses
+// DefaultServiceLabel only.
+type ServiceIdentity struct {
+	labelKeys []string
+	selectors map[graph.NodeID]labels.Selector
+	sets      map[graph.NodeID]map[string]string // the selectors' labels
+	services  []graph.NodeID                     // services with selectors, sorted
+}
+
+// NewServiceIdentity builds a ServiceIdentity. keys defaults to
+// DefaultServiceLabel; selectors maps service -> required labels.
+func NewServiceIdentity(keys []string, selectors map[string]map[string]string) *ServiceIdentity {
+	if len(keys) == 0 {
+		keys = []string{DefaultServiceLabel}
+	}
+	id := &ServiceIdentity{
+		labelKeys: keys,
+		selectors: make(map[graph.NodeID]labels.Selector),
+		sets:      make(map[graph.NodeID]map[string]string),
+	}
+	for svc, sel := range selectors {
+		if len(sel) == 0 {
+			continue
+		}
+		id.selectors[graph.NodeID(svc)] = labels.SelectorFromSet(sel)
+		id.sets[graph.NodeID(svc)] = sel
+		id.services = append(id.services, graph.NodeID(svc))
+	}
+	sort.Slice(id.services, func(i, j int) bool { return id.services[i] < id.services[j] })
+	return id
+}
+
+func (id *ServiceIdentity) keys() []string {
+	if id == nil {
+		return []string{DefaultServiceLabel}
+	}
+	return id.labelKeys
+}
+
+// ServiceOf returns the service an object with these labels belongs to, or
+// "" if none.
+func (id *ServiceIdentity) ServiceOf(lbls map[string]string) graph.NodeID {
+	if id != nil {
+		for _, svc := range id.services {
+			if id.selectors[svc].Matches(labels.Set(lbls)) {
+				return svc
+			}
+		}
+	}
+	for _, k := range id.keys() {
+		if v := lbls[k]; v != "" {
+			return graph.NodeID(v)
+		}
+	}
+	return ""
+}
+
+// DeploymentService returns the service of d, judged by the deployment's
+// own labels and then by its pod template labels.
+func (id *ServiceIdentity) DeploymentService(d *appsv1.Deployment) graph.NodeID {
+	if svc := id.ServiceOf(d.Labels); svc != "" {
+		return svc
+	}
+	return id.ServiceOf(d.Spec.Template.Labels)
+}
+
+// PodSelector returns the labels that select the pods of svc, given the
+// pod template labels of its deployment: the service's labelSelector, or
+// the first service label key naming svc. Other template labels (versions,
+// tracks) are left out so terms keep matching across rollouts. If neither
+// applies the whole template is used.
+func (id *ServiceIdentity) PodSelector(svc graph.NodeID, template map[string]string) map[string]string {
+	if id != nil {
+		if set, ok := id.sets[svc]; ok {
+			return set
+		}
+	}
+	for _, k := range id.keys() {
+		if template[k] == string(svc) {
+			return map[string]string{k: string(svc)}
+		}
+	}
+	return template
+}
+
+// ListServicePods lists the pods of svc in namespace.
+func (id *ServiceIdentity) ListServicePods(ctx context.Context, pods PodLister, namespace string, svc graph.NodeID) ([]corev1.Pod, error) {
+	if id != nil {
+		if sel, ok := id.selectors[svc]; ok {
+			return pods.ListPods(ctx, namespace, sel.String())
+		}
+	}
+	var out []corev1.Pod
+	seen := make(map[string]bool)
+	for _, k := range id.keys() {
+		list, err := pods.ListPods(ctx, namespace, k+"="+string(svc))
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range list {
+			// A higher-priority key or a selector may name another service.
+			if !seen[p.Name] && id.ServiceOf(p.Labels) == svc {
+				seen[p.Name] = true
+				out = append(out, p)
+			}
+		}
+	}
+	return out, nil
+}
+
+// anyServiceSelector returns a selector matching at least every pod that
+// belongs to some service; callers still filter with ServiceOf.
+func (id *ServiceIdentity) anyServiceSelector() string {
+	if keys := id.keys(); len(keys) == 1 && (id == nil || len(id.services) == 0) {
+		return keys[0]
+	}
+	return ""
+}
@@ -0,0 +1,53 @@
+package kube
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"log"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// PodLogs returns the log lines written in the last since by every running
+// pod matching selector in namespace (e.g. the CoreDNS pods). Pods whose
+// logs cannot be read are skipped; an error is returned only if listing the
+// pods fails.
+func (c *Client) PodLogs(ctx context.Context, namespace, selector string, since time.Duration) ([]string, error) {
+	var pods *corev1.PodList
+	err := c.withRetry(ctx, "list_pods", func() (err error) {
+		pods, err = c.cs.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+		return err
+	})
+	if err != nil {
+		log.Printf("[lead-net][kube] PodLogs namespace=%s selector=%q: list failed: %v", namespace, selector, err)
+		return nil, err
+	}
+
+	sinceSeconds := int64(since / time.Second)
+	var lines []string
+	for _, p := range pods.Items {
+		if p.Status.Phase != corev1.PodRunning {
+			continue
+		}
+		opts := &corev1.PodLogOptions{}
+		if sinceSeconds > 0 {
+			opts.SinceSeconds = &sinceSeconds
+		}
+		raw, err := c.cs.CoreV1().Pods(namespace).GetLogs(p.Name, opts).DoRaw(ctx)
+		if err != nil {
+			log.Printf("[lead-net][kube] PodLogs %s/%s failed: %v", namespace, p.Name, err)
+			continue
+		}
+		sc := bufio.NewScanner(bytes.NewReader(raw))
+		sc.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+		for sc.Scan() {
+			lines = append(lines, sc.Text())
+		}
+	}
+	log.Printf("[lead-net][kube] PodLogs namespace=%s selector=%q read %d lines from %d pods",
+		namespace, selector, len(lines), len(pods.Items))
+	return lines, nil
+}
@@ -0,0 +1,143 @@
+package kube
+
+import (
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// Ownership markers the controller sets on the workloads it updates; see
+// config.OwnershipConfig.
+const (
+	ManagedAnnotation      = "lead.io/managed"
+	ManagerAnnotation      = "lead.io/manager"
+	LastDecisionAnnotation = "lead.io/last-applied-decision-id"
+	LastUpdateAnnotation   = "lead.io/last-update-timestamp"
+
+	// GuaranteedCPUsAnnotation marks a workload whose container resources
+	// the controller set to Guaranteed QoS with whole CPUs (see
+	// rulegen.ApplyLatencyCritical); those resources are then its own too.
+	GuaranteedCPUsAnnotation = "lead.io/guaranteed-cpus"
+
+	// DecisionAnnotation is set on the pod template to the decision that
+	// last changed the workload's affinity.
+	DecisionAnnotation = "lead.io/decision-id"
+)
+
+// ownedAnnotations are the workload annotations the controller writes.
+// Only these are carried onto the latest object when an update conflicts;
+// other lead.io/ annotations, such as IgnoreAnnotation, belong to users.
+var ownedAnnotations = []string{
+	ManagedAnnotation,
+	ManagerAnnotation,
+	LastDecisionAnnotation,
+	LastUpdateAnnotation,
+	GuaranteedCPUsAnnotation,
+}
+
+// ownedTemplateAnnotations are the pod-template annotations it writes.
+var ownedTemplateAnnotations = []string{DecisionAnnotation}
+
+// carryOwned applies to latest, a freshly read copy of d's workload, every
+// field the controller sets on d, and leaves the rest as latest has it.
+func carryOwned(latest, d *appsv1.Deployment) {
+	latest.Spec.Template.Spec.Affinity = d.Spec.Template.Spec.Affinity.DeepCopy()
+	latest.Annotations = carryAnnotations(latest.Annotations, d.Annotations, ownedAnnotations)
+	tmpl := &latest.Spec.Template
+	tmpl.Annotations = carryAnnotations(tmpl.Annotations, d.Spec.Template.Annotations, ownedTemplateAnnotations)
+	if d.Annotations[GuaranteedCPUsAnnotation] == "true" {
+		carryResources(latest.Spec.Template.Spec.InitContainers, d.Spec.Template.Spec.InitContainers)
+		carryResources(latest.Spec.Template.Spec.Containers, d.Spec.Template.Spec.Containers)
+	}
+}
+
+// carryResources copies the resources of every container in from to the
+// container of the same name in to.
+func carryResources(to, from []corev1.Container) {
+	for i := range to {
+		for _, c := range from {
+			if c.Name == to[i].Name {
+				to[i].Resources = *c.Resources.DeepCopy()
+			}
+		}
+	}
+}
+
+// carryAnnotations sets the keys of from that are in keys on to.
+func carryAnnotations(to, from map[string]string, keys []string) map[string]string {
+	for _, k := range keys {
+		v, ok := from[k]
+		if !ok {
+			continue
+		}
+		if to == nil {
+			to = make(map[string]string)
+		}
+		to[k] = v
+	}
+	return to
+}
+
+// carryOwnedUnstructured is carryOwned for a workload read as unstructured,
+// an Argo Rollout, whose other fields must survive the round trip.
+func carryOwnedUnstructured(obj *unstructured.Unstructured, d *appsv1.Deployment) error {
+	affinityPath := []string{"spec", "template", "spec", "affinity"}
+	if aff := d.Spec.Template.Spec.Affinity; aff != nil {
+		m, err := runtime.DefaultUnstructuredConverter.ToUnstructured(aff)
+		if err != nil {
+			return err
+		}
+		if err := unstructured.SetNestedMap(obj.Object, m, affinityPath...); err != nil {
+			return err
+		}
+	} else {
+		unstructured.RemoveNestedField(obj.Object, affinityPath...)
+	}
+
+	obj.SetAnnotations(carryAnnotations(obj.GetAnnotations(), d.Annotations, ownedAnnotations))
+	tmplPath := []string{"spec", "template", "metadata", "annotations"}
+	tmpl, _, err := unstructured.NestedStringMap(obj.Object, tmplPath...)
+	if err != nil {
+		return err
+	}
+	if tmpl = carryAnnotations(tmpl, d.Spec.Template.Annotations, ownedTemplateAnnotations); tmpl != nil {
+		if err := unstructured.SetNestedStringMap(obj.Object, tmpl, tmplPath...); err != nil {
+			return err
+		}
+	}
+
+	if d.Annotations[GuaranteedCPUsAnnotation] != "true" {
+		return nil
+	}
+	for field, from := range map[string][]corev1.Container{
+		"initContainers": d.Spec.Template.Spec.InitContainers,
+		"containers":     d.Spec.Template.Spec.Containers,
+	} {
+		path := []string{"spec", "template", "spec", field}
+		containers, found, err := unstructured.NestedSlice(obj.Object, path...)
+		if err != nil || !found {
+			continue
+		}
+		for _, item := range containers {
+			c, ok := item.(map[string]any)
+			if !ok {
+				continue
+			}
+			for _, want := range from {
+				if c["name"] != want.Name {
+					continue
+				}
+				res, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&want.Resources)
+				if err != nil {
+					return err
+				}
+				c["resources"] = res
+			}
+		}
+		if err := unstructured.SetNestedSlice(obj.Object, containers, path...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
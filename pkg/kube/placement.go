@@ -2,8 +2,9 @@ package kube
 
 import (
 	"context"
-	"fmt"
 	"log"
+	"sort"
+	"sync"
 
 	corev1 "k8s.io/api/core/v1"
 
@@ -16,49 +17,101 @@ type PodLister interface {
 	ListPods(ctx context.Context, namespace, selector string) ([]corev1.Pod, error)
 }
 
-// PlacementResolver knows how to find which node a service
-// (graph node) is currently running on.
+// PlacementResolver knows which nodes a service (graph node) is currently
+// running on. Lookups are cached for the resolver's lifetime (one
+// reconcile).
 type PlacementResolver struct {
 	k8s        PodLister
 	namespaces []string
+	identity   *ServiceIdentity
+
+	mu       sync.Mutex
+	nodes    map[graph.NodeID]map[string]int
+	replicas map[graph.NodeID]Replicas
 }
 
 // NewPlacementResolver wires in the kube client and the namespaces
-// we care about (from config.yaml: namespaceSelector).
-func NewPlacementResolver(k8s PodLister, namespaces []string) *PlacementResolver {
+// we care about (from config.yaml: namespaceSelector). id maps pods to
+// services; nil uses DefaultServiceLabel.
+func NewPlacementResolver(k8s PodLister, namespaces []string, id *ServiceIdentity) *PlacementResolver {
 	log.Printf("[lead-net][placement] creating placement resolver for namespaces=%v", namespaces)
 	return &PlacementResolver{
 		k8s:        k8s,
 		namespaces: namespaces,
+		identity:   id,
 	}
 }
 
-// NodeNameForService implements scoring.PodPlacement.
-// It looks up a pod with label io.kompose.service=<service>
-// in the configured namespaces and returns its node name.
-func (p *PlacementResolver) NodeNameForService(svcID graph.NodeID) string {
+// NodesForService implements scoring.MultiNodePlacement: the nodes
+// running pods of the service in the configured namespaces, with the
+// number of its pods on each. Pods not yet scheduled, terminating or
+// finished (including evicted) are not counted.
+func (p *PlacementResolver) NodesForService(svcID graph.NodeID) map[string]int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if nodes, ok := p.nodes[svcID]; ok {
+		return nodes
+	}
 	ctx := context.Background()
-	selector := fmt.Sprintf("%s=%s", svcLabel, string(svcID))
-	log.Printf("[lead-net][placement] resolving node for service=%s selector=%q", svcID, selector)
-
+	nodes := make(map[string]int)
+	var replicas Replicas
 	for _, ns := range p.namespaces {
-		pods, err := p.k8s.ListPods(ctx, ns, selector)
+		pods, err := p.identity.ListServicePods(ctx, p.k8s, ns, svcID)
 		if err != nil {
-			log.Printf("[lead-net][placement] ListPods failed for ns=%s selector=%q: %v", ns, selector, err)
+			log.Printf("[lead-net][placement] ListPods failed for service=%s ns=%s: %v", svcID, ns, err)
 			continue
 		}
-		if len(pods) == 0 {
-			log.Printf("[lead-net][placement] no pods found for service=%s in ns=%s selector=%q", svcID, ns, selector)
-			continue
+		for i := range pods {
+			pod := &pods[i]
+			replicas.Add(pod)
+			if pod.Spec.NodeName == "" || !PodActive(pod) {
+				continue
+			}
+			nodes[pod.Spec.NodeName]++
 		}
-		log.Printf("[lead-net][placement] resolved service=%s to node=%s via pod=%s ns=%s",
-			svcID, pods[0].Spec.NodeName, pods[0].Name, ns)
-		// Any pod for that service is fine; in the benchmark
-		// you usually have a small fixed replica count.
-		return pods[0].Spec.NodeName
 	}
+	if len(nodes) == 0 {
+		log.Printf("[lead-net][placement] could not resolve nodes for service=%s (no scheduled pods across namespaces=%v)", svcID, p.namespaces)
+	} else {
+		log.Printf("[lead-net][placement] resolved service=%s to nodes=%v", svcID, nodes)
+	}
+	if p.nodes == nil {
+		p.nodes = make(map[graph.NodeID]map[string]int)
+		p.replicas = make(map[graph.NodeID]Replicas)
+	}
+	p.nodes[svcID] = nodes
+	p.replicas[svcID] = replicas
+	return nodes
+}
 
-	// Unknown placement
-	log.Printf("[lead-net][placement] could not resolve node for service=%s (no matching pods across namespaces=%v)", svcID, p.namespaces)
-	return ""
+// Replicas returns the service's active pods in the configured namespaces
+// by readiness, listing them like NodesForService.
+func (p *PlacementResolver) Replicas(svcID graph.NodeID) Replicas {
+	p.NodesForService(svcID)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.replicas[svcID]
+}
+
+// NodeNameForService implements scoring.PodPlacement: the node running
+// most of the service's pods (ties go to the first name), or "".
+func (p *PlacementResolver) NodeNameForService(svcID graph.NodeID) string {
+	return MainNode(p.NodesForService(svcID))
+}
+
+// MainNode returns the node with the most pods in nodes (ties go to the
+// first name), or "" if nodes is empty.
+func MainNode(nodes map[string]int) string {
+	names := make([]string, 0, len(nodes))
+	for n := range nodes {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	best := ""
+	for _, n := range names {
+		if best == "" || nodes[n] > nodes[best] {
+			best = n
+		}
+	}
+	return best
 }
@@ -0,0 +1,140 @@
+package kube
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"lead-net-affinity/pkg/graph"
+)
+
+const (
+	zoneLabel = "topology.kubernetes.io/zone"
+
+	// ZoneAnnotation lets pods carry their node's zone (e.g. set by a
+	// mutating webhook) for namespace-scoped mode without node read access.
+	ZoneAnnotation = "lead.io/zone"
+)
+
+// PodZone returns the zone recorded on the pod itself: the well-known
+// topology label, or the lead.io/zone annotation. "" if neither is set.
+func PodZone(p *corev1.Pod) string {
+	if z := p.Labels[zoneLabel]; z != "" {
+		return z
+	}
+	return p.Annotations[ZoneAnnotation]
+}
+
+// NodeGetter is the small interface we need to resolve node labels.
+type NodeGetter interface {
+	GetNode(ctx context.Context, name string) (*corev1.Node, error)
+}
+
+// PlacementIndex is a snapshot of which nodes (and zones) each service's
+// pods are running on. It is built once per reconcile so node scoring does
+// not have to list pods per candidate.
+type PlacementIndex struct {
+	ServiceNodes map[graph.NodeID]map[string]int // service -> node -> pod count
+	NodeZones    map[string]string               // node -> zone ("" if unknown)
+}
+
+// BuildPlacementIndex lists pods in the given namespaces and groups them by
+// the service id resolves them to; finished (including evicted) and
+// terminating pods are left out. Zones come from the pods' own topology
+// label/annotation and, when nodes is non-nil, from the node labels.
+func BuildPlacementIndex(ctx context.Context, pods PodLister, nodes NodeGetter, namespaces []string, id *ServiceIdentity) *PlacementIndex {
+	idx := &PlacementIndex{
+		ServiceNodes: make(map[graph.NodeID]map[string]int),
+		NodeZones:    make(map[string]string),
+	}
+
+	for _, ns := range namespaces {
+		list, err := pods.ListPods(ctx, ns, id.anyServiceSelector())
+		if err != nil {
+			log.Printf("[lead-net][placement] BuildPlacementIndex: ListPods failed for ns=%s: %v", ns, err)
+			continue
+		}
+		for _, p := range list {
+			svc := id.ServiceOf(p.Labels)
+			if svc == "" || p.Spec.NodeName == "" || !PodActive(&p) {
+				continue
+			}
+			if idx.ServiceNodes[svc] == nil {
+				idx.ServiceNodes[svc] = make(map[string]int)
+			}
+			idx.ServiceNodes[svc][p.Spec.NodeName]++
+			if z := PodZone(&p); z != "" || idx.NodeZones[p.Spec.NodeName] == "" {
+				idx.NodeZones[p.Spec.NodeName] = z
+			}
+		}
+	}
+
+	if nodes != nil {
+		for name := range idx.NodeZones {
+			n, err := nodes.GetNode(ctx, name)
+			if err != nil {
+				log.Printf("[lead-net][placement] BuildPlacementIndex: GetNode(%q) failed: %v", name, err)
+				continue
+			}
+			if z := n.Labels[zoneLabel]; z != "" {
+				idx.NodeZones[name] = z
+			}
+		}
+	}
+
+	log.Printf("[lead-net][placement] built placement index: services=%d nodes=%d",
+		len(idx.ServiceNodes), len(idx.NodeZones))
+	return idx
+}
+
+// NodesForService implements scoring.PlacementView.
+func (idx *PlacementIndex) NodesForService(svc graph.NodeID) map[string]int {
+	if idx == nil {
+		return nil
+	}
+	return idx.ServiceNodes[svc]
+}
+
+// ZoneForNode implements scoring.PlacementView.
+func (idx *PlacementIndex) ZoneForNode(node string) string {
+	if idx == nil {
+		return ""
+	}
+	return idx.NodeZones[node]
+}
+
+// Nodes returns every node that currently hosts at least one service pod.
+func (idx *PlacementIndex) Nodes() []string {
+	if idx == nil {
+		return nil
+	}
+	out := make([]string, 0, len(idx.NodeZones))
+	for n := range idx.NodeZones {
+		out = append(out, n)
+	}
+	return out
+}
+
+// Fingerprint returns a stable string describing the current topology
+// (service -> node counts and node zones). It changes whenever a pod moves,
+// so callers can cache derived node scores between topology changes.
+func (idx *PlacementIndex) Fingerprint() string {
+	if idx == nil {
+		return ""
+	}
+	var parts []string
+	for svc, nodes := range idx.ServiceNodes {
+		for n, cnt := range nodes {
+			parts = append(parts, fmt.Sprintf("%s@%s=%d", svc, n, cnt))
+		}
+	}
+	for n, z := range idx.NodeZones {
+		parts = append(parts, fmt.Sprintf("%s~%s", n, z))
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ",")
+}
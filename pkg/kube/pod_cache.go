@@ -0,0 +1,135 @@
+package kube
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	podPhaseIndex   = "phase"
+	podServiceIndex = "service"
+)
+
+// podCache serves ListPods from shared informers instead of hitting the API
+// server on every call. Pods are indexed by namespace/phase and by service.
+type podCache struct {
+	indexers map[string]cache.Indexer // namespace ("" = all) -> indexer
+}
+
+// EnableInformerCache starts pod informers for the given namespaces (all
+// namespaces if empty) and waits for them to sync. After it returns, ListPods
+// and ListPodsByPhase read from the local cache. id maps pods to services
+// for the service index.
+func (c *Client) EnableInformerCache(ctx context.Context, namespaces []string, id *ServiceIdentity) error {
+	if len(namespaces) == 0 {
+		namespaces = []string{""}
+	}
+	log.Printf("[lead-net][kube] starting pod informers for namespaces=%v", namespaces)
+
+	pc := &podCache{indexers: make(map[string]cache.Indexer)}
+	var synced []cache.InformerSynced
+	for _, ns := range namespaces {
+		factory := informers.NewSharedInformerFactoryWithOptions(c.cs, 0, informers.WithNamespace(ns))
+		inf := factory.Core().V1().Pods().Informer()
+		if err := inf.AddIndexers(cache.Indexers{
+			podPhaseIndex:   podPhaseIndexFunc,
+			podServiceIndex: podServiceIndexFunc(id),
+		}); err != nil {
+			return fmt.Errorf("add pod indexers for ns %q: %w", ns, err)
+		}
+		pc.indexers[ns] = inf.GetIndexer()
+		synced = append(synced, inf.HasSynced)
+		factory.Start(ctx.Done())
+	}
+
+	if !cache.WaitForCacheSync(ctx.Done(), synced...) {
+		return fmt.Errorf("pod informer cache did not sync")
+	}
+
+	c.pods = pc
+	log.Printf("[lead-net][kube] pod informer cache synced")
+	return nil
+}
+
+func podPhaseIndexFunc(obj interface{}) ([]string, error) {
+	p, ok := obj.(*corev1.Pod)
+	if !ok {
+		return nil, nil
+	}
+	return []string{p.Namespace + "/" + string(p.Status.Phase)}, nil
+}
+
+func podServiceIndexFunc(id *ServiceIdentity) cache.IndexFunc {
+	return func(obj interface{}) ([]string, error) {
+		p, ok := obj.(*corev1.Pod)
+		if !ok {
+			return nil, nil
+		}
+		svc := id.ServiceOf(p.Labels)
+		if svc == "" {
+			return nil, nil
+		}
+		return []string{p.Namespace + "/" + string(svc)}, nil
+	}
+}
+
+// indexerFor returns the indexer that covers namespace (falling back to the
+// cluster-wide one) or nil if the namespace is not cached.
+func (pc *podCache) indexerFor(namespace string) cache.Indexer {
+	if idx, ok := pc.indexers[namespace]; ok {
+		return idx
+	}
+	return pc.indexers[""]
+}
+
+func (pc *podCache) list(namespace, selector string) ([]corev1.Pod, bool, error) {
+	idx := pc.indexerFor(namespace)
+	if idx == nil {
+		return nil, false, nil
+	}
+	sel, err := labels.Parse(selector)
+	if err != nil {
+		return nil, true, err
+	}
+
+	var objs []interface{}
+	if namespace == "" {
+		objs = idx.List()
+	} else {
+		objs, err = idx.ByIndex(cache.NamespaceIndex, namespace)
+		if err != nil {
+			return nil, true, err
+		}
+	}
+
+	out := make([]corev1.Pod, 0, len(objs))
+	for _, o := range objs {
+		p := o.(*corev1.Pod)
+		if sel.Matches(labels.Set(p.Labels)) {
+			out = append(out, *p)
+		}
+	}
+	return out, true, nil
+}
+
+func (pc *podCache) byPhase(namespace string, phase corev1.PodPhase) ([]corev1.Pod, bool, error) {
+	idx := pc.indexerFor(namespace)
+	if idx == nil || namespace == "" {
+		return nil, false, nil
+	}
+	objs, err := idx.ByIndex(podPhaseIndex, namespace+"/"+string(phase))
+	if err != nil {
+		return nil, true, err
+	}
+	out := make([]corev1.Pod, 0, len(objs))
+	for _, o := range objs {
+		out = append(out, *o.(*corev1.Pod))
+	}
+	return out, true, nil
+}
@@ -0,0 +1,42 @@
+package kube
+
+import corev1 "k8s.io/api/core/v1"
+
+// PodActive reports whether p is a replica that serves or will serve
+// traffic: not finished (Succeeded, or Failed which includes Evicted pods)
+// and not terminating. Pending pods are active but not ready.
+func PodActive(p *corev1.Pod) bool {
+	return p.DeletionTimestamp == nil &&
+		p.Status.Phase != corev1.PodSucceeded && p.Status.Phase != corev1.PodFailed
+}
+
+// Replicas counts a service's active pods (see PodActive) by readiness.
+type Replicas struct {
+	Ready    int `json:"ready"`
+	NotReady int `json:"notReady"` // pending, starting or failing readiness checks
+}
+
+// Add counts p if it is active.
+func (r *Replicas) Add(p *corev1.Pod) {
+	switch {
+	case !PodActive(p):
+	case PodReady(p):
+		r.Ready++
+	default:
+		r.NotReady++
+	}
+}
+
+// Total is the number of active replicas.
+func (r Replicas) Total() int {
+	return r.Ready + r.NotReady
+}
+
+// ReadyRatio is the share of active replicas that are ready, and false if
+// there are none.
+func (r Replicas) ReadyRatio() (float64, bool) {
+	if r.Total() == 0 {
+		return 0, false
+	}
+	return float64(r.Ready) / float64(r.Total()), true
+}
@@ -0,0 +1,57 @@
+package kube
+
+import (
+	"slices"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// DefaultSidecarContainers are the injected service mesh proxies counted
+// as sidecars when no list is configured.
+var DefaultSidecarContainers = []string{"istio-proxy", "linkerd-proxy"}
+
+// PodRequests is the CPU a pod needs to be scheduled, of which
+// SidecarCPUMillis is requested by sidecars rather than the application.
+type PodRequests struct {
+	CPUMillis        int64
+	SidecarCPUMillis int64
+}
+
+// AppCPUMillis is the CPU requested by the application containers.
+func (r PodRequests) AppCPUMillis() int64 {
+	return r.CPUMillis - r.SidecarCPUMillis
+}
+
+// EffectiveRequests returns the CPU request the scheduler accounts for a
+// pod with spec: every container plus native sidecars (restartable init
+// containers), or the largest init container step if that is more, plus
+// the pod overhead. Containers named in sidecars (e.g. injected mesh
+// proxies) and native sidecars make up SidecarCPUMillis.
+func EffectiveRequests(spec *corev1.PodSpec, sidecars []string) PodRequests {
+	var app, side, initPeak, started int64
+	for _, c := range spec.InitContainers {
+		cpu := c.Resources.Requests.Cpu().MilliValue()
+		if c.RestartPolicy != nil && *c.RestartPolicy == corev1.ContainerRestartPolicyAlways {
+			// Native sidecars keep running next to the later init
+			// containers and the app.
+			started += cpu
+			side += cpu
+			initPeak = max(initPeak, started)
+			continue
+		}
+		initPeak = max(initPeak, started+cpu)
+	}
+	for _, c := range spec.Containers {
+		cpu := c.Resources.Requests.Cpu().MilliValue()
+		if slices.Contains(sidecars, c.Name) {
+			side += cpu
+		} else {
+			app += cpu
+		}
+	}
+	total := max(app+side, initPeak)
+	if spec.Overhead != nil {
+		total += spec.Overhead.Cpu().MilliValue()
+	}
+	return PodRequests{CPUMillis: total, SidecarCPUMillis: side}
+}
@@ -0,0 +1,75 @@
+package kube
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/util/retry"
+
+	"lead-net-affinity/pkg/metrics"
+)
+
+// DefaultRetryBackoff is the per-call retry budget for transient API errors:
+// up to 5 attempts, 200ms doubling to at most 5s between attempts.
+var DefaultRetryBackoff = wait.Backoff{
+	Duration: 200 * time.Millisecond,
+	Factor:   2,
+	Jitter:   0.1,
+	Steps:    5,
+	Cap:      5 * time.Second,
+}
+
+// SetRetryBackoff overrides the retry budget used for every API call.
+func (c *Client) SetRetryBackoff(b wait.Backoff) {
+	c.backoff = &b
+}
+
+// isTransient reports whether err is worth retrying: throttling, timeouts,
+// an unavailable/overloaded API server or a network error.
+func isTransient(err error) bool {
+	if err == nil {
+		return false
+	}
+	if apierrors.IsTooManyRequests(err) ||
+		apierrors.IsServerTimeout(err) ||
+		apierrors.IsTimeout(err) ||
+		apierrors.IsServiceUnavailable(err) ||
+		apierrors.IsInternalError(err) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// withRetry runs fn with exponential backoff while it fails with a transient
+// error, counting retries and final failures per operation.
+func (c *Client) withRetry(ctx context.Context, op string, fn func() error) error {
+	backoff := DefaultRetryBackoff
+	if c.backoff != nil {
+		backoff = *c.backoff
+	}
+
+	attempt := 0
+	err := retry.OnError(backoff, func(err error) bool {
+		if ctx.Err() != nil || !isTransient(err) {
+			return false
+		}
+		metrics.Default.Add("lead_net_kube_retries_total", "Kubernetes API calls retried after a transient error.",
+			map[string]string{"op": op}, 1)
+		log.Printf("[lead-net][kube] %s attempt %d failed with transient error, retrying: %v", op, attempt, err)
+		return true
+	}, func() error {
+		attempt++
+		return fn()
+	})
+	if err != nil {
+		metrics.Default.Add("lead_net_kube_failures_total", "Kubernetes API calls that failed after retries.",
+			map[string]string{"op": op}, 1)
+	}
+	return err
+}
@@ -0,0 +1,83 @@
+package kube
+
+import (
+	"context"
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// GetDeployment reads one Deployment.
+func (c *Client) GetDeployment(ctx context.Context, namespace, name string) (*appsv1.Deployment, error) {
+	var d *appsv1.Deployment
+	err := c.withRetry(ctx, "get_deployment", func() (err error) {
+		d, err = c.cs.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+		return err
+	})
+	return d, err
+}
+
+// RolloutComplete reports whether d's latest pod template is fully rolled
+// out, the same check "kubectl rollout status" makes. It returns an error
+// once the rollout exceeded its progress deadline. An Argo Rollout (see
+// IsRollout) is complete once Healthy and failed once Degraded, e.g. after
+// an aborted canary.
+func RolloutComplete(d *appsv1.Deployment) (bool, error) {
+	if d.Generation > d.Status.ObservedGeneration {
+		return false, nil
+	}
+	if IsRollout(d) {
+		switch RolloutPhase(d) {
+		case RolloutPhaseHealthy:
+			return true, nil
+		case RolloutPhaseDegraded:
+			return false, fmt.Errorf("rollout %s/%s is degraded", d.Namespace, d.Name)
+		}
+		return false, nil
+	}
+	for _, cond := range d.Status.Conditions {
+		if cond.Type == appsv1.DeploymentProgressing && cond.Status == corev1.ConditionFalse &&
+			cond.Reason == "ProgressDeadlineExceeded" {
+			return false, fmt.Errorf("deployment %s/%s exceeded its progress deadline", d.Namespace, d.Name)
+		}
+	}
+	replicas := int32(1)
+	if d.Spec.Replicas != nil {
+		replicas = *d.Spec.Replicas
+	}
+	st := d.Status
+	return st.UpdatedReplicas >= replicas && st.Replicas <= st.UpdatedReplicas && st.AvailableReplicas >= st.UpdatedReplicas, nil
+}
+
+// ScaleDeployment changes a Deployment's replica count by delta and returns
+// the new count.
+func (c *Client) ScaleDeployment(ctx context.Context, namespace, name string, delta int32) (int32, error) {
+	var replicas int32
+	err := c.UpdateDeploymentWith(ctx, namespace, name, func(d *appsv1.Deployment) {
+		replicas = 1
+		if d.Spec.Replicas != nil {
+			replicas = *d.Spec.Replicas
+		}
+		replicas += delta
+		if replicas < 0 {
+			replicas = 0
+		}
+		d.Spec.Replicas = &replicas
+	}, nil)
+	return replicas, err
+}
+
+// PodReady reports whether p is running and passes its readiness checks.
+func PodReady(p *corev1.Pod) bool {
+	if p.DeletionTimestamp != nil || p.Status.Phase != corev1.PodRunning {
+		return false
+	}
+	for _, cond := range p.Status.Conditions {
+		if cond.Type == corev1.PodReady {
+			return cond.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
@@ -0,0 +1,25 @@
+package kube
+
+import appsv1 "k8s.io/api/apps/v1"
+
+const (
+	// OwnerAnnotation names the team owning a Deployment.
+	OwnerAnnotation = "lead.io/owner"
+	// VersionLabel is the recommended Kubernetes label for an app version.
+	VersionLabel = "app.kubernetes.io/version"
+)
+
+// DeploymentVersion returns the app.kubernetes.io/version label of the
+// Deployment or its pod template, or "".
+func DeploymentVersion(d *appsv1.Deployment) string {
+	if v := d.Labels[VersionLabel]; v != "" {
+		return v
+	}
+	return d.Spec.Template.Labels[VersionLabel]
+}
+
+// DeploymentOwner returns the lead.io/owner annotation of the Deployment,
+// or "".
+func DeploymentOwner(d *appsv1.Deployment) string {
+	return d.Annotations[OwnerAnnotation]
+}
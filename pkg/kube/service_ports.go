@@ -0,0 +1,78 @@
+package kube
+
+import (
+	"context"
+	"log"
+	"sort"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"lead-net-affinity/pkg/graph"
+)
+
+// ListServices lists the Kubernetes Services of the given namespaces.
+func (c *Client) ListServices(ctx context.Context, namespaces []string) ([]corev1.Service, error) {
+	var out []corev1.Service
+	for _, ns := range namespaces {
+		var list *corev1.ServiceList
+		err := c.withRetry(ctx, "list_services", func() (err error) {
+			list, err = c.cs.CoreV1().Services(ns).List(ctx, metav1.ListOptions{})
+			return err
+		})
+		if err != nil {
+			log.Printf("[lead-net][kube] ListServices failed for namespace=%s: %v", ns, err)
+			return nil, err
+		}
+		out = append(out, list.Items...)
+	}
+	log.Printf("[lead-net][kube] ListServices total services=%d across namespaces=%v", len(out), namespaces)
+	return out, nil
+}
+
+// DeploymentPorts returns the ports of the Services in d's namespace that
+// select d's pods, ordered by port. Named target ports are resolved against
+// the pod template's container ports; the app protocol comes from
+// appProtocol or the port name (graph.AppProtocolOf). Services without a
+// selector (external or manually managed endpoints) are skipped.
+func DeploymentPorts(d *appsv1.Deployment, services []corev1.Service) []graph.Port {
+	podLabels := labels.Set(d.Spec.Template.Labels)
+	named := make(map[string]int32)
+	for _, ctr := range d.Spec.Template.Spec.Containers {
+		for _, p := range ctr.Ports {
+			if p.Name != "" {
+				named[p.Name] = p.ContainerPort
+			}
+		}
+	}
+
+	var out []graph.Port
+	seen := make(map[graph.Port]bool)
+	for _, svc := range services {
+		if svc.Namespace != d.Namespace || len(svc.Spec.Selector) == 0 ||
+			!labels.SelectorFromSet(svc.Spec.Selector).Matches(podLabels) {
+			continue
+		}
+		for _, sp := range svc.Spec.Ports {
+			p := graph.Port{Name: sp.Name, Port: sp.Port, Protocol: string(sp.Protocol)}
+			if sp.AppProtocol != nil {
+				p.AppProtocol = *sp.AppProtocol
+			}
+			p.AppProtocol = graph.AppProtocolOf(p.AppProtocol, p.Name)
+			switch {
+			case sp.TargetPort.StrVal != "":
+				p.TargetPort = named[sp.TargetPort.StrVal]
+			case sp.TargetPort.IntVal != sp.Port:
+				p.TargetPort = sp.TargetPort.IntVal
+			}
+			if !seen[p] {
+				seen[p] = true
+				out = append(out, p)
+			}
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Port < out[j].Port })
+	return out
+}
@@ -0,0 +1,63 @@
+package kube
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// StatusGVR is the LeadNetAffinityStatus custom resource (see deploy/crd.yaml).
+var StatusGVR = schema.GroupVersionResource{
+	Group:    "lead.io",
+	Version:  "v1alpha1",
+	Resource: "leadnetaffinitystatuses",
+}
+
+const statusKind = "LeadNetAffinityStatus"
+
+// WriteStatus creates the LeadNetAffinityStatus object if needed and replaces
+// its status subresource with status (any JSON-serializable value).
+func (c *Client) WriteStatus(ctx context.Context, namespace, name string, status interface{}) error {
+	if c.dyn == nil {
+		return fmt.Errorf("dynamic client not configured")
+	}
+
+	raw, err := json.Marshal(status)
+	if err != nil {
+		return fmt.Errorf("marshal status: %w", err)
+	}
+	var statusMap map[string]interface{}
+	if err := json.Unmarshal(raw, &statusMap); err != nil {
+		return fmt.Errorf("unmarshal status: %w", err)
+	}
+
+	res := c.dyn.Resource(StatusGVR).Namespace(namespace)
+	obj, err := res.Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		log.Printf("[lead-net][kube] creating %s %s/%s", statusKind, namespace, name)
+		obj = &unstructured.Unstructured{}
+		obj.SetAPIVersion(StatusGVR.GroupVersion().String())
+		obj.SetKind(statusKind)
+		obj.SetNamespace(namespace)
+		obj.SetName(name)
+		obj, err = res.Create(ctx, obj, metav1.CreateOptions{})
+	}
+	if err != nil {
+		log.Printf("[lead-net][kube] get/create %s %s/%s failed: %v", statusKind, namespace, name, err)
+		return err
+	}
+
+	obj.Object["status"] = statusMap
+	if _, err := res.UpdateStatus(ctx, obj, metav1.UpdateOptions{}); err != nil {
+		log.Printf("[lead-net][kube] update %s %s/%s status failed: %v", statusKind, namespace, name, err)
+		return err
+	}
+	log.Printf("[lead-net][kube] updated %s %s/%s status", statusKind, namespace, name)
+	return nil
+}
@@ -0,0 +1,58 @@
+package kube
+
+import (
+	"context"
+	"log"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+)
+
+// DegradedTaint marks nodes whose network metrics are bad. PreferNoSchedule
+// steers new pods elsewhere without making the node unusable.
+var DegradedTaint = corev1.Taint{Key: "lead.io/degraded", Value: "true", Effect: corev1.TaintEffectPreferNoSchedule}
+
+// HasTaint reports whether n carries a taint with t's key and effect.
+func HasTaint(n *corev1.Node, t corev1.Taint) bool {
+	for _, x := range n.Spec.Taints {
+		if x.Key == t.Key && x.Effect == t.Effect {
+			return true
+		}
+	}
+	return false
+}
+
+// SetNodeTaint adds (present) or removes t on the named node, retrying on
+// conflicts. Nodes already in the wanted state are not written.
+func (c *Client) SetNodeTaint(ctx context.Context, name string, t corev1.Taint, present bool) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		var n *corev1.Node
+		err := c.withRetry(ctx, "get_node", func() (err error) {
+			n, err = c.cs.CoreV1().Nodes().Get(ctx, name, metav1.GetOptions{})
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		if HasTaint(n, t) == present {
+			return nil
+		}
+		if present {
+			n.Spec.Taints = append(n.Spec.Taints, t)
+		} else {
+			kept := n.Spec.Taints[:0]
+			for _, x := range n.Spec.Taints {
+				if x.Key != t.Key || x.Effect != t.Effect {
+					kept = append(kept, x)
+				}
+			}
+			n.Spec.Taints = kept
+		}
+		log.Printf("[lead-net][kube] node %s taint %s=%s:%s present=%v", name, t.Key, t.Value, t.Effect, present)
+		return c.withRetry(ctx, "update_node", func() error {
+			_, err := c.cs.CoreV1().Nodes().Update(ctx, n, metav1.UpdateOptions{})
+			return err
+		})
+	})
+}
@@ -0,0 +1,158 @@
+package kube
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+
+	"lead-net-affinity/pkg/supervise"
+)
+
+// WatchChanges starts Deployment and Node informers and calls notify whenever
+// something happens that should trigger a reconcile:
+//   - a Deployment for a graph service appears (id maps it to a service,
+//     isGraphService decides),
+//   - a Deployment's replicas or pod template change, unless the change is
+//     the controller's own update (its lead.io/last-update-timestamp moved),
+//   - a Deployment loses its last ready replica; other status updates, such
+//     as ready counts moving during a rollout, do not notify,
+//   - a Node's Ready condition flips, or it is cordoned/drained or
+//     uncordoned (not in namespace-scoped mode),
+//   - a Node is deleted; forgetNode (if not nil) is called first with its
+//     name and addresses so cached state about it can be dropped.
+//
+// notify must be cheap and non-blocking; debouncing is up to the caller.
+func (c *Client) WatchChanges(
+	ctx context.Context,
+	namespaces []string,
+	id *ServiceIdentity,
+	isGraphService func(name string) bool,
+	notify func(reason string),
+	forgetNode func(name string, addrs []string),
+) error {
+	if len(namespaces) == 0 {
+		namespaces = []string{""}
+	}
+	log.Printf("[lead-net][kube] starting change watchers for namespaces=%v", namespaces)
+
+	var synced []cache.InformerSynced
+
+	for _, ns := range namespaces {
+		factory := informers.NewSharedInformerFactoryWithOptions(c.cs, 0, informers.WithNamespace(ns))
+		inf := factory.Apps().V1().Deployments().Informer()
+		_, err := inf.AddEventHandler(cache.ResourceEventHandlerDetailedFuncs{
+			AddFunc: func(obj interface{}, isInInitialList bool) {
+				defer supervise.Catch("watch", nil)
+				d, ok := obj.(*appsv1.Deployment)
+				if !ok || isInInitialList {
+					return
+				}
+				if svc := id.DeploymentService(d); svc != "" && isGraphService(string(svc)) {
+					notify(fmt.Sprintf("new deployment %s/%s for service %s", d.Namespace, d.Name, svc))
+				}
+			},
+			UpdateFunc: func(oldObj, newObj interface{}) {
+				defer supervise.Catch("watch", nil)
+				od, ok1 := oldObj.(*appsv1.Deployment)
+				nd, ok2 := newObj.(*appsv1.Deployment)
+				if !ok1 || !ok2 {
+					return
+				}
+				ownUpdate := od.Annotations[LastUpdateAnnotation] != nd.Annotations[LastUpdateAnnotation]
+				switch {
+				case replicas(od) != replicas(nd) && !ownUpdate:
+					notify(fmt.Sprintf("replicas changed for deployment %s/%s (%d -> %d)",
+						nd.Namespace, nd.Name, replicas(od), replicas(nd)))
+				case !ownUpdate && !equality.Semantic.DeepEqual(od.Spec.Template, nd.Spec.Template):
+					notify(fmt.Sprintf("pod template changed for deployment %s/%s", nd.Namespace, nd.Name))
+				case od.Status.ReadyReplicas > 0 && nd.Status.ReadyReplicas == 0:
+					notify(fmt.Sprintf("deployment %s/%s has no ready replicas", nd.Namespace, nd.Name))
+				}
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("add deployment handler for ns %q: %w", ns, err)
+		}
+		synced = append(synced, inf.HasSynced)
+		factory.Start(ctx.Done())
+	}
+
+	if c.noNodes {
+		log.Printf("[lead-net][kube] namespace-scoped mode: not watching nodes")
+		return c.waitSynced(ctx, synced)
+	}
+
+	nodeFactory := informers.NewSharedInformerFactory(c.cs, 0)
+	nodeInf := nodeFactory.Core().V1().Nodes().Informer()
+	_, err := nodeInf.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			defer supervise.Catch("watch", nil)
+			on, ok1 := oldObj.(*corev1.Node)
+			nn, ok2 := newObj.(*corev1.Node)
+			if !ok1 || !ok2 {
+				return
+			}
+			if wasReady, isReady := nodeIsReady(on), nodeIsReady(nn); wasReady != isReady {
+				notify(fmt.Sprintf("node %s ready=%v", nn.Name, isReady))
+			}
+			if was, is := NodeDraining(on), NodeDraining(nn); was != is {
+				notify(fmt.Sprintf("node %s draining=%v", nn.Name, is))
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			defer supervise.Catch("watch", nil)
+			if d, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = d.Obj
+			}
+			n, ok := obj.(*corev1.Node)
+			if !ok {
+				return
+			}
+			if forgetNode != nil {
+				addrs := make([]string, 0, len(n.Status.Addresses))
+				for _, a := range n.Status.Addresses {
+					addrs = append(addrs, a.Address)
+				}
+				forgetNode(n.Name, addrs)
+			}
+			notify(fmt.Sprintf("node %s deleted", n.Name))
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("add node handler: %w", err)
+	}
+	synced = append(synced, nodeInf.HasSynced)
+	nodeFactory.Start(ctx.Done())
+
+	return c.waitSynced(ctx, synced)
+}
+
+func (c *Client) waitSynced(ctx context.Context, synced []cache.InformerSynced) error {
+	if !cache.WaitForCacheSync(ctx.Done(), synced...) {
+		return fmt.Errorf("change watchers did not sync")
+	}
+	log.Printf("[lead-net][kube] change watchers synced")
+	return nil
+}
+
+func replicas(d *appsv1.Deployment) int32 {
+	if d.Spec.Replicas == nil {
+		return 1
+	}
+	return *d.Spec.Replicas
+}
+
+func nodeIsReady(n *corev1.Node) bool {
+	for _, cond := range n.Status.Conditions {
+		if cond.Type == corev1.NodeReady {
+			return cond.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
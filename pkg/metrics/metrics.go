@@ -0,0 +1,165 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+type kind int
+
+const (
+	kindCounter kind = iota
+	kindGauge
+)
+
+type family struct {
+	name   string
+	help   string
+	kind   kind
+	series map[string]*series // key: rendered label set
+}
+
+type series struct {
+	labels string
+	value  float64
+}
+
+// Registry is a minimal Prometheus text-format registry for the few counters
+// and gauges the controller exports. It is safe for concurrent use.
+type Registry struct {
+	mu       sync.Mutex
+	families map[string]*family
+}
+
+func NewRegistry() *Registry {
+	return &Registry{families: make(map[string]*family)}
+}
+
+// Default is the process-wide registry served on /metrics.
+var Default = NewRegistry()
+
+// Add increments counter name{labels} by delta.
+func (r *Registry) Add(name, help string, labels map[string]string, delta float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.get(name, help, kindCounter, labels).value += delta
+}
+
+// Set sets gauge name{labels} to value.
+func (r *Registry) Set(name, help string, labels map[string]string, value float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.get(name, help, kindGauge, labels).value = value
+}
+
+// Reset drops every series of a gauge family, e.g. before re-publishing a
+// per-node gauge whose label set may have shrunk.
+func (r *Registry) Reset(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if f, ok := r.families[name]; ok {
+		f.series = make(map[string]*series)
+	}
+}
+
+// Delete drops the series name{labels}, e.g. of a path or node that is
+// gone.
+func (r *Registry) Delete(name string, labels map[string]string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if f, ok := r.families[name]; ok {
+		delete(f.series, renderLabels(labels))
+	}
+}
+
+// Value returns the current value of name{labels} (0 if missing).
+func (r *Registry) Value(name string, labels map[string]string) float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	f, ok := r.families[name]
+	if !ok {
+		return 0
+	}
+	if s, ok := f.series[renderLabels(labels)]; ok {
+		return s.value
+	}
+	return 0
+}
+
+func (r *Registry) get(name, help string, k kind, labels map[string]string) *series {
+	f, ok := r.families[name]
+	if !ok {
+		f = &family{name: name, help: help, kind: k, series: make(map[string]*series)}
+		r.families[name] = f
+	}
+	key := renderLabels(labels)
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{labels: key}
+		f.series[key] = s
+	}
+	return s
+}
+
+// WriteText renders all metrics in the Prometheus text exposition format.
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	names := make([]string, 0, len(r.families))
+	for n := range r.families {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	for _, n := range names {
+		f := r.families[n]
+		typ := "counter"
+		if f.kind == kindGauge {
+			typ = "gauge"
+		}
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.name, f.help, f.name, typ); err != nil {
+			return err
+		}
+		keys := make([]string, 0, len(f.series))
+		for k := range f.series {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if _, err := fmt.Fprintf(w, "%s%s %g\n", f.name, k, f.series[k].value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Handler serves the registry on /metrics.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		_ = r.WriteText(w)
+	})
+}
+
+func renderLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		v := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(labels[k])
+		parts[i] = fmt.Sprintf(`%s="%s"`, k, v)
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
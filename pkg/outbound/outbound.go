@@ -0,0 +1,76 @@
+// Package outbound builds the HTTP clients the controller uses to reach
+// Prometheus and trace backends: proxies, extra headers and timeouts.
+package outbound
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Options tunes an outbound HTTP client.
+type Options struct {
+	// ProxyURL overrides the HTTP_PROXY/HTTPS_PROXY/NO_PROXY environment
+	// variables, which are honored otherwise.
+	ProxyURL string
+	// Headers are added to every request, e.g. a token for a metrics gateway.
+	Headers map[string]string
+	// Timeout bounds each request; 0 keeps the client's default.
+	Timeout time.Duration
+}
+
+// NewTransport returns a copy of http.DefaultTransport that uses proxyURL,
+// or the proxy environment variables if it is empty.
+func NewTransport(proxyURL string) (*http.Transport, error) {
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	if proxyURL != "" {
+		u, err := url.Parse(proxyURL)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("invalid proxy URL %q", proxyURL)
+		}
+		tr.Proxy = http.ProxyURL(u)
+	}
+	return tr, nil
+}
+
+// WithHeaders wraps rt to set headers on every request. Headers already
+// on a request (e.g. Authorization from configured credentials) win.
+func WithHeaders(rt http.RoundTripper, headers map[string]string) http.RoundTripper {
+	if len(headers) == 0 {
+		return rt
+	}
+	return &headerTransport{base: rt, headers: headers}
+}
+
+type headerTransport struct {
+	base    http.RoundTripper
+	headers map[string]string
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for k, v := range t.headers {
+		if req.Header.Get(k) == "" {
+			req.Header.Set(k, v)
+		}
+	}
+	return t.base.RoundTrip(req)
+}
+
+// Apply configures client per o on top of tr (whose TLS settings are
+// kept). Call it again to change the options.
+func Apply(client *http.Client, tr *http.Transport, o Options) error {
+	if o.ProxyURL != "" {
+		fresh, err := NewTransport(o.ProxyURL)
+		if err != nil {
+			return err
+		}
+		tr.Proxy = fresh.Proxy
+	}
+	client.Transport = WithHeaders(tr, o.Headers)
+	if o.Timeout > 0 {
+		client.Timeout = o.Timeout
+	}
+	return nil
+}
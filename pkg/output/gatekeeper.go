@@ -0,0 +1,230 @@
+package output
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// Gatekeeper export files.
+const (
+	GatekeeperTemplateFile    = "gatekeeper-template.yaml"
+	GatekeeperConstraintsFile = "gatekeeper-constraints.yaml"
+)
+
+// GatekeeperKind is the constraint kind defined by the exported template.
+const GatekeeperKind = "LeadNetNodeAffinity"
+
+// DefaultEnforcementAction audits without blocking admission.
+const DefaultEnforcementAction = "dryrun"
+
+// NodeConstraint is a node requirement LEAD enforces on a service's pods,
+// e.g. "topology.kubernetes.io/zone In [eu-1a]" or spot nodes NotIn.
+type NodeConstraint struct {
+	Service      string
+	Namespace    string
+	Selector     map[string]string // the service's pod labels
+	Requirements []corev1.NodeSelectorRequirement
+}
+
+// NodeConstraints returns the required node affinity of d that holds
+// whichever term the scheduler picks: the In and NotIn requirements
+// present in every required term.
+func NodeConstraints(d *appsv1.Deployment) []corev1.NodeSelectorRequirement {
+	aff := d.Spec.Template.Spec.Affinity
+	if aff == nil || aff.NodeAffinity == nil || aff.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution == nil {
+		return nil
+	}
+	terms := aff.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms
+	if len(terms) == 0 {
+		return nil
+	}
+	var out []corev1.NodeSelectorRequirement
+	for _, e := range terms[0].MatchExpressions {
+		if e.Operator != corev1.NodeSelectorOpIn && e.Operator != corev1.NodeSelectorOpNotIn {
+			continue
+		}
+		inAll := true
+		for _, t := range terms[1:] {
+			if !slices.ContainsFunc(t.MatchExpressions, func(o corev1.NodeSelectorRequirement) bool {
+				return o.Key == e.Key && o.Operator == e.Operator && slices.Equal(o.Values, e.Values)
+			}) {
+				inAll = false
+				break
+			}
+		}
+		if inAll {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// Gatekeeper renders a ConstraintTemplate and one constraint per service
+// with node requirements, so OPA Gatekeeper can audit (or, with
+// enforcementAction deny, enforce) them on every workload, including ones
+// LEAD does not manage.
+func Gatekeeper(constraints []NodeConstraint, enforcementAction string) (map[string][]byte, error) {
+	if enforcementAction == "" {
+		enforcementAction = DefaultEnforcementAction
+	}
+	tmpl, err := yaml.Marshal(gatekeeperTemplate())
+	if err != nil {
+		return nil, fmt.Errorf("render constraint template: %w", err)
+	}
+
+	sort.Slice(constraints, func(i, j int) bool {
+		return constraints[i].Namespace+"/"+constraints[i].Service < constraints[j].Namespace+"/"+constraints[j].Service
+	})
+	var docs bytes.Buffer
+	for _, c := range constraints {
+		if len(c.Requirements) == 0 {
+			continue
+		}
+		b, err := yaml.Marshal(gatekeeperConstraint(c, enforcementAction))
+		if err != nil {
+			return nil, fmt.Errorf("render constraint for %s: %w", c.Service, err)
+		}
+		if docs.Len() > 0 {
+			docs.WriteString("---\n")
+		}
+		docs.Write(b)
+	}
+	return map[string][]byte{GatekeeperTemplateFile: tmpl, GatekeeperConstraintsFile: docs.Bytes()}, nil
+}
+
+var nonDNS = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// constraintName is a DNS-1123 name for c's constraint.
+func constraintName(c NodeConstraint) string {
+	name := nonDNS.ReplaceAllString(strings.ToLower("lead-net-"+c.Namespace+"-"+c.Service), "-")
+	return strings.Trim(name[:min(len(name), 253)], "-")
+}
+
+func gatekeeperConstraint(c NodeConstraint, enforcementAction string) map[string]any {
+	reqs := make([]map[string]any, 0, len(c.Requirements))
+	for _, r := range c.Requirements {
+		reqs = append(reqs, map[string]any{"key": r.Key, "operator": string(r.Operator), "values": r.Values})
+	}
+	return map[string]any{
+		"apiVersion": "constraints.gatekeeper.sh/v1beta1",
+		"kind":       GatekeeperKind,
+		"metadata": map[string]any{
+			"name":        constraintName(c),
+			"annotations": map[string]any{"lead.io/service": c.Service},
+		},
+		"spec": map[string]any{
+			"enforcementAction": enforcementAction,
+			"match": map[string]any{
+				"kinds": []map[string]any{
+					{"apiGroups": []string{""}, "kinds": []string{"Pod"}},
+					{"apiGroups": []string{"apps"}, "kinds": []string{"Deployment", "StatefulSet", "ReplicaSet", "DaemonSet"}},
+				},
+				"namespaces":    []string{c.Namespace},
+				"labelSelector": map[string]any{"matchLabels": c.Selector},
+			},
+			"parameters": map[string]any{"requirements": reqs},
+		},
+	}
+}
+
+func gatekeeperTemplate() map[string]any {
+	return map[string]any{
+		"apiVersion": "templates.gatekeeper.sh/v1",
+		"kind":       "ConstraintTemplate",
+		"metadata":   map[string]any{"name": strings.ToLower(GatekeeperKind)},
+		"spec": map[string]any{
+			"crd": map[string]any{"spec": map[string]any{
+				"names": map[string]any{"kind": GatekeeperKind},
+				"validation": map[string]any{"openAPIV3Schema": map[string]any{
+					"type": "object",
+					"properties": map[string]any{"requirements": map[string]any{
+						"type": "array",
+						"items": map[string]any{
+							"type": "object",
+							"properties": map[string]any{
+								"key":      map[string]any{"type": "string"},
+								"operator": map[string]any{"type": "string", "enum": []string{"In", "NotIn"}},
+								"values":   map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+							},
+						},
+					}},
+				}},
+			}},
+			"targets": []map[string]any{{"target": "admission.k8s.gatekeeper.sh", "rego": gatekeeperRego}},
+		},
+	}
+}
+
+// gatekeeperRego checks that a pod (template) can only be scheduled where
+// every requirement holds: each required node affinity term restricts the
+// key at least as much, or for In a nodeSelector picks an allowed value.
+const gatekeeperRego = `package leadnetnodeaffinity
+
+pod_spec(obj) = spec {
+  obj.kind == "Pod"
+  spec := obj.spec
+}
+
+pod_spec(obj) = spec {
+  obj.kind != "Pod"
+  spec := obj.spec.template.spec
+}
+
+violation[{"msg": msg}] {
+  obj := input.review.object
+  spec := pod_spec(obj)
+  req := input.parameters.requirements[_]
+  not satisfied(spec, req)
+  msg := sprintf("%v %v must only run on nodes with %v %v %v (lead-net-affinity)", [obj.kind, obj.metadata.name, req.key, req.operator, req.values])
+}
+
+satisfied(spec, req) {
+  req.operator == "In"
+  req.values[_] == spec.nodeSelector[req.key]
+}
+
+satisfied(spec, req) {
+  terms := spec.affinity.nodeAffinity.requiredDuringSchedulingIgnoredDuringExecution.nodeSelectorTerms
+  count(terms) > 0
+  not unrestricted_term(terms, req)
+}
+
+unrestricted_term(terms, req) {
+  t := terms[_]
+  not restricts(t, req)
+}
+
+restricts(t, req) {
+  req.operator == "In"
+  e := t.matchExpressions[_]
+  e.key == req.key
+  e.operator == "In"
+  not value_outside(e.values, req.values)
+}
+
+restricts(t, req) {
+  req.operator == "NotIn"
+  e := t.matchExpressions[_]
+  e.key == req.key
+  e.operator == "NotIn"
+  not value_outside(req.values, e.values)
+}
+
+# value_outside holds if some value of vs is not in allowed.
+value_outside(vs, allowed) {
+  v := vs[_]
+  not in_list(v, allowed)
+}
+
+in_list(v, list) {
+  list[_] == v
+}
+`
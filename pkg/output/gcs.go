@@ -0,0 +1,142 @@
+package output
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"lead-net-affinity/pkg/config"
+)
+
+// GCSSink uploads every file to a Google Cloud Storage bucket with the
+// JSON API's simple upload.
+type GCSSink struct {
+	Bucket   string
+	Prefix   string
+	Endpoint string // default https://storage.googleapis.com
+	Tokens   TokenSource
+	Client   *http.Client
+}
+
+// TokenSource returns an OAuth2 access token.
+type TokenSource interface {
+	Token(ctx context.Context) (string, error)
+}
+
+// NewGCSSink builds a GCSSink for cfg. Without a token file it uses the
+// metadata server, which serves the workload identity's token on GKE.
+func NewGCSSink(cfg config.GCSOutput) *GCSSink {
+	var tokens TokenSource = &MetadataTokenSource{}
+	if cfg.TokenFile != "" {
+		tokens = FileTokenSource(cfg.TokenFile)
+	}
+	endpoint := strings.TrimRight(cfg.Endpoint, "/")
+	if endpoint == "" {
+		endpoint = "https://storage.googleapis.com"
+	}
+	return &GCSSink{Bucket: cfg.Bucket, Prefix: cfg.Prefix, Endpoint: endpoint, Tokens: tokens}
+}
+
+func (s *GCSSink) String() string { return "gs://" + s.Bucket + "/" + s.Prefix }
+
+func (s *GCSSink) Write(ctx context.Context, files map[string][]byte) error {
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	token, err := s.Tokens.Token(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", s, err)
+	}
+	for _, name := range sortedNames(files) {
+		u := s.Endpoint + "/upload/storage/v1/b/" + url.PathEscape(s.Bucket) +
+			"/o?uploadType=media&name=" + url.QueryEscape(s.Prefix+name)
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(files[name]))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/yaml")
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode/100 != 2 {
+			return fmt.Errorf("upload gs://%s/%s%s: unexpected status %s: %s", s.Bucket, s.Prefix, name, resp.Status, readSnippet(resp))
+		}
+		resp.Body.Close()
+	}
+	return nil
+}
+
+// FileTokenSource reads the token from a file on every call, so a rotated
+// Secret applies at once.
+type FileTokenSource string
+
+func (f FileTokenSource) Token(context.Context) (string, error) {
+	b, err := os.ReadFile(string(f))
+	if err != nil {
+		return "", fmt.Errorf("read token: %w", err)
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// MetadataTokenSource fetches the default service account's token from
+// the GCE/GKE metadata server (GCE_METADATA_HOST overrides its address)
+// and caches it until shortly before it expires.
+type MetadataTokenSource struct {
+	Client *http.Client
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+func (m *MetadataTokenSource) Token(ctx context.Context) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.token != "" && time.Until(m.expires) > time.Minute {
+		return m.token, nil
+	}
+	host := os.Getenv("GCE_METADATA_HOST")
+	if host == "" {
+		host = "metadata.google.internal"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		"http://"+host+"/computeMetadata/v1/instance/service-accounts/default/token", nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	client := m.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("metadata token: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("metadata token: unexpected status %s: %s", resp.Status, readSnippet(resp))
+	}
+	var out struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", fmt.Errorf("metadata token: %w", err)
+	}
+	if out.AccessToken == "" {
+		return "", fmt.Errorf("metadata token: empty access_token")
+	}
+	m.token, m.expires = out.AccessToken, time.Now().Add(time.Duration(out.ExpiresIn)*time.Second)
+	return m.token, nil
+}
@@ -0,0 +1,179 @@
+package output
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+	appsv1 "k8s.io/api/apps/v1"
+	sigsyaml "sigs.k8s.io/yaml"
+
+	"lead-net-affinity/pkg/kube"
+)
+
+// docSeparator matches the "---" lines between YAML documents, with the
+// trailing comment Helm sometimes puts there.
+var docSeparator = regexp.MustCompile(`(?m)^---[ \t]*(#.*)?\n`)
+
+// mergeBaseManifest sets spec.template.spec.affinity of d in a user-supplied
+// manifest, keeping everything else as written. The manifest may hold
+// several documents, e.g. a rendered Helm chart: only the Deployment (or
+// Argo Rollout, see kube.IsRollout) named like d is rewritten, or failing
+// that the only document that is more than comments; every other document
+// passes through byte for byte. Line endings, indentation width, key order
+// and comments of the rewritten document are kept.
+func mergeBaseManifest(d *appsv1.Deployment, raw []byte) ([]byte, error) {
+	crlf := bytes.Contains(raw, []byte("\r\n"))
+	if crlf {
+		raw = bytes.ReplaceAll(raw, []byte("\r\n"), []byte("\n"))
+	}
+
+	// Documents and the separators in between, in order.
+	var docs, seps [][]byte
+	last := 0
+	for _, loc := range docSeparator.FindAllIndex(raw, -1) {
+		docs = append(docs, raw[last:loc[0]])
+		seps = append(seps, raw[loc[0]:loc[1]])
+		last = loc[1]
+	}
+	docs = append(docs, raw[last:])
+
+	kind := "Deployment"
+	if kube.IsRollout(d) {
+		kind = kube.RolloutKind
+	}
+	target := -1
+	var objects []int // documents that are more than comments
+	for i, doc := range docs {
+		var meta struct {
+			Kind     string `yaml:"kind"`
+			Metadata struct {
+				Name string `yaml:"name"`
+			} `yaml:"metadata"`
+		}
+		var n yaml.Node
+		if err := yaml.Unmarshal(doc, &n); err != nil {
+			return nil, fmt.Errorf("document %d: %w", i+1, err)
+		}
+		if len(n.Content) == 0 {
+			continue
+		}
+		objects = append(objects, i)
+		if err := n.Decode(&meta); err == nil && meta.Kind == kind && meta.Metadata.Name == d.Name {
+			target = i
+		}
+	}
+	if target < 0 && len(objects) == 1 {
+		target = objects[0]
+	}
+	if target < 0 {
+		return nil, fmt.Errorf("no %s %q among %d documents", kind, d.Name, len(objects))
+	}
+
+	doc, err := setAffinity(docs[target], d)
+	if err != nil {
+		return nil, err
+	}
+	docs[target] = doc
+
+	var out bytes.Buffer
+	for i, doc := range docs {
+		out.Write(doc)
+		if i < len(seps) {
+			out.Write(seps[i])
+		}
+	}
+	if crlf {
+		return bytes.ReplaceAll(out.Bytes(), []byte("\n"), []byte("\r\n")), nil
+	}
+	return out.Bytes(), nil
+}
+
+// setAffinity rewrites spec.template.spec.affinity of one document,
+// re-encoding it with the indentation it was written with.
+func setAffinity(doc []byte, d *appsv1.Deployment) ([]byte, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(doc, &root); err != nil {
+		return nil, err
+	}
+	if len(root.Content) == 0 || root.Content[0].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("deployment %s: manifest is not a mapping", d.Name)
+	}
+
+	var aff *yaml.Node
+	if d.Spec.Template.Spec.Affinity != nil {
+		b, err := sigsyaml.Marshal(d.Spec.Template.Spec.Affinity)
+		if err != nil {
+			return nil, err
+		}
+		var n yaml.Node
+		if err := yaml.Unmarshal(b, &n); err != nil {
+			return nil, err
+		}
+		aff = n.Content[0]
+	}
+
+	podSpec := root.Content[0]
+	for _, key := range []string{"spec", "template", "spec"} {
+		podSpec = childMapping(podSpec, key)
+	}
+	setMappingValue(podSpec, "affinity", aff)
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(indentOf(doc))
+	if err := enc.Encode(&root); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// childMapping returns the mapping under key in m, adding one (or
+// replacing a value that is no mapping) if needed.
+func childMapping(m *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			if m.Content[i+1].Kind != yaml.MappingNode {
+				m.Content[i+1] = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+			}
+			return m.Content[i+1]
+		}
+	}
+	v := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	m.Content = append(m.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, v)
+	return v
+}
+
+// setMappingValue replaces (or appends) key in m; a nil v removes it.
+func setMappingValue(m *yaml.Node, key string, v *yaml.Node) {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			if v == nil {
+				m.Content = append(m.Content[:i], m.Content[i+2:]...)
+			} else {
+				m.Content[i+1] = v
+			}
+			return
+		}
+	}
+	if v != nil {
+		m.Content = append(m.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, v)
+	}
+}
+
+// indentOf guesses a document's indentation from its first nested key
+// (2 if it has none).
+func indentOf(doc []byte) int {
+	for _, line := range strings.Split(string(doc), "\n") {
+		trimmed := strings.TrimLeft(line, " ")
+		if n := len(line) - len(trimmed); n > 0 && trimmed != "" && !strings.HasPrefix(trimmed, "#") && !strings.HasPrefix(trimmed, "- ") {
+			return n
+		}
+	}
+	return 2
+}
@@ -0,0 +1,325 @@
+package output
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"lead-net-affinity/pkg/config"
+)
+
+// Media types of the pushed artifact, as Flux's OCIRepository expects
+// them.
+const (
+	OCIManifestMediaType = "application/vnd.oci.image.manifest.v1+json"
+	OCIConfigMediaType   = "application/vnd.cncf.flux.config.v1+json"
+	OCIContentMediaType  = "application/vnd.cncf.flux.content.v1.tar+gzip"
+)
+
+// OCISink pushes all files as one tar+gzip layer of an OCI artifact to
+// Registry/Name:Tag. The layer is reproducible, so an unchanged export
+// yields the same manifest digest and consumers see no new revision.
+type OCISink struct {
+	Registry     string
+	Name         string
+	Tag          string
+	Username     string
+	PasswordFile string
+	PlainHTTP    bool
+	Client       *http.Client
+
+	mu    sync.Mutex
+	token string // bearer token from the registry's token service
+}
+
+// NewOCISink builds an OCISink for cfg.
+func NewOCISink(cfg config.OCIOutput) (*OCISink, error) {
+	registry, name, ok := strings.Cut(cfg.Repository, "/")
+	if !ok || registry == "" || name == "" {
+		return nil, fmt.Errorf("oci repository %q: expected <registry>/<name>", cfg.Repository)
+	}
+	return &OCISink{
+		Registry:     registry,
+		Name:         name,
+		Tag:          cfg.TagOrDefault(),
+		Username:     cfg.Username,
+		PasswordFile: cfg.PasswordFile,
+		PlainHTTP:    cfg.PlainHTTP,
+	}, nil
+}
+
+func (s *OCISink) String() string { return "oci://" + s.Registry + "/" + s.Name + ":" + s.Tag }
+
+func (s *OCISink) Write(ctx context.Context, files map[string][]byte) error {
+	layer, err := tarGzip(files)
+	if err != nil {
+		return err
+	}
+	cfgBlob := []byte("{}")
+	for _, blob := range [][]byte{cfgBlob, layer} {
+		if err := s.pushBlob(ctx, blob); err != nil {
+			return fmt.Errorf("%s: %w", s, err)
+		}
+	}
+	manifest, err := json.Marshal(map[string]any{
+		"schemaVersion": 2,
+		"mediaType":     OCIManifestMediaType,
+		"config":        descriptor(OCIConfigMediaType, cfgBlob),
+		"layers":        []any{descriptor(OCIContentMediaType, layer)},
+	})
+	if err != nil {
+		return err
+	}
+	resp, err := s.do(ctx, http.MethodPut, s.url("/manifests/"+s.Tag), OCIManifestMediaType, manifest)
+	if err != nil {
+		return fmt.Errorf("%s: %w", s, err)
+	}
+	if resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("%s: push manifest: unexpected status %s: %s", s, resp.Status, readSnippet(resp))
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// pushBlob uploads blob unless the registry has it: a POST opens an
+// upload session and a PUT to its location with the digest completes it.
+func (s *OCISink) pushBlob(ctx context.Context, blob []byte) error {
+	digest := ociDigest(blob)
+	resp, err := s.do(ctx, http.MethodHead, s.url("/blobs/"+digest), "", nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	resp, err = s.do(ctx, http.MethodPost, s.url("/blobs/uploads/"), "", nil)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusAccepted {
+		return fmt.Errorf("start upload: unexpected status %s: %s", resp.Status, readSnippet(resp))
+	}
+	resp.Body.Close()
+	loc, err := resp.Request.URL.Parse(resp.Header.Get("Location"))
+	if err != nil || resp.Header.Get("Location") == "" {
+		return fmt.Errorf("start upload: bad Location %q", resp.Header.Get("Location"))
+	}
+	q := loc.Query()
+	q.Set("digest", digest)
+	loc.RawQuery = q.Encode()
+
+	resp, err = s.do(ctx, http.MethodPut, loc.String(), "application/octet-stream", blob)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("upload %s: unexpected status %s: %s", digest, resp.Status, readSnippet(resp))
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (s *OCISink) url(path string) string {
+	scheme := "https"
+	if s.PlainHTTP {
+		scheme = "http"
+	}
+	return scheme + "://" + s.Registry + "/v2/" + s.Name + path
+}
+
+// do sends one request. On a 401 it authenticates as the challenge asks,
+// with basic auth or a bearer token from the registry's token service,
+// and retries once.
+func (s *OCISink) do(ctx context.Context, method, u, contentType string, body []byte) (*http.Response, error) {
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	send := func() (*http.Response, error) {
+		req, err := http.NewRequestWithContext(ctx, method, u, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		if err := s.authorize(req); err != nil {
+			return nil, err
+		}
+		return client.Do(req)
+	}
+	resp, err := send()
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	challenge := resp.Header.Get("Www-Authenticate")
+	resp.Body.Close()
+	if err := s.login(ctx, client, challenge); err != nil {
+		return nil, err
+	}
+	return send()
+}
+
+func (s *OCISink) authorize(req *http.Request) error {
+	s.mu.Lock()
+	token := s.token
+	s.mu.Unlock()
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+		return nil
+	}
+	if s.Username == "" {
+		return nil
+	}
+	password, err := s.password()
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(s.Username, password)
+	return nil
+}
+
+// login answers a Bearer challenge by fetching a token for the challenged
+// scope. Basic challenges need nothing: authorize always sends the
+// credentials it has.
+func (s *OCISink) login(ctx context.Context, client *http.Client, challenge string) error {
+	scheme, params := parseChallenge(challenge)
+	if !strings.EqualFold(scheme, "bearer") || params["realm"] == "" {
+		return fmt.Errorf("registry %s: unauthorized", s.Registry)
+	}
+	u, err := url.Parse(params["realm"])
+	if err != nil {
+		return fmt.Errorf("registry %s: bad token realm: %w", s.Registry, err)
+	}
+	q := u.Query()
+	if params["service"] != "" {
+		q.Set("service", params["service"])
+	}
+	scope := params["scope"]
+	if scope == "" {
+		scope = "repository:" + s.Name + ":pull,push"
+	}
+	q.Set("scope", scope)
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	if s.Username != "" {
+		password, err := s.password()
+		if err != nil {
+			return err
+		}
+		req.SetBasicAuth(s.Username, password)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("registry token: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("registry token: unexpected status %s: %s", resp.Status, readSnippet(resp))
+	}
+	var out struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return fmt.Errorf("registry token: %w", err)
+	}
+	token := out.Token
+	if token == "" {
+		token = out.AccessToken
+	}
+	if token == "" {
+		return fmt.Errorf("registry token: empty token")
+	}
+	s.mu.Lock()
+	s.token = token
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *OCISink) password() (string, error) {
+	if s.PasswordFile == "" {
+		return "", nil
+	}
+	b, err := os.ReadFile(s.PasswordFile)
+	if err != nil {
+		return "", fmt.Errorf("read registry password: %w", err)
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// parseChallenge splits a WWW-Authenticate value such as
+// `Bearer realm="https://r/token",service="r",scope="repository:x:pull,push"`.
+func parseChallenge(h string) (string, map[string]string) {
+	scheme, rest, _ := strings.Cut(strings.TrimSpace(h), " ")
+	params := make(map[string]string)
+	for rest = strings.TrimSpace(rest); rest != ""; {
+		key, after, ok := strings.Cut(rest, "=")
+		if !ok {
+			break
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		var val string
+		if strings.HasPrefix(after, `"`) {
+			end := strings.Index(after[1:], `"`)
+			if end < 0 {
+				break
+			}
+			val, rest = after[1:end+1], after[end+2:]
+		} else {
+			val, rest, _ = strings.Cut(after, ",")
+		}
+		params[key] = val
+		rest = strings.TrimLeft(rest, ", ")
+	}
+	return scheme, params
+}
+
+// tarGzip packs files into a reproducible tar.gz: sorted names, no
+// timestamps or owners.
+func tarGzip(files map[string][]byte) ([]byte, error) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, name := range sortedNames(files) {
+		hdr := &tar.Header{Name: name, Mode: 0o644, Size: int64(len(files[name])), Typeflag: tar.TypeReg, Format: tar.FormatPAX}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return nil, err
+		}
+		if _, err := tw.Write(files[name]); err != nil {
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func descriptor(mediaType string, blob []byte) map[string]any {
+	return map[string]any{"mediaType": mediaType, "digest": ociDigest(blob), "size": len(blob)}
+}
+
+func ociDigest(b []byte) string {
+	sum := sha256.Sum256(b)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
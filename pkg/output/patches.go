@@ -0,0 +1,60 @@
+package output
+
+import (
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+
+	"lead-net-affinity/pkg/kube"
+)
+
+// affinityPatch is the minimal Deployment carrying only the generated
+// affinity; applied as a strategic merge patch (a merge patch for an Argo
+// Rollout) it touches nothing else.
+type affinityPatch struct {
+	metav1.TypeMeta `json:",inline"`
+	Metadata        patchMeta `json:"metadata"`
+	Spec            patchSpec `json:"spec"`
+}
+
+type patchMeta struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"`
+}
+
+type patchSpec struct {
+	Template patchTemplate `json:"template"`
+}
+
+type patchTemplate struct {
+	Spec patchPodSpec `json:"spec"`
+}
+
+type patchPodSpec struct {
+	Affinity *corev1.Affinity `json:"affinity"`
+}
+
+// AffinityPatches renders one "<namespace>.<name>.yaml" patch per deployment.
+func AffinityPatches(deploys []*appsv1.Deployment) (map[string][]byte, error) {
+	files := make(map[string][]byte, len(deploys))
+	for _, d := range deploys {
+		tm := metav1.TypeMeta{APIVersion: "apps/v1", Kind: "Deployment"}
+		if kube.IsRollout(d) {
+			tm = d.TypeMeta
+		}
+		p := affinityPatch{
+			TypeMeta: tm,
+			Metadata: patchMeta{Name: d.Name, Namespace: d.Namespace},
+			Spec:     patchSpec{Template: patchTemplate{Spec: patchPodSpec{Affinity: d.Spec.Template.Spec.Affinity}}},
+		}
+		b, err := yaml.Marshal(p)
+		if err != nil {
+			return nil, fmt.Errorf("render patch for %s/%s: %w", d.Namespace, d.Name, err)
+		}
+		files[fileName(d)] = b
+	}
+	return files, nil
+}
@@ -0,0 +1,298 @@
+package output
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"lead-net-affinity/pkg/config"
+)
+
+// S3Sink PUTs every file to an S3 bucket (or an S3-compatible server),
+// signing requests with AWS Signature Version 4.
+type S3Sink struct {
+	Bucket   string
+	Prefix   string
+	Region   string
+	Endpoint string // path-style base URL; empty means AWS virtual-hosted
+	Creds    AWSCredentialsProvider
+	Client   *http.Client
+}
+
+// NewS3Sink builds an S3Sink for cfg with credentials from the environment.
+func NewS3Sink(cfg config.S3Output) (*S3Sink, error) {
+	region := cfg.Region
+	if region == "" {
+		region = os.Getenv("AWS_REGION")
+	}
+	if region == "" {
+		return nil, fmt.Errorf("s3 bucket %q: no region (set output.s3.region or AWS_REGION)", cfg.Bucket)
+	}
+	return &S3Sink{
+		Bucket:   cfg.Bucket,
+		Prefix:   cfg.Prefix,
+		Region:   region,
+		Endpoint: strings.TrimRight(cfg.Endpoint, "/"),
+		Creds:    &EnvAWSCredentials{Region: region},
+	}, nil
+}
+
+func (s *S3Sink) String() string { return "s3://" + s.Bucket + "/" + s.Prefix }
+
+func (s *S3Sink) Write(ctx context.Context, files map[string][]byte) error {
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	creds, err := s.Creds.Credentials(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", s, err)
+	}
+	for _, name := range sortedNames(files) {
+		u := s.objectURL(s.Prefix + name)
+		req, err := http.NewRequestWithContext(ctx, http.MethodPut, u, bytes.NewReader(files[name]))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/yaml")
+		SignAWSV4(req, files[name], creds, s.Region, "s3", time.Now())
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode/100 != 2 {
+			return fmt.Errorf("PUT %s: unexpected status %s: %s", u, resp.Status, readSnippet(resp))
+		}
+		resp.Body.Close()
+	}
+	return nil
+}
+
+func (s *S3Sink) objectURL(key string) string {
+	if s.Endpoint != "" {
+		return s.Endpoint + "/" + awsURIEscape(s.Bucket, false) + "/" + awsURIEscape(key, false)
+	}
+	return "https://" + s.Bucket + ".s3." + s.Region + ".amazonaws.com/" + awsURIEscape(key, false)
+}
+
+// AWSCredentials sign requests; SessionToken is set for temporary ones.
+type AWSCredentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	Expires         time.Time // zero for long-lived keys
+}
+
+// AWSCredentialsProvider returns credentials valid for at least the next
+// request.
+type AWSCredentialsProvider interface {
+	Credentials(ctx context.Context) (AWSCredentials, error)
+}
+
+// EnvAWSCredentials reads static keys from AWS_ACCESS_KEY_ID,
+// AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN or, without them, exchanges
+// the web identity token in AWS_WEB_IDENTITY_TOKEN_FILE for AWS_ROLE_ARN
+// at STS (IRSA). STS credentials are cached until shortly before they
+// expire. AWS_ENDPOINT_URL_STS overrides the regional STS endpoint.
+type EnvAWSCredentials struct {
+	Region string
+	Client *http.Client
+
+	mu     sync.Mutex
+	cached AWSCredentials
+}
+
+func (e *EnvAWSCredentials) Credentials(ctx context.Context) (AWSCredentials, error) {
+	if id := os.Getenv("AWS_ACCESS_KEY_ID"); id != "" {
+		return AWSCredentials{
+			AccessKeyID:     id,
+			SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		}, nil
+	}
+	role, tokenFile := os.Getenv("AWS_ROLE_ARN"), os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE")
+	if role == "" || tokenFile == "" {
+		return AWSCredentials{}, fmt.Errorf("no AWS credentials: set AWS_ACCESS_KEY_ID or AWS_ROLE_ARN and AWS_WEB_IDENTITY_TOKEN_FILE")
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.cached.AccessKeyID != "" && time.Until(e.cached.Expires) > 5*time.Minute {
+		return e.cached, nil
+	}
+	token, err := os.ReadFile(tokenFile)
+	if err != nil {
+		return AWSCredentials{}, fmt.Errorf("read web identity token: %w", err)
+	}
+	creds, err := e.assumeRole(ctx, role, strings.TrimSpace(string(token)))
+	if err != nil {
+		return AWSCredentials{}, err
+	}
+	e.cached = creds
+	return creds, nil
+}
+
+// assumeRole calls STS AssumeRoleWithWebIdentity, which needs no signature.
+func (e *EnvAWSCredentials) assumeRole(ctx context.Context, role, token string) (AWSCredentials, error) {
+	endpoint := os.Getenv("AWS_ENDPOINT_URL_STS")
+	if endpoint == "" {
+		endpoint = "https://sts." + e.Region + ".amazonaws.com"
+	}
+	session := os.Getenv("AWS_ROLE_SESSION_NAME")
+	if session == "" {
+		session = "lead-net-affinity"
+	}
+	form := url.Values{
+		"Action":           {"AssumeRoleWithWebIdentity"},
+		"Version":          {"2011-06-15"},
+		"RoleArn":          {role},
+		"RoleSessionName":  {session},
+		"WebIdentityToken": {token},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(endpoint, "/")+"/", strings.NewReader(form.Encode()))
+	if err != nil {
+		return AWSCredentials{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	client := e.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return AWSCredentials{}, fmt.Errorf("sts: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return AWSCredentials{}, fmt.Errorf("sts: unexpected status %s: %s", resp.Status, readSnippet(resp))
+	}
+	var out struct {
+		Credentials struct {
+			AccessKeyID     string    `xml:"AccessKeyId"`
+			SecretAccessKey string    `xml:"SecretAccessKey"`
+			SessionToken    string    `xml:"SessionToken"`
+			Expiration      time.Time `xml:"Expiration"`
+		} `xml:"AssumeRoleWithWebIdentityResult>Credentials"`
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return AWSCredentials{}, fmt.Errorf("sts: decode response: %w", err)
+	}
+	c := out.Credentials
+	if c.AccessKeyID == "" {
+		return AWSCredentials{}, fmt.Errorf("sts: response has no credentials")
+	}
+	return AWSCredentials{AccessKeyID: c.AccessKeyID, SecretAccessKey: c.SecretAccessKey, SessionToken: c.SessionToken, Expires: c.Expiration}, nil
+}
+
+// SignAWSV4 adds X-Amz-Date, X-Amz-Content-Sha256, X-Amz-Security-Token (for
+// temporary credentials) and the Signature Version 4 Authorization header
+// to req. The host and every header already set on req are signed.
+func SignAWSV4(req *http.Request, payload []byte, creds AWSCredentials, region, service string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256Hex(payload)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		headers[strings.ToLower(k)] = strings.Join(strings.Fields(strings.Join(v, ",")), " ")
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		awsURIEscape(req.URL.Path, false),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+creds.SecretAccessKey), date)
+	for _, part := range []string{region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+creds.AccessKeyID+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+func canonicalQuery(q url.Values) string {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		vals := append([]string(nil), q[k]...)
+		sort.Strings(vals)
+		for _, v := range vals {
+			parts = append(parts, awsURIEscape(k, true)+"="+awsURIEscape(v, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// awsURIEscape percent-encodes everything but the unreserved characters,
+// and "/" unless encodeSlash, as SigV4 requires.
+func awsURIEscape(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// readSnippet returns the start of an error response body and closes it.
+func readSnippet(resp *http.Response) string {
+	defer resp.Body.Close()
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return strings.TrimSpace(string(b))
+}
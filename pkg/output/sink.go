@@ -0,0 +1,167 @@
+// Package output exports the affinity the controller generates, so it can be
+// consumed by GitOps tooling (Flux/Argo kustomize patches) instead of, or in
+// addition to, being written into the live Deployments.
+package output
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"lead-net-affinity/pkg/config"
+)
+
+// Sink receives one set of generated files per reconcile, keyed by file name.
+type Sink interface {
+	String() string
+	Write(ctx context.Context, files map[string][]byte) error
+}
+
+// DirSink writes every file into a local directory.
+type DirSink struct {
+	Dir string
+}
+
+func (s *DirSink) String() string { return "dir:" + s.Dir }
+
+func (s *DirSink) Write(_ context.Context, files map[string][]byte) error {
+	if err := os.MkdirAll(s.Dir, 0o755); err != nil {
+		return err
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(s.Dir, name), data, 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ConfigMapWriter is implemented by kube.Client.
+type ConfigMapWriter interface {
+	ApplyConfigMap(ctx context.Context, namespace, name string, data map[string]string) error
+}
+
+// ConfigMapSink stores all files as keys of one ConfigMap.
+type ConfigMapSink struct {
+	Client    ConfigMapWriter
+	Namespace string
+	Name      string
+}
+
+// NewConfigMapSink builds a ConfigMapSink for ref ("namespace/name").
+func NewConfigMapSink(ref string, cm ConfigMapWriter) (*ConfigMapSink, error) {
+	ns, name, ok := strings.Cut(ref, "/")
+	switch {
+	case !ok || ns == "" || name == "":
+		return nil, fmt.Errorf("configMap %q: expected namespace/name", ref)
+	case cm == nil:
+		return nil, fmt.Errorf("configMap %q: no Kubernetes client", ref)
+	}
+	return &ConfigMapSink{Client: cm, Namespace: ns, Name: name}, nil
+}
+
+func (s *ConfigMapSink) String() string { return "configmap:" + s.Namespace + "/" + s.Name }
+
+func (s *ConfigMapSink) Write(ctx context.Context, files map[string][]byte) error {
+	data := make(map[string]string, len(files))
+	for name, b := range files {
+		data[name] = string(b)
+	}
+	return s.Client.ApplyConfigMap(ctx, s.Namespace, s.Name, data)
+}
+
+// HTTPSink PUTs every file to BaseURL/<file>, for artifact servers with a
+// plain PUT API. Buckets and registries have their own sinks: S3Sink,
+// GCSSink and OCISink.
+type HTTPSink struct {
+	BaseURL string
+	Headers map[string]string
+	Client  *http.Client
+}
+
+func (s *HTTPSink) String() string { return "http:" + s.BaseURL }
+
+func (s *HTTPSink) Write(ctx context.Context, files map[string][]byte) error {
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	for _, name := range sortedNames(files) {
+		url := strings.TrimRight(s.BaseURL, "/") + "/" + name
+		req, err := http.NewRequestWithContext(ctx, http.MethodPut, url, bytes.NewReader(files[name]))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/yaml")
+		for k, v := range s.Headers {
+			req.Header.Set(k, v)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode/100 != 2 {
+			return fmt.Errorf("PUT %s: unexpected status %s", url, resp.Status)
+		}
+	}
+	return nil
+}
+
+// SinksFromConfig builds the sinks enabled in cfg. cm may be nil when no
+// Kubernetes client is available; the ConfigMap sink is skipped then. A
+// sink whose settings are unusable is an error rather than left out, so a
+// misconfigured export fails at startup instead of never happening.
+func SinksFromConfig(cfg config.OutputConfig, cm ConfigMapWriter) ([]Sink, error) {
+	var sinks []Sink
+	if cfg.Directory != "" {
+		sinks = append(sinks, &DirSink{Dir: cfg.Directory})
+	}
+	if cfg.ConfigMap != "" {
+		if cm == nil {
+			log.Printf("[lead-net][output] skipping configMap %s: no Kubernetes client", cfg.ConfigMap)
+		} else {
+			s, err := NewConfigMapSink(cfg.ConfigMap, cm)
+			if err != nil {
+				return nil, err
+			}
+			sinks = append(sinks, s)
+		}
+	}
+	if cfg.HTTPURL != "" {
+		sinks = append(sinks, &HTTPSink{BaseURL: cfg.HTTPURL, Headers: cfg.HTTPHeaders})
+	}
+	if cfg.S3.Bucket != "" {
+		s, err := NewS3Sink(cfg.S3)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, s)
+	}
+	if cfg.GCS.Bucket != "" {
+		sinks = append(sinks, NewGCSSink(cfg.GCS))
+	}
+	if cfg.OCI.Repository != "" {
+		s, err := NewOCISink(cfg.OCI)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, s)
+	}
+	return sinks, nil
+}
+
+func sortedNames(files map[string][]byte) []string {
+	names := make([]string, 0, len(files))
+	for n := range files {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
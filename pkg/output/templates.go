@@ -0,0 +1,160 @@
+package output
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	appsv1 "k8s.io/api/apps/v1"
+	"sigs.k8s.io/yaml"
+
+	"lead-net-affinity/pkg/config"
+	"lead-net-affinity/pkg/graph"
+	"lead-net-affinity/pkg/kube"
+)
+
+// TemplateData is what a per-deployment Go template is rendered with.
+// LEAD contributes placement and the service's known ports; everything else
+// (image, probes, env) comes from the template itself.
+type TemplateData struct {
+	Name      string
+	Namespace string
+	Service   string       // graph service, see kube.ServiceIdentity
+	Affinity  string       // generated affinity as YAML, see the indent func
+	Ports     []graph.Port // declared or discovered; empty if unknown
+}
+
+// Templates locates the per-deployment templates and base manifests.
+type Templates struct {
+	Dir string
+
+	// Include and Exclude select the files of Dir that may be used, see
+	// config.OutputConfig.Allows.
+	Include []string
+	Exclude []string
+
+	// Files maps a graph service to its file in Dir, replacing the
+	// <name>.yaml(.tmpl) lookup.
+	Files map[string]string
+}
+
+// TemplatesFor returns the templates of an output config.
+func TemplatesFor(o config.OutputConfig) Templates {
+	return Templates{Dir: o.TemplateDir, Include: o.Include, Exclude: o.Exclude, Files: o.Files}
+}
+
+// candidates are the files of t.Dir to try for d, in order.
+func (t Templates) candidates(d *appsv1.Deployment, svc graph.NodeID) []string {
+	if f, ok := t.Files[string(svc)]; ok && svc != "" {
+		return []string{f}
+	}
+	return []string{d.Name + ".yaml.tmpl", d.Name + ".yaml"}
+}
+
+func (t Templates) allows(file string) bool {
+	return config.OutputConfig{Include: t.Include, Exclude: t.Exclude}.Allows(file)
+}
+
+// Render produces one file per deployment. For a deployment named <name>,
+// t.Dir is searched for:
+//
+//	<name>.yaml.tmpl  Go template rendered with TemplateData
+//	<name>.yaml       base manifest; only spec.template.spec.affinity is replaced
+//
+// (a base manifest may be multi-document, e.g. helm template output; see
+// mergeBaseManifest) or the service's file in t.Files, and a bare affinity patch is emitted
+// when none exists or is allowed (or t.Dir is empty). id fills in
+// TemplateData.Service and ports, per graph service, TemplateData.Ports, so
+// a template can render the matching Service:
+//
+//	ports:
+//	{{- range .Ports }}
+//	- name: {{ .Name }}
+//	  port: {{ .Port }}
+//	  targetPort: {{ .Target }}
+//	  protocol: {{ .Transport }}
+//	{{- end }}
+func Render(deploys []*appsv1.Deployment, t Templates, id *kube.ServiceIdentity, ports map[graph.NodeID][]graph.Port) (map[string][]byte, error) {
+	files := make(map[string][]byte, len(deploys))
+	var bare []*appsv1.Deployment
+	for _, d := range deploys {
+		out, err := renderFromDir(d, t, id, ports)
+		if err != nil {
+			return nil, fmt.Errorf("render %s/%s: %w", d.Namespace, d.Name, err)
+		}
+		if out == nil {
+			bare = append(bare, d)
+			continue
+		}
+		files[fileName(d)] = out
+	}
+
+	patches, err := AffinityPatches(bare)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range patches {
+		files[k] = v
+	}
+	return files, nil
+}
+
+func renderFromDir(d *appsv1.Deployment, t Templates, id *kube.ServiceIdentity, ports map[graph.NodeID][]graph.Port) ([]byte, error) {
+	if t.Dir == "" {
+		return nil, nil
+	}
+	svc := id.DeploymentService(d)
+	for _, f := range t.candidates(d, svc) {
+		if !t.allows(f) {
+			continue
+		}
+		raw, err := os.ReadFile(filepath.Join(t.Dir, f))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		if strings.HasSuffix(f, ".tmpl") {
+			return renderTemplate(d, string(raw), string(svc), ports[svc])
+		}
+		return mergeBaseManifest(d, raw)
+	}
+	return nil, nil
+}
+
+func renderTemplate(d *appsv1.Deployment, text, service string, ports []graph.Port) ([]byte, error) {
+	aff, err := yaml.Marshal(d.Spec.Template.Spec.Affinity)
+	if err != nil {
+		return nil, err
+	}
+	tmpl, err := template.New(d.Name).
+		Option("missingkey=error").
+		Funcs(template.FuncMap{"indent": indent}).
+		Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, TemplateData{
+		Name:      d.Name,
+		Namespace: d.Namespace,
+		Service:   service,
+		Affinity:  strings.TrimSpace(string(aff)),
+		Ports:     ports,
+	})
+	return buf.Bytes(), err
+}
+
+// indent prefixes every line of s with n spaces (for nesting Affinity).
+func indent(n int, s string) string {
+	pad := strings.Repeat(" ", n)
+	return pad + strings.ReplaceAll(s, "\n", "\n"+pad)
+}
+
+func fileName(d *appsv1.Deployment) string {
+	return fmt.Sprintf("%s.%s.yaml", d.Namespace, d.Name)
+}
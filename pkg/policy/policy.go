@@ -0,0 +1,169 @@
+// Package policy evaluates the affinity rules and evictions the controller
+// proposes against organizational policy compiled to WebAssembly (e.g.
+// TinyGo, Rust, or Rego wrapped as a WASI command). Modules run in an
+// external WASI runtime with no filesystem, network or environment access:
+// they read an Input as JSON on stdin and write a Decision as JSON to
+// stdout.
+package policy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Kinds of proposed actions.
+const (
+	KindAffinity = "affinity"
+	KindEviction = "eviction"
+)
+
+// Results of a Decision.
+const (
+	Allow  = "allow"
+	Deny   = "deny"
+	Mutate = "mutate"
+)
+
+// DefaultTimeout bounds an evaluation when none is configured.
+const DefaultTimeout = 2 * time.Second
+
+// DefaultRuntime runs a WASI module; the module path is appended.
+var DefaultRuntime = []string{"wasmtime", "run"}
+
+// maxOutput bounds what a module may write to stdout.
+const maxOutput = 1 << 20
+
+// Input is a proposed action: new affinity for a deployment, or the
+// eviction of a pod.
+type Input struct {
+	Kind      string            `json:"kind"`
+	Service   string            `json:"service,omitempty"`
+	Namespace string            `json:"namespace"`
+	Name      string            `json:"name"` // the deployment or pod
+	Labels    map[string]string `json:"labels,omitempty"`
+	Affinity  *corev1.Affinity  `json:"affinity,omitempty"` // affinity: the proposed rules
+	Current   *corev1.Affinity  `json:"current,omitempty"`  // affinity: the rules in the cluster
+	Node      string            `json:"node,omitempty"`     // eviction: the node the pod runs on
+	Reason    string            `json:"reason,omitempty"`
+}
+
+// Decision is a policy's verdict. Mutate (affinity only) replaces the
+// proposed rules with Affinity.
+type Decision struct {
+	Result   string           `json:"result"`
+	Reason   string           `json:"reason,omitempty"`
+	Affinity *corev1.Affinity `json:"affinity,omitempty"`
+}
+
+// Validate checks that d is a verdict for an action of the given kind.
+func (d Decision) Validate(kind string) error {
+	switch d.Result {
+	case Allow, Deny:
+	case Mutate:
+		if kind != KindAffinity {
+			return fmt.Errorf("result mutate is only valid for affinity, got it for %s", kind)
+		}
+		if d.Affinity == nil {
+			return fmt.Errorf("result mutate without affinity")
+		}
+	default:
+		return fmt.Errorf("result must be allow, deny or mutate, got %q", d.Result)
+	}
+	return nil
+}
+
+// Evaluator decides on proposed actions.
+type Evaluator interface {
+	Evaluate(ctx context.Context, in Input) (Decision, error)
+}
+
+// WASIModule evaluates inputs by running a WASI command module once per
+// input.
+type WASIModule struct {
+	module  string
+	runtime []string
+	timeout time.Duration
+}
+
+// NewWASIModule returns an Evaluator running module with runtime
+// (DefaultRuntime if empty), each run timing out after timeout
+// (DefaultTimeout if <= 0).
+func NewWASIModule(module string, runtime []string, timeout time.Duration) (*WASIModule, error) {
+	if _, err := os.Stat(module); err != nil {
+		return nil, fmt.Errorf("policy module: %w", err)
+	}
+	if len(runtime) == 0 {
+		runtime = DefaultRuntime
+	}
+	if _, err := exec.LookPath(runtime[0]); err != nil {
+		return nil, fmt.Errorf("policy runtime (policy.runtime; the published image ships none): %w", err)
+	}
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	return &WASIModule{module: module, runtime: runtime, timeout: timeout}, nil
+}
+
+func (m *WASIModule) String() string {
+	return "wasm policy " + m.module
+}
+
+// Evaluate runs the module on in.
+func (m *WASIModule) Evaluate(ctx context.Context, in Input) (Decision, error) {
+	var d Decision
+	data, err := json.Marshal(in)
+	if err != nil {
+		return d, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	args := append(append([]string{}, m.runtime[1:]...), m.module)
+	cmd := exec.CommandContext(ctx, m.runtime[0], args...)
+	cmd.Env = []string{} // nothing leaks into the sandbox
+	cmd.WaitDelay = time.Second
+	cmd.Stdin = bytes.NewReader(data)
+	var stdout, stderr limitedBuffer
+	stdout.max, stderr.max = maxOutput, 4096
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return d, fmt.Errorf("%s: timed out after %s", m, m.timeout)
+		}
+		return d, fmt.Errorf("%s: %v: %s", m, err, strings.TrimSpace(stderr.String()))
+	}
+	if stdout.truncated {
+		return d, fmt.Errorf("%s: output exceeds %d bytes", m, maxOutput)
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &d); err != nil {
+		return d, fmt.Errorf("%s: decode decision: %w", m, err)
+	}
+	if err := d.Validate(in.Kind); err != nil {
+		return d, fmt.Errorf("%s: %w", m, err)
+	}
+	return d, nil
+}
+
+// limitedBuffer keeps the first max bytes written to it.
+type limitedBuffer struct {
+	bytes.Buffer
+	max       int
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.max - b.Len(); len(p) > room {
+		b.truncated = true
+		b.Buffer.Write(p[:max(room, 0)])
+		return len(p), nil
+	}
+	return b.Buffer.Write(p)
+}
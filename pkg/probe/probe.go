@@ -0,0 +1,172 @@
+// Package probe runs active health checks against service pods: an HTTP
+// GET, or the gRPC health checking protocol (grpc.health.v1.Health/Check)
+// spoken over cleartext HTTP/2 without a gRPC dependency.
+package probe
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Protocols a probe can speak.
+const (
+	ProtocolHTTP = "http"
+	ProtocolGRPC = "grpc"
+)
+
+// DefaultTimeout bounds a probe when none is configured.
+const DefaultTimeout = time.Second
+
+// Prober runs health checks. Pods are reached directly, so proxy settings
+// are ignored.
+type Prober struct {
+	http *http.Client
+	grpc *http.Client
+}
+
+// NewProber returns a Prober whose checks time out after timeout
+// (DefaultTimeout if <= 0).
+func NewProber(timeout time.Duration) *Prober {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	h2c := &http.Transport{Protocols: new(http.Protocols)}
+	h2c.Protocols.SetUnencryptedHTTP2(true)
+	return &Prober{
+		http: &http.Client{Timeout: timeout, Transport: &http.Transport{DisableKeepAlives: true}},
+		grpc: &http.Client{Timeout: timeout, Transport: h2c},
+	}
+}
+
+// HTTP checks that a GET of url answers with a 2xx or 3xx status.
+func (p *Prober) HTTP(ctx context.Context, url string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := p.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode < 200 || resp.StatusCode >= 400 {
+		return fmt.Errorf("GET %s: status %d", url, resp.StatusCode)
+	}
+	return nil
+}
+
+// Serving states of grpc.health.v1.HealthCheckResponse.
+var grpcServingStatus = map[uint64]string{0: "UNKNOWN", 1: "SERVING", 2: "NOT_SERVING", 3: "SERVICE_UNKNOWN"}
+
+// GRPC checks that the gRPC server at addr ("host:port") reports service
+// ("" for the server as a whole) as SERVING.
+func (p *Prober) GRPC(ctx context.Context, addr, service string) error {
+	// HealthCheckRequest{service = 1}, length-prefixed and uncompressed.
+	msg := appendString(nil, 1, service)
+	body := make([]byte, 5, 5+len(msg))
+	binary.BigEndian.PutUint32(body[1:], uint32(len(msg)))
+	body = append(body, msg...)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://"+addr+"/grpc.health.v1.Health/Check", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+	resp, err := p.grpc.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("grpc health %s: HTTP status %d", addr, resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if err != nil {
+		return err
+	}
+	// A trailers-only response carries grpc-status in the headers.
+	status := resp.Trailer.Get("Grpc-Status")
+	if status == "" {
+		status = resp.Header.Get("Grpc-Status")
+	}
+	if status != "0" {
+		msg := resp.Trailer.Get("Grpc-Message")
+		if msg == "" {
+			msg = resp.Header.Get("Grpc-Message")
+		}
+		return fmt.Errorf("grpc health %s: grpc-status %s %s", addr, status, msg)
+	}
+	if len(data) < 5 || data[0] != 0 || int(binary.BigEndian.Uint32(data[1:5])) != len(data)-5 {
+		return fmt.Errorf("grpc health %s: malformed response", addr)
+	}
+	serving := readVarintField(data[5:], 1)
+	if serving != 1 {
+		name, ok := grpcServingStatus[serving]
+		if !ok {
+			name = strconv.FormatUint(serving, 10)
+		}
+		return fmt.Errorf("grpc health %s: %s", addr, name)
+	}
+	return nil
+}
+
+// appendString appends a protobuf string field; empty strings are left out.
+func appendString(b []byte, field int, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = binary.AppendUvarint(b, uint64(field)<<3|2)
+	b = binary.AppendUvarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+// readVarintField returns the last value of varint field in a protobuf
+// message, 0 if absent. Other fields are skipped.
+func readVarintField(b []byte, field int) uint64 {
+	var out uint64
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			return out
+		}
+		b = b[n:]
+		switch key & 7 {
+		case 0: // varint
+			v, n := binary.Uvarint(b)
+			if n <= 0 {
+				return out
+			}
+			if int(key>>3) == field {
+				out = v
+			}
+			b = b[n:]
+		case 1: // 64-bit
+			if len(b) < 8 {
+				return out
+			}
+			b = b[8:]
+		case 2: // length-delimited
+			l, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < l {
+				return out
+			}
+			b = b[n+int(l):]
+		case 5: // 32-bit
+			if len(b) < 4 {
+				return out
+			}
+			b = b[4:]
+		default:
+			return out
+		}
+	}
+	return out
+}
@@ -0,0 +1,115 @@
+package prometheus
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Auth holds the credentials sent with every query: a bearer token or
+// HTTP basic auth. The *File variants name files (typically a mounted
+// Secret) that are re-read whenever they change, so a rotated Secret is
+// picked up without a restart.
+type Auth struct {
+	BearerToken     string
+	BearerTokenFile string
+	Username        string
+	Password        string
+	PasswordFile    string
+}
+
+// fileSecret is a credential read from a file and cached until the file's
+// modification time or size changes.
+type fileSecret struct {
+	path string
+
+	mu      sync.Mutex
+	modTime time.Time
+	size    int64
+	value   string
+}
+
+func (f *fileSecret) get() (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	fi, err := os.Stat(f.path)
+	if err != nil {
+		if f.value != "" {
+			// Keep the last value while a Secret volume swaps its files.
+			log.Printf("[lead-net][prom] credential file %s unreadable, using the last value: %v", f.path, err)
+			return f.value, nil
+		}
+		return "", err
+	}
+	if fi.ModTime().Equal(f.modTime) && fi.Size() == f.size {
+		return f.value, nil
+	}
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return "", err
+	}
+	if !f.modTime.IsZero() {
+		log.Printf("[lead-net][prom] credential file %s changed, reloaded", f.path)
+	}
+	f.modTime, f.size, f.value = fi.ModTime(), fi.Size(), strings.TrimSpace(string(data))
+	return f.value, nil
+}
+
+// SetAuth makes the client authenticate with a. Files are read once here
+// so a missing Secret fails at startup.
+func (c *Client) SetAuth(a Auth) error {
+	if (a.BearerToken != "" || a.BearerTokenFile != "") && a.Username != "" {
+		return fmt.Errorf("prometheus: set either a bearer token or basic auth, not both")
+	}
+	c.auth = &a
+	c.tokenFile, c.passwordFile = nil, nil
+	if a.BearerTokenFile != "" {
+		c.tokenFile = &fileSecret{path: a.BearerTokenFile}
+		if _, err := c.tokenFile.get(); err != nil {
+			return fmt.Errorf("prometheus bearer token: %w", err)
+		}
+	}
+	if a.PasswordFile != "" {
+		c.passwordFile = &fileSecret{path: a.PasswordFile}
+		if _, err := c.passwordFile.get(); err != nil {
+			return fmt.Errorf("prometheus password: %w", err)
+		}
+	}
+	return nil
+}
+
+// authorize adds the configured credentials to req.
+func (c *Client) authorize(req *http.Request) error {
+	if c.auth == nil {
+		return nil
+	}
+	token := c.auth.BearerToken
+	if c.tokenFile != nil {
+		v, err := c.tokenFile.get()
+		if err != nil {
+			return fmt.Errorf("prometheus bearer token: %w", err)
+		}
+		token = v
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+		return nil
+	}
+	if c.auth.Username == "" {
+		return nil
+	}
+	password := c.auth.Password
+	if c.passwordFile != nil {
+		v, err := c.passwordFile.get()
+		if err != nil {
+			return fmt.Errorf("prometheus password: %w", err)
+		}
+		password = v
+	}
+	req.SetBasicAuth(c.auth.Username, password)
+	return nil
+}
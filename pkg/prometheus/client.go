@@ -3,16 +3,43 @@ package prometheus
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"net/url"
 	"time"
+
+	"lead-net-affinity/pkg/outbound"
+)
+
+// ErrUnavailable wraps failures to reach Prometheus or get an answer out of
+// it: network errors, timeouts, 429 and 5xx responses. Queries retry them;
+// a rejected query or a bad response is not retried.
+var ErrUnavailable = errors.New("prometheus unavailable")
+
+// queryAttempts and queryRetryDelay bound the retries of an unavailable
+// Prometheus per query; the delay doubles between attempts.
+const (
+	queryAttempts   = 3
+	queryRetryDelay = 200 * time.Millisecond
 )
 
+// defaultNodeQueryTimeout bounds each node query of FetchNetworkMatrix,
+// retries included, unless SetNodeQueryTimeout sets another.
+const defaultNodeQueryTimeout = 20 * time.Second
+
 type Client struct {
 	baseURL    *url.URL
 	httpClient *http.Client
+	transport  *http.Transport // shared by SetTLS and SetHTTPOptions
+
+	nodeQueryTimeout time.Duration // see SetNodeQueryTimeout
+
+	// Credentials, see SetAuth.
+	auth         *Auth
+	tokenFile    *fileSecret
+	passwordFile *fileSecret
 }
 
 type queryResult struct {
@@ -32,14 +59,56 @@ func NewClient(rawURL string) (*Client, error) {
 		log.Printf("[lead-net][prom] invalid Prometheus URL %q: %v", rawURL, err)
 		return nil, err
 	}
-	log.Printf("[lead-net][prom] creating Prometheus client for baseURL=%s", u.String())
+	log.Printf("[lead-net][prom] creating Prometheus client for baseURL=%s", u.Redacted())
+	tr, err := outbound.NewTransport("")
+	if err != nil {
+		return nil, err
+	}
 	return &Client{
 		baseURL:    u,
-		httpClient: &http.Client{Timeout: 10 * time.Second},
+		httpClient: &http.Client{Timeout: 10 * time.Second, Transport: tr},
+		transport:  tr,
 	}, nil
 }
 
+// SetHTTPOptions sets a proxy, extra headers and the per-query timeout
+// (default 10s).
+func (c *Client) SetHTTPOptions(o outbound.Options) error {
+	return outbound.Apply(c.httpClient, c.transport, o)
+}
+
+// SetNodeQueryTimeout bounds each node query of FetchNetworkMatrix,
+// retries included; 0 restores the default (20s).
+func (c *Client) SetNodeQueryTimeout(d time.Duration) {
+	c.nodeQueryTimeout = d
+}
+
+func (c *Client) nodeQueryTimeoutOrDefault() time.Duration {
+	if c.nodeQueryTimeout > 0 {
+		return c.nodeQueryTimeout
+	}
+	return defaultNodeQueryTimeout
+}
+
+// Query runs an instant query, retrying while Prometheus is unavailable.
 func (c *Client) Query(ctx context.Context, q string) (queryResult, error) {
+	delay := queryRetryDelay
+	for attempt := 1; ; attempt++ {
+		r, err := c.query(ctx, q)
+		if !errors.Is(err, ErrUnavailable) || attempt == queryAttempts || ctx.Err() != nil {
+			return r, err
+		}
+		log.Printf("[lead-net][prom] query %q attempt %d failed, retrying in %s: %v", q, attempt, delay, err)
+		select {
+		case <-ctx.Done():
+			return r, err
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+func (c *Client) query(ctx context.Context, q string) (queryResult, error) {
 	start := time.Now()
 
 	u := *c.baseURL
@@ -48,23 +117,30 @@ func (c *Client) Query(ctx context.Context, q string) (queryResult, error) {
 	qs.Set("query", q)
 	u.RawQuery = qs.Encode()
 
-	log.Printf("[lead-net][prom] executing query %q against %s", q, u.String())
+	log.Printf("[lead-net][prom] executing query %q against %s", q, u.Redacted())
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
 	if err != nil {
 		log.Printf("[lead-net][prom] NewRequest failed for query %q: %v", q, err)
 		return queryResult{}, err
 	}
+	if err := c.authorize(req); err != nil {
+		log.Printf("[lead-net][prom] no credentials for query %q: %v", q, err)
+		return queryResult{}, err
+	}
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
 		log.Printf("[lead-net][prom] HTTP request failed for query %q: %v", q, err)
-		return queryResult{}, err
+		return queryResult{}, fmt.Errorf("%w: %w", ErrUnavailable, err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		log.Printf("[lead-net][prom] non-OK status for query %q: %s", q, resp.Status)
+		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+			return queryResult{}, fmt.Errorf("%w: status %s", ErrUnavailable, resp.Status)
+		}
 		return queryResult{}, fmt.Errorf("prometheus status: %s", resp.Status)
 	}
 
@@ -83,3 +159,9 @@ func (c *Client) Query(ctx context.Context, q string) (queryResult, error) {
 
 	return r, nil
 }
+
+// Ping checks that Prometheus is reachable and answering queries.
+func (c *Client) Ping(ctx context.Context) error {
+	_, err := c.Query(ctx, "vector(1)")
+	return err
+}
@@ -0,0 +1,64 @@
+package prometheus
+
+import "time"
+
+// Confidence says how a metric value was obtained.
+type Confidence string
+
+const (
+	// ConfidenceMeasured values come straight from a metrics or trace backend.
+	ConfidenceMeasured Confidence = "measured"
+	// ConfidenceInferred values are guessed from indirect evidence, e.g.
+	// edges inferred from DNS lookups.
+	ConfidenceInferred Confidence = "inferred"
+	// ConfidenceDefault means no data: the value is a configured or built-in
+	// default.
+	ConfidenceDefault Confidence = "default"
+	// ConfidenceInjected values were injected through the controller's
+	// /inject test-bench endpoint and replace measured ones.
+	ConfidenceInjected Confidence = "injected"
+)
+
+// Weight is how much a value of this confidence counts in scoring. An unset
+// confidence is treated as measured.
+func (c Confidence) Weight() float64 {
+	switch c {
+	case ConfidenceInferred:
+		return 0.5
+	case ConfidenceDefault:
+		return 0
+	default:
+		return 1
+	}
+}
+
+// Freshness records where a value came from and when it was observed.
+type Freshness struct {
+	Confidence Confidence `json:"confidence"`
+	ObservedAt time.Time  `json:"observedAt,omitempty"`
+}
+
+// Measured returns the freshness of a value measured at t.
+func Measured(t time.Time) Freshness {
+	return Freshness{Confidence: ConfidenceMeasured, ObservedAt: t}
+}
+
+// Discount returns the factor (0..1) to scale a value's contribution by:
+// its confidence weight, further scaled by staleAfter/age once it is older
+// than staleAfter. staleAfter <= 0 or an unknown ObservedAt disables the
+// age discount.
+func (f Freshness) Discount(now time.Time, staleAfter time.Duration) float64 {
+	w := f.Confidence.Weight()
+	if staleAfter <= 0 || f.ObservedAt.IsZero() {
+		return w
+	}
+	if age := now.Sub(f.ObservedAt); age > staleAfter {
+		w *= float64(staleAfter) / float64(age)
+	}
+	return w
+}
+
+// Stale reports whether the value is older than staleAfter.
+func (f Freshness) Stale(now time.Time, staleAfter time.Duration) bool {
+	return staleAfter > 0 && !f.ObservedAt.IsZero() && now.Sub(f.ObservedAt) > staleAfter
+}
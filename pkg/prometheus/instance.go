@@ -0,0 +1,87 @@
+package prometheus
+
+import (
+	"net"
+	"net/netip"
+	"strings"
+)
+
+// nodeLabels are the labels naming the node of a per-node series, in order
+// of preference over the instance label: "node" is set by the usual
+// kube-prometheus relabelings, "kubernetes_node" by older scrape configs,
+// "nodename" by node-exporter's node_uname_info and "source_node_name" by
+// Cilium's node connectivity metrics.
+var nodeLabels = []string{"node", "kubernetes_node", "nodename", "source_node_name"}
+
+// seriesNodeID returns the normalized node identifier of a per-node
+// series: its node name label if it has one, else its instance.
+func seriesNodeID(metric map[string]string) string {
+	for _, l := range nodeLabels {
+		if v := NormalizeAddress(metric[l]); v != "" {
+			return v
+		}
+	}
+	return normalizeInstance(metric["instance"])
+}
+
+// normalizeInstance("91.228.186.28:9962") -> "91.228.186.28".
+func normalizeInstance(inst string) string {
+	return NormalizeAddress(inst)
+}
+
+// NormalizeAddress strips the port from an instance label or node address
+// and returns IPs in canonical form and host names in lower case without a
+// trailing dot, so both sides of a lookup agree:
+//
+//	"91.228.186.28:9962"         -> "91.228.186.28"
+//	"[2001:db8::1]:9962"         -> "2001:db8::1"
+//	"2001:DB8:0:0:0:0:0:1"       -> "2001:db8::1"
+//	"::ffff:10.0.0.1"            -> "10.0.0.1"
+//	"Worker-1.Example.com.:9100" -> "worker-1.example.com"
+func NormalizeAddress(addr string) string {
+	addr = strings.TrimSpace(addr)
+	if addr == "" {
+		return ""
+	}
+	host := addr
+	if h, _, err := net.SplitHostPort(addr); err == nil {
+		host = h
+	} else if strings.HasPrefix(addr, "[") && strings.HasSuffix(addr, "]") {
+		host = addr[1 : len(addr)-1]
+	} else if strings.Count(addr, ":") == 1 {
+		host = addr[:strings.IndexByte(addr, ':')]
+	}
+	if ip, err := netip.ParseAddr(host); err == nil {
+		return ip.Unmap().WithZone("").String()
+	}
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
+
+// SameNode reports whether two node identifiers (node names, instance
+// labels or node addresses) name the same node: equal once normalized, or
+// host names with the same first label ("worker-1" and
+// "worker-1.example.com").
+func SameNode(a, b string) bool {
+	a, b = NormalizeAddress(a), NormalizeAddress(b)
+	if a == "" || b == "" {
+		return false
+	}
+	if a == b {
+		return true
+	}
+	return !isIP(a) && !isIP(b) && shortHostname(a) == shortHostname(b)
+}
+
+func isIP(s string) bool {
+	_, err := netip.ParseAddr(s)
+	return err == nil
+}
+
+// shortHostname is the first label of a host name: "worker-1" for
+// "worker-1.example.com".
+func shortHostname(host string) string {
+	if i := strings.IndexByte(host, '.'); i > 0 {
+		return host[:i]
+	}
+	return host
+}
@@ -0,0 +1,68 @@
+package prometheus
+
+import (
+	"context"
+	"log"
+	"strconv"
+)
+
+// DeploymentRollout is a Deployment's replica and rollout state as
+// exported by kube-state-metrics.
+type DeploymentRollout struct {
+	Desired            float64 // kube_deployment_spec_replicas
+	Updated            float64 // kube_deployment_status_replicas_updated
+	Available          float64 // kube_deployment_status_replicas_available
+	Generation         float64 // kube_deployment_metadata_generation
+	ObservedGeneration float64 // kube_deployment_status_observed_generation
+}
+
+// Settled reports whether the latest spec (including a replica change) has
+// been observed and fully rolled out: every desired replica is updated and
+// available.
+func (r DeploymentRollout) Settled() bool {
+	return r.ObservedGeneration >= r.Generation && r.Updated >= r.Desired && r.Available >= r.Desired
+}
+
+// FetchDeploymentRollouts reads the kube-state-metrics Deployment series,
+// narrowed by selector (extra label matchers such as
+// job="kube-state-metrics"; may be empty), keyed by "namespace/deployment".
+func (c *Client) FetchDeploymentRollouts(ctx context.Context, selector string) (map[string]DeploymentRollout, error) {
+	out := make(map[string]DeploymentRollout)
+	series := []struct {
+		metric string
+		set    func(r *DeploymentRollout, v float64)
+	}{
+		{"kube_deployment_spec_replicas", func(r *DeploymentRollout, v float64) { r.Desired = v }},
+		{"kube_deployment_status_replicas_updated", func(r *DeploymentRollout, v float64) { r.Updated = v }},
+		{"kube_deployment_status_replicas_available", func(r *DeploymentRollout, v float64) { r.Available = v }},
+		{"kube_deployment_metadata_generation", func(r *DeploymentRollout, v float64) { r.Generation = v }},
+		{"kube_deployment_status_observed_generation", func(r *DeploymentRollout, v float64) { r.ObservedGeneration = v }},
+	}
+	for _, s := range series {
+		res, err := c.Query(ctx, s.metric+"{"+selector+"}")
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range res.Data.Result {
+			ns, name := r.Metric["namespace"], r.Metric["deployment"]
+			if ns == "" || name == "" {
+				continue
+			}
+			valStr, ok := r.Value[1].(string)
+			if !ok {
+				continue
+			}
+			v, err := strconv.ParseFloat(valStr, 64)
+			if err != nil {
+				log.Printf("[lead-net][debug] failed to parse %s for %s/%s raw=%q: %v", s.metric, ns, name, valStr, err)
+				continue
+			}
+			key := ns + "/" + name
+			d := out[key]
+			s.set(&d, v)
+			out[key] = d
+		}
+	}
+	log.Printf("[lead-net][debug] kube-state-metrics: rollout state of %d deployments", len(out))
+	return out, nil
+}
@@ -2,9 +2,14 @@ package prometheus
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
+	"maps"
+	"slices"
 	"strconv"
-	"strings"
+	"sync"
+	"time"
 )
 
 const (
@@ -18,30 +23,73 @@ type NodeMetrics struct {
 	AvgLatencyMs  float64 // p50 latency in ms
 	DropRate      float64 // drop bytes rate (unit depends on query)
 	BandwidthRate float64 // flow rate (e.g. flows/sec)
+
+	Freshness Freshness // zero value counts as measured and current
 }
 
+// Dimensions of a NetworkMatrix, one per node query.
+const (
+	DimensionLatency   = "latency"
+	DimensionDrop      = "drop"
+	DimensionBandwidth = "bandwidth"
+)
+
 // NetworkMatrix now holds *per-node* metrics.
 type NetworkMatrix struct {
 	Nodes map[string]*NodeMetrics
+
+	// Missing maps the dimensions whose query failed or timed out to the
+	// error; their metrics are 0 on every node and must not be read as
+	// measured (see Has).
+	Missing map[string]string `json:",omitempty"`
 }
 
-// GetNode returns metrics for a given node ID (or nil if missing).
-func (nm *NetworkMatrix) GetNode(nodeID string) *NodeMetrics {
-	if nm == nil || nm.Nodes == nil {
+// Has reports whether the dimension was measured, i.e. is not Missing.
+func (nm *NetworkMatrix) Has(dim string) bool {
+	if nm == nil {
+		return false
+	}
+	_, missing := nm.Missing[dim]
+	return !missing
+}
+
+// MissingDimensions returns the Missing dimensions in name order.
+func (nm *NetworkMatrix) MissingDimensions() []string {
+	if nm == nil {
 		return nil
 	}
-	return nm.Nodes[nodeID]
+	return slices.Sorted(maps.Keys(nm.Missing))
 }
 
-// normalizeInstance("91.228.186.28:9962") -> "91.228.186.28".
-func normalizeInstance(inst string) string {
-	if inst == "" {
-		return ""
+// GetNode returns metrics for a given node ID (or nil if missing). The ID
+// is also matched in normalized form (see NormalizeAddress) and, for a host
+// name, by its first label, so node "worker-1" finds the metrics of
+// instance "Worker-1.example.com:9100" and "2001:DB8:0::1" those of
+// "[2001:db8::1]:9962".
+func (nm *NetworkMatrix) GetNode(nodeID string) *NodeMetrics {
+	if nm == nil || nm.Nodes == nil {
+		return nil
+	}
+	if m, ok := nm.Nodes[nodeID]; ok {
+		return m
 	}
-	if i := strings.IndexByte(inst, ':'); i != -1 {
-		return inst[:i]
+	n := NormalizeAddress(nodeID)
+	if m, ok := nm.Nodes[n]; ok {
+		return m
+	}
+	if n == "" || isIP(n) {
+		return nil
+	}
+	match := ""
+	for id := range nm.Nodes {
+		if SameNode(id, n) && (match == "" || id < match) {
+			match = id
+		}
 	}
-	return inst
+	if match == "" {
+		return nil
+	}
+	return nm.Nodes[match]
 }
 
 func isMasterInstance(inst string) bool {
@@ -55,12 +103,32 @@ func (nm *NetworkMatrix) getOrCreate(nodeID string) *NodeMetrics {
 	if m, ok := nm.Nodes[nodeID]; ok {
 		return m
 	}
-	m := &NodeMetrics{NodeID: nodeID}
+	m := &NodeMetrics{NodeID: nodeID, Freshness: Measured(time.Now())}
 	nm.Nodes[nodeID] = m
 	return m
 }
 
-// FetchNetworkMatrix queries Prometheus and builds a per-node view.
+// nodeQuery is one dimension of a NetworkMatrix and the query measuring it.
+type nodeQuery struct {
+	dim   string
+	query string
+	scale float64 // applied to each sample, e.g. seconds -> ms
+	set   func(m *NodeMetrics, v float64)
+}
+
+// nodeQueryResult is the outcome of one nodeQuery; samples are keyed by
+// node ID.
+type nodeQueryResult struct {
+	samples map[string]float64
+	err     error
+}
+
+// FetchNetworkMatrix queries Prometheus and builds a per-node view. The
+// queries run concurrently, each bounded by the node query timeout (see
+// SetNodeQueryTimeout), so a slow query holds up neither the others nor
+// the reconcile beyond that. When some of them fail, the matrix is returned
+// without their dimensions, listed in Missing; it fails only if every
+// configured query does.
 func (c *Client) FetchNetworkMatrix(
 	ctx context.Context,
 	latencyQuery, dropQuery, bwQuery string,
@@ -69,161 +137,105 @@ func (c *Client) FetchNetworkMatrix(
 	log.Printf("[lead-net][debug] FetchNetworkMatrix start latencyQuery=%q dropQuery=%q bwQuery=%q",
 		latencyQuery, dropQuery, bwQuery)
 
-	nm := &NetworkMatrix{Nodes: make(map[string]*NodeMetrics)}
-
-	// 1) Latency (seconds -> ms)
-	if latencyQuery != "" {
-		res, err := c.Query(ctx, latencyQuery)
-		if err != nil {
-			log.Printf("[lead-net][debug] latency query %q failed: %v", latencyQuery, err)
-			return nil, err
+	var queries []nodeQuery
+	for _, q := range []nodeQuery{
+		{DimensionLatency, latencyQuery, 1000, func(m *NodeMetrics, v float64) { m.AvgLatencyMs = v }},
+		{DimensionDrop, dropQuery, 1, func(m *NodeMetrics, v float64) { m.DropRate = v }},
+		{DimensionBandwidth, bwQuery, 1, func(m *NodeMetrics, v float64) { m.BandwidthRate = v }},
+	} {
+		if q.query != "" {
+			queries = append(queries, q)
 		}
-		log.Printf("[lead-net][debug] latency query returned %d series", len(res.Data.Result))
-
-		for _, r := range res.Data.Result {
-			inst := r.Metric["instance"]
-			nodeLabel := r.Metric["node"]
-
-			// Ignore master
-			if inst != "" && isMasterInstance(inst) {
-				log.Printf("[lead-net][debug] skipping latency sample for master instance=%q", inst)
-				continue
-			}
+	}
 
-			// Prefer the Kubernetes node name if present.
-			nodeID := nodeLabel
-			if nodeID == "" {
-				nodeID = normalizeInstance(inst)
-			}
-			if nodeID == "" {
-				log.Printf("[lead-net][debug] skipping latency sample: no usable nodeID (instance=%q node=%q)", inst, nodeLabel)
-				continue
-			}
+	results := make([]nodeQueryResult, len(queries))
+	var wg sync.WaitGroup
+	for i, q := range queries {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = c.fetchNodeQuery(ctx, q)
+		}()
+	}
+	wg.Wait()
 
-			valRaw := r.Value[1]
-			valStr, ok := valRaw.(string)
-			if !ok {
-				log.Printf("[lead-net][debug] unexpected value type for latency sample node=%s instance=%s: %#v", nodeID, inst, valRaw)
-				continue
-			}
-			v, err := strconv.ParseFloat(valStr, 64) // seconds
-			if err != nil {
-				log.Printf("[lead-net][debug] failed to parse latency value for node=%s instance=%s raw=%q: %v",
-					nodeID, inst, valStr, err)
-				continue
+	nm := &NetworkMatrix{Nodes: make(map[string]*NodeMetrics)}
+	var errs []error
+	for i, q := range queries {
+		r := results[i]
+		if r.err != nil {
+			log.Printf("[lead-net][debug] %s query %q failed: %v", q.dim, q.query, r.err)
+			if nm.Missing == nil {
+				nm.Missing = make(map[string]string)
 			}
-			latMs := v * 1000.0
-
-			m := nm.getOrCreate(nodeID)
-			m.AvgLatencyMs = latMs
-
-			log.Printf("[lead-net][debug] latency node=%s instance=%s raw_sec=%s latency_ms=%f",
-				nodeID, inst, valStr, latMs)
+			nm.Missing[q.dim] = r.err.Error()
+			errs = append(errs, fmt.Errorf("%s query: %w", q.dim, r.err))
+			continue
 		}
-	}
-
-	// 2) Drop bytes rate
-	if dropQuery != "" {
-		res, err := c.Query(ctx, dropQuery)
-		if err != nil {
-			log.Printf("[lead-net][debug] drop query %q failed: %v", dropQuery, err)
-			return nil, err
+		for nodeID, v := range r.samples {
+			q.set(nm.getOrCreate(nodeID), v)
 		}
-		log.Printf("[lead-net][debug] drop query returned %d series", len(res.Data.Result))
-
-		for _, r := range res.Data.Result {
-			inst := r.Metric["instance"]
-			nodeLabel := r.Metric["node"]
-
-			if inst != "" && isMasterInstance(inst) {
-				log.Printf("[lead-net][debug] skipping drop sample for master instance=%q", inst)
-				continue
-			}
-
-			nodeID := nodeLabel
-			if nodeID == "" {
-				nodeID = normalizeInstance(inst)
-			}
-			if nodeID == "" {
-				log.Printf("[lead-net][debug] skipping drop sample: no usable nodeID (instance=%q node=%q)", inst, nodeLabel)
-				continue
-			}
+	}
+	if len(queries) > 0 && len(errs) == len(queries) {
+		return nil, errors.Join(errs...)
+	}
 
-			valRaw := r.Value[1]
-			valStr, ok := valRaw.(string)
-			if !ok {
-				log.Printf("[lead-net][debug] unexpected value type for drop sample node=%s instance=%s: %#v", nodeID, inst, valRaw)
-				continue
-			}
-			v, err := strconv.ParseFloat(valStr, 64)
-			if err != nil {
-				log.Printf("[lead-net][debug] failed to parse drop value for node=%s instance=%s raw=%q: %v",
-					nodeID, inst, valStr, err)
-				continue
-			}
+	// Final summary
+	log.Printf("[lead-net][debug] built NetworkMatrix with %d nodes (missing %v)", len(nm.Nodes), nm.MissingDimensions())
+	for id, m := range nm.Nodes {
+		log.Printf("[lead-net][debug] node summary id=%s latency_ms=%f drop=%f flow=%f",
+			id, m.AvgLatencyMs, m.DropRate, m.BandwidthRate)
+	}
 
-			m := nm.getOrCreate(nodeID)
-			m.DropRate = v
+	return nm, nil
+}
 
-			log.Printf("[lead-net][debug] drop node=%s instance=%s drop_rate=%f",
-				nodeID, inst, v)
+// fetchNodeQuery runs q within the node query timeout and parses its
+// samples by node.
+func (c *Client) fetchNodeQuery(ctx context.Context, q nodeQuery) nodeQueryResult {
+	timeout := c.nodeQueryTimeoutOrDefault()
+	qctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	res, err := c.Query(qctx, q.query)
+	if err != nil {
+		if qctx.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+			err = fmt.Errorf("timed out after %s: %w", timeout, err)
 		}
+		return nodeQueryResult{err: err}
 	}
+	log.Printf("[lead-net][debug] %s query returned %d series", q.dim, len(res.Data.Result))
 
-	// 3) Flow rate (as a proxy for bandwidth / load)
-	if bwQuery != "" {
-		res, err := c.Query(ctx, bwQuery)
-		if err != nil {
-			log.Printf("[lead-net][debug] bandwidth/flow query %q failed: %v", bwQuery, err)
-			return nil, err
-		}
-		log.Printf("[lead-net][debug] bandwidth/flow query returned %d series", len(res.Data.Result))
-
-		for _, r := range res.Data.Result {
-			inst := r.Metric["instance"]
-			nodeLabel := r.Metric["node"]
-
-			if inst != "" && isMasterInstance(inst) {
-				log.Printf("[lead-net][debug] skipping bandwidth sample for master instance=%q", inst)
-				continue
-			}
-
-			nodeID := nodeLabel
-			if nodeID == "" {
-				nodeID = normalizeInstance(inst)
-			}
-			if nodeID == "" {
-				log.Printf("[lead-net][debug] skipping bandwidth sample: no usable nodeID (instance=%q node=%q)", inst, nodeLabel)
-				continue
-			}
+	out := make(map[string]float64, len(res.Data.Result))
+	for _, r := range res.Data.Result {
+		inst := r.Metric["instance"]
 
-			valRaw := r.Value[1]
-			valStr, ok := valRaw.(string)
-			if !ok {
-				log.Printf("[lead-net][debug] unexpected value type for bandwidth sample node=%s instance=%s: %#v", nodeID, inst, valRaw)
-				continue
-			}
-			v, err := strconv.ParseFloat(valStr, 64)
-			if err != nil {
-				log.Printf("[lead-net][debug] failed to parse bandwidth value for node=%s instance=%s raw=%q: %v",
-					nodeID, inst, valStr, err)
-				continue
-			}
+		// Ignore master
+		if inst != "" && isMasterInstance(inst) {
+			log.Printf("[lead-net][debug] skipping %s sample for master instance=%q", q.dim, inst)
+			continue
+		}
 
-			m := nm.getOrCreate(nodeID)
-			m.BandwidthRate = v
+		// Prefer the Kubernetes node name if present.
+		nodeID := seriesNodeID(r.Metric)
+		if nodeID == "" {
+			log.Printf("[lead-net][debug] skipping %s sample: no usable nodeID (instance=%q)", q.dim, inst)
+			continue
+		}
 
-			log.Printf("[lead-net][debug] bandwidth node=%s instance=%s flow_rate=%f",
-				nodeID, inst, v)
+		valStr, ok := r.Value[1].(string)
+		if !ok {
+			log.Printf("[lead-net][debug] unexpected value type for %s sample node=%s instance=%s: %#v", q.dim, nodeID, inst, r.Value[1])
+			continue
 		}
-	}
+		v, err := strconv.ParseFloat(valStr, 64)
+		if err != nil {
+			log.Printf("[lead-net][debug] failed to parse %s value for node=%s instance=%s raw=%q: %v",
+				q.dim, nodeID, inst, valStr, err)
+			continue
+		}
+		out[nodeID] = v * q.scale
 
-	// Final summary
-	log.Printf("[lead-net][debug] built NetworkMatrix with %d nodes", len(nm.Nodes))
-	for id, m := range nm.Nodes {
-		log.Printf("[lead-net][debug] node summary id=%s latency_ms=%f drop=%f flow=%f",
-			id, m.AvgLatencyMs, m.DropRate, m.BandwidthRate)
+		log.Printf("[lead-net][debug] %s node=%s instance=%s raw=%s value=%f", q.dim, nodeID, inst, valStr, out[nodeID])
 	}
-
-	return nm, nil
+	return nodeQueryResult{samples: out}
 }
@@ -0,0 +1,270 @@
+package prometheus
+
+import (
+	"context"
+	"log"
+	"math"
+	"strconv"
+	"time"
+)
+
+const (
+	// Default label keys used by Hubble/Istio edge metrics for the caller and callee.
+	DefaultServiceSrcLabel = "source_workload"
+	DefaultServiceDstLabel = "destination_workload"
+)
+
+// ServicePair identifies a directed caller -> callee edge between two services.
+type ServicePair struct {
+	Src string
+	Dst string
+}
+
+// ServiceLatencyMatrix holds measured latency for service pairs (edges),
+// as opposed to NetworkMatrix which only knows per-node signals.
+type ServiceLatencyMatrix struct {
+	Pairs     map[ServicePair]float64 // latency in ms
+	Freshness map[ServicePair]Freshness
+}
+
+// Latency returns the measured src -> dst latency in ms. If the directed edge
+// is missing, the reverse direction is used as a fallback.
+func (m *ServiceLatencyMatrix) Latency(src, dst string) (float64, bool) {
+	if m == nil || m.Pairs == nil {
+		return 0, false
+	}
+	if v, ok := m.Pairs[ServicePair{Src: src, Dst: dst}]; ok {
+		return v, true
+	}
+	if v, ok := m.Pairs[ServicePair{Src: dst, Dst: src}]; ok {
+		return v, true
+	}
+	return 0, false
+}
+
+// FreshnessOf returns the freshness of the value Latency(src, dst) returns,
+// with the same reverse-direction fallback. Pairs without metadata count as
+// measured.
+func (m *ServiceLatencyMatrix) FreshnessOf(src, dst string) Freshness {
+	if m == nil {
+		return Freshness{Confidence: ConfidenceDefault}
+	}
+	if _, ok := m.Pairs[ServicePair{Src: src, Dst: dst}]; ok {
+		return m.Freshness[ServicePair{Src: src, Dst: dst}]
+	}
+	if _, ok := m.Pairs[ServicePair{Src: dst, Dst: src}]; ok {
+		return m.Freshness[ServicePair{Src: dst, Dst: src}]
+	}
+	return Freshness{Confidence: ConfidenceDefault}
+}
+
+// ServiceRPSMatrix holds measured request rate for service pairs (edges).
+type ServiceRPSMatrix struct {
+	Pairs     map[ServicePair]float64 // requests per second
+	Freshness map[ServicePair]Freshness
+}
+
+// RPS returns the measured src -> dst request rate.
+func (m *ServiceRPSMatrix) RPS(src, dst string) (float64, bool) {
+	if m == nil || m.Pairs == nil {
+		return 0, false
+	}
+	v, ok := m.Pairs[ServicePair{Src: src, Dst: dst}]
+	return v, ok
+}
+
+// FreshnessOf returns the freshness of the src -> dst request rate.
+func (m *ServiceRPSMatrix) FreshnessOf(src, dst string) Freshness {
+	if m == nil {
+		return Freshness{Confidence: ConfidenceDefault}
+	}
+	if _, ok := m.Pairs[ServicePair{Src: src, Dst: dst}]; !ok {
+		return Freshness{Confidence: ConfidenceDefault}
+	}
+	return m.Freshness[ServicePair{Src: src, Dst: dst}]
+}
+
+// FetchServiceLatencies runs a pairwise edge latency query (e.g. Hubble
+// hubble_http_request_duration_seconds or Istio istio_request_duration_milliseconds)
+// and keys every series by its src/dst labels.
+//
+// unit is the unit of the query result ("s", "ms" or "us"; "" means
+// seconds); the matrix is always in milliseconds.
+func (c *Client) FetchServiceLatencies(
+	ctx context.Context,
+	query, srcLabel, dstLabel, unit string,
+) (*ServiceLatencyMatrix, error) {
+	scale, err := MillisecondsPer(unit)
+	if err != nil {
+		return nil, err
+	}
+	pairs, err := c.fetchServicePairs(ctx, "latency", query, srcLabel, dstLabel)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range pairs {
+		pairs[k] = v * scale
+	}
+	return &ServiceLatencyMatrix{Pairs: pairs, Freshness: measuredNow(pairs)}, nil
+}
+
+// FetchServicePairRPS runs a pairwise edge request-rate query and keys every
+// series by its src/dst labels.
+func (c *Client) FetchServicePairRPS(
+	ctx context.Context,
+	query, srcLabel, dstLabel string,
+) (*ServiceRPSMatrix, error) {
+	pairs, err := c.fetchServicePairs(ctx, "rps", query, srcLabel, dstLabel)
+	if err != nil {
+		return nil, err
+	}
+	return &ServiceRPSMatrix{Pairs: pairs, Freshness: measuredNow(pairs)}, nil
+}
+
+// ServiceBytesMatrix holds measured traffic volume for service pairs (edges).
+type ServiceBytesMatrix struct {
+	Pairs map[ServicePair]float64 // bytes per second
+}
+
+// Bytes returns the measured src -> dst traffic volume.
+func (m *ServiceBytesMatrix) Bytes(src, dst string) (float64, bool) {
+	if m == nil || m.Pairs == nil {
+		return 0, false
+	}
+	v, ok := m.Pairs[ServicePair{Src: src, Dst: dst}]
+	return v, ok
+}
+
+// FetchServicePairBytes runs a pairwise edge byte-rate query (e.g. Istio
+// istio_tcp_sent_bytes_total or istio_request_bytes_sum) and keys every
+// series by its src/dst labels.
+func (c *Client) FetchServicePairBytes(
+	ctx context.Context,
+	query, srcLabel, dstLabel string,
+) (*ServiceBytesMatrix, error) {
+	pairs, err := c.fetchServicePairs(ctx, "bytes", query, srcLabel, dstLabel)
+	if err != nil {
+		return nil, err
+	}
+	return &ServiceBytesMatrix{Pairs: pairs}, nil
+}
+
+// FetchServiceValues runs a per-service query (e.g. a server-side request
+// rate without a caller label) and keys every series by label. kind only
+// names the query in logs.
+func (c *Client) FetchServiceValues(ctx context.Context, kind, query, label string) (map[string]float64, error) {
+	out := make(map[string]float64)
+	res, err := c.Query(ctx, query)
+	if err != nil {
+		log.Printf("[lead-net][debug] service %s query %q failed: %v", kind, query, err)
+		return nil, err
+	}
+	for _, r := range res.Data.Result {
+		svc := r.Metric[label]
+		valStr, ok := r.Value[1].(string)
+		if svc == "" || !ok {
+			log.Printf("[lead-net][debug] skipping service %s sample: missing %s or value (metric=%v)", kind, label, r.Metric)
+			continue
+		}
+		v, err := strconv.ParseFloat(valStr, 64)
+		if err != nil || math.IsNaN(v) {
+			log.Printf("[lead-net][debug] failed to parse service %s %s raw=%q", kind, svc, valStr)
+			continue
+		}
+		out[svc] = v
+	}
+	log.Printf("[lead-net][debug] service %s: %d services", kind, len(out))
+	return out, nil
+}
+
+func measuredNow(pairs map[ServicePair]float64) map[ServicePair]Freshness {
+	now := time.Now()
+	out := make(map[ServicePair]Freshness, len(pairs))
+	for k := range pairs {
+		out[k] = Measured(now)
+	}
+	return out
+}
+
+func (c *Client) fetchServicePairs(
+	ctx context.Context,
+	kind, query, srcLabel, dstLabel string,
+) (map[ServicePair]float64, error) {
+	if srcLabel == "" {
+		srcLabel = DefaultServiceSrcLabel
+	}
+	if dstLabel == "" {
+		dstLabel = DefaultServiceDstLabel
+	}
+
+	pairs := make(map[ServicePair]float64)
+	if query == "" {
+		log.Printf("[lead-net][debug] service %s: no query configured; returning empty matrix", kind)
+		return pairs, nil
+	}
+
+	log.Printf("[lead-net][debug] service %s fetch start query=%q srcLabel=%s dstLabel=%s",
+		kind, query, srcLabel, dstLabel)
+
+	res, err := c.Query(ctx, query)
+	if err != nil {
+		log.Printf("[lead-net][debug] service %s query %q failed: %v", kind, query, err)
+		return nil, err
+	}
+
+	for _, r := range res.Data.Result {
+		src := r.Metric[srcLabel]
+		dst := r.Metric[dstLabel]
+		if src == "" || dst == "" {
+			log.Printf("[lead-net][debug] skipping service %s sample: missing src/dst (metric=%v)", kind, r.Metric)
+			continue
+		}
+
+		valStr, ok := r.Value[1].(string)
+		if !ok {
+			log.Printf("[lead-net][debug] unexpected value type for service %s %s -> %s: %#v", kind, src, dst, r.Value[1])
+			continue
+		}
+		v, err := strconv.ParseFloat(valStr, 64)
+		if err != nil {
+			log.Printf("[lead-net][debug] failed to parse service %s %s -> %s raw=%q: %v", kind, src, dst, valStr, err)
+			continue
+		}
+		pairs[ServicePair{Src: src, Dst: dst}] = v
+
+		log.Printf("[lead-net][debug] service %s %s -> %s value=%f", kind, src, dst, v)
+	}
+
+	log.Printf("[lead-net][debug] service %s: built matrix with %d pairs", kind, len(pairs))
+	return pairs, nil
+}
+
+// FetchGatewayLatency runs an entry-point latency query (e.g. a
+// histogram_quantile over the ingress controller's request durations) and
+// returns its value in milliseconds. With several series the slowest one
+// counts; ok is false if the query returned no usable sample.
+func (c *Client) FetchGatewayLatency(ctx context.Context, query, unit string) (ms float64, ok bool, err error) {
+	scale, err := MillisecondsPer(unit)
+	if err != nil {
+		return 0, false, err
+	}
+	res, err := c.Query(ctx, query)
+	if err != nil {
+		return 0, false, err
+	}
+	for _, r := range res.Data.Result {
+		valStr, isStr := r.Value[1].(string)
+		if !isStr {
+			continue
+		}
+		v, err := strconv.ParseFloat(valStr, 64)
+		if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+			log.Printf("[lead-net][debug] skipping gateway latency sample raw=%q (metric=%v)", valStr, r.Metric)
+			continue
+		}
+		if !ok || v*scale > ms {
+			ms, ok = v*scale, true
+		}
+	}
+	return ms, ok, nil
+}
@@ -0,0 +1,102 @@
+package prometheus
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// TLS configures HTTPS to Prometheus: a CA bundle for private CAs, a
+// client certificate for mutual TLS, and an insecure mode for testing.
+type TLS struct {
+	CAFile             string
+	CertFile           string
+	KeyFile            string
+	ServerName         string // overrides the name checked in the server certificate
+	InsecureSkipVerify bool
+}
+
+// SetTLS makes the client use t for HTTPS. The client certificate is
+// re-read when its files change, so rotated certificates (cert-manager
+// Secrets) are picked up without a restart.
+func (c *Client) SetTLS(t TLS) error {
+	if t == (TLS{}) {
+		return nil
+	}
+	if (t.CertFile == "") != (t.KeyFile == "") {
+		return fmt.Errorf("prometheus tls: certFile and keyFile must be set together")
+	}
+	cfg := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         t.ServerName,
+		InsecureSkipVerify: t.InsecureSkipVerify,
+	}
+	if t.InsecureSkipVerify {
+		log.Printf("[lead-net][prom] TLS certificate verification disabled for %s", c.baseURL.Redacted())
+	}
+	if t.CAFile != "" {
+		pem, err := os.ReadFile(t.CAFile)
+		if err != nil {
+			return fmt.Errorf("prometheus tls: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("prometheus tls: no certificates in %s", t.CAFile)
+		}
+		cfg.RootCAs = pool
+	}
+	if t.CertFile != "" {
+		kp := &keyPair{certFile: t.CertFile, keyFile: t.KeyFile}
+		if _, err := kp.get(); err != nil {
+			return fmt.Errorf("prometheus tls: %w", err)
+		}
+		cfg.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return kp.get()
+		}
+	}
+	c.transport.TLSClientConfig = cfg
+	return nil
+}
+
+// keyPair is a client certificate loaded from files and reloaded when the
+// certificate file changes.
+type keyPair struct {
+	certFile, keyFile string
+
+	mu      sync.Mutex
+	modTime time.Time
+	cert    *tls.Certificate
+}
+
+func (k *keyPair) get() (*tls.Certificate, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	fi, err := os.Stat(k.certFile)
+	if err != nil {
+		if k.cert != nil {
+			return k.cert, nil // keep the last certificate while a Secret volume swaps
+		}
+		return nil, err
+	}
+	if k.cert != nil && fi.ModTime().Equal(k.modTime) {
+		return k.cert, nil
+	}
+	cert, err := tls.LoadX509KeyPair(k.certFile, k.keyFile)
+	if err != nil {
+		if k.cert != nil {
+			// The key may not have been updated yet; retry next handshake.
+			log.Printf("[lead-net][prom] reloading client certificate %s failed, using the last one: %v", k.certFile, err)
+			return k.cert, nil
+		}
+		return nil, err
+	}
+	if k.cert != nil {
+		log.Printf("[lead-net][prom] client certificate %s changed, reloaded", k.certFile)
+	}
+	k.modTime, k.cert = fi.ModTime(), &cert
+	return k.cert, nil
+}
@@ -0,0 +1,17 @@
+package prometheus
+
+import "fmt"
+
+// MillisecondsPer returns how many milliseconds one unit of a latency query
+// result is: "s" (or "") 1000, "ms" 1, "us" 0.001.
+func MillisecondsPer(unit string) (float64, error) {
+	switch unit {
+	case "", "s":
+		return 1000, nil
+	case "ms":
+		return 1, nil
+	case "us":
+		return 0.001, nil
+	}
+	return 0, fmt.Errorf("unknown latency unit %q (want s, ms or us)", unit)
+}
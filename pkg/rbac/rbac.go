@@ -0,0 +1,250 @@
+// Package rbac is the single source of truth for the Kubernetes permissions
+// lead-net-affinity uses. The same table drives the generated Role/ClusterRole
+// manifests and the startup capability check, so features degrade cleanly
+// when a permission is not granted.
+package rbac
+
+import (
+	"bytes"
+
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// Feature is a controller capability that needs its own set of permissions.
+type Feature string
+
+const (
+	FeatureCore          Feature = "core"           // read deployments and pods
+	FeatureApplyAffinity Feature = "apply-affinity" // write affinity into deployments
+	FeatureRebalance     Feature = "rebalance"      // delete pods stuck on bad nodes
+	FeatureNodes         Feature = "nodes"          // node IPs, zones and readiness
+	FeatureStatus        Feature = "status"         // LeadNetAffinityStatus resource
+	FeatureOutput        Feature = "output"         // export generated patches to a ConfigMap
+	FeatureDNSInference  Feature = "dns-inference"  // read CoreDNS logs to infer edges
+	FeatureTaintNodes    Feature = "taint-nodes"    // taint bad nodes (rebalancing.badNodeMode=taint)
+	FeatureServicePorts  Feature = "service-ports"  // read Services for service ports and protocols
+	FeatureArgoRollouts  Feature = "argo-rollouts"  // read and update Argo Rollouts (controller.argoRollouts)
+	FeatureHPA           Feature = "hpa"            // read HorizontalPodAutoscalers, so surges skip their Deployments
+)
+
+// AllFeatures lists every feature in the order manifests are rendered.
+var AllFeatures = []Feature{FeatureCore, FeatureApplyAffinity, FeatureRebalance, FeatureNodes, FeatureStatus, FeatureOutput, FeatureDNSInference, FeatureTaintNodes, FeatureServicePorts, FeatureArgoRollouts, FeatureHPA}
+
+// Permission is one API group/resource grant needed by a feature.
+type Permission struct {
+	Feature       Feature
+	APIGroup      string
+	Resource      string // may include a subresource, e.g. "pods/status"
+	Verbs         []string
+	ClusterScoped bool
+}
+
+// Permissions is the full permission table.
+var Permissions = []Permission{
+	{Feature: FeatureCore, APIGroup: "apps", Resource: "deployments", Verbs: []string{"get", "list", "watch"}},
+	{Feature: FeatureCore, APIGroup: "", Resource: "pods", Verbs: []string{"get", "list", "watch"}},
+	{Feature: FeatureApplyAffinity, APIGroup: "apps", Resource: "deployments", Verbs: []string{"update", "patch"}},
+	{Feature: FeatureRebalance, APIGroup: "", Resource: "pods", Verbs: []string{"delete"}},
+	{Feature: FeatureNodes, APIGroup: "", Resource: "nodes", Verbs: []string{"get", "list", "watch"}, ClusterScoped: true},
+	{Feature: FeatureStatus, APIGroup: "lead.io", Resource: "leadnetaffinitystatuses", Verbs: []string{"get", "create", "update"}},
+	{Feature: FeatureStatus, APIGroup: "lead.io", Resource: "leadnetaffinitystatuses/status", Verbs: []string{"update"}},
+	{Feature: FeatureOutput, APIGroup: "", Resource: "configmaps", Verbs: []string{"get", "create", "update"}},
+	{Feature: FeatureDNSInference, APIGroup: "", Resource: "pods/log", Verbs: []string{"get"}},
+	{Feature: FeatureTaintNodes, APIGroup: "", Resource: "nodes", Verbs: []string{"update"}, ClusterScoped: true},
+	{Feature: FeatureServicePorts, APIGroup: "", Resource: "services", Verbs: []string{"get", "list"}},
+	{Feature: FeatureArgoRollouts, APIGroup: "argoproj.io", Resource: "rollouts", Verbs: []string{"get", "list", "update"}},
+	{Feature: FeatureHPA, APIGroup: "autoscaling", Resource: "horizontalpodautoscalers", Verbs: []string{"list"}},
+}
+
+// Capabilities records which features the controller's service account may
+// use. A nil Capabilities means "not detected" and allows everything.
+type Capabilities map[Feature]bool
+
+// Has reports whether f is allowed.
+func (c Capabilities) Has(f Feature) bool {
+	if c == nil {
+		return true
+	}
+	return c[f]
+}
+
+// Missing returns the features that are not allowed, in AllFeatures order.
+func (c Capabilities) Missing() []Feature {
+	var out []Feature
+	for _, f := range AllFeatures {
+		if !c.Has(f) {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+// PermissionsFor returns the permissions needed by the given features.
+func PermissionsFor(features ...Feature) []Permission {
+	want := make(map[Feature]bool, len(features))
+	for _, f := range features {
+		want[f] = true
+	}
+	var out []Permission
+	for _, p := range Permissions {
+		if want[p.Feature] {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// Rules converts permissions into policy rules, merging verbs per resource.
+func Rules(perms []Permission) []rbacv1.PolicyRule {
+	type key struct{ group, resource string }
+	var order []key
+	verbs := make(map[key][]string)
+	for _, p := range perms {
+		k := key{p.APIGroup, p.Resource}
+		if _, ok := verbs[k]; !ok {
+			order = append(order, k)
+		}
+		for _, v := range p.Verbs {
+			if !containsVerb(verbs[k], v) {
+				verbs[k] = append(verbs[k], v)
+			}
+		}
+	}
+
+	rules := make([]rbacv1.PolicyRule, 0, len(order))
+	for _, k := range order {
+		rules = append(rules, rbacv1.PolicyRule{
+			APIGroups: []string{k.group},
+			Resources: []string{k.resource},
+			Verbs:     verbs[k],
+		})
+	}
+	return rules
+}
+
+// ClusterRole builds the ClusterRole granting the given features.
+func ClusterRole(name string, features ...Feature) *rbacv1.ClusterRole {
+	return &rbacv1.ClusterRole{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "rbac.authorization.k8s.io/v1", Kind: "ClusterRole"},
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Rules:      Rules(PermissionsFor(features...)),
+	}
+}
+
+// RulesYAML renders just the ClusterRole rules for the given features (all
+// when none are given). The Helm chart embeds this as files/rbac-rules.yaml.
+func RulesYAML(features ...Feature) ([]byte, error) {
+	if len(features) == 0 {
+		features = AllFeatures
+	}
+	return yaml.Marshal(Rules(PermissionsFor(features...)))
+}
+
+// Manifests renders the ServiceAccount, ClusterRole and ClusterRoleBinding
+// for the controller as a multi-document YAML stream.
+func Manifests(name, namespace string, features ...Feature) ([]byte, error) {
+	if len(features) == 0 {
+		features = AllFeatures
+	}
+	objs := []interface{}{
+		&corev1.ServiceAccount{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ServiceAccount"},
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+		},
+		ClusterRole(name, features...),
+		&rbacv1.ClusterRoleBinding{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "rbac.authorization.k8s.io/v1", Kind: "ClusterRoleBinding"},
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "ClusterRole", Name: name},
+			Subjects:   []rbacv1.Subject{{Kind: rbacv1.ServiceAccountKind, Name: name, Namespace: namespace}},
+		},
+	}
+	return renderYAML(objs)
+}
+
+// NamespacedManifests renders the ServiceAccount plus a Role and RoleBinding
+// in each of the given namespaces, for clusters where the controller may not
+// hold cluster-wide permissions. Cluster-scoped permissions (nodes) are left
+// out; run the controller in namespace-scoped mode with these. The status
+// resource lives in the ServiceAccount's namespace, which gets a status-only
+// Role if it is not one of the watched namespaces.
+func NamespacedManifests(name, namespace string, namespaces []string, features ...Feature) ([]byte, error) {
+	if len(features) == 0 {
+		features = AllFeatures
+	}
+	var perms []Permission
+	for _, p := range PermissionsFor(features...) {
+		if !p.ClusterScoped {
+			perms = append(perms, p)
+		}
+	}
+
+	objs := []interface{}{
+		&corev1.ServiceAccount{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ServiceAccount"},
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+		},
+	}
+	addRole := func(ns string, rules []rbacv1.PolicyRule) {
+		objs = append(objs,
+			&rbacv1.Role{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "rbac.authorization.k8s.io/v1", Kind: "Role"},
+				ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: ns},
+				Rules:      rules,
+			},
+			&rbacv1.RoleBinding{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "rbac.authorization.k8s.io/v1", Kind: "RoleBinding"},
+				ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: ns},
+				RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "Role", Name: name},
+				Subjects:   []rbacv1.Subject{{Kind: rbacv1.ServiceAccountKind, Name: name, Namespace: namespace}},
+			},
+		)
+	}
+
+	ownNamespaceCovered := false
+	for _, ns := range namespaces {
+		addRole(ns, Rules(perms))
+		if ns == namespace {
+			ownNamespaceCovered = true
+		}
+	}
+	if !ownNamespaceCovered {
+		var status []Permission
+		for _, p := range perms {
+			if p.Feature == FeatureStatus {
+				status = append(status, p)
+			}
+		}
+		if len(status) > 0 {
+			addRole(namespace, Rules(status))
+		}
+	}
+	return renderYAML(objs)
+}
+
+func renderYAML(objs []interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	for i, o := range objs {
+		if i > 0 {
+			buf.WriteString("---\n")
+		}
+		b, err := yaml.Marshal(o)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(b)
+	}
+	return buf.Bytes(), nil
+}
+
+func containsVerb(verbs []string, v string) bool {
+	for _, x := range verbs {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
@@ -10,9 +10,80 @@ import (
 	"lead-net-affinity/pkg/graph"
 )
 
+const (
+	HostnameTopologyKey = "kubernetes.io/hostname"
+	ZoneTopologyKey     = "topology.kubernetes.io/zone"
+)
+
+// EdgeLatencyFunc returns the measured caller -> callee latency (ms) for an edge.
+type EdgeLatencyFunc func(src, dst graph.NodeID) (float64, bool)
+
 type AffinityConfig struct {
 	MinAffinityWeight int
 	MaxAffinityWeight int
+
+	// Optional pairwise latency source. When set, slow edges get a weight boost
+	// toward MaxAffinityWeight, and edges already faster than ZoneLatencyMs
+	// only ask for zone-level co-location instead of same-node.
+	EdgeLatency      EdgeLatencyFunc
+	BadEdgeLatencyMs float64
+	ZoneLatencyMs    float64
+
+	// Optional per-edge confidence (0..1) the edge weight is scaled by, so
+	// inferred edges ask for less co-location than declared ones.
+	EdgeConfidence func(src, dst graph.NodeID) float64
+
+	// PodSelector returns the labels selecting a service's pods (see
+	// kube.ServiceIdentity.PodSelector); nil uses the deployment's whole
+	// pod template labels.
+	PodSelector func(svc graph.NodeID, template map[string]string) map[string]string
+}
+
+// selector returns the label selector of a term toward svc's pods.
+func (cfg AffinityConfig) selector(svc graph.NodeID, d *appsv1.Deployment) *metav1.LabelSelector {
+	lbls := d.Spec.Template.Labels
+	if cfg.PodSelector != nil {
+		lbls = cfg.PodSelector(svc, lbls)
+	}
+	return &metav1.LabelSelector{MatchLabels: lbls}
+}
+
+// edgeWeightAndTopology adjusts the path weight for a single edge using the
+// pairwise latency (if known) and picks the topology key for the rule.
+func edgeWeightAndTopology(cfg AffinityConfig, src, dst graph.NodeID, w int) (int32, string) {
+	if cfg.EdgeConfidence != nil {
+		if f := cfg.EdgeConfidence(src, dst); f < 1 {
+			w = int(float64(w) * f)
+			if w < 1 {
+				w = 1
+			}
+			log.Printf("[lead-net][affinity] edge %s -> %s confidence=%.2f scaled weight=%d", src, dst, f, w)
+		}
+	}
+
+	topologyKey := HostnameTopologyKey
+	if cfg.EdgeLatency == nil {
+		return int32(w), topologyKey
+	}
+	lat, ok := cfg.EdgeLatency(src, dst)
+	if !ok {
+		return int32(w), topologyKey
+	}
+
+	if cfg.BadEdgeLatencyMs > 0 && w < cfg.MaxAffinityWeight {
+		ratio := lat / cfg.BadEdgeLatencyMs
+		if ratio > 1 {
+			ratio = 1
+		}
+		w += int(ratio * float64(cfg.MaxAffinityWeight-w))
+	}
+	if cfg.ZoneLatencyMs > 0 && lat <= cfg.ZoneLatencyMs {
+		topologyKey = ZoneTopologyKey
+	}
+
+	log.Printf("[lead-net][affinity] edge %s -> %s latency_ms=%.2f weight=%d topologyKey=%s",
+		src, dst, lat, w, topologyKey)
+	return int32(w), topologyKey
 }
 
 // GenerateAffinityForPath adds preferred podAffinity between adjacent services on a path.
@@ -67,14 +138,13 @@ func GenerateAffinityForPath(
 			continue
 		}
 
-		selector := &metav1.LabelSelector{
-			MatchLabels: dA.Spec.Template.Labels,
-		}
+		selector := cfg.selector(a, dA)
 
+		edgeWeight, topologyKey := edgeWeightAndTopology(cfg, a, b, w)
 		term := corev1.WeightedPodAffinityTerm{
-			Weight: int32(w),
+			Weight: edgeWeight,
 			PodAffinityTerm: corev1.PodAffinityTerm{
-				TopologyKey:   "kubernetes.io/hostname",
+				TopologyKey:   topologyKey,
 				LabelSelector: selector,
 			},
 		}
@@ -98,7 +168,7 @@ func GenerateAffinityForPath(
 
 		// Log the changes being made to PodAffinity
 		log.Printf("[lead-net][affinity] adding podAffinity: from service=%s (deployment=%s/%s) to service=%s (deployment=%s/%s) weight=%d",
-			a, dA.Namespace, dA.Name, b, dB.Namespace, dB.Name, w)
+			a, dA.Namespace, dA.Name, b, dB.Namespace, dB.Name, edgeWeight)
 
 		// Append the affinity rule
 		dB.Spec.Template.Spec.Affinity.PodAffinity.
@@ -116,123 +186,19 @@ func GenerateAffinityForPath(
 }
 
 // GenerateCleanAffinityForPath is an alternative implementation that completely replaces
-// all affinity rules for a deployment with a clean set based on the current path
+// all affinity rules for a deployment with a clean set based on the current path.
+// Reconciles combine several paths and sources with an AffinityPlan instead.
 func GenerateCleanAffinityForPath(
 	deploys map[graph.NodeID]*appsv1.Deployment,
 	path graph.Path,
 	pathScore float64,
 	cfg AffinityConfig,
 ) {
-	if len(path.Nodes) < 2 {
-		log.Printf("[lead-net][affinity] path too short for affinity: %v", path.Nodes)
-		return
-	}
-
 	log.Printf("[lead-net][affinity] generating clean affinity for path=%v score=%.2f cfg=%+v",
 		path.Nodes, pathScore, cfg)
-
-	// Scale normalized [0,100] to [MinAffinityWeight, MaxAffinityWeight]
-	if cfg.MaxAffinityWeight <= 0 {
-		cfg.MaxAffinityWeight = 100
-	}
-	if cfg.MinAffinityWeight < 0 {
-		cfg.MinAffinityWeight = 0
-	}
-	w := cfg.MinAffinityWeight +
-		int(pathScore/100.0*float64(cfg.MaxAffinityWeight-cfg.MinAffinityWeight))
-	if w <= 0 {
-		log.Printf("[lead-net][affinity] computed weight<=0 (%d) for path=%v; skipping", w, path.Nodes)
-		return
-	}
-
-	log.Printf("[lead-net][affinity] computed affinity weight=%d for path=%v", w, path.Nodes)
-
-	// First, collect all affinity rules for this path
-	type affinityRule struct {
-		targetDeployment *appsv1.Deployment
-		sourceService    graph.NodeID
-		weight           int32
-		selector         *metav1.LabelSelector
-	}
-
-	var rules []affinityRule
-
-	for i := 0; i < len(path.Nodes)-1; i++ {
-		a := path.Nodes[i]
-		b := path.Nodes[i+1]
-
-		dA, okA := deploys[a]
-		dB, okB := deploys[b]
-		if !okA || !okB {
-			log.Printf("[lead-net][affinity] missing deployments for edge %s -> %s (okA=%v okB=%v); skipping",
-				a, b, okA, okB)
-			continue
-		}
-		if dA.Spec.Template.Labels == nil || len(dA.Spec.Template.Labels) == 0 {
-			log.Printf("[lead-net][affinity] deployment %s/%s has no template labels; cannot create selector for path edge %s -> %s",
-				dA.Namespace, dA.Name, a, b)
-			continue
-		}
-
-		selector := &metav1.LabelSelector{
-			MatchLabels: dA.Spec.Template.Labels,
-		}
-
-		rules = append(rules, affinityRule{
-			targetDeployment: dB,
-			sourceService:    a,
-			weight:           int32(w),
-			selector:         selector,
-		})
-	}
-
-	// Now apply all rules to each target deployment
-	targetDeployments := make(map[*appsv1.Deployment][]affinityRule)
-	for _, rule := range rules {
-		targetDeployments[rule.targetDeployment] = append(targetDeployments[rule.targetDeployment], rule)
-	}
-
-	for targetDeploy, deployRules := range targetDeployments {
-		// Ensure Affinity & PodAffinity objects exist
-		if targetDeploy.Spec.Template.Spec.Affinity == nil {
-			targetDeploy.Spec.Template.Spec.Affinity = &corev1.Affinity{}
-		}
-		if targetDeploy.Spec.Template.Spec.Affinity.PodAffinity == nil {
-			targetDeploy.Spec.Template.Spec.Affinity.PodAffinity = &corev1.PodAffinity{}
-		}
-
-		// Clear all existing rules
-		log.Printf("[lead-net][affinity] clearing all existing podAffinity rules for deployment %s/%s",
-			targetDeploy.Namespace, targetDeploy.Name)
-		targetDeploy.Spec.Template.Spec.Affinity.PodAffinity.
-			PreferredDuringSchedulingIgnoredDuringExecution = nil
-
-		// Add all new rules for this deployment
-		for _, rule := range deployRules {
-			term := corev1.WeightedPodAffinityTerm{
-				Weight: rule.weight,
-				PodAffinityTerm: corev1.PodAffinityTerm{
-					TopologyKey:   "kubernetes.io/hostname",
-					LabelSelector: rule.selector,
-				},
-			}
-
-			log.Printf("[lead-net][affinity] adding podAffinity: from service=%s to deployment=%s/%s weight=%d",
-				rule.sourceService, targetDeploy.Namespace, targetDeploy.Name, rule.weight)
-
-			targetDeploy.Spec.Template.Spec.Affinity.PodAffinity.
-				PreferredDuringSchedulingIgnoredDuringExecution =
-				append(
-					targetDeploy.Spec.Template.Spec.Affinity.PodAffinity.
-						PreferredDuringSchedulingIgnoredDuringExecution,
-					term,
-				)
-		}
-
-		log.Printf("[lead-net][affinity] deployment %s/%s now has %d podAffinity rules",
-			targetDeploy.Namespace, targetDeploy.Name,
-			len(targetDeploy.Spec.Template.Spec.Affinity.PodAffinity.PreferredDuringSchedulingIgnoredDuringExecution))
-	}
+	var plan AffinityPlan
+	plan.AddPath(deploys, path, pathScore, cfg)
+	plan.Apply(deploys, WeightBudget{})
 }
 
 // AddAntiAffinityForBadLink adds soft anti-affinity against pods with given labels.
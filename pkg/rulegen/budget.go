@@ -0,0 +1,263 @@
+package rulegen
+
+import (
+	"log"
+	"sort"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"lead-net-affinity/pkg/graph"
+)
+
+// Sources of generated pod affinity terms, in default priority order.
+const (
+	SourcePath       = "path"       // edges of the top-ranked paths
+	SourceDependency = "dependency" // direct dependencies of a service
+)
+
+// WeightBudget bounds the preferred pod affinity of one service, so many
+// near-100 terms cannot outweigh the scheduler's other scoring.
+type WeightBudget struct {
+	// MaxTotalWeight caps the sum of a service's term weights; larger sums
+	// are scaled down proportionally. 0 = unlimited.
+	MaxTotalWeight int
+	// MaxTerms keeps only the first terms by priority and weight. 0 =
+	// unlimited.
+	MaxTerms int
+	// Priority orders sources, highest first. Sources not listed rank
+	// last; default SourcePath, SourceDependency.
+	Priority []string
+}
+
+func (b WeightBudget) rank(source string) int {
+	prio := b.Priority
+	if len(prio) == 0 {
+		prio = []string{SourcePath, SourceDependency}
+	}
+	for i, s := range prio {
+		if s == source {
+			return i
+		}
+	}
+	return len(prio)
+}
+
+// AffinityTerm is a generated preferred pod affinity term before the
+// terms of all sources are composed.
+type AffinityTerm struct {
+	Target      graph.NodeID // service whose deployment gets the term
+	Peer        graph.NodeID // service the term attracts it to
+	Source      string
+	Weight      int32
+	TopologyKey string
+	Selector    *metav1.LabelSelector
+	Reverse     bool // added by Mirror
+}
+
+// AffinityPlan collects the terms of every source during a reconcile and
+// writes them to the deployments at once, within a WeightBudget.
+type AffinityPlan struct {
+	terms []AffinityTerm
+}
+
+// Add records a term.
+func (p *AffinityPlan) Add(t AffinityTerm) {
+	p.terms = append(p.terms, t)
+}
+
+// Terms returns the recorded terms.
+func (p *AffinityPlan) Terms() []AffinityTerm {
+	return p.terms
+}
+
+// Mirror adds, for every term recorded so far, the reverse term: the peer
+// pulled toward the target at factor times the weight (at least 1), with
+// the same source and topology key. Whichever of two co-located
+// deployments restarts first is then pulled toward the other. Terms whose
+// peer has no deployment or template labels are not mirrored.
+func (p *AffinityPlan) Mirror(deploys map[graph.NodeID]*appsv1.Deployment, factor float64, cfg AffinityConfig) {
+	if factor <= 0 {
+		return
+	}
+	for _, t := range p.terms[:len(p.terms):len(p.terms)] {
+		if t.Reverse {
+			continue
+		}
+		dT, ok := deploys[t.Target]
+		if _, okPeer := deploys[t.Peer]; !ok || !okPeer || len(dT.Spec.Template.Labels) == 0 {
+			continue
+		}
+		w := int32(float64(t.Weight) * factor)
+		if w < 1 {
+			w = 1
+		}
+		if w > 100 {
+			w = 100
+		}
+		p.Add(AffinityTerm{
+			Target:      t.Peer,
+			Peer:        t.Target,
+			Source:      t.Source,
+			Weight:      w,
+			TopologyKey: t.TopologyKey,
+			Selector:    cfg.selector(t.Target, dT),
+			Reverse:     true,
+		})
+	}
+}
+
+// AddPath records a term toward its predecessor for every service on the
+// path, weighted by the normalized path score as GenerateCleanAffinityForPath
+// does.
+func (p *AffinityPlan) AddPath(
+	deploys map[graph.NodeID]*appsv1.Deployment,
+	path graph.Path,
+	pathScore float64,
+	cfg AffinityConfig,
+) {
+	if len(path.Nodes) < 2 {
+		log.Printf("[lead-net][affinity] path too short for affinity: %v", path.Nodes)
+		return
+	}
+
+	// Scale normalized [0,100] to [MinAffinityWeight, MaxAffinityWeight]
+	if cfg.MaxAffinityWeight <= 0 {
+		cfg.MaxAffinityWeight = 100
+	}
+	if cfg.MinAffinityWeight < 0 {
+		cfg.MinAffinityWeight = 0
+	}
+	w := cfg.MinAffinityWeight +
+		int(pathScore/100.0*float64(cfg.MaxAffinityWeight-cfg.MinAffinityWeight))
+	if w <= 0 {
+		log.Printf("[lead-net][affinity] computed weight<=0 (%d) for path=%v; skipping", w, path.Nodes)
+		return
+	}
+	log.Printf("[lead-net][affinity] computed affinity weight=%d for path=%v", w, path.Nodes)
+
+	for i := 0; i < len(path.Nodes)-1; i++ {
+		a := path.Nodes[i]
+		b := path.Nodes[i+1]
+
+		dA, okA := deploys[a]
+		_, okB := deploys[b]
+		if !okA || !okB {
+			log.Printf("[lead-net][affinity] missing deployments for edge %s -> %s (okA=%v okB=%v); skipping",
+				a, b, okA, okB)
+			continue
+		}
+		if len(dA.Spec.Template.Labels) == 0 {
+			log.Printf("[lead-net][affinity] deployment %s/%s has no template labels; cannot create selector for path edge %s -> %s",
+				dA.Namespace, dA.Name, a, b)
+			continue
+		}
+
+		edgeWeight, topologyKey := edgeWeightAndTopology(cfg, a, b, w)
+		p.Add(AffinityTerm{
+			Target:      b,
+			Peer:        a,
+			Source:      SourcePath,
+			Weight:      edgeWeight,
+			TopologyKey: topologyKey,
+			Selector:    cfg.selector(a, dA),
+		})
+	}
+}
+
+// Compose merges the terms per target service: duplicates (same peer and
+// topology key) keep their highest weight, terms are ordered by source
+// priority and weight, and the budget's term count and total weight are
+// enforced.
+func (p *AffinityPlan) Compose(budget WeightBudget) map[graph.NodeID][]AffinityTerm {
+	type key struct {
+		target, peer graph.NodeID
+		topologyKey  string
+	}
+	merged := make(map[key]AffinityTerm)
+	var order []key
+	for _, t := range p.terms {
+		k := key{t.Target, t.Peer, t.TopologyKey}
+		cur, ok := merged[k]
+		if !ok {
+			order = append(order, k)
+		}
+		if !ok || t.Weight > cur.Weight ||
+			(t.Weight == cur.Weight && budget.rank(t.Source) < budget.rank(cur.Source)) {
+			merged[k] = t
+		}
+	}
+
+	out := make(map[graph.NodeID][]AffinityTerm)
+	for _, k := range order {
+		out[k.target] = append(out[k.target], merged[k])
+	}
+	for target, terms := range out {
+		sort.SliceStable(terms, func(i, j int) bool {
+			ri, rj := budget.rank(terms[i].Source), budget.rank(terms[j].Source)
+			if ri != rj {
+				return ri < rj
+			}
+			if terms[i].Weight != terms[j].Weight {
+				return terms[i].Weight > terms[j].Weight
+			}
+			return terms[i].Peer < terms[j].Peer
+		})
+		if budget.MaxTerms > 0 && len(terms) > budget.MaxTerms {
+			log.Printf("[lead-net][affinity] service=%s has %d terms; keeping %d", target, len(terms), budget.MaxTerms)
+			terms = terms[:budget.MaxTerms]
+		}
+		total := 0
+		for _, t := range terms {
+			total += int(t.Weight)
+		}
+		if budget.MaxTotalWeight > 0 && total > budget.MaxTotalWeight {
+			scale := float64(budget.MaxTotalWeight) / float64(total)
+			for i := range terms {
+				w := int32(float64(terms[i].Weight) * scale)
+				if w < 1 {
+					w = 1
+				}
+				terms[i].Weight = w
+			}
+			log.Printf("[lead-net][affinity] service=%s total weight %d over budget %d; scaled by %.2f",
+				target, total, budget.MaxTotalWeight, scale)
+		}
+		out[target] = terms
+	}
+	return out
+}
+
+// Apply replaces the preferred pod affinity of every target deployment
+// with its composed terms. Deployments without terms are left alone.
+func (p *AffinityPlan) Apply(deploys map[graph.NodeID]*appsv1.Deployment, budget WeightBudget) {
+	for target, terms := range p.Compose(budget) {
+		d, ok := deploys[target]
+		if !ok {
+			continue
+		}
+		if d.Spec.Template.Spec.Affinity == nil {
+			d.Spec.Template.Spec.Affinity = &corev1.Affinity{}
+		}
+		if d.Spec.Template.Spec.Affinity.PodAffinity == nil {
+			d.Spec.Template.Spec.Affinity.PodAffinity = &corev1.PodAffinity{}
+		}
+		pa := d.Spec.Template.Spec.Affinity.PodAffinity
+		pa.PreferredDuringSchedulingIgnoredDuringExecution = nil
+		for _, t := range terms {
+			log.Printf("[lead-net][affinity] adding podAffinity: from service=%s to deployment=%s/%s weight=%d source=%s reverse=%v",
+				t.Peer, d.Namespace, d.Name, t.Weight, t.Source, t.Reverse)
+			pa.PreferredDuringSchedulingIgnoredDuringExecution = append(pa.PreferredDuringSchedulingIgnoredDuringExecution,
+				corev1.WeightedPodAffinityTerm{
+					Weight: t.Weight,
+					PodAffinityTerm: corev1.PodAffinityTerm{
+						TopologyKey:   t.TopologyKey,
+						LabelSelector: t.Selector,
+					},
+				})
+		}
+		log.Printf("[lead-net][affinity] deployment %s/%s now has %d podAffinity rules",
+			d.Namespace, d.Name, len(pa.PreferredDuringSchedulingIgnoredDuringExecution))
+	}
+}
@@ -0,0 +1,137 @@
+package rulegen
+
+import (
+	"log"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"lead-net-affinity/pkg/kube"
+)
+
+// DefaultCPUManagerNodeLabel marks nodes whose kubelet runs the static CPU
+// manager policy. Kubernetes has no built-in label for this; label the
+// nodes yourself or configure another one.
+const DefaultCPUManagerNodeLabel = "lead.io/cpu-manager-policy=static"
+
+// cpuManagerNodeWeight is the node affinity weight for CPU-manager nodes.
+const cpuManagerNodeWeight int32 = 100
+
+// ApplyLatencyCritical prepares a deployment for exclusive CPUs under the
+// static CPU manager:
+//
+//   - every container gets Guaranteed QoS (requests == limits) with a whole
+//     number of CPUs, rounding the larger of request and limit up, and the
+//     deployment is marked with kube.GuaranteedCPUsAnnotation so updates
+//     keep these resources;
+//   - pods prefer nodes carrying nodeLabel ("key=value").
+//
+// Guaranteed QoS needs a memory amount for every container; if one has
+// none, resources are left alone (with a log line) and only the node
+// preference is added.
+func ApplyLatencyCritical(d *appsv1.Deployment, nodeLabel string) {
+	spec := &d.Spec.Template.Spec
+
+	if missing := containersWithoutMemory(spec); len(missing) > 0 {
+		log.Printf("[lead-net][cpu-manager] %s/%s: containers %v have no memory request or limit; cannot make QoS Guaranteed",
+			d.Namespace, d.Name, missing)
+	} else {
+		for i := range spec.InitContainers {
+			guaranteeWholeCPUs(&spec.InitContainers[i].Resources)
+		}
+		for i := range spec.Containers {
+			guaranteeWholeCPUs(&spec.Containers[i].Resources)
+		}
+		if d.Annotations == nil {
+			d.Annotations = make(map[string]string)
+		}
+		d.Annotations[kube.GuaranteedCPUsAnnotation] = "true"
+		log.Printf("[lead-net][cpu-manager] %s/%s: set Guaranteed QoS with whole CPUs", d.Namespace, d.Name)
+	}
+
+	if nodeLabel == "" {
+		nodeLabel = DefaultCPUManagerNodeLabel
+	}
+	key, value, _ := strings.Cut(nodeLabel, "=")
+	preferNodeLabel(d, key, value)
+}
+
+func containersWithoutMemory(spec *corev1.PodSpec) []string {
+	var out []string
+	all := append(append([]corev1.Container{}, spec.InitContainers...), spec.Containers...)
+	for _, c := range all {
+		_, req := c.Resources.Requests[corev1.ResourceMemory]
+		_, lim := c.Resources.Limits[corev1.ResourceMemory]
+		if !req && !lim {
+			out = append(out, c.Name)
+		}
+	}
+	return out
+}
+
+// guaranteeWholeCPUs sets requests == limits for CPU and memory, with CPU
+// rounded up to whole cores (at least one).
+func guaranteeWholeCPUs(r *corev1.ResourceRequirements) {
+	if r.Requests == nil {
+		r.Requests = corev1.ResourceList{}
+	}
+	if r.Limits == nil {
+		r.Limits = corev1.ResourceList{}
+	}
+
+	cpu := maxQuantity(r.Requests[corev1.ResourceCPU], r.Limits[corev1.ResourceCPU])
+	cores := (cpu.MilliValue() + 999) / 1000
+	if cores < 1 {
+		cores = 1
+	}
+	whole := *resource.NewQuantity(cores, resource.DecimalSI)
+	r.Requests[corev1.ResourceCPU] = whole
+	r.Limits[corev1.ResourceCPU] = whole
+
+	mem := maxQuantity(r.Requests[corev1.ResourceMemory], r.Limits[corev1.ResourceMemory])
+	r.Requests[corev1.ResourceMemory] = mem
+	r.Limits[corev1.ResourceMemory] = mem
+}
+
+func maxQuantity(a, b resource.Quantity) resource.Quantity {
+	if a.Cmp(b) >= 0 {
+		return a
+	}
+	return b
+}
+
+// preferNodeLabel adds (or replaces) a preferred node affinity term for
+// nodes with key=value (key only: the label exists).
+func preferNodeLabel(d *appsv1.Deployment, key, value string) {
+	if d.Spec.Template.Spec.Affinity == nil {
+		d.Spec.Template.Spec.Affinity = &corev1.Affinity{}
+	}
+	if d.Spec.Template.Spec.Affinity.NodeAffinity == nil {
+		d.Spec.Template.Spec.Affinity.NodeAffinity = &corev1.NodeAffinity{}
+	}
+	na := d.Spec.Template.Spec.Affinity.NodeAffinity
+
+	req := corev1.NodeSelectorRequirement{Key: key, Operator: corev1.NodeSelectorOpExists}
+	if value != "" {
+		req = corev1.NodeSelectorRequirement{Key: key, Operator: corev1.NodeSelectorOpIn, Values: []string{value}}
+	}
+
+	kept := na.PreferredDuringSchedulingIgnoredDuringExecution[:0]
+	for _, term := range na.PreferredDuringSchedulingIgnoredDuringExecution {
+		same := false
+		for _, expr := range term.Preference.MatchExpressions {
+			if expr.Key == key {
+				same = true
+			}
+		}
+		if !same {
+			kept = append(kept, term)
+		}
+	}
+	na.PreferredDuringSchedulingIgnoredDuringExecution = append(kept, corev1.PreferredSchedulingTerm{
+		Weight:     cpuManagerNodeWeight,
+		Preference: corev1.NodeSelectorTerm{MatchExpressions: []corev1.NodeSelectorRequirement{req}},
+	})
+}
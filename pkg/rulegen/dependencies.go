@@ -0,0 +1,75 @@
+package rulegen
+
+import (
+	"log"
+	"sort"
+
+	appsv1 "k8s.io/api/apps/v1"
+
+	"lead-net-affinity/pkg/graph"
+)
+
+// DefaultDependencyWeight is the weight of direct-dependency terms.
+const DefaultDependencyWeight = 80
+
+// DependencyConfig tunes the terms AddDependencies generates.
+type DependencyConfig struct {
+	Weight  int             // default DefaultDependencyWeight
+	Exclude map[string]bool // services that get and attract no terms
+}
+
+// AddDependencies records, for every declared or inferred dependency of a
+// graph service, a term pulling the dependency toward its caller, whether
+// or not the edge is on a top-ranked path. Edge latency and confidence
+// adjust the weight as for path terms.
+func (p *AffinityPlan) AddDependencies(
+	deploys map[graph.NodeID]*appsv1.Deployment,
+	g *graph.Graph,
+	dc DependencyConfig,
+	cfg AffinityConfig,
+) {
+	w := dc.Weight
+	if w <= 0 {
+		w = DefaultDependencyWeight
+	}
+	if cfg.MaxAffinityWeight <= 0 {
+		cfg.MaxAffinityWeight = 100
+	}
+	if w > cfg.MaxAffinityWeight {
+		w = cfg.MaxAffinityWeight
+	}
+
+	ids := make([]graph.NodeID, 0, len(g.Nodes))
+	for id := range g.Nodes {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	for _, caller := range ids {
+		if dc.Exclude[string(caller)] {
+			continue
+		}
+		dCaller, ok := deploys[caller]
+		if !ok || len(dCaller.Spec.Template.Labels) == 0 {
+			continue
+		}
+		for _, dep := range g.Nodes[caller].DependsOn {
+			if dc.Exclude[string(dep)] {
+				log.Printf("[lead-net][affinity] dependency %s -> %s excluded", caller, dep)
+				continue
+			}
+			if _, ok := deploys[dep]; !ok {
+				continue
+			}
+			edgeWeight, topologyKey := edgeWeightAndTopology(cfg, caller, dep, w)
+			p.Add(AffinityTerm{
+				Target:      dep,
+				Peer:        caller,
+				Source:      SourceDependency,
+				Weight:      edgeWeight,
+				TopologyKey: topologyKey,
+				Selector:    cfg.selector(caller, dCaller),
+			})
+		}
+	}
+}
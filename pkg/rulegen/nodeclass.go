@@ -0,0 +1,149 @@
+package rulegen
+
+import (
+	"log"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// DefaultSpotNodeLabels are the labels the major managed offerings put on
+// spot/preemptible nodes.
+var DefaultSpotNodeLabels = []string{
+	"eks.amazonaws.com/capacityType=SPOT",
+	"karpenter.sh/capacity-type=spot",
+	"cloud.google.com/gke-spot=true",
+	"cloud.google.com/gke-preemptible=true",
+	"kubernetes.azure.com/scalesetpriority=spot",
+}
+
+// avoidSpotWeight is the preference weight used when spot avoidance is
+// not required.
+const avoidSpotWeight int32 = 100
+
+// nodeLabel is a parsed "key=value" node label.
+type nodeLabel struct{ key, value string }
+
+func parseNodeLabels(labels []string) []nodeLabel {
+	if len(labels) == 0 {
+		labels = DefaultSpotNodeLabels
+	}
+	out := make([]nodeLabel, 0, len(labels))
+	for _, l := range labels {
+		k, v, _ := strings.Cut(l, "=")
+		out = append(out, nodeLabel{k, v})
+	}
+	return out
+}
+
+// AvoidSpotNodes keeps a deployment off spot nodes (any of spotLabels):
+// as a required NotIn rule when required is set, otherwise as a strong
+// preference. Earlier spot rules are replaced.
+func AvoidSpotNodes(d *appsv1.Deployment, spotLabels []string, required bool) {
+	labels := parseNodeLabels(spotLabels)
+	na := clearSpotRules(d, labels)
+
+	var exprs []corev1.NodeSelectorRequirement
+	for _, l := range labels {
+		exprs = append(exprs, corev1.NodeSelectorRequirement{Key: l.key, Operator: corev1.NodeSelectorOpNotIn, Values: []string{l.value}})
+	}
+
+	if required {
+		// Terms are ORed, so the NotIn requirements are ANDed into each.
+		if na.RequiredDuringSchedulingIgnoredDuringExecution == nil {
+			na.RequiredDuringSchedulingIgnoredDuringExecution = &corev1.NodeSelector{}
+		}
+		rs := na.RequiredDuringSchedulingIgnoredDuringExecution
+		if len(rs.NodeSelectorTerms) == 0 {
+			rs.NodeSelectorTerms = []corev1.NodeSelectorTerm{{}}
+		}
+		for i := range rs.NodeSelectorTerms {
+			rs.NodeSelectorTerms[i].MatchExpressions = append(rs.NodeSelectorTerms[i].MatchExpressions, exprs...)
+		}
+	} else {
+		na.PreferredDuringSchedulingIgnoredDuringExecution = append(na.PreferredDuringSchedulingIgnoredDuringExecution,
+			corev1.PreferredSchedulingTerm{Weight: avoidSpotWeight, Preference: corev1.NodeSelectorTerm{MatchExpressions: exprs}})
+	}
+	log.Printf("[lead-net][nodeclass] %s/%s: avoiding spot nodes (required=%v)", d.Namespace, d.Name, required)
+}
+
+// PreferSpotNodes lets a non-critical deployment prefer spot nodes (any of
+// spotLabels) with the given weight. Earlier spot rules are replaced; a
+// weight <= 0 only clears them.
+func PreferSpotNodes(d *appsv1.Deployment, spotLabels []string, weight int32) {
+	labels := parseNodeLabels(spotLabels)
+	na := clearSpotRules(d, labels)
+	if weight <= 0 {
+		return
+	}
+	if weight > 100 {
+		weight = 100
+	}
+	for _, l := range labels {
+		na.PreferredDuringSchedulingIgnoredDuringExecution = append(na.PreferredDuringSchedulingIgnoredDuringExecution,
+			corev1.PreferredSchedulingTerm{
+				Weight: weight,
+				Preference: corev1.NodeSelectorTerm{MatchExpressions: []corev1.NodeSelectorRequirement{
+					{Key: l.key, Operator: corev1.NodeSelectorOpIn, Values: []string{l.value}},
+				}},
+			})
+	}
+	log.Printf("[lead-net][nodeclass] %s/%s: preferring spot nodes weight=%d", d.Namespace, d.Name, weight)
+}
+
+// clearSpotRules removes every node affinity expression on a spot label
+// key, dropping terms that end up empty, and returns the node affinity.
+func clearSpotRules(d *appsv1.Deployment, labels []nodeLabel) *corev1.NodeAffinity {
+	if d.Spec.Template.Spec.Affinity == nil {
+		d.Spec.Template.Spec.Affinity = &corev1.Affinity{}
+	}
+	if d.Spec.Template.Spec.Affinity.NodeAffinity == nil {
+		d.Spec.Template.Spec.Affinity.NodeAffinity = &corev1.NodeAffinity{}
+	}
+	na := d.Spec.Template.Spec.Affinity.NodeAffinity
+
+	isSpot := func(key string) bool {
+		for _, l := range labels {
+			if l.key == key {
+				return true
+			}
+		}
+		return false
+	}
+	strip := func(exprs []corev1.NodeSelectorRequirement) []corev1.NodeSelectorRequirement {
+		var kept []corev1.NodeSelectorRequirement
+		for _, e := range exprs {
+			if !isSpot(e.Key) {
+				kept = append(kept, e)
+			}
+		}
+		return kept
+	}
+
+	var preferred []corev1.PreferredSchedulingTerm
+	for _, t := range na.PreferredDuringSchedulingIgnoredDuringExecution {
+		had := len(t.Preference.MatchExpressions) + len(t.Preference.MatchFields)
+		t.Preference.MatchExpressions = strip(t.Preference.MatchExpressions)
+		if had == 0 || len(t.Preference.MatchExpressions)+len(t.Preference.MatchFields) > 0 {
+			preferred = append(preferred, t)
+		}
+	}
+	na.PreferredDuringSchedulingIgnoredDuringExecution = preferred
+
+	if rs := na.RequiredDuringSchedulingIgnoredDuringExecution; rs != nil {
+		var terms []corev1.NodeSelectorTerm
+		for _, t := range rs.NodeSelectorTerms {
+			t.MatchExpressions = strip(t.MatchExpressions)
+			if len(t.MatchExpressions)+len(t.MatchFields) > 0 {
+				terms = append(terms, t)
+			}
+		}
+		if len(terms) == 0 {
+			na.RequiredDuringSchedulingIgnoredDuringExecution = nil
+		} else {
+			rs.NodeSelectorTerms = terms
+		}
+	}
+	return na
+}
@@ -0,0 +1,89 @@
+package rulegen
+
+import (
+	"log"
+	"sort"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ZoneSpread is a target distribution of a service's replicas over zones.
+type ZoneSpread struct {
+	// Weights are the node affinity weights (1-100) of the zones that
+	// should get replicas; the busiest zone has the highest.
+	Weights map[string]int32
+
+	// MaxSkew is the difference between the most and fewest replicas the
+	// plan puts in a zone, at least 1.
+	MaxSkew int32
+
+	// Selector labels the pods the spread constraint counts.
+	Selector map[string]string
+}
+
+// ApplyZoneSpread expresses s on d: a ScheduleAnyway topology spread
+// constraint over zones and one preferred node affinity term per zone (see
+// PreferZones). Earlier ScheduleAnyway zone constraints are replaced.
+func ApplyZoneSpread(d *appsv1.Deployment, s ZoneSpread) {
+	spec := &d.Spec.Template.Spec
+	var tsc []corev1.TopologySpreadConstraint
+	for _, c := range spec.TopologySpreadConstraints {
+		if c.TopologyKey != ZoneTopologyKey || c.WhenUnsatisfiable != corev1.ScheduleAnyway {
+			tsc = append(tsc, c)
+		}
+	}
+	spec.TopologySpreadConstraints = append(tsc, corev1.TopologySpreadConstraint{
+		MaxSkew:           max(s.MaxSkew, 1),
+		TopologyKey:       ZoneTopologyKey,
+		WhenUnsatisfiable: corev1.ScheduleAnyway,
+		LabelSelector:     &metav1.LabelSelector{MatchLabels: s.Selector},
+	})
+
+	PreferZones(d, s.Weights)
+	log.Printf("[lead-net][zonespread] %s/%s: zone weights=%v maxSkew=%d", d.Namespace, d.Name, s.Weights, s.MaxSkew)
+}
+
+// PreferZones sets one preferred node affinity term per zone with its
+// weight (clamped to 1-100), replacing earlier preferred terms on a single
+// zone.
+func PreferZones(d *appsv1.Deployment, weights map[string]int32) {
+	spec := &d.Spec.Template.Spec
+	if spec.Affinity == nil {
+		spec.Affinity = &corev1.Affinity{}
+	}
+	if spec.Affinity.NodeAffinity == nil {
+		spec.Affinity.NodeAffinity = &corev1.NodeAffinity{}
+	}
+	na := spec.Affinity.NodeAffinity
+	var preferred []corev1.PreferredSchedulingTerm
+	for _, t := range na.PreferredDuringSchedulingIgnoredDuringExecution {
+		if !zoneTerm(t) {
+			preferred = append(preferred, t)
+		}
+	}
+	zones := make([]string, 0, len(weights))
+	for z := range weights {
+		zones = append(zones, z)
+	}
+	sort.Strings(zones)
+	for _, z := range zones {
+		preferred = append(preferred, corev1.PreferredSchedulingTerm{
+			Weight: min(max(weights[z], 1), 100),
+			Preference: corev1.NodeSelectorTerm{MatchExpressions: []corev1.NodeSelectorRequirement{
+				{Key: ZoneTopologyKey, Operator: corev1.NodeSelectorOpIn, Values: []string{z}},
+			}},
+		})
+	}
+	na.PreferredDuringSchedulingIgnoredDuringExecution = preferred
+}
+
+// zoneTerm reports whether t prefers a single zone.
+func zoneTerm(t corev1.PreferredSchedulingTerm) bool {
+	p := t.Preference
+	return len(p.MatchFields) == 0 && len(p.MatchExpressions) == 1 &&
+		p.MatchExpressions[0].Key == ZoneTopologyKey &&
+		p.MatchExpressions[0].Operator == corev1.NodeSelectorOpIn &&
+		len(p.MatchExpressions[0].Values) == 1
+}
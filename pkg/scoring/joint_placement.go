@@ -0,0 +1,142 @@
+package scoring
+
+import (
+	"log"
+	"sort"
+
+	"lead-net-affinity/pkg/graph"
+)
+
+// EdgeWeightFunc returns the weight of the (undirected) edge between two services.
+type EdgeWeightFunc func(a, b graph.NodeID) float64
+
+// plannedView overlays planned (not yet scheduled) assignments on top of the
+// live placement view, so later services in a group are pulled toward nodes
+// chosen for earlier ones.
+type plannedView struct {
+	live    PlacementView
+	planned map[graph.NodeID]string
+}
+
+func (v plannedView) NodesForService(svc graph.NodeID) map[string]int {
+	var out map[string]int
+	if v.live != nil {
+		if live := v.live.NodesForService(svc); len(live) > 0 {
+			out = make(map[string]int, len(live)+1)
+			for n, c := range live {
+				out[n] = c
+			}
+		}
+	}
+	if n, ok := v.planned[svc]; ok {
+		if out == nil {
+			out = make(map[string]int, 1)
+		}
+		out[n]++
+	}
+	return out
+}
+
+func (v plannedView) ZoneForNode(node string) string {
+	if v.live == nil {
+		return ""
+	}
+	return v.live.ZoneForNode(node)
+}
+
+// PlanJointPlacement assigns every service of a co-dependent pending group to
+// a node at once, instead of letting early choices constrain later ones.
+//
+// Services are placed greedily, most anchored first: at each step the member
+// whose best candidate has the highest proximity score (against running pods
+// and already-planned members) is placed, ties going to the member with the
+// heaviest in-group edges. maxPerNode caps how many group members may
+// share a node (0 = unlimited). Ties and zero scores fall back to the least
+// used candidate so the plan is deterministic.
+func PlanJointPlacement(
+	group []graph.NodeID,
+	g *graph.Graph,
+	edgeWeight EdgeWeightFunc,
+	candidates []string,
+	view PlacementView,
+	w ProximityWeights,
+	maxPerNode int,
+) map[graph.NodeID]string {
+	plan := make(map[graph.NodeID]string, len(group))
+	if len(group) == 0 || len(candidates) == 0 || g == nil {
+		return plan
+	}
+	if edgeWeight == nil {
+		edgeWeight = func(_, _ graph.NodeID) float64 { return 1 }
+	}
+
+	inGroup := make(map[graph.NodeID]bool, len(group))
+	for _, s := range group {
+		inGroup[s] = true
+	}
+
+	groupWeight := make(map[graph.NodeID]float64, len(group))
+	for _, s := range group {
+		for _, n := range g.Neighbors(s) {
+			if inGroup[n] {
+				groupWeight[s] += edgeWeight(s, n)
+			}
+		}
+	}
+
+	sortedCandidates := append([]string(nil), candidates...)
+	sort.Strings(sortedCandidates)
+
+	used := make(map[string]int, len(candidates))
+	overlay := plannedView{live: view, planned: plan}
+
+	remaining := append([]graph.NodeID(nil), group...)
+	sort.Slice(remaining, func(i, j int) bool { return remaining[i] < remaining[j] })
+
+	for len(remaining) > 0 {
+		var open []string
+		for _, c := range sortedCandidates {
+			if maxPerNode <= 0 || used[c] < maxPerNode {
+				open = append(open, c)
+			}
+		}
+		if len(open) == 0 {
+			log.Printf("[lead-net][joint-plan] no open candidates left for %v (maxPerNode=%d)", remaining, maxPerNode)
+			break
+		}
+
+		// Place the most anchored service next: the one whose best node has
+		// the highest proximity score, then the one with the heaviest in-group edges.
+		pick, pickNode, pickScore := -1, "", 0.0
+		for i, svc := range remaining {
+			neighbors := make(map[graph.NodeID]float64)
+			for _, n := range g.Neighbors(svc) {
+				neighbors[n] = edgeWeight(svc, n)
+			}
+			scores := NodeProximityScores(svc, neighbors, open, overlay, w)
+			best := BestNode(scores)
+			score := scores[best]
+			if pick == -1 || score > pickScore ||
+				(score == pickScore && groupWeight[svc] > groupWeight[remaining[pick]]) {
+				pick, pickNode, pickScore = i, best, score
+			}
+		}
+
+		svc := remaining[pick]
+		if pickNode == "" {
+			pickNode = open[0]
+			for _, c := range open {
+				if used[c] < used[pickNode] {
+					pickNode = c
+				}
+			}
+		}
+
+		plan[svc] = pickNode
+		used[pickNode]++
+		remaining = append(remaining[:pick], remaining[pick+1:]...)
+		log.Printf("[lead-net][joint-plan] service=%s -> node=%s (score=%.2f)", svc, pickNode, pickScore)
+	}
+
+	return plan
+}
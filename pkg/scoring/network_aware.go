@@ -2,6 +2,8 @@ package scoring
 
 import (
 	"log"
+	"sort"
+	"time"
 
 	"lead-net-affinity/pkg/graph"
 	promnet "lead-net-affinity/pkg/prometheus"
@@ -15,14 +17,43 @@ type NetWeights struct {
 	BadLatencyMs     float64
 	BadDropRate      float64
 	BadBandwidthRate float64
+
+	EdgeLatencyWeight float64
+	BadEdgeLatencyMs  float64
+
+	// StaleAfter starts discounting metrics older than this (0 = never);
+	// see prometheus.Freshness.Discount.
+	StaleAfter time.Duration
+
+	// Limits bounds the metric samples; see Limits.
+	Limits Limits
+
+	// NodeAggregation combines the severities of the nodes running one
+	// service's pods (with a MultiNodePlacement): AggregateWorst (default)
+	// or AggregateWeighted.
+	NodeAggregation string
 }
 
+// Node severity aggregations across a service's pods.
+const (
+	AggregateWorst    = "worst"    // the worst node
+	AggregateWeighted = "weighted" // average weighted by pods per node
+)
+
 // PodPlacement is implemented by kube.PlacementResolver.
 type PodPlacement interface {
 	// NodeNameForService returns the node name (or empty string) for a service.
 	NodeNameForService(svc graph.NodeID) string
 }
 
+// MultiNodePlacement is implemented by placements that know every node a
+// service runs on (kube.PlacementResolver does).
+type MultiNodePlacement interface {
+	// NodesForService returns the nodes running pods of svc with the
+	// number of its pods on each.
+	NodesForService(svc graph.NodeID) map[string]int
+}
+
 // NodeIPResolver resolves a Kubernetes node name to an IP address that matches
 // the Prometheus "instance" label (e.g. 91.228.186.28).
 // Implemented on the controller side so scoring stays decoupled from kube.
@@ -31,10 +62,46 @@ type NodeIPResolver interface {
 	IPForNode(nodeName string) string
 }
 
+// MultiIPResolver is a NodeIPResolver that knows every address of a node:
+// dual-stack nodes report one per family, Prometheus may scrape either, and
+// some exporters use the node's host name as instance.
+type MultiIPResolver interface {
+	NodeIPResolver
+	// IPsForNode returns the node's addresses, preferred first; IPs
+	// come before host names.
+	IPsForNode(nodeName string) []string
+}
+
+// NodeIPs returns the addresses of a node known to r, preferred first.
+func NodeIPs(r NodeIPResolver, nodeName string) []string {
+	if r == nil {
+		return nil
+	}
+	if m, ok := r.(MultiIPResolver); ok {
+		return m.IPsForNode(nodeName)
+	}
+	if ip := r.IPForNode(nodeName); ip != "" {
+		return []string{ip}
+	}
+	return nil
+}
+
+// NodeMetricsByIP looks the metrics of a node up by each of its addresses
+// and returns the first match with the address it matched ("" if none).
+func NodeMetricsByIP(matrix *promnet.NetworkMatrix, nodeName string, r NodeIPResolver) (*promnet.NodeMetrics, string) {
+	for _, ip := range NodeIPs(r, nodeName) {
+		if m := matrix.GetNode(ip); m != nil {
+			return m, ip
+		}
+	}
+	return nil, ""
+}
+
 // NodeSeverityFromMetrics converts per-node metrics into a scalar penalty.
 //
-// Larger values mean "worse" nodes. If a metric is missing or thresholds are
-// not configured, that signal simply contributes 0.
+// Larger values mean "worse" nodes. If a metric is missing (including a
+// dimension missing from a partial NetworkMatrix, which reads as 0) or
+// thresholds are not configured, that signal simply contributes 0.
 func NodeSeverityFromMetrics(m *promnet.NodeMetrics, w NetWeights) float64 {
 	if m == nil {
 		log.Printf("[lead-net][net-score] NodeSeverityFromMetrics: metrics=nil, penalty=0")
@@ -46,9 +113,14 @@ func NodeSeverityFromMetrics(m *promnet.NodeMetrics, w NetWeights) float64 {
 
 	var penalty float64
 
+	// Out-of-range samples contribute nothing; absurd ones are clamped.
+	lat, latOK := Sanitize("node latency_ms", m.AvgLatencyMs, w.Limits.MaxLatencyMs)
+	drop, dropOK := Sanitize("node drop rate", m.DropRate, w.Limits.MaxDropRate)
+	bw, bwOK := Sanitize("node bandwidth rate", m.BandwidthRate, w.Limits.MaxBandwidthRate)
+
 	// Latency
-	if w.NetLatencyWeight > 0 && w.BadLatencyMs > 0 && m.AvgLatencyMs > w.BadLatencyMs {
-		factor := (m.AvgLatencyMs / w.BadLatencyMs) - 1.0
+	if latOK && w.NetLatencyWeight > 0 && w.BadLatencyMs > 0 && lat > w.BadLatencyMs {
+		factor := w.Limits.capFactor((lat / w.BadLatencyMs) - 1.0)
 		if factor < 0 {
 			factor = 0
 		}
@@ -58,8 +130,8 @@ func NodeSeverityFromMetrics(m *promnet.NodeMetrics, w NetWeights) float64 {
 	}
 
 	// Drops
-	if w.NetDropWeight > 0 && w.BadDropRate > 0 && m.DropRate > 0 {
-		factor := m.DropRate / w.BadDropRate
+	if dropOK && w.NetDropWeight > 0 && w.BadDropRate > 0 && drop > 0 {
+		factor := w.Limits.capFactor(drop / w.BadDropRate)
 		if factor < 0 {
 			factor = 0
 		}
@@ -70,8 +142,8 @@ func NodeSeverityFromMetrics(m *promnet.NodeMetrics, w NetWeights) float64 {
 
 	// Bandwidth
 	// Bandwidth: only penalize when we're above the "bad" threshold.
-	if w.NetBandwidthWeight > 0 && w.BadBandwidthRate > 0 && m.BandwidthRate > w.BadBandwidthRate {
-		factor := (m.BandwidthRate / w.BadBandwidthRate) - 1.0
+	if bwOK && w.NetBandwidthWeight > 0 && w.BadBandwidthRate > 0 && bw > w.BadBandwidthRate {
+		factor := w.Limits.capFactor((bw / w.BadBandwidthRate) - 1.0)
 		if factor < 0 {
 			factor = 0
 		}
@@ -107,42 +179,133 @@ func ComputeNetworkPenalty(
 	var penalty float64
 
 	for _, svc := range path.Nodes {
-		nodeName := placements.NodeNameForService(svc)
-		if nodeName == "" {
+		nodes := ServiceNodes(placements, svc)
+		if len(nodes) == 0 {
 			log.Printf("[lead-net][net-score] service=%s has no resolved node; skipping", svc)
 			continue
 		}
-		if _, ok := seenNodes[nodeName]; ok {
-			// Only penalize each node once per path.
-			log.Printf("[lead-net][net-score] node=%s already accounted for; skipping duplicate", nodeName)
+		// Only penalize each node once per path.
+		fresh := make(map[string]int, len(nodes))
+		for n, pods := range nodes {
+			if _, ok := seenNodes[n]; ok {
+				log.Printf("[lead-net][net-score] node=%s already accounted for; skipping duplicate", n)
+				continue
+			}
+			seenNodes[n] = struct{}{}
+			fresh[n] = pods
+		}
+		if len(fresh) == 0 {
 			continue
 		}
-		seenNodes[nodeName] = struct{}{}
-
-		// Try metrics keyed by node name (if Prom ever uses node label).
-		metrics := matrix.GetNode(nodeName)
-
-		// If that fails, resolve nodeName -> IP and look up by IP.
-		if metrics == nil && ipResolver != nil {
-			ip := ipResolver.IPForNode(nodeName)
-			if ip == "" {
-				log.Printf("[lead-net][net-score] no IP mapping for node=%s; skipping metrics lookup", nodeName)
-			} else {
-				metrics = matrix.GetNode(ip)
-				if metrics == nil {
-					log.Printf("[lead-net][net-score] no metrics found for node=%s ip=%s", nodeName, ip)
-				} else {
-					log.Printf("[lead-net][net-score] resolved node=%s to ip=%s for metrics lookup", nodeName, ip)
-				}
-			}
+		svcPenalty, _ := AggregateNodeSeverity(fresh, matrix, ipResolver, w)
+		log.Printf("[lead-net][net-score] path service=%s nodes=%v contributes penalty=%f", svc, fresh, svcPenalty)
+		penalty += svcPenalty
+	}
+
+	log.Printf("[lead-net][net-score] ComputeNetworkPenalty: path=%v totalPenalty=%f", path.Nodes, penalty)
+	return penalty
+}
+
+// ServiceNodes returns the nodes running svc with their pod counts: all
+// of them with a MultiNodePlacement, otherwise the single node of
+// NodeNameForService.
+func ServiceNodes(placements PodPlacement, svc graph.NodeID) map[string]int {
+	if mp, ok := placements.(MultiNodePlacement); ok {
+		return mp.NodesForService(svc)
+	}
+	if n := placements.NodeNameForService(svc); n != "" {
+		return map[string]int{n: 1}
+	}
+	return nil
+}
+
+// AggregateNodeSeverity combines the discounted severities of nodes (node
+// -> pods of one service) per w.NodeAggregation and returns it with the
+// worst node ("" if none has metrics).
+func AggregateNodeSeverity(
+	nodes map[string]int,
+	matrix *promnet.NetworkMatrix,
+	ipResolver NodeIPResolver,
+	w NetWeights,
+) (float64, string) {
+	names := make([]string, 0, len(nodes))
+	for n := range nodes {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	var worst, weighted float64
+	worstNode := ""
+	pods := 0
+	for _, n := range names {
+		m := nodeMetricsFor(n, matrix, ipResolver)
+		if m == nil {
+			continue
 		}
+		sev := NodeSeverityFromMetrics(m, w) * m.Freshness.Discount(time.Now(), w.StaleAfter)
+		if worstNode == "" || sev > worst {
+			worst, worstNode = sev, n
+		}
+		weighted += sev * float64(nodes[n])
+		pods += nodes[n]
+	}
+	if w.NodeAggregation == AggregateWeighted && pods > 0 {
+		return weighted / float64(pods), worstNode
+	}
+	return worst, worstNode
+}
+
+// nodeMetricsFor looks a node's metrics up by name (if Prometheus ever uses
+// the node label), then by each of its IPs.
+func nodeMetricsFor(nodeName string, matrix *promnet.NetworkMatrix, ipResolver NodeIPResolver) *promnet.NodeMetrics {
+	if m := matrix.GetNode(nodeName); m != nil || ipResolver == nil {
+		return m
+	}
+	ips := NodeIPs(ipResolver, nodeName)
+	if len(ips) == 0 {
+		log.Printf("[lead-net][net-score] no IP mapping for node=%s; skipping metrics lookup", nodeName)
+		return nil
+	}
+	m, _ := NodeMetricsByIP(matrix, nodeName, ipResolver)
+	if m == nil {
+		log.Printf("[lead-net][net-score] no metrics found for node=%s ips=%v", nodeName, ips)
+	}
+	return m
+}
 
-		nodePenalty := NodeSeverityFromMetrics(metrics, w)
-		log.Printf("[lead-net][net-score] path node=%s contributes penalty=%f", nodeName, nodePenalty)
-		penalty += nodePenalty
+// ComputeEdgeLatencyPenalty penalizes a path by the measured latency of each
+// caller -> callee hop, using pairwise service metrics rather than per-node
+// averages. Hops without a measurement contribute 0; stale or low-confidence
+// measurements are discounted.
+func ComputeEdgeLatencyPenalty(
+	path graph.Path,
+	latencies *promnet.ServiceLatencyMatrix,
+	w NetWeights,
+) float64 {
+	if latencies == nil || w.EdgeLatencyWeight <= 0 || w.BadEdgeLatencyMs <= 0 {
+		log.Printf("[lead-net][net-score] ComputeEdgeLatencyPenalty: no latencies or weights, penalty=0")
+		return 0
 	}
 
-	log.Printf("[lead-net][net-score] ComputeNetworkPenalty: path=%v totalPenalty=%f", path.Nodes, penalty)
+	var penalty float64
+	for i := 0; i < len(path.Nodes)-1; i++ {
+		src, dst := path.Nodes[i], path.Nodes[i+1]
+		lat, ok := latencies.Latency(string(src), string(dst))
+		if !ok {
+			log.Printf("[lead-net][net-score] edge %s -> %s has no latency sample; skipping", src, dst)
+			continue
+		}
+		if lat, ok = Sanitize("edge latency_ms", lat, w.Limits.MaxLatencyMs); !ok || lat <= w.BadEdgeLatencyMs {
+			continue
+		}
+		factor := w.Limits.capFactor((lat / w.BadEdgeLatencyMs) - 1.0)
+		factor *= latencies.FreshnessOf(string(src), string(dst)).Discount(time.Now(), w.StaleAfter)
+		penalty += w.EdgeLatencyWeight * factor
+		log.Printf("[lead-net][net-score] edge %s -> %s latency_ms=%f factor=%f partialPenalty=%f",
+			src, dst, lat, factor, penalty)
+	}
+
+	log.Printf("[lead-net][net-score] ComputeEdgeLatencyPenalty: path=%v totalPenalty=%f", path.Nodes, penalty)
 	return penalty
 }
 
@@ -0,0 +1,149 @@
+package scoring
+
+import (
+	"log"
+	"sort"
+
+	"lead-net-affinity/pkg/graph"
+)
+
+// PlacementView is implemented by kube.PlacementIndex.
+type PlacementView interface {
+	// NodesForService returns node -> pod count for a service.
+	NodesForService(svc graph.NodeID) map[string]int
+	// ZoneForNode returns the zone of a node (or "" if unknown).
+	ZoneForNode(node string) string
+}
+
+type ProximityWeights struct {
+	SameNodeBonus float64
+	SameZoneBonus float64
+
+	// ReplicaAggregation combines the closeness of a candidate to each
+	// replica of a dependency: AggregateMax (default), AggregateMin or
+	// AggregateWeighted.
+	ReplicaAggregation string
+}
+
+// Replica aggregations for proximity scoring. AggregateWeighted is shared
+// with NetWeights.NodeAggregation.
+const (
+	AggregateMax = "max" // closest replica: one co-located pod earns the full bonus
+	AggregateMin = "min" // farthest replica: the bonus only if every pod is close
+)
+
+// Replica is where one pod of a service runs.
+type Replica struct {
+	Node string
+	Zone string // "" if unknown
+}
+
+// Replicas expands a service's node -> pod count placement into one entry
+// per pod, ordered by node.
+func Replicas(view PlacementView, svc graph.NodeID) []Replica {
+	if view == nil {
+		return nil
+	}
+	nodes := view.NodesForService(svc)
+	names := make([]string, 0, len(nodes))
+	for n := range nodes {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	var out []Replica
+	for _, n := range names {
+		z := view.ZoneForNode(n)
+		for i := 0; i < nodes[n]; i++ {
+			out = append(out, Replica{Node: n, Zone: z})
+		}
+	}
+	return out
+}
+
+// replicaCloseness is the bonus a node in zone earns for one replica.
+func (w ProximityWeights) replicaCloseness(node, zone string, r Replica) float64 {
+	switch {
+	case r.Node == node:
+		return w.SameNodeBonus
+	case zone != "" && r.Zone == zone:
+		return w.SameZoneBonus
+	}
+	return 0
+}
+
+// closeness aggregates replicaCloseness over replicas per
+// w.ReplicaAggregation.
+func (w ProximityWeights) closeness(node, zone string, replicas []Replica) float64 {
+	var sum, lo, hi float64
+	for i, r := range replicas {
+		v := w.replicaCloseness(node, zone, r)
+		sum += v
+		if i == 0 || v < lo {
+			lo = v
+		}
+		if i == 0 || v > hi {
+			hi = v
+		}
+	}
+	switch w.ReplicaAggregation {
+	case AggregateMin:
+		return lo
+	case AggregateWeighted:
+		return sum / float64(len(replicas))
+	}
+	return hi
+}
+
+// NodeProximityScores scores candidate nodes for a service by how close they
+// are to where its dependency pods (parents and children) currently run.
+//
+// neighbors maps each dependency to its edge weight (e.g. edge RPS); a node
+// earns SameNodeBonus for a dependency replica on it and SameZoneBonus for
+// one in its zone, aggregated over the dependency's replicas per
+// w.ReplicaAggregation and multiplied by edgeWeight. Larger scores are
+// better.
+func NodeProximityScores(
+	svc graph.NodeID,
+	neighbors map[graph.NodeID]float64,
+	candidates []string,
+	view PlacementView,
+	w ProximityWeights,
+) map[string]float64 {
+	scores := make(map[string]float64, len(candidates))
+	for _, c := range candidates {
+		scores[c] = 0
+	}
+	if view == nil {
+		return scores
+	}
+
+	zones := make(map[string]string, len(candidates))
+	for _, c := range candidates {
+		zones[c] = view.ZoneForNode(c)
+	}
+	for dep, edgeWeight := range neighbors {
+		replicas := Replicas(view, dep)
+		if len(replicas) == 0 {
+			continue
+		}
+		for _, c := range candidates {
+			scores[c] += w.closeness(c, zones[c], replicas) * edgeWeight
+		}
+	}
+
+	log.Printf("[lead-net][node-score] NodeProximityScores service=%s neighbors=%v scores=%v", svc, neighbors, scores)
+	return scores
+}
+
+// BestNode returns the highest scoring node (ties broken by name) or "" if no
+// node has a positive score.
+func BestNode(scores map[string]float64) string {
+	best := ""
+	bestScore := 0.0
+	for n, s := range scores {
+		if s > bestScore || (s == bestScore && s > 0 && n < best) {
+			best, bestScore = n, s
+		}
+	}
+	return best
+}
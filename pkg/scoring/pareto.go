@@ -0,0 +1,54 @@
+package scoring
+
+// Objectives are a path's trade-offs, kept apart instead of combined into
+// one score. Latency and Resilience are maximized, Cost is minimized.
+type Objectives struct {
+	Latency    float64 // latency co-location can recover (network penalty)
+	Cost       float64 // pods co-location moves
+	Resilience float64 // ready replicas of the path's least replicated service
+}
+
+// Dominates reports whether a is at least as good as b in every objective
+// and better in one.
+func (a Objectives) Dominates(b Objectives) bool {
+	if a.Latency < b.Latency || a.Cost > b.Cost || a.Resilience < b.Resilience {
+		return false
+	}
+	return a.Latency > b.Latency || a.Cost < b.Cost || a.Resilience > b.Resilience
+}
+
+// ParetoFronts returns each point's front by non-dominated sorting: 1 for
+// the Pareto-optimal points, 2 for the ones optimal once front 1 is
+// removed, and so on.
+func ParetoFronts(points []Objectives) []int {
+	fronts := make([]int, len(points))
+	dominatedBy := make([]int, len(points)) // points dominating each point
+	dominates := make([][]int, len(points))
+	for i := range points {
+		for j := range points {
+			if i != j && points[i].Dominates(points[j]) {
+				dominates[i] = append(dominates[i], j)
+				dominatedBy[j]++
+			}
+		}
+	}
+	var current []int
+	for i, n := range dominatedBy {
+		if n == 0 {
+			current = append(current, i)
+		}
+	}
+	for front := 1; len(current) > 0; front++ {
+		var next []int
+		for _, i := range current {
+			fronts[i] = front
+			for _, j := range dominates[i] {
+				if dominatedBy[j]--; dominatedBy[j] == 0 {
+					next = append(next, j)
+				}
+			}
+		}
+		current = next
+	}
+	return fronts
+}
@@ -0,0 +1,52 @@
+package scoring
+
+import (
+	"log"
+	"math"
+)
+
+// DefaultMaxPenaltyFactor caps how far past its "bad" threshold a single
+// signal counts when Limits.MaxPenaltyFactor is unset: a node at 11x the
+// bad latency is penalized like one at 100x.
+const DefaultMaxPenaltyFactor = 10
+
+// Limits keeps implausible metric samples from dominating a path score.
+//
+// Each Max* bounds a raw sample in the unit of the matching Bad* threshold
+// (0 = unbounded); larger samples are clamped to it. NaN, infinite and
+// negative samples are always discarded and count as missing.
+type Limits struct {
+	MaxLatencyMs     float64
+	MaxDropRate      float64
+	MaxBandwidthRate float64
+
+	// MaxPenaltyFactor caps (value/bad - 1) per signal; 0 means
+	// DefaultMaxPenaltyFactor, negative disables the cap.
+	MaxPenaltyFactor float64
+}
+
+// Sanitize checks one sample of metric what (for the log). ok is false if
+// the sample is unusable; samples above max (when max > 0) are clamped.
+func Sanitize(what string, v, max float64) (float64, bool) {
+	if math.IsNaN(v) || math.IsInf(v, 0) || v < 0 {
+		log.Printf("[lead-net][net-score] warning: discarding out-of-range %s sample %v", what, v)
+		return 0, false
+	}
+	if max > 0 && v > max {
+		log.Printf("[lead-net][net-score] warning: clamping %s sample %v to %v", what, v, max)
+		return max, true
+	}
+	return v, true
+}
+
+// capFactor applies MaxPenaltyFactor to a penalty factor.
+func (l Limits) capFactor(f float64) float64 {
+	max := l.MaxPenaltyFactor
+	if max == 0 {
+		max = DefaultMaxPenaltyFactor
+	}
+	if max > 0 && f > max {
+		return max
+	}
+	return f
+}
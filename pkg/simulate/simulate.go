@@ -0,0 +1,595 @@
+// Package simulate predicts where pods will land before rules are applied,
+// with a simplified model of the default kube-scheduler: the filters and
+// scores that decide co-location (node readiness, taints, node selectors
+// and affinity, resources, pod (anti-)affinity, topology spread) and none
+// of the rest (volumes, host ports, images, preemption, namespace
+// selectors). Where the scheduler breaks ties at random, the simulator
+// takes the first node by name, so a prediction is deterministic.
+package simulate
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"lead-net-affinity/pkg/kube"
+)
+
+// Score plugin weights of the default scheduler profile.
+const (
+	weightTaintToleration   = 3
+	weightNodeAffinity      = 2
+	weightPodTopologySpread = 2
+	weightInterPodAffinity  = 2
+	weightResourcesFit      = 1
+	weightBalancedAlloc     = 1
+)
+
+// Snapshot is the cluster state pods are placed into.
+type Snapshot struct {
+	Nodes []corev1.Node
+	Pods  []corev1.Pod // pods not bound to a node or finished are ignored
+}
+
+// Workload is a set of pods to (re)place, e.g. a Deployment with the
+// affinity LEAD proposes: its running pods (Selector in Namespace) are
+// removed and Replicas pods of Template placed one after another, as a
+// rolling restart would.
+type Workload struct {
+	Name      string
+	Namespace string
+	Selector  *metav1.LabelSelector
+	Template  corev1.PodTemplateSpec
+	Replicas  int
+}
+
+// Prediction is where a workload's pods are expected to land.
+type Prediction struct {
+	Workload      string         `json:"workload"`
+	Namespace     string         `json:"namespace"`
+	Nodes         map[string]int `json:"nodes"`
+	Zones         map[string]int `json:"zones,omitempty"`
+	Unschedulable int            `json:"unschedulable,omitempty"`
+	Reason        string         `json:"reason,omitempty"` // why the last unschedulable pod did not fit
+}
+
+// Run places the workloads in order, each seeing the pods placed for the
+// ones before it, and returns a prediction per workload.
+func Run(s Snapshot, workloads []Workload) []Prediction {
+	c := newCluster(s)
+	out := make([]Prediction, 0, len(workloads))
+	for _, w := range workloads {
+		out = append(out, c.place(w))
+	}
+	return out
+}
+
+type nodeState struct {
+	node     *corev1.Node
+	zone     string
+	cpu, mem int64 // requested
+	pods     []*corev1.Pod
+}
+
+type cluster struct {
+	nodes []*nodeState // by name
+}
+
+func newCluster(s Snapshot) *cluster {
+	c := &cluster{}
+	byName := make(map[string]*nodeState, len(s.Nodes))
+	for i := range s.Nodes {
+		n := &s.Nodes[i]
+		ns := &nodeState{node: n, zone: n.Labels[corev1.LabelTopologyZone]}
+		c.nodes = append(c.nodes, ns)
+		byName[n.Name] = ns
+	}
+	sort.Slice(c.nodes, func(i, j int) bool { return c.nodes[i].node.Name < c.nodes[j].node.Name })
+	for i := range s.Pods {
+		p := &s.Pods[i]
+		if ns := byName[p.Spec.NodeName]; ns != nil && kube.PodActive(p) {
+			ns.add(p)
+		}
+	}
+	return c
+}
+
+func (n *nodeState) add(p *corev1.Pod) {
+	cpu, mem := requests(&p.Spec)
+	n.cpu += cpu
+	n.mem += mem
+	n.pods = append(n.pods, p)
+}
+
+func (c *cluster) place(w Workload) Prediction {
+	pred := Prediction{Workload: w.Name, Namespace: w.Namespace, Nodes: map[string]int{}, Zones: map[string]int{}}
+	if sel, err := metav1.LabelSelectorAsSelector(w.Selector); err == nil && w.Selector != nil {
+		for _, n := range c.nodes {
+			kept := n.pods[:0]
+			for _, p := range n.pods {
+				if p.Namespace == w.Namespace && sel.Matches(labels.Set(p.Labels)) {
+					cpu, mem := requests(&p.Spec)
+					n.cpu -= cpu
+					n.mem -= mem
+					continue
+				}
+				kept = append(kept, p)
+			}
+			n.pods = kept
+		}
+	}
+	for i := 0; i < w.Replicas; i++ {
+		p := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      fmt.Sprintf("%s-simulated-%d", w.Name, i),
+				Namespace: w.Namespace,
+				Labels:    w.Template.Labels,
+			},
+			Spec: *w.Template.Spec.DeepCopy(),
+		}
+		n, reason := c.schedule(p)
+		if n == nil {
+			pred.Unschedulable++
+			pred.Reason = reason
+			continue
+		}
+		p.Spec.NodeName = n.node.Name
+		n.add(p)
+		pred.Nodes[n.node.Name]++
+		if n.zone != "" {
+			pred.Zones[n.zone]++
+		}
+	}
+	return pred
+}
+
+// schedule picks p's node, or returns nil and a reason in the scheduler's
+// words ("0/3 nodes are available: 2 Insufficient cpu, ...").
+func (c *cluster) schedule(p *corev1.Pod) (*nodeState, string) {
+	var feasible []*nodeState
+	reasons := make(map[string]int)
+	for _, n := range c.nodes {
+		if r := c.filter(p, n); r != "" {
+			reasons[r]++
+			continue
+		}
+		feasible = append(feasible, n)
+	}
+	if len(feasible) == 0 {
+		parts := make([]string, 0, len(reasons))
+		for r, k := range reasons {
+			parts = append(parts, fmt.Sprintf("%d %s", k, r))
+		}
+		sort.Strings(parts)
+		return nil, fmt.Sprintf("0/%d nodes are available: %s", len(c.nodes), strings.Join(parts, ", "))
+	}
+
+	total := make([]int64, len(feasible))
+	addNormalized := func(weight int64, raw []int64, reverse bool) {
+		for i, s := range normalize(raw, reverse) {
+			total[i] += weight * s
+		}
+	}
+	raw := func(f func(n *nodeState) int64) []int64 {
+		out := make([]int64, len(feasible))
+		for i, n := range feasible {
+			out[i] = f(n)
+		}
+		return out
+	}
+	addNormalized(weightTaintToleration, raw(func(n *nodeState) int64 { return preferNoScheduleTaints(p, n) }), true)
+	addNormalized(weightNodeAffinity, raw(func(n *nodeState) int64 { return preferredNodeAffinity(p, n) }), false)
+	addNormalized(weightPodTopologySpread, raw(func(n *nodeState) int64 { return c.softSpread(p, n) }), true)
+	addNormalized(weightInterPodAffinity, raw(func(n *nodeState) int64 { return c.preferredPodAffinity(p, n) }), false)
+	cpu, mem := requests(&p.Spec)
+	for i, n := range feasible {
+		total[i] += weightResourcesFit * leastAllocated(n, cpu, mem)
+		total[i] += weightBalancedAlloc * balancedAllocation(n, cpu, mem)
+	}
+
+	best := 0
+	for i := range feasible {
+		if total[i] > total[best] {
+			best = i
+		}
+	}
+	return feasible[best], ""
+}
+
+// normalize scales raw scores to 0-100 by their range (reverse: lower raw
+// scores are better).
+func normalize(raw []int64, reverse bool) []int64 {
+	lo, hi := int64(0), int64(0)
+	for i, s := range raw {
+		if i == 0 || s < lo {
+			lo = s
+		}
+		if i == 0 || s > hi {
+			hi = s
+		}
+	}
+	out := make([]int64, len(raw))
+	for i, s := range raw {
+		switch {
+		case hi == lo:
+			if reverse {
+				out[i] = 100
+			}
+		case reverse:
+			out[i] = (hi - s) * 100 / (hi - lo)
+		default:
+			out[i] = (s - lo) * 100 / (hi - lo)
+		}
+	}
+	return out
+}
+
+// filter returns why p cannot run on n, "" if it can.
+func (c *cluster) filter(p *corev1.Pod, n *nodeState) string {
+	node := n.node
+	if node.Spec.Unschedulable {
+		return "node(s) were unschedulable"
+	}
+	if !nodeReady(node) {
+		return "node(s) were not ready"
+	}
+	for i := range node.Spec.Taints {
+		t := &node.Spec.Taints[i]
+		if t.Effect != corev1.TaintEffectPreferNoSchedule && !tolerated(p, t) {
+			return "node(s) had untolerated taint"
+		}
+	}
+	if !labels.SelectorFromSet(p.Spec.NodeSelector).Matches(labels.Set(node.Labels)) || !requiredNodeAffinity(p, node) {
+		return "node(s) didn't match Pod's node affinity/selector"
+	}
+	cpu, mem := requests(&p.Spec)
+	if a := node.Status.Allocatable.Cpu().MilliValue(); cpu > 0 && n.cpu+cpu > a {
+		return "Insufficient cpu"
+	}
+	if a := node.Status.Allocatable.Memory().Value(); mem > 0 && n.mem+mem > a {
+		return "Insufficient memory"
+	}
+	if a := node.Status.Allocatable.Pods().Value(); a > 0 && int64(len(n.pods)) >= a {
+		return "Too many pods"
+	}
+	if r := c.requiredPodAffinity(p, n); r != "" {
+		return r
+	}
+	return c.hardSpread(p, n)
+}
+
+func nodeReady(n *corev1.Node) bool {
+	for _, cond := range n.Status.Conditions {
+		if cond.Type == corev1.NodeReady {
+			return cond.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+func tolerated(p *corev1.Pod, t *corev1.Taint) bool {
+	for i := range p.Spec.Tolerations {
+		if p.Spec.Tolerations[i].ToleratesTaint(t) {
+			return true
+		}
+	}
+	return false
+}
+
+func preferNoScheduleTaints(p *corev1.Pod, n *nodeState) int64 {
+	var k int64
+	for i := range n.node.Spec.Taints {
+		t := &n.node.Spec.Taints[i]
+		if t.Effect == corev1.TaintEffectPreferNoSchedule && !tolerated(p, t) {
+			k++
+		}
+	}
+	return k
+}
+
+func requiredNodeAffinity(p *corev1.Pod, node *corev1.Node) bool {
+	aff := p.Spec.Affinity
+	if aff == nil || aff.NodeAffinity == nil || aff.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution == nil {
+		return true
+	}
+	for _, term := range aff.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms {
+		if nodeMatches(term, node) {
+			return true
+		}
+	}
+	return false
+}
+
+func preferredNodeAffinity(p *corev1.Pod, n *nodeState) int64 {
+	aff := p.Spec.Affinity
+	if aff == nil || aff.NodeAffinity == nil {
+		return 0
+	}
+	var s int64
+	for _, t := range aff.NodeAffinity.PreferredDuringSchedulingIgnoredDuringExecution {
+		if nodeMatches(t.Preference, n.node) {
+			s += int64(t.Weight)
+		}
+	}
+	return s
+}
+
+// nodeMatches reports whether node satisfies every expression of term; an
+// empty term matches nothing, as in the scheduler.
+func nodeMatches(term corev1.NodeSelectorTerm, node *corev1.Node) bool {
+	if len(term.MatchExpressions) == 0 && len(term.MatchFields) == 0 {
+		return false
+	}
+	for _, e := range term.MatchExpressions {
+		if !requirementMatches(e, node.Labels[e.Key], hasKey(node.Labels, e.Key)) {
+			return false
+		}
+	}
+	for _, f := range term.MatchFields {
+		if f.Key != "metadata.name" || !requirementMatches(f, node.Name, true) {
+			return false
+		}
+	}
+	return true
+}
+
+func hasKey(m map[string]string, k string) bool {
+	_, ok := m[k]
+	return ok
+}
+
+func requirementMatches(r corev1.NodeSelectorRequirement, value string, present bool) bool {
+	switch r.Operator {
+	case corev1.NodeSelectorOpIn:
+		return present && contains(r.Values, value)
+	case corev1.NodeSelectorOpNotIn:
+		return !present || !contains(r.Values, value)
+	case corev1.NodeSelectorOpExists:
+		return present
+	case corev1.NodeSelectorOpDoesNotExist:
+		return !present
+	case corev1.NodeSelectorOpGt, corev1.NodeSelectorOpLt:
+		var v, want int64
+		if len(r.Values) != 1 || !present {
+			return false
+		}
+		if _, err := fmt.Sscan(value, &v); err != nil {
+			return false
+		}
+		if _, err := fmt.Sscan(r.Values[0], &want); err != nil {
+			return false
+		}
+		if r.Operator == corev1.NodeSelectorOpGt {
+			return v > want
+		}
+		return v < want
+	}
+	return false
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// termMatches reports whether term (of a pod in namespace ns) selects pod.
+func termMatches(term corev1.PodAffinityTerm, ns string, pod *corev1.Pod) bool {
+	namespaces := term.Namespaces
+	if len(namespaces) == 0 {
+		namespaces = []string{ns}
+	}
+	if !contains(namespaces, pod.Namespace) || term.LabelSelector == nil {
+		return false
+	}
+	sel, err := metav1.LabelSelectorAsSelector(term.LabelSelector)
+	return err == nil && sel.Matches(labels.Set(pod.Labels))
+}
+
+// sameDomain reports whether nodes a and b share the value of key; a node
+// without the label is in no domain.
+func sameDomain(a, b *corev1.Node, key string) bool {
+	va, ok := a.Labels[key]
+	if !ok {
+		return false
+	}
+	vb, ok := b.Labels[key]
+	return ok && va == vb
+}
+
+// requiredPodAffinity checks p's required pod (anti-)affinity and the
+// required anti-affinity of the pods already placed.
+func (c *cluster) requiredPodAffinity(p *corev1.Pod, n *nodeState) string {
+	aff := p.Spec.Affinity
+	if aff != nil && aff.PodAffinity != nil {
+		for _, term := range aff.PodAffinity.RequiredDuringSchedulingIgnoredDuringExecution {
+			inDomain, anywhere := false, false
+			for _, m := range c.nodes {
+				for _, q := range m.pods {
+					if termMatches(term, p.Namespace, q) {
+						anywhere = true
+						inDomain = inDomain || sameDomain(m.node, n.node, term.TopologyKey)
+					}
+				}
+			}
+			// The first pod of a group that selects itself may go anywhere.
+			if !inDomain && (anywhere || !termMatches(term, p.Namespace, p)) {
+				return "node(s) didn't match pod affinity rules"
+			}
+		}
+	}
+	for _, m := range c.nodes {
+		for _, q := range m.pods {
+			if aff != nil && aff.PodAntiAffinity != nil {
+				for _, term := range aff.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution {
+					if termMatches(term, p.Namespace, q) && sameDomain(m.node, n.node, term.TopologyKey) {
+						return "node(s) didn't match pod anti-affinity rules"
+					}
+				}
+			}
+			if q.Spec.Affinity == nil || q.Spec.Affinity.PodAntiAffinity == nil {
+				continue
+			}
+			for _, term := range q.Spec.Affinity.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution {
+				if termMatches(term, q.Namespace, p) && sameDomain(m.node, n.node, term.TopologyKey) {
+					return "node(s) didn't satisfy existing pods anti-affinity rules"
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// preferredPodAffinity sums the weights of p's preferred terms satisfied
+// on n (anti-affinity subtracts), and those of placed pods' terms toward p.
+func (c *cluster) preferredPodAffinity(p *corev1.Pod, n *nodeState) int64 {
+	var s int64
+	aff := p.Spec.Affinity
+	for _, m := range c.nodes {
+		for _, q := range m.pods {
+			if aff != nil && aff.PodAffinity != nil {
+				for _, t := range aff.PodAffinity.PreferredDuringSchedulingIgnoredDuringExecution {
+					if termMatches(t.PodAffinityTerm, p.Namespace, q) && sameDomain(m.node, n.node, t.PodAffinityTerm.TopologyKey) {
+						s += int64(t.Weight)
+					}
+				}
+			}
+			if aff != nil && aff.PodAntiAffinity != nil {
+				for _, t := range aff.PodAntiAffinity.PreferredDuringSchedulingIgnoredDuringExecution {
+					if termMatches(t.PodAffinityTerm, p.Namespace, q) && sameDomain(m.node, n.node, t.PodAffinityTerm.TopologyKey) {
+						s -= int64(t.Weight)
+					}
+				}
+			}
+			qa := q.Spec.Affinity
+			if qa != nil && qa.PodAffinity != nil {
+				for _, t := range qa.PodAffinity.PreferredDuringSchedulingIgnoredDuringExecution {
+					if termMatches(t.PodAffinityTerm, q.Namespace, p) && sameDomain(m.node, n.node, t.PodAffinityTerm.TopologyKey) {
+						s += int64(t.Weight)
+					}
+				}
+			}
+			if qa != nil && qa.PodAntiAffinity != nil {
+				for _, t := range qa.PodAntiAffinity.PreferredDuringSchedulingIgnoredDuringExecution {
+					if termMatches(t.PodAffinityTerm, q.Namespace, p) && sameDomain(m.node, n.node, t.PodAffinityTerm.TopologyKey) {
+						s -= int64(t.Weight)
+					}
+				}
+			}
+		}
+	}
+	return s
+}
+
+// spreadCounts counts the pods matching constraint k per domain of its
+// topology key, over the nodes p may run on by node affinity and selector.
+func (c *cluster) spreadCounts(p *corev1.Pod, k corev1.TopologySpreadConstraint) map[string]int64 {
+	sel, err := metav1.LabelSelectorAsSelector(k.LabelSelector)
+	counts := make(map[string]int64)
+	for _, m := range c.nodes {
+		v, ok := m.node.Labels[k.TopologyKey]
+		if !ok || !labels.SelectorFromSet(p.Spec.NodeSelector).Matches(labels.Set(m.node.Labels)) || !requiredNodeAffinity(p, m.node) {
+			continue
+		}
+		counts[v] += 0
+		if err != nil || k.LabelSelector == nil {
+			continue
+		}
+		for _, q := range m.pods {
+			if q.Namespace == p.Namespace && sel.Matches(labels.Set(q.Labels)) {
+				counts[v]++
+			}
+		}
+	}
+	return counts
+}
+
+// hardSpread checks p's DoNotSchedule topology spread constraints.
+func (c *cluster) hardSpread(p *corev1.Pod, n *nodeState) string {
+	for _, k := range p.Spec.TopologySpreadConstraints {
+		if k.WhenUnsatisfiable != corev1.DoNotSchedule {
+			continue
+		}
+		v, ok := n.node.Labels[k.TopologyKey]
+		if !ok {
+			return "node(s) didn't match pod topology spread constraints (missing required label)"
+		}
+		counts := c.spreadCounts(p, k)
+		lo := counts[v]
+		for _, cnt := range counts {
+			lo = min(lo, cnt)
+		}
+		if counts[v]+1-lo > int64(k.MaxSkew) {
+			return "node(s) didn't match pod topology spread constraints"
+		}
+	}
+	return ""
+}
+
+// softSpread is the number of matching pods in n's domains of p's
+// ScheduleAnyway constraints; fewer is better.
+func (c *cluster) softSpread(p *corev1.Pod, n *nodeState) int64 {
+	var s int64
+	for _, k := range p.Spec.TopologySpreadConstraints {
+		if k.WhenUnsatisfiable != corev1.ScheduleAnyway {
+			continue
+		}
+		if v, ok := n.node.Labels[k.TopologyKey]; ok {
+			s += c.spreadCounts(p, k)[v]
+		}
+	}
+	return s
+}
+
+// leastAllocated favors nodes with more CPU and memory left after placing
+// the pod (0-100).
+func leastAllocated(n *nodeState, cpu, mem int64) int64 {
+	free := func(used, alloc int64) int64 {
+		if alloc <= 0 || used > alloc {
+			return 0
+		}
+		return (alloc - used) * 100 / alloc
+	}
+	a := n.node.Status.Allocatable
+	return (free(n.cpu+cpu, a.Cpu().MilliValue()) + free(n.mem+mem, a.Memory().Value())) / 2
+}
+
+// balancedAllocation favors nodes whose CPU and memory fill up evenly (0-100).
+func balancedAllocation(n *nodeState, cpu, mem int64) int64 {
+	a := n.node.Status.Allocatable
+	ac, am := a.Cpu().MilliValue(), a.Memory().Value()
+	if ac <= 0 || am <= 0 {
+		return 0
+	}
+	fc := float64(n.cpu+cpu) / float64(ac)
+	fm := float64(n.mem+mem) / float64(am)
+	d := fc - fm
+	if d < 0 {
+		d = -d
+	}
+	return int64((1 - min(d, 1)) * 100)
+}
+
+// requests is the CPU (millicores) and memory (bytes) the scheduler
+// accounts for a pod: its containers, or its largest init container if
+// that is more, plus the pod overhead.
+func requests(spec *corev1.PodSpec) (cpu, mem int64) {
+	for _, c := range spec.Containers {
+		cpu += c.Resources.Requests.Cpu().MilliValue()
+		mem += c.Resources.Requests.Memory().Value()
+	}
+	for _, c := range spec.InitContainers {
+		cpu = max(cpu, c.Resources.Requests.Cpu().MilliValue())
+		mem = max(mem, c.Resources.Requests.Memory().Value())
+	}
+	cpu += spec.Overhead.Cpu().MilliValue()
+	mem += spec.Overhead.Memory().Value()
+	return cpu, mem
+}
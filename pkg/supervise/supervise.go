@@ -0,0 +1,127 @@
+// Package supervise keeps long-running goroutines alive: a panic is
+// recovered, counted and logged with its stack instead of killing the loop
+// (or, unrecovered, the process), and the loop restarts with exponential
+// backoff until it crashes too often in a row.
+package supervise
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"time"
+
+	"lead-net-affinity/pkg/metrics"
+)
+
+// Defaults of Loop.
+const (
+	DefaultInitialBackoff = time.Second
+	DefaultMaxBackoff     = 5 * time.Minute
+)
+
+// PanicError is a recovered panic.
+type PanicError struct {
+	Loop  string
+	Value any
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("%s panicked: %v", e.Loop, e.Value)
+}
+
+// Recover runs fn and returns its error, or a *PanicError if it panics.
+// labels are added to the loop label of lead_net_loop_panics_total.
+func Recover(name string, labels map[string]string, fn func() error) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = recovered(name, labels, v)
+		}
+	}()
+	return fn()
+}
+
+// Catch recovers a panic of the calling goroutine, for callbacks with no
+// error to return: defer supervise.Catch("name", nil).
+func Catch(name string, labels map[string]string) {
+	if v := recover(); v != nil {
+		recovered(name, labels, v)
+	}
+}
+
+func recovered(name string, labels map[string]string, v any) *PanicError {
+	e := &PanicError{Loop: name, Value: v, Stack: debug.Stack()}
+	log.Printf("[lead-net][supervise] %v\n%s", e, e.Stack)
+	metrics.Default.Add("lead_net_loop_panics_total", "Panics recovered in long-running loops and callbacks.",
+		loopLabels(name, labels), 1)
+	return e
+}
+
+// Loop restarts a long-running function after it panics.
+type Loop struct {
+	Name   string
+	Labels map[string]string // added to the loop label of the metrics
+
+	// InitialBackoff is the wait before the first restart; it doubles with
+	// every crash in a row up to MaxBackoff. A run lasting MaxBackoff ends
+	// the streak.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+
+	// MaxCrashes in a row make Run give up and return the last panic; 0
+	// restarts forever.
+	MaxCrashes int
+}
+
+// Run calls fn until it returns without panicking, ctx is done or fn
+// crashes MaxCrashes times in a row, and returns fn's last error.
+func (l Loop) Run(ctx context.Context, fn func(ctx context.Context) error) error {
+	initial, limit := l.InitialBackoff, l.MaxBackoff
+	if initial <= 0 {
+		initial = DefaultInitialBackoff
+	}
+	if limit <= 0 {
+		limit = DefaultMaxBackoff
+	}
+	if limit < initial {
+		limit = initial
+	}
+	labels := loopLabels(l.Name, l.Labels)
+	crashes := 0
+	backoff := initial
+	for {
+		start := time.Now()
+		err := Recover(l.Name, l.Labels, func() error { return fn(ctx) })
+		if _, ok := err.(*PanicError); !ok {
+			metrics.Default.Set("lead_net_loop_restart_backoff_seconds", "Wait before restarting a crashed loop; 0 while it runs.", labels, 0)
+			return err
+		}
+		if time.Since(start) >= limit {
+			crashes, backoff = 0, initial
+		}
+		crashes++
+		if l.MaxCrashes > 0 && crashes >= l.MaxCrashes {
+			log.Printf("[lead-net][supervise] %s crashed %d times in a row; giving up", l.Name, crashes)
+			return err
+		}
+		log.Printf("[lead-net][supervise] restarting %s in %s (crash %d in a row)", l.Name, backoff, crashes)
+		metrics.Default.Set("lead_net_loop_restart_backoff_seconds", "Wait before restarting a crashed loop; 0 while it runs.", labels, backoff.Seconds())
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		metrics.Default.Add("lead_net_loop_restarts_total", "Restarts of long-running loops after a panic.", labels, 1)
+		metrics.Default.Set("lead_net_loop_restart_backoff_seconds", "Wait before restarting a crashed loop; 0 while it runs.", labels, 0)
+		backoff = min(2*backoff, limit)
+	}
+}
+
+func loopLabels(name string, extra map[string]string) map[string]string {
+	labels := map[string]string{"loop": name}
+	for k, v := range extra {
+		labels[k] = v
+	}
+	return labels
+}
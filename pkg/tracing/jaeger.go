@@ -0,0 +1,219 @@
+// Package tracing derives service-to-service edges from distributed traces
+// (Jaeger, or Tempo through its Jaeger-compatible query frontend).
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	"lead-net-affinity/pkg/outbound"
+	promc "lead-net-affinity/pkg/prometheus"
+)
+
+// Client queries the Jaeger HTTP API (/api/traces).
+type Client struct {
+	baseURL    *url.URL
+	httpClient *http.Client
+	transport  *http.Transport
+}
+
+func NewClient(rawURL string) (*Client, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		log.Printf("[lead-net][tracing] invalid tracing URL %q: %v", rawURL, err)
+		return nil, err
+	}
+	log.Printf("[lead-net][tracing] creating Jaeger query client for baseURL=%s", u.Redacted())
+	tr, err := outbound.NewTransport("")
+	if err != nil {
+		return nil, err
+	}
+	return &Client{
+		baseURL:    u,
+		httpClient: &http.Client{Timeout: 30 * time.Second, Transport: tr},
+		transport:  tr,
+	}, nil
+}
+
+// SetHTTPOptions sets a proxy, extra headers and the per-request timeout
+// (default 30s).
+func (c *Client) SetHTTPOptions(o outbound.Options) error {
+	return outbound.Apply(c.httpClient, c.transport, o)
+}
+
+// EdgeStats aggregates the calls seen on one caller -> callee edge.
+type EdgeStats struct {
+	Calls       int
+	DurationsMs []float64 // callee span durations, sorted ascending
+}
+
+// Percentile returns the q-quantile (0..1) of the call durations.
+func (s *EdgeStats) Percentile(q float64) float64 {
+	if s == nil || len(s.DurationsMs) == 0 {
+		return 0
+	}
+	if q <= 0 {
+		return s.DurationsMs[0]
+	}
+	if q >= 1 {
+		return s.DurationsMs[len(s.DurationsMs)-1]
+	}
+	return s.DurationsMs[int(q*float64(len(s.DurationsMs)-1)+0.5)]
+}
+
+// Edges is the edge set derived from the traces of one lookback window.
+type Edges struct {
+	Window time.Duration
+	At     time.Time // end of the window
+	Pairs  map[promc.ServicePair]*EdgeStats
+}
+
+// RPS converts call counts into an average request rate over the window.
+// Traces are usually sampled, so this is a relative weight, not a true rate.
+func (e *Edges) RPS() *promc.ServiceRPSMatrix {
+	m := &promc.ServiceRPSMatrix{Pairs: map[promc.ServicePair]float64{}, Freshness: map[promc.ServicePair]promc.Freshness{}}
+	if e == nil || e.Window <= 0 {
+		return m
+	}
+	for p, s := range e.Pairs {
+		m.Pairs[p] = float64(s.Calls) / e.Window.Seconds()
+		m.Freshness[p] = promc.Measured(e.At)
+	}
+	return m
+}
+
+// Latency returns the q-quantile call latency (ms) per edge.
+func (e *Edges) Latency(q float64) *promc.ServiceLatencyMatrix {
+	m := &promc.ServiceLatencyMatrix{Pairs: map[promc.ServicePair]float64{}, Freshness: map[promc.ServicePair]promc.Freshness{}}
+	if e == nil {
+		return m
+	}
+	for p, s := range e.Pairs {
+		m.Pairs[p] = s.Percentile(q)
+		m.Freshness[p] = promc.Measured(e.At)
+	}
+	return m
+}
+
+type jaegerResponse struct {
+	Data []jaegerTrace `json:"data"`
+}
+
+type jaegerTrace struct {
+	TraceID   string                   `json:"traceID"`
+	Spans     []jaegerSpan             `json:"spans"`
+	Processes map[string]jaegerProcess `json:"processes"`
+}
+
+type jaegerSpan struct {
+	SpanID     string            `json:"spanID"`
+	Duration   int64             `json:"duration"` // microseconds
+	ProcessID  string            `json:"processID"`
+	References []jaegerReference `json:"references"`
+}
+
+type jaegerReference struct {
+	RefType string `json:"refType"`
+	SpanID  string `json:"spanID"`
+}
+
+type jaegerProcess struct {
+	ServiceName string `json:"serviceName"`
+}
+
+// FetchEdges loads up to limit traces per service from the last lookback and
+// counts every parent -> child span pair whose services differ as one call
+// on that edge; the child span's duration is the call latency.
+func (c *Client) FetchEdges(ctx context.Context, services []string, lookback time.Duration, limit int) (*Edges, error) {
+	end := time.Now()
+	start := end.Add(-lookback)
+	edges := &Edges{Window: lookback, At: end, Pairs: map[promc.ServicePair]*EdgeStats{}}
+	seen := make(map[string]bool)
+
+	for _, svc := range services {
+		traces, err := c.fetchTraces(ctx, svc, start, end, limit)
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range traces {
+			if seen[t.TraceID] {
+				continue
+			}
+			seen[t.TraceID] = true
+			addTraceEdges(edges, t)
+		}
+	}
+	for _, s := range edges.Pairs {
+		sort.Float64s(s.DurationsMs)
+	}
+
+	log.Printf("[lead-net][tracing] derived %d edges from %d traces (lookback=%s)", len(edges.Pairs), len(seen), lookback)
+	return edges, nil
+}
+
+func addTraceEdges(edges *Edges, t jaegerTrace) {
+	serviceOf := make(map[string]string, len(t.Spans))
+	for _, sp := range t.Spans {
+		serviceOf[sp.SpanID] = t.Processes[sp.ProcessID].ServiceName
+	}
+	for _, sp := range t.Spans {
+		child := serviceOf[sp.SpanID]
+		for _, ref := range sp.References {
+			if ref.RefType != "CHILD_OF" {
+				continue
+			}
+			parent := serviceOf[ref.SpanID]
+			if parent == "" || child == "" || parent == child {
+				continue
+			}
+			pair := promc.ServicePair{Src: parent, Dst: child}
+			s := edges.Pairs[pair]
+			if s == nil {
+				s = &EdgeStats{}
+				edges.Pairs[pair] = s
+			}
+			s.Calls++
+			s.DurationsMs = append(s.DurationsMs, float64(sp.Duration)/1000.0)
+		}
+	}
+}
+
+func (c *Client) fetchTraces(ctx context.Context, service string, start, end time.Time, limit int) ([]jaegerTrace, error) {
+	u := *c.baseURL
+	u.Path = "/api/traces"
+	qs := u.Query()
+	qs.Set("service", service)
+	qs.Set("start", strconv.FormatInt(start.UnixMicro(), 10))
+	qs.Set("end", strconv.FormatInt(end.UnixMicro(), 10))
+	if limit > 0 {
+		qs.Set("limit", strconv.Itoa(limit))
+	}
+	u.RawQuery = qs.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		log.Printf("[lead-net][tracing] trace query for service %q failed: %v", service, err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("jaeger returned %s for service %q", resp.Status, service)
+	}
+
+	var out jaegerResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("decode traces for service %q: %w", service, err)
+	}
+	return out.Data, nil
+}
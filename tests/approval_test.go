@@ -0,0 +1,160 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"lead-net-affinity/pkg/config"
+	"lead-net-affinity/pkg/controller"
+)
+
+func approvalFixture(approval config.ApprovalConfig) (*config.Config, *fakeKube) {
+	cfg := &config.Config{
+		NamespaceSelector: []string{"test-ns"},
+		Graph: config.ServiceGraphConfig{
+			Entry:    "a",
+			Services: []config.ServiceNode{{Name: "a", DependsOn: []string{"b"}}, {Name: "b", DependsOn: []string{"c"}}, {Name: "c"}},
+		},
+		Scoring:  config.ScoringWeights{PathLengthWeight: 1, PodCountWeight: 1, ServiceEdgesWeight: 1},
+		Affinity: config.AffinityConfig{TopPaths: 1, MinAffinityWeight: 50, MaxAffinityWeight: 100},
+		Approval: approval,
+	}
+	deploy := func(name string, replicas int32) appsv1.Deployment {
+		return appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{
+			Name: name, Namespace: "test-ns", Labels: map[string]string{"io.kompose.service": name},
+		}, Spec: appsv1.DeploymentSpec{Replicas: &replicas, Template: corev1.PodTemplateSpec{
+			ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"io.kompose.service": name}},
+		}}}
+	}
+	return cfg, &fakeKube{deploys: []appsv1.Deployment{deploy("a", 1), deploy("b", 1), deploy("c", 4)}}
+}
+
+func TestController_ApprovalGateHoldsPatches(t *testing.T) {
+	cfg, fk := approvalFixture(config.ApprovalConfig{Enabled: true})
+	cfg.Server.Debug.Token = "s3cret"
+	ctrl := controller.New(cfg, fk, &fakeProm{})
+	ctx := context.Background()
+
+	if err := ctrl.ReconcileOnceForTest(ctx); err != nil {
+		t.Fatalf("reconcile error: %v", err)
+	}
+	// a (the entry) gets no pod affinity; an update that changes nothing
+	// needs no approval.
+	if fk.updated != 1 {
+		t.Fatalf("expected only the no-op update before approval, got %d", fk.updated)
+	}
+	queued := ctrl.Approvals()
+	if len(queued) != 2 || queued[0].State != controller.ApprovalPending || queued[0].Kind != controller.ActionPatch {
+		t.Fatalf("expected 2 pending patches, got %+v", queued)
+	}
+
+	ts := httptest.NewServer(ctrl.Handler())
+	defer ts.Close()
+	decideWith := func(token, id, verb string) int {
+		req, _ := http.NewRequest(http.MethodPost, ts.URL+"/approvals/"+id+"/"+verb, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("POST: %v", err)
+		}
+		defer resp.Body.Close()
+		return resp.StatusCode
+	}
+	decide := func(id, verb string) int { return decideWith("s3cret", id, verb) }
+	var approveID, denyID string
+	for _, a := range queued {
+		if a.Name == "b" {
+			approveID = a.ID
+		} else {
+			denyID = a.ID
+		}
+	}
+	if code := decideWith("", approveID, "approve"); code != http.StatusUnauthorized {
+		t.Fatalf("approve without the token: expected 401, got %d", code)
+	}
+	if code := decideWith("wrong", approveID, "approve"); code != http.StatusUnauthorized {
+		t.Fatalf("approve with a wrong token: expected 401, got %d", code)
+	}
+	if code := decide(approveID, "approve"); code != http.StatusOK {
+		t.Fatalf("approve: status %d", code)
+	}
+	if code := decide(denyID, "deny"); code != http.StatusOK {
+		t.Fatalf("deny: status %d", code)
+	}
+	if code := decide(denyID, "approve"); code != http.StatusConflict {
+		t.Fatalf("deciding twice: expected 409, got %d", code)
+	}
+	if code := decide("nope", "approve"); code != http.StatusNotFound {
+		t.Fatalf("unknown id: expected 404, got %d", code)
+	}
+
+	// The controller re-lists deployments from the cluster, which still
+	// carry their old affinity.
+	_, fresh := approvalFixture(cfg.Approval)
+	fk.deploys = fresh.deploys
+	if err := ctrl.ReconcileOnceForTest(ctx); err != nil {
+		t.Fatalf("reconcile error: %v", err)
+	}
+	if fk.updated != 3 {
+		t.Fatalf("expected the no-op and the approved patch to be applied, got %d updates in total", fk.updated)
+	}
+
+	resp, err := http.Get(ts.URL + "/approvals")
+	if err != nil {
+		t.Fatalf("GET /approvals: %v", err)
+	}
+	defer resp.Body.Close()
+	var left []controller.PendingAction
+	if err := json.NewDecoder(resp.Body).Decode(&left); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(left) != 1 || left[0].ID != denyID || left[0].State != controller.ApprovalDenied {
+		t.Fatalf("expected the denied patch to stay denied, got %+v", left)
+	}
+}
+
+func TestController_ApprovalAutoApprovesLowRisk(t *testing.T) {
+	cfg, fk := approvalFixture(config.ApprovalConfig{Enabled: true, AutoApproveBelowRisk: 2})
+	ctrl := controller.New(cfg, fk, &fakeProm{})
+	if err := ctrl.ReconcileOnceForTest(context.Background()); err != nil {
+		t.Fatalf("reconcile error: %v", err)
+	}
+	if fk.updated != 2 {
+		t.Fatalf("expected the no-op and the single-replica patch to be applied, got %d updates", fk.updated)
+	}
+	if q := ctrl.Approvals(); len(q) != 1 || q[0].Name != "c" || q[0].Risk != 4 {
+		t.Fatalf("expected only c (4 replicas) queued, got %+v", q)
+	}
+}
+
+func TestController_ApprovalDecisionsNeedAToken(t *testing.T) {
+	cfg, fk := approvalFixture(config.ApprovalConfig{Enabled: true})
+	ctrl := controller.New(cfg, fk, &fakeProm{})
+	if err := ctrl.ReconcileOnceForTest(context.Background()); err != nil {
+		t.Fatalf("reconcile error: %v", err)
+	}
+	ts := httptest.NewServer(ctrl.Handler())
+	defer ts.Close()
+
+	// No token configured: nobody can decide.
+	id := ctrl.Approvals()[0].ID
+	req, _ := http.NewRequest(http.MethodPost, ts.URL+"/approvals/"+id+"/approve", nil)
+	req.Header.Set("Authorization", "Bearer ")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("POST: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized || ctrl.Approvals()[0].State != controller.ApprovalPending {
+		t.Fatalf("expected 401 and the action still pending, got %d %+v", resp.StatusCode, ctrl.Approvals()[0])
+	}
+}
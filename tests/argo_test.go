@@ -0,0 +1,194 @@
+package tests
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynfake "k8s.io/client-go/dynamic/fake"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+
+	"lead-net-affinity/pkg/config"
+	"lead-net-affinity/pkg/controller"
+	"lead-net-affinity/pkg/kube"
+	"lead-net-affinity/pkg/output"
+	"lead-net-affinity/pkg/rulegen"
+)
+
+// argoKube serves some workloads as Argo Rollouts.
+type argoKube struct {
+	*fakeKube
+	rollouts       []appsv1.Deployment
+	rolloutUpdated int
+}
+
+func (f *argoKube) ListRollouts(context.Context, []string) ([]appsv1.Deployment, error) {
+	return f.rollouts, nil
+}
+
+func (f *argoKube) GetRollout(_ context.Context, namespace, name string) (*appsv1.Deployment, error) {
+	for i := range f.rollouts {
+		if f.rollouts[i].Namespace == namespace && f.rollouts[i].Name == name {
+			return &f.rollouts[i], nil
+		}
+	}
+	return nil, nil
+}
+
+func (f *argoKube) UpdateRollout(context.Context, *appsv1.Deployment) error {
+	f.rolloutUpdated++
+	return nil
+}
+
+func rolloutObject(name string, spec map[string]any) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "argoproj.io/v1alpha1",
+		"kind":       "Rollout",
+		"metadata":   map[string]any{"name": name, "namespace": "test-ns", "generation": int64(2)},
+		"spec":       spec,
+		"status":     map[string]any{"phase": "Healthy", "observedGeneration": "2", "replicas": int64(2), "updatedReplicas": int64(2), "availableReplicas": int64(2)},
+	}}
+}
+
+func TestKubeClient_Rollouts(t *testing.T) {
+	dyn := dynfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{kube.RolloutGVR: "RolloutList"},
+		rolloutObject("web", map[string]any{
+			"replicas": int64(2),
+			"selector": map[string]any{"matchLabels": map[string]any{"app": "web"}},
+			"template": map[string]any{
+				"metadata": map[string]any{"labels": map[string]any{"app": "web"}},
+				"spec": map[string]any{"containers": []any{map[string]any{"name": "web", "image": "web:1",
+					"resources": map[string]any{"requests": map[string]any{"cpu": "500m", "memory": "1Gi"}}}}},
+			},
+			"strategy": map[string]any{"canary": map[string]any{"steps": []any{map[string]any{"setWeight": int64(20)}}}},
+		}),
+		rolloutObject("ref", map[string]any{"workloadRef": map[string]any{"apiVersion": "apps/v1", "kind": "Deployment", "name": "ref"}}),
+	)
+	c := kube.NewForClients(k8sfake.NewSimpleClientset(), dyn)
+	ctx := context.Background()
+
+	list, err := c.ListRollouts(ctx, []string{"test-ns"})
+	if err != nil {
+		t.Fatalf("ListRollouts: %v", err)
+	}
+	if len(list) != 1 || list[0].Name != "web" {
+		t.Fatalf("expected only the rollout with a pod template, got %d", len(list))
+	}
+	d := &list[0]
+	if !kube.IsRollout(d) || kube.RolloutPhase(d) != kube.RolloutPhaseHealthy || d.Status.ObservedGeneration != 2 {
+		t.Fatalf("unexpected conversion: %+v %+v", d.TypeMeta, d.Status)
+	}
+	if done, err := kube.RolloutComplete(d); !done || err != nil {
+		t.Fatalf("expected a healthy rollout complete, got %v %v", done, err)
+	}
+
+	d.Spec.Template.Spec.Affinity = &corev1.Affinity{NodeAffinity: &corev1.NodeAffinity{
+		PreferredDuringSchedulingIgnoredDuringExecution: []corev1.PreferredSchedulingTerm{{Weight: 10,
+			Preference: corev1.NodeSelectorTerm{MatchExpressions: []corev1.NodeSelectorRequirement{{Key: "zone", Operator: corev1.NodeSelectorOpIn, Values: []string{"a"}}}}}},
+	}}
+	if err := c.UpdateRollout(ctx, d); err != nil {
+		t.Fatalf("UpdateRollout: %v", err)
+	}
+	got, err := c.GetRollout(ctx, "test-ns", "web")
+	if err != nil {
+		t.Fatalf("GetRollout: %v", err)
+	}
+	if aff := got.Spec.Template.Spec.Affinity; aff == nil || aff.NodeAffinity == nil || got.Spec.Template.Labels["app"] != "web" {
+		t.Fatalf("expected the affinity patched and the template kept, got %+v", got.Spec.Template)
+	}
+
+	// Ownership and decision markers and Guaranteed CPUs reach the Rollout
+	// too; fields LEAD does not own, like the strategy, are kept.
+	d.Annotations[kube.ManagedAnnotation] = "true"
+	d.Annotations[kube.ManagerAnnotation] = controller.DefaultManager
+	d.Spec.Template.Annotations = map[string]string{kube.DecisionAnnotation: "abc123"}
+	rulegen.ApplyLatencyCritical(d, "")
+	if err := c.UpdateRollout(ctx, d); err != nil {
+		t.Fatalf("UpdateRollout: %v", err)
+	}
+	got, err = c.GetRollout(ctx, "test-ns", "web")
+	if err != nil {
+		t.Fatalf("GetRollout: %v", err)
+	}
+	if got.Annotations[kube.ManagedAnnotation] != "true" || got.Annotations[kube.ManagerAnnotation] != controller.DefaultManager {
+		t.Fatalf("expected the ownership annotations on the rollout, got %v", got.Annotations)
+	}
+	if got.Spec.Template.Annotations[kube.DecisionAnnotation] != "abc123" {
+		t.Fatalf("expected the decision on the rollout's template, got %v", got.Spec.Template.Annotations)
+	}
+	if r := got.Spec.Template.Spec.Containers[0].Resources; r.Limits.Cpu().String() != "1" || r.Requests.Memory().String() != "1Gi" {
+		t.Fatalf("expected Guaranteed whole-CPU resources on the rollout, got %v", r)
+	}
+	raw, _ := dyn.Resource(kube.RolloutGVR).Namespace("test-ns").Get(ctx, "web", metav1.GetOptions{})
+	if _, found, _ := unstructured.NestedSlice(raw.Object, "spec", "strategy", "canary", "steps"); !found {
+		t.Fatalf("rollout strategy lost: %v", raw.Object["spec"])
+	}
+
+	d.Spec.Template.Spec.Affinity = nil
+	if err := c.UpdateRollout(ctx, d); err != nil {
+		t.Fatalf("UpdateRollout (remove): %v", err)
+	}
+	if got, _ := c.GetRollout(ctx, "test-ns", "web"); got.Spec.Template.Spec.Affinity != nil {
+		t.Fatalf("expected the affinity removed, got %+v", got.Spec.Template.Spec.Affinity)
+	}
+}
+
+func TestController_ArgoRollouts(t *testing.T) {
+	cfg, fk := approvalFixture(config.ApprovalConfig{})
+	// c is an Argo Rollout paused in a canary step.
+	c := fk.deploys[2]
+	fk.deploys = fk.deploys[:2]
+	c.TypeMeta.APIVersion, c.TypeMeta.Kind = "argoproj.io/v1alpha1", kube.RolloutKind
+	c.Annotations = map[string]string{kube.RolloutPhaseAnnotation: kube.RolloutPhasePaused}
+	ak := &argoKube{fakeKube: fk, rollouts: []appsv1.Deployment{c}}
+	ctx := context.Background()
+
+	ctrl := controller.New(cfg, ak, &fakeProm{})
+	if err := ctrl.ReconcileOnceForTest(ctx); err != nil {
+		t.Fatalf("reconcile error: %v", err)
+	}
+	if fk.updated != 2 || ak.rolloutUpdated != 0 {
+		t.Fatalf("expected rollouts ignored without controller.argoRollouts, got %d/%d updates", fk.updated, ak.rolloutUpdated)
+	}
+
+	cfg.Controller.ArgoRollouts = true
+	fk.updated = 0
+	if err := ctrl.ReconcileOnceForTest(ctx); err != nil {
+		t.Fatalf("reconcile error: %v", err)
+	}
+	if fk.updated != 2 || ak.rolloutUpdated != 0 {
+		t.Fatalf("expected the paused rollout deferred, got %d/%d updates", fk.updated, ak.rolloutUpdated)
+	}
+	if !strings.Contains(strings.Join(ctrl.Status().Degraded, "\n"), "test-ns/c deferred: rollout Paused") {
+		t.Fatalf("expected the deferral in the status, got %+v", ctrl.Status().Degraded)
+	}
+
+	ak.rollouts[0].Annotations[kube.RolloutPhaseAnnotation] = kube.RolloutPhaseHealthy
+	if err := ctrl.ReconcileOnceForTest(ctx); err != nil {
+		t.Fatalf("reconcile error: %v", err)
+	}
+	if ak.rolloutUpdated != 1 {
+		t.Fatalf("expected the healthy rollout patched, got %d updates", ak.rolloutUpdated)
+	}
+}
+
+func TestOutput_RolloutPatchKind(t *testing.T) {
+	d := testPatchDeployment()
+	d.APIVersion, d.Kind = "argoproj.io/v1alpha1", kube.RolloutKind
+	files, err := output.AffinityPatches([]*appsv1.Deployment{d})
+	if err != nil {
+		t.Fatalf("AffinityPatches: %v", err)
+	}
+	for _, b := range files {
+		if !strings.Contains(string(b), "apiVersion: argoproj.io/v1alpha1") || !strings.Contains(string(b), "kind: Rollout") {
+			t.Fatalf("expected a Rollout patch, got:\n%s", b)
+		}
+	}
+}
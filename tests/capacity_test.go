@@ -0,0 +1,99 @@
+package tests
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"lead-net-affinity/pkg/config"
+	"lead-net-affinity/pkg/controller"
+	"lead-net-affinity/pkg/kube"
+	"lead-net-affinity/pkg/metrics"
+)
+
+func TestController_ExpansionHintsForFullZone(t *testing.T) {
+	cfg := &config.Config{
+		NamespaceSelector: []string{"test-ns"},
+		Graph: config.ServiceGraphConfig{
+			Entry:    "a",
+			Services: []config.ServiceNode{{Name: "a", DependsOn: []string{"b"}}, {Name: "b"}},
+		},
+		Controller: config.ControllerConfig{ExpansionHints: true},
+	}
+	node := func(name, zone, cpu string) corev1.Node {
+		return corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{corev1.LabelTopologyZone: zone}},
+			Status: corev1.NodeStatus{
+				Allocatable: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse(cpu)},
+				Conditions:  []corev1.NodeCondition{{Type: corev1.NodeReady, Status: corev1.ConditionTrue}},
+			},
+		}
+	}
+	pod := func(name, svc, node, cpu string) corev1.Pod {
+		return corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "test-ns", Labels: map[string]string{"io.kompose.service": svc}},
+			Spec: corev1.PodSpec{NodeName: node, Containers: []corev1.Container{{
+				Resources: corev1.ResourceRequirements{Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse(cpu)}},
+			}}},
+			Status: corev1.PodStatus{Phase: corev1.PodRunning},
+		}
+	}
+	pending := pod("a-2", "a", "", "250m")
+	pending.Status = corev1.PodStatus{Phase: corev1.PodPending, Conditions: []corev1.PodCondition{{
+		Type: corev1.PodScheduled, Status: corev1.ConditionFalse, Reason: corev1.PodReasonUnschedulable,
+	}}}
+
+	k8s := &fakeKube{
+		nodes: []corev1.Node{node("n1", "zone-a", "1"), node("n2", "zone-b", "4")},
+		pods: []corev1.Pod{
+			pod("b-0", "b", "n1", "800m"),
+			pod("a-0", "a", "n2", "500m"), // dependency runs in zone-a, which has 200m left
+			pending,
+		},
+	}
+	ctrl := controller.New(cfg, k8s, &fakeProm{})
+	ctrl.EnableDryRunForTest()
+	if err := ctrl.ReconcileOnceForTest(context.Background()); err != nil {
+		t.Fatalf("reconcile error: %v", err)
+	}
+
+	hints := ctrl.Status().DesiredCapacity
+	if len(hints) != 1 || hints[0].Zone != "zone-a" || hints[0].Pods != 2 || hints[0].CPUMillis != 750 {
+		t.Fatalf("expected 2 pods / 750m wanted in zone-a, got %+v", hints)
+	}
+	if v := metrics.Default.Value("lead_net_desired_capacity", map[string]string{"zone": "zone-a"}); v != 2 {
+		t.Fatalf("lead_net_desired_capacity{zone-a} = %v, want 2", v)
+	}
+}
+
+func TestEffectiveRequests_SumsContainersAndSidecars(t *testing.T) {
+	req := func(cpu string) corev1.ResourceRequirements {
+		return corev1.ResourceRequirements{Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse(cpu)}}
+	}
+	always := corev1.ContainerRestartPolicyAlways
+	spec := corev1.PodSpec{
+		InitContainers: []corev1.Container{
+			{Name: "log-shipper", Resources: req("50m"), RestartPolicy: &always}, // native sidecar
+			{Name: "migrate", Resources: req("200m")},
+		},
+		Containers: []corev1.Container{
+			{Name: "app", Resources: req("300m")},
+			{Name: "worker", Resources: req("100m")},
+			{Name: "istio-proxy", Resources: req("100m")},
+		},
+		Overhead: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("10m")},
+	}
+	got := kube.EffectiveRequests(&spec, kube.DefaultSidecarContainers)
+	if got.CPUMillis != 560 || got.SidecarCPUMillis != 150 || got.AppCPUMillis() != 410 {
+		t.Fatalf("want 560m with 150m of sidecars, got %+v", got)
+	}
+
+	// A heavy init container dominates the pod's request.
+	spec.InitContainers[1].Resources = req("2")
+	if got := kube.EffectiveRequests(&spec, nil); got.CPUMillis != 2060 || got.SidecarCPUMillis != 50 {
+		t.Fatalf("want 2060m (init step plus overhead) with 50m of native sidecars, got %+v", got)
+	}
+}
@@ -0,0 +1,45 @@
+package tests
+
+import (
+	"context"
+	"testing"
+
+	"lead-net-affinity/pkg/config"
+	"lead-net-affinity/pkg/controller"
+)
+
+func TestController_ComponentHealth(t *testing.T) {
+	cfg := &config.Config{
+		NamespaceSelector: []string{"test-ns"},
+		Graph:             config.ServiceGraphConfig{Entry: "a", Services: []config.ServiceNode{{Name: "a"}}},
+	}
+	prom := &matrixProm{} // no network matrix
+	ctrl := controller.New(cfg, &fakeKube{}, prom)
+	if err := ctrl.ReconcileOnceForTest(context.Background()); err != nil {
+		t.Fatalf("reconcile error: %v", err)
+	}
+
+	byName := make(map[string]controller.ComponentStatus)
+	for _, s := range ctrl.Status().Components {
+		byName[s.Name] = s
+	}
+	if k := byName[controller.ComponentKubernetes]; !k.Healthy || k.LastSuccess.IsZero() {
+		t.Fatalf("expected kubernetes healthy with a last success, got %+v", k)
+	}
+	nm := byName[controller.ComponentNetworkMetrics]
+	if nm.Healthy || nm.LastError == "" || nm.Failures != 1 || nm.FailingSince.IsZero() {
+		t.Fatalf("expected network-metrics failing once, got %+v", nm)
+	}
+	if _, ok := byName[controller.ComponentTraces]; ok {
+		t.Fatalf("expected no traces component without tracing configured")
+	}
+
+	if err := ctrl.ReconcileOnceForTest(context.Background()); err != nil {
+		t.Fatalf("reconcile error: %v", err)
+	}
+	for _, s := range ctrl.Components() {
+		if s.Name == controller.ComponentNetworkMetrics && (s.Failures != 2 || !s.FailingSince.Equal(nm.FailingSince)) {
+			t.Fatalf("expected the failure counted from the first one, got %+v", s)
+		}
+	}
+}
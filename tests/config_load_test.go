@@ -3,7 +3,9 @@ package tests
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"lead-net-affinity/pkg/config"
 )
@@ -54,3 +56,179 @@ affinity:
 		t.Fatalf("weights/affinity not parsed: %+v %+v", cfg.Scoring, cfg.Affinity)
 	}
 }
+
+func TestApplyEdgeSourceOTelServiceGraph(t *testing.T) {
+	p := config.PrometheusConfig{
+		EdgeSource:   config.EdgeSourceOTelServiceGraph,
+		SampleWindow: "2m",
+		EdgeSelector: `env="prod"`,
+	}
+	if err := p.ApplyEdgeSource(); err != nil {
+		t.Fatalf("ApplyEdgeSource: %v", err)
+	}
+	if p.ServicePairSrcLabel != "client" || p.ServicePairDstLabel != "server" {
+		t.Fatalf("labels = %q/%q", p.ServicePairSrcLabel, p.ServicePairDstLabel)
+	}
+	wantRPS := `sum by (client, server) (rate(traces_service_graph_request_total{env="prod"}[2m]))`
+	if p.ServicePairRPSQuery != wantRPS {
+		t.Fatalf("rps query = %q", p.ServicePairRPSQuery)
+	}
+	if !strings.Contains(p.ServicePairLatencyQuery, `traces_service_graph_request_server_seconds_bucket{env="prod"}[2m]`) ||
+		p.ServicePairLatencyUnit != "s" {
+		t.Fatalf("latency query = %q unit=%q", p.ServicePairLatencyQuery, p.ServicePairLatencyUnit)
+	}
+
+	// Explicit settings win over the preset.
+	p = config.PrometheusConfig{EdgeSource: "otel-servicegraph", ServicePairRPSQuery: "custom"}
+	if err := p.ApplyEdgeSource(); err != nil {
+		t.Fatalf("ApplyEdgeSource: %v", err)
+	}
+	if p.ServicePairRPSQuery != "custom" {
+		t.Fatalf("explicit rps query overridden: %q", p.ServicePairRPSQuery)
+	}
+
+	p = config.PrometheusConfig{EdgeSource: "zipkin"}
+	if err := p.ApplyEdgeSource(); err == nil {
+		t.Fatal("expected error for unknown edge source")
+	}
+}
+
+func TestApplyEdgeFamilies(t *testing.T) {
+	p := config.PrometheusConfig{
+		SampleWindow: "2m",
+		EdgeFamilies: []config.EdgeFamilyConfig{{Family: config.EdgeFamilyGRPC}, {Family: config.EdgeFamilyTCP, Selector: `namespace="db"`}},
+	}
+	if err := p.ApplyEdgeFamilies(); err != nil {
+		t.Fatalf("ApplyEdgeFamilies: %v", err)
+	}
+	grpc, tcp := p.EdgeFamilies[0], p.EdgeFamilies[1]
+	if grpc.SrcLabel != "" || grpc.DstLabel != "app" || grpc.LatencyUnit != "s" ||
+		grpc.RPSQuery != "sum by (app) (rate(grpc_server_handled_total[2m]))" {
+		t.Fatalf("grpc preset: %+v", grpc)
+	}
+	if tcp.LatencyQuery != "" ||
+		tcp.RPSQuery != `sum by (source_workload, destination_workload) (rate(istio_tcp_connections_opened_total{namespace="db"}[2m]))` {
+		t.Fatalf("tcp preset: %+v", tcp)
+	}
+	if !strings.Contains(p.ServicePairBytesQuery, "istio_tcp_sent_bytes_total") {
+		t.Fatalf("tcp family should provide the bytes query, got %q", p.ServicePairBytesQuery)
+	}
+
+	for _, bad := range []config.EdgeFamilyConfig{{Family: "amqp"}, {RPSQuery: "x"}, {DstLabel: "app"}} {
+		p := config.PrometheusConfig{EdgeFamilies: []config.EdgeFamilyConfig{bad}}
+		if err := p.ApplyEdgeFamilies(); err == nil {
+			t.Fatalf("%+v: expected an error", bad)
+		}
+	}
+}
+
+func TestGatewayPreset(t *testing.T) {
+	g := config.GatewayConfig{Controller: config.GatewayIngressNginx, Selector: `ingress="shop"`}
+	if err := g.ApplyPreset("2m"); err != nil {
+		t.Fatalf("ApplyPreset: %v", err)
+	}
+	want := `histogram_quantile(0.95, sum by (le) (rate(nginx_ingress_controller_request_duration_seconds_bucket{ingress="shop"}[2m])))`
+	if g.LatencyQuery != want || g.LatencyUnit != "s" {
+		t.Fatalf("query = %q unit = %q", g.LatencyQuery, g.LatencyUnit)
+	}
+
+	g = config.GatewayConfig{Controller: config.GatewayEnvoy, Quantile: 0.5}
+	if err := g.ApplyPreset(""); err != nil || g.LatencyUnit != "ms" ||
+		!strings.HasPrefix(g.LatencyQuery, "histogram_quantile(0.5, ") {
+		t.Fatalf("envoy preset: %q unit=%q err=%v", g.LatencyQuery, g.LatencyUnit, err)
+	}
+
+	for _, bad := range []config.GatewayConfig{{Controller: "haproxy"}, {Quantile: 1}, {LatencyUnit: "min"}} {
+		if err := bad.ApplyPreset(""); err == nil {
+			t.Fatalf("%+v: expected an error", bad)
+		}
+	}
+}
+
+func TestConfigLoad_RejectsBadUnitsAndLimits(t *testing.T) {
+	cases := map[string]string{
+		"unit":   "prometheus:\n  servicePairLatencyUnit: minutes\n",
+		"limit":  "scoring:\n  limits:\n    maxLatencyMs: -1\n",
+		"tls":    "server:\n  tlsCertFile: tls.crt\n",
+		"proxy":  "prometheus:\n  http:\n    proxyURL: \"::\"\n",
+		"key":    "serviceLabelKeys: [\"app name\"]\n",
+		"value":  "graph:\n  services:\n    - name: db\n      labelSelector: {tier: \"data base\"}\n",
+		"hook":   "hooks:\n  - name: zones\n    failurePolicy: retry\n",
+		"policy": "policy:\n  timeoutMs: -5\n",
+		"wasmrt": "policy:\n  runtime: [\"\", run]\n",
+		"extern": "graph:\n  services:\n    - name: db\n      dependsOn: [x]\n      external: {zone: z1}\n",
+		"oci":    "output:\n  oci:\n    repository: lead-patches\n",
+		"cmref":  "output:\n  configMap: lead-patches\n",
+		"report": "reports:\n  configMap: ops/lead/reports\n",
+		"s3reg":  "output:\n  s3:\n    bucket: b\n",
+		"ocitag": "output:\n  oci:\n    repository: ghcr.io/acme/lead\n    tag: \":v1\"\n",
+		"s3":     "output:\n  s3:\n    bucket: b\n    endpoint: minio:9000\n",
+	}
+	t.Setenv("AWS_REGION", "")
+	for name, y := range cases {
+		fp := filepath.Join(t.TempDir(), "config.yaml")
+		if err := os.WriteFile(fp, []byte(y), 0644); err != nil {
+			t.Fatalf("write temp yaml: %v", err)
+		}
+		if _, err := config.Load(fp); err == nil {
+			t.Fatalf("%s: expected a validation error", name)
+		}
+	}
+}
+
+func TestConfigLoad_StrictKeysAndEnv(t *testing.T) {
+	load := func(y string) (*config.Config, error) {
+		fp := filepath.Join(t.TempDir(), "config.yaml")
+		if err := os.WriteFile(fp, []byte(y), 0644); err != nil {
+			t.Fatalf("write temp yaml: %v", err)
+		}
+		return config.Load(fp)
+	}
+
+	_, err := load("graph:\n  entry: fe\nscorring:\n  rpsWeight: 2\n")
+	if err == nil || !strings.Contains(err.Error(), `config.yaml:3:1: unknown field "scorring"`) {
+		t.Fatalf("expected an unknown field error with its position, got %v", err)
+	}
+	_, err = load("scoring:\n  rpsWeight: fast\n")
+	if err == nil || !strings.Contains(err.Error(), "config.yaml:2:3:") {
+		t.Fatalf("expected a type error with its position, got %v", err)
+	}
+
+	t.Setenv("LEAD_TEST_PROM_URL", "http://prom:9090")
+	cfg, err := load("prometheus:\n  url: ${LEAD_TEST_PROM_URL}\n  sampleWindow: ${LEAD_TEST_UNSET:-5m}\n  NodeRTTQuery: up$${x}\n")
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if p := cfg.Prometheus; p.URL != "http://prom:9090" || p.SampleWindow != "5m" || p.NodeRTTQuery != "up${x}" {
+		t.Fatalf("environment not interpolated: %+v", p)
+	}
+	if _, err := load("prometheus:\n  url: ${LEAD_TEST_UNSET}\n"); err == nil || !strings.Contains(err.Error(), "LEAD_TEST_UNSET (line 2)") {
+		t.Fatalf("expected an error for an unset variable, got %v", err)
+	}
+
+	cfg, err = load("rebalancing:\n  maxConcurrentDeletions: 4\n")
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.Rebalancing.MaxDeletionsPerPass != 4 {
+		t.Fatalf("deprecated maxConcurrentDeletions not applied: %+v", cfg.Rebalancing)
+	}
+	if _, err := load("rebalancing:\n  maxDeletionsPerPass: 2\n  maxConcurrentDeletions: 4\n"); err == nil {
+		t.Fatalf("expected an error for both spellings of maxDeletionsPerPass")
+	}
+}
+
+func TestServerConfigDefaults(t *testing.T) {
+	var s config.ServerConfig
+	if s.AddressOrDefault() != ":8080" || s.ReadHeaderTimeout() != 5*time.Second ||
+		s.ShutdownTimeout() != 5*time.Second || s.WriteTimeout() != 0 {
+		t.Fatalf("unexpected defaults: %s %s %s %s", s.AddressOrDefault(), s.ReadHeaderTimeout(), s.ShutdownTimeout(), s.WriteTimeout())
+	}
+	s = config.ServerConfig{Address: "127.0.0.1:9443", WriteTimeoutSeconds: 1.5}
+	if s.AddressOrDefault() != "127.0.0.1:9443" || s.WriteTimeout() != 1500*time.Millisecond {
+		t.Fatalf("configured values not used: %+v", s)
+	}
+	if err := (config.ServerConfig{ReadTimeoutSeconds: -1}).Validate(); err == nil {
+		t.Fatalf("expected an error for a negative timeout")
+	}
+}
@@ -2,27 +2,48 @@ package tests
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
 
 	"lead-net-affinity/pkg/config"
 	"lead-net-affinity/pkg/controller"
+	"lead-net-affinity/pkg/graph"
+	"lead-net-affinity/pkg/metrics"
+	"lead-net-affinity/pkg/output"
 	promc "lead-net-affinity/pkg/prometheus"
+	"lead-net-affinity/pkg/rbac"
+	"lead-net-affinity/pkg/supervise"
+	"lead-net-affinity/pkg/tracing"
 )
 
 // ---- Fakes ----
 
 type fakeKube struct {
-	deploys []appsv1.Deployment
-	pods    []corev1.Pod
-	updated int
+	deploys  []appsv1.Deployment
+	pods     []corev1.Pod
+	nodes    []corev1.Node
+	services []corev1.Service
+	updated  int
+
+	listCalls atomic.Int32
+	deleted   atomic.Int32
 }
 
 func (f *fakeKube) ListDeployments(_ context.Context, _ []string) ([]appsv1.Deployment, error) {
+	f.listCalls.Add(1)
 	return f.deploys, nil
 }
 
@@ -33,27 +54,110 @@ func (f *fakeKube) UpdateDeployment(_ context.Context, d *appsv1.Deployment) err
 	return nil
 }
 
+func (f *fakeKube) GetDeployment(_ context.Context, namespace, name string) (*appsv1.Deployment, error) {
+	for i := range f.deploys {
+		if f.deploys[i].Namespace == namespace && f.deploys[i].Name == name {
+			return &f.deploys[i], nil
+		}
+	}
+	return nil, fmt.Errorf("deployment %s/%s not found", namespace, name)
+}
+
 func (f *fakeKube) ListPods(_ context.Context, _ string, selector string) ([]corev1.Pod, error) {
-	// Very small selector matcher for "io.kompose.service=name"
-	const key = "io.kompose.service="
-	var name string
-	if len(selector) > len(key) && selector[:len(key)] == key {
-		name = selector[len(key):]
+	sel, err := labels.Parse(selector)
+	if err != nil {
+		return nil, err
+	}
+	var out []corev1.Pod
+	for _, p := range f.pods {
+		if sel.Matches(labels.Set(p.Labels)) {
+			out = append(out, p)
+		}
 	}
+	return out, nil
+}
+
+func (f *fakeKube) ListPodsByPhase(_ context.Context, ns string, phase corev1.PodPhase) ([]corev1.Pod, error) {
 	var out []corev1.Pod
 	for _, p := range f.pods {
-		if p.Labels["io.kompose.service"] == name {
+		if p.Namespace == ns && p.Status.Phase == phase {
 			out = append(out, p)
 		}
 	}
 	return out, nil
 }
 
-type fakeProm struct{}
+func (f *fakeKube) GetNode(_ context.Context, name string) (*corev1.Node, error) {
+	for i := range f.nodes {
+		if f.nodes[i].Name == name {
+			return &f.nodes[i], nil
+		}
+	}
+	return &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name}}, nil
+}
+
+func (f *fakeKube) ListNodes(_ context.Context) ([]corev1.Node, error) {
+	return f.nodes, nil
+}
+
+func (f *fakeKube) ListServices(_ context.Context, _ []string) ([]corev1.Service, error) {
+	return f.services, nil
+}
+
+func (f *fakeKube) DeletePod(_ context.Context, _, _ string) error {
+	f.deleted.Add(1)
+	return nil
+}
+
+type fakeProm struct {
+	rps map[promc.ServicePair]float64 // returned by FetchServicePairRPS
+	lat map[promc.ServicePair]float64 // returned by FetchServiceLatencies
+	bps map[promc.ServicePair]float64 // returned by FetchServicePairBytes
+
+	rollouts map[string]promc.DeploymentRollout // returned by FetchDeploymentRollouts
+	gateway  []float64                          // returned by FetchGatewayLatency, one per call
+	values   map[string]map[string]float64      // returned by FetchServiceValues, by query
+}
 
 func (f *fakeProm) FetchNetworkMatrix(_ context.Context, _, _, _ string) (*promc.NetworkMatrix, error) {
 	// Return a tiny, neutral matrix: effectively zero penalties.
-	return &promc.NetworkMatrix{Links: map[string]*promc.NodeLinkMetrics{}}, nil
+	return &promc.NetworkMatrix{Nodes: map[string]*promc.NodeMetrics{}}, nil
+}
+
+func (f *fakeProm) FetchServiceLatencies(_ context.Context, _, _, _, _ string) (*promc.ServiceLatencyMatrix, error) {
+	if f.lat != nil {
+		return &promc.ServiceLatencyMatrix{Pairs: f.lat}, nil
+	}
+	return &promc.ServiceLatencyMatrix{Pairs: map[promc.ServicePair]float64{}}, nil
+}
+
+func (f *fakeProm) FetchServicePairRPS(_ context.Context, _, _, _ string) (*promc.ServiceRPSMatrix, error) {
+	pairs := map[promc.ServicePair]float64{}
+	for k, v := range f.rps {
+		pairs[k] = v
+	}
+	return &promc.ServiceRPSMatrix{Pairs: pairs}, nil
+}
+
+func (f *fakeProm) FetchServicePairBytes(_ context.Context, _, _, _ string) (*promc.ServiceBytesMatrix, error) {
+	return &promc.ServiceBytesMatrix{Pairs: f.bps}, nil
+}
+
+func (f *fakeProm) FetchDeploymentRollouts(_ context.Context, _ string) (map[string]promc.DeploymentRollout, error) {
+	return f.rollouts, nil
+}
+
+func (f *fakeProm) FetchGatewayLatency(_ context.Context, _, _ string) (float64, bool, error) {
+	if len(f.gateway) == 0 {
+		return 0, false, nil
+	}
+	v := f.gateway[0]
+	f.gateway = f.gateway[1:]
+	return v, true, nil
+}
+
+func (f *fakeProm) FetchServiceValues(_ context.Context, _, query, _ string) (map[string]float64, error) {
+	return f.values[query], nil
 }
 
 // ---- Test ----
@@ -194,6 +298,8 @@ func TestController_DryRun_GeneratesAffinityInMemory(t *testing.T) {
 
 	ctrl := controller.New(cfg, fk, fp)
 	ctrl.EnableDryRunForTest()
+	outDir := t.TempDir()
+	ctrl.SetOutputSinks(&output.DirSink{Dir: outDir})
 
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
 	defer cancel()
@@ -201,6 +307,11 @@ func TestController_DryRun_GeneratesAffinityInMemory(t *testing.T) {
 		t.Fatalf("reconcile error: %v", err)
 	}
 
+	// dry-run still exports the generated rules to the sinks
+	if b, err := os.ReadFile(filepath.Join(outDir, "test-ns.b.yaml")); err != nil || !strings.Contains(string(b), "podAffinity") {
+		t.Fatalf("expected exported affinity patch for svc-b, got %q (err=%v)", b, err)
+	}
+
 	// svc-b (index 1) should now have PodAffinity terms (generated in-memory)
 	aff := fk.deploys[1].Spec.Template.Spec.Affinity
 	if aff == nil || aff.PodAffinity == nil || len(aff.PodAffinity.PreferredDuringSchedulingIgnoredDuringExecution) == 0 {
@@ -258,3 +369,488 @@ func TestController_NonDryRun_AppliesUpdates(t *testing.T) {
 		t.Fatalf("expected updates in non-dry-run, got %d", fk.updated)
 	}
 }
+
+func TestController_ReconcileIntervalConfig(t *testing.T) {
+	cfg := &config.Config{Controller: config.ControllerConfig{IntervalSeconds: 1}}
+	if got := controller.New(cfg, &fakeKube{}, &fakeProm{}).ReconcileIntervalForTest(); got != 5*time.Second {
+		t.Fatalf("expected interval clamped to 5s minimum, got %s", got)
+	}
+
+	cfg.Controller.IntervalSeconds = 0
+	if got := controller.New(cfg, &fakeKube{}, &fakeProm{}).ReconcileIntervalForTest(); got != 30*time.Second {
+		t.Fatalf("expected default interval 30s, got %s", got)
+	}
+
+	t.Setenv("LEAD_NET_INTERVAL", "45s")
+	if got := controller.New(cfg, &fakeKube{}, &fakeProm{}).ReconcileIntervalForTest(); got != 45*time.Second {
+		t.Fatalf("expected env override 45s, got %s", got)
+	}
+}
+
+func TestController_RebalancePods_CapsDeletionsPerPass(t *testing.T) {
+	t.Setenv("LEAD_NET_DRY_DELETE", "false")
+
+	cfg := &config.Config{
+		NamespaceSelector: []string{"test-ns"},
+		Graph:             config.ServiceGraphConfig{Entry: "a", Services: []config.ServiceNode{{Name: "a"}}},
+		Rebalancing:       config.RebalancingConfig{MaxDeletionsPerPass: 2, DeletionsPerSecond: 100},
+	}
+	old := metav1.NewTime(time.Now().Add(-time.Hour))
+	fk := &fakeKube{}
+	for _, name := range []string{"a-1", "a-2", "a-3"} {
+		fk.pods = append(fk.pods, corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: name, Namespace: "test-ns", CreationTimestamp: old,
+				Labels: map[string]string{"io.kompose.service": "a"},
+			},
+			Spec: corev1.PodSpec{NodeName: "bad"},
+		})
+	}
+	deploys := []appsv1.Deployment{{ObjectMeta: metav1.ObjectMeta{
+		Name: "a", Namespace: "test-ns", Labels: map[string]string{"io.kompose.service": "a"},
+	}}}
+
+	ctrl := controller.New(cfg, fk, &fakeProm{})
+	if err := ctrl.RebalancePods(context.Background(), deploys, []string{"bad"}); err != nil {
+		t.Fatalf("rebalance error: %v", err)
+	}
+	if got := fk.deleted.Load(); got != 2 {
+		t.Fatalf("expected deletions capped at 2, got %d", got)
+	}
+}
+
+func TestController_WithoutDeletePermission_DoesNotDeletePods(t *testing.T) {
+	t.Setenv("LEAD_NET_DRY_DELETE", "false")
+
+	cfg := &config.Config{
+		NamespaceSelector: []string{"test-ns"},
+		Graph:             config.ServiceGraphConfig{Entry: "a", Services: []config.ServiceNode{{Name: "a"}}},
+	}
+	fk := &fakeKube{pods: []corev1.Pod{{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "a-1", Namespace: "test-ns", CreationTimestamp: metav1.NewTime(time.Now().Add(-time.Hour)),
+			Labels: map[string]string{"io.kompose.service": "a"},
+		},
+		Spec: corev1.PodSpec{NodeName: "bad"},
+	}}}
+	deploys := []appsv1.Deployment{{ObjectMeta: metav1.ObjectMeta{
+		Name: "a", Namespace: "test-ns", Labels: map[string]string{"io.kompose.service": "a"},
+	}}}
+
+	ctrl := controller.New(cfg, fk, &fakeProm{})
+	ctrl.SetCapabilities(rbac.Capabilities{rbac.FeatureCore: true})
+	if err := ctrl.RebalancePods(context.Background(), deploys, []string{"bad"}); err != nil {
+		t.Fatalf("rebalance error: %v", err)
+	}
+	if fk.deleted.Load() != 0 || fk.updated != 0 {
+		t.Fatalf("expected no deletes/updates without permissions, got deleted=%d updated=%d", fk.deleted.Load(), fk.updated)
+	}
+}
+
+func TestController_NamespaceScoped_ResolvesBadNodeFromPodHostIP(t *testing.T) {
+	cfg := &config.Config{
+		NamespaceSelector: []string{"test-ns"},
+		Scoring:           config.ScoringWeights{BadLatencyMs: 10, BadDropRate: 1},
+	}
+	fk := &fakeKube{pods: []corev1.Pod{{
+		ObjectMeta: metav1.ObjectMeta{Name: "a-1", Namespace: "test-ns", Labels: map[string]string{"io.kompose.service": "a"}},
+		Spec:       corev1.PodSpec{NodeName: "worker-1"},
+		Status:     corev1.PodStatus{HostIP: "10.0.0.5"},
+	}}}
+	nm := &promc.NetworkMatrix{Nodes: map[string]*promc.NodeMetrics{
+		"10.0.0.5": {NodeID: "10.0.0.5", AvgLatencyMs: 50},
+	}}
+
+	ctrl := controller.New(cfg, fk, &fakeProm{})
+	ctrl.SetCapabilities(rbac.Capabilities{rbac.FeatureCore: true, rbac.FeatureApplyAffinity: true})
+	bad := ctrl.IdentifyBadNodes(nm)
+	if len(bad) != 1 || bad[0] != "worker-1" {
+		t.Fatalf("expected bad node worker-1 resolved via pod host IP, got %v", bad)
+	}
+}
+
+func TestController_SetName_LabelsMetrics(t *testing.T) {
+	cfg := &config.Config{Graph: config.ServiceGraphConfig{Entry: "a", Services: []config.ServiceNode{{Name: "a"}}}}
+	ctrl := controller.New(cfg, &fakeKube{}, &fakeProm{})
+	ctrl.SetName("staging")
+
+	labels := map[string]string{"context": "staging"}
+	before := metrics.Default.Value("lead_net_reconcile_total", labels)
+	if err := ctrl.ReconcileOnceForTest(context.Background()); err != nil {
+		t.Fatalf("reconcile error: %v", err)
+	}
+	if got := metrics.Default.Value("lead_net_reconcile_total", labels); got != before+1 {
+		t.Fatalf("expected reconcile counter for context staging to grow by 1, got %v -> %v", before, got)
+	}
+}
+
+func TestController_Run_TriggerIsDebounced(t *testing.T) {
+	cfg := &config.Config{
+		NamespaceSelector: []string{"test-ns"},
+		Graph: config.ServiceGraphConfig{
+			Entry:    "a",
+			Services: []config.ServiceNode{{Name: "a"}},
+		},
+		Controller: config.ControllerConfig{IntervalSeconds: 60, DebounceSeconds: 1},
+	}
+	fk := &fakeKube{}
+	ctrl := controller.New(cfg, fk, &fakeProm{})
+	ctrl.EnableDryRunForTest()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1800*time.Millisecond)
+	defer cancel()
+
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		// A burst of events must collapse into a single extra reconcile.
+		ctrl.Trigger("node x ready=false")
+		ctrl.Trigger("replicas changed")
+		ctrl.Trigger("new deployment")
+	}()
+	_ = ctrl.Run(ctx)
+
+	if !ctrl.IsGraphService("a") || ctrl.IsGraphService("zzz") {
+		t.Fatalf("IsGraphService mismatch")
+	}
+	// Graph "a" has a single node path, so reconcile reaches ListDeployments.
+	if got := fk.listCalls.Load(); got != 2 {
+		t.Fatalf("expected 2 reconciles (startup + debounced events), got %d", got)
+	}
+}
+
+func TestController_RunLifecycle(t *testing.T) {
+	cfg := &config.Config{
+		NamespaceSelector: []string{"test-ns"},
+		Graph:             config.ServiceGraphConfig{Entry: "a", Services: []config.ServiceNode{{Name: "a"}}},
+		Controller:        config.ControllerConfig{IntervalSeconds: 60},
+	}
+	ctrl := controller.New(cfg, &fakeKube{}, &fakeProm{})
+	ctrl.EnableDryRunForTest()
+	ctrl.Stop() // not running: no-op
+
+	for round := 0; round < 2; round++ {
+		done := make(chan error, 1)
+		go func() { done <- ctrl.Run(context.Background()) }()
+		deadline := time.Now().Add(2 * time.Second)
+		for ctrl.State() != controller.StateRunning {
+			if time.Now().After(deadline) {
+				t.Fatalf("round %d: controller did not start, state %s", round, ctrl.State())
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+		if err := ctrl.Run(context.Background()); !errors.Is(err, controller.ErrAlreadyRunning) {
+			t.Fatalf("round %d: expected ErrAlreadyRunning from a second Run, got %v", round, err)
+		}
+
+		ctrl.Stop()
+		ctrl.Stop()
+		if err := <-done; !errors.Is(err, context.Canceled) {
+			t.Fatalf("round %d: expected Run to return context.Canceled, got %v", round, err)
+		}
+		if ctrl.State() != controller.StateStopped {
+			t.Fatalf("round %d: expected stopped, got %s", round, ctrl.State())
+		}
+	}
+}
+
+// panickingKube panics on the first call of every reconcile.
+type panickingKube struct{ *fakeKube }
+
+func (panickingKube) ListDeployments(context.Context, []string) ([]appsv1.Deployment, error) {
+	panic("boom")
+}
+
+func TestController_RunReturnsReconcilePanic(t *testing.T) {
+	cfg := &config.Config{
+		NamespaceSelector: []string{"test-ns"},
+		Graph:             config.ServiceGraphConfig{Entry: "a", Services: []config.ServiceNode{{Name: "a"}}},
+		Controller:        config.ControllerConfig{IntervalSeconds: 60},
+	}
+	ctrl := controller.New(cfg, panickingKube{&fakeKube{}}, &fakeProm{})
+	ctrl.EnableDryRunForTest()
+
+	done := make(chan error, 1)
+	go func() { done <- ctrl.Run(context.Background()) }()
+	select {
+	case err := <-done:
+		var pe *supervise.PanicError
+		if !errors.As(err, &pe) || pe.Value != "boom" {
+			t.Fatalf("expected Run to return the reconcile panic, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		ctrl.Stop()
+		t.Fatalf("Run did not stop after the reconcile panicked")
+	}
+	if ctrl.State() != controller.StateStopped {
+		t.Fatalf("expected stopped, got %s", ctrl.State())
+	}
+}
+
+func TestController_ReconcileScoped_OnlyPatchesScopedService(t *testing.T) {
+	cfg := &config.Config{
+		NamespaceSelector: []string{"test-ns"},
+		Graph: config.ServiceGraphConfig{
+			Entry: "a",
+			Services: []config.ServiceNode{
+				{Name: "a", DependsOn: []string{"b", "c"}},
+				{Name: "b"},
+				{Name: "c"},
+			},
+		},
+		Scoring:  config.ScoringWeights{PathLengthWeight: 1},
+		Affinity: config.AffinityConfig{MinAffinityWeight: 50, MaxAffinityWeight: 100},
+	}
+	mk := func(name string) appsv1.Deployment {
+		return appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "test-ns", Labels: map[string]string{"io.kompose.service": name}},
+			Spec: appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"io.kompose.service": name}},
+			}},
+		}
+	}
+	fk := &fakeKube{deploys: []appsv1.Deployment{mk("a"), mk("b"), mk("c")}}
+
+	ctrl := controller.New(cfg, fk, &fakeProm{})
+	if err := ctrl.ReconcileScoped(context.Background(), controller.Scope{Services: []string{"b"}}); err != nil {
+		t.Fatalf("scoped reconcile error: %v", err)
+	}
+	if fk.updated != 1 {
+		t.Fatalf("expected only the scoped deployment to be updated, got %d updates", fk.updated)
+	}
+	// Path a -> c is out of scope, so c gets no rules.
+	if fk.deploys[2].Spec.Template.Spec.Affinity != nil {
+		t.Fatalf("expected no affinity generated for out-of-scope service c")
+	}
+}
+
+type recordingPublisher struct {
+	got []controller.ReconcileStatus
+}
+
+func (r *recordingPublisher) PublishStatus(_ context.Context, st controller.ReconcileStatus) error {
+	r.got = append(r.got, st)
+	return nil
+}
+
+func TestController_PublishesReconcileStatus(t *testing.T) {
+	cfg := &config.Config{
+		NamespaceSelector: []string{"test-ns"},
+		Graph: config.ServiceGraphConfig{
+			Entry:    "a",
+			Services: []config.ServiceNode{{Name: "a", DependsOn: []string{"b"}}, {Name: "b"}},
+		},
+	}
+	ctrl := controller.New(cfg, &fakeKube{}, &fakeProm{})
+	ctrl.EnableDryRunForTest()
+	pub := &recordingPublisher{}
+	ctrl.SetStatusPublisher(pub)
+
+	if err := ctrl.ReconcileOnceForTest(context.Background()); err != nil {
+		t.Fatalf("reconcile error: %v", err)
+	}
+	if len(pub.got) != 1 {
+		t.Fatalf("expected one published status, got %d", len(pub.got))
+	}
+	st := ctrl.Status()
+	if st.PathsEvaluated != 1 || len(st.Errors) != 0 || st.LastSuccessTime.IsZero() {
+		t.Fatalf("unexpected status: %+v", st)
+	}
+}
+
+type recordingDriftNotifier struct {
+	got []controller.DriftReport
+}
+
+func (r *recordingDriftNotifier) NotifyDrift(_ context.Context, rep controller.DriftReport) error {
+	r.got = append(r.got, rep)
+	return nil
+}
+
+func TestController_DetectsGraphDrift(t *testing.T) {
+	cfg := &config.Config{
+		NamespaceSelector: []string{"test-ns"},
+		Graph: config.ServiceGraphConfig{
+			Entry: "a",
+			Services: []config.ServiceNode{
+				{Name: "a", DependsOn: []string{"b", "c"}},
+				{Name: "b"},
+				{Name: "c"},
+			},
+		},
+		Prometheus: config.PrometheusConfig{ServicePairRPSQuery: "rps"},
+	}
+	fp := &fakeProm{rps: map[promc.ServicePair]float64{
+		{Src: "a", Dst: "b"}: 5, // declared, observed
+		{Src: "b", Dst: "d"}: 2, // observed, not declared
+	}}
+	ctrl := controller.New(cfg, &fakeKube{}, fp)
+	ctrl.EnableDryRunForTest()
+	notifier := &recordingDriftNotifier{}
+	ctrl.SetDriftNotifier(notifier)
+
+	for i := 0; i < 2; i++ {
+		if err := ctrl.ReconcileOnceForTest(context.Background()); err != nil {
+			t.Fatalf("reconcile error: %v", err)
+		}
+	}
+
+	d := ctrl.Drift()
+	if len(d.Undeclared) != 1 || d.Undeclared[0].From != "b" || d.Undeclared[0].To != "d" {
+		t.Fatalf("expected undeclared b -> d, got %+v", d.Undeclared)
+	}
+	if len(d.Unobserved) != 1 || d.Unobserved[0].From != "a" || d.Unobserved[0].To != "c" {
+		t.Fatalf("expected unobserved a -> c, got %+v", d.Unobserved)
+	}
+	if len(notifier.got) != 1 {
+		t.Fatalf("expected one notification for an unchanged report, got %d", len(notifier.got))
+	}
+
+	// a -> c shows up: the report changes and is sent again.
+	fp.rps[promc.ServicePair{Src: "a", Dst: "c"}] = 1
+	if err := ctrl.ReconcileOnceForTest(context.Background()); err != nil {
+		t.Fatalf("reconcile error: %v", err)
+	}
+	if len(notifier.got) != 2 || len(ctrl.Drift().Unobserved) != 0 {
+		t.Fatalf("expected a second notification without unobserved edges, got %d / %+v", len(notifier.got), ctrl.Drift())
+	}
+}
+
+type fakeTraceSource struct {
+	edges *tracing.Edges
+	calls int
+}
+
+func (f *fakeTraceSource) FetchEdges(_ context.Context, _ []string, _ time.Duration, _ int) (*tracing.Edges, error) {
+	f.calls++
+	return f.edges, nil
+}
+
+func TestController_TraceEdgesFillMissingPromEdges(t *testing.T) {
+	cfg := &config.Config{
+		NamespaceSelector: []string{"test-ns"},
+		Graph: config.ServiceGraphConfig{
+			Entry:    "a",
+			Services: []config.ServiceNode{{Name: "a", DependsOn: []string{"b"}}, {Name: "b"}},
+		},
+	}
+	ts := &fakeTraceSource{edges: &tracing.Edges{
+		Window: time.Minute,
+		Pairs: map[promc.ServicePair]*tracing.EdgeStats{
+			{Src: "a", Dst: "b"}: {Calls: 60, DurationsMs: []float64{4}},
+			{Src: "a", Dst: "x"}: {Calls: 6, DurationsMs: []float64{1}},
+		},
+	}}
+	ctrl := controller.New(cfg, &fakeKube{}, &fakeProm{})
+	ctrl.EnableDryRunForTest()
+	ctrl.SetTraceSource(ts)
+
+	for i := 0; i < 2; i++ {
+		if err := ctrl.ReconcileOnceForTest(context.Background()); err != nil {
+			t.Fatalf("reconcile error: %v", err)
+		}
+	}
+	if ts.calls != 1 {
+		t.Fatalf("expected trace edges to be cached within the interval, got %d fetches", ts.calls)
+	}
+	h, ok := ctrl.PathHistory("a-b")
+	if !ok || h.Samples[0].PredictedLatencyMs == nil || *h.Samples[0].PredictedLatencyMs != 4 {
+		t.Fatalf("expected predicted latency 4ms from traces, got %+v", h)
+	}
+	if d := ctrl.Drift(); len(d.Undeclared) != 1 || d.Undeclared[0].To != "x" {
+		t.Fatalf("expected trace edge a -> x reported as undeclared, got %+v", d)
+	}
+}
+
+func TestEdgeFamilies_FillGRPCAndTCPEdges(t *testing.T) {
+	cfg := &config.Config{
+		NamespaceSelector: []string{"test-ns"},
+		Graph: config.ServiceGraphConfig{
+			Entry:    "a",
+			Services: []config.ServiceNode{{Name: "a", DependsOn: []string{"b", "c"}}, {Name: "b"}, {Name: "c"}},
+		},
+		Prometheus: config.PrometheusConfig{EdgeFamilies: []config.EdgeFamilyConfig{
+			{Family: "grpc", RPSQuery: "grpc_rps", LatencyQuery: "grpc_latency", DstLabel: "app"},
+			{Family: "tcp", RPSQuery: "tcp_conns", SrcLabel: "source_workload", DstLabel: "destination_workload"},
+		}},
+		Scoring:  config.ScoringWeights{PathLengthWeight: 1, PodCountWeight: 1, ServiceEdgesWeight: 1},
+		Affinity: config.AffinityConfig{TopPaths: 1},
+	}
+	prom := &fakeProm{
+		values: map[string]map[string]float64{"grpc_rps": {"b": 30}, "grpc_latency": {"b": 0.02}},
+		rps:    map[promc.ServicePair]float64{{Src: "a", Dst: "c"}: 5},
+	}
+	ctrl := controller.New(cfg, &fakeKube{}, prom)
+	ctrl.EnableDryRunForTest()
+	if err := ctrl.ReconcileOnceForTest(context.Background()); err != nil {
+		t.Fatalf("reconcile error: %v", err)
+	}
+
+	if d := ctrl.Drift(); len(d.Unobserved) != 0 {
+		t.Fatalf("gRPC and TCP edges should count as observed, unobserved: %+v", d.Unobserved)
+	}
+	h, ok := ctrl.PathHistory("a-b")
+	if !ok || len(h.Samples) != 1 || h.Samples[0].PredictedLatencyMs == nil || *h.Samples[0].PredictedLatencyMs != 20 {
+		t.Fatalf("a-b latency should come from grpc_server_handling_seconds: %+v", h)
+	}
+}
+
+func TestEdgeFamilies_OnlyMeasureCalleesOfTheirProtocol(t *testing.T) {
+	cfg := &config.Config{
+		NamespaceSelector: []string{"test-ns"},
+		Graph: config.ServiceGraphConfig{
+			Entry: "a",
+			Services: []config.ServiceNode{
+				{Name: "a", DependsOn: []string{"b", "c"}},
+				{Name: "b"},
+				{Name: "c", Ports: []graph.Port{{Name: "api", Port: 9090, AppProtocol: "grpc"}}},
+			},
+		},
+		Prometheus: config.PrometheusConfig{EdgeFamilies: []config.EdgeFamilyConfig{
+			{Family: "grpc", LatencyQuery: "grpc_latency", DstLabel: "app"},
+		}},
+		Scoring:  config.ScoringWeights{PathLengthWeight: 1, PodCountWeight: 1, ServiceEdgesWeight: 1},
+		Affinity: config.AffinityConfig{TopPaths: 2},
+	}
+	var deploys []appsv1.Deployment
+	for _, name := range []string{"a", "b", "c"} {
+		deploys = append(deploys, appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "test-ns"},
+			Spec: appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"io.kompose.service": name}},
+			}},
+		})
+	}
+	// b serves HTTP: its Service names the port "http" and targets 8080.
+	fk := &fakeKube{deploys: deploys, services: []corev1.Service{{
+		ObjectMeta: metav1.ObjectMeta{Name: "b", Namespace: "test-ns"},
+		Spec: corev1.ServiceSpec{
+			Selector: map[string]string{"io.kompose.service": "b"},
+			Ports:    []corev1.ServicePort{{Name: "http", Port: 80, TargetPort: intstr.FromInt32(8080), Protocol: corev1.ProtocolTCP}},
+		},
+	}}}
+	prom := &fakeProm{values: map[string]map[string]float64{"grpc_latency": {"b": 0.02, "c": 0.03}}}
+	ctrl := controller.New(cfg, fk, prom)
+	ctrl.EnableDryRunForTest()
+	if err := ctrl.ReconcileOnceForTest(context.Background()); err != nil {
+		t.Fatalf("reconcile error: %v", err)
+	}
+
+	if h, ok := ctrl.PathHistory("a-c"); !ok || h.Samples[0].PredictedLatencyMs == nil || *h.Samples[0].PredictedLatencyMs != 30 {
+		t.Fatalf("a-c is gRPC and should be measured by the grpc family: %+v", h)
+	}
+	if h, ok := ctrl.PathHistory("a-b"); ok && h.Samples[0].PredictedLatencyMs != nil {
+		t.Fatalf("a-b is HTTP and must not take gRPC latencies: %v", *h.Samples[0].PredictedLatencyMs)
+	}
+
+	var b *graph.DocumentService
+	doc := ctrl.GraphDocument(context.Background())
+	for i := range doc.Services {
+		if doc.Services[i].Name == "b" {
+			b = &doc.Services[i]
+		}
+	}
+	want := []graph.Port{{Name: "http", Port: 80, TargetPort: 8080, Protocol: "TCP", AppProtocol: "http"}}
+	if b == nil || !reflect.DeepEqual(b.Ports, want) {
+		t.Fatalf("b's ports should be discovered from its Service, got %+v", b)
+	}
+}
@@ -0,0 +1,80 @@
+package tests
+
+import (
+	"context"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"lead-net-affinity/pkg/config"
+	"lead-net-affinity/pkg/controller"
+	"lead-net-affinity/pkg/kube"
+)
+
+func TestNodeDraining(t *testing.T) {
+	cases := map[string]struct {
+		node corev1.Node
+		want bool
+	}{
+		"ready":    {corev1.Node{}, false},
+		"cordoned": {corev1.Node{Spec: corev1.NodeSpec{Unschedulable: true}}, true},
+		"autoscaler": {corev1.Node{Spec: corev1.NodeSpec{Taints: []corev1.Taint{
+			{Key: "ToBeDeletedByClusterAutoscaler", Effect: corev1.TaintEffectNoSchedule},
+		}}}, true},
+		"soft taint": {corev1.Node{Spec: corev1.NodeSpec{Taints: []corev1.Taint{
+			{Key: "karpenter.sh/disrupted", Effect: corev1.TaintEffectPreferNoSchedule},
+		}}}, false},
+	}
+	for name, tc := range cases {
+		if got := kube.NodeDraining(&tc.node); got != tc.want {
+			t.Errorf("%s: NodeDraining = %v, want %v", name, got, tc.want)
+		}
+	}
+}
+
+func TestController_DropsPreferencesForDrainingNodes(t *testing.T) {
+	cfg := &config.Config{
+		NamespaceSelector: []string{"test-ns"},
+		Graph: config.ServiceGraphConfig{
+			Entry:    "a",
+			Services: []config.ServiceNode{{Name: "a", DependsOn: []string{"b"}}, {Name: "b"}},
+		},
+	}
+	deploy := func(name string, preferred ...string) appsv1.Deployment {
+		d := appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{
+			Name: name, Namespace: "test-ns", Labels: map[string]string{"io.kompose.service": name},
+		}}
+		d.Spec.Template.Labels = map[string]string{"io.kompose.service": name}
+		d.Spec.Template.Spec.Affinity = &corev1.Affinity{NodeAffinity: &corev1.NodeAffinity{
+			PreferredDuringSchedulingIgnoredDuringExecution: []corev1.PreferredSchedulingTerm{{
+				Weight: 50,
+				Preference: corev1.NodeSelectorTerm{MatchExpressions: []corev1.NodeSelectorRequirement{{
+					Key: "kubernetes.io/hostname", Operator: corev1.NodeSelectorOpIn, Values: preferred,
+				}}},
+			}},
+		}}
+		return d
+	}
+	k8s := &fakeKube{
+		deploys: []appsv1.Deployment{deploy("a", "n1"), deploy("b", "n1", "n2")},
+		nodes: []corev1.Node{
+			{ObjectMeta: metav1.ObjectMeta{Name: "n1"}, Spec: corev1.NodeSpec{Unschedulable: true}},
+			{ObjectMeta: metav1.ObjectMeta{Name: "n2"}},
+		},
+	}
+	ctrl := controller.New(cfg, k8s, &fakeProm{})
+	ctrl.EnableDryRunForTest()
+	if err := ctrl.ReconcileOnceForTest(context.Background()); err != nil {
+		t.Fatalf("reconcile error: %v", err)
+	}
+
+	if terms := k8s.deploys[0].Spec.Template.Spec.Affinity.NodeAffinity.PreferredDuringSchedulingIgnoredDuringExecution; len(terms) != 0 {
+		t.Fatalf("expected the preference for cordoned n1 to be dropped, got %+v", terms)
+	}
+	terms := k8s.deploys[1].Spec.Template.Spec.Affinity.NodeAffinity.PreferredDuringSchedulingIgnoredDuringExecution
+	if len(terms) != 1 || len(terms[0].Preference.MatchExpressions[0].Values) != 1 || terms[0].Preference.MatchExpressions[0].Values[0] != "n2" {
+		t.Fatalf("expected only n2 to remain preferred, got %+v", terms)
+	}
+}
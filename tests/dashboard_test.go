@@ -0,0 +1,89 @@
+package tests
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+
+	"lead-net-affinity/pkg/dashboard"
+)
+
+func TestDashboard_FilesAreGenerated(t *testing.T) {
+	want, err := dashboard.JSON()
+	if err != nil {
+		t.Fatalf("render dashboard: %v", err)
+	}
+	b, err := os.ReadFile(filepath.Join(chartDir, "files", "grafana-dashboard.json"))
+	if err != nil {
+		t.Fatalf("read chart dashboard: %v", err)
+	}
+	if string(b) != string(want) {
+		t.Fatalf("files/grafana-dashboard.json is stale; regenerate with \"lead-net-affinity dashboard\"")
+	}
+
+	want, err = dashboard.ConfigMap("lead-net-affinity-dashboard", "monitoring")
+	if err != nil {
+		t.Fatalf("render dashboard ConfigMap: %v", err)
+	}
+	b, err = os.ReadFile("../deploy/grafana-dashboard.yaml")
+	if err != nil {
+		t.Fatalf("read dashboard ConfigMap: %v", err)
+	}
+	_, got, _ := strings.Cut(string(b), "\n") // drop the "Generated by" header
+	if got != string(want) {
+		t.Fatalf("deploy/grafana-dashboard.yaml is stale; regenerate with \"lead-net-affinity dashboard --configmap\"")
+	}
+}
+
+// Every metric the controller exports is charted, and the dashboard only
+// queries metrics that exist.
+func TestDashboard_MatchesExportedMetrics(t *testing.T) {
+	name := regexp.MustCompile(`"(lead_net_[a-z_]+)"`)
+	seen := make(map[string]bool)
+	for _, dir := range []string{"../pkg", "../cmd"} {
+		err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() && d.Name() == "dashboard" {
+				return filepath.SkipDir
+			}
+			if d.IsDir() || !strings.HasSuffix(path, ".go") || strings.HasSuffix(path, "_test.go") {
+				return nil
+			}
+			b, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			for _, m := range name.FindAllStringSubmatch(string(b), -1) {
+				seen[m[1]] = true
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("scan %s: %v", dir, err)
+		}
+	}
+	var exported []string
+	for m := range seen {
+		exported = append(exported, m)
+	}
+	sort.Strings(exported)
+
+	charted := dashboard.Metrics()
+	for _, m := range exported {
+		if !slices.Contains(charted, m) {
+			t.Errorf("metric %s is exported but not on the dashboard (pkg/dashboard)", m)
+		}
+	}
+	for _, m := range charted {
+		if !seen[m] {
+			t.Errorf("dashboard queries %s, which the controller does not export", m)
+		}
+	}
+}
@@ -0,0 +1,251 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"lead-net-affinity/pkg/config"
+	"lead-net-affinity/pkg/controller"
+	"lead-net-affinity/pkg/graph"
+	"lead-net-affinity/pkg/metrics"
+)
+
+func TestController_RecordsDecisions(t *testing.T) {
+	cfg := &config.Config{
+		NamespaceSelector: []string{"test-ns"},
+		Graph: config.ServiceGraphConfig{
+			Entry:    "a",
+			Services: []config.ServiceNode{{Name: "a", DependsOn: []string{"b"}}, {Name: "b"}},
+		},
+		Scoring:  config.ScoringWeights{PathLengthWeight: 1, PodCountWeight: 1, ServiceEdgesWeight: 1},
+		Affinity: config.AffinityConfig{TopPaths: 1, MinAffinityWeight: 50, MaxAffinityWeight: 100},
+	}
+	deploy := func(name string) appsv1.Deployment {
+		lbls := map[string]string{"io.kompose.service": name}
+		return appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "test-ns", Labels: lbls},
+			Spec: appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{ObjectMeta: metav1.ObjectMeta{Labels: lbls}}}}
+	}
+	fk := &fakeKube{deploys: []appsv1.Deployment{deploy("a"), deploy("b")}}
+	ctrl := controller.New(cfg, fk, &fakeProm{})
+	if err := ctrl.ReconcileOnceForTest(context.Background()); err != nil {
+		t.Fatalf("reconcile error: %v", err)
+	}
+
+	d := ctrl.Decisions()
+	if len(d.Paths) != 1 || d.Paths[0].ID != "a-b" || d.Paths[0].Rank != 1 {
+		t.Fatalf("unexpected ranking: %+v", d.Paths)
+	}
+	if len(d.Affinity) != 1 || d.Affinity[0].Service != "b" || d.Affinity[0].Peers[0].Service != "a" {
+		t.Fatalf("expected affinity of b toward a, got %+v", d.Affinity)
+	}
+	if d.Graph == nil || len(d.Graph.Services) != 2 {
+		t.Fatalf("expected the graph in the snapshot, got %+v", d.Graph)
+	}
+}
+
+func TestController_DecisionIDs(t *testing.T) {
+	cfg, fk := approvalFixture(config.ApprovalConfig{})
+	ctrl := controller.New(cfg, fk, &fakeProm{})
+	reconcile := func() string {
+		t.Helper()
+		if err := ctrl.ReconcileOnceForTest(context.Background()); err != nil {
+			t.Fatalf("reconcile error: %v", err)
+		}
+		return ctrl.Decisions().ID
+	}
+
+	id := reconcile()
+	if len(id) != 12 {
+		t.Fatalf("expected a 12 character decision ID, got %q", id)
+	}
+	for _, d := range fk.deploys {
+		want := id
+		if d.Name == "a" {
+			want = "" // the entry gets no affinity and so no stamp
+		}
+		if got := d.Spec.Template.Annotations[controller.DecisionAnnotation]; got != want {
+			t.Fatalf("expected %s stamped with %q, got %q", d.Name, want, got)
+		}
+	}
+	if v := metrics.Default.Value("lead_net_decision_info", map[string]string{"decision_id": id}); v != 1 {
+		t.Fatalf("expected lead_net_decision_info for %s, got %v", id, v)
+	}
+
+	// The same inputs decide the same thing again.
+	if again := reconcile(); again != id {
+		t.Fatalf("expected a stable decision ID, got %s then %s", id, again)
+	}
+	h, ok := ctrl.PathHistory("a-b-c")
+	if !ok || len(h.Samples) != 2 || h.Samples[0].DecisionID != "" || h.Samples[1].DecisionID != id {
+		t.Fatalf("expected the second sample measured under %s, got %+v", id, h.Samples)
+	}
+
+	// Other rules are another decision.
+	cfg.Affinity.MaxAffinityWeight = 80
+	if changed := reconcile(); changed == id {
+		t.Fatalf("expected a new decision ID after the weights changed")
+	} else if got := fk.deploys[2].Spec.Template.Annotations[controller.DecisionAnnotation]; got != changed {
+		t.Fatalf("expected c restamped with %s, got %s", changed, got)
+	}
+	if v := metrics.Default.Value("lead_net_decision_info", map[string]string{"decision_id": id}); v != 0 {
+		t.Fatalf("expected the old decision's series removed, got %v", v)
+	}
+}
+
+func TestController_DecisionsCarryServiceOwnership(t *testing.T) {
+	cfg := &config.Config{
+		NamespaceSelector: []string{"test-ns"},
+		Graph: config.ServiceGraphConfig{
+			Entry: "a",
+			Services: []config.ServiceNode{
+				{Name: "a", DependsOn: []string{"b"}, Owner: "team-edge", Metadata: map[string]string{"tier": "gold"}},
+				{Name: "b", Version: "2.0.0"},
+			},
+		},
+		Scoring:  config.ScoringWeights{PathLengthWeight: 1, PodCountWeight: 1, ServiceEdgesWeight: 1},
+		Affinity: config.AffinityConfig{TopPaths: 1, MinAffinityWeight: 50, MaxAffinityWeight: 100},
+	}
+	deploy := func(name string) appsv1.Deployment {
+		lbls := map[string]string{"io.kompose.service": name, "app.kubernetes.io/version": "1.0.0"}
+		return appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "test-ns", Labels: lbls,
+				Annotations: map[string]string{"lead.io/owner": "team-" + name}},
+			Spec: appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{ObjectMeta: metav1.ObjectMeta{Labels: lbls}}},
+		}
+	}
+	fk := &fakeKube{deploys: []appsv1.Deployment{deploy("a"), deploy("b")}}
+	ctrl := controller.New(cfg, fk, &fakeProm{})
+	if err := ctrl.ReconcileOnceForTest(context.Background()); err != nil {
+		t.Fatalf("reconcile error: %v", err)
+	}
+
+	d := ctrl.Decisions()
+	// The config wins; the Deployment fills in the rest.
+	want := map[string]graph.DocumentService{
+		"a": {Version: "1.0.0", Owner: "team-edge", Metadata: map[string]string{"tier": "gold"}},
+		"b": {Version: "2.0.0", Owner: "team-b"},
+	}
+	for _, s := range d.Graph.Services {
+		w := want[s.Name]
+		if s.Version != w.Version || s.Owner != w.Owner || !reflect.DeepEqual(s.Metadata, w.Metadata) {
+			t.Fatalf("service %s: version=%q owner=%q metadata=%v, want %+v", s.Name, s.Version, s.Owner, s.Metadata, w)
+		}
+	}
+	if len(d.Affinity) != 1 || d.Affinity[0].Owner != "team-b" || d.Affinity[0].Version != "2.0.0" {
+		t.Fatalf("expected b's affinity attributed to team-b, got %+v", d.Affinity)
+	}
+
+	rec := httptest.NewRecorder()
+	ctrl.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/decisions?owner=team-edge", nil))
+	var got controller.Decisions
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(got.Affinity) != 0 || len(got.Paths) != 1 || len(got.Graph.Services) != 1 || got.Graph.Services[0].Name != "a" {
+		t.Fatalf("unexpected decisions for team-edge: %+v", got)
+	}
+
+	// Ownership survives the GraphML round trip.
+	b, err := d.Graph.Marshal(graph.FormatGraphML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := graph.ParseDocument(b, graph.FormatGraphML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range doc.Services {
+		if w := want[s.Name]; s.Owner != w.Owner || s.Version != w.Version || !reflect.DeepEqual(s.Metadata, w.Metadata) {
+			t.Fatalf("GraphML round trip lost metadata of %s: %+v", s.Name, s)
+		}
+	}
+}
+
+func TestDiffDecisions(t *testing.T) {
+	before := controller.Decisions{
+		Graph: &graph.Document{Entry: "fe", Services: []graph.DocumentService{
+			{Name: "fe", DependsOn: []string{"cart", "search"}}, {Name: "cart"}, {Name: "search"},
+		}},
+		Paths: []controller.RankedPath{{ID: "fe-cart", Rank: 1, FinalScore: 90}, {ID: "fe-search", Rank: 2, FinalScore: 40}},
+		Affinity: []controller.ServiceAffinity{
+			{Service: "cart", Peers: []controller.AffinityPeer{{Service: "fe", TopologyKey: "kubernetes.io/hostname", Weight: 100}}},
+		},
+	}
+	after := controller.Decisions{
+		Graph: &graph.Document{Entry: "fe", Services: []graph.DocumentService{
+			{Name: "fe", DependsOn: []string{"search", "recs"}}, {Name: "search"}, {Name: "recs"},
+		}},
+		Paths: []controller.RankedPath{{ID: "fe-search", Rank: 1, FinalScore: 100}, {ID: "fe-recs", Rank: 2, FinalScore: 20}},
+		Affinity: []controller.ServiceAffinity{
+			{Service: "search", Peers: []controller.AffinityPeer{{Service: "fe", TopologyKey: "kubernetes.io/hostname", Weight: 80}}},
+		},
+	}
+
+	d := controller.DiffDecisions(before, after)
+	wantGraph := graph.DocumentDiff{
+		AddedServices:   []string{"recs"},
+		RemovedServices: []string{"cart"},
+		AddedEdges:      []graph.Edge{{From: "fe", To: "recs"}},
+		RemovedEdges:    []graph.Edge{{From: "fe", To: "cart"}},
+	}
+	if d.Graph == nil || !reflect.DeepEqual(*d.Graph, wantGraph) {
+		t.Fatalf("graph diff = %+v, want %+v", d.Graph, wantGraph)
+	}
+	wantPaths := []controller.PathChange{
+		{ID: "fe-cart", RankBefore: 1, ScoreBefore: 90},
+		{ID: "fe-search", RankBefore: 2, RankAfter: 1, ScoreBefore: 40, ScoreAfter: 100},
+		{ID: "fe-recs", RankAfter: 2, ScoreAfter: 20},
+	}
+	if !reflect.DeepEqual(d.Paths, wantPaths) {
+		t.Fatalf("path changes = %+v, want %+v", d.Paths, wantPaths)
+	}
+	if len(d.Affinity) != 2 || d.Affinity[0].Service != "cart" || d.Affinity[0].WeightAfter != 0 ||
+		d.Affinity[1].Service != "search" || d.Affinity[1].WeightAfter != 80 {
+		t.Fatalf("unexpected affinity changes: %+v", d.Affinity)
+	}
+
+	var text bytes.Buffer
+	d.WriteText(&text)
+	for _, want := range []string{"+ edge fe -> recs", "~ fe-search rank 2 -> 1", "search -> fe (kubernetes.io/hostname) weight 0 -> 80 (+80)"} {
+		if !strings.Contains(text.String(), want) {
+			t.Fatalf("text output missing %q:\n%s", want, text.String())
+		}
+	}
+	if !controller.DiffDecisions(after, after).Empty() {
+		t.Fatalf("a snapshot should not differ from itself")
+	}
+}
+
+func TestHTTP_DiffGraphDocuments(t *testing.T) {
+	ctrl := controller.New(&config.Config{}, &fakeKube{}, &fakeProm{})
+	body := `{"before": {"entry": "a", "services": [{"name": "a"}]},
+	          "after":  {"entry": "a", "services": [{"name": "a", "dependsOn": ["b"]}, {"name": "b"}]}}`
+	rec := httptest.NewRecorder()
+	ctrl.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/diff", strings.NewReader(body)))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"addedEdges":[{"from":"a","to":"b"}]`) {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	ctrl.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/diff", strings.NewReader(`{"before": {"entry": "x"}}`)))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an invalid graph, got %d", rec.Code)
+	}
+
+	huge := `{"before": {"entry": "a", "services": [{"name": "` + strings.Repeat("a", 9<<20) + `"}]}}`
+	rec = httptest.NewRecorder()
+	ctrl.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/diff", strings.NewReader(huge)))
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected 413 for an oversized body, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,78 @@
+package tests
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"lead-net-affinity/pkg/config"
+	"lead-net-affinity/pkg/controller"
+)
+
+func degradationController(nodePolicy string) *controller.Controller {
+	cfg := &config.Config{
+		NamespaceSelector: []string{"test-ns"},
+		Graph: config.ServiceGraphConfig{
+			Entry:    "a",
+			Services: []config.ServiceNode{{Name: "a", DependsOn: []string{"b", "c"}}, {Name: "b"}, {Name: "c"}},
+		},
+		Prometheus:  config.PrometheusConfig{NodeRTTQuery: "rtt"},
+		Degradation: config.DegradationConfig{NodeMetrics: nodePolicy},
+	}
+	// Only b is placed; the fake matrix has no metrics for its node.
+	k8s := &fakeKube{pods: []corev1.Pod{{
+		ObjectMeta: metav1.ObjectMeta{Name: "b-0", Namespace: "test-ns", Labels: map[string]string{"io.kompose.service": "b"}},
+		Spec:       corev1.PodSpec{NodeName: "n1"},
+	}}}
+	ctrl := controller.New(cfg, k8s, &fakeProm{})
+	ctrl.EnableDryRunForTest()
+	return ctrl
+}
+
+func TestDegradation_UseDefaultFlagsStatus(t *testing.T) {
+	ctrl := degradationController("")
+	if err := ctrl.ReconcileOnceForTest(context.Background()); err != nil {
+		t.Fatalf("reconcile error: %v", err)
+	}
+	st := ctrl.Status()
+	if st.PathsEvaluated != 2 || len(st.Degraded) != 1 || len(st.Errors) != 0 {
+		t.Fatalf("expected 2 paths scored with a flagged default, got %+v", st)
+	}
+}
+
+func TestDegradation_SkipServiceDropsPaths(t *testing.T) {
+	ctrl := degradationController(config.DegradeSkipService)
+	if err := ctrl.ReconcileOnceForTest(context.Background()); err != nil {
+		t.Fatalf("reconcile error: %v", err)
+	}
+	if st := ctrl.Status(); st.PathsEvaluated != 1 {
+		t.Fatalf("expected path a-b to be skipped, got %+v", st)
+	}
+	if _, ok := ctrl.PathHistory("a-b"); ok {
+		t.Fatal("skipped path a-b should not be recorded")
+	}
+}
+
+func TestDegradation_FailAbortsReconcile(t *testing.T) {
+	ctrl := degradationController(config.DegradeFail)
+	if err := ctrl.ReconcileOnceForTest(context.Background()); err == nil {
+		t.Fatal("expected reconcile to fail")
+	}
+	if st := ctrl.Status(); len(st.Errors) == 0 {
+		t.Fatalf("expected an error in status, got %+v", st)
+	}
+}
+
+func TestConfigLoad_RejectsUnknownDegradationPolicy(t *testing.T) {
+	fp := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(fp, []byte("degradation:\n  nodeMetrics: ignore\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := config.Load(fp); err == nil {
+		t.Fatal("expected unknown policy to be rejected")
+	}
+}
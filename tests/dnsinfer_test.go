@@ -0,0 +1,129 @@
+package tests
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"lead-net-affinity/pkg/config"
+	"lead-net-affinity/pkg/controller"
+	"lead-net-affinity/pkg/dnsinfer"
+	"lead-net-affinity/pkg/graph"
+	promc "lead-net-affinity/pkg/prometheus"
+)
+
+func TestParseCoreDNSLog(t *testing.T) {
+	line := `[INFO] 10.244.1.7:51234 - 4242 "A IN search.default.svc.cluster.local. udp 50 false 512" NOERROR qr,aa,rd 106 0.000123s`
+	q, ok := dnsinfer.ParseCoreDNSLog(line)
+	if !ok || q.ClientIP != "10.244.1.7" || q.Name != "search.default.svc.cluster.local." {
+		t.Fatalf("unexpected parse: %+v ok=%v", q, ok)
+	}
+	v6 := `[INFO] [fd00::7]:5353 - 1 "AAAA IN user.shop.svc.cluster.local. udp 40 false 512" NOERROR qr 90 0.0001s`
+	if q, ok := dnsinfer.ParseCoreDNSLog(v6); !ok || q.ClientIP != "fd00::7" {
+		t.Fatalf("unexpected IPv6 parse: %+v ok=%v", q, ok)
+	}
+	if _, ok := dnsinfer.ParseCoreDNSLog("[INFO] plugin/reload: Running configuration"); ok {
+		t.Fatal("expected non-query line to be rejected")
+	}
+}
+
+func TestServiceFromName(t *testing.T) {
+	if svc, ns, ok := dnsinfer.ServiceFromName("Search.default.svc.cluster.local.", ""); !ok || svc != "search" || ns != "default" {
+		t.Fatalf("got %q %q %v", svc, ns, ok)
+	}
+	for _, n := range []string{"api.example.com.default.svc.cluster.local.", "example.com.", "default.svc.cluster.local"} {
+		if _, _, ok := dnsinfer.ServiceFromName(n, "cluster.local"); ok {
+			t.Fatalf("expected %q to be rejected", n)
+		}
+	}
+}
+
+func TestInfer(t *testing.T) {
+	pods := map[string]string{"10.0.0.1": "frontend", "10.0.0.2": "search"}
+	queries := []dnsinfer.Query{
+		{ClientIP: "10.0.0.1", Name: "search.ns.svc.cluster.local."},
+		{ClientIP: "10.0.0.1", Name: "search.ns.svc.cluster.local."},
+		{ClientIP: "10.0.0.2", Name: "geo.ns.svc.cluster.local."},
+		{ClientIP: "10.0.0.2", Name: "search.ns.svc.cluster.local."}, // self
+		{ClientIP: "10.9.9.9", Name: "geo.ns.svc.cluster.local."},    // unknown client
+	}
+	got := dnsinfer.Infer(queries, pods, "")
+	want := []dnsinfer.Edge{
+		{Pair: promc.ServicePair{Src: "frontend", Dst: "search"}, Queries: 2},
+		{Pair: promc.ServicePair{Src: "search", Dst: "geo"}, Queries: 1},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v want %+v", got, want)
+	}
+}
+
+func TestGraph_AddInferredEdge(t *testing.T) {
+	g := graph.NewGraph("a", []struct {
+		Name          string
+		DependsOn     []string
+		LabelSelector map[string]string
+	}{
+		{Name: "a", DependsOn: []string{"b"}},
+		{Name: "b"},
+		{Name: "c"},
+	})
+	if !g.AddInferredEdge("b", "c") || !g.IsInferred("b", "c") {
+		t.Fatal("expected b -> c to be added as inferred")
+	}
+	if g.AddInferredEdge("c", "a") {
+		t.Fatal("expected c -> a to be rejected as a cycle")
+	}
+	if g.AddInferredEdge("b", "a") || g.AddInferredEdge("a", "missing") {
+		t.Fatal("expected reverse and unknown edges to be rejected")
+	}
+	if got := toStringPaths(g.FindAllPaths()); !reflect.DeepEqual(got, [][]string{{"a", "b", "c"}}) {
+		t.Fatalf("unexpected paths %v", got)
+	}
+}
+
+type fakeDNSLogs struct{ lines []string }
+
+func (f *fakeDNSLogs) PodLogs(_ context.Context, _, _ string, _ time.Duration) ([]string, error) {
+	return f.lines, nil
+}
+
+func TestController_DNSInferredEdgesExtendPaths(t *testing.T) {
+	cfg := &config.Config{
+		NamespaceSelector: []string{"test-ns"},
+		Graph: config.ServiceGraphConfig{
+			Entry:    "a",
+			Services: []config.ServiceNode{{Name: "a", DependsOn: []string{"b"}}, {Name: "b"}, {Name: "c"}},
+		},
+		DNSInference: config.DNSInferenceConfig{Enabled: true, MinQueries: 2},
+	}
+	pod := func(name, ip string) corev1.Pod {
+		return corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "test-ns", Labels: map[string]string{"io.kompose.service": name}},
+			Status:     corev1.PodStatus{PodIP: ip},
+		}
+	}
+	k8s := &fakeKube{pods: []corev1.Pod{pod("a", "10.0.0.1"), pod("b", "10.0.0.2")}}
+	q := func(ip, svc string) string {
+		return `[INFO] ` + ip + `:40000 - 1 "A IN ` + svc + `.test-ns.svc.cluster.local. udp 50 false 512" NOERROR qr 90 0.0001s`
+	}
+	ctrl := controller.New(cfg, k8s, &fakeProm{})
+	ctrl.EnableDryRunForTest()
+	ctrl.SetDNSLogSource(&fakeDNSLogs{lines: []string{
+		q("10.0.0.2", "c"), q("10.0.0.2", "c"), // b -> c, above minQueries
+		q("10.0.0.1", "c"), // a -> c, below minQueries
+	}})
+
+	if err := ctrl.ReconcileOnceForTest(context.Background()); err != nil {
+		t.Fatalf("reconcile error: %v", err)
+	}
+	if _, ok := ctrl.PathHistory("a-b-c"); !ok {
+		t.Fatal("expected the DNS-inferred edge b -> c to extend path a-b")
+	}
+	if _, ok := ctrl.PathHistory("a-c"); ok {
+		t.Fatal("expected a -> c (below minQueries) not to be inferred")
+	}
+}
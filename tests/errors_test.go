@@ -0,0 +1,57 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"lead-net-affinity/pkg/config"
+	"lead-net-affinity/pkg/controller"
+	promc "lead-net-affinity/pkg/prometheus"
+)
+
+func TestPrometheusClient_UnavailableIsRetried(t *testing.T) {
+	var calls, status atomic.Int32
+	status.Store(http.StatusServiceUnavailable)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(int(status.Load()))
+	}))
+	defer srv.Close()
+	client, err := promc.NewClient(srv.URL)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+
+	_, err = client.Query(context.Background(), "up")
+	if !errors.Is(err, controller.ErrPrometheusUnavailable) || calls.Load() != 3 {
+		t.Fatalf("expected ErrPrometheusUnavailable after 3 attempts, got %v after %d", err, calls.Load())
+	}
+
+	calls.Store(0)
+	status.Store(http.StatusBadRequest)
+	_, err = client.Query(context.Background(), "up{")
+	if err == nil || errors.Is(err, promc.ErrUnavailable) || calls.Load() != 1 {
+		t.Fatalf("expected a rejected query to fail once without retries, got %v after %d", err, calls.Load())
+	}
+}
+
+func TestController_TypedReconcileErrors(t *testing.T) {
+	empty := controller.New(&config.Config{Graph: config.ServiceGraphConfig{Entry: "a"}}, &fakeKube{}, &fakeProm{})
+	if err := empty.ReconcileOnceForTest(context.Background()); !errors.Is(err, controller.ErrGraphEmpty) {
+		t.Fatalf("expected ErrGraphEmpty, got %v", err)
+	}
+
+	cfg := &config.Config{
+		NamespaceSelector: []string{"test-ns"},
+		Graph:             config.ServiceGraphConfig{Entry: "a", Services: []config.ServiceNode{{Name: "a"}, {Name: "lonely"}}},
+	}
+	ctrl := controller.New(cfg, &fakeKube{}, &fakeProm{})
+	err := ctrl.ReconcileScoped(context.Background(), controller.Scope{Services: []string{"lonely"}})
+	if !errors.Is(err, controller.ErrNoPaths) {
+		t.Fatalf("expected ErrNoPaths for a scope on no path, got %v", err)
+	}
+}
@@ -0,0 +1,98 @@
+package tests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"lead-net-affinity/pkg/config"
+	"lead-net-affinity/pkg/controller"
+	"lead-net-affinity/pkg/kube"
+)
+
+// deleteRecorder records the names of deleted pods.
+type deleteRecorder struct {
+	*fakeKube
+	deletedPods []string
+}
+
+func (d *deleteRecorder) DeletePod(ctx context.Context, namespace, name string) error {
+	d.deletedPods = append(d.deletedPods, name)
+	return d.fakeKube.DeletePod(ctx, namespace, name)
+}
+
+func TestController_EvictsCheapestPodsAndRespectsSafeToEvict(t *testing.T) {
+	t.Setenv("LEAD_NET_DRY_DELETE", "false")
+	cfg := &config.Config{
+		NamespaceSelector: []string{"test-ns"},
+		Graph:             config.ServiceGraphConfig{Entry: "a", Services: []config.ServiceNode{{Name: "a"}}},
+		Rebalancing:       config.RebalancingConfig{MaxDeletionsPerPass: 2, DeletionsPerSecond: 100},
+	}
+	old := metav1.NewTime(time.Now().Add(-time.Hour))
+	pod := func(name string, annotations map[string]string) corev1.Pod {
+		return corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: name, Namespace: "test-ns", CreationTimestamp: old, Annotations: annotations,
+				Labels: map[string]string{"io.kompose.service": "a"},
+			},
+			Spec: corev1.PodSpec{NodeName: "bad"},
+		}
+	}
+	rec := &deleteRecorder{fakeKube: &fakeKube{pods: []corev1.Pod{
+		pod("a-pinned", map[string]string{kube.SafeToEvictAnnotation: "false", kube.PodDeletionCostAnnotation: "-100"}),
+		pod("a-expensive", map[string]string{kube.PodDeletionCostAnnotation: "1000"}),
+		pod("a-default", nil),
+		pod("a-cheap", map[string]string{kube.PodDeletionCostAnnotation: "-10"}),
+	}}}
+	deploys := []appsv1.Deployment{{ObjectMeta: metav1.ObjectMeta{
+		Name: "a", Namespace: "test-ns", Labels: map[string]string{"io.kompose.service": "a"},
+	}}}
+
+	ctrl := controller.New(cfg, rec, &fakeProm{})
+	if err := ctrl.RebalancePods(context.Background(), deploys, []string{"bad"}); err != nil {
+		t.Fatalf("rebalance error: %v", err)
+	}
+	if len(rec.deletedPods) != 2 || rec.deletedPods[0] != "a-cheap" || rec.deletedPods[1] != "a-default" {
+		t.Fatalf("expected the two cheapest evictable pods deleted, got %v", rec.deletedPods)
+	}
+}
+
+func TestController_SparesPodsYoungerThanMinPodAge(t *testing.T) {
+	t.Setenv("LEAD_NET_DRY_DELETE", "false")
+	cfg := &config.Config{
+		NamespaceSelector: []string{"test-ns"},
+		Graph:             config.ServiceGraphConfig{Entry: "a", Services: []config.ServiceNode{{Name: "a"}}},
+		Rebalancing:       config.RebalancingConfig{DeletionsPerSecond: 100, MinPodAgeSeconds: 600},
+	}
+	pod := func(name string, age time.Duration) corev1.Pod {
+		return corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: name, Namespace: "test-ns", CreationTimestamp: metav1.NewTime(time.Now().Add(-age)),
+				Labels: map[string]string{"io.kompose.service": "a"},
+			},
+			Spec: corev1.PodSpec{NodeName: "bad"},
+		}
+	}
+	rec := &deleteRecorder{fakeKube: &fakeKube{pods: []corev1.Pod{
+		pod("a-young", 5*time.Minute),
+		pod("a-old", time.Hour),
+	}}}
+	deploys := []appsv1.Deployment{{ObjectMeta: metav1.ObjectMeta{
+		Name: "a", Namespace: "test-ns", Labels: map[string]string{"io.kompose.service": "a"},
+	}}}
+
+	ctrl := controller.New(cfg, rec, &fakeProm{})
+	if err := ctrl.RebalancePods(context.Background(), deploys, []string{"bad"}); err != nil {
+		t.Fatalf("rebalance error: %v", err)
+	}
+	if len(rec.deletedPods) != 1 || rec.deletedPods[0] != "a-old" {
+		t.Fatalf("expected only the pod older than minPodAgeSeconds deleted, got %v", rec.deletedPods)
+	}
+	if (config.RebalancingConfig{}).MinPodAge() != 30*time.Second {
+		t.Fatalf("expected a 30s default, got %s", (config.RebalancingConfig{}).MinPodAge())
+	}
+}
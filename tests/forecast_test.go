@@ -0,0 +1,107 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"lead-net-affinity/pkg/config"
+	"lead-net-affinity/pkg/controller"
+	"lead-net-affinity/pkg/forecast"
+	promc "lead-net-affinity/pkg/prometheus"
+)
+
+func TestHoltWinters(t *testing.T) {
+	p := forecast.Params{Alpha: 0.5, Beta: 0.1, Gamma: 0.3, Season: 4}
+	seasonal := []float64{10, 20, 30, 20, 10, 20, 30, 20, 10, 20, 30, 20}
+	for h, want := range map[int]float64{1: 10, 3: 30, 6: 20} {
+		v, model, ok := forecast.HoltWinters(seasonal, p, h)
+		if !ok || model != forecast.ModelHoltWinters || math.Abs(v-want) > 1e-9 {
+			t.Fatalf("h=%d: expected %v from %s, got %v %s %v", h, want, forecast.ModelHoltWinters, v, model, ok)
+		}
+	}
+
+	// Less than two seasons: the linear trend alone.
+	v, model, ok := forecast.HoltWinters([]float64{1, 2, 3, 4, 5}, p, 2)
+	if !ok || model != forecast.ModelHolt || math.Abs(v-7) > 1e-9 {
+		t.Fatalf("expected 7 from holt, got %v %s %v", v, model, ok)
+	}
+	if v, _, _ := forecast.HoltWinters([]float64{5, 4, 3}, p, 10); v != 0 {
+		t.Fatalf("expected a falling forecast clamped at 0, got %v", v)
+	}
+	if _, _, ok := forecast.HoltWinters([]float64{1}, p, 1); ok {
+		t.Fatal("expected no forecast from one sample")
+	}
+}
+
+func TestSeries_HourlyMeans(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := forecast.NewSeries(5)
+	s.Add(start, 10)
+	s.Add(start.Add(30*time.Minute), 20)
+	s.Add(start.Add(10*time.Minute), 99) // same hour, counted
+	s.Add(start.Add(-time.Hour), 1000)   // before the current hour, dropped
+	s.Add(start.Add(3*time.Hour), 5)     // hours 1 and 2 repeat hour 0
+	if got := s.Hours(); len(got) != 3 || got[0] != 43 || got[2] != 43 {
+		t.Fatalf("expected three hours of 43, got %v", got)
+	}
+
+	for i := 4; i < 12; i++ {
+		s.Add(start.Add(time.Duration(i)*time.Hour), float64(i))
+	}
+	if got := s.Hours(); len(got) != 5 || got[4] != 10 {
+		t.Fatalf("expected the last 5 hours ending at 10, got %v", got)
+	}
+	// Hour 11 is open; hour 12 is two steps past the last complete one.
+	p := forecast.Params{Alpha: 0.5, Beta: 0.5, Season: 24}
+	v, model, ok := s.Forecast(p, start.Add(12*time.Hour+time.Minute))
+	if !ok || model != forecast.ModelHolt || math.Abs(v-12) > 1e-9 {
+		t.Fatalf("expected 12 for hour 12, got %v %s %v", v, model, ok)
+	}
+}
+
+func TestController_ForecastEndpoint(t *testing.T) {
+	cfg := &config.Config{
+		NamespaceSelector: []string{"test-ns"},
+		Graph: config.ServiceGraphConfig{
+			Entry:    "a",
+			Services: []config.ServiceNode{{Name: "a", DependsOn: []string{"b"}}, {Name: "b"}},
+		},
+		Prometheus: config.PrometheusConfig{ServicePairRPSQuery: "rps"},
+		Forecast:   config.ForecastConfig{Enabled: true},
+	}
+	fk := &fakeKube{deploys: []appsv1.Deployment{
+		{ObjectMeta: metav1.ObjectMeta{Name: "a", Namespace: "test-ns", Labels: map[string]string{"io.kompose.service": "a"}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "b", Namespace: "test-ns", Labels: map[string]string{"io.kompose.service": "b"}}},
+	}}
+	fp := &fakeProm{rps: map[promc.ServicePair]float64{{Src: "a", Dst: "b"}: 40}}
+	ctrl := controller.New(cfg, fk, fp)
+	ctrl.EnableDryRunForTest()
+	if err := ctrl.ReconcileOnceForTest(context.Background()); err != nil {
+		t.Fatalf("reconcile error: %v", err)
+	}
+
+	ts := httptest.NewServer(ctrl.Handler())
+	defer ts.Close()
+	resp, err := http.Get(ts.URL + "/forecast")
+	if err != nil {
+		t.Fatalf("GET /forecast: %v", err)
+	}
+	defer resp.Body.Close()
+	var rep controller.ForecastReport
+	if err := json.NewDecoder(resp.Body).Decode(&rep); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	// Only b has measured callers; no hour is complete yet.
+	if !rep.Enabled || len(rep.Services) != 1 || rep.Services[0].Service != "b" || rep.Services[0].CurrentRPS != 40 ||
+		rep.Services[0].NextHourRPS != nil {
+		t.Fatalf("expected b observed without a forecast yet, got %+v", rep)
+	}
+}
@@ -0,0 +1,140 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"lead-net-affinity/pkg/config"
+	"lead-net-affinity/pkg/controller"
+	"lead-net-affinity/pkg/graph"
+)
+
+func TestGraphDocument_RoundTrip(t *testing.T) {
+	gc := config.ServiceGraphConfig{
+		Entry: "fe",
+		Services: []config.ServiceNode{
+			{Name: "fe", DependsOn: []string{"api"}, LabelSelector: map[string]string{"app": "web", "tier": "edge"}},
+			{Name: "api", DependsOn: []string{"db"}, Ports: []graph.Port{
+				{Name: "grpc", Port: 9090, AppProtocol: "grpc"},
+				{Name: "metrics", Port: 80, TargetPort: 8080, Protocol: "TCP"},
+			}},
+			{Name: "db", Ports: []graph.Port{{Port: 27017}}},
+		},
+	}
+	want := gc.Document()
+	for _, format := range []string{graph.FormatYAML, graph.FormatJSON, graph.FormatGraphML} {
+		b, err := want.Marshal(format)
+		if err != nil {
+			t.Fatalf("marshal %s: %v", format, err)
+		}
+		got, err := graph.ParseDocument(b, "")
+		if err != nil {
+			t.Fatalf("parse %s: %v\n%s", format, err, b)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("%s round trip mismatch:\ngot  %+v\nwant %+v", format, got, want)
+		}
+	}
+}
+
+func TestGraphDocument_ForeignGraphML(t *testing.T) {
+	// As written by e.g. networkx: generated node ids, names in a data key.
+	gml := `<?xml version="1.0"?>
+<graphml xmlns="http://graphml.graphdrawing.org/xmlns">
+  <key id="d0" for="node" attr.name="name" attr.type="string"/>
+  <graph edgedefault="directed">
+    <node id="n0"><data key="d0">gateway</data></node>
+    <node id="n1"><data key="d0">orders</data></node>
+    <node id="n2"><data key="d0">payments</data></node>
+    <edge source="n0" target="n1"/>
+    <edge source="n1" target="n2"/>
+  </graph>
+</graphml>`
+	doc, err := graph.ParseDocument([]byte(gml), "")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	g, err := doc.Graph()
+	if err != nil {
+		t.Fatalf("graph: %v", err)
+	}
+	if g.Entry != "gateway" || len(g.FindAllPaths()) != 1 || g.Nodes["orders"].DependsOn[0] != "payments" {
+		t.Fatalf("unexpected graph: entry=%s nodes=%+v", g.Entry, g.Nodes)
+	}
+}
+
+func TestGraphDocument_Validation(t *testing.T) {
+	cases := map[string]string{
+		"cycle":   "entry: a\nservices:\n  - {name: a, dependsOn: [b]}\n  - {name: b, dependsOn: [a]}\n",
+		"unknown": "entry: a\nservices:\n  - {name: a, dependsOn: [b]}\n",
+		"entry":   "entry: x\nservices:\n  - {name: a}\n",
+		"field":   "entry: a\nservices:\n  - {name: a, depends: [b]}\n",
+		"port":    "entry: a\nservices:\n  - {name: a, ports: [{port: 80, protocol: QUIC}]}\n",
+	}
+	for name, y := range cases {
+		if _, err := graph.ParseDocument([]byte(y), graph.FormatYAML); err == nil {
+			t.Fatalf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestConfigLoad_GraphFile(t *testing.T) {
+	dir := t.TempDir()
+	doc := `{"apiVersion": "lead.io/v1alpha1", "kind": "ServiceGraph", "entry": "a",
+	         "services": [{"name": "a", "dependsOn": ["b"]}, {"name": "b"}]}`
+	if err := os.WriteFile(filepath.Join(dir, "graph.json"), []byte(doc), 0644); err != nil {
+		t.Fatalf("write graph: %v", err)
+	}
+	fp := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(fp, []byte("graph:\n  file: graph.json\n"), 0644); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	cfg, err := config.Load(fp)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.Graph.Entry != "a" || len(cfg.Graph.Services) != 2 || cfg.Graph.Services[0].DependsOn[0] != "b" {
+		t.Fatalf("graph file not loaded: %+v", cfg.Graph)
+	}
+
+	both := "graph:\n  file: graph.json\n  services:\n    - name: c\n"
+	if err := os.WriteFile(fp, []byte(both), 0644); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	if _, err := config.Load(fp); err == nil || !strings.Contains(err.Error(), "mutually exclusive") {
+		t.Fatalf("expected file/services conflict, got %v", err)
+	}
+}
+
+func TestHTTP_GraphExport(t *testing.T) {
+	cfg := &config.Config{Graph: config.ServiceGraphConfig{
+		Entry:    "a",
+		Services: []config.ServiceNode{{Name: "a", DependsOn: []string{"b"}}, {Name: "b"}},
+	}}
+	ctrl := controller.New(cfg, &fakeKube{}, &fakeProm{})
+
+	rec := httptest.NewRecorder()
+	ctrl.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/graph?format=graphml", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/xml" {
+		t.Fatalf("status = %d, content type %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	doc, err := graph.ParseDocument(rec.Body.Bytes(), "")
+	if err != nil {
+		t.Fatalf("parse exported graph: %v", err)
+	}
+	if !reflect.DeepEqual(doc, ctrl.GraphDocument(context.Background())) {
+		t.Fatalf("exported graph differs: %+v", doc)
+	}
+
+	rec = httptest.NewRecorder()
+	ctrl.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/graph?format=dot", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for unknown format, got %d", rec.Code)
+	}
+}
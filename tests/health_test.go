@@ -0,0 +1,400 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"lead-net-affinity/pkg/config"
+	"lead-net-affinity/pkg/controller"
+	promc "lead-net-affinity/pkg/prometheus"
+)
+
+func TestHealthSummary_PerPath(t *testing.T) {
+	cfg := &config.Config{
+		Graph: config.ServiceGraphConfig{
+			Entry: "a",
+			Services: []config.ServiceNode{
+				{Name: "a", DependsOn: []string{"b"}},
+				{Name: "b", DependsOn: []string{"c"}},
+				{Name: "c"},
+			},
+		},
+		Prometheus: config.PrometheusConfig{ServicePairLatencyQuery: "edge_latency"},
+		Scoring:    config.ScoringWeights{BadEdgeLatencyMs: 35},
+		SLO:        config.SLOConfig{PathLatencyMs: 100, Paths: map[string]float64{"a-b-c": 60}, Target: 0.9},
+	}
+	prom := &fakeProm{lat: map[promc.ServicePair]float64{
+		{Src: "a", Dst: "b"}: 20,
+		{Src: "b", Dst: "c"}: 30,
+	}}
+	ctrl := controller.New(cfg, &fakeKube{}, prom)
+	reconcile := func() controller.HealthSummary {
+		t.Helper()
+		if err := ctrl.ReconcileOnceForTest(context.Background()); err != nil {
+			t.Fatalf("reconcile error: %v", err)
+		}
+		return ctrl.HealthSummary()
+	}
+
+	hs := reconcile()
+	if len(hs.Paths) != 1 || hs.Paths[0].Path != "a-b-c" || hs.Paths[0].ObjectiveMs != 60 {
+		t.Fatalf("unexpected paths: %+v", hs.Paths)
+	}
+	p := hs.Paths[0]
+	if p.Status != controller.HealthUnknown || p.WorstService != "c" || *p.LatencyMs != 50 || *p.BurnRate != 0 {
+		t.Fatalf("expected an unknown path (c unmeasured) within its objective, got %+v", p)
+	}
+
+	// b -> c slows down: b is degraded, the path misses its objective and
+	// burns its 10% budget at 5x (one miss in two samples).
+	prom.lat[promc.ServicePair{Src: "b", Dst: "c"}] = 45
+	hs = reconcile()
+	p = hs.Paths[0]
+	if p.Status != controller.HealthUnhealthy || math.Abs(*p.BurnRate-5) > 1e-9 || p.WindowSamples != 2 {
+		t.Fatalf("expected an unhealthy path at burn rate 5, got %+v (burn %v)", p, *p.BurnRate)
+	}
+	if hs.Services[1].Service != "b" || hs.Services[1].Status != controller.HealthDegraded || hs.Status != controller.HealthUnhealthy {
+		t.Fatalf("expected b degraded and overall unhealthy, got %+v", hs)
+	}
+
+	rec := httptest.NewRecorder()
+	ctrl.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health-summary", nil))
+	var got controller.HealthSummary
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil || len(got.Paths) != 1 {
+		t.Fatalf("bad /health-summary response %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestErrorBudget_HoldsAffinityChanges(t *testing.T) {
+	cfg := &config.Config{
+		NamespaceSelector: []string{"test-ns"},
+		Graph: config.ServiceGraphConfig{
+			Entry:    "a",
+			Services: []config.ServiceNode{{Name: "a", DependsOn: []string{"b"}}, {Name: "b"}},
+		},
+		Prometheus: config.PrometheusConfig{ServicePairLatencyQuery: "edge_latency"},
+		Scoring:    config.ScoringWeights{PathLengthWeight: 1, PodCountWeight: 1, ServiceEdgesWeight: 1},
+		Affinity:   config.AffinityConfig{TopPaths: 1, MinAffinityWeight: 50, MaxAffinityWeight: 100},
+		SLO:        config.SLOConfig{PathLatencyMs: 50, Target: 0.9, ReanalyzeBurnRate: 2},
+	}
+	deploy := func(name string) appsv1.Deployment {
+		lbls := map[string]string{"io.kompose.service": name}
+		return appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "test-ns", Labels: lbls},
+			Spec: appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{ObjectMeta: metav1.ObjectMeta{Labels: lbls}}}}
+	}
+	fk := &fakeKube{deploys: []appsv1.Deployment{deploy("a"), deploy("b")}}
+	prom := &fakeProm{lat: map[promc.ServicePair]float64{{Src: "a", Dst: "b"}: 10}}
+	ctrl := controller.New(cfg, fk, prom)
+
+	if err := ctrl.ReconcileOnceForTest(context.Background()); err != nil {
+		t.Fatalf("reconcile error: %v", err)
+	}
+	if fk.deploys[1].Spec.Template.Spec.Affinity != nil {
+		t.Fatalf("expected b's affinity change held while the path meets its objective")
+	}
+	if held := ctrl.Status().HeldByErrorBudget; len(held) != 1 || held[0] != "b" {
+		t.Fatalf("expected b reported as held, got %v", held)
+	}
+
+	// One miss in two samples burns a 10% budget at 5x >= 2x.
+	prom.lat[promc.ServicePair{Src: "a", Dst: "b"}] = 80
+	if err := ctrl.ReconcileOnceForTest(context.Background()); err != nil {
+		t.Fatalf("reconcile error: %v", err)
+	}
+	if aff := fk.deploys[1].Spec.Template.Spec.Affinity; aff == nil || aff.PodAffinity == nil {
+		t.Fatalf("expected b's affinity applied once the budget burns, got %+v", aff)
+	}
+	if held := ctrl.Status().HeldByErrorBudget; len(held) != 0 {
+		t.Fatalf("expected nothing held, got %v", held)
+	}
+}
+
+func TestGatewayLatency_PrimaryObjective(t *testing.T) {
+	cfg := &config.Config{
+		NamespaceSelector: []string{"test-ns"},
+		Graph: config.ServiceGraphConfig{
+			Entry:    "a",
+			Services: []config.ServiceNode{{Name: "a", DependsOn: []string{"b"}}, {Name: "b"}},
+		},
+		Prometheus: config.PrometheusConfig{
+			ServicePairLatencyQuery: "edge_latency",
+			Gateway:                 config.GatewayConfig{LatencyQuery: "gateway_latency"},
+		},
+		Scoring:  config.ScoringWeights{PathLengthWeight: 1, PodCountWeight: 1, ServiceEdgesWeight: 1},
+		Affinity: config.AffinityConfig{TopPaths: 1, MinAffinityWeight: 50, MaxAffinityWeight: 100},
+		SLO:      config.SLOConfig{PathLatencyMs: 50, GatewayLatencyMs: 100, Target: 0.9, ReanalyzeBurnRate: 2},
+	}
+	deploy := func(name string) appsv1.Deployment {
+		lbls := map[string]string{"io.kompose.service": name}
+		return appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "test-ns", Labels: lbls},
+			Spec: appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{ObjectMeta: metav1.ObjectMeta{Labels: lbls}}}}
+	}
+	fk := &fakeKube{deploys: []appsv1.Deployment{deploy("a"), deploy("b")}}
+	prom := &fakeProm{lat: map[promc.ServicePair]float64{{Src: "a", Dst: "b"}: 10}, gateway: []float64{60, 300}}
+	ctrl := controller.New(cfg, fk, prom)
+
+	if err := ctrl.ReconcileOnceForTest(context.Background()); err != nil {
+		t.Fatalf("reconcile error: %v", err)
+	}
+	if gw := ctrl.HealthSummary().Gateway; gw == nil || gw.Status != controller.HealthHealthy || *gw.LatencyMs != 60 {
+		t.Fatalf("first reconcile: gateway %+v, want healthy at 60ms", gw)
+	}
+	if held := ctrl.Status().HeldByErrorBudget; len(held) != 1 {
+		t.Fatalf("expected b held while path and gateway meet their objectives, got %v", held)
+	}
+
+	// The path still meets its objective, but users see one miss in two
+	// samples: the gateway burns a 10% budget at 5x >= 2x.
+	if err := ctrl.ReconcileOnceForTest(context.Background()); err != nil {
+		t.Fatalf("reconcile error: %v", err)
+	}
+	sum := ctrl.HealthSummary()
+	if gw := sum.Gateway; gw == nil || gw.Status != controller.HealthUnhealthy || gw.BurnRate == nil || math.Abs(*gw.BurnRate-5) > 1e-9 {
+		t.Fatalf("second reconcile: gateway %+v, want unhealthy burning at 5x", gw)
+	}
+	if sum.Status != controller.HealthUnhealthy {
+		t.Fatalf("summary status %q, want the gateway's unhealthy", sum.Status)
+	}
+	if held := ctrl.Status().HeldByErrorBudget; len(held) != 0 {
+		t.Fatalf("expected nothing held while the gateway burns its budget, got %v", held)
+	}
+	if aff := fk.deploys[1].Spec.Template.Spec.Affinity; aff == nil || aff.PodAffinity == nil {
+		t.Fatalf("expected b's affinity applied, got %+v", aff)
+	}
+
+	h, ok := ctrl.PathHistory("a-b")
+	if !ok || len(h.Samples) != 2 || *h.Samples[0].GatewayLatencyMs != 60 || *h.Samples[1].GatewayLatencyMs != 300 {
+		t.Fatalf("path history should carry the gateway latency: %+v", h)
+	}
+}
+
+func TestHealthSummary_PerServiceThresholds(t *testing.T) {
+	cfg := &config.Config{
+		NamespaceSelector: []string{"test-ns"},
+		Graph: config.ServiceGraphConfig{
+			Entry: "fe",
+			Services: []config.ServiceNode{
+				{Name: "fe", DependsOn: []string{"api", "db"}},
+				{Name: "api"},
+				{Name: "db"},
+			},
+		},
+		Prometheus: config.PrometheusConfig{ServicePairLatencyQuery: "edge_latency"},
+		Scoring:    config.ScoringWeights{BadEdgeLatencyMs: 20},
+		Thresholds: []config.ServiceThresholds{
+			{Selector: map[string]string{"tier": "database"}, BadEdgeLatencyMs: 100},
+			{Service: "api", BadEdgeLatencyMs: 50},
+		},
+	}
+	fk := &fakeKube{deploys: []appsv1.Deployment{{
+		ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "test-ns", Labels: map[string]string{"io.kompose.service": "db"}},
+		Spec: appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{ObjectMeta: metav1.ObjectMeta{
+			Labels: map[string]string{"io.kompose.service": "db", "tier": "database"}}}},
+	}}}
+	prom := &fakeProm{lat: map[promc.ServicePair]float64{
+		{Src: "fe", Dst: "api"}: 30, // below api's 50
+		{Src: "fe", Dst: "db"}:  80, // below the database selector's 100
+	}}
+	ctrl := controller.New(cfg, fk, prom)
+	if err := ctrl.ReconcileOnceForTest(context.Background()); err != nil {
+		t.Fatalf("reconcile error: %v", err)
+	}
+	fe := func() controller.ServiceHealth {
+		for _, s := range ctrl.HealthSummary().Services {
+			if s.Service == "fe" {
+				return s
+			}
+		}
+		t.Fatalf("fe missing from the health summary")
+		return controller.ServiceHealth{}
+	}
+	if fe := fe(); fe.Status != controller.HealthHealthy {
+		t.Fatalf("expected fe healthy under per-service thresholds, got %+v", fe)
+	}
+
+	prom.lat[promc.ServicePair{Src: "fe", Dst: "api"}] = 60
+	if err := ctrl.ReconcileOnceForTest(context.Background()); err != nil {
+		t.Fatalf("reconcile error: %v", err)
+	}
+	if fe := fe(); fe.Status != controller.HealthDegraded || len(fe.Reasons) != 1 {
+		t.Fatalf("expected fe degraded by its call to api only, got %+v", fe)
+	}
+}
+
+func TestRootCause_FollowsSlowCalls(t *testing.T) {
+	cfg := &config.Config{
+		Graph: config.ServiceGraphConfig{
+			Entry: "fe",
+			Services: []config.ServiceNode{
+				{Name: "fe", DependsOn: []string{"api", "cache"}},
+				{Name: "api", DependsOn: []string{"db"}},
+				{Name: "cache"},
+				{Name: "db"},
+			},
+		},
+		Prometheus: config.PrometheusConfig{ServicePairLatencyQuery: "edge_latency"},
+		Scoring:    config.ScoringWeights{BadEdgeLatencyMs: 20},
+		SLO:        config.SLOConfig{PathLatencyMs: 100},
+	}
+	prom := &fakeProm{lat: map[promc.ServicePair]float64{
+		{Src: "fe", Dst: "api"}:   120,
+		{Src: "api", Dst: "db"}:   100,
+		{Src: "fe", Dst: "cache"}: 5,
+	}}
+	ctrl := controller.New(cfg, &fakeKube{}, prom)
+	if err := ctrl.ReconcileOnceForTest(context.Background()); err != nil {
+		t.Fatalf("reconcile error: %v", err)
+	}
+	rep := ctrl.RootCause()
+	if len(rep.Violations) != 1 || rep.Violations[0].Path != "fe-api-db" {
+		t.Fatalf("expected fe-api-db over its objective, got %+v", rep.Violations)
+	}
+	if len(rep.Culprits) != 1 || rep.Culprits[0].Service != "db" || rep.Culprits[0].ExcessMs != 80 ||
+		strings.Join(rep.Culprits[0].Chain, ",") != "fe,api,db" {
+		t.Fatalf("expected db as the culprit, got %+v", rep.Culprits)
+	}
+
+	// db answers quickly again: the time is spent in api itself.
+	prom.lat[promc.ServicePair{Src: "api", Dst: "db"}] = 10
+	if err := ctrl.ReconcileOnceForTest(context.Background()); err != nil {
+		t.Fatalf("reconcile error: %v", err)
+	}
+	if rep := ctrl.RootCause(); len(rep.Culprits) != 1 || rep.Culprits[0].Service != "api" {
+		t.Fatalf("expected api as the culprit, got %+v", rep.Culprits)
+	}
+}
+
+func TestHealthSummary_ReadyReplicas(t *testing.T) {
+	cfg := &config.Config{
+		NamespaceSelector: []string{"test-ns"},
+		Graph: config.ServiceGraphConfig{
+			Entry:    "a",
+			Services: []config.ServiceNode{{Name: "a", DependsOn: []string{"b", "c"}}, {Name: "b"}, {Name: "c"}},
+		},
+	}
+	pod := func(name, svc, node string, phase corev1.PodPhase, ready bool) corev1.Pod {
+		status := corev1.ConditionFalse
+		if ready {
+			status = corev1.ConditionTrue
+		}
+		return corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "test-ns", Labels: map[string]string{"io.kompose.service": svc}},
+			Spec:       corev1.PodSpec{NodeName: node},
+			Status:     corev1.PodStatus{Phase: phase, Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: status}}},
+		}
+	}
+	evicted := pod("b-2", "b", "n2", corev1.PodFailed, false)
+	evicted.Status.Reason = "Evicted"
+	k8s := &fakeKube{pods: []corev1.Pod{
+		pod("a-0", "a", "n1", corev1.PodRunning, true),
+		pod("b-0", "b", "n1", corev1.PodRunning, true),
+		pod("b-1", "b", "", corev1.PodPending, false),
+		evicted,
+		pod("c-0", "c", "n2", corev1.PodRunning, false),
+	}}
+	ctrl := controller.New(cfg, k8s, &fakeProm{})
+	if err := ctrl.ReconcileOnceForTest(context.Background()); err != nil {
+		t.Fatalf("reconcile error: %v", err)
+	}
+
+	services := map[string]controller.ServiceHealth{}
+	for _, s := range ctrl.HealthSummary().Services {
+		services[s.Service] = s
+	}
+	b, c := services["b"], services["c"]
+	if b.Replicas == nil || b.Replicas.Ready != 1 || b.Replicas.NotReady != 1 || *b.ReadyRatio != 0.5 || b.Status != controller.HealthDegraded {
+		t.Fatalf("b should have 1/2 replicas ready (evicted pod ignored) and be degraded, got %+v", b)
+	}
+	if b.Node != "n1" {
+		t.Fatalf("the evicted pod must not place b on n2, got node %q", b.Node)
+	}
+	if c.ReadyRatio == nil || *c.ReadyRatio != 0 || c.Status != controller.HealthUnhealthy {
+		t.Fatalf("c has no ready replica and should be unhealthy, got %+v", c)
+	}
+	if a := services["a"]; a.Status != controller.HealthHealthy || *a.ReadyRatio != 1 {
+		t.Fatalf("a is fully ready, got %+v", a)
+	}
+}
+
+func TestServiceHistory_TrendsAndBounds(t *testing.T) {
+	cfg := &config.Config{
+		Graph: config.ServiceGraphConfig{
+			Entry:    "a",
+			Services: []config.ServiceNode{{Name: "a", DependsOn: []string{"b"}}, {Name: "b", DependsOn: []string{"c"}}, {Name: "c"}},
+		},
+		Prometheus: config.PrometheusConfig{ServicePairLatencyQuery: "edge_latency"},
+		Controller: config.ControllerConfig{HistorySize: 3},
+		Caches:     config.CacheConfig{MaxServices: 3},
+	}
+	prom := &fakeProm{lat: map[promc.ServicePair]float64{{Src: "a", Dst: "b"}: 10, {Src: "b", Dst: "c"}: 30}}
+	ctrl := controller.New(cfg, &fakeKube{}, prom)
+	ts := httptest.NewServer(ctrl.Handler())
+	defer ts.Close()
+
+	// Handlers read snapshots while the loop records.
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				_, _ = ctrl.ServiceHistory("b")
+				_ = ctrl.HealthSummary()
+			}
+		}
+	}()
+	for i := 0; i < 4; i++ {
+		prom.lat[promc.ServicePair{Src: "b", Dst: "c"}] = float64(30 + 10*i)
+		if err := ctrl.ReconcileOnceForTest(context.Background()); err != nil {
+			t.Fatalf("reconcile error: %v", err)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	close(stop)
+	wg.Wait()
+
+	resp, err := http.Get(ts.URL + "/services/history?service=b")
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	defer resp.Body.Close()
+	var h controller.ServiceHistory
+	if err := json.NewDecoder(resp.Body).Decode(&h); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(h.Samples) != 3 || *h.Samples[0].CallLatencyMs != 40 || *h.Samples[2].CallLatencyMs != 60 {
+		t.Fatalf("expected the last 3 samples of b's calls, got %+v", h.Samples)
+	}
+	if h.Trend.CallLatencyMsPerHour == nil || *h.Trend.CallLatencyMsPerHour <= 0 {
+		t.Fatalf("expected a rising call latency trend, got %+v", h.Trend)
+	}
+	if h.Trend.ReadyRatioPerHour != nil {
+		t.Fatalf("expected no ready ratio trend without pods, got %v", *h.Trend.ReadyRatioPerHour)
+	}
+	if _, ok := ctrl.ServiceHistory("c"); !ok {
+		t.Fatalf("expected c (no calls of its own) sampled too")
+	}
+
+	cfg.Caches.MaxServices = 1
+	if err := ctrl.ReconcileOnceForTest(context.Background()); err != nil {
+		t.Fatalf("reconcile error: %v", err)
+	}
+	if ids := ctrl.ServiceHistoryIDs(); len(ids) != 1 {
+		t.Fatalf("expected the history bounded to 1 service, got %v", ids)
+	}
+}
@@ -0,0 +1,86 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+
+	"lead-net-affinity/pkg/config"
+	"lead-net-affinity/pkg/rbac"
+)
+
+const chartDir = "../deploy/helm/lead-net-affinity"
+
+func TestHelmChart_RBACRulesAreGenerated(t *testing.T) {
+	b, err := os.ReadFile(filepath.Join(chartDir, "files", "rbac-rules.yaml"))
+	if err != nil {
+		t.Fatalf("read chart rules: %v", err)
+	}
+	want, err := rbac.RulesYAML()
+	if err != nil {
+		t.Fatalf("render rules: %v", err)
+	}
+	_, got, _ := strings.Cut(string(b), "\n") // drop the "Generated by" header
+	if got != string(want) {
+		t.Fatalf("files/rbac-rules.yaml is stale; regenerate with \"lead-net-affinity rbac --rules\"")
+	}
+}
+
+func TestHelmChart_DefaultValuesRenderValidConfig(t *testing.T) {
+	b, err := os.ReadFile(filepath.Join(chartDir, "values.yaml"))
+	if err != nil {
+		t.Fatalf("read values: %v", err)
+	}
+	var values struct {
+		Config map[string]interface{} `yaml:"config"`
+	}
+	if err := yaml.Unmarshal(b, &values); err != nil {
+		t.Fatalf("parse values: %v", err)
+	}
+	// Mirror the chart's "lead-net-affinity.config" template.
+	values.Config["apiVersion"] = config.APIVersion
+	out, err := yaml.Marshal(values.Config)
+	if err != nil {
+		t.Fatalf("marshal config: %v", err)
+	}
+	fp := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(fp, out, 0644); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	cfg, err := config.Load(fp)
+	if err != nil {
+		t.Fatalf("chart default config does not load: %v", err)
+	}
+	if cfg.Graph.Entry == "" || cfg.Affinity.TopPaths == 0 {
+		t.Fatalf("chart values not carried into config: %+v", cfg)
+	}
+
+	tmpl, err := os.ReadFile(filepath.Join(chartDir, "templates", "_helpers.tpl"))
+	if err != nil {
+		t.Fatalf("read helpers: %v", err)
+	}
+	if !strings.Contains(string(tmpl), "apiVersion: "+config.APIVersion) {
+		t.Fatalf("chart config template does not pin apiVersion %s", config.APIVersion)
+	}
+}
+
+func TestConfigLoad_RejectsUnknownAPIVersion(t *testing.T) {
+	fp := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(fp, []byte("apiVersion: lead.io/v9\ngraph: {entry: a}\n"), 0644); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	if _, err := config.Load(fp); err == nil || !strings.Contains(err.Error(), "lead.io/v9") {
+		t.Fatalf("expected unsupported apiVersion error, got %v", err)
+	}
+
+	if err := os.WriteFile(fp, []byte("graph: {entry: a}\n"), 0644); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	cfg, err := config.Load(fp)
+	if err != nil || cfg.APIVersion != config.APIVersion {
+		t.Fatalf("expected unversioned config to default to %s, got %v %v", config.APIVersion, cfg, err)
+	}
+}
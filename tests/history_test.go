@@ -0,0 +1,24 @@
+package tests
+
+import (
+	"reflect"
+	"testing"
+
+	"lead-net-affinity/pkg/history"
+)
+
+func TestRing_KeepsLastNOldestFirst(t *testing.T) {
+	r := history.NewRing[int](3)
+	if got := r.Snapshot(); len(got) != 0 {
+		t.Fatalf("empty ring snapshot: %v", got)
+	}
+	for i := 1; i <= 5; i++ {
+		r.Push(i)
+	}
+	if got := r.Snapshot(); !reflect.DeepEqual(got, []int{3, 4, 5}) {
+		t.Fatalf("expected [3 4 5], got %v", got)
+	}
+	if r.Len() != 3 {
+		t.Fatalf("expected len 3, got %d", r.Len())
+	}
+}
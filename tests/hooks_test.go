@@ -0,0 +1,100 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"lead-net-affinity/pkg/config"
+	"lead-net-affinity/pkg/controller"
+	"lead-net-affinity/pkg/hooks"
+)
+
+func init() {
+	controller.RegisterHook("compliance-zones", hooks.NewComplianceZones)
+}
+
+func TestDecisionHooks_CompiledInAndSidecar(t *testing.T) {
+	var mu sync.Mutex
+	var events []string
+	var applied []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req controller.HookRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("decode hook request: %v", err)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		event := strings.TrimPrefix(r.URL.Path, "/")
+		events = append(events, event)
+		switch event {
+		case controller.HookEventPathsScored:
+			if len(req.Paths) == 0 {
+				t.Errorf("expected scored paths, got none")
+			}
+		case controller.HookEventBeforeApply:
+			if req.Deployment.Name == "b" {
+				_ = json.NewEncoder(w).Encode(controller.HookResponse{Allowed: new(bool), Reason: "change freeze"})
+			}
+		case controller.HookEventAfterApply:
+			applied = append(applied, req.Deployment.Name)
+		}
+	}))
+	defer ts.Close()
+
+	cfg, fk := approvalFixture(config.ApprovalConfig{})
+	cfg.Hooks = []config.HookConfig{
+		{Name: "compliance-zones", Options: map[string]string{"zones": "eu-1a, eu-1b", "services": "c"}},
+		{Name: "sidecar", URL: ts.URL},
+	}
+	hs, err := controller.HooksFromConfig(cfg.Hooks)
+	if err != nil {
+		t.Fatalf("hooks from config: %v", err)
+	}
+	ctrl := controller.New(cfg, fk, &fakeProm{})
+	ctrl.SetDecisionHooks(hs...)
+	if err := ctrl.ReconcileOnceForTest(context.Background()); err != nil {
+		t.Fatalf("reconcile error: %v", err)
+	}
+
+	// The sidecar vetoes b; a and c are updated.
+	if fk.updated != 2 {
+		t.Fatalf("expected 2 updates with b denied, got %d", fk.updated)
+	}
+	sort.Strings(applied)
+	if strings.Join(applied, ",") != "a,c" {
+		t.Fatalf("expected after-apply for a and c, got %v", applied)
+	}
+	if st := ctrl.Status(); !strings.Contains(strings.Join(st.Errors, "\n"), "denied: change freeze") {
+		t.Fatalf("expected the denial in the status, got %+v", st.Errors)
+	}
+	if events[0] != controller.HookEventPathsScored {
+		t.Fatalf("expected paths-scored first, got %v", events)
+	}
+
+	// Only c is restricted to the compliance zones.
+	aff, ok := ctrl.AffinityPreview("c")
+	if !ok || aff.NodeAffinity == nil || aff.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution == nil {
+		t.Fatalf("expected c to require the compliance zones, got %+v", aff)
+	}
+	terms := aff.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms
+	want := corev1.NodeSelectorRequirement{Key: hooks.DefaultZoneLabel, Operator: corev1.NodeSelectorOpIn, Values: []string{"eu-1a", "eu-1b"}}
+	if len(terms) != 1 || len(terms[0].MatchExpressions) != 1 || terms[0].MatchExpressions[0].Key != want.Key ||
+		strings.Join(terms[0].MatchExpressions[0].Values, ",") != "eu-1a,eu-1b" {
+		t.Fatalf("expected %+v, got %+v", want, terms)
+	}
+	if aff, ok := ctrl.AffinityPreview("b"); ok && aff != nil && aff.NodeAffinity != nil {
+		t.Fatalf("b is not a compliance service, got node affinity %+v", aff.NodeAffinity)
+	}
+
+	if _, err := controller.HooksFromConfig([]config.HookConfig{{Name: "missing"}}); err == nil {
+		t.Fatalf("expected an error for a hook that is neither compiled in nor a sidecar")
+	}
+}
@@ -0,0 +1,477 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"lead-net-affinity/pkg/config"
+	"lead-net-affinity/pkg/controller"
+	promc "lead-net-affinity/pkg/prometheus"
+)
+
+// withToken sends an empty request with the bearer token the write API
+// (server.debug.token) requires.
+func withToken(method, url, token string) (*http.Response, error) {
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return http.DefaultClient.Do(req)
+}
+
+func TestController_HealthReadyMetrics(t *testing.T) {
+	cfg := &config.Config{
+		NamespaceSelector: []string{"test-ns"},
+		Graph: config.ServiceGraphConfig{
+			Entry:    "a",
+			Services: []config.ServiceNode{{Name: "a", DependsOn: []string{"b"}}, {Name: "b"}},
+		},
+		Server: config.ServerConfig{Debug: config.DebugConfig{Token: "s3cret"}},
+	}
+	ctrl := controller.New(cfg, &fakeKube{}, &fakeProm{})
+	ctrl.EnableDryRunForTest()
+
+	ts := httptest.NewServer(ctrl.Handler())
+	defer ts.Close()
+
+	get := func(path string) (int, string) {
+		resp, err := http.Get(ts.URL + path)
+		if err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(b)
+	}
+
+	if code, _ := get("/healthz"); code != http.StatusOK {
+		t.Fatalf("/healthz: expected 200, got %d", code)
+	}
+	if code, body := get("/readyz"); code != http.StatusServiceUnavailable {
+		t.Fatalf("/readyz before first reconcile: expected 503, got %d (%s)", code, body)
+	}
+
+	if err := ctrl.ReconcileOnceForTest(context.Background()); err != nil {
+		t.Fatalf("reconcile error: %v", err)
+	}
+
+	if code, body := get("/readyz"); code != http.StatusOK {
+		t.Fatalf("/readyz after reconcile: expected 200, got %d (%s)", code, body)
+	}
+	if _, body := get("/metrics"); !strings.Contains(body, "lead_net_reconcile_total") {
+		t.Fatalf("/metrics missing reconcile counter:\n%s", body)
+	}
+
+	resp, err := http.Post(ts.URL+"/reanalyze?service=b", "", nil)
+	if err != nil {
+		t.Fatalf("POST /reanalyze: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("/reanalyze without the token: expected 401, got %d", resp.StatusCode)
+	}
+	resp, err = withToken(http.MethodGet, ts.URL+"/reanalyze?service=b", "s3cret")
+	if err != nil {
+		t.Fatalf("GET /reanalyze: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Fatalf("/reanalyze with GET: expected 405, got %d", resp.StatusCode)
+	}
+	resp, err = withToken(http.MethodPost, ts.URL+"/reanalyze?service=b", "s3cret")
+	if err != nil {
+		t.Fatalf("POST /reanalyze: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("/reanalyze: expected 200, got %d", resp.StatusCode)
+	}
+	resp, err = withToken(http.MethodPost, ts.URL+"/reanalyze?service=nope", "s3cret")
+	if err != nil {
+		t.Fatalf("POST /reanalyze: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("/reanalyze of a service on no path: expected 404, got %d", resp.StatusCode)
+	}
+}
+
+func TestController_RecommendationsEndpoint(t *testing.T) {
+	cfg := &config.Config{
+		NamespaceSelector: []string{"test-ns"},
+		Graph: config.ServiceGraphConfig{
+			Entry:    "a",
+			Services: []config.ServiceNode{{Name: "a", DependsOn: []string{"b"}}, {Name: "b"}},
+		},
+		Affinity:        config.AffinityConfig{TopPaths: 1},
+		Recommendations: config.RecommendationsConfig{MinReplicasOnCriticalPath: 2},
+	}
+	two := int32(2)
+	fk := &fakeKube{deploys: []appsv1.Deployment{
+		{ObjectMeta: metav1.ObjectMeta{Name: "a", Namespace: "test-ns", Labels: map[string]string{"io.kompose.service": "a"}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "b", Namespace: "test-ns", Labels: map[string]string{"io.kompose.service": "b"}},
+			Spec: appsv1.DeploymentSpec{Replicas: &two}},
+	}}
+	ctrl := controller.New(cfg, fk, &fakeProm{})
+	ctrl.EnableDryRunForTest()
+	if err := ctrl.ReconcileOnceForTest(context.Background()); err != nil {
+		t.Fatalf("reconcile error: %v", err)
+	}
+
+	ts := httptest.NewServer(ctrl.Handler())
+	defer ts.Close()
+	resp, err := http.Get(ts.URL + "/recommendations")
+	if err != nil {
+		t.Fatalf("GET /recommendations: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var doc controller.Recommendations
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(doc.Items) != 1 {
+		t.Fatalf("expected one recommendation (a: 1 -> 2), got %+v", doc.Items)
+	}
+	if r := doc.Items[0]; r.ServiceID != "a" || r.Current != 1 || r.Target != 2 || r.Reason == "" {
+		t.Fatalf("unexpected recommendation: %+v", r)
+	}
+	if fk.updated != 0 {
+		t.Fatalf("recommendations must never be applied, got %d updates", fk.updated)
+	}
+}
+
+func TestController_RecommendationsWaitForRollouts(t *testing.T) {
+	cfg := &config.Config{
+		NamespaceSelector: []string{"test-ns"},
+		Graph: config.ServiceGraphConfig{
+			Entry:    "a",
+			Services: []config.ServiceNode{{Name: "a", DependsOn: []string{"b"}}, {Name: "b"}},
+		},
+		Prometheus:      config.PrometheusConfig{KubeStateMetrics: config.KubeStateMetricsConfig{Enabled: true}},
+		Affinity:        config.AffinityConfig{TopPaths: 1},
+		Recommendations: config.RecommendationsConfig{MinReplicasOnCriticalPath: 2},
+	}
+	fk := &fakeKube{deploys: []appsv1.Deployment{
+		{ObjectMeta: metav1.ObjectMeta{Name: "a", Namespace: "test-ns", Labels: map[string]string{"io.kompose.service": "a"}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "b", Namespace: "test-ns", Labels: map[string]string{"io.kompose.service": "b"}}},
+	}}
+	fp := &fakeProm{}
+	ctrl := controller.New(cfg, fk, fp)
+	ctrl.EnableDryRunForTest()
+	if err := ctrl.ReconcileOnceForTest(context.Background()); err != nil {
+		t.Fatalf("reconcile error: %v", err)
+	}
+	if items := ctrl.Recommendations().Items; len(items) != 2 || items[1].Target != 2 {
+		t.Fatalf("first reconcile: got %+v, want a and b scaled to 2", items)
+	}
+
+	// b is still rolling out an earlier change: its decision is not re-made.
+	fp.rollouts = map[string]promc.DeploymentRollout{
+		"test-ns/a": {Desired: 1, Updated: 1, Available: 1},
+		"test-ns/b": {Desired: 2, Updated: 2, Available: 1},
+	}
+	cfg.Recommendations.MinReplicasOnCriticalPath = 3
+	if err := ctrl.ReconcileOnceForTest(context.Background()); err != nil {
+		t.Fatalf("reconcile error: %v", err)
+	}
+	items := ctrl.Recommendations().Items
+	if len(items) != 2 || items[0].ServiceID != "a" || items[0].Target != 3 ||
+		items[1].ServiceID != "b" || items[1].Target != 2 {
+		t.Fatalf("during b's rollout: got %+v, want a re-evaluated to 3 and b kept at 2", items)
+	}
+}
+
+func TestController_TrendRecommendations(t *testing.T) {
+	cfg := &config.Config{
+		NamespaceSelector: []string{"test-ns"},
+		Graph: config.ServiceGraphConfig{
+			Entry:    "a",
+			Services: []config.ServiceNode{{Name: "a", DependsOn: []string{"b"}}, {Name: "b"}},
+		},
+		Prometheus:      config.PrometheusConfig{ServicePairRPSQuery: "rps"},
+		Recommendations: config.RecommendationsConfig{Trend: config.TrendConfig{MaxRPSPerReplica: 50}},
+	}
+	fk := &fakeKube{deploys: []appsv1.Deployment{
+		{ObjectMeta: metav1.ObjectMeta{Name: "a", Namespace: "test-ns", Labels: map[string]string{"io.kompose.service": "a"}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "b", Namespace: "test-ns", Labels: map[string]string{"io.kompose.service": "b"}}},
+	}}
+	fp := &fakeProm{rps: map[promc.ServicePair]float64{}}
+	ctrl := controller.New(cfg, fk, fp)
+	ctrl.EnableDryRunForTest()
+	reconcile := func(rps float64) []controller.ReplicaRecommendation {
+		t.Helper()
+		fp.rps[promc.ServicePair{Src: "a", Dst: "b"}] = rps
+		if err := ctrl.ReconcileOnceForTest(context.Background()); err != nil {
+			t.Fatalf("reconcile error: %v", err)
+		}
+		time.Sleep(5 * time.Millisecond)
+		return ctrl.Recommendations().Items
+	}
+
+	// A steady 40 req/s fits one replica.
+	for i := 0; i < 3; i++ {
+		if items := reconcile(40); len(items) != 0 {
+			t.Fatalf("expected no recommendation for steady load, got %+v", items)
+		}
+	}
+	// Still below the limit, but rising: b is scaled ahead of the breach.
+	reconcile(44)
+	items := reconcile(48)
+	if len(items) != 1 || items[0].ServiceID != "b" || items[0].Current != 1 || items[0].Target <= 1 ||
+		!strings.Contains(items[0].Reason, "rising") {
+		t.Fatalf("expected b scaled ahead of rising load, got %+v", items)
+	}
+	if h, ok := ctrl.ServiceHistory("b"); !ok || h.Trend.InboundRPSPerHour == nil || *h.Trend.InboundRPSPerHour <= 0 {
+		t.Fatalf("expected a rising inbound rate trend for b, got %+v", h.Trend)
+	}
+}
+
+func TestController_PathHistoryEndpoint(t *testing.T) {
+	cfg := &config.Config{
+		NamespaceSelector: []string{"test-ns"},
+		Graph: config.ServiceGraphConfig{
+			Entry:    "fe",
+			Services: []config.ServiceNode{{Name: "fe", DependsOn: []string{"src"}}, {Name: "src", DependsOn: []string{"prf"}}, {Name: "prf"}},
+		},
+		Controller: config.ControllerConfig{HistorySize: 2},
+	}
+	ctrl := controller.New(cfg, &fakeKube{}, &fakeProm{})
+	ctrl.EnableDryRunForTest()
+	for i := 0; i < 3; i++ {
+		if err := ctrl.ReconcileOnceForTest(context.Background()); err != nil {
+			t.Fatalf("reconcile error: %v", err)
+		}
+	}
+
+	ts := httptest.NewServer(ctrl.Handler())
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/paths/history?path=fe-src-prf")
+	if err != nil {
+		t.Fatalf("GET /paths/history: %v", err)
+	}
+	defer resp.Body.Close()
+	var h controller.PathHistory
+	if err := json.NewDecoder(resp.Body).Decode(&h); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if h.Path != "fe-src-prf" || len(h.Samples) != 2 {
+		t.Fatalf("expected 2 samples (ring size) for fe-src-prf, got %+v", h)
+	}
+	if h.Samples[0].Rank != 1 || h.Samples[1].Time.Before(h.Samples[0].Time) {
+		t.Fatalf("unexpected samples: %+v", h.Samples)
+	}
+
+	missing, err := http.Get(ts.URL + "/paths/history?path=nope")
+	if err != nil {
+		t.Fatalf("GET missing path: %v", err)
+	}
+	missing.Body.Close()
+	if missing.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404 for unknown path, got %d", missing.StatusCode)
+	}
+}
+
+func TestDebugEndpoints_RequireToken(t *testing.T) {
+	api := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) { _, _ = w.Write([]byte("api")) })
+	h := controller.WithDebugEndpoints(api, config.DebugConfig{Enabled: true, Token: "s3cret"})
+	get := func(path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+	if rec := get("/debug/vars", ""); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without a token, got %d", rec.Code)
+	}
+	if rec := get("/debug/pprof/", "wrong"); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for a wrong token, got %d", rec.Code)
+	}
+	if rec := get("/debug/vars", "s3cret"); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "memstats") {
+		t.Fatalf("expected expvar memstats, got %d", rec.Code)
+	}
+	if rec := get("/debug/pprof/heap", "s3cret"); rec.Code != http.StatusOK {
+		t.Fatalf("expected a heap profile, got %d", rec.Code)
+	}
+	if rec := get("/status", ""); rec.Body.String() != "api" {
+		t.Fatalf("expected other paths served unchanged, got %q", rec.Body.String())
+	}
+	if err := (config.DebugConfig{Enabled: true}).Validate(); err == nil {
+		t.Fatalf("expected enabled debug endpoints without a token to be rejected")
+	}
+}
+
+func TestAffinityPreview_DryRun(t *testing.T) {
+	cfg := &config.Config{
+		NamespaceSelector: []string{"test-ns"},
+		Graph: config.ServiceGraphConfig{
+			Entry:    "a",
+			Services: []config.ServiceNode{{Name: "a", DependsOn: []string{"b"}}, {Name: "b"}},
+		},
+		Scoring:  config.ScoringWeights{PathLengthWeight: 1, PodCountWeight: 1, ServiceEdgesWeight: 1},
+		Affinity: config.AffinityConfig{TopPaths: 1, MinAffinityWeight: 50, MaxAffinityWeight: 100},
+	}
+	deploy := func(name string) appsv1.Deployment {
+		lbls := map[string]string{"io.kompose.service": name}
+		d := appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "test-ns", Labels: lbls}}
+		d.Spec.Template.Labels = lbls
+		return d
+	}
+	fk := &fakeKube{deploys: []appsv1.Deployment{deploy("a"), deploy("b")}}
+	ctrl := controller.New(cfg, fk, &fakeProm{})
+	ctrl.EnableDryRunForTest()
+	if err := ctrl.ReconcileOnceForTest(context.Background()); err != nil {
+		t.Fatalf("reconcile error: %v", err)
+	}
+	if fk.updated != 0 {
+		t.Fatalf("dry-run updated %d deployments", fk.updated)
+	}
+
+	get := func(url string) (int, string, string) {
+		rec := httptest.NewRecorder()
+		ctrl.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, url, nil))
+		return rec.Code, rec.Header().Get("Content-Type"), rec.Body.String()
+	}
+	code, ct, body := get("/affinity/preview?service=b")
+	if code != http.StatusOK || ct != "application/yaml" {
+		t.Fatalf("preview b: %d %s %s", code, ct, body)
+	}
+	for _, want := range []string{"podAffinity:", "preferredDuringSchedulingIgnoredDuringExecution:", "io.kompose.service: a", "topologyKey: kubernetes.io/hostname"} {
+		if !strings.Contains(body, want) {
+			t.Fatalf("preview of b lacks %q:\n%s", want, body)
+		}
+	}
+	if code, _, body := get("/affinity/preview"); code != http.StatusOK || !strings.Contains(body, `"services":["a","b"]`) {
+		t.Fatalf("preview index: %d %s", code, body)
+	}
+	if code, _, _ := get("/affinity/preview?service=nope"); code != http.StatusNotFound {
+		t.Fatalf("unknown service: got %d, want 404", code)
+	}
+}
+
+func TestSelectorCheck_ReportsUnmatchedSelectors(t *testing.T) {
+	cfg := &config.Config{
+		NamespaceSelector: []string{"test-ns"},
+		Graph: config.ServiceGraphConfig{
+			Entry:    "a",
+			Services: []config.ServiceNode{{Name: "a", DependsOn: []string{"b"}}, {Name: "b"}},
+		},
+		Scoring:  config.ScoringWeights{PathLengthWeight: 1, PodCountWeight: 1, ServiceEdgesWeight: 1},
+		Affinity: config.AffinityConfig{TopPaths: 1, MinAffinityWeight: 50, MaxAffinityWeight: 100},
+	}
+	deploy := func(name string) appsv1.Deployment {
+		lbls := map[string]string{"io.kompose.service": name}
+		d := appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "test-ns", Labels: lbls}}
+		d.Spec.Template.Labels = lbls
+		return d
+	}
+	pod := corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Name: "a-1", Namespace: "test-ns", Labels: map[string]string{"io.kompose.service": "a"},
+	}}
+	pod.Status.Phase = corev1.PodRunning
+	fk := &fakeKube{deploys: []appsv1.Deployment{deploy("a"), deploy("b")}, pods: []corev1.Pod{pod}}
+	ctrl := controller.New(cfg, fk, &fakeProm{})
+	ctrl.EnableDryRunForTest()
+	if err := ctrl.ReconcileOnceForTest(context.Background()); err != nil {
+		t.Fatalf("reconcile error: %v", err)
+	}
+	if sc := ctrl.SelectorCheck(); sc.Checked == 0 || len(sc.Unmatched) != 0 {
+		t.Fatalf("running pod of a: got %+v, want checked selectors and none unmatched", sc)
+	}
+
+	fk.pods[0].Status.Phase = corev1.PodPending
+	if err := ctrl.ReconcileOnceForTest(context.Background()); err != nil {
+		t.Fatalf("reconcile error: %v", err)
+	}
+	sc := ctrl.SelectorCheck()
+	if len(sc.Unmatched) != 1 || sc.Unmatched[0].Service != "b" ||
+		sc.Unmatched[0].Selector["io.kompose.service"] != "a" {
+		t.Fatalf("pending pod of a: got %+v, want b's selector of a unmatched", sc.Unmatched)
+	}
+
+	rec := httptest.NewRecorder()
+	ctrl.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/selectors", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"service":"b"`) {
+		t.Fatalf("GET /selectors: %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestEffectiveness_CrossNodeTrafficPerEpoch(t *testing.T) {
+	cfg := &config.Config{
+		NamespaceSelector: []string{"test-ns"},
+		Graph: config.ServiceGraphConfig{
+			Entry:    "a",
+			Services: []config.ServiceNode{{Name: "a", DependsOn: []string{"b"}}, {Name: "b"}},
+		},
+		Prometheus: config.PrometheusConfig{ServicePairBytesQuery: "bytes"},
+		Scoring:    config.ScoringWeights{PathLengthWeight: 1, PodCountWeight: 1, ServiceEdgesWeight: 1},
+		Affinity:   config.AffinityConfig{TopPaths: 1, MinAffinityWeight: 50, MaxAffinityWeight: 100},
+	}
+	deploy := func(name string) appsv1.Deployment {
+		lbls := map[string]string{"io.kompose.service": name}
+		d := appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "test-ns", Labels: lbls}}
+		d.Spec.Template.Labels = lbls
+		return d
+	}
+	pod := func(svc, node, zone string) corev1.Pod {
+		p := corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Name: svc + "-1", Namespace: "test-ns",
+			Labels: map[string]string{"io.kompose.service": svc, "topology.kubernetes.io/zone": zone},
+		}}
+		p.Spec.NodeName = node
+		p.Status.Phase = corev1.PodRunning
+		return p
+	}
+	fk := &fakeKube{
+		deploys: []appsv1.Deployment{deploy("a"), deploy("b")},
+		pods:    []corev1.Pod{pod("a", "n1", "z1"), pod("b", "n2", "z1")},
+	}
+	fp := &fakeProm{bps: map[promc.ServicePair]float64{{Src: "a", Dst: "b"}: 1000}}
+	ctrl := controller.New(cfg, fk, fp)
+	ctrl.EnableDryRunForTest()
+	if err := ctrl.ReconcileOnceForTest(context.Background()); err != nil {
+		t.Fatalf("reconcile error: %v", err)
+	}
+
+	// The rescheduled b now shares a's node.
+	fk.pods[1] = pod("b", "n1", "z1")
+	if err := ctrl.ReconcileOnceForTest(context.Background()); err != nil {
+		t.Fatalf("reconcile error: %v", err)
+	}
+
+	eff := ctrl.Effectiveness()
+	if len(eff.Samples) != 2 {
+		t.Fatalf("got %d samples, want 2", len(eff.Samples))
+	}
+	s0, s1 := eff.Samples[0], eff.Samples[1]
+	if s0.Epoch != 0 || s0.CrossNodeFraction != 1 || s0.BytesPerSec != 1000 || s0.CrossZoneFraction == nil || *s0.CrossZoneFraction != 0 {
+		t.Fatalf("first sample: %+v, want epoch 0 with all traffic crossing nodes within one zone", s0)
+	}
+	if s1.Epoch != 1 || s1.CrossNodeFraction != 0 {
+		t.Fatalf("second sample: %+v, want epoch 1 with no cross-node traffic", s1)
+	}
+	if len(eff.Epochs) != 2 || eff.CrossNodeChange == nil || *eff.CrossNodeChange != -1 {
+		t.Fatalf("epochs %+v change %v, want 2 epochs and a change of -1", eff.Epochs, eff.CrossNodeChange)
+	}
+
+	rec := httptest.NewRecorder()
+	ctrl.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/effectiveness", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"crossNodeChange":-1`) {
+		t.Fatalf("GET /effectiveness: %d %s", rec.Code, rec.Body.String())
+	}
+}
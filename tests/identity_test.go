@@ -0,0 +1,137 @@
+package tests
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"lead-net-affinity/pkg/config"
+	"lead-net-affinity/pkg/controller"
+	"lead-net-affinity/pkg/graph"
+	"lead-net-affinity/pkg/kube"
+)
+
+func TestServiceIdentity_KeysAndSelectors(t *testing.T) {
+	id := kube.NewServiceIdentity(
+		[]string{"app.kubernetes.io/name", "app"},
+		map[string]map[string]string{"db": {"tier": "database"}},
+	)
+	cases := []struct {
+		labels map[string]string
+		want   graph.NodeID
+	}{
+		{map[string]string{"app.kubernetes.io/name": "cart", "app": "legacy"}, "cart"},
+		{map[string]string{"app": "legacy"}, "legacy"},
+		{map[string]string{"tier": "database", "app": "postgres"}, "db"},
+		{map[string]string{"io.kompose.service": "cart"}, ""},
+	}
+	for _, tc := range cases {
+		if got := id.ServiceOf(tc.labels); got != tc.want {
+			t.Fatalf("ServiceOf(%v) = %q, want %q", tc.labels, got, tc.want)
+		}
+	}
+	var def *kube.ServiceIdentity
+	if got := def.ServiceOf(map[string]string{"io.kompose.service": "cart"}); got != "cart" {
+		t.Fatalf("nil identity should use io.kompose.service, got %q", got)
+	}
+
+	pod := func(name string, lbls map[string]string) corev1.Pod {
+		return corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "ns", Labels: lbls}}
+	}
+	fk := &fakeKube{pods: []corev1.Pod{
+		pod("cart-1", map[string]string{"app.kubernetes.io/name": "cart"}),
+		pod("cart-2", map[string]string{"app": "cart"}),
+		pod("other", map[string]string{"app.kubernetes.io/name": "search", "app": "cart"}),
+		pod("pg-0", map[string]string{"tier": "database"}),
+	}}
+	got, err := id.ListServicePods(context.Background(), fk, "ns", "cart")
+	if err != nil || len(got) != 2 || got[0].Name != "cart-1" || got[1].Name != "cart-2" {
+		t.Fatalf("expected cart-1 and cart-2, got %v (err %v)", got, err)
+	}
+	if got, _ := id.ListServicePods(context.Background(), fk, "ns", "db"); len(got) != 1 || got[0].Name != "pg-0" {
+		t.Fatalf("expected pg-0 by selector, got %v", got)
+	}
+}
+
+func TestController_NonKomposeLabels(t *testing.T) {
+	cfg := &config.Config{
+		NamespaceSelector: []string{"test-ns"},
+		ServiceLabelKeys:  []string{"app.kubernetes.io/name"},
+		Graph: config.ServiceGraphConfig{
+			Entry: "a",
+			Services: []config.ServiceNode{
+				{Name: "a", DependsOn: []string{"b"}},
+				{Name: "b", LabelSelector: map[string]string{"role": "backend"}},
+			},
+		},
+		Scoring:  config.ScoringWeights{PathLengthWeight: 1, PodCountWeight: 1, ServiceEdgesWeight: 1},
+		Affinity: config.AffinityConfig{TopPaths: 1, MinAffinityWeight: 50, MaxAffinityWeight: 100},
+	}
+	deploy := func(name string, lbls map[string]string) appsv1.Deployment {
+		return appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "test-ns"},
+			Spec: appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{ObjectMeta: metav1.ObjectMeta{Labels: lbls}}}}
+	}
+	fk := &fakeKube{deploys: []appsv1.Deployment{
+		deploy("a", map[string]string{"app.kubernetes.io/name": "a"}),
+		deploy("b-server", map[string]string{"role": "backend"}),
+	}}
+
+	ctrl := controller.New(cfg, fk, &fakeProm{})
+	if err := ctrl.ReconcileOnceForTest(context.Background()); err != nil {
+		t.Fatalf("reconcile error: %v", err)
+	}
+	if fk.updated != 2 {
+		t.Fatalf("expected both services to be mapped and updated, got %d updates", fk.updated)
+	}
+	aff := fk.deploys[1].Spec.Template.Spec.Affinity
+	if aff == nil || aff.PodAffinity == nil {
+		t.Fatalf("expected pod affinity on b-server toward a, got %+v", aff)
+	}
+}
+
+func TestServiceIdentity_PodSelector(t *testing.T) {
+	id := kube.NewServiceIdentity(
+		[]string{"app.kubernetes.io/name", "app"},
+		map[string]map[string]string{"db": {"tier": "database"}},
+	)
+	tmpl := map[string]string{"app": "cart", "app.kubernetes.io/version": "1.2.0", "track": "canary"}
+	if got := id.PodSelector("cart", tmpl); !reflect.DeepEqual(got, map[string]string{"app": "cart"}) {
+		t.Fatalf("PodSelector(cart) = %v", got)
+	}
+	if got := id.PodSelector("db", map[string]string{"tier": "database", "app": "postgres"}); !reflect.DeepEqual(got, map[string]string{"tier": "database"}) {
+		t.Fatalf("PodSelector(db) = %v", got)
+	}
+	// No identifying label: fall back to the whole template.
+	if got := id.PodSelector("x", map[string]string{"run": "x"}); !reflect.DeepEqual(got, map[string]string{"run": "x"}) {
+		t.Fatalf("PodSelector(x) = %v", got)
+	}
+}
+
+func TestController_AffinitySelectsServiceLabelsOnly(t *testing.T) {
+	cfg := &config.Config{
+		NamespaceSelector: []string{"test-ns"},
+		Graph: config.ServiceGraphConfig{
+			Entry:    "a",
+			Services: []config.ServiceNode{{Name: "a", DependsOn: []string{"b"}}, {Name: "b"}},
+		},
+		Scoring:  config.ScoringWeights{PathLengthWeight: 1, PodCountWeight: 1, ServiceEdgesWeight: 1},
+		Affinity: config.AffinityConfig{TopPaths: 1, MinAffinityWeight: 50, MaxAffinityWeight: 100},
+	}
+	deploy := func(name string) appsv1.Deployment {
+		lbls := map[string]string{"io.kompose.service": name, "app.kubernetes.io/version": "1.0.0"}
+		return appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "test-ns", Labels: lbls},
+			Spec: appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{ObjectMeta: metav1.ObjectMeta{Labels: lbls}}}}
+	}
+	fk := &fakeKube{deploys: []appsv1.Deployment{deploy("a"), deploy("b")}}
+	if err := controller.New(cfg, fk, &fakeProm{}).ReconcileOnceForTest(context.Background()); err != nil {
+		t.Fatalf("reconcile error: %v", err)
+	}
+	terms := fk.deploys[1].Spec.Template.Spec.Affinity.PodAffinity.PreferredDuringSchedulingIgnoredDuringExecution
+	if len(terms) != 1 || !reflect.DeepEqual(terms[0].PodAffinityTerm.LabelSelector.MatchLabels, map[string]string{"io.kompose.service": "a"}) {
+		t.Fatalf("expected a selector on the service label only, got %+v", terms)
+	}
+}
@@ -0,0 +1,100 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"lead-net-affinity/pkg/config"
+	"lead-net-affinity/pkg/controller"
+	promc "lead-net-affinity/pkg/prometheus"
+)
+
+func TestController_InjectedMetrics(t *testing.T) {
+	cfg := &config.Config{
+		NamespaceSelector: []string{"test-ns"},
+		Graph: config.ServiceGraphConfig{
+			Entry:    "a",
+			Services: []config.ServiceNode{{Name: "a", DependsOn: []string{"b"}}, {Name: "b"}},
+		},
+		Scoring:     config.ScoringWeights{BadLatencyMs: 10, BadDropRate: 1},
+		Rebalancing: config.RebalancingConfig{BadNodeMode: config.BadNodeTaint},
+		Server:      config.ServerConfig{Debug: config.DebugConfig{Enabled: true, Token: "s3cret", Inject: true}},
+	}
+	tk := &taintKube{fakeKube: &fakeKube{nodes: []corev1.Node{
+		{ObjectMeta: metav1.ObjectMeta{Name: "fine"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "quiet"}},
+	}}}
+	prom := &matrixProm{
+		fakeProm: fakeProm{lat: map[promc.ServicePair]float64{{Src: "a", Dst: "b"}: 2}},
+		nm:       &promc.NetworkMatrix{Nodes: map[string]*promc.NodeMetrics{"fine": {NodeID: "fine", AvgLatencyMs: 1}}},
+	}
+	cfg.Prometheus.ServicePairLatencyQuery = "lat"
+	ctrl := controller.New(cfg, tk, prom)
+	ts := httptest.NewServer(ctrl.Handler())
+	defer ts.Close()
+
+	post := func(token, body string) int {
+		req, _ := http.NewRequest(http.MethodPost, ts.URL+"/inject", strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("POST /inject: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if code := post("", `{"nodes":[{"node":"fine","dropRate":5}]}`); code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without the token, got %d", code)
+	}
+	if code := post("s3cret", `{"edges":[{"dst":"b","latencyMs":-1}]}`); code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a negative latency, got %d", code)
+	}
+	// fine drops packets; quiet, unknown to Prometheus, is slow.
+	if code := post("s3cret", `{"nodes":[{"node":"fine","dropRate":5},{"node":"quiet","latencyMs":50}],"edges":[{"dst":"b","latencyMs":80}]}`); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+
+	if err := ctrl.ReconcileOnceForTest(context.Background()); err != nil {
+		t.Fatalf("reconcile error: %v", err)
+	}
+	sort.Strings(tk.calls)
+	if strings.Join(tk.calls, ",") != "fine=true,quiet=true" {
+		t.Fatalf("expected both injected nodes tainted, got %v", tk.calls)
+	}
+	q := ctrl.DataQuality()
+	if len(q.Edges) != 1 || q.Edges[0].LatencyMs == nil || *q.Edges[0].LatencyMs != 80 || q.Edges[0].Confidence != promc.ConfidenceInjected {
+		t.Fatalf("expected the injected a -> b latency, got %+v", q.Edges)
+	}
+
+	ctrl.ClearInjections()
+	tk.calls = nil
+	if err := ctrl.ReconcileOnceForTest(context.Background()); err != nil {
+		t.Fatalf("reconcile error: %v", err)
+	}
+	if q := ctrl.DataQuality(); *q.Edges[0].LatencyMs != 2 || q.Edges[0].Confidence != promc.ConfidenceMeasured {
+		t.Fatalf("expected the measured latency after clearing, got %+v", q.Edges)
+	}
+}
+
+func TestController_InjectEndpointNeedsConfig(t *testing.T) {
+	ctrl := controller.New(&config.Config{Graph: config.ServiceGraphConfig{Entry: "a"}}, &fakeKube{}, &fakeProm{})
+	ts := httptest.NewServer(ctrl.Handler())
+	defer ts.Close()
+	resp, err := http.Get(ts.URL + "/inject")
+	if err != nil {
+		t.Fatalf("GET /inject: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected /inject to be absent without server.debug.inject, got %d", resp.StatusCode)
+	}
+}
@@ -1,12 +1,29 @@
 package tests
 
 import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	appsv1 "k8s.io/api/apps/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+	k8stesting "k8s.io/client-go/testing"
 
 	"lead-net-affinity/pkg/kube"
+	"lead-net-affinity/pkg/metrics"
+	"lead-net-affinity/pkg/rbac"
+	"lead-net-affinity/pkg/rulegen"
 )
 
 func TestMapDeploymentsByService(t *testing.T) {
@@ -23,7 +40,7 @@ func TestMapDeploymentsByService(t *testing.T) {
 		},
 	}
 
-	m := kube.MapDeploymentsByService(deploys)
+	m := kube.MapDeploymentsByService(deploys, nil)
 	if len(m) != 2 {
 		t.Fatalf("expected 2 mapped services, got %d", len(m))
 	}
@@ -31,3 +48,364 @@ func TestMapDeploymentsByService(t *testing.T) {
 		t.Fatalf("missing frontend")
 	}
 }
+
+func TestKubeOptions_ApplyRateLimits(t *testing.T) {
+	cfg := &rest.Config{QPS: 5, Burst: 10}
+	kube.Options{}.Apply(cfg)
+	if cfg.QPS != 5 || cfg.Burst != 10 {
+		t.Fatalf("zero options must keep defaults, got qps=%v burst=%d", cfg.QPS, cfg.Burst)
+	}
+
+	kube.Options{QPS: 50, Burst: 100}.Apply(cfg)
+	if cfg.QPS != 50 || cfg.Burst != 100 {
+		t.Fatalf("expected qps=50 burst=100, got qps=%v burst=%d", cfg.QPS, cfg.Burst)
+	}
+}
+
+func TestPlacementIndex_BuildAndFingerprint(t *testing.T) {
+	fk := &fakeKube{
+		pods: []corev1.Pod{
+			{ObjectMeta: metav1.ObjectMeta{Name: "geo-1", Namespace: "ns", Labels: map[string]string{"io.kompose.service": "geo"}}, Spec: corev1.PodSpec{NodeName: "n1"}},
+			{ObjectMeta: metav1.ObjectMeta{Name: "geo-2", Namespace: "ns", Labels: map[string]string{"io.kompose.service": "geo"}}, Spec: corev1.PodSpec{NodeName: "n2"}},
+			{ObjectMeta: metav1.ObjectMeta{Name: "pending", Namespace: "ns", Labels: map[string]string{"io.kompose.service": "rate"}}},
+		},
+	}
+
+	idx := kube.BuildPlacementIndex(context.Background(), fk, nil, []string{"ns"}, nil)
+	if got := idx.NodesForService("geo"); len(got) != 2 || got["n1"] != 1 || got["n2"] != 1 {
+		t.Fatalf("unexpected nodes for geo: %v", got)
+	}
+	if got := idx.NodesForService("rate"); len(got) != 0 {
+		t.Fatalf("unscheduled pods must not be indexed, got %v", got)
+	}
+
+	before := idx.Fingerprint()
+	fk.pods[1].Spec.NodeName = "n1"
+	after := kube.BuildPlacementIndex(context.Background(), fk, nil, []string{"ns"}, nil).Fingerprint()
+	if before == after {
+		t.Fatalf("expected fingerprint to change when a pod moves")
+	}
+}
+
+func TestKubeClient_RetriesTransientErrors(t *testing.T) {
+	cs := fake.NewClientset(&appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "geo", Namespace: "ns"},
+	})
+	failures := 2
+	cs.PrependReactor("list", "deployments", func(k8stesting.Action) (bool, runtime.Object, error) {
+		if failures > 0 {
+			failures--
+			return true, nil, apierrors.NewTooManyRequests("slow down", 0)
+		}
+		return false, nil, nil
+	})
+
+	c := kube.NewForClientset(cs)
+	c.SetRetryBackoff(wait.Backoff{Duration: time.Millisecond, Factor: 1, Steps: 5})
+
+	before := metrics.Default.Value("lead_net_kube_retries_total", map[string]string{"op": "list_deployments"})
+	got, err := c.ListDeployments(context.Background(), []string{"ns"})
+	if err != nil {
+		t.Fatalf("expected retries to succeed, got %v", err)
+	}
+	if len(got) != 1 {
+		t.Fatalf("expected 1 deployment, got %d", len(got))
+	}
+	after := metrics.Default.Value("lead_net_kube_retries_total", map[string]string{"op": "list_deployments"})
+	if after-before != 2 {
+		t.Fatalf("expected 2 retries recorded, got %v", after-before)
+	}
+
+	// Non-transient errors are returned immediately.
+	cs.PrependReactor("get", "nodes", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewForbidden(corev1.Resource("nodes"), "n1", nil)
+	})
+	if _, err := c.GetNode(context.Background(), "n1"); !apierrors.IsForbidden(err) {
+		t.Fatalf("expected forbidden error, got %v", err)
+	}
+}
+
+func TestKubeClient_UpdateDeployment_ReappliesOnConflict(t *testing.T) {
+	one, five := int32(1), int32(5)
+	cs := fake.NewClientset(&appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "geo", Namespace: "ns"},
+		Spec:       appsv1.DeploymentSpec{Replicas: &five}, // HPA already scaled it
+	})
+	conflicts := 1
+	cs.PrependReactor("update", "deployments", func(k8stesting.Action) (bool, runtime.Object, error) {
+		if conflicts > 0 {
+			conflicts--
+			return true, nil, apierrors.NewConflict(appsv1.Resource("deployments"), "geo", nil)
+		}
+		return false, nil, nil
+	})
+
+	// Our (stale) copy still says 1 replica but carries the new affinity.
+	stale := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "geo", Namespace: "ns"},
+		Spec:       appsv1.DeploymentSpec{Replicas: &one},
+	}
+	stale.Spec.Template.Spec.Affinity = &corev1.Affinity{PodAffinity: &corev1.PodAffinity{}}
+
+	c := kube.NewForClientset(cs)
+	if err := c.UpdateDeployment(context.Background(), stale); err != nil {
+		t.Fatalf("UpdateDeployment: %v", err)
+	}
+
+	got, err := cs.AppsV1().Deployments("ns").Get(context.Background(), "geo", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if got.Spec.Template.Spec.Affinity == nil || got.Spec.Template.Spec.Affinity.PodAffinity == nil {
+		t.Fatalf("expected affinity to be applied after conflict")
+	}
+	if *got.Spec.Replicas != 5 {
+		t.Fatalf("expected replicas owned by HPA (5) to be preserved, got %d", *got.Spec.Replicas)
+	}
+}
+
+func TestKubeClient_UpdateDeployment_KeepsOwnershipOnConflict(t *testing.T) {
+	cs := fake.NewClientset(&appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "geo", Namespace: "ns", Annotations: map[string]string{"team": "maps"}},
+	})
+	conflicts := 1
+	cs.PrependReactor("update", "deployments", func(k8stesting.Action) (bool, runtime.Object, error) {
+		if conflicts > 0 {
+			conflicts--
+			return true, nil, apierrors.NewConflict(appsv1.Resource("deployments"), "geo", nil)
+		}
+		return false, nil, nil
+	})
+
+	stale := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "geo", Namespace: "ns", Annotations: map[string]string{
+		kube.ManagedAnnotation:      "true",
+		kube.ManagerAnnotation:      "lead-net-affinity",
+		kube.LastDecisionAnnotation: "abc123",
+		kube.LastUpdateAnnotation:   "2026-01-02T03:04:05Z",
+	}}}
+	stale.Spec.Template.Spec.Affinity = &corev1.Affinity{PodAffinity: &corev1.PodAffinity{}}
+	if err := kube.NewForClientset(cs).UpdateDeployment(context.Background(), stale); err != nil {
+		t.Fatalf("UpdateDeployment: %v", err)
+	}
+
+	got, err := cs.AppsV1().Deployments("ns").Get(context.Background(), "geo", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	for k, v := range stale.Annotations {
+		if got.Annotations[k] != v {
+			t.Fatalf("annotation %s = %q after the conflict retry, want %q", k, got.Annotations[k], v)
+		}
+	}
+	if got.Annotations["team"] != "maps" {
+		t.Fatalf("annotation owned by someone else lost: %v", got.Annotations)
+	}
+}
+
+func TestKubeClient_UpdateDeployment_KeepsDecisionOnConflict(t *testing.T) {
+	latest := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "geo", Namespace: "ns"}}
+	latest.Spec.Template.Annotations = map[string]string{"kubectl.kubernetes.io/restartedAt": "2026-01-01T00:00:00Z"}
+	cs := fake.NewClientset(latest)
+	conflicts := 1
+	cs.PrependReactor("update", "deployments", func(k8stesting.Action) (bool, runtime.Object, error) {
+		if conflicts > 0 {
+			conflicts--
+			return true, nil, apierrors.NewConflict(appsv1.Resource("deployments"), "geo", nil)
+		}
+		return false, nil, nil
+	})
+
+	stale := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "geo", Namespace: "ns"}}
+	stale.Spec.Template.Annotations = map[string]string{kube.DecisionAnnotation: "abc123"}
+	if err := kube.NewForClientset(cs).UpdateDeployment(context.Background(), stale); err != nil {
+		t.Fatalf("UpdateDeployment: %v", err)
+	}
+
+	got, err := cs.AppsV1().Deployments("ns").Get(context.Background(), "geo", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	a := got.Spec.Template.Annotations
+	if a[kube.DecisionAnnotation] != "abc123" || a["kubectl.kubernetes.io/restartedAt"] == "" {
+		t.Fatalf("expected the decision stamped next to the restart annotation, got %v", a)
+	}
+}
+
+func TestKubeClient_UpdateDeployment_KeepsGuaranteedResourcesOnConflict(t *testing.T) {
+	container := func() corev1.Container {
+		return corev1.Container{Name: "app", Resources: corev1.ResourceRequirements{Requests: corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse("500m"),
+			corev1.ResourceMemory: resource.MustParse("1Gi"),
+		}}}
+	}
+	latest := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "geo", Namespace: "ns"}}
+	latest.Spec.Template.Spec.Containers = []corev1.Container{container()}
+	cs := fake.NewClientset(latest)
+	conflicts := 1
+	cs.PrependReactor("update", "deployments", func(k8stesting.Action) (bool, runtime.Object, error) {
+		if conflicts > 0 {
+			conflicts--
+			return true, nil, apierrors.NewConflict(appsv1.Resource("deployments"), "geo", nil)
+		}
+		return false, nil, nil
+	})
+
+	stale := latest.DeepCopy()
+	rulegen.ApplyLatencyCritical(stale, "")
+	if err := kube.NewForClientset(cs).UpdateDeployment(context.Background(), stale); err != nil {
+		t.Fatalf("UpdateDeployment: %v", err)
+	}
+
+	got, err := cs.AppsV1().Deployments("ns").Get(context.Background(), "geo", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	r := got.Spec.Template.Spec.Containers[0].Resources
+	if got.Annotations[kube.GuaranteedCPUsAnnotation] != "true" ||
+		r.Limits.Cpu().String() != "1" || r.Requests.Cpu().String() != "1" || r.Limits.Memory().String() != "1Gi" {
+		t.Fatalf("Guaranteed whole-CPU resources lost on the conflict retry: %v %v", got.Annotations, r)
+	}
+}
+
+func TestKubeClient_DetectCapabilities(t *testing.T) {
+	cs := fake.NewClientset()
+	cs.PrependReactor("create", "selfsubjectaccessreviews", func(a k8stesting.Action) (bool, runtime.Object, error) {
+		review := a.(k8stesting.CreateAction).GetObject().(*authorizationv1.SelfSubjectAccessReview)
+		attrs := review.Spec.ResourceAttributes
+		// Namespace-only service account: no node access, no pod deletes.
+		review.Status.Allowed = attrs.Resource != "nodes" && !(attrs.Resource == "pods" && attrs.Verb == "delete")
+		return true, review, nil
+	})
+
+	caps := kube.NewForClientset(cs).DetectCapabilities(context.Background(), []string{"a", "b"})
+	for _, f := range []rbac.Feature{rbac.FeatureCore, rbac.FeatureApplyAffinity, rbac.FeatureStatus} {
+		if !caps.Has(f) {
+			t.Fatalf("expected feature %q allowed", f)
+		}
+	}
+	if caps.Has(rbac.FeatureNodes) || caps.Has(rbac.FeatureRebalance) {
+		t.Fatalf("expected nodes and rebalance disabled, got %v", caps)
+	}
+}
+
+func TestKubeClient_NamespaceScopedMode(t *testing.T) {
+	cs := fake.NewClientset(
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "n1", Labels: map[string]string{"topology.kubernetes.io/zone": "z-node"}}},
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "a-1", Namespace: "ns",
+				Labels:      map[string]string{"io.kompose.service": "a"},
+				Annotations: map[string]string{kube.ZoneAnnotation: "z-pod"},
+			},
+			Spec: corev1.PodSpec{NodeName: "n1"},
+		},
+	)
+	c := kube.NewForClientset(cs)
+	c.DisableNodeAccess()
+
+	if _, err := c.GetNode(context.Background(), "n1"); err != kube.ErrNodeAccessDisabled {
+		t.Fatalf("expected ErrNodeAccessDisabled, got %v", err)
+	}
+	if caps := c.DetectCapabilities(context.Background(), []string{"ns"}); caps.Has(rbac.FeatureNodes) {
+		t.Fatalf("nodes feature must be unavailable in namespace-scoped mode")
+	}
+
+	idx := kube.BuildPlacementIndex(context.Background(), c, nil, []string{"ns"}, nil)
+	if z := idx.ZoneForNode("n1"); z != "z-pod" {
+		t.Fatalf("expected zone from pod annotation, got %q", z)
+	}
+}
+
+func TestKubeClient_WatchChanges_NotifiesOnSpecAndReadyLoss(t *testing.T) {
+	two := int32(2)
+	d := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "a", Namespace: "ns", Labels: map[string]string{"io.kompose.service": "a"}},
+		Spec:       appsv1.DeploymentSpec{Replicas: &two},
+		Status:     appsv1.DeploymentStatus{ReadyReplicas: 2},
+	}
+	cs := fake.NewClientset(d)
+	c := kube.NewForClientset(cs)
+	c.DisableNodeAccess()
+
+	reasons := make(chan string, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	err := c.WatchChanges(ctx, []string{"ns"}, kube.NewServiceIdentity(nil, nil),
+		func(string) bool { return true }, func(r string) { reasons <- r }, nil)
+	if err != nil {
+		t.Fatalf("WatchChanges: %v", err)
+	}
+
+	deploys := cs.AppsV1().Deployments("ns")
+	update := func(mutate func(*appsv1.Deployment)) {
+		t.Helper()
+		cur, err := deploys.Get(ctx, "a", metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		mutate(cur)
+		if _, err := deploys.Update(ctx, cur, metav1.UpdateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Events arrive in order, so the first reason after each step shows
+	// that the updates before it did not notify.
+	expect := func(want string) {
+		t.Helper()
+		select {
+		case r := <-reasons:
+			if !strings.Contains(r, want) {
+				t.Fatalf("expected a %q notification, got %q", want, r)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no %q notification", want)
+		}
+	}
+
+	update(func(d *appsv1.Deployment) { d.Status.ReadyReplicas = 1 })
+	update(func(d *appsv1.Deployment) {
+		d.Annotations = map[string]string{kube.LastUpdateAnnotation: "2026-01-01T00:00:00Z"}
+		d.Spec.Template.Annotations = map[string]string{kube.DecisionAnnotation: "d1"}
+	})
+	update(func(d *appsv1.Deployment) { three := int32(3); d.Spec.Replicas = &three })
+	expect("replicas changed for deployment ns/a (2 -> 3)")
+
+	update(func(d *appsv1.Deployment) { d.Spec.Template.Labels = map[string]string{"v": "2"} })
+	expect("pod template changed")
+
+	update(func(d *appsv1.Deployment) { d.Status.ReadyReplicas = 0 })
+	expect("no ready replicas")
+}
+
+func TestKubeNew_SelectsKubeconfigContext(t *testing.T) {
+	kubeconfig := filepath.Join(t.TempDir(), "config")
+	err := os.WriteFile(kubeconfig, []byte(`apiVersion: v1
+kind: Config
+clusters:
+- name: staging
+  cluster: {server: "https://staging.example:6443"}
+- name: prod
+  cluster: {server: "https://prod.example:6443"}
+users:
+- name: me
+  user: {token: abc}
+contexts:
+- name: staging
+  context: {cluster: staging, user: me}
+- name: prod
+  context: {cluster: prod, user: me}
+current-context: staging
+`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"", "staging", "prod"} {
+		if _, err := kube.New(kube.Options{Kubeconfig: kubeconfig, Context: name}); err != nil {
+			t.Fatalf("context %q: unexpected error: %v", name, err)
+		}
+	}
+	if _, err := kube.New(kube.Options{Kubeconfig: kubeconfig, Context: "missing"}); err == nil {
+		t.Fatalf("expected an error for an unknown context")
+	}
+}
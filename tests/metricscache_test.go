@@ -0,0 +1,184 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"lead-net-affinity/pkg/config"
+	"lead-net-affinity/pkg/controller"
+	"lead-net-affinity/pkg/metrics"
+	promc "lead-net-affinity/pkg/prometheus"
+)
+
+func metricsCacheConfig() *config.Config {
+	return &config.Config{
+		NamespaceSelector: []string{"test-ns"},
+		Graph: config.ServiceGraphConfig{
+			Entry:    "a",
+			Services: []config.ServiceNode{{Name: "a", DependsOn: []string{"b"}}, {Name: "b"}},
+		},
+		Prometheus: config.PrometheusConfig{ServicePairLatencyQuery: "lat"},
+	}
+}
+
+func TestController_MetricsCacheSurvivesRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache", "metrics.json")
+	ab := promc.ServicePair{Src: "a", Dst: "b"}
+
+	first := controller.New(metricsCacheConfig(), &fakeKube{}, &fakeProm{lat: map[promc.ServicePair]float64{ab: 7}})
+	first.EnableDryRunForTest()
+	first.SetMetricsCache(&controller.FileMetricsCache{Path: path})
+	if err := first.ReconcileOnceForTest(context.Background()); err != nil {
+		t.Fatalf("reconcile error: %v", err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("expected metrics cache to be saved: %v", err)
+	}
+	restart := time.Now()
+
+	// After a restart the latency query returns nothing yet.
+	second := controller.New(metricsCacheConfig(), &fakeKube{}, &fakeProm{})
+	second.EnableDryRunForTest()
+	second.SetMetricsCache(&controller.FileMetricsCache{Path: path})
+	if err := second.ReconcileOnceForTest(context.Background()); err != nil {
+		t.Fatalf("reconcile error: %v", err)
+	}
+	e := second.DataQuality().Edges[0]
+	if e.Confidence != promc.ConfidenceMeasured || e.LatencyMs == nil || *e.LatencyMs != 7 {
+		t.Fatalf("expected cached a -> b latency, got %+v", e)
+	}
+	if e.ObservedAt.IsZero() || !e.ObservedAt.Before(restart) {
+		t.Fatalf("restored value must keep its observation time from before the restart, got %v", e.ObservedAt)
+	}
+}
+
+func TestController_MetricsCacheDropsOldValues(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.json")
+	old := time.Now().Add(-2 * time.Hour).UTC().Format(time.RFC3339)
+	snap := `{"savedAt":"` + old + `","latency":[{"src":"a","dst":"b","value":7,"observedAt":"` + old + `"}]}`
+	if err := os.WriteFile(path, []byte(snap), 0644); err != nil {
+		t.Fatalf("write cache: %v", err)
+	}
+
+	cfg := metricsCacheConfig()
+	cfg.MetricsCache.MaxAgeSeconds = 3600
+	ctrl := controller.New(cfg, &fakeKube{}, &fakeProm{})
+	ctrl.EnableDryRunForTest()
+	ctrl.SetMetricsCache(&controller.FileMetricsCache{Path: path})
+	if err := ctrl.ReconcileOnceForTest(context.Background()); err != nil {
+		t.Fatalf("reconcile error: %v", err)
+	}
+	if e := ctrl.DataQuality().Edges[0]; e.Confidence != promc.ConfidenceDefault {
+		t.Fatalf("expected value older than maxAgeSeconds to be dropped, got %+v", e)
+	}
+}
+
+func TestController_CachesAreBounded(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.json")
+	at := func(d time.Duration) string { return time.Now().Add(-d).UTC().Format(time.RFC3339) }
+	snap := `{"savedAt":"` + at(0) + `","nodes":{` +
+		`"n1":{"avgLatencyMs":1,"observedAt":"` + at(30*time.Minute) + `"},` +
+		`"n2":{"avgLatencyMs":2,"observedAt":"` + at(20*time.Minute) + `"},` +
+		`"10.0.0.3":{"avgLatencyMs":3,"observedAt":"` + at(10*time.Minute) + `"}}}`
+	if err := os.WriteFile(path, []byte(snap), 0644); err != nil {
+		t.Fatalf("write cache: %v", err)
+	}
+
+	cfg := metricsCacheConfig()
+	cfg.Graph.Services = []config.ServiceNode{{Name: "a", DependsOn: []string{"b", "c"}}, {Name: "b"}, {Name: "c"}}
+	cfg.Caches = config.CacheConfig{MaxNodes: 2, MaxPaths: 1}
+	ctrl := controller.New(cfg, &fakeKube{}, &fakeProm{})
+	ctrl.EnableDryRunForTest()
+	ctrl.SetMetricsCache(&controller.FileMetricsCache{Path: path})
+	if err := ctrl.ReconcileOnceForTest(context.Background()); err != nil {
+		t.Fatalf("reconcile error: %v", err)
+	}
+	entries := func(cache string) float64 {
+		return metrics.Default.Value("lead_net_cache_entries", map[string]string{"cache": cache})
+	}
+	if n := entries("metrics_cache_nodes"); n != 2 {
+		t.Fatalf("expected the node measured longest ago evicted, %v nodes cached", n)
+	}
+	if n := entries("path_history"); n != 1 || len(mustIDs(t, ctrl)) != 1 {
+		t.Fatalf("expected history for one of the two paths, got %v", n)
+	}
+
+	// The node behind 10.0.0.3 is deleted from the cluster.
+	ctrl.ForgetNode("n3", []string{"10.0.0.3"})
+	if err := ctrl.ReconcileOnceForTest(context.Background()); err != nil {
+		t.Fatalf("reconcile error: %v", err)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read cache: %v", err)
+	}
+	if s := string(b); !strings.Contains(s, `"n2"`) || strings.Contains(s, `"n1"`) || strings.Contains(s, "10.0.0.3") {
+		t.Fatalf("expected only n2 left in the saved cache, got %s", s)
+	}
+}
+
+// mustIDs lists the paths with history via GET /paths/history.
+func mustIDs(t *testing.T, ctrl *controller.Controller) []string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	ctrl.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/paths/history", nil))
+	var resp struct {
+		Paths []string `json:"paths"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("bad /paths/history response: %s", rec.Body.String())
+	}
+	return resp.Paths
+}
+
+func TestController_PartialMatrixKeepsCachedDimensions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.json")
+	observed := time.Now().Add(-10 * time.Minute).UTC().Truncate(time.Second)
+	snap := `{"savedAt":"` + observed.Format(time.RFC3339) + `","nodes":{` +
+		`"n1":{"avgLatencyMs":9,"dropRate":0.5,"observedAt":"` + observed.Format(time.RFC3339) + `"}}}`
+	if err := os.WriteFile(path, []byte(snap), 0644); err != nil {
+		t.Fatalf("write cache: %v", err)
+	}
+
+	cfg := metricsCacheConfig()
+	cfg.Prometheus.NodeRTTQuery, cfg.Prometheus.NodeDropRateQuery = "rtt", "drop"
+	prom := &matrixProm{nm: &promc.NetworkMatrix{
+		Nodes:   map[string]*promc.NodeMetrics{"n1": {NodeID: "n1", DropRate: 0.1}},
+		Missing: map[string]string{promc.DimensionLatency: "timed out after 20s"},
+	}}
+	ctrl := controller.New(cfg, &fakeKube{}, prom)
+	ctrl.EnableDryRunForTest()
+	ctrl.SetMetricsCache(&controller.FileMetricsCache{Path: path})
+	if err := ctrl.ReconcileOnceForTest(context.Background()); err != nil {
+		t.Fatalf("reconcile error: %v", err)
+	}
+	if d := strings.Join(ctrl.Status().Degraded, "\n"); !strings.Contains(d, "latency query failed") {
+		t.Fatalf("expected the missing latency reported, got %q", d)
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read cache: %v", err)
+	}
+	var saved struct {
+		Nodes map[string]struct {
+			AvgLatencyMs float64   `json:"avgLatencyMs"`
+			DropRate     float64   `json:"dropRate"`
+			ObservedAt   time.Time `json:"observedAt"`
+		} `json:"nodes"`
+	}
+	if err := json.Unmarshal(b, &saved); err != nil {
+		t.Fatalf("decode cache: %v", err)
+	}
+	n1 := saved.Nodes["n1"]
+	if n1.AvgLatencyMs != 9 || n1.DropRate != 0.1 || !n1.ObservedAt.Equal(observed) {
+		t.Fatalf("expected cached latency kept next to the new drop rate, observed as before; got %+v", n1)
+	}
+}
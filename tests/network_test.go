@@ -1,33 +1,37 @@
 package tests
 
 import (
+	"math"
 	"testing"
 
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
 	"lead-net-affinity/pkg/graph"
+	"lead-net-affinity/pkg/kube"
 	promnet "lead-net-affinity/pkg/prometheus"
 	"lead-net-affinity/pkg/scoring"
 )
 
+// staticPlacement maps every service to a fixed node.
+type staticPlacement map[graph.NodeID]string
+
+func (s staticPlacement) NodeNameForService(svc graph.NodeID) string {
+	return s[svc]
+}
+
 // TestNetworkPenaltyAndCombine
 // Basic sanity check that ComputeNetworkPenalty runs and that
 // CombineScores(base, penalty) = base - penalty behaves as expected.
 func TestNetworkPenaltyAndCombine(t *testing.T) {
 	// Simple path with a couple of hops.
 	path := graph.Path{Nodes: []graph.NodeID{"a", "b", "c"}}
+	placements := staticPlacement{"a": "node1", "b": "node1", "c": "node2"}
 
-	// Synthetic matrix entry. In the real cluster you're effectively using
-	// cluster-level signals, but for unit tests we just need *some* numbers.
 	m := &promnet.NetworkMatrix{
-		Links: map[string]*promnet.NodeLinkMetrics{
-			// Key is arbitrary here; tests don't rely on per-link keys,
-			// they only care that the function can read something.
-			"cluster||cluster": {
-				SrcNode:       "cluster",
-				DstNode:       "cluster",
-				AvgLatencyMs:  50,  // "bad" latency
-				DropRate:      0.1, // "bad" drop rate
-				BandwidthMbps: 5,   // "low" bandwidth
-			},
+		Nodes: map[string]*promnet.NodeMetrics{
+			"node1": {NodeID: "node1", AvgLatencyMs: 50, DropRate: 0.1},
+			"node2": {NodeID: "node2", AvgLatencyMs: 5},
 		},
 	}
 
@@ -39,11 +43,11 @@ func TestNetworkPenaltyAndCombine(t *testing.T) {
 		BadDropRate:        0.01,
 	}
 
-	penalty := scoring.ComputeNetworkPenalty(path, m, w)
+	penalty := scoring.ComputeNetworkPenalty(path, placements, m, nil, w)
 
-	// Penalty should at least not be negative.
-	if penalty < 0 {
-		t.Fatalf("expected non-negative penalty, got %.2f", penalty)
+	// node1 is bad (latency and drops), node2 is fine.
+	if penalty <= 0 {
+		t.Fatalf("expected positive penalty, got %.2f", penalty)
 	}
 
 	base := 100.0
@@ -66,16 +70,12 @@ func TestNetworkPenaltyAndCombine(t *testing.T) {
 // penalty or a *higher* final score.
 func TestPenaltyAffectsRanking(t *testing.T) {
 	path := graph.Path{Nodes: []graph.NodeID{"a", "b", "c", "d"}}
+	placements := staticPlacement{"a": "node1", "b": "node2", "c": "node1", "d": "node2"}
 
 	m := &promnet.NetworkMatrix{
-		Links: map[string]*promnet.NodeLinkMetrics{
-			"cluster||cluster": {
-				SrcNode:       "cluster",
-				DstNode:       "cluster",
-				AvgLatencyMs:  50,
-				DropRate:      0.1,
-				BandwidthMbps: 5,
-			},
+		Nodes: map[string]*promnet.NodeMetrics{
+			"node1": {NodeID: "node1", AvgLatencyMs: 50, DropRate: 0.1},
+			"node2": {NodeID: "node2", AvgLatencyMs: 20, DropRate: 0.05},
 		},
 	}
 
@@ -95,8 +95,8 @@ func TestPenaltyAffectsRanking(t *testing.T) {
 		BadDropRate:        0.01,
 	}
 
-	penLight := scoring.ComputeNetworkPenalty(path, m, wLight)
-	penHeavy := scoring.ComputeNetworkPenalty(path, m, wHeavy)
+	penLight := scoring.ComputeNetworkPenalty(path, placements, m, nil, wLight)
+	penHeavy := scoring.ComputeNetworkPenalty(path, placements, m, nil, wHeavy)
 
 	// Heavier weights should not produce a *smaller* penalty.
 	if penHeavy < penLight {
@@ -112,3 +112,125 @@ func TestPenaltyAffectsRanking(t *testing.T) {
 		t.Fatalf("expected heavier penalty to give <= score; light=%.2f heavy=%.2f", finalLight, finalHeavy)
 	}
 }
+
+// TestEdgeLatencyPenalty checks that only slow caller -> callee hops are penalized.
+func TestEdgeLatencyPenalty(t *testing.T) {
+	path := graph.Path{Nodes: []graph.NodeID{"frontend", "search", "geo"}}
+	lat := &promnet.ServiceLatencyMatrix{
+		Pairs: map[promnet.ServicePair]float64{
+			{Src: "frontend", Dst: "search"}: 40, // 2x the bad threshold
+			{Src: "search", Dst: "geo"}:      5,  // fine
+		},
+	}
+	w := scoring.NetWeights{EdgeLatencyWeight: 3, BadEdgeLatencyMs: 20}
+
+	got := scoring.ComputeEdgeLatencyPenalty(path, lat, w)
+	if got != 3 {
+		t.Fatalf("expected penalty 3 (one edge at 2x threshold), got %.2f", got)
+	}
+
+	if got := scoring.ComputeEdgeLatencyPenalty(path, nil, w); got != 0 {
+		t.Fatalf("expected 0 penalty without latency data, got %.2f", got)
+	}
+}
+
+func TestPenalty_SanitizesSamples(t *testing.T) {
+	w := scoring.NetWeights{
+		NetLatencyWeight: 1, BadLatencyMs: 10,
+		NetDropWeight: 1, BadDropRate: 0.01,
+		Limits: scoring.Limits{MaxLatencyMs: 1000},
+	}
+	// 1e9 ms is clamped to 1000 ms, and the factor (99) capped at 10;
+	// a negative drop rate is discarded.
+	m := &promnet.NodeMetrics{NodeID: "n1", AvgLatencyMs: 1e9, DropRate: -5}
+	if got := scoring.NodeSeverityFromMetrics(m, w); got != scoring.DefaultMaxPenaltyFactor {
+		t.Fatalf("expected capped penalty %d, got %.2f", scoring.DefaultMaxPenaltyFactor, got)
+	}
+
+	w.Limits.MaxPenaltyFactor = -1
+	if got := scoring.NodeSeverityFromMetrics(m, w); got != 99 {
+		t.Fatalf("expected uncapped penalty 99 at the clamped latency, got %.2f", got)
+	}
+
+	path := graph.Path{Nodes: []graph.NodeID{"a", "b"}}
+	lat := &promnet.ServiceLatencyMatrix{Pairs: map[promnet.ServicePair]float64{{Src: "a", Dst: "b"}: math.NaN()}}
+	if got := scoring.ComputeEdgeLatencyPenalty(path, lat, scoring.NetWeights{EdgeLatencyWeight: 1, BadEdgeLatencyMs: 10}); got != 0 {
+		t.Fatalf("expected NaN latency to be ignored, got %.2f", got)
+	}
+}
+
+// spreadPlacement runs every service on several nodes.
+type spreadPlacement map[graph.NodeID]map[string]int
+
+func (s spreadPlacement) NodeNameForService(svc graph.NodeID) string {
+	return kube.MainNode(s[svc])
+}
+
+func (s spreadPlacement) NodesForService(svc graph.NodeID) map[string]int {
+	return s[svc]
+}
+
+func TestNetworkPenalty_AggregatesAcrossServicePods(t *testing.T) {
+	path := graph.Path{Nodes: []graph.NodeID{"a"}}
+	// Three pods on a healthy node, one on a slow one.
+	placements := spreadPlacement{"a": {"good": 3, "bad": 1}}
+	m := &promnet.NetworkMatrix{
+		Nodes: map[string]*promnet.NodeMetrics{
+			"good": {NodeID: "good", AvgLatencyMs: 5},
+			"bad":  {NodeID: "bad", AvgLatencyMs: 30},
+		},
+	}
+	w := scoring.NetWeights{NetLatencyWeight: 1, BadLatencyMs: 10}
+
+	// The old attribution only looked at the main node and saw no penalty.
+	if got := scoring.ComputeNetworkPenalty(path, staticPlacement{"a": "good"}, m, nil, w); got != 0 {
+		t.Fatalf("single-node penalty = %v, want 0", got)
+	}
+	if got := scoring.ComputeNetworkPenalty(path, placements, m, nil, w); math.Abs(got-2) > 1e-9 {
+		t.Fatalf("worst penalty = %v, want 2", got)
+	}
+	w.NodeAggregation = scoring.AggregateWeighted
+	if got := scoring.ComputeNetworkPenalty(path, placements, m, nil, w); math.Abs(got-0.5) > 1e-9 {
+		t.Fatalf("weighted penalty = %v, want 0.5", got)
+	}
+	sev, worst := scoring.AggregateNodeSeverity(placements["a"], m, nil, w)
+	if worst != "bad" || math.Abs(sev-0.5) > 1e-9 {
+		t.Fatalf("AggregateNodeSeverity = %v, %q", sev, worst)
+	}
+}
+
+func TestPlacementResolver_CountsScheduledPods(t *testing.T) {
+	pod := func(name, node string, phase corev1.PodPhase, deleting bool) corev1.Pod {
+		p := corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "ns",
+				Labels:    map[string]string{kube.DefaultServiceLabel: "a"},
+			},
+			Spec:   corev1.PodSpec{NodeName: node},
+			Status: corev1.PodStatus{Phase: phase},
+		}
+		if deleting {
+			now := metav1.Now()
+			p.DeletionTimestamp = &now
+		}
+		return p
+	}
+	k8s := &fakeKube{pods: []corev1.Pod{
+		pod("a-1", "n2", corev1.PodRunning, false),
+		pod("a-2", "n1", corev1.PodRunning, false),
+		pod("a-3", "n1", corev1.PodRunning, false),
+		pod("a-4", "", corev1.PodPending, false),
+		pod("a-5", "n3", corev1.PodRunning, true),
+		pod("a-6", "n3", corev1.PodSucceeded, false),
+	}}
+	p := kube.NewPlacementResolver(k8s, []string{"ns"}, nil)
+
+	got := p.NodesForService("a")
+	if len(got) != 2 || got["n1"] != 2 || got["n2"] != 1 {
+		t.Fatalf("NodesForService = %v, want n1:2 n2:1", got)
+	}
+	if n := p.NodeNameForService("a"); n != "n1" {
+		t.Fatalf("NodeNameForService = %q, want n1 (most pods)", n)
+	}
+}
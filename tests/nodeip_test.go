@@ -0,0 +1,149 @@
+package tests
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"lead-net-affinity/pkg/config"
+	"lead-net-affinity/pkg/controller"
+	promc "lead-net-affinity/pkg/prometheus"
+	"lead-net-affinity/pkg/rbac"
+)
+
+func TestNormalizeAddress(t *testing.T) {
+	for in, want := range map[string]string{
+		"":                       "",
+		"10.0.0.1":               "10.0.0.1",
+		"10.0.0.1:9962":          "10.0.0.1",
+		"[2001:db8::1]:9962":     "2001:db8::1",
+		"[2001:db8::1]":          "2001:db8::1",
+		"2001:DB8:0:0:0:0:0:1":   "2001:db8::1",
+		"::ffff:10.0.0.1":        "10.0.0.1",
+		"fe80::1%eth0":           "fe80::1",
+		"worker-1:9100":          "worker-1",
+		"worker-1.cluster.local": "worker-1.cluster.local",
+		" Worker-1.Example.com.": "worker-1.example.com",
+	} {
+		if got := promc.NormalizeAddress(in); got != want {
+			t.Errorf("NormalizeAddress(%q) = %q, want %q", in, got, want)
+		}
+	}
+
+	nm := &promc.NetworkMatrix{Nodes: map[string]*promc.NodeMetrics{"2001:db8::1": {NodeID: "2001:db8::1"}}}
+	if nm.GetNode("2001:DB8::0:1") == nil || nm.GetNode("[2001:db8::1]:9962") == nil {
+		t.Fatalf("expected the IPv6 key matched in any spelling")
+	}
+}
+
+func TestController_ResolvesBadNodeByAddressOrHostName(t *testing.T) {
+	cfg := &config.Config{Scoring: config.ScoringWeights{BadLatencyMs: 1}}
+	fk := &fakeKube{nodes: []corev1.Node{
+		{ObjectMeta: metav1.ObjectMeta{Name: "worker-1"}, Status: corev1.NodeStatus{Addresses: []corev1.NodeAddress{
+			{Type: corev1.NodeInternalIP, Address: "10.0.0.1"},
+		}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "worker-2"}, Status: corev1.NodeStatus{Addresses: []corev1.NodeAddress{
+			{Type: corev1.NodeInternalIP, Address: "10.0.0.2"},
+			{Type: corev1.NodeInternalDNS, Address: "ip-10-0-0-2.ec2.internal"},
+		}}},
+	}}
+	ctrl := controller.New(cfg, fk, &fakeProm{})
+	for key, want := range map[string]string{
+		"10.0.0.1":                      "worker-1",
+		"Worker-1.example.com":          "worker-1",
+		"ip-10-0-0-2.EC2.internal:9100": "worker-2",
+	} {
+		nm := &promc.NetworkMatrix{Nodes: map[string]*promc.NodeMetrics{key: {NodeID: key, AvgLatencyMs: 5}}}
+		if bad := ctrl.IdentifyBadNodes(nm); len(bad) != 1 || bad[0] != want {
+			t.Errorf("instance %q: expected bad node %s, got %v", key, want, bad)
+		}
+	}
+}
+
+func dualStackFixture(family string) (*config.Config, *fakeKube, *matrixProm) {
+	cfg := &config.Config{
+		NamespaceSelector: []string{"test-ns"},
+		Graph:             config.ServiceGraphConfig{Entry: "a", Services: []config.ServiceNode{{Name: "a"}}},
+		Prometheus:        config.PrometheusConfig{NodeRTTQuery: "rtt", NodeIPFamily: family},
+	}
+	fk := &fakeKube{
+		nodes: []corev1.Node{{
+			ObjectMeta: metav1.ObjectMeta{Name: "worker-1"},
+			Status: corev1.NodeStatus{Addresses: []corev1.NodeAddress{
+				{Type: corev1.NodeHostName, Address: "worker-1"},
+				{Type: corev1.NodeInternalIP, Address: "10.0.0.5"},
+				{Type: corev1.NodeInternalIP, Address: "2001:DB8::5"},
+			}},
+		}},
+		pods: []corev1.Pod{{
+			ObjectMeta: metav1.ObjectMeta{Name: "a-1", Namespace: "test-ns", Labels: map[string]string{"io.kompose.service": "a"}},
+			Spec:       corev1.PodSpec{NodeName: "worker-1"},
+			Status: corev1.PodStatus{
+				Phase:   corev1.PodRunning,
+				HostIP:  "10.0.0.5",
+				HostIPs: []corev1.HostIP{{IP: "10.0.0.5"}, {IP: "2001:db8::5"}},
+			},
+		}},
+	}
+	// Prometheus scrapes the node over IPv6 only.
+	prom := &matrixProm{nm: &promc.NetworkMatrix{Nodes: map[string]*promc.NodeMetrics{
+		"2001:db8::5": {NodeID: "2001:db8::5", AvgLatencyMs: 3},
+	}}}
+	return cfg, fk, prom
+}
+
+func nodeConfidence(ctrl *controller.Controller, node string) promc.Confidence {
+	for _, n := range ctrl.DataQuality().Nodes {
+		if n.Node == node {
+			return n.Confidence
+		}
+	}
+	return ""
+}
+
+func TestController_DualStackNodeMatchesIPv6Instance(t *testing.T) {
+	for _, family := range []string{"", "ipv6"} {
+		cfg, fk, prom := dualStackFixture(family)
+		ctrl := controller.New(cfg, fk, prom)
+		ctrl.EnableDryRunForTest()
+		if err := ctrl.ReconcileOnceForTest(context.Background()); err != nil {
+			t.Fatalf("reconcile error: %v", err)
+		}
+		if got := nodeConfidence(ctrl, "worker-1"); got != promc.ConfidenceMeasured {
+			t.Fatalf("family %q: expected worker-1 matched by its IPv6 address, got confidence %q", family, got)
+		}
+	}
+}
+
+func TestController_NamespaceScoped_DualStackHostIPs(t *testing.T) {
+	cfg, fk, prom := dualStackFixture("")
+	cfg.Scoring = config.ScoringWeights{BadLatencyMs: 1}
+	ctrl := controller.New(cfg, fk, prom)
+	ctrl.SetCapabilities(rbac.Capabilities{rbac.FeatureCore: true, rbac.FeatureApplyAffinity: true})
+
+	if bad := ctrl.IdentifyBadNodes(prom.nm); len(bad) != 1 || bad[0] != "worker-1" {
+		t.Fatalf("expected bad node worker-1 resolved via its IPv6 host IP, got %v", bad)
+	}
+	ctrl.EnableDryRunForTest()
+	if err := ctrl.ReconcileOnceForTest(context.Background()); err != nil {
+		t.Fatalf("reconcile error: %v", err)
+	}
+	if got := nodeConfidence(ctrl, "worker-1"); got != promc.ConfidenceMeasured {
+		t.Fatalf("expected worker-1 matched from pod host IPs, got confidence %q", got)
+	}
+}
+
+func TestConfigLoad_RejectsUnknownNodeIPFamily(t *testing.T) {
+	fp := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(fp, []byte("graph: {entry: a}\nprometheus: {nodeIPFamily: ipv5}\n"), 0644); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	if _, err := config.Load(fp); err == nil || !strings.Contains(err.Error(), "nodeIPFamily") {
+		t.Fatalf("expected nodeIPFamily error, got %v", err)
+	}
+}
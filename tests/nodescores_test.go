@@ -0,0 +1,76 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"lead-net-affinity/pkg/config"
+	"lead-net-affinity/pkg/controller"
+)
+
+// memSink keeps the files of the last write.
+type memSink struct{ files map[string][]byte }
+
+func (s *memSink) String() string { return "mem" }
+
+func (s *memSink) Write(_ context.Context, files map[string][]byte) error {
+	s.files = files
+	return nil
+}
+
+func TestController_PublishesNodeScores(t *testing.T) {
+	cfg := &config.Config{
+		NamespaceSelector: []string{"test-ns"},
+		Graph: config.ServiceGraphConfig{
+			Entry:    "a",
+			Services: []config.ServiceNode{{Name: "a", DependsOn: []string{"b"}}, {Name: "b"}},
+		},
+		Scoring: config.ScoringWeights{SameNodeBonus: 10},
+	}
+	ready := corev1.NodeStatus{Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: corev1.ConditionTrue}}}
+	pod := func(name, svc, node string) corev1.Pod {
+		return corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "test-ns", Labels: map[string]string{"io.kompose.service": svc}},
+			Spec:       corev1.PodSpec{NodeName: node},
+			Status:     corev1.PodStatus{Phase: corev1.PodRunning},
+		}
+	}
+	fk := &fakeKube{
+		pods: []corev1.Pod{pod("a-1", "a", "n1"), pod("b-1", "b", "n2")},
+		nodes: []corev1.Node{
+			{ObjectMeta: metav1.ObjectMeta{Name: "n1"}, Status: ready},
+			{ObjectMeta: metav1.ObjectMeta{Name: "n2"}, Status: ready},
+			{ObjectMeta: metav1.ObjectMeta{Name: "empty"}, Status: ready},
+			{ObjectMeta: metav1.ObjectMeta{Name: "cordoned"}, Spec: corev1.NodeSpec{Unschedulable: true}, Status: ready},
+		},
+	}
+	sink := &memSink{}
+	ctrl := controller.New(cfg, fk, &fakeProm{})
+	ctrl.EnableDryRunForTest()
+	ctrl.SetNodeScoresSink(sink)
+	if err := ctrl.ReconcileOnceForTest(context.Background()); err != nil {
+		t.Fatalf("reconcile error: %v", err)
+	}
+
+	var doc controller.NodeScores
+	if err := json.Unmarshal(sink.files["node-scores.json"], &doc); err != nil {
+		t.Fatalf("decode node-scores.json: %v (%v)", err, sink.files)
+	}
+	b := doc.Services["b"]
+	if b["n1"] <= b["n2"] {
+		t.Fatalf("expected b to score best next to its caller a on n1, got %v", b)
+	}
+	if _, ok := b["empty"]; !ok {
+		t.Fatalf("expected ready nodes without graph pods to be scored, got %v", b)
+	}
+	if _, ok := b["cordoned"]; ok || len(doc.Excluded) != 1 || doc.Excluded[0] != "cordoned" {
+		t.Fatalf("expected the cordoned node excluded, got scores %v excluded %v", b, doc.Excluded)
+	}
+	if got := ctrl.NodeScores(); len(got.Services) != 2 {
+		t.Fatalf("expected scores for both services, got %+v", got)
+	}
+}
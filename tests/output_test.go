@@ -0,0 +1,351 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"sigs.k8s.io/yaml"
+
+	"lead-net-affinity/pkg/config"
+	"lead-net-affinity/pkg/kube"
+	"lead-net-affinity/pkg/output"
+)
+
+func testPatchDeployment() *appsv1.Deployment {
+	d := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "a", Namespace: "ns"}}
+	d.Spec.Template.Spec.Affinity = &corev1.Affinity{PodAffinity: &corev1.PodAffinity{
+		PreferredDuringSchedulingIgnoredDuringExecution: []corev1.WeightedPodAffinityTerm{{
+			Weight: 80,
+			PodAffinityTerm: corev1.PodAffinityTerm{
+				LabelSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"io.kompose.service": "b"}},
+				TopologyKey:   "kubernetes.io/hostname",
+			},
+		}},
+	}}
+	// Container specs must never leak into the patch.
+	d.Spec.Template.Spec.Containers = []corev1.Container{{Name: "app", Image: "secret/image:1"}}
+	return d
+}
+
+func TestOutput_AffinityPatchesAndDirSink(t *testing.T) {
+	files, err := output.AffinityPatches([]*appsv1.Deployment{testPatchDeployment()})
+	if err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	patch := string(files["ns.a.yaml"])
+	for _, want := range []string{"kind: Deployment", "name: a", "weight: 80", "topologyKey: kubernetes.io/hostname"} {
+		if !strings.Contains(patch, want) {
+			t.Fatalf("patch missing %q:\n%s", want, patch)
+		}
+	}
+	if strings.Contains(patch, "image") {
+		t.Fatalf("patch must only carry affinity:\n%s", patch)
+	}
+
+	dir := filepath.Join(t.TempDir(), "out")
+	if err := (&output.DirSink{Dir: dir}).Write(context.Background(), files); err != nil {
+		t.Fatalf("dir sink: %v", err)
+	}
+	if b, err := os.ReadFile(filepath.Join(dir, "ns.a.yaml")); err != nil || string(b) != patch {
+		t.Fatalf("dir sink wrote %q, err=%v", b, err)
+	}
+}
+
+func TestOutput_HTTPAndConfigMapSinks(t *testing.T) {
+	var mu sync.Mutex
+	got := map[string]string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut || r.Header.Get("Authorization") != "Bearer t" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		b, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		got[r.URL.Path] = string(b)
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	cs := fake.NewClientset()
+	sinks, err := output.SinksFromConfig(config.OutputConfig{
+		ConfigMap:   "ops/lead-patches",
+		HTTPURL:     srv.URL + "/bucket/",
+		HTTPHeaders: map[string]string{"Authorization": "Bearer t"},
+	}, kube.NewForClientset(cs))
+	if err != nil || len(sinks) != 2 {
+		t.Fatalf("expected configmap and http sinks, got %v, %v", sinks, err)
+	}
+	if _, err := output.SinksFromConfig(config.OutputConfig{ConfigMap: "lead-patches"}, kube.NewForClientset(cs)); err == nil {
+		t.Fatalf("expected an error for a configMap without a namespace")
+	}
+
+	files := map[string][]byte{"ns.a.yaml": []byte("x")}
+	for _, s := range sinks {
+		if err := s.Write(context.Background(), files); err != nil {
+			t.Fatalf("%s: %v", s, err)
+		}
+	}
+	if got["/bucket/ns.a.yaml"] != "x" {
+		t.Fatalf("http sink did not PUT the file, got %v", got)
+	}
+	cm, err := cs.CoreV1().ConfigMaps("ops").Get(context.Background(), "lead-patches", metav1.GetOptions{})
+	if err != nil || cm.Data["ns.a.yaml"] != "x" {
+		t.Fatalf("configmap sink: cm=%v err=%v", cm, err)
+	}
+}
+
+func TestOutput_RenderFromTemplatesAndBaseManifests(t *testing.T) {
+	dir := t.TempDir()
+	tmpl := `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: {{ .Name }}
+spec:
+  template:
+    spec:
+      containers:
+      - name: app
+        image: registry.local/{{ .Name }}:v2
+      affinity:
+{{ indent 8 .Affinity }}
+`
+	base := `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: b
+spec:
+  replicas: 3
+  template:
+    spec:
+      containers:
+      - name: app
+        image: registry.local/b:v7
+`
+	if err := os.WriteFile(filepath.Join(dir, "a.yaml.tmpl"), []byte(tmpl), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "b.yaml"), []byte(base), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	a := testPatchDeployment()
+	b := testPatchDeployment()
+	b.Name = "b"
+	c := testPatchDeployment()
+	c.Name = "c"
+
+	files, err := output.Render([]*appsv1.Deployment{a, b, c}, output.Templates{Dir: dir}, nil, nil)
+	if err != nil {
+		t.Fatalf("render: %v", err)
+	}
+
+	var fromTmpl appsv1.Deployment
+	if err := yaml.Unmarshal(files["ns.a.yaml"], &fromTmpl); err != nil {
+		t.Fatalf("template output is not a valid Deployment: %v\n%s", err, files["ns.a.yaml"])
+	}
+	if fromTmpl.Spec.Template.Spec.Containers[0].Image != "registry.local/a:v2" ||
+		fromTmpl.Spec.Template.Spec.Affinity.PodAffinity == nil {
+		t.Fatalf("unexpected template output:\n%s", files["ns.a.yaml"])
+	}
+
+	var fromBase appsv1.Deployment
+	if err := yaml.Unmarshal(files["ns.b.yaml"], &fromBase); err != nil {
+		t.Fatalf("base output: %v", err)
+	}
+	if *fromBase.Spec.Replicas != 3 || fromBase.Spec.Template.Spec.Containers[0].Image != "registry.local/b:v7" ||
+		fromBase.Spec.Template.Spec.Affinity.PodAffinity == nil {
+		t.Fatalf("base manifest must keep its fields and gain affinity:\n%s", files["ns.b.yaml"])
+	}
+
+	if strings.Contains(string(files["ns.c.yaml"]), "containers") {
+		t.Fatalf("deployments without templates must get a bare patch:\n%s", files["ns.c.yaml"])
+	}
+}
+
+func TestOutput_RenderOnlyAllowedFiles(t *testing.T) {
+	dir := t.TempDir()
+	base := "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: %s\nspec:\n  replicas: 4\n"
+	for name, content := range map[string]string{
+		"a.yaml":            fmt.Sprintf(base, "a"),
+		"apps/search.yaml":  fmt.Sprintf(base, "b"),
+		"vendor/c.yaml":     fmt.Sprintf(base, "c"),
+		"vendor/chart.yaml": "not: ours",
+	} {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	a := testPatchDeployment()
+	b := testPatchDeployment()
+	b.Name = "b"
+	b.Labels = map[string]string{kube.DefaultServiceLabel: "search"}
+	c := testPatchDeployment()
+	c.Name = "c"
+	c.Labels = map[string]string{kube.DefaultServiceLabel: "c"}
+	tmpl := output.Templates{
+		Dir:     dir,
+		Include: []string{"apps/*.yaml", "vendor/*.yaml"},
+		Exclude: []string{"vendor/*"},
+		Files:   map[string]string{"search": "apps/search.yaml", "c": "vendor/c.yaml"},
+	}
+
+	files, err := output.Render([]*appsv1.Deployment{a, b, c}, tmpl, kube.NewServiceIdentity(nil, nil), nil)
+	if err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	if !strings.Contains(string(files["ns.b.yaml"]), "replicas: 4") {
+		t.Fatalf("expected search rendered from its mapped manifest:\n%s", files["ns.b.yaml"])
+	}
+	for _, f := range []string{"ns.a.yaml", "ns.c.yaml"} {
+		if strings.Contains(string(files[f]), "replicas") {
+			t.Fatalf("expected a bare patch for %s, whose manifest is not included or excluded:\n%s", f, files[f])
+		}
+	}
+
+	cfg := config.OutputConfig{TemplateDir: dir, Exclude: tmpl.Exclude, Files: map[string]string{"c": "vendor/c.yaml"}}
+	if err := cfg.Validate(); err == nil {
+		t.Fatalf("expected a mapping to an excluded file to be rejected")
+	}
+}
+
+// helmRendered is `helm template` output: several resources per file,
+// "# Source" comments and 4-space indentation.
+const helmRendered = `---
+# Source: shop/templates/service.yaml
+apiVersion: v1
+kind: Service
+metadata:
+    name: a
+spec:
+    ports:
+        - port: 80
+          targetPort: http
+---
+# Source: shop/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+    name: a
+    labels:
+        app.kubernetes.io/name: a # managed by the chart
+spec:
+    replicas: 2
+    template:
+        spec:
+            containers:
+                - name: app
+                  image: registry.local/a:v3
+---
+# Source: shop/templates/deployment-worker.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+    name: a-worker
+spec:
+    replicas: 1
+`
+
+func TestOutput_RenderMultiDocumentManifest(t *testing.T) {
+	for _, eol := range []string{"\n", "\r\n"} {
+		dir := t.TempDir()
+		raw := strings.ReplaceAll(helmRendered, "\n", eol)
+		if err := os.WriteFile(filepath.Join(dir, "a.yaml"), []byte(raw), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		files, err := output.Render([]*appsv1.Deployment{testPatchDeployment()}, output.Templates{Dir: dir}, nil, nil)
+		if err != nil {
+			t.Fatalf("render: %v", err)
+		}
+		got := string(files["ns.a.yaml"])
+		docs := strings.Split(got, "---"+eol)
+		want := strings.Split(raw, "---"+eol)
+		if len(docs) != len(want) || docs[1] != want[1] || docs[3] != want[3] {
+			t.Fatalf("expected the Service and the other Deployment untouched, got:\n%s", got)
+		}
+		if bare := strings.Count(got, "\n") - strings.Count(got, "\r\n"); (bare == 0) != (eol == "\r\n") {
+			t.Fatalf("expected %q line endings kept, got %q", eol, got)
+		}
+		for _, keep := range []string{"# Source: shop/templates/deployment.yaml", "    replicas: 2", "# managed by the chart", "image: registry.local/a:v3"} {
+			if !strings.Contains(docs[2], keep) {
+				t.Fatalf("expected %q kept in the rewritten Deployment:\n%s", keep, docs[2])
+			}
+		}
+		var d appsv1.Deployment
+		if err := yaml.Unmarshal([]byte(docs[2]), &d); err != nil {
+			t.Fatalf("rewritten Deployment: %v", err)
+		}
+		if d.Spec.Template.Spec.Affinity == nil || d.Spec.Template.Spec.Affinity.PodAffinity == nil || *d.Spec.Replicas != 2 {
+			t.Fatalf("expected the affinity set and the rest kept, got %+v", d.Spec)
+		}
+	}
+}
+
+func TestOutput_GatekeeperConstraints(t *testing.T) {
+	zone := corev1.NodeSelectorRequirement{Key: "topology.kubernetes.io/zone", Operator: corev1.NodeSelectorOpIn, Values: []string{"eu-1a"}}
+	spot := corev1.NodeSelectorRequirement{Key: "karpenter.sh/capacity-type", Operator: corev1.NodeSelectorOpNotIn, Values: []string{"spot"}}
+	d := testPatchDeployment()
+	d.Spec.Template.Spec.Affinity.NodeAffinity = &corev1.NodeAffinity{
+		RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{NodeSelectorTerms: []corev1.NodeSelectorTerm{
+			{MatchExpressions: []corev1.NodeSelectorRequirement{zone, spot, {Key: "gpu", Operator: corev1.NodeSelectorOpExists}}},
+			{MatchExpressions: []corev1.NodeSelectorRequirement{spot, zone}},
+		}},
+	}
+	reqs := output.NodeConstraints(d)
+	if len(reqs) != 2 || reqs[0].Key != zone.Key || reqs[1].Key != spot.Key {
+		t.Fatalf("expected the zone and spot requirements common to all terms, got %+v", reqs)
+	}
+
+	files, err := output.Gatekeeper([]output.NodeConstraint{
+		{Service: "user_svc", Namespace: "ns", Selector: map[string]string{"io.kompose.service": "user_svc"}, Requirements: reqs},
+		{Service: "free", Namespace: "ns"},
+	}, "deny")
+	if err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	var tmpl map[string]any
+	if err := yaml.Unmarshal(files[output.GatekeeperTemplateFile], &tmpl); err != nil || tmpl["kind"] != "ConstraintTemplate" {
+		t.Fatalf("expected a ConstraintTemplate, got %v (%v)", tmpl, err)
+	}
+	docs := strings.Split(string(files[output.GatekeeperConstraintsFile]), "---\n")
+	if len(docs) != 1 {
+		t.Fatalf("expected one constraint (services without requirements are skipped), got %d", len(docs))
+	}
+	var c struct {
+		Kind     string `json:"kind"`
+		Metadata struct {
+			Name string `json:"name"`
+		} `json:"metadata"`
+		Spec struct {
+			EnforcementAction string `json:"enforcementAction"`
+			Match             struct {
+				LabelSelector metav1.LabelSelector `json:"labelSelector"`
+			} `json:"match"`
+			Parameters struct {
+				Requirements []corev1.NodeSelectorRequirement `json:"requirements"`
+			} `json:"parameters"`
+		} `json:"spec"`
+	}
+	if err := yaml.Unmarshal([]byte(docs[0]), &c); err != nil {
+		t.Fatalf("decode constraint: %v", err)
+	}
+	if c.Kind != output.GatekeeperKind || c.Metadata.Name != "lead-net-ns-user-svc" || c.Spec.EnforcementAction != "deny" ||
+		c.Spec.Match.LabelSelector.MatchLabels["io.kompose.service"] != "user_svc" || len(c.Spec.Parameters.Requirements) != 2 ||
+		c.Spec.Parameters.Requirements[0].Values[0] != "eu-1a" {
+		t.Fatalf("unexpected constraint: %+v", c)
+	}
+}
@@ -0,0 +1,54 @@
+package tests
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"lead-net-affinity/pkg/config"
+	"lead-net-affinity/pkg/controller"
+)
+
+func TestController_OwnershipMarkers(t *testing.T) {
+	cfg, fk := approvalFixture(config.ApprovalConfig{})
+	// c was marked by another LEAD instance.
+	fk.deploys[2].Annotations = map[string]string{controller.ManagedAnnotation: "true", controller.ManagerAnnotation: "lead-staging"}
+	ctrl := controller.New(cfg, fk, &fakeProm{})
+	if err := ctrl.ReconcileOnceForTest(context.Background()); err != nil {
+		t.Fatalf("reconcile error: %v", err)
+	}
+
+	if fk.updated != 2 {
+		t.Fatalf("expected a and b updated and c left alone, got %d updates", fk.updated)
+	}
+	b := fk.deploys[1].Annotations
+	if b[controller.ManagedAnnotation] != "true" || b[controller.ManagerAnnotation] != controller.DefaultManager ||
+		b[controller.LastDecisionAnnotation] != ctrl.Decisions().ID {
+		t.Fatalf("expected b marked as managed by this controller, got %v", b)
+	}
+	stamped, err := time.Parse(time.RFC3339, b[controller.LastUpdateAnnotation])
+	if err != nil || time.Since(stamped) > time.Minute {
+		t.Fatalf("expected a recent update timestamp, got %q (%v)", b[controller.LastUpdateAnnotation], err)
+	}
+	if c := fk.deploys[2]; c.Annotations[controller.ManagerAnnotation] != "lead-staging" || c.Spec.Template.Annotations != nil {
+		t.Fatalf("expected c untouched, got %v", c.Annotations)
+	}
+	if st := ctrl.Status(); !strings.Contains(strings.Join(st.Errors, "\n"), "test-ns/c skipped: managed by another controller") {
+		t.Fatalf("expected the skip in the status, got %v", st.Errors)
+	}
+
+	// Unchanged rules keep the last update's markers.
+	fk.deploys[1].Annotations[controller.LastUpdateAnnotation] = "2020-01-01T00:00:00Z"
+	cfg.Ownership.Force = true
+	fk.updated = 0
+	if err := ctrl.ReconcileOnceForTest(context.Background()); err != nil {
+		t.Fatalf("reconcile error: %v", err)
+	}
+	if fk.updated != 3 || fk.deploys[2].Annotations[controller.ManagerAnnotation] != controller.DefaultManager {
+		t.Fatalf("expected c taken over with ownership.force, got %d updates and %v", fk.updated, fk.deploys[2].Annotations)
+	}
+	if got := fk.deploys[1].Annotations[controller.LastUpdateAnnotation]; got != "2020-01-01T00:00:00Z" {
+		t.Fatalf("expected b's timestamp kept while its affinity is unchanged, got %s", got)
+	}
+}
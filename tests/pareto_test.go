@@ -0,0 +1,161 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"lead-net-affinity/pkg/config"
+	"lead-net-affinity/pkg/controller"
+	promc "lead-net-affinity/pkg/prometheus"
+	"lead-net-affinity/pkg/scoring"
+)
+
+func TestParetoFronts(t *testing.T) {
+	fronts := scoring.ParetoFronts([]scoring.Objectives{
+		{Latency: 10, Cost: 5, Resilience: 1},
+		{Latency: 5, Cost: 2, Resilience: 1},
+		{Latency: 5, Cost: 5, Resilience: 1},  // dominated by both above
+		{Latency: 4, Cost: 6, Resilience: 1},  // dominated by the one above
+		{Latency: 10, Cost: 5, Resilience: 1}, // equal points do not dominate
+	})
+	want := []int{1, 1, 2, 3, 1}
+	for i := range want {
+		if fronts[i] != want[i] {
+			t.Fatalf("expected fronts %v, got %v", want, fronts)
+		}
+	}
+}
+
+func TestController_ParetoFrontAndSelection(t *testing.T) {
+	cfg := &config.Config{
+		NamespaceSelector: []string{"test-ns"},
+		Graph: config.ServiceGraphConfig{
+			Entry:    "a",
+			Services: []config.ServiceNode{{Name: "a", DependsOn: []string{"b", "c", "d"}}, {Name: "b"}, {Name: "c"}, {Name: "d"}},
+		},
+		Prometheus: config.PrometheusConfig{ServicePairLatencyQuery: "lat"},
+		Server:     config.ServerConfig{Debug: config.DebugConfig{Token: "s3cret"}},
+		Scoring: config.ScoringWeights{
+			PathLengthWeight: 1, PodCountWeight: 1, ServiceEdgesWeight: 1,
+			EdgeLatencyWeight: 4, BadEdgeLatencyMs: 20,
+			Pareto: config.ParetoConfig{Enabled: true},
+		},
+		Affinity: config.AffinityConfig{TopPaths: 1, MinAffinityWeight: 50, MaxAffinityWeight: 100},
+	}
+	deploy := func(name string) appsv1.Deployment {
+		lbls := map[string]string{"io.kompose.service": name}
+		return appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "test-ns", Labels: lbls},
+			Spec: appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{ObjectMeta: metav1.ObjectMeta{Labels: lbls}}}}
+	}
+	fk := &fakeKube{deploys: []appsv1.Deployment{deploy("a"), deploy("b"), deploy("c"), deploy("d")}}
+	// a-b moves 5 pods and keeps 2 replicas; a-c moves 3 but is slow and
+	// keeps 1; a-d is as fast as a-b, moves more and keeps no more.
+	for svc, n := range map[string]int{"a": 2, "b": 3, "c": 1, "d": 5} {
+		for i := 0; i < n; i++ {
+			fk.pods = append(fk.pods, corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: svc + "-" + strconv.Itoa(i), Namespace: "test-ns", Labels: map[string]string{"io.kompose.service": svc}},
+				Spec:       corev1.PodSpec{NodeName: "n1"},
+				Status:     corev1.PodStatus{Phase: corev1.PodRunning, Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}},
+			})
+		}
+	}
+	prom := &fakeProm{lat: map[promc.ServicePair]float64{{Src: "a", Dst: "c"}: 80}}
+	ctrl := controller.New(cfg, fk, prom)
+	ts := httptest.NewServer(ctrl.Handler())
+	defer ts.Close()
+
+	reconcile := func() controller.ParetoFront {
+		t.Helper()
+		if err := ctrl.ReconcileOnceForTest(context.Background()); err != nil {
+			t.Fatalf("reconcile error: %v", err)
+		}
+		resp, err := http.Get(ts.URL + "/paths/pareto")
+		if err != nil {
+			t.Fatalf("GET /paths/pareto: %v", err)
+		}
+		defer resp.Body.Close()
+		var pf controller.ParetoFront
+		if err := json.NewDecoder(resp.Body).Decode(&pf); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return pf
+	}
+	fronts := func(pf controller.ParetoFront) map[string]controller.ParetoPoint {
+		out := make(map[string]controller.ParetoPoint)
+		for _, p := range pf.Points {
+			out[p.Path] = p
+		}
+		return out
+	}
+
+	pf := reconcile()
+	pts := fronts(pf)
+	if len(pts) != 3 || pts["a-b"].Front != 1 || pts["a-c"].Front != 1 || pts["a-d"].Front != 2 {
+		t.Fatalf("expected a-b and a-c on the front and a-d behind, got %+v", pf.Points)
+	}
+	if ab := pts["a-b"]; ab.Cost != 5 || ab.Resilience != 2 {
+		t.Fatalf("unexpected objectives for a-b: %+v", ab)
+	}
+	if ac := pts["a-c"]; ac.Latency <= 0 || ac.PredictedLatencyMs == nil || *ac.PredictedLatencyMs != 80 {
+		t.Fatalf("expected a-c's latency to count, got %+v", ac)
+	}
+
+	post := func(path string) int {
+		t.Helper()
+		resp, err := withToken(http.MethodPost, ts.URL+"/paths/pareto/select?path="+path, "s3cret")
+		if err != nil {
+			t.Fatalf("POST: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	resp, err := http.Post(ts.URL+"/paths/pareto/select?path=a-b", "", nil)
+	if err != nil {
+		t.Fatalf("POST: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected 401 selecting without the token, got %d", resp.StatusCode)
+	}
+	if code := post("a-d"); code != http.StatusConflict {
+		t.Fatalf("expected 409 for a path behind the front, got %d", code)
+	}
+	if code := post("x-y"); code != http.StatusNotFound {
+		t.Fatalf("expected 404 for an unknown path, got %d", code)
+	}
+
+	// Pick the front path the combined score does not rank first.
+	first := ctrl.Decisions().Paths[0].ID
+	pick := "a-b"
+	if first == "a-b" {
+		pick = "a-c"
+	}
+	if code := post(pick); code != http.StatusOK {
+		t.Fatalf("expected 200 selecting %s, got %d", pick, code)
+	}
+	pf = reconcile()
+	if pf.Selected != pick || !fronts(pf)[pick].Selected {
+		t.Fatalf("expected %s selected, got %+v", pick, pf)
+	}
+	if got := ctrl.Decisions().Paths[0].ID; got != pick {
+		t.Fatalf("expected the selected point ranked first, got %s", got)
+	}
+
+	resp, err = withToken(http.MethodDelete, ts.URL+"/paths/pareto/select", "s3cret")
+	if err != nil {
+		t.Fatalf("DELETE: %v", err)
+	}
+	resp.Body.Close()
+	reconcile()
+	if got := ctrl.Decisions().Paths[0].ID; got != first {
+		t.Fatalf("expected %s ranked first again after clearing, got %s", first, got)
+	}
+}
@@ -0,0 +1,72 @@
+package tests
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"lead-net-affinity/pkg/config"
+	"lead-net-affinity/pkg/controller"
+	"lead-net-affinity/pkg/policy"
+)
+
+// fakePolicy stands in for a WASI runtime: the script gets the module path
+// as $1 and the input on stdin.
+func fakePolicy(t *testing.T, script string) *policy.WASIModule {
+	t.Helper()
+	module := filepath.Join(t.TempDir(), "policy.wasm")
+	if err := os.WriteFile(module, []byte("\x00asm"), 0644); err != nil {
+		t.Fatalf("write module: %v", err)
+	}
+	ev, err := policy.NewWASIModule(module, []string{"sh", "-c", script, "sh"}, time.Second)
+	if err != nil {
+		t.Fatalf("new module: %v", err)
+	}
+	return ev
+}
+
+func TestPolicy_DeniesAffinityChanges(t *testing.T) {
+	ev := fakePolicy(t, `in=$(cat); case "$in" in
+*'"name":"b"'*) echo '{"result":"deny","reason":"frozen"}' ;;
+*) echo '{"result":"allow"}' ;;
+esac`)
+	cfg, fk := approvalFixture(config.ApprovalConfig{})
+	ctrl := controller.New(cfg, fk, &fakeProm{})
+	ctrl.SetPolicy(ev)
+	if err := ctrl.ReconcileOnceForTest(context.Background()); err != nil {
+		t.Fatalf("reconcile error: %v", err)
+	}
+	if aff, _ := ctrl.AffinityPreview("b"); aff != nil && aff.PodAffinity != nil {
+		t.Fatalf("denied change for b must keep its current rules, got %+v", aff)
+	}
+	if aff, _ := ctrl.AffinityPreview("c"); aff == nil || aff.PodAffinity == nil {
+		t.Fatalf("allowed change for c must keep its pod affinity, got %+v", aff)
+	}
+}
+
+func TestPolicy_RejectsInvalidDecisions(t *testing.T) {
+	cases := map[string]string{
+		"mutate without affinity": `echo '{"result":"mutate"}'`,
+		"unknown result":          `echo '{"result":"maybe"}'`,
+		"not json":                `echo nope`,
+		"exit status":             `echo boom >&2; exit 3`,
+		"timeout":                 `sleep 5`,
+	}
+	for name, script := range cases {
+		_, err := fakePolicy(t, script).Evaluate(context.Background(), policy.Input{Kind: policy.KindAffinity, Name: "a"})
+		if err == nil {
+			t.Fatalf("%s: expected an error", name)
+		}
+		if name == "exit status" && !strings.Contains(err.Error(), "boom") {
+			t.Fatalf("expected stderr in the error, got %v", err)
+		}
+	}
+	dec, err := fakePolicy(t, `echo '{"result":"deny","reason":"never"}'`).Evaluate(context.Background(),
+		policy.Input{Kind: policy.KindEviction, Name: "a-1"})
+	if err != nil || dec.Result != policy.Deny || dec.Reason != "never" {
+		t.Fatalf("expected a denied eviction, got %+v %v", dec, err)
+	}
+}
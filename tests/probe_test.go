@@ -0,0 +1,128 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"lead-net-affinity/pkg/config"
+	"lead-net-affinity/pkg/controller"
+	"lead-net-affinity/pkg/graph"
+	"lead-net-affinity/pkg/probe"
+)
+
+// grpcHealthServer answers grpc.health.v1.Health/Check over cleartext
+// HTTP/2: SERVING for the server, NOT_SERVING for the "db" service.
+func grpcHealthServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor != 2 || r.URL.Path != "/grpc.health.v1.Health/Check" || r.Header.Get("Content-Type") != "application/grpc" {
+			http.Error(w, "not a gRPC health check", http.StatusBadRequest)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		status := byte(1) // SERVING
+		if bytes.Contains(body, []byte("db")) {
+			status = 2 // NOT_SERVING
+		}
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Write([]byte{0, 0, 0, 0, 2, 0x08, status})
+		w.Header().Set(http.TrailerPrefix+"Grpc-Status", "0")
+	}))
+	srv.Config.Protocols = new(http.Protocols)
+	srv.Config.Protocols.SetHTTP1(true)
+	srv.Config.Protocols.SetUnencryptedHTTP2(true)
+	srv.Start()
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestProber_HTTPAndGRPC(t *testing.T) {
+	httpSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer httpSrv.Close()
+	grpcSrv := grpcHealthServer(t)
+
+	p := probe.NewProber(time.Second)
+	ctx := context.Background()
+	if err := p.HTTP(ctx, httpSrv.URL+"/health"); err != nil {
+		t.Fatalf("healthy HTTP endpoint: %v", err)
+	}
+	if err := p.HTTP(ctx, httpSrv.URL+"/ready"); err == nil || !strings.Contains(err.Error(), "503") {
+		t.Fatalf("expected a 503 error, got %v", err)
+	}
+
+	addr := strings.TrimPrefix(grpcSrv.URL, "http://")
+	if err := p.GRPC(ctx, addr, ""); err != nil {
+		t.Fatalf("serving gRPC server: %v", err)
+	}
+	if err := p.GRPC(ctx, addr, "db"); err == nil || !strings.Contains(err.Error(), "NOT_SERVING") {
+		t.Fatalf("expected NOT_SERVING, got %v", err)
+	}
+}
+
+func TestHealthChecks_MergedIntoServiceHealth(t *testing.T) {
+	grpcSrv := grpcHealthServer(t)
+	httpSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer httpSrv.Close()
+	port := func(url string) int32 {
+		_, p, _ := net.SplitHostPort(strings.TrimPrefix(url, "http://"))
+		n, _ := strconv.Atoi(p)
+		return int32(n)
+	}
+
+	cfg := &config.Config{
+		NamespaceSelector: []string{"test-ns"},
+		Graph: config.ServiceGraphConfig{
+			Entry: "a",
+			Services: []config.ServiceNode{
+				{Name: "a", DependsOn: []string{"b", "c"}},
+				{Name: "b", Ports: []graph.Port{{Name: "grpc", Port: 9090, TargetPort: port(grpcSrv.URL), AppProtocol: "grpc"}}},
+				{Name: "c", Ports: []graph.Port{{Name: "http", Port: 80, TargetPort: port(httpSrv.URL), AppProtocol: "http"}}},
+			},
+		},
+		HealthChecks: config.HealthCheckConfig{Enabled: true, TimeoutMs: 2000},
+	}
+	pod := func(name, svc string) corev1.Pod {
+		return corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "test-ns", Labels: map[string]string{"io.kompose.service": svc}},
+			Spec:       corev1.PodSpec{NodeName: "n1"},
+			Status: corev1.PodStatus{Phase: corev1.PodRunning, PodIP: "127.0.0.1",
+				Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}},
+		}
+	}
+	k8s := &fakeKube{pods: []corev1.Pod{pod("a-0", "a"), pod("b-0", "b"), pod("c-0", "c")}}
+	ctrl := controller.New(cfg, k8s, &fakeProm{})
+	if err := ctrl.ReconcileOnceForTest(context.Background()); err != nil {
+		t.Fatalf("reconcile error: %v", err)
+	}
+
+	services := map[string]controller.ServiceHealth{}
+	for _, s := range ctrl.HealthSummary().Services {
+		services[s.Service] = s
+	}
+	if b := services["b"]; b.Probe == nil || b.Probe.Protocol != "grpc" || b.Probe.Healthy != 1 || b.Status != controller.HealthHealthy {
+		t.Fatalf("b should pass its gRPC health check, got %+v (probe %+v)", b, b.Probe)
+	}
+	if c := services["c"]; c.Probe == nil || c.Probe.Protocol != "http" || c.Probe.Healthy != 0 || c.Status != controller.HealthUnhealthy {
+		t.Fatalf("c fails its HTTP health check on every pod and should be unhealthy, got %+v (probe %+v)", c, c.Probe)
+	}
+	if a := services["a"]; a.Probe != nil {
+		t.Fatalf("a has no known port and must not be probed, got %+v", a.Probe)
+	}
+}
@@ -2,12 +2,25 @@ package tests
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
 	"fmt"
+	"math/big"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
+	"lead-net-affinity/pkg/outbound"
 	promc "lead-net-affinity/pkg/prometheus"
 )
 
@@ -136,3 +149,325 @@ func TestPrometheus_Query_And_FetchMatrix(t *testing.T) {
 		t.Fatalf("expected at least one non-empty map field in NetworkMatrix, got none")
 	}
 }
+
+func TestPrometheus_FetchServiceLatencies(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{
+		  "status": "success",
+		  "data": {
+		    "resultType": "vector",
+		    "result": [
+		      {"metric": {"source_workload": "frontend", "destination_workload": "search"}, "value": [1731700000.0, "0.012"]},
+		      {"metric": {"source_workload": "frontend"}, "value": [1731700000.0, "0.5"]}
+		    ]
+		  }
+		}`)
+	}))
+	defer ts.Close()
+
+	client, err := promc.NewClient(ts.URL)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	m, err := client.FetchServiceLatencies(context.Background(), "pair_latency", "", "", "s")
+	if err != nil {
+		t.Fatalf("FetchServiceLatencies() error = %v", err)
+	}
+	if len(m.Pairs) != 1 {
+		t.Fatalf("expected 1 pair (sample without dst skipped), got %d", len(m.Pairs))
+	}
+	if v, ok := m.Latency("frontend", "search"); !ok || v != 12 {
+		t.Fatalf("expected frontend->search = 12ms, got %v (ok=%v)", v, ok)
+	}
+	// Reverse direction falls back to the measured edge.
+	if _, ok := m.Latency("search", "frontend"); !ok {
+		t.Fatalf("expected reverse lookup to fall back to measured edge")
+	}
+}
+
+func TestPrometheus_FetchDeploymentRollouts(t *testing.T) {
+	values := map[string]string{
+		"kube_deployment_spec_replicas":              "3",
+		"kube_deployment_status_replicas_updated":    "3",
+		"kube_deployment_status_replicas_available":  "2",
+		"kube_deployment_metadata_generation":        "4",
+		"kube_deployment_status_observed_generation": "4",
+	}
+	var queries []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query().Get("query")
+		queries = append(queries, q)
+		metric := q[:strings.Index(q, "{")]
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"status": "success", "data": {"resultType": "vector", "result": [
+		  {"metric": {"namespace": "shop", "deployment": "cart"}, "value": [1731700000.0, %q]},
+		  {"metric": {"namespace": "shop"}, "value": [1731700000.0, "1"]}
+		]}}`, values[metric])
+	}))
+	defer ts.Close()
+
+	client, err := promc.NewClient(ts.URL)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	rollouts, err := client.FetchDeploymentRollouts(context.Background(), `job="ksm"`)
+	if err != nil {
+		t.Fatalf("FetchDeploymentRollouts() error = %v", err)
+	}
+	want := promc.DeploymentRollout{Desired: 3, Updated: 3, Available: 2, Generation: 4, ObservedGeneration: 4}
+	if len(rollouts) != 1 || rollouts["shop/cart"] != want {
+		t.Fatalf("got %+v, want only shop/cart = %+v", rollouts, want)
+	}
+	if rollouts["shop/cart"].Settled() {
+		t.Fatalf("2 of 3 replicas available must not count as settled")
+	}
+	if queries[0] != `kube_deployment_spec_replicas{job="ksm"}` {
+		t.Fatalf("selector not applied: %q", queries[0])
+	}
+}
+
+func TestPrometheus_AuthReloadsTokenFile(t *testing.T) {
+	var got []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = append(got, r.Header.Get("Authorization"))
+		fmt.Fprint(w, `{"status":"success","data":{"resultType":"vector","result":[]}}`)
+	}))
+	defer ts.Close()
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("first\n"), 0600); err != nil {
+		t.Fatalf("write token: %v", err)
+	}
+	c, err := promc.NewClient(ts.URL)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	if err := c.SetAuth(promc.Auth{BearerTokenFile: tokenFile}); err != nil {
+		t.Fatalf("SetAuth: %v", err)
+	}
+	if err := c.Ping(context.Background()); err != nil {
+		t.Fatalf("Ping: %v", err)
+	}
+	// The Secret rotates: the next query uses the new token.
+	if err := os.WriteFile(tokenFile, []byte("second-token\n"), 0600); err != nil {
+		t.Fatalf("write token: %v", err)
+	}
+	if err := c.Ping(context.Background()); err != nil {
+		t.Fatalf("Ping: %v", err)
+	}
+	if len(got) != 2 || got[0] != "Bearer first" || got[1] != "Bearer second-token" {
+		t.Fatalf("unexpected Authorization headers: %q", got)
+	}
+
+	if err := c.SetAuth(promc.Auth{Username: "lead", Password: "pw"}); err != nil {
+		t.Fatalf("SetAuth: %v", err)
+	}
+	if err := c.Ping(context.Background()); err != nil {
+		t.Fatalf("Ping: %v", err)
+	}
+	if got[2] != "Basic bGVhZDpwdw==" {
+		t.Fatalf("expected basic auth, got %q", got[2])
+	}
+	if err := c.SetAuth(promc.Auth{BearerTokenFile: filepath.Join(t.TempDir(), "missing")}); err == nil {
+		t.Fatalf("expected an error for a missing token file")
+	}
+}
+
+func TestPrometheus_TLSWithPrivateCAAndClientCert(t *testing.T) {
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.PeerCertificates) == 0 {
+			http.Error(w, "client certificate required", http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, `{"status":"success","data":{"resultType":"vector","result":[]}}`)
+	}))
+	ts.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	ts.StartTLS()
+	defer ts.Close()
+
+	dir := t.TempDir()
+	writePEM := func(name, typ string, der []byte) string {
+		fp := filepath.Join(dir, name)
+		if err := os.WriteFile(fp, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0600); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+		return fp
+	}
+	caFile := writePEM("ca.crt", "CERTIFICATE", ts.Certificate().Raw)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	tmpl := &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "lead"},
+		NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().Add(time.Hour),
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("marshal key: %v", err)
+	}
+	certFile := writePEM("tls.crt", "CERTIFICATE", der)
+	keyFile := writePEM("tls.key", "EC PRIVATE KEY", keyDER)
+
+	c, err := promc.NewClient(ts.URL)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	if err := c.Ping(context.Background()); err == nil {
+		t.Fatalf("expected the private CA to be rejected without tls.caFile")
+	}
+	if err := c.SetTLS(promc.TLS{CAFile: caFile}); err != nil {
+		t.Fatalf("SetTLS: %v", err)
+	}
+	if err := c.Ping(context.Background()); err == nil {
+		t.Fatalf("expected the server to require a client certificate")
+	}
+	if err := c.SetTLS(promc.TLS{CAFile: caFile, CertFile: certFile, KeyFile: keyFile}); err != nil {
+		t.Fatalf("SetTLS: %v", err)
+	}
+	if err := c.Ping(context.Background()); err != nil {
+		t.Fatalf("Ping over mutual TLS: %v", err)
+	}
+	if err := c.SetTLS(promc.TLS{CertFile: certFile}); err == nil {
+		t.Fatalf("expected an error for a certificate without its key")
+	}
+}
+
+func TestPrometheus_HTTPOptionsProxyAndHeaders(t *testing.T) {
+	// The "proxy" answers for any host; a proxied request carries the
+	// absolute target URL.
+	var target, orgID, auth string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		target, orgID, auth = r.URL.Host, r.Header.Get("X-Scope-OrgID"), r.Header.Get("Authorization")
+		fmt.Fprint(w, `{"status":"success","data":{"resultType":"vector","result":[]}}`)
+	}))
+	defer proxy.Close()
+
+	c, err := promc.NewClient("http://prometheus.invalid:9090")
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	if err := c.SetAuth(promc.Auth{BearerToken: "tok"}); err != nil {
+		t.Fatalf("SetAuth: %v", err)
+	}
+	err = c.SetHTTPOptions(outbound.Options{
+		ProxyURL: proxy.URL,
+		Headers:  map[string]string{"X-Scope-OrgID": "platform", "Authorization": "ignored"},
+		Timeout:  time.Second,
+	})
+	if err != nil {
+		t.Fatalf("SetHTTPOptions: %v", err)
+	}
+	if err := c.Ping(context.Background()); err != nil {
+		t.Fatalf("Ping through the proxy: %v", err)
+	}
+	if target != "prometheus.invalid:9090" || orgID != "platform" || auth != "Bearer tok" {
+		t.Fatalf("unexpected proxied request: host=%q org=%q auth=%q", target, orgID, auth)
+	}
+	if err := c.SetHTTPOptions(outbound.Options{ProxyURL: "not a url"}); err == nil {
+		t.Fatalf("expected an error for an invalid proxy URL")
+	}
+}
+
+func TestPrometheus_FetchMatrix_InstanceLabelVariants(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"status": "success", "data": {"resultType": "vector", "result": [
+		  {"metric": {"instance": "10.0.0.1:9100", "job": "node-exporter"}, "value": [1731700000.0, "0.001"]},
+		  {"metric": {"instance": "Worker-2.Example.com.:9100", "job": "node-exporter"}, "value": [1731700000.0, "0.002"]},
+		  {"metric": {"instance": "[2001:DB8::3]:9100", "job": "node-exporter"}, "value": [1731700000.0, "0.003"]},
+		  {"metric": {"instance": "10.0.0.4:9100", "nodename": "worker-4"}, "value": [1731700000.0, "0.004"]},
+		  {"metric": {"instance": "10.0.0.5:9962", "job": "cilium-agent"}, "value": [1731700000.0, "0.005"]},
+		  {"metric": {"instance": "10.0.0.6:9962", "node": "worker-6"}, "value": [1731700000.0, "0.006"]},
+		  {"metric": {"instance": "10.0.0.7:9962", "kubernetes_node": "Worker-7"}, "value": [1731700000.0, "0.007"]},
+		  {"metric": {"instance": "10.0.0.8:9962", "source_node_name": "worker-8"}, "value": [1731700000.0, "0.008"]}
+		]}}`)
+	}))
+	defer ts.Close()
+
+	client, err := promc.NewClient(ts.URL)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	nm, err := client.FetchNetworkMatrix(context.Background(), "rtt", "", "")
+	if err != nil {
+		t.Fatalf("FetchNetworkMatrix() error = %v", err)
+	}
+	for lookup, want := range map[string]float64{
+		"10.0.0.1":             1,
+		"10.0.0.1:9100":        1,
+		"worker-2":             2,
+		"WORKER-2.example.com": 2,
+		"2001:db8::3":          3,
+		"worker-4":             4,
+		"10.0.0.5":             5,
+		"worker-6":             6,
+		"worker-7":             7,
+		"worker-8":             8,
+	} {
+		m := nm.GetNode(lookup)
+		if m == nil || m.AvgLatencyMs != want {
+			t.Errorf("GetNode(%q) = %+v, want latency %vms", lookup, m, want)
+		}
+	}
+	if m := nm.GetNode("10.0.0.6"); m != nil {
+		t.Errorf("expected a series with a node label keyed by the node, not its instance; got %+v", m)
+	}
+	if m := nm.GetNode("worker-9"); m != nil {
+		t.Errorf("expected no metrics for an unknown node, got %+v", m)
+	}
+}
+
+func TestPrometheus_FetchMatrix_PartialResults(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("query") {
+		case "slow":
+			select {
+			case <-r.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+			return
+		case "bad":
+			http.Error(w, "parse error", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"status": "success", "data": {"resultType": "vector", "result": [
+		  {"metric": {"instance": "10.0.0.1:9962"}, "value": [1731700000.0, "0.004"]}
+		]}}`)
+	}))
+	defer ts.Close()
+
+	client, err := promc.NewClient(ts.URL)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	client.SetNodeQueryTimeout(200 * time.Millisecond)
+
+	start := time.Now()
+	nm, err := client.FetchNetworkMatrix(context.Background(), "rtt", "bad", "slow")
+	if err != nil {
+		t.Fatalf("expected a partial matrix, got error %v", err)
+	}
+	if took := time.Since(start); took > 2*time.Second {
+		t.Fatalf("expected the slow query cut off by its timeout, took %s", took)
+	}
+	if m := nm.GetNode("10.0.0.1"); m == nil || m.AvgLatencyMs != 4 {
+		t.Fatalf("expected the latency of 10.0.0.1, got %+v", m)
+	}
+	if got := nm.MissingDimensions(); !reflect.DeepEqual(got, []string{promc.DimensionBandwidth, promc.DimensionDrop}) {
+		t.Fatalf("expected bandwidth and drop missing, got %v", got)
+	}
+	if !strings.Contains(nm.Missing[promc.DimensionBandwidth], "timed out") || !nm.Has(promc.DimensionLatency) {
+		t.Fatalf("expected the bandwidth timeout recorded, got %+v", nm.Missing)
+	}
+
+	if _, err := client.FetchNetworkMatrix(context.Background(), "", "bad", "slow"); err == nil {
+		t.Fatalf("expected an error when every query fails")
+	}
+}
@@ -0,0 +1,92 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"lead-net-affinity/pkg/config"
+	"lead-net-affinity/pkg/controller"
+	"lead-net-affinity/pkg/graph"
+	promc "lead-net-affinity/pkg/prometheus"
+	"lead-net-affinity/pkg/scoring"
+)
+
+func TestFreshness_Discount(t *testing.T) {
+	now := time.Now()
+	cases := []struct {
+		f    promc.Freshness
+		want float64
+	}{
+		{promc.Freshness{}, 1},
+		{promc.Measured(now.Add(-time.Minute)), 1},
+		{promc.Measured(now.Add(-20 * time.Minute)), 0.5},
+		{promc.Freshness{Confidence: promc.ConfidenceInferred, ObservedAt: now}, 0.5},
+		{promc.Freshness{Confidence: promc.ConfidenceDefault}, 0},
+	}
+	for _, tc := range cases {
+		if got := tc.f.Discount(now, 10*time.Minute); got != tc.want {
+			t.Fatalf("Discount(%+v) = %v, want %v", tc.f, got, tc.want)
+		}
+	}
+	if !promc.Measured(now.Add(-time.Hour)).Stale(now, time.Minute) || promc.Measured(now).Stale(now, 0) {
+		t.Fatal("unexpected Stale result")
+	}
+}
+
+func TestComputeEdgeLatencyPenalty_DiscountsStaleEdges(t *testing.T) {
+	path := graph.Path{Nodes: []graph.NodeID{"a", "b"}}
+	w := scoring.NetWeights{EdgeLatencyWeight: 1, BadEdgeLatencyMs: 10, StaleAfter: time.Minute}
+	pair := promc.ServicePair{Src: "a", Dst: "b"}
+
+	fresh := &promc.ServiceLatencyMatrix{Pairs: map[promc.ServicePair]float64{pair: 30}}
+	if got := scoring.ComputeEdgeLatencyPenalty(path, fresh, w); got != 2 {
+		t.Fatalf("fresh penalty = %v, want 2", got)
+	}
+	stale := &promc.ServiceLatencyMatrix{
+		Pairs:     map[promc.ServicePair]float64{pair: 30},
+		Freshness: map[promc.ServicePair]promc.Freshness{pair: promc.Measured(time.Now().Add(-4 * time.Minute))},
+	}
+	if got := scoring.ComputeEdgeLatencyPenalty(path, stale, w); got < 0.49 || got > 0.51 {
+		t.Fatalf("stale penalty = %v, want ~0.5", got)
+	}
+}
+
+func TestHTTP_QualityReportsMeasuredAndDefaultEdges(t *testing.T) {
+	cfg := &config.Config{
+		NamespaceSelector: []string{"test-ns"},
+		Graph: config.ServiceGraphConfig{
+			Entry:    "a",
+			Services: []config.ServiceNode{{Name: "a", DependsOn: []string{"b", "c"}}, {Name: "b"}, {Name: "c"}},
+		},
+		Prometheus: config.PrometheusConfig{ServicePairLatencyQuery: "lat"},
+	}
+	prom := &fakeProm{lat: map[promc.ServicePair]float64{{Src: "a", Dst: "b"}: 3}}
+	ctrl := controller.New(cfg, &fakeKube{}, prom)
+	ctrl.EnableDryRunForTest()
+	if err := ctrl.ReconcileOnceForTest(context.Background()); err != nil {
+		t.Fatalf("reconcile error: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	ctrl.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/quality", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d", rec.Code)
+	}
+	var q controller.DataQuality
+	if err := json.Unmarshal(rec.Body.Bytes(), &q); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(q.Edges) != 2 {
+		t.Fatalf("expected 2 edges, got %+v", q.Edges)
+	}
+	if e := q.Edges[0]; e.To != "b" || e.Confidence != promc.ConfidenceMeasured || e.LatencyMs == nil || *e.LatencyMs != 3 {
+		t.Fatalf("expected measured a -> b, got %+v", e)
+	}
+	if e := q.Edges[1]; e.To != "c" || e.Confidence != promc.ConfidenceDefault || e.LatencyMs != nil {
+		t.Fatalf("expected default a -> c, got %+v", e)
+	}
+}
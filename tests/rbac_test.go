@@ -0,0 +1,61 @@
+package tests
+
+import (
+	"strings"
+	"testing"
+
+	"lead-net-affinity/pkg/rbac"
+)
+
+func TestRBAC_ClusterRoleMergesVerbsPerResource(t *testing.T) {
+	role := rbac.ClusterRole("lead", rbac.FeatureCore, rbac.FeatureRebalance)
+
+	var podVerbs []string
+	for _, r := range role.Rules {
+		if len(r.Resources) == 1 && r.Resources[0] == "nodes" {
+			t.Fatalf("nodes rule must not be granted without the nodes feature")
+		}
+		if len(r.Resources) == 1 && r.Resources[0] == "pods" {
+			podVerbs = r.Verbs
+		}
+	}
+	if strings.Join(podVerbs, ",") != "get,list,watch,delete" {
+		t.Fatalf("expected merged pod verbs, got %v", podVerbs)
+	}
+}
+
+func TestRBAC_ManifestsAndCapabilities(t *testing.T) {
+	out, err := rbac.Manifests("lead", "ops")
+	if err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	for _, want := range []string{"kind: ServiceAccount", "kind: ClusterRole\n", "kind: ClusterRoleBinding", "namespace: ops", "leadnetaffinitystatuses/status"} {
+		if !strings.Contains(string(out), want) {
+			t.Fatalf("manifests missing %q:\n%s", want, out)
+		}
+	}
+
+	var undetected rbac.Capabilities
+	if !undetected.Has(rbac.FeatureRebalance) || len(undetected.Missing()) != 0 {
+		t.Fatalf("nil capabilities must allow everything")
+	}
+	caps := rbac.Capabilities{rbac.FeatureCore: true}
+	if caps.Has(rbac.FeatureRebalance) || len(caps.Missing()) != len(rbac.AllFeatures)-1 {
+		t.Fatalf("unexpected missing features: %v", caps.Missing())
+	}
+}
+
+func TestRBAC_NamespacedManifestsOmitNodes(t *testing.T) {
+	out, err := rbac.NamespacedManifests("lead", "ops", []string{"app"})
+	if err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	s := string(out)
+	if strings.Contains(s, "nodes") || strings.Contains(s, "ClusterRole") {
+		t.Fatalf("namespaced manifests must not grant cluster-scoped access:\n%s", s)
+	}
+	// one Role in the watched namespace, one status-only Role in the SA namespace
+	if n := strings.Count(s, "\nkind: Role\n"); n != 2 {
+		t.Fatalf("expected 2 Roles, got %d:\n%s", n, s)
+	}
+}
@@ -0,0 +1,60 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"lead-net-affinity/pkg/config"
+	"lead-net-affinity/pkg/controller"
+	promc "lead-net-affinity/pkg/prometheus"
+)
+
+func TestController_ReplayReproducesDecisions(t *testing.T) {
+	cfg, fk, fp := zonePlanFixture()
+	cfg.Prometheus.ServicePairLatencyQuery = "lat"
+	cfg.Prometheus.Auth.BearerToken = "prom-secret"
+	cfg.Server.Debug = config.DebugConfig{Enabled: true, Token: "s3cret", Record: true}
+	fp.lat = map[promc.ServicePair]float64{{Src: "a", Dst: "c"}: 12, {Src: "b", Dst: "c"}: 3}
+	ctrl := controller.New(cfg, fk, fp)
+	ctrl.EnableDryRunForTest()
+	if err := ctrl.ReconcileOnceForTest(context.Background()); err != nil {
+		t.Fatalf("reconcile error: %v", err)
+	}
+
+	ts := httptest.NewServer(ctrl.Handler())
+	defer ts.Close()
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/snapshot", nil)
+	req.Header.Set("Authorization", "Bearer s3cret")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET /snapshot: %v", err)
+	}
+	defer resp.Body.Close()
+	var snap controller.Snapshot
+	if err := json.NewDecoder(resp.Body).Decode(&snap); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if snap.Decisions == nil || len(snap.Calls) == 0 {
+		t.Fatalf("expected recorded calls and decisions, got %+v", snap)
+	}
+	if snap.Config.Prometheus.Auth.BearerToken != config.Redacted || snap.Config.Server.Debug.Token != config.Redacted {
+		t.Fatalf("expected credentials redacted, got %+v", snap.Config.Prometheus.Auth)
+	}
+
+	// The cluster changes after the snapshot; the replay does not see it.
+	fp.lat = nil
+	fk.deploys = nil
+	d, err := controller.Replay(context.Background(), snap)
+	if err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	if d.ID == "" || d.ID != snap.Decisions.ID {
+		t.Fatalf("expected the replay to decide %s, got %s", snap.Decisions.ID, d.ID)
+	}
+	if diff := controller.DiffDecisions(*snap.Decisions, d); !diff.Empty() {
+		t.Fatalf("expected identical decisions, got %+v", diff)
+	}
+}
@@ -0,0 +1,64 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"lead-net-affinity/pkg/config"
+	"lead-net-affinity/pkg/controller"
+)
+
+func TestReport_CurrentPeriod(t *testing.T) {
+	cfg, fk := approvalFixture(config.ApprovalConfig{})
+	ctrl := controller.New(cfg, fk, &fakeProm{})
+	if err := ctrl.ReconcileOnceForTest(context.Background()); err != nil {
+		t.Fatalf("reconcile error: %v", err)
+	}
+	ts := httptest.NewServer(ctrl.Handler())
+	defer ts.Close()
+
+	get := func(query string) (string, string) {
+		t.Helper()
+		resp, err := http.Get(ts.URL + "/report" + query)
+		if err != nil {
+			t.Fatalf("GET /report%s: %v", query, err)
+		}
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("GET /report%s: status %d: %s", query, resp.StatusCode, b)
+		}
+		return string(b), resp.Header.Get("Content-Type")
+	}
+
+	var rep controller.Report
+	body, _ := get("?format=json")
+	if err := json.Unmarshal([]byte(body), &rep); err != nil {
+		t.Fatalf("decode report: %v", err)
+	}
+	if rep.Schedule != config.ReportDaily || rep.Reconciles != 1 || len(rep.TopPaths) != 1 || rep.TopPaths[0].ID != "a-b-c" {
+		t.Fatalf("unexpected report: %+v", rep)
+	}
+	if rep.Start.IsZero() || rep.End.Before(rep.Start) || time.Since(rep.Start) > time.Minute {
+		t.Fatalf("expected the period to start at the first reconcile, got %s to %s", rep.Start, rep.End)
+	}
+
+	md, ctype := get("")
+	for _, want := range []string{"# LEAD placement and health report (daily)", "| 1 | a-b-c |", "1 reconciles", "Not measured"} {
+		if !strings.Contains(md, want) {
+			t.Fatalf("markdown report missing %q:\n%s", want, md)
+		}
+	}
+	if !strings.HasPrefix(ctype, "text/markdown") {
+		t.Fatalf("expected a markdown content type, got %q", ctype)
+	}
+	if html, _ := get("?format=html"); !strings.Contains(html, "<td>a-b-c</td>") {
+		t.Fatalf("html report missing the top path:\n%s", html)
+	}
+}
@@ -0,0 +1,124 @@
+package tests
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+
+	"lead-net-affinity/pkg/config"
+	"lead-net-affinity/pkg/controller"
+	"lead-net-affinity/pkg/kube"
+)
+
+func TestRolloutComplete(t *testing.T) {
+	three := int32(3)
+	d := appsv1.Deployment{Spec: appsv1.DeploymentSpec{Replicas: &three}}
+	d.Generation = 2
+	d.Status = appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 4, UpdatedReplicas: 3, AvailableReplicas: 3}
+	if done, _ := kube.RolloutComplete(&d); done {
+		t.Fatalf("old replica still terminating; rollout must not be complete")
+	}
+	d.Status.Replicas = 3
+	if done, err := kube.RolloutComplete(&d); !done || err != nil {
+		t.Fatalf("expected complete rollout, got %v %v", done, err)
+	}
+	d.Generation = 3
+	if done, _ := kube.RolloutComplete(&d); done {
+		t.Fatalf("unobserved generation must not count as rolled out")
+	}
+}
+
+func TestController_RolloutHaltsOnUnhealthyBatch(t *testing.T) {
+	cfg, fk := approvalFixture(config.ApprovalConfig{})
+	cfg.Rollout = config.RolloutConfig{BatchSize: 1, HealthGate: true}
+	// b and c get new affinity; b's rollout is stuck: c must be deferred.
+	for i := range fk.deploys {
+		d := &fk.deploys[i]
+		d.Status = appsv1.DeploymentStatus{Replicas: *d.Spec.Replicas, UpdatedReplicas: *d.Spec.Replicas, AvailableReplicas: *d.Spec.Replicas}
+		if d.Name == "b" {
+			d.Status.Conditions = []appsv1.DeploymentCondition{{
+				Type: appsv1.DeploymentProgressing, Status: corev1.ConditionFalse, Reason: "ProgressDeadlineExceeded",
+			}}
+		}
+	}
+	kc := &persistingKube{fakeKube: fk, writes: map[string]int{}}
+	ctrl := controller.New(cfg, kc, &fakeProm{})
+
+	for i := 0; i < 2; i++ {
+		if err := ctrl.ReconcileOnceForTest(context.Background()); err != nil {
+			t.Fatalf("reconcile error: %v", err)
+		}
+	}
+	if kc.writes["b"] != 1 || kc.writes["c"] != 0 {
+		t.Fatalf("expected b updated and c deferred, got %v", kc.writes)
+	}
+	st := ctrl.Status()
+	if len(st.Errors) == 0 || !strings.Contains(strings.Join(st.Errors, "\n"), "rollout halted, 1 deployments deferred") {
+		t.Fatalf("expected the halted rollout in the status, got %+v", st.Errors)
+	}
+}
+
+func TestController_RolloutContinuesInLaterReconciles(t *testing.T) {
+	cfg, fk := approvalFixture(config.ApprovalConfig{})
+	cfg.Rollout = config.RolloutConfig{BatchSize: 1, BatchIntervalSeconds: 3600}
+	kc := &persistingKube{fakeKube: fk, writes: map[string]int{}}
+	ctrl := controller.New(cfg, kc, &fakeProm{})
+
+	start := time.Now()
+	for i := 0; i < 2; i++ {
+		if err := ctrl.ReconcileOnceForTest(context.Background()); err != nil {
+			t.Fatalf("reconcile error: %v", err)
+		}
+	}
+	if time.Since(start) > 10*time.Second {
+		t.Fatalf("reconcile blocked on the batch interval")
+	}
+	if kc.writes["b"] != 1 || kc.writes["c"] != 0 {
+		t.Fatalf("expected c to wait for the batch interval, got %v", kc.writes)
+	}
+
+	cfg.Rollout.BatchIntervalSeconds = 0
+	if err := ctrl.ReconcileOnceForTest(context.Background()); err != nil {
+		t.Fatalf("reconcile error: %v", err)
+	}
+	if kc.writes["b"] != 1 || kc.writes["c"] != 1 {
+		t.Fatalf("expected the next batch once the interval passed, got %v", kc.writes)
+	}
+}
+
+// persistingKube lists copies, as the API server does, and keeps what
+// UpdateDeployment writes, so the next reconcile sees the updated
+// deployments; their status stays as the test set it. writes counts the
+// updates that changed a deployment's affinity.
+type persistingKube struct {
+	*fakeKube
+	writes map[string]int
+}
+
+func (p *persistingKube) ListDeployments(ctx context.Context, namespaces []string) ([]appsv1.Deployment, error) {
+	list, err := p.fakeKube.ListDeployments(ctx, namespaces)
+	out := make([]appsv1.Deployment, len(list))
+	for i := range list {
+		list[i].DeepCopyInto(&out[i])
+	}
+	return out, err
+}
+
+func (p *persistingKube) UpdateDeployment(ctx context.Context, d *appsv1.Deployment) error {
+	for i := range p.deploys {
+		if cur := &p.deploys[i]; cur.Namespace == d.Namespace && cur.Name == d.Name {
+			if !equality.Semantic.DeepEqual(cur.Spec.Template.Spec.Affinity, d.Spec.Template.Spec.Affinity) {
+				p.writes[d.Name]++
+			}
+			status := cur.Status
+			*cur = *d.DeepCopy()
+			cur.Status = status
+		}
+	}
+	return p.fakeKube.UpdateDeployment(ctx, d)
+}
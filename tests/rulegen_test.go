@@ -1,11 +1,16 @@
 package tests
 
 import (
+	"reflect"
 	"testing"
 
 	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	"lead-net-affinity/pkg/graph"
+	"lead-net-affinity/pkg/kube"
 	"lead-net-affinity/pkg/rulegen"
 )
 
@@ -36,3 +41,229 @@ func TestGenerateAffinityAndAntiAffinity(t *testing.T) {
 		t.Fatalf("expected anti-affinity section to exist")
 	}
 }
+
+func TestAffinityPlan_ComposesWithinBudget(t *testing.T) {
+	deploys := map[graph.NodeID]*appsv1.Deployment{}
+	for _, n := range []graph.NodeID{"x", "y", "z", "db"} {
+		d := &appsv1.Deployment{}
+		d.Spec.Template.Labels = map[string]string{"io.kompose.service": string(n)}
+		deploys[n] = d
+	}
+	cfg := rulegen.AffinityConfig{MinAffinityWeight: 50, MaxAffinityWeight: 100}
+	weights := func() map[graph.NodeID]int32 {
+		out := map[graph.NodeID]int32{}
+		for _, t := range deploys["db"].Spec.Template.Spec.Affinity.PodAffinity.PreferredDuringSchedulingIgnoredDuringExecution {
+			out[graph.NodeID(t.PodAffinityTerm.LabelSelector.MatchLabels["io.kompose.service"])] = t.Weight
+		}
+		return out
+	}
+
+	var plan rulegen.AffinityPlan
+	plan.AddPath(deploys, graph.Path{Nodes: []graph.NodeID{"x", "db"}}, 100, cfg)
+	plan.AddPath(deploys, graph.Path{Nodes: []graph.NodeID{"y", "db"}}, 60, cfg)
+	plan.AddPath(deploys, graph.Path{Nodes: []graph.NodeID{"x", "db"}}, 20, cfg) // lower duplicate
+	plan.Add(rulegen.AffinityTerm{Target: "db", Peer: "z", Source: rulegen.SourceDependency, Weight: 100,
+		TopologyKey: rulegen.HostnameTopologyKey, Selector: &metav1.LabelSelector{MatchLabels: deploys["z"].Spec.Template.Labels}})
+
+	// Without a budget every peer keeps its strongest term.
+	plan.Apply(deploys, rulegen.WeightBudget{})
+	if got, want := weights(), (map[graph.NodeID]int32{"x": 100, "y": 80, "z": 100}); !reflect.DeepEqual(got, want) {
+		t.Fatalf("unbounded weights = %v, want %v", got, want)
+	}
+
+	// Paths rank first by default: the dependency term is the one dropped.
+	plan.Apply(deploys, rulegen.WeightBudget{MaxTerms: 2, MaxTotalWeight: 90})
+	if got, want := weights(), (map[graph.NodeID]int32{"x": 50, "y": 40}); !reflect.DeepEqual(got, want) {
+		t.Fatalf("budgeted weights = %v, want %v", got, want)
+	}
+
+	plan.Apply(deploys, rulegen.WeightBudget{MaxTerms: 1, Priority: []string{rulegen.SourceDependency, rulegen.SourcePath}})
+	if got, want := weights(), (map[graph.NodeID]int32{"z": 100}); !reflect.DeepEqual(got, want) {
+		t.Fatalf("dependency-first weights = %v, want %v", got, want)
+	}
+}
+
+func TestAffinityPlan_DirectDependencies(t *testing.T) {
+	g := graph.NewGraph("fe", []struct {
+		Name          string
+		DependsOn     []string
+		LabelSelector map[string]string
+	}{
+		{Name: "fe", DependsOn: []string{"cart", "search"}},
+		{Name: "cart", DependsOn: []string{"redis"}},
+		{Name: "search"},
+		{Name: "redis"},
+	})
+	deploys := map[graph.NodeID]*appsv1.Deployment{}
+	for id := range g.Nodes {
+		d := &appsv1.Deployment{}
+		d.Spec.Template.Labels = map[string]string{"io.kompose.service": string(id)}
+		deploys[id] = d
+	}
+
+	var plan rulegen.AffinityPlan
+	plan.AddDependencies(deploys, g, rulegen.DependencyConfig{Weight: 60, Exclude: map[string]bool{"redis": true}},
+		rulegen.AffinityConfig{MaxAffinityWeight: 100})
+	got := map[string]int32{}
+	for _, term := range plan.Terms() {
+		if term.Source != rulegen.SourceDependency {
+			t.Fatalf("unexpected source %q", term.Source)
+		}
+		got[string(term.Peer)+"->"+string(term.Target)] = term.Weight
+	}
+	if want := (map[string]int32{"fe->cart": 60, "fe->search": 60}); !reflect.DeepEqual(got, want) {
+		t.Fatalf("dependency terms = %v, want %v", got, want)
+	}
+
+	var def rulegen.AffinityPlan
+	def.AddDependencies(deploys, g, rulegen.DependencyConfig{}, rulegen.AffinityConfig{MaxAffinityWeight: 70})
+	for _, term := range def.Terms() {
+		if term.Weight != 70 {
+			t.Fatalf("default weight 80 should be capped at maxAffinityWeight 70, got %d", term.Weight)
+		}
+	}
+}
+
+func TestAffinityPlan_MirrorAddsReverseTerms(t *testing.T) {
+	deploys := map[graph.NodeID]*appsv1.Deployment{}
+	for _, n := range []graph.NodeID{"fe", "cart"} {
+		d := &appsv1.Deployment{}
+		d.Spec.Template.Labels = map[string]string{"io.kompose.service": string(n)}
+		deploys[n] = d
+	}
+	var plan rulegen.AffinityPlan
+	plan.AddPath(deploys, graph.Path{Nodes: []graph.NodeID{"fe", "cart"}}, 100, rulegen.AffinityConfig{MinAffinityWeight: 50, MaxAffinityWeight: 90})
+	plan.Mirror(deploys, 0.5, rulegen.AffinityConfig{})
+	plan.Mirror(deploys, 0.5, rulegen.AffinityConfig{}) // reverse terms are not mirrored again
+	plan.Apply(deploys, rulegen.WeightBudget{})
+
+	fwd := deploys["cart"].Spec.Template.Spec.Affinity.PodAffinity.PreferredDuringSchedulingIgnoredDuringExecution
+	rev := deploys["fe"].Spec.Template.Spec.Affinity.PodAffinity.PreferredDuringSchedulingIgnoredDuringExecution
+	if len(fwd) != 1 || fwd[0].Weight != 90 || fwd[0].PodAffinityTerm.LabelSelector.MatchLabels["io.kompose.service"] != "fe" {
+		t.Fatalf("forward term = %+v", fwd)
+	}
+	if len(rev) != 1 || rev[0].Weight != 45 || rev[0].PodAffinityTerm.LabelSelector.MatchLabels["io.kompose.service"] != "cart" ||
+		rev[0].PodAffinityTerm.TopologyKey != rulegen.HostnameTopologyKey {
+		t.Fatalf("reverse term = %+v", rev)
+	}
+}
+
+func TestGenerateCleanAffinity_UsesEdgeLatency(t *testing.T) {
+	path := graph.Path{Nodes: []graph.NodeID{"a", "b", "c"}}
+
+	dA := &appsv1.Deployment{}
+	dA.Spec.Template.Labels = map[string]string{"io.kompose.service": "a"}
+	dB := &appsv1.Deployment{}
+	dB.Spec.Template.Labels = map[string]string{"io.kompose.service": "b"}
+	dC := &appsv1.Deployment{}
+	dC.Spec.Template.Labels = map[string]string{"io.kompose.service": "c"}
+
+	deploys := map[graph.NodeID]*appsv1.Deployment{"a": dA, "b": dB, "c": dC}
+
+	lat := map[[2]graph.NodeID]float64{
+		{"a", "b"}: 100, // slow edge -> boosted to max, same node
+		{"b", "c"}: 1,   // already fast -> zone is enough
+	}
+	cfg := rulegen.AffinityConfig{
+		MinAffinityWeight: 10,
+		MaxAffinityWeight: 100,
+		BadEdgeLatencyMs:  50,
+		ZoneLatencyMs:     2,
+		EdgeLatency: func(src, dst graph.NodeID) (float64, bool) {
+			v, ok := lat[[2]graph.NodeID{src, dst}]
+			return v, ok
+		},
+	}
+	rulegen.GenerateCleanAffinityForPath(deploys, path, 0, cfg)
+
+	tb := dB.Spec.Template.Spec.Affinity.PodAffinity.PreferredDuringSchedulingIgnoredDuringExecution[0]
+	if tb.Weight != 100 || tb.PodAffinityTerm.TopologyKey != rulegen.HostnameTopologyKey {
+		t.Fatalf("slow edge: expected weight=100 on hostname, got weight=%d key=%s",
+			tb.Weight, tb.PodAffinityTerm.TopologyKey)
+	}
+	tc := dC.Spec.Template.Spec.Affinity.PodAffinity.PreferredDuringSchedulingIgnoredDuringExecution[0]
+	if tc.PodAffinityTerm.TopologyKey != rulegen.ZoneTopologyKey {
+		t.Fatalf("fast edge: expected zone topology key, got %s", tc.PodAffinityTerm.TopologyKey)
+	}
+}
+
+func TestApplyLatencyCritical(t *testing.T) {
+	d := &appsv1.Deployment{}
+	d.Spec.Template.Spec.Containers = []corev1.Container{{
+		Name: "app",
+		Resources: corev1.ResourceRequirements{
+			Requests: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse("1500m"),
+				corev1.ResourceMemory: resource.MustParse("256Mi"),
+			},
+			Limits: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("512Mi")},
+		},
+	}}
+
+	rulegen.ApplyLatencyCritical(d, "")
+	rulegen.ApplyLatencyCritical(d, "") // idempotent
+
+	r := d.Spec.Template.Spec.Containers[0].Resources
+	if cpu := r.Requests[corev1.ResourceCPU]; cpu.String() != "2" || !cpu.Equal(r.Limits[corev1.ResourceCPU]) {
+		t.Fatalf("expected 2 whole CPUs with requests == limits, got %v / %v", r.Requests, r.Limits)
+	}
+	if mem := r.Requests[corev1.ResourceMemory]; mem.String() != "512Mi" || !mem.Equal(r.Limits[corev1.ResourceMemory]) {
+		t.Fatalf("expected memory requests == limits == 512Mi, got %v / %v", r.Requests, r.Limits)
+	}
+	if d.Annotations[kube.GuaranteedCPUsAnnotation] != "true" {
+		t.Fatalf("expected the deployment marked %s, got %v", kube.GuaranteedCPUsAnnotation, d.Annotations)
+	}
+	terms := d.Spec.Template.Spec.Affinity.NodeAffinity.PreferredDuringSchedulingIgnoredDuringExecution
+	if len(terms) != 1 || terms[0].Preference.MatchExpressions[0].Key != "lead.io/cpu-manager-policy" ||
+		terms[0].Preference.MatchExpressions[0].Values[0] != "static" {
+		t.Fatalf("unexpected node affinity %+v", terms)
+	}
+}
+
+func TestApplyLatencyCritical_NoMemoryKeepsResources(t *testing.T) {
+	d := &appsv1.Deployment{}
+	d.Spec.Template.Spec.Containers = []corev1.Container{{Name: "app"}}
+	rulegen.ApplyLatencyCritical(d, "cpu-pinning")
+
+	if d.Spec.Template.Spec.Containers[0].Resources.Requests != nil || d.Annotations[kube.GuaranteedCPUsAnnotation] != "" {
+		t.Fatalf("resources should be left alone without a memory amount")
+	}
+	expr := d.Spec.Template.Spec.Affinity.NodeAffinity.PreferredDuringSchedulingIgnoredDuringExecution[0].Preference.MatchExpressions[0]
+	if expr.Key != "cpu-pinning" || expr.Operator != corev1.NodeSelectorOpExists {
+		t.Fatalf("unexpected node selector %+v", expr)
+	}
+}
+
+func TestSpotNodeRules(t *testing.T) {
+	d := &appsv1.Deployment{}
+	labels := []string{"eks.amazonaws.com/capacityType=SPOT", "cloud.google.com/gke-spot=true"}
+
+	rulegen.PreferSpotNodes(d, labels, 20)
+	na := d.Spec.Template.Spec.Affinity.NodeAffinity
+	if len(na.PreferredDuringSchedulingIgnoredDuringExecution) != 2 {
+		t.Fatalf("expected one spot preference per label, got %+v", na.PreferredDuringSchedulingIgnoredDuringExecution)
+	}
+
+	// Switching classes replaces the old rules instead of accumulating.
+	rulegen.AvoidSpotNodes(d, labels, false)
+	pref := na.PreferredDuringSchedulingIgnoredDuringExecution
+	if len(pref) != 1 || pref[0].Weight != 100 || len(pref[0].Preference.MatchExpressions) != 2 ||
+		pref[0].Preference.MatchExpressions[0].Operator != corev1.NodeSelectorOpNotIn {
+		t.Fatalf("expected a single NotIn preference, got %+v", pref)
+	}
+
+	rulegen.AvoidSpotNodes(d, labels, true)
+	rulegen.AvoidSpotNodes(d, labels, true)
+	if len(na.PreferredDuringSchedulingIgnoredDuringExecution) != 0 {
+		t.Fatalf("expected the spot preference to be replaced, got %+v", na.PreferredDuringSchedulingIgnoredDuringExecution)
+	}
+	terms := na.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms
+	if len(terms) != 1 || len(terms[0].MatchExpressions) != 2 {
+		t.Fatalf("expected one required term with two NotIn expressions, got %+v", terms)
+	}
+
+	rulegen.PreferSpotNodes(d, labels, 0)
+	if na.RequiredDuringSchedulingIgnoredDuringExecution != nil || len(na.PreferredDuringSchedulingIgnoredDuringExecution) != 0 {
+		t.Fatalf("expected all spot rules cleared, got %+v", na)
+	}
+}
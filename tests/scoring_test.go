@@ -48,3 +48,114 @@ func TestEstimateHelpers(t *testing.T) {
 		t.Fatal("EstimateServiceEdges wrong")
 	}
 }
+
+type fakePlacementView struct {
+	svcNodes map[graph.NodeID]map[string]int
+	zones    map[string]string
+}
+
+func (f fakePlacementView) NodesForService(svc graph.NodeID) map[string]int { return f.svcNodes[svc] }
+func (f fakePlacementView) ZoneForNode(node string) string                  { return f.zones[node] }
+
+func TestNodeProximityScores(t *testing.T) {
+	view := fakePlacementView{
+		svcNodes: map[graph.NodeID]map[string]int{
+			"mongodb-geo": {"n1": 1},
+			"search":      {"n3": 2},
+		},
+		zones: map[string]string{"n1": "z1", "n2": "z1", "n3": "z2", "n4": "z3"},
+	}
+	neighbors := map[graph.NodeID]float64{"mongodb-geo": 10, "search": 1}
+	w := scoring.ProximityWeights{SameNodeBonus: 2, SameZoneBonus: 1}
+
+	scores := scoring.NodeProximityScores("geo", neighbors, []string{"n1", "n2", "n3", "n4"}, view, w)
+
+	// n1 hosts the heavy dependency, n2 shares its zone, n3 hosts the light one.
+	if scores["n1"] != 20 || scores["n2"] != 10 || scores["n3"] != 2 || scores["n4"] != 0 {
+		t.Fatalf("unexpected proximity scores: %v", scores)
+	}
+	if best := scoring.BestNode(scores); best != "n1" {
+		t.Fatalf("expected best node n1, got %q", best)
+	}
+	if best := scoring.BestNode(map[string]float64{"n4": 0}); best != "" {
+		t.Fatalf("expected no best node when all scores are 0, got %q", best)
+	}
+}
+
+func TestNodeProximityScores_ReplicaAggregation(t *testing.T) {
+	// The dependency runs two pods in z1 (one on n1) and two in z2.
+	view := fakePlacementView{
+		svcNodes: map[graph.NodeID]map[string]int{"db": {"n1": 1, "n2": 1, "n3": 2}},
+		zones:    map[string]string{"n1": "z1", "n2": "z1", "n3": "z2", "n4": "z3"},
+	}
+	neighbors := map[graph.NodeID]float64{"db": 1}
+	candidates := []string{"n1", "n3", "n4"}
+
+	for _, tc := range []struct {
+		agg  string
+		want map[string]float64
+	}{
+		{"", map[string]float64{"n1": 4, "n3": 4, "n4": 0}},
+		{scoring.AggregateMin, map[string]float64{"n1": 0, "n3": 0, "n4": 0}},
+		// n1: 4 (own pod) + 1 (zone peer) of 4 pods; n3: 4+4 of 4.
+		{scoring.AggregateWeighted, map[string]float64{"n1": 1.25, "n3": 2, "n4": 0}},
+	} {
+		w := scoring.ProximityWeights{SameNodeBonus: 4, SameZoneBonus: 1, ReplicaAggregation: tc.agg}
+		got := scoring.NodeProximityScores("api", neighbors, candidates, view, w)
+		for n, want := range tc.want {
+			if math.Abs(got[n]-want) > 1e-9 {
+				t.Fatalf("aggregation %q: scores = %v, want %v", tc.agg, got, tc.want)
+			}
+		}
+	}
+
+	all := fakePlacementView{
+		svcNodes: map[graph.NodeID]map[string]int{"db": {"n1": 1, "n2": 1}},
+		zones:    map[string]string{"n1": "z1", "n2": "z1"},
+	}
+	w := scoring.ProximityWeights{SameNodeBonus: 4, SameZoneBonus: 1, ReplicaAggregation: scoring.AggregateMin}
+	if got := scoring.NodeProximityScores("api", neighbors, []string{"n1"}, all, w); got["n1"] != 1 {
+		t.Fatalf("min with every replica in the zone = %v, want 1", got["n1"])
+	}
+	if r := scoring.Replicas(view, "db"); len(r) != 4 || r[3] != (scoring.Replica{Node: "n3", Zone: "z2"}) {
+		t.Fatalf("Replicas = %+v", r)
+	}
+}
+
+func TestPlanJointPlacement_ColocatesGroup(t *testing.T) {
+	services := []struct {
+		Name          string
+		DependsOn     []string
+		LabelSelector map[string]string
+	}{
+		{Name: "frontend", DependsOn: []string{"search"}},
+		{Name: "search", DependsOn: []string{"geo"}},
+		{Name: "geo", DependsOn: []string{"mongodb-geo"}},
+		{Name: "mongodb-geo"},
+	}
+	g := graph.NewGraph("frontend", services)
+
+	// mongodb-geo already runs on n2; the rest of the path is pending.
+	view := fakePlacementView{
+		svcNodes: map[graph.NodeID]map[string]int{"mongodb-geo": {"n2": 1}},
+	}
+	group := []graph.NodeID{"frontend", "search", "geo"}
+	w := scoring.ProximityWeights{SameNodeBonus: 1}
+
+	plan := scoring.PlanJointPlacement(group, g, nil, []string{"n1", "n2", "n3"}, view, w, 0)
+	for _, svc := range group {
+		if plan[svc] != "n2" {
+			t.Fatalf("expected whole group on n2, got %v", plan)
+		}
+	}
+
+	// With a cap of 2 per node, one member must spill over.
+	capped := scoring.PlanJointPlacement(group, g, nil, []string{"n1", "n2", "n3"}, view, w, 2)
+	perNode := map[string]int{}
+	for _, n := range capped {
+		perNode[n]++
+	}
+	if len(capped) != 3 || perNode["n2"] != 2 {
+		t.Fatalf("expected 2 members on n2 and one elsewhere, got %v", capped)
+	}
+}
@@ -0,0 +1,164 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"lead-net-affinity/pkg/config"
+	"lead-net-affinity/pkg/controller"
+	"lead-net-affinity/pkg/simulate"
+)
+
+func simNode(name, zone string) corev1.Node {
+	return corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{
+			"kubernetes.io/hostname": name, "topology.kubernetes.io/zone": zone,
+		}},
+		Status: corev1.NodeStatus{
+			Allocatable: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse("4"),
+				corev1.ResourceMemory: resource.MustParse("8Gi"),
+				corev1.ResourcePods:   resource.MustParse("110"),
+			},
+			Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: corev1.ConditionTrue}},
+		},
+	}
+}
+
+func simPod(name, svc, node, cpu string) corev1.Pod {
+	return corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "test-ns", Labels: map[string]string{"io.kompose.service": svc}},
+		Spec: corev1.PodSpec{NodeName: node, Containers: []corev1.Container{{Name: svc, Resources: corev1.ResourceRequirements{
+			Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse(cpu)},
+		}}}},
+		Status: corev1.PodStatus{Phase: corev1.PodRunning},
+	}
+}
+
+func simWorkload(name, cpu string, replicas int, peer string) simulate.Workload {
+	tmpl := simPod("", name, "", cpu)
+	w := simulate.Workload{
+		Name: name, Namespace: "test-ns", Replicas: replicas,
+		Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"io.kompose.service": name}},
+		Template: corev1.PodTemplateSpec{ObjectMeta: tmpl.ObjectMeta, Spec: tmpl.Spec},
+	}
+	if peer != "" {
+		w.Template.Spec.Affinity = &corev1.Affinity{PodAffinity: &corev1.PodAffinity{
+			PreferredDuringSchedulingIgnoredDuringExecution: []corev1.WeightedPodAffinityTerm{{Weight: 100, PodAffinityTerm: corev1.PodAffinityTerm{
+				LabelSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"io.kompose.service": peer}},
+				TopologyKey:   "kubernetes.io/hostname",
+			}}},
+		}}
+	}
+	return w
+}
+
+func TestSimulate_PodAffinityAndCapacity(t *testing.T) {
+	snap := simulate.Snapshot{
+		Nodes: []corev1.Node{simNode("n1", "a"), simNode("n2", "a"), simNode("n3", "b")},
+		Pods:  []corev1.Pod{simPod("db-1", "db", "n3", "1"), simPod("api-old", "api", "n1", "1")},
+	}
+
+	got := simulate.Run(snap, []simulate.Workload{simWorkload("api", "1", 2, "db")})
+	if got[0].Nodes["n3"] != 2 || got[0].Zones["b"] != 2 {
+		t.Fatalf("expected both api pods next to db on n3, got %+v", got[0])
+	}
+
+	// Only one 2-CPU pod still fits next to db; the other spreads out.
+	got = simulate.Run(snap, []simulate.Workload{simWorkload("api", "2", 2, "db")})
+	if got[0].Nodes["n3"] != 1 || got[0].Unschedulable != 0 {
+		t.Fatalf("expected one api pod on n3 and one elsewhere, got %+v", got[0])
+	}
+
+	got = simulate.Run(snap, []simulate.Workload{simWorkload("api", "5", 1, "")})
+	if got[0].Unschedulable != 1 || !strings.Contains(got[0].Reason, "0/3 nodes are available: 3 Insufficient cpu") {
+		t.Fatalf("expected an unschedulable pod, got %+v", got[0])
+	}
+
+	// Without affinity an empty node wins over n3; api-old was replaced,
+	// so n1 and n2 tie and the first by name is taken.
+	got = simulate.Run(snap, []simulate.Workload{simWorkload("api", "1", 1, "")})
+	if got[0].Nodes["n1"] != 1 {
+		t.Fatalf("expected the pod on the empty node n1, got %+v", got[0])
+	}
+}
+
+func TestSimulate_TaintsAndRequiredAntiAffinity(t *testing.T) {
+	tainted := simNode("n1", "a")
+	tainted.Spec.Taints = []corev1.Taint{{Key: "dedicated", Value: "gpu", Effect: corev1.TaintEffectNoSchedule}}
+	snap := simulate.Snapshot{Nodes: []corev1.Node{tainted, simNode("n2", "a")}}
+
+	w := simWorkload("api", "1", 2, "")
+	w.Template.Spec.Affinity = &corev1.Affinity{PodAntiAffinity: &corev1.PodAntiAffinity{
+		RequiredDuringSchedulingIgnoredDuringExecution: []corev1.PodAffinityTerm{{
+			LabelSelector: w.Selector, TopologyKey: "kubernetes.io/hostname",
+		}},
+	}}
+	got := simulate.Run(snap, []simulate.Workload{w})[0]
+	if got.Nodes["n2"] != 1 || got.Unschedulable != 1 || !strings.Contains(got.Reason, "1 node(s) had untolerated taint") {
+		t.Fatalf("expected one pod on n2 and one unschedulable, got %+v", got)
+	}
+}
+
+func TestController_SimulateEndpoint(t *testing.T) {
+	cfg, fk := approvalFixture(config.ApprovalConfig{})
+	cfg.Server.Debug.Token = "s3cret"
+	fk.nodes = []corev1.Node{simNode("n1", "a"), simNode("n2", "a"), simNode("n3", "b")}
+	fk.pods = []corev1.Pod{
+		simPod("a-1", "a", "n1", "100m"),
+		simPod("b-1", "b", "n2", "100m"),
+		simPod("c-1", "c", "n3", "100m"),
+	}
+	ctrl := controller.New(cfg, fk, &fakeProm{})
+	ctrl.EnableDryRunForTest()
+
+	ts := httptest.NewServer(ctrl.Handler())
+	defer ts.Close()
+	resp, err := http.Get(ts.URL + "/simulate")
+	if err != nil {
+		t.Fatalf("GET /simulate: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without the token, got %d", resp.StatusCode)
+	}
+	resp, err = withToken(http.MethodGet, ts.URL+"/simulate", "s3cret")
+	if err != nil {
+		t.Fatalf("GET /simulate: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404 before the first reconcile, got %d", resp.StatusCode)
+	}
+
+	if err := ctrl.ReconcileOnceForTest(context.Background()); err != nil {
+		t.Fatalf("reconcile error: %v", err)
+	}
+	resp, err = withToken(http.MethodGet, ts.URL+"/simulate?service=b", "s3cret")
+	if err != nil {
+		t.Fatalf("GET /simulate: %v", err)
+	}
+	defer resp.Body.Close()
+	var sim controller.Simulation
+	if err := json.NewDecoder(resp.Body).Decode(&sim); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(sim.Services) != 1 || sim.Services[0].Service != "b" {
+		t.Fatalf("expected a simulation of b, got %+v", sim)
+	}
+	b := sim.Services[0]
+	if b.Current["n2"] != 1 || b.Predicted.Nodes["n1"] != 1 {
+		t.Fatalf("expected b predicted to move from n2 next to a on n1, got %+v", b)
+	}
+	if len(b.Peers) != 1 || b.Peers[0].Peer != "a" || b.Peers[0].Current != 0 || b.Peers[0].Predicted != 1 {
+		t.Fatalf("expected co-location with a to go from 0 to 1, got %+v", b.Peers)
+	}
+}
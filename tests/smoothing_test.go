@@ -0,0 +1,78 @@
+package tests
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"lead-net-affinity/pkg/config"
+	"lead-net-affinity/pkg/controller"
+	"lead-net-affinity/pkg/history"
+	promc "lead-net-affinity/pkg/prometheus"
+)
+
+func TestFilter_RejectsSpikesAndFollowsShifts(t *testing.T) {
+	f := history.NewFilter(5, true, 0, 3)
+	for _, v := range []float64{10, 11, 9, 10} {
+		f.Add(v)
+	}
+	if got, rejected := f.Add(500); !rejected || got != 10 {
+		t.Fatalf("expected the spike rejected and 10 kept, got %v (rejected %v)", got, rejected)
+	}
+	if got, rejected := f.Add(10.5); rejected || got != 10 {
+		t.Fatalf("expected a normal sample accepted, got %v (rejected %v)", got, rejected)
+	}
+	// Three samples in a row at a new level: the level has moved.
+	var got float64
+	for _, v := range []float64{40, 41, 39} {
+		got, _ = f.Add(v)
+	}
+	if got != 40 {
+		t.Fatalf("expected the filter to follow the shift to 40, got %v", got)
+	}
+
+	e := history.NewFilter(5, false, 0.5, 0)
+	e.Add(10)
+	if got, _ := e.Add(20); got != 15 {
+		t.Fatalf("ewma(10, 20) with alpha 0.5 = %v, want 15", got)
+	}
+}
+
+func TestController_SmoothingIgnoresSingleSpike(t *testing.T) {
+	cfg := &config.Config{
+		NamespaceSelector: []string{"test-ns"},
+		Graph: config.ServiceGraphConfig{
+			Entry:    "a",
+			Services: []config.ServiceNode{{Name: "a", DependsOn: []string{"b"}}, {Name: "b"}},
+		},
+		Scoring:     config.ScoringWeights{BadLatencyMs: 10, BadDropRate: 1},
+		Rebalancing: config.RebalancingConfig{BadNodeMode: config.BadNodeTaint},
+		Smoothing:   config.SmoothingConfig{Method: config.SmoothMedian, OutlierMADs: 3},
+	}
+	tk := &taintKube{fakeKube: &fakeKube{nodes: []corev1.Node{{ObjectMeta: metav1.ObjectMeta{Name: "n1"}}}}}
+	prom := &matrixProm{}
+	ctrl := controller.New(cfg, tk, prom)
+
+	reconcile := func(latency float64) {
+		t.Helper()
+		prom.nm = &promc.NetworkMatrix{Nodes: map[string]*promc.NodeMetrics{"n1": {NodeID: "n1", AvgLatencyMs: latency}}}
+		if err := ctrl.ReconcileOnceForTest(context.Background()); err != nil {
+			t.Fatalf("reconcile error: %v", err)
+		}
+	}
+	for _, v := range []float64{2, 2.2, 1.8, 2, 80, 2.1} {
+		reconcile(v)
+	}
+	if len(tk.calls) != 0 {
+		t.Fatalf("a single GC-pause sample must not taint the node, got %v", tk.calls)
+	}
+	for i := 0; i < 3; i++ {
+		reconcile(80)
+	}
+	if !strings.Contains(strings.Join(tk.calls, ","), "n1=true") {
+		t.Fatalf("a sustained latency increase should taint the node, got %v", tk.calls)
+	}
+}
@@ -0,0 +1,44 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"lead-net-affinity/pkg/metrics"
+	"lead-net-affinity/pkg/supervise"
+)
+
+func TestSupervise_LoopRestartsAfterPanic(t *testing.T) {
+	labels := map[string]string{"loop": "test-restart"}
+	before := metrics.Default.Value("lead_net_loop_restarts_total", labels)
+	runs := 0
+	loop := supervise.Loop{Name: "test-restart", InitialBackoff: time.Millisecond, MaxBackoff: time.Second}
+	err := loop.Run(context.Background(), func(context.Context) error {
+		runs++
+		if runs < 3 {
+			panic("boom")
+		}
+		return errors.New("done")
+	})
+	if err == nil || err.Error() != "done" || runs != 3 {
+		t.Fatalf("expected fn's error after two restarts, got %v after %d runs", err, runs)
+	}
+	if got := metrics.Default.Value("lead_net_loop_restarts_total", labels) - before; got != 2 {
+		t.Fatalf("expected 2 restarts counted, got %v", got)
+	}
+}
+
+func TestSupervise_LoopGivesUp(t *testing.T) {
+	runs := 0
+	loop := supervise.Loop{Name: "test-give-up", InitialBackoff: time.Millisecond, MaxBackoff: time.Second, MaxCrashes: 3}
+	err := loop.Run(context.Background(), func(context.Context) error {
+		runs++
+		panic("boom")
+	})
+	var pe *supervise.PanicError
+	if !errors.As(err, &pe) || pe.Value != "boom" || runs != 3 {
+		t.Fatalf("expected the panic after 3 crashes, got %v after %d runs", err, runs)
+	}
+}
@@ -0,0 +1,108 @@
+package tests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"lead-net-affinity/pkg/config"
+	"lead-net-affinity/pkg/controller"
+)
+
+// surgeKube starts a Ready replica on node "good" whenever a deployment is
+// scaled up.
+type surgeKube struct {
+	*fakeKube
+	deltas []int32
+}
+
+func (s *surgeKube) ScaleDeployment(_ context.Context, namespace, _ string, delta int32) (int32, error) {
+	s.deltas = append(s.deltas, delta)
+	if delta > 0 {
+		s.pods = append(s.pods, corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "a-new", Namespace: namespace, Labels: map[string]string{"io.kompose.service": "a"}},
+			Spec:       corev1.PodSpec{NodeName: "good"},
+			Status: corev1.PodStatus{Phase: corev1.PodRunning, Conditions: []corev1.PodCondition{
+				{Type: corev1.PodReady, Status: corev1.ConditionTrue},
+			}},
+		})
+	}
+	return 2, nil
+}
+
+func surgeFixture() (*config.Config, *fakeKube, []appsv1.Deployment) {
+	cfg := &config.Config{
+		NamespaceSelector: []string{"test-ns"},
+		Graph:             config.ServiceGraphConfig{Entry: "a", Services: []config.ServiceNode{{Name: "a"}}},
+		Rebalancing:       config.RebalancingConfig{DeletionsPerSecond: 100, SurgeBeforeEvict: true},
+	}
+	fk := &fakeKube{pods: []corev1.Pod{{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "a-1", Namespace: "test-ns", CreationTimestamp: metav1.NewTime(time.Now().Add(-time.Hour)),
+			Labels: map[string]string{"io.kompose.service": "a"},
+		},
+		Spec: corev1.PodSpec{NodeName: "bad"},
+	}}}
+	deploys := []appsv1.Deployment{{ObjectMeta: metav1.ObjectMeta{
+		Name: "a", Namespace: "test-ns", Labels: map[string]string{"io.kompose.service": "a"},
+	}}}
+	return cfg, fk, deploys
+}
+
+func TestController_SurgeBeforeEvict(t *testing.T) {
+	t.Setenv("LEAD_NET_DRY_DELETE", "false")
+	cfg, fk, deploys := surgeFixture()
+	sk := &surgeKube{fakeKube: fk}
+
+	ctrl := controller.New(cfg, sk, &fakeProm{})
+	if err := ctrl.RebalancePods(context.Background(), deploys, []string{"bad"}); err != nil {
+		t.Fatalf("rebalance error: %v", err)
+	}
+	if got := fk.deleted.Load(); got != 1 {
+		t.Fatalf("expected the old pod deleted once the replacement was Ready, got %d deletions", got)
+	}
+	if len(sk.deltas) != 2 || sk.deltas[0] != 1 || sk.deltas[1] != -1 {
+		t.Fatalf("expected scale +1 then -1, got %v", sk.deltas)
+	}
+}
+
+// hpaKube reports every deployment as scaled by a HorizontalPodAutoscaler.
+type hpaKube struct{ *surgeKube }
+
+func (h *hpaKube) HPATargets(_ context.Context, _ []string) (map[string]bool, error) {
+	return map[string]bool{"test-ns/a": true}, nil
+}
+
+func TestController_SurgeBeforeEvict_SkipsHPATargets(t *testing.T) {
+	t.Setenv("LEAD_NET_DRY_DELETE", "false")
+	cfg, fk, deploys := surgeFixture()
+	sk := &surgeKube{fakeKube: fk}
+
+	ctrl := controller.New(cfg, &hpaKube{sk}, &fakeProm{})
+	if err := ctrl.RebalancePods(context.Background(), deploys, []string{"bad"}); err != nil {
+		t.Fatalf("rebalance error: %v", err)
+	}
+	if got := fk.deleted.Load(); got != 1 {
+		t.Fatalf("expected the pod deleted directly, got %d deletions", got)
+	}
+	if len(sk.deltas) != 0 {
+		t.Fatalf("expected no surge of an HPA target, got scale deltas %v", sk.deltas)
+	}
+}
+
+func TestController_SurgeBeforeEvict_KeepsPodWhenUnscalable(t *testing.T) {
+	t.Setenv("LEAD_NET_DRY_DELETE", "false")
+	cfg, fk, deploys := surgeFixture()
+
+	ctrl := controller.New(cfg, fk, &fakeProm{})
+	if err := ctrl.RebalancePods(context.Background(), deploys, []string{"bad"}); err != nil {
+		t.Fatalf("rebalance error: %v", err)
+	}
+	if got := fk.deleted.Load(); got != 0 {
+		t.Fatalf("expected the pod kept without a surge, got %d deletions", got)
+	}
+}
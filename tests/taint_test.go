@@ -0,0 +1,83 @@
+package tests
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"lead-net-affinity/pkg/config"
+	"lead-net-affinity/pkg/controller"
+	"lead-net-affinity/pkg/kube"
+	promc "lead-net-affinity/pkg/prometheus"
+)
+
+// taintKube records SetNodeTaint calls as "node=present".
+type taintKube struct {
+	*fakeKube
+	calls []string
+}
+
+func (k *taintKube) SetNodeTaint(_ context.Context, name string, t corev1.Taint, present bool) error {
+	if t.Key != kube.DegradedTaint.Key {
+		return nil
+	}
+	k.calls = append(k.calls, name+"="+map[bool]string{true: "true", false: "false"}[present])
+	return nil
+}
+
+// matrixProm returns a fixed network matrix.
+type matrixProm struct {
+	fakeProm
+	nm *promc.NetworkMatrix
+}
+
+func (p *matrixProm) FetchNetworkMatrix(_ context.Context, _, _, _ string) (*promc.NetworkMatrix, error) {
+	return p.nm, nil
+}
+
+func TestController_TaintModeTracksBadNodes(t *testing.T) {
+	cfg := &config.Config{
+		NamespaceSelector: []string{"test-ns"},
+		Graph: config.ServiceGraphConfig{
+			Entry:    "a",
+			Services: []config.ServiceNode{{Name: "a", DependsOn: []string{"b"}}, {Name: "b"}},
+		},
+		Scoring:     config.ScoringWeights{BadLatencyMs: 10, BadDropRate: 1},
+		Rebalancing: config.RebalancingConfig{BadNodeMode: config.BadNodeTaint},
+	}
+	tk := &taintKube{fakeKube: &fakeKube{nodes: []corev1.Node{
+		{ObjectMeta: metav1.ObjectMeta{Name: "recovered"}, Spec: corev1.NodeSpec{Taints: []corev1.Taint{kube.DegradedTaint}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "slow"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "fine"}},
+	}}}
+	prom := &matrixProm{nm: &promc.NetworkMatrix{Nodes: map[string]*promc.NodeMetrics{
+		"recovered": {NodeID: "recovered", AvgLatencyMs: 1},
+		"slow":      {NodeID: "slow", AvgLatencyMs: 50},
+		"fine":      {NodeID: "fine", AvgLatencyMs: 1},
+	}}}
+
+	ctrl := controller.New(cfg, tk, prom)
+	if err := ctrl.ReconcileOnceForTest(context.Background()); err != nil {
+		t.Fatalf("reconcile error: %v", err)
+	}
+	sort.Strings(tk.calls)
+	if strings.Join(tk.calls, ",") != "recovered=false,slow=true" {
+		t.Fatalf("expected slow tainted and recovered untainted, got %v", tk.calls)
+	}
+}
+
+func TestConfigLoad_RejectsUnknownBadNodeMode(t *testing.T) {
+	fp := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(fp, []byte("graph: {entry: a}\nrebalancing: {badNodeMode: cordon}\n"), 0644); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	if _, err := config.Load(fp); err == nil || !strings.Contains(err.Error(), "badNodeMode") {
+		t.Fatalf("expected badNodeMode error, got %v", err)
+	}
+}
@@ -0,0 +1,153 @@
+package tests
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"lead-net-affinity/pkg/config"
+	"lead-net-affinity/pkg/controller"
+	"lead-net-affinity/pkg/kube"
+)
+
+func TestConfigForTenant(t *testing.T) {
+	y := `
+namespaceSelector: ["shared"]
+graph:
+  entry: frontend
+scoring:
+  rpsWeight: 1
+affinity:
+  topPaths: 3
+tenants:
+  - name: payments
+    namespaceSelector: ["payments"]
+    deploymentSelector: {team: payments}
+    graph:
+      entry: checkout
+      services:
+        - name: checkout
+          dependsOn: ["ledger"]
+    scoring:
+      rpsWeight: 5
+  - name: search
+    graph:
+      entry: search
+`
+	dir := t.TempDir()
+	fp := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(fp, []byte(y), 0644); err != nil {
+		t.Fatalf("write temp yaml: %v", err)
+	}
+	cfg, err := config.Load(fp)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if len(cfg.Tenants) != 2 {
+		t.Fatalf("expected 2 tenants, got %+v", cfg.Tenants)
+	}
+
+	pay := cfg.ForTenant(cfg.Tenants[0])
+	if pay.Graph.Entry != "checkout" || pay.NamespaceSelector[0] != "payments" || pay.DeploymentSelector["team"] != "payments" {
+		t.Fatalf("tenant scope not applied: %+v", pay)
+	}
+	if pay.Scoring.RPSWeight != 5 || pay.Affinity.TopPaths != 3 {
+		t.Fatalf("expected scoring override and inherited affinity, got %+v %+v", pay.Scoring, pay.Affinity)
+	}
+	if len(pay.Tenants) != 0 {
+		t.Fatalf("tenant config must not carry tenants, got %+v", pay.Tenants)
+	}
+
+	search := cfg.ForTenant(cfg.Tenants[1])
+	if search.NamespaceSelector[0] != "shared" || search.Scoring.RPSWeight != 1 {
+		t.Fatalf("expected namespaces and scoring inherited, got %+v %+v", search.NamespaceSelector, search.Scoring)
+	}
+
+	dup := strings.Replace(y, "name: search", "name: payments", 1)
+	if err := os.WriteFile(fp, []byte(dup), 0644); err != nil {
+		t.Fatalf("write temp yaml: %v", err)
+	}
+	if _, err := config.Load(fp); err == nil || !strings.Contains(err.Error(), "duplicate") {
+		t.Fatalf("expected duplicate tenant error, got %v", err)
+	}
+}
+
+func TestController_DeploymentSelectorIsolatesTenants(t *testing.T) {
+	cfg := &config.Config{
+		NamespaceSelector:  []string{"test-ns"},
+		DeploymentSelector: map[string]string{"team": "payments"},
+		Graph: config.ServiceGraphConfig{
+			Entry:    "a",
+			Services: []config.ServiceNode{{Name: "a", DependsOn: []string{"b"}}, {Name: "b"}},
+		},
+		Scoring:  config.ScoringWeights{PathLengthWeight: 1, PodCountWeight: 1, ServiceEdgesWeight: 1},
+		Affinity: config.AffinityConfig{TopPaths: 1, MinAffinityWeight: 50, MaxAffinityWeight: 100},
+	}
+	deploy := func(name, team string) appsv1.Deployment {
+		return appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{
+			Name: name, Namespace: "test-ns", Labels: map[string]string{"io.kompose.service": name, "team": team},
+		}, Spec: appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{
+			ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"io.kompose.service": name}},
+		}}}
+	}
+	fk := &fakeKube{deploys: []appsv1.Deployment{deploy("a", "payments"), deploy("b", "search")}}
+
+	ctrl := controller.New(cfg, fk, &fakeProm{})
+	ctrl.SetTenant("payments")
+	if err := ctrl.ReconcileOnceForTest(context.Background()); err != nil {
+		t.Fatalf("reconcile error: %v", err)
+	}
+	if fk.updated != 1 {
+		t.Fatalf("expected only the tenant's deployment to be updated, got %d updates", fk.updated)
+	}
+	if fk.deploys[1].Spec.Template.Spec.Affinity != nil {
+		t.Fatalf("deployment of another team was modified: %+v", fk.deploys[1].Spec.Template.Spec.Affinity)
+	}
+}
+
+func TestController_IgnoreAnnotationOptsOut(t *testing.T) {
+	cfg := &config.Config{
+		NamespaceSelector: []string{"test-ns"},
+		Graph: config.ServiceGraphConfig{
+			Entry:    "a",
+			Services: []config.ServiceNode{{Name: "a", DependsOn: []string{"b", "c"}}, {Name: "b"}, {Name: "c"}},
+		},
+		Scoring:  config.ScoringWeights{PathLengthWeight: 1, PodCountWeight: 1, ServiceEdgesWeight: 1},
+		Affinity: config.AffinityConfig{TopPaths: 2, MinAffinityWeight: 50, MaxAffinityWeight: 100},
+	}
+	deploy := func(name, ignore string) appsv1.Deployment {
+		d := appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{
+			Name: name, Namespace: "test-ns", Labels: map[string]string{"io.kompose.service": name},
+		}, Spec: appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{
+			ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"io.kompose.service": name}},
+		}}}
+		if ignore != "" {
+			d.Annotations = map[string]string{kube.IgnoreAnnotation: ignore}
+		}
+		return d
+	}
+	fk := &fakeKube{deploys: []appsv1.Deployment{deploy("a", ""), deploy("b", "true"), deploy("c", "false")}}
+
+	ctrl := controller.New(cfg, fk, &fakeProm{})
+	if err := ctrl.ReconcileOnceForTest(context.Background()); err != nil {
+		t.Fatalf("reconcile error: %v", err)
+	}
+	if fk.deploys[1].Spec.Template.Spec.Affinity != nil {
+		t.Fatalf("ignored deployment was modified: %+v", fk.deploys[1].Spec.Template.Spec.Affinity)
+	}
+	var managed []string
+	for _, sa := range ctrl.Decisions().Affinity {
+		managed = append(managed, sa.Service)
+	}
+	// c is annotated ignore=false and still gets its affinity.
+	if !reflect.DeepEqual(managed, []string{"c"}) {
+		t.Fatalf("expected affinity decisions for c only, got %v", managed)
+	}
+}
@@ -0,0 +1,63 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	promc "lead-net-affinity/pkg/prometheus"
+	"lead-net-affinity/pkg/tracing"
+)
+
+const jaegerTraces = `{"data":[{
+  "traceID":"t1",
+  "spans":[
+    {"spanID":"s1","duration":20000,"processID":"p1","references":[]},
+    {"spanID":"s2","duration":8000,"processID":"p2","references":[{"refType":"CHILD_OF","spanID":"s1"}]},
+    {"spanID":"s3","duration":3000,"processID":"p2","references":[{"refType":"CHILD_OF","spanID":"s2"}]},
+    {"spanID":"s4","duration":2000,"processID":"p3","references":[{"refType":"CHILD_OF","spanID":"s3"}]}
+  ],
+  "processes":{"p1":{"serviceName":"frontend"},"p2":{"serviceName":"search"},"p3":{"serviceName":"profile"}}
+}]}`
+
+func TestTracing_FetchEdgesFromJaeger(t *testing.T) {
+	var services []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/traces" || r.URL.Query().Get("start") == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		services = append(services, r.URL.Query().Get("service"))
+		_, _ = w.Write([]byte(jaegerTraces))
+	}))
+	defer srv.Close()
+
+	c, err := tracing.NewClient(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Both services return the same trace; it must only be counted once.
+	edges, err := c.FetchEdges(context.Background(), []string{"frontend", "search"}, 10*time.Second, 50)
+	if err != nil {
+		t.Fatalf("FetchEdges: %v", err)
+	}
+	if len(services) != 2 {
+		t.Fatalf("expected one query per service, got %v", services)
+	}
+	if len(edges.Pairs) != 2 {
+		t.Fatalf("expected frontend->search and search->profile (in-service spans skipped), got %v", edges.Pairs)
+	}
+
+	fs := edges.Pairs[promc.ServicePair{Src: "frontend", Dst: "search"}]
+	if fs == nil || fs.Calls != 1 || fs.Percentile(0.5) != 8 {
+		t.Fatalf("unexpected frontend->search stats: %+v", fs)
+	}
+	if v, _ := edges.RPS().RPS("frontend", "search"); v != 0.1 {
+		t.Fatalf("expected 1 call / 10s = 0.1 rps, got %v", v)
+	}
+	if v, ok := edges.Latency(0.5).Latency("search", "profile"); !ok || v != 2 {
+		t.Fatalf("expected search->profile latency 2ms, got %v (%v)", v, ok)
+	}
+}
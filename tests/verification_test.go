@@ -0,0 +1,118 @@
+package tests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"lead-net-affinity/pkg/config"
+	"lead-net-affinity/pkg/controller"
+	"lead-net-affinity/pkg/rulegen"
+)
+
+func verificationPod(name, svc, node string) corev1.Pod {
+	return corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name, Namespace: "test-ns",
+			Labels:            map[string]string{"io.kompose.service": svc, "topology.kubernetes.io/zone": "z1"},
+			CreationTimestamp: metav1.NewTime(time.Now().Add(-10 * time.Minute)),
+		},
+		Spec:   corev1.PodSpec{NodeName: node},
+		Status: corev1.PodStatus{Phase: corev1.PodRunning},
+	}
+}
+
+func ruleVerification(ctrl *controller.Controller, svc, peer string) (controller.RuleVerification, bool) {
+	for _, r := range ctrl.Verification().Rules {
+		if r.Service == svc && r.Peer == peer {
+			return r, true
+		}
+	}
+	return controller.RuleVerification{}, false
+}
+
+func TestController_VerifiesPlacementAndEscalates(t *testing.T) {
+	cfg, fk := approvalFixture(config.ApprovalConfig{})
+	cfg.Affinity.Verification = config.VerificationConfig{Enabled: true, FailureThreshold: 2, Escalate: true}
+	// b landed next to a; c did not land next to b.
+	fk.pods = []corev1.Pod{
+		verificationPod("a-1", "a", "n1"),
+		verificationPod("b-1", "b", "n1"),
+		verificationPod("c-1", "c", "n2"),
+	}
+	ctrl := controller.New(cfg, fk, &fakeProm{})
+	ctx := context.Background()
+	reconcile := func() {
+		t.Helper()
+		if err := ctrl.ReconcileOnceForTest(ctx); err != nil {
+			t.Fatalf("reconcile error: %v", err)
+		}
+	}
+
+	// The terms decided by the first reconcile are in place from the second.
+	reconcile()
+	reconcile()
+	if r, ok := ruleVerification(ctrl, "c", "b"); !ok || r.State != controller.VerificationPending {
+		t.Fatalf("expected c -> b pending before it settled, got %+v", r)
+	}
+	ctrl.AgeVerificationForTest(time.Hour)
+	reconcile()
+	if r, _ := ruleVerification(ctrl, "b", "a"); r.State != controller.VerificationSatisfied || r.Successes != 1 {
+		t.Fatalf("expected b -> a satisfied, got %+v", r)
+	}
+	c, _ := ruleVerification(ctrl, "c", "b")
+	if c.State != controller.VerificationUnsatisfied || c.Pods != 1 || c.Colocated != 0 || c.Failures != 1 {
+		t.Fatalf("expected c -> b unsatisfied, got %+v", c)
+	}
+
+	// The same placement is not checked twice.
+	reconcile()
+	if c, _ := ruleVerification(ctrl, "c", "b"); c.Failures != 1 {
+		t.Fatalf("expected an unchanged placement not re-checked, got %+v", c)
+	}
+
+	// c is rescheduled and misses b again: the term is relaxed to the zone.
+	fk.pods[2] = verificationPod("c-2", "c", "n3")
+	reconcile()
+	if _, ok := ruleVerification(ctrl, "c", "b"); ok {
+		t.Fatalf("expected the same-node term replaced, got %+v", ctrl.Verification().Rules)
+	}
+	reconcile()
+	c, ok := ruleVerification(ctrl, "c", "b")
+	if !ok || c.TopologyKey != rulegen.ZoneTopologyKey || !c.Escalated {
+		t.Fatalf("expected c -> b escalated to the zone, got %+v", c)
+	}
+	ctrl.AgeVerificationForTest(time.Hour)
+	reconcile()
+	if c, _ := ruleVerification(ctrl, "c", "b"); c.State != controller.VerificationSatisfied || c.Flagged {
+		t.Fatalf("expected the zone term satisfied, got %+v", c)
+	}
+}
+
+func TestController_VerificationFlagsWithoutEscalation(t *testing.T) {
+	cfg, fk := approvalFixture(config.ApprovalConfig{})
+	cfg.Affinity.Verification = config.VerificationConfig{Enabled: true, FailureThreshold: 1}
+	fk.pods = []corev1.Pod{
+		verificationPod("a-1", "a", "n1"),
+		verificationPod("b-1", "b", "n2"),
+		verificationPod("c-1", "c", "n3"),
+	}
+	ctrl := controller.New(cfg, fk, &fakeProm{})
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		if err := ctrl.ReconcileOnceForTest(ctx); err != nil {
+			t.Fatalf("reconcile error: %v", err)
+		}
+	}
+	ctrl.AgeVerificationForTest(time.Hour)
+	if err := ctrl.ReconcileOnceForTest(ctx); err != nil {
+		t.Fatalf("reconcile error: %v", err)
+	}
+	r, ok := ruleVerification(ctrl, "b", "a")
+	if !ok || !r.Flagged || r.TopologyKey != rulegen.HostnameTopologyKey || r.Escalated {
+		t.Fatalf("expected b -> a flagged for review at the node level, got %+v", r)
+	}
+}
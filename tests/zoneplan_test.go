@@ -0,0 +1,184 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"lead-net-affinity/pkg/config"
+	"lead-net-affinity/pkg/controller"
+	promc "lead-net-affinity/pkg/prometheus"
+	"lead-net-affinity/pkg/rulegen"
+)
+
+// zonePlanFixture runs a in z1 only and b in z2 only, with c's four
+// replicas split evenly; a calls b and c, b calls c.
+func zonePlanFixture() (*config.Config, *fakeKube, *fakeProm) {
+	cfg := &config.Config{
+		NamespaceSelector: []string{"test-ns"},
+		Graph: config.ServiceGraphConfig{
+			Entry:    "a",
+			Services: []config.ServiceNode{{Name: "a", DependsOn: []string{"b", "c"}}, {Name: "b", DependsOn: []string{"c"}}, {Name: "c"}},
+		},
+		Prometheus: config.PrometheusConfig{ServicePairRPSQuery: "rps"},
+		Affinity: config.AffinityConfig{
+			TopPaths: 1, MinAffinityWeight: 50, MaxAffinityWeight: 100,
+			ZonePlan: config.ZonePlanConfig{Enabled: true},
+		},
+	}
+	four := int32(4)
+	deploy := func(name string, replicas *int32) appsv1.Deployment {
+		lbls := map[string]string{"io.kompose.service": name}
+		return appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "test-ns", Labels: lbls},
+			Spec: appsv1.DeploymentSpec{Replicas: replicas, Template: corev1.PodTemplateSpec{ObjectMeta: metav1.ObjectMeta{Labels: lbls}}}}
+	}
+	fk := &fakeKube{deploys: []appsv1.Deployment{deploy("a", &four), deploy("b", nil), deploy("c", &four)}}
+	for svc, zones := range map[string][]string{"a": {"z1", "z1"}, "b": {"z2"}, "c": {"z1", "z2", "z1", "z2"}} {
+		for i, z := range zones {
+			fk.pods = append(fk.pods, corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: svc + "-" + strconv.Itoa(i), Namespace: "test-ns",
+					Labels: map[string]string{"io.kompose.service": svc, rulegen.ZoneTopologyKey: z}},
+				Spec:   corev1.PodSpec{NodeName: z + "-node"},
+				Status: corev1.PodStatus{Phase: corev1.PodRunning},
+			})
+		}
+	}
+	fp := &fakeProm{rps: map[promc.ServicePair]float64{{Src: "a", Dst: "c"}: 30, {Src: "b", Dst: "c"}: 10, {Src: "a", Dst: "b"}: 5}}
+	return cfg, fk, fp
+}
+
+func zonePlansByService(t *testing.T, ctrl *controller.Controller) map[string]controller.ZonePlan {
+	t.Helper()
+	if err := ctrl.ReconcileOnceForTest(context.Background()); err != nil {
+		t.Fatalf("reconcile error: %v", err)
+	}
+	out := make(map[string]controller.ZonePlan)
+	for _, p := range ctrl.ZonePlans().Plans {
+		out[p.Service] = p
+	}
+	return out
+}
+
+func TestController_ZonePlan(t *testing.T) {
+	cfg, fk, fp := zonePlanFixture()
+	ctrl := controller.New(cfg, fk, fp)
+	ctrl.EnableDryRunForTest()
+	if err := ctrl.ReconcileOnceForTest(context.Background()); err != nil {
+		t.Fatalf("reconcile error: %v", err)
+	}
+
+	ts := httptest.NewServer(ctrl.Handler())
+	defer ts.Close()
+	resp, err := http.Get(ts.URL + "/zones/plan")
+	if err != nil {
+		t.Fatalf("GET /zones/plan: %v", err)
+	}
+	defer resp.Body.Close()
+	var plans controller.ZonePlans
+	if err := json.NewDecoder(resp.Body).Decode(&plans); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	byService := make(map[string]controller.ZonePlan)
+	for _, p := range plans.Plans {
+		byService[p.Service] = p
+	}
+	if _, ok := byService["a"]; ok {
+		t.Fatalf("expected no plan for the entry service, got %+v", plans.Plans)
+	}
+	// 3/4 of c's traffic comes from z1: 3 of its 4 replicas go there.
+	c := byService["c"]
+	if c.Replicas != 4 || c.Origin != controller.ZoneOriginCallers || c.MaxSkew != 2 || len(c.Zones) != 2 ||
+		c.Zones[0].Zone != "z1" || c.Zones[0].Target != 3 || c.Zones[0].Current != 2 || c.Zones[0].Weight != 50 ||
+		c.Zones[1].Zone != "z2" || c.Zones[1].Target != 1 || c.Zones[1].Weight != 17 {
+		t.Fatalf("unexpected plan for c: %+v", c)
+	}
+	// b's only caller runs in z1; its replica in z2 is planned away.
+	if b := byService["b"]; len(b.Zones) != 2 || b.Zones[0].Target != 1 || b.Zones[1].Zone != "z2" || b.Zones[1].Target != 0 || b.Zones[1].Weight != 0 {
+		t.Fatalf("unexpected plan for b: %+v", b)
+	}
+
+	aff, ok := ctrl.AffinityPreview("c")
+	if !ok || aff.NodeAffinity == nil {
+		t.Fatalf("expected zone node affinity for c, got %+v", aff)
+	}
+	weights := make(map[string]int32)
+	for _, term := range aff.NodeAffinity.PreferredDuringSchedulingIgnoredDuringExecution {
+		weights[term.Preference.MatchExpressions[0].Values[0]] = term.Weight
+	}
+	if len(weights) != 2 || weights["z1"] != 50 || weights["z2"] != 17 {
+		t.Fatalf("expected zone weights z1=50 z2=17, got %v", weights)
+	}
+}
+
+func TestController_ZonePlanFollowsGatewayOrigin(t *testing.T) {
+	cfg, fk, fp := zonePlanFixture()
+	cfg.Prometheus.Gateway.Origin = config.GatewayOrigin{Query: "origin", Zones: map[string]string{"fra": "z1"}}
+	// fra serves z1; mars is no zone of the cluster and is left out.
+	fp.values = map[string]map[string]float64{"origin": {"fra": 60, "z1": 30, "z2": 30, "mars": 100}}
+	ctrl := controller.New(cfg, fk, fp)
+	ctrl.EnableDryRunForTest()
+
+	a := zonePlansByService(t, ctrl)["a"]
+	if a.Origin != controller.ZoneOriginGateway || len(a.Zones) != 2 ||
+		a.Zones[0].Zone != "z1" || a.Zones[0].Target != 3 || a.Zones[1].Zone != "z2" || a.Zones[1].Target != 1 {
+		t.Fatalf("expected a's replicas to follow user traffic 3:1, got %+v", a)
+	}
+
+	// Without origin data the entry service has no callers to follow.
+	fp.values = nil
+	if a, ok := zonePlansByService(t, ctrl)["a"]; ok {
+		t.Fatalf("expected no plan for a without origin data, got %+v", a)
+	}
+}
+
+func TestController_ExternalServiceZones(t *testing.T) {
+	cfg, fk, fp := zonePlanFixture()
+	// c is a managed database in z2, 3ms away from z1.
+	cfg.Graph.Services[2].External = &config.ExternalEndpoint{Zone: "z2", ZoneLatencyMs: map[string]float64{"z1": 3}}
+	cfg.Affinity.ZonePlan.Enabled = false
+	fk.deploys = fk.deploys[:2]
+	ctrl := controller.New(cfg, fk, fp)
+	ctrl.EnableDryRunForTest()
+	if err := ctrl.ReconcileOnceForTest(context.Background()); err != nil {
+		t.Fatalf("reconcile error: %v", err)
+	}
+
+	for svc, want := range map[string]map[string]int32{"a": {"z2": 60, "z1": 15}, "b": {"z2": 60, "z1": 15}} {
+		aff, ok := ctrl.AffinityPreview(svc)
+		if !ok || aff.NodeAffinity == nil {
+			t.Fatalf("expected node affinity toward c for %s, got %+v", svc, aff)
+		}
+		got := make(map[string]int32)
+		for _, term := range aff.NodeAffinity.PreferredDuringSchedulingIgnoredDuringExecution {
+			got[term.Preference.MatchExpressions[0].Values[0]] = term.Weight
+		}
+		if len(got) != 2 || got["z1"] != want["z1"] || got["z2"] != want["z2"] {
+			t.Fatalf("%s: expected zone weights %v, got %v", svc, want, got)
+		}
+	}
+}
+
+func TestApplyZoneSpread_ReplacesEarlierRules(t *testing.T) {
+	d := &appsv1.Deployment{}
+	d.Spec.Template.Spec.TopologySpreadConstraints = []corev1.TopologySpreadConstraint{
+		{MaxSkew: 1, TopologyKey: rulegen.HostnameTopologyKey, WhenUnsatisfiable: corev1.DoNotSchedule},
+	}
+	for _, w := range []int32{80, 40} {
+		rulegen.ApplyZoneSpread(d, rulegen.ZoneSpread{Weights: map[string]int32{"z1": w}, MaxSkew: 3, Selector: map[string]string{"app": "x"}})
+	}
+	tsc := d.Spec.Template.Spec.TopologySpreadConstraints
+	if len(tsc) != 2 || tsc[0].TopologyKey != rulegen.HostnameTopologyKey || tsc[1].MaxSkew != 3 || tsc[1].WhenUnsatisfiable != corev1.ScheduleAnyway {
+		t.Fatalf("expected the hostname constraint kept and one zone constraint, got %+v", tsc)
+	}
+	terms := d.Spec.Template.Spec.Affinity.NodeAffinity.PreferredDuringSchedulingIgnoredDuringExecution
+	if len(terms) != 1 || terms[0].Weight != 40 {
+		t.Fatalf("expected the zone term replaced, got %+v", terms)
+	}
+}